@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/dbehnke/usrp-go/internal/transport"
 	"github.com/dbehnke/usrp-go/pkg/audio"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
@@ -344,6 +345,24 @@ func runClient() {
 		cancel()
 	}()
 
+	// Each Opus packet converts to a burst of USRP frames; pace them out at
+	// 20ms so the receiving node's jitter buffer is not overrun
+	sent := 0
+	paced := transport.NewPacedSender(func(msg usrp.Message) error {
+		data, err := msg.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal USRP message: %w", err)
+		}
+		if _, err := usrpConn.Write(data); err != nil {
+			log.Printf("Failed to send USRP message: %v", err)
+			return err
+		}
+		sent++
+		fmt.Printf("📡 Sent USRP message %d: %d bytes\n", sent, len(data))
+		return nil
+	}, nil)
+	go paced.Run(ctx)
+
 	buffer := make([]byte, 4096)
 	packetCount := 0
 
@@ -377,18 +396,10 @@ func runClient() {
 				continue
 			}
 
-			// Send USRP messages
-			for i, voiceMsg := range usrpMessages {
-				data, err := voiceMsg.Marshal()
-				if err != nil {
-					log.Printf("Failed to marshal USRP message %d: %v", i, err)
-					continue
-				}
-
-				if _, err := usrpConn.Write(data); err != nil {
-					log.Printf("Failed to send USRP message %d: %v", i, err)
-				} else {
-					fmt.Printf("📡 Sent USRP message %d: %d bytes\n", i+1, len(data))
+			// Queue USRP messages for paced sending
+			for _, voiceMsg := range usrpMessages {
+				if err := paced.Send(ctx, voiceMsg); err != nil {
+					return
 				}
 			}
 		}
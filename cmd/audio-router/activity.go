@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// maxHeard is how many transmissions the last-heard table keeps
+	maxHeard = 25
+
+	// talkerTimeout ends a transmission whose source stopped sending
+	// without unkeying
+	talkerTimeout = time.Second
+
+	// levelHold is how long a level reading shows before its meter falls
+	// back to silence
+	levelHold = 250 * time.Millisecond
+
+	// silenceDB is the level of silence, in dBFS
+	silenceDB = -90.0
+)
+
+// Transmission is a transmission in the last-heard table
+type Transmission struct {
+	SourceID   string        `json:"source_id"`
+	SourceName string        `json:"source_name"`
+	CallSign   string        `json:"call_sign,omitempty"`
+	TalkGroup  uint32        `json:"talk_group,omitempty"`
+	Start      time.Time     `json:"start"`
+	Duration   time.Duration `json:"duration"` // Nanoseconds, so far while active
+	Active     bool          `json:"active"`
+}
+
+// AudioLevel is a VU meter reading of a frame of audio, in dBFS
+type AudioLevel struct {
+	RMS  float64 `json:"rms"`
+	Peak float64 `json:"peak"`
+}
+
+// Activity is what the router carries right now: who is talking, who was
+// heard, newest first, and the level of the PCM audio from each service
+type Activity struct {
+	Talkers []Transmission        `json:"talkers"`
+	Heard   []Transmission        `json:"heard"`
+	Levels  map[string]AudioLevel `json:"levels"`
+}
+
+// activityTracker follows the transmissions routed for the dashboard
+type activityTracker struct {
+	mutex  sync.Mutex
+	heard  []*transmission // Newest first
+	levels map[string]levelReading
+}
+
+// transmission is a tracked Transmission and when it was last heard
+type transmission struct {
+	Transmission
+	last time.Time
+}
+
+// levelReading is a service's last level and when it was measured
+type levelReading struct {
+	level AudioLevel
+	at    time.Time
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{levels: make(map[string]levelReading)}
+}
+
+// observe accounts for a message routed at time at
+func (a *activityTracker) observe(msg *AudioMessage, at time.Time) {
+	measured := msg.Format == "pcm" && len(msg.Data) >= 2
+	var level AudioLevel
+	if measured {
+		level = pcmLevel(msg.Data)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if measured {
+		a.levels[msg.SourceID] = levelReading{level: level, at: at}
+	}
+
+	tx := a.active(msg.SourceID, at)
+	if !msg.PTTActive {
+		if tx != nil {
+			tx.Active = false
+			tx.Duration = at.Sub(tx.Start)
+		}
+		return
+	}
+
+	if tx == nil {
+		tx = &transmission{Transmission: Transmission{
+			SourceID:   msg.SourceID,
+			SourceName: msg.SourceName,
+			Start:      at,
+			Active:     true,
+		}}
+		a.heard = append([]*transmission{tx}, a.heard...)
+		if len(a.heard) > maxHeard {
+			a.heard = a.heard[:maxHeard]
+		}
+	}
+	tx.last = at
+	tx.Duration = at.Sub(tx.Start)
+	if msg.CallSign != "" {
+		tx.CallSign = msg.CallSign
+	}
+	if msg.TalkGroup != 0 {
+		tx.TalkGroup = msg.TalkGroup
+	}
+}
+
+// active returns a source's transmission in progress, ending it instead if
+// the source went quiet. Must be called with mutex held.
+func (a *activityTracker) active(source string, at time.Time) *transmission {
+	for _, tx := range a.heard {
+		if tx.SourceID != source || !tx.Active {
+			continue
+		}
+		if at.Sub(tx.last) > talkerTimeout {
+			tx.Active = false
+			return nil
+		}
+		return tx
+	}
+	return nil
+}
+
+// forget drops a stopped service's level meter
+func (a *activityTracker) forget(source string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.levels, source)
+}
+
+// snapshot returns the activity at time at
+func (a *activityTracker) snapshot(at time.Time) Activity {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	activity := Activity{
+		Talkers: []Transmission{},
+		Heard:   make([]Transmission, 0, len(a.heard)),
+		Levels:  make(map[string]AudioLevel, len(a.levels)),
+	}
+	for _, tx := range a.heard {
+		if tx.Active && at.Sub(tx.last) > talkerTimeout {
+			tx.Active = false
+		}
+		activity.Heard = append(activity.Heard, tx.Transmission)
+		if tx.Active {
+			activity.Talkers = append(activity.Talkers, tx.Transmission)
+		}
+	}
+	for source, reading := range a.levels {
+		level := AudioLevel{RMS: silenceDB, Peak: silenceDB}
+		if at.Sub(reading.at) <= levelHold {
+			level = reading.level
+		}
+		activity.Levels[source] = level
+	}
+	return activity
+}
+
+// pcmLevel measures a frame of 16-bit little-endian PCM
+func pcmLevel(data []byte) AudioLevel {
+	samples := len(data) / 2
+	var sum float64
+	var peak int
+	for i := 0; i < samples; i++ {
+		sample := int(int16(binary.LittleEndian.Uint16(data[i*2:])))
+		sum += float64(sample * sample)
+		peak = max(peak, sample, -sample)
+	}
+	return AudioLevel{
+		RMS:  dbfs(math.Sqrt(sum / float64(samples))),
+		Peak: dbfs(float64(peak)),
+	}
+}
+
+// dbfs converts a 16-bit amplitude to dBFS, no quieter than silence
+func dbfs(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return silenceDB
+	}
+	return max(20*math.Log10(amplitude/32768), silenceDB)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbehnke/usrp-go/internal/configfile"
+)
+
+// APIConfig enables the service management API, which adds, edits and
+// removes services while the router runs
+type APIConfig struct {
+	Token string `json:"token"` // Bearer token required by the API (empty = disabled)
+}
+
+// maxServiceBody limits the size of a service sent to the API
+const maxServiceBody = 64 * 1024
+
+// requireToken allows only requests bearing the API token through to next
+func (r *AudioRouter) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.configMux.RLock()
+		var want string
+		if r.config.API != nil {
+			want = r.config.API.Token
+		}
+		r.configMux.RUnlock()
+		if want == "" {
+			http.Error(w, "service management API is disabled", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// handleListServices lists the configured services, enabled or not, with
+// their secrets redacted
+func (r *AudioRouter) handleListServices(w http.ResponseWriter, req *http.Request) {
+	r.configMux.RLock()
+	config, err := sanitizeConfig(r.config)
+	r.configMux.RUnlock()
+	if err != nil {
+		http.Error(w, "failed to encode services", http.StatusInternalServerError)
+		log.Printf("encode services error: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, config.Services)
+}
+
+// handleGetService shows a configured service with its secrets redacted
+func (r *AudioRouter) handleGetService(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+
+	r.configMux.RLock()
+	defer r.configMux.RUnlock()
+	i := r.serviceIndex(id)
+	if i < 0 {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	r.writeService(w, http.StatusOK, &r.config.Services[i])
+}
+
+// handleCreateService adds a service, starting it if it is enabled
+func (r *AudioRouter) handleCreateService(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+
+	var service ServiceInstance
+	if err := decodeService(w, req, &service); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if service.ID == "" {
+		service.ID = id
+	}
+	if service.ID != id {
+		http.Error(w, "service id does not match the path", http.StatusBadRequest)
+		return
+	}
+	if err := unredactService(&service, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.configMux.Lock()
+	defer r.configMux.Unlock()
+	if r.serviceIndex(id) >= 0 {
+		http.Error(w, "service already exists", http.StatusConflict)
+		return
+	}
+	services := append(append([]ServiceInstance(nil), r.config.Services...), service)
+	if status, err := r.updateServices(id, services); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("API added service %s", id)
+	r.writeService(w, http.StatusCreated, &r.config.Services[len(r.config.Services)-1])
+}
+
+// handleUpdateService merges the fields sent into a service, restarting
+// it; {"enabled": false} disables a service and {"enabled": true} enables
+// it again
+func (r *AudioRouter) handleUpdateService(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+
+	r.configMux.Lock()
+	defer r.configMux.Unlock()
+	i := r.serviceIndex(id)
+	if i < 0 {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	// Merge into a deep copy, so a failed edit leaves the running service
+	// as it was
+	data, err := json.Marshal(&r.config.Services[i])
+	if err != nil {
+		http.Error(w, "failed to encode service", http.StatusInternalServerError)
+		return
+	}
+	var service ServiceInstance
+	if err := json.Unmarshal(data, &service); err != nil {
+		http.Error(w, "failed to decode service", http.StatusInternalServerError)
+		return
+	}
+	if err := decodeService(w, req, &service); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if service.ID != id {
+		http.Error(w, "service id cannot be changed", http.StatusBadRequest)
+		return
+	}
+	if err := unredactService(&service, &r.config.Services[i]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	services := append([]ServiceInstance(nil), r.config.Services...)
+	services[i] = service
+	if status, err := r.updateServices(id, services); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("API updated service %s (enabled: %v)", id, service.Enabled)
+	r.writeService(w, http.StatusOK, &r.config.Services[i])
+}
+
+// handleDeleteService stops and removes a service
+func (r *AudioRouter) handleDeleteService(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+
+	r.configMux.Lock()
+	defer r.configMux.Unlock()
+	i := r.serviceIndex(id)
+	if i < 0 {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	services := append(append([]ServiceInstance(nil), r.config.Services[:i]...), r.config.Services[i+1:]...)
+	if status, err := r.updateServices(id, services); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("API removed service %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeService decodes a service from a request body into service,
+// rejecting fields a ServiceInstance does not have
+func decodeService(w http.ResponseWriter, req *http.Request, service *ServiceInstance) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxServiceBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(service); err != nil {
+		return fmt.Errorf("invalid service: %w", err)
+	}
+	return nil
+}
+
+// unredactService puts back the secrets of previous that a service sent
+// to the API still has redacted, as it will after an edit of what the API
+// showed, so they are not saved as the placeholder. A redacted secret
+// previous does not have is an error.
+func unredactService(service, previous *ServiceInstance) error {
+	if previous == nil {
+		previous = &ServiceInstance{}
+	}
+	if service.Encryption != nil && service.Encryption.Key == redacted {
+		if previous.Encryption == nil || previous.Encryption.Key == "" {
+			return fmt.Errorf("invalid service: encryption key is %s", redacted)
+		}
+		service.Encryption.Key = previous.Encryption.Key
+	}
+	if proxy, err := url.Parse(service.Proxy); err == nil && proxy.User != nil {
+		if password, _ := proxy.User.Password(); password == redactedPassword {
+			if old, err := url.Parse(previous.Proxy); err != nil || old.User == nil || old.Redacted() != service.Proxy {
+				return fmt.Errorf("invalid service: proxy password is redacted")
+			}
+			service.Proxy = previous.Proxy
+		}
+	}
+	for name, value := range service.Settings {
+		if value != redacted {
+			continue
+		}
+		old, ok := previous.Settings[name]
+		if !ok || old == redacted {
+			return fmt.Errorf("invalid service: setting %s is %s", name, redacted)
+		}
+		service.Settings[name] = old
+	}
+	return nil
+}
+
+// serviceIndex returns the index of a service in the configuration, or -1.
+// Must be called with configMux held.
+func (r *AudioRouter) serviceIndex(id string) int {
+	for i := range r.config.Services {
+		if r.config.Services[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeService writes a service as a JSON response with its secrets
+// redacted
+func (r *AudioRouter) writeService(w http.ResponseWriter, status int, service *ServiceInstance) {
+	data, err := json.Marshal(service)
+	if err != nil {
+		http.Error(w, "failed to encode service", http.StatusInternalServerError)
+		return
+	}
+	var sanitized ServiceInstance
+	if err := json.Unmarshal(data, &sanitized); err != nil {
+		http.Error(w, "failed to encode service", http.StatusInternalServerError)
+		return
+	}
+	redactService(&sanitized)
+	writeJSON(w, status, &sanitized)
+}
+
+// updateServices makes services the router's services after a change to
+// the service id: the new list is validated, the service is stopped and,
+// if it is still there and enabled, started again as configured now, and
+// the configuration is saved. A config file the change could not be saved
+// to is refused first. On failure the running services are left as they
+// were, and the HTTP status to answer with is returned. Must be called
+// with configMux held.
+//
+// services must be a new slice: running services keep pointers into the
+// old one.
+func (r *AudioRouter) updateServices(id string, services []ServiceInstance) (int, error) {
+	if r.configFile != "" {
+		if err := configfile.Rewritable(r.configFile); err != nil {
+			return http.StatusConflict, fmt.Errorf("cannot save changes, edit the config file by hand: %w", err)
+		}
+	}
+
+	candidate := *r.config
+	candidate.Services = services
+	if err := validateConfig(&candidate); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var previous, next *ServiceInstance
+	if i := r.serviceIndex(id); i >= 0 {
+		previous = &r.config.Services[i]
+	}
+	for i := range candidate.Services {
+		if candidate.Services[i].ID == id {
+			next = &candidate.Services[i]
+		}
+	}
+
+	wasRunning := r.stopService(id)
+	if next != nil && next.Enabled {
+		if err := r.startService(next); err != nil {
+			if wasRunning {
+				if err := r.startService(previous); err != nil {
+					log.Printf("Failed to restart service %s: %v", id, err)
+				}
+			}
+			return http.StatusInternalServerError, fmt.Errorf("failed to start service: %w", err)
+		}
+	}
+	r.config.Services = candidate.Services
+
+	if err := r.saveConfig(); err != nil {
+		log.Printf("Failed to save config: %v", err)
+		return http.StatusInternalServerError, fmt.Errorf("service changed but not saved: %w", err)
+	}
+	return 0, nil
+}
+
+// saveConfig writes the configuration back to the file it was loaded from,
+// replacing it atomically so a crash cannot leave it half written
+func (r *AudioRouter) saveConfig() error {
+	if r.configFile == "" {
+		return nil
+	}
+	if err := configfile.Rewritable(r.configFile); err != nil {
+		return fmt.Errorf("edit the config file by hand: %w", err)
+	}
+
+	data, err := json.MarshalIndent(r.config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	data = append(data, '\n')
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(r.configFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.configFile), "."+filepath.Base(r.configFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.configFile); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFiles signals on the returned channel when any of the files at
+// paths is written or replaced, until ctx is done. It watches the files'
+// directories with inotify, so files replaced by renaming over them, as
+// editors and the service management API do, are noticed too.
+func watchFiles(ctx context.Context, paths []string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	dirs := make(map[int32]string) // Directory by watch descriptor
+	watched := make(map[string]bool)
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		watched[path] = true
+		dir := filepath.Dir(path)
+		wd, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO)
+		if err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		dirs[int32(wd)] = dir
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer unix.Close(fd)
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for ctx.Err() == nil {
+			// Poll with a timeout so a cancelled ctx is noticed
+			if n, err := unix.Poll(fds, 500); err != nil && err != unix.EINTR {
+				log.Printf("Config file watch error: %v", err)
+				return
+			} else if n <= 0 {
+				continue
+			}
+			n, err := unix.Read(fd, buf)
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				log.Printf("Config file watch error: %v", err)
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + unix.SizeofInotifyEvent
+				offset = start + int(event.Len)
+				name := string(bytes.TrimRight(buf[start:offset], "\x00"))
+				if !watched[filepath.Join(dirs[event.Wd], name)] {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
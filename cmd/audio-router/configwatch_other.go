@@ -0,0 +1,56 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// configPollInterval is how often the config file is checked for changes
+// where inotify is not available
+const configPollInterval = 2 * time.Second
+
+// watchFiles signals on the returned channel when any of the files at
+// paths changes size or modification time, until ctx is done
+func watchFiles(ctx context.Context, paths []string) (<-chan struct{}, error) {
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		infos[i] = info
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			changed := false
+			for i, path := range paths {
+				latest, err := os.Stat(path)
+				if err != nil || (latest.ModTime().Equal(infos[i].ModTime()) && latest.Size() == infos[i].Size()) {
+					continue
+				}
+				infos[i] = latest
+				changed = true
+			}
+			if !changed {
+				continue
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
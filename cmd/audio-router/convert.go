@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// pcmStream is one stream of PCM on its way between a service's sample
+// rate and channel count and USRP's 8kHz mono: the resampler, and on the
+// way in the samples still short of a voice frame
+type pcmStream struct {
+	resampler *audio.ChannelResampler
+	pending   []int16
+}
+
+// converterPoolConfig returns the settings of every converter pool
+func converterPoolConfig(config *AudioRouterConfig) *audio.ConverterPoolConfig {
+	poolConfig := audio.DefaultConverterPoolConfig()
+	if config.Audio.MaxConverters > 0 {
+		poolConfig.MaxConverters = config.Audio.MaxConverters
+	}
+	return poolConfig
+}
+
+// converterPool returns the pool of a format's converters, creating it on
+// first use
+func (r *AudioRouter) converterPool(format string) (*audio.ConverterPool, error) {
+	r.convertMux.Lock()
+	defer r.convertMux.Unlock()
+
+	if pool, ok := r.formatPools[format]; ok {
+		return pool, nil
+	}
+	factory, err := converterFactory(format, nativeOpusConfig(r.config), r.config.Audio.FFmpeg)
+	if err != nil {
+		return nil, err
+	}
+	pool := audio.NewConverterPool(r.meterConverters(format, factory), converterPoolConfig(r.config))
+	r.formatPools[format] = pool
+	return pool, nil
+}
+
+// encoderStream names the stream of a talker's audio to one destination.
+// Each destination gets its own encoder: encoders keep state between
+// frames.
+func encoderStream(sourceID, destID string) string {
+	return sourceID + ">" + destID
+}
+
+// endStreams closes the converters and resamplers of a talker's
+// transmission to destinations, once it has unkeyed
+func (r *AudioRouter) endStreams(sourceID string, destinations []*ServiceConnection) {
+	ids := []string{sourceID}
+	for _, dest := range destinations {
+		ids = append(ids, encoderStream(sourceID, dest.Instance.ID))
+	}
+
+	r.convertMux.Lock()
+	defer r.convertMux.Unlock()
+	for _, id := range ids {
+		for _, pool := range r.formatPools {
+			pool.Release(id)
+		}
+		delete(r.pcmStreams, id)
+	}
+}
+
+// pcmStreamFor returns a stream's PCM state, resampling from inRate and
+// inChannels to outRate and outChannels, creating it on first use
+func (r *AudioRouter) pcmStreamFor(id string, inRate, inChannels, outRate, outChannels int) (*pcmStream, error) {
+	r.convertMux.Lock()
+	defer r.convertMux.Unlock()
+
+	if stream, ok := r.pcmStreams[id]; ok {
+		return stream, nil
+	}
+	stream := &pcmStream{}
+	if inRate != outRate || inChannels != outChannels {
+		mix, err := audio.DefaultChannelMatrix(inChannels, outChannels)
+		if err != nil {
+			return nil, err
+		}
+		if stream.resampler, err = audio.NewChannelResampler(inRate, outRate, mix, ""); err != nil {
+			return nil, err
+		}
+	}
+	r.pcmStreams[id] = stream
+	return stream, nil
+}
+
+// pcmLayout returns a sample rate and channel count, taking unset ones as
+// USRP's
+func pcmLayout(rate, channels int) (int, int) {
+	if rate <= 0 {
+		rate = audio.USRPSampleRate
+	}
+	if channels <= 0 {
+		channels = 1
+	}
+	return rate, channels
+}
+
+// voiceFrames returns a message's audio as USRP voice frames. It is
+// decoded the first time it is asked for and shared by every destination,
+// as the decoder keeps state from one message to the next. At unkey the
+// frames include what the decoder held back.
+func (r *AudioRouter) voiceFrames(msg *AudioMessage) ([]*usrp.VoiceMessage, error) {
+	if !msg.decoded {
+		msg.frames, msg.decodeErr = r.decodeFrames(msg)
+		msg.decoded = true
+	}
+	return msg.frames, msg.decodeErr
+}
+
+func (r *AudioRouter) decodeFrames(msg *AudioMessage) ([]*usrp.VoiceMessage, error) {
+	if msg.Format != "pcm" {
+		if r.converters == nil {
+			return nil, fmt.Errorf("cannot convert %s audio with conversion disabled", msg.Format)
+		}
+		pool, err := r.converterPool(msg.Format)
+		if err != nil {
+			return nil, err
+		}
+		converter, err := pool.Get(msg.SourceID)
+		if err != nil {
+			return nil, err
+		}
+		frames, err := converter.FormatToUSRP(msg.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s audio: %w", msg.Format, err)
+		}
+		if !msg.PTTActive {
+			_, tail, err := pool.Flush(msg.SourceID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to flush %s decoder: %w", msg.Format, err)
+			}
+			frames = append(frames, tail...)
+		}
+		return frames, nil
+	}
+
+	samples := pcmSamples(msg.Data)
+	rate, channels := pcmLayout(msg.SampleRate, msg.Channels)
+	if rate == audio.USRPSampleRate && channels == 1 && len(samples) == usrp.VoiceFrameSize {
+		// A frame already, as from USRP
+		voice := &usrp.VoiceMessage{}
+		copy(voice.AudioData[:], samples)
+		return []*usrp.VoiceMessage{voice}, nil
+	}
+
+	stream, err := r.pcmStreamFor(msg.SourceID, rate, channels, audio.USRPSampleRate, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resample %dHz audio: %w", rate, err)
+	}
+	if stream.resampler != nil {
+		samples = stream.resampler.Process(samples)
+	}
+	samples = append(stream.pending, samples...)
+
+	var frames []*usrp.VoiceMessage
+	for len(samples) >= usrp.VoiceFrameSize {
+		voice := &usrp.VoiceMessage{}
+		copy(voice.AudioData[:], samples)
+		frames = append(frames, voice)
+		samples = samples[usrp.VoiceFrameSize:]
+	}
+	if !msg.PTTActive && len(samples) > 0 {
+		// The last frame, padded with silence
+		voice := &usrp.VoiceMessage{}
+		copy(voice.AudioData[:], samples)
+		frames = append(frames, voice)
+		samples = nil
+	}
+	stream.pending = append([]int16(nil), samples...)
+	return frames, nil
+}
+
+// encodeFor returns a message's audio as packets in a destination's format
+// and, for PCM, its sample rate and channel count. Audio already in that
+// form, or routed with conversion disabled, passes through as it is.
+func (r *AudioRouter) encodeFor(msg *AudioMessage, conn *ServiceConnection) ([][]byte, error) {
+	service := conn.Instance
+	if r.converters == nil || sameAudioFormat(msg, service) {
+		return [][]byte{msg.Data}, nil
+	}
+
+	frames, err := r.voiceFrames(msg)
+	if err != nil {
+		return nil, err
+	}
+	id := encoderStream(msg.SourceID, service.ID)
+
+	if service.Audio.Format == "pcm" {
+		var samples []int16
+		for _, frame := range frames {
+			samples = append(samples, frame.AudioData[:]...)
+		}
+		rate, channels := pcmLayout(service.Audio.SampleRate, service.Audio.Channels)
+		if rate != audio.USRPSampleRate || channels != 1 {
+			stream, err := r.pcmStreamFor(id, audio.USRPSampleRate, 1, rate, channels)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resample to %dHz: %w", rate, err)
+			}
+			samples = stream.resampler.Process(samples)
+		}
+		if len(samples) == 0 {
+			return nil, nil
+		}
+		return [][]byte{pcmBytes(samples)}, nil
+	}
+
+	pool, err := r.converterPool(service.Audio.Format)
+	if err != nil {
+		return nil, err
+	}
+	converter, err := pool.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	var packets [][]byte
+	for _, frame := range frames {
+		data, err := converter.USRPToFormat(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s audio: %w", service.Audio.Format, err)
+		}
+		if len(data) > 0 {
+			packets = append(packets, data)
+		}
+	}
+	if !msg.PTTActive {
+		tail, _, err := pool.Flush(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to flush %s encoder: %w", service.Audio.Format, err)
+		}
+		if len(tail) > 0 {
+			packets = append(packets, tail)
+		}
+	}
+	return packets, nil
+}
+
+// sameAudioFormat reports whether a message's audio is already in a
+// service's format, sample rate and channel count
+func sameAudioFormat(msg *AudioMessage, service *ServiceInstance) bool {
+	if msg.Format != service.Audio.Format {
+		return false
+	}
+	if msg.Format != "pcm" {
+		return true // Encoded formats carry their own rate
+	}
+	msgRate, msgChannels := pcmLayout(msg.SampleRate, msg.Channels)
+	rate, channels := pcmLayout(service.Audio.SampleRate, service.Audio.Channels)
+	return msgRate == rate && msgChannels == channels
+}
+
+// pcmSamples reads little-endian 16-bit samples
+func pcmSamples(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples
+}
+
+// pcmBytes writes samples as little-endian 16-bit PCM
+func pcmBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/internal/transport"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// newConvertRouter creates a router converting to and from services,
+// registered but not started
+func newConvertRouter(t *testing.T, services ...ServiceInstance) *AudioRouter {
+	t.Helper()
+	config := defaultConfig()
+	config.Audio.DefaultFormat = "ulaw"
+	config.Services = services
+	if err := validateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewAudioRouter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Stop() })
+	for i := range config.Services {
+		conn := &ServiceConnection{
+			Instance:         &config.Services[i],
+			shaper:           transport.NewShaper(nil),
+			talkGroupRewrite: parseTalkGroupRewrite(config.Services[i].TalkGroupRewrite),
+		}
+		if config.Services[i].Network.RemoteAddr != "" {
+			conn.outbound = newOutboundLink(&config.Services[i])
+		}
+		r.services[config.Services[i].ID] = conn
+	}
+	return r
+}
+
+// listener returns a UDP socket for a service to send to, and a service
+// sending to it
+func listener(t *testing.T, id string, serviceType ServiceType, format string) (net.PacketConn, ServiceInstance) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	service := ServiceInstance{ID: id, Type: serviceType, Enabled: true}
+	service.Audio.Format = format
+	service.Routing.CanReceive = true
+	service.Network.RemoteAddr = "127.0.0.1"
+	service.Network.RemotePort = pc.LocalAddr().(*net.UDPAddr).Port
+	return pc, service
+}
+
+// receive reads the packets a listener gets until it goes quiet
+func receive(t *testing.T, pc net.PacketConn) [][]byte {
+	t.Helper()
+	var packets [][]byte
+	buf := make([]byte, 65536)
+	for {
+		pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// tone returns a frame of a 1kHz tone
+func tone() []int16 {
+	samples := make([]int16, usrp.VoiceFrameSize)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*1000*float64(i)/audio.USRPSampleRate))
+	}
+	return samples
+}
+
+func TestConvert_PCMToULaw(t *testing.T) {
+	pc, dest := listener(t, "sip", ServiceTypeGeneric, "ulaw")
+	r := newConvertRouter(t, ServiceInstance{ID: "allstar", Type: ServiceTypeUSRP, Enabled: true}, dest)
+
+	samples := tone()
+	r.routeAudioMessage(&AudioMessage{SourceID: "allstar", Format: "pcm", SampleRate: 8000, Channels: 1,
+		Data: pcmBytes(samples), PTTActive: true})
+
+	packets := receive(t, pc)
+	if len(packets) != 1 || len(packets[0]) != usrp.VoiceFrameSize {
+		t.Fatalf("Received %d packets, want one frame of G.711", len(packets))
+	}
+	decoded := audio.DecodeG711(audio.G711Law("ulaw"), make([]int16, usrp.VoiceFrameSize), packets[0])
+	for i := range samples {
+		if diff := math.Abs(float64(decoded[i]) - float64(samples[i])); diff > 300 {
+			t.Fatalf("Sample %d decoded to %d, sent %d", i, decoded[i], samples[i])
+		}
+	}
+}
+
+func TestConvert_PCMToWhoTalkieOpus(t *testing.T) {
+	pc, dest := listener(t, "whotalkie", ServiceTypeWhoTalkie, "opus-native")
+	r := newConvertRouter(t, ServiceInstance{ID: "allstar", Type: ServiceTypeUSRP, Enabled: true}, dest)
+
+	for i := 0; i < 10; i++ {
+		r.routeAudioMessage(&AudioMessage{SourceID: "allstar", Format: "pcm", SampleRate: 8000, Channels: 1,
+			Data: pcmBytes(tone()), PTTActive: i < 9})
+	}
+
+	decoder, err := audio.NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+	frames := 0
+	for _, packet := range receive(t, pc) {
+		voices, err := decoder.FormatToUSRP(packet)
+		if err != nil {
+			t.Fatalf("Packet is not Opus: %v", err)
+		}
+		frames += len(voices)
+	}
+	if frames < 8 {
+		t.Errorf("Decoded %d frames of 10 sent", frames)
+	}
+}
+
+func TestConvert_ULawToUSRP(t *testing.T) {
+	pc, dest := listener(t, "allstar", ServiceTypeUSRP, "pcm")
+	source := ServiceInstance{ID: "phone", Type: ServiceTypeGeneric, Enabled: true}
+	source.Audio.Format = "ulaw"
+	r := newConvertRouter(t, source, dest)
+
+	// A frame and a half, the half held back until the unkey
+	samples := append(tone(), tone()[:80]...)
+	data := audio.EncodeG711(audio.G711Law("ulaw"), make([]byte, len(samples)), samples)
+	r.routeAudioMessage(&AudioMessage{SourceID: "phone", Format: "ulaw", Data: data, PTTActive: true, TalkGroup: 91})
+	r.routeAudioMessage(&AudioMessage{SourceID: "phone", Format: "ulaw", PTTActive: false, TalkGroup: 91})
+
+	var voices []*usrp.VoiceMessage
+	for _, packet := range receive(t, pc) {
+		msg, err := usrp.Parse(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		voices = append(voices, msg.(*usrp.VoiceMessage))
+	}
+	if len(voices) != 2 {
+		t.Fatalf("Received %d voice packets, want 2", len(voices))
+	}
+	if !voices[0].Header.IsPTT() || voices[1].Header.IsPTT() || voices[0].Header.TalkGroup != 91 {
+		t.Errorf("Headers %+v, %+v", voices[0].Header, voices[1].Header)
+	}
+	if diff := math.Abs(float64(voices[0].AudioData[40]) - float64(samples[40])); diff > 300 {
+		t.Errorf("Sample decoded to %d, sent %d", voices[0].AudioData[40], samples[40])
+	}
+	if voices[1].AudioData[79] == 0 || voices[1].AudioData[80] != 0 {
+		t.Error("Last frame not the held half frame padded with silence")
+	}
+
+	// The unkey closed the talker's converters
+	if n := r.formatPools["ulaw"].Len(); n != 0 {
+		t.Errorf("%d converters open after unkey", n)
+	}
+}
+
+func TestConvert_PCMRates(t *testing.T) {
+	pc, dest := listener(t, "discord", ServiceTypeGeneric, "pcm")
+	dest.Audio.SampleRate = 48000
+	dest.Audio.Channels = 2
+	r := newConvertRouter(t, ServiceInstance{ID: "allstar", Type: ServiceTypeUSRP, Enabled: true}, dest)
+
+	for i := 0; i < 5; i++ {
+		r.routeAudioMessage(&AudioMessage{SourceID: "allstar", Format: "pcm", SampleRate: 8000, Channels: 1,
+			Data: pcmBytes(tone()), PTTActive: true})
+	}
+	samples := 0
+	for _, packet := range receive(t, pc) {
+		samples += len(packet) / 2
+	}
+	// 100ms of 48kHz stereo, less the resampler's delay
+	if want := 5 * usrp.VoiceFrameSize * 6 * 2; samples > want || samples < want*9/10 {
+		t.Errorf("Received %d samples, want about %d", samples, want)
+	}
+
+	// The same audio in the destination's form passes through
+	msg := &AudioMessage{Format: "pcm", SampleRate: 48000, Channels: 2}
+	if !sameAudioFormat(msg, r.services["discord"].Instance) {
+		t.Error("48kHz stereo PCM converted to itself")
+	}
+}
+
+func TestConvert_Disabled(t *testing.T) {
+	pc, dest := listener(t, "sip", ServiceTypeGeneric, "ulaw")
+	r := newConvertRouter(t, ServiceInstance{ID: "allstar", Type: ServiceTypeUSRP, Enabled: true}, dest)
+	r.converters = nil
+
+	data := pcmBytes(tone())
+	r.routeAudioMessage(&AudioMessage{SourceID: "allstar", Format: "pcm", Data: data, PTTActive: true})
+	if packets := receive(t, pc); len(packets) != 1 || len(packets[0]) != len(data) {
+		t.Errorf("Received %d packets, want the PCM as it was", len(packets))
+	}
+}
+
+func TestConvert_InvalidFormat(t *testing.T) {
+	config := defaultConfig()
+	config.Services[0].Audio.Format = "speex"
+	if err := validateConfig(config); err == nil {
+		t.Error("Unknown service format accepted")
+	}
+}
+
+func TestSendToService_ShapedUnkey(t *testing.T) {
+	pc, dest := listener(t, "allstar", ServiceTypeUSRP, "pcm")
+	r := newConvertRouter(t, ServiceInstance{ID: "bm", Type: ServiceTypeUSRP, Enabled: true}, dest)
+	conn := r.services["allstar"]
+	conn.shaper = transport.NewShaper(&transport.ShaperConfig{MaxPPS: 1, Burst: 1})
+
+	for i := 0; i < 3; i++ {
+		r.routeAudioMessage(&AudioMessage{SourceID: "bm", Format: "pcm", Data: pcmBytes(tone()), PTTActive: i < 2})
+	}
+	var keyed []bool
+	for _, packet := range receive(t, pc) {
+		msg, err := usrp.Parse(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyed = append(keyed, msg.(*usrp.VoiceMessage).Header.IsPTT())
+	}
+	if len(keyed) != 2 || !keyed[0] || keyed[1] {
+		t.Errorf("Received PTT %v, want the first frame and the unkey", keyed)
+	}
+	if conn.Stats.Shaped != 1 {
+		t.Errorf("Shaped %d frames, want 1", conn.Stats.Shaped)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dashboardHTML is the single-page dashboard served at /
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+const (
+	// liveInterval is how often /ws sends the router's activity
+	liveInterval = 100 * time.Millisecond
+
+	// liveWriteTimeout drops dashboards that stop reading
+	liveWriteTimeout = 5 * time.Second
+)
+
+// upgrader upgrades /ws requests from pages served by the router itself
+var upgrader = websocket.Upgrader{}
+
+// RoutingMatrix shows where the audio of each running service goes
+type RoutingMatrix struct {
+	Services   []string            `json:"services"`
+	Routes     map[string][]string `json:"routes"`                // Source ID -> destination IDs, on talkgroups no talkgroup route names
+	TalkGroups []TalkGroupMatrix   `json:"talk_groups,omitempty"` // Where audio goes on the talkgroups of each talkgroup route
+}
+
+// TalkGroupMatrix shows where the audio of each running service goes on
+// the talkgroups of a talkgroup route, taking the first as their example
+type TalkGroupMatrix struct {
+	TalkGroups string              `json:"talk_groups"`
+	Routes     map[string][]string `json:"routes"` // Source ID -> destination IDs
+}
+
+// handleDashboard serves the dashboard
+func handleDashboard(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+// handleActivity reports who is talking, who was heard and the audio
+// levels, as /ws streams them
+func (r *AudioRouter) handleActivity(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, r.activity.snapshot(time.Now()))
+}
+
+// handleRouting reports the routing matrix of the running services
+func (r *AudioRouter) handleRouting(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, r.routingMatrix())
+}
+
+// routingMatrix works out which running services a transmission from each
+// running service is routed to, by the services' routing rules, on the
+// talkgroups no talkgroup route names and on those of each route
+func (r *AudioRouter) routingMatrix() RoutingMatrix {
+	r.rulesMux.RLock()
+	talkGroups := r.talkGroups
+	unrouted := r.unroutedTalkGroup()
+	r.rulesMux.RUnlock()
+
+	r.servicesMux.RLock()
+	defer r.servicesMux.RUnlock()
+
+	matrix := RoutingMatrix{Services: make([]string, 0, len(r.services))}
+	for id := range r.services {
+		matrix.Services = append(matrix.Services, id)
+	}
+	sort.Strings(matrix.Services)
+
+	matrix.Routes = r.routesOn(matrix.Services, unrouted)
+	for _, route := range talkGroups {
+		matrix.TalkGroups = append(matrix.TalkGroups, TalkGroupMatrix{
+			TalkGroups: route.spec,
+			Routes:     r.routesOn(matrix.Services, route.ranges[0].first),
+		})
+	}
+	return matrix
+}
+
+// routesOn works out where a transmission on a talkgroup from each of the
+// services goes. Must be called with servicesMux held.
+func (r *AudioRouter) routesOn(services []string, tg uint32) map[string][]string {
+	routes := make(map[string][]string, len(services))
+	for _, source := range services {
+		msg := &AudioMessage{SourceID: source, PTTActive: true, TalkGroup: tg}
+		destinations := []string{}
+		for _, dest := range services {
+			if r.routes(r.services[source].Instance, r.services[dest].Instance, msg) {
+				destinations = append(destinations, dest)
+			}
+		}
+		routes[source] = destinations
+	}
+	return routes
+}
+
+// handleLive streams the router's activity over a WebSocket, every
+// liveInterval, until the dashboard goes away
+func (r *AudioRouter) handleLive(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return // The upgrader has replied
+	}
+	defer conn.Close()
+
+	// Reading handles pings and notices the dashboard closing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(liveInterval)
+	defer ticker.Stop()
+	for {
+		conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		if err := conn.WriteJSON(r.activity.snapshot(time.Now())); err != nil {
+			return
+		}
+		select {
+		case <-closed:
+			return
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pcmFrame returns a frame of 16-bit PCM with every sample at amplitude,
+// alternating in sign
+func pcmFrame(amplitude int16) []byte {
+	data := make([]byte, 320)
+	for i := 0; i < len(data)/2; i++ {
+		sample := amplitude
+		if i%2 == 1 {
+			sample = -amplitude
+		}
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+func TestActivityTracker(t *testing.T) {
+	a := newActivityTracker()
+	start := time.Now()
+	key := func(source string, ptt bool, at time.Duration) {
+		a.observe(&AudioMessage{SourceID: source, SourceName: strings.ToUpper(source), Format: "pcm",
+			Data: pcmFrame(16384), PTTActive: ptt, CallSign: "W1AW", TalkGroup: 91}, start.Add(at))
+	}
+
+	key("usrp_1", true, 0)
+	key("usrp_1", true, 500*time.Millisecond)
+	activity := a.snapshot(start.Add(600 * time.Millisecond))
+	if len(activity.Talkers) != 1 || activity.Talkers[0].CallSign != "W1AW" || activity.Talkers[0].Duration != 500*time.Millisecond {
+		t.Fatalf("Talkers %+v", activity.Talkers)
+	}
+	if level := activity.Levels["usrp_1"]; level.Peak < -6.1 || level.Peak > -6 || level.RMS != level.Peak {
+		t.Errorf("Level %+v, want -6 dBFS", level)
+	}
+
+	// Unkey ends the transmission, and the meter falls back to silence
+	key("usrp_1", false, time.Second)
+	activity = a.snapshot(start.Add(2 * time.Second))
+	if len(activity.Talkers) != 0 || len(activity.Heard) != 1 || activity.Heard[0].Active || activity.Heard[0].Duration != time.Second {
+		t.Errorf("Activity %+v after unkey", activity)
+	}
+	if level := activity.Levels["usrp_1"]; level.RMS != silenceDB {
+		t.Errorf("Level %+v after unkey", level)
+	}
+
+	// A talker that goes quiet without unkeying times out, and keying
+	// again starts a new transmission
+	key("discord_1", true, 3*time.Second)
+	if activity = a.snapshot(start.Add(3*time.Second + talkerTimeout*2)); len(activity.Talkers) != 0 {
+		t.Errorf("Talkers %+v after timeout", activity.Talkers)
+	}
+	key("discord_1", true, 6*time.Second)
+	activity = a.snapshot(start.Add(6 * time.Second))
+	if len(activity.Heard) != 3 || activity.Heard[0].SourceName != "DISCORD_1" || !activity.Heard[0].Active {
+		t.Errorf("Heard %+v", activity.Heard)
+	}
+
+	for i := 0; i < maxHeard; i++ {
+		key("usrp_1", true, 10*time.Second)
+		key("usrp_1", false, 10*time.Second)
+	}
+	if activity = a.snapshot(start.Add(10 * time.Second)); len(activity.Heard) != maxHeard {
+		t.Errorf("Heard %d transmissions, want %d", len(activity.Heard), maxHeard)
+	}
+
+	a.forget("usrp_1")
+	if _, ok := a.snapshot(start).Levels["usrp_1"]; ok {
+		t.Error("Forgotten service still metered")
+	}
+}
+
+func TestPCMLevel(t *testing.T) {
+	if level := pcmLevel(make([]byte, 320)); level.RMS != silenceDB || level.Peak != silenceDB {
+		t.Errorf("Silence %+v", level)
+	}
+	if level := pcmLevel(pcmFrame(-32768)); level.Peak != 0 {
+		t.Errorf("Full scale %+v", level)
+	}
+}
+
+func TestStatusServer_Routing(t *testing.T) {
+	r := newTestRouter(t)
+	for _, conn := range r.services {
+		conn.Instance.Enabled = true
+		conn.Instance.Routing.CanReceive = true
+	}
+	r.services["usrp_1"].Instance.Routing.ExcludeServices = []string{"discord_1"}
+
+	var matrix RoutingMatrix
+	get(t, r, "/routing", &matrix)
+	if len(matrix.Services) != 2 || len(matrix.Routes["usrp_1"]) != 0 ||
+		len(matrix.Routes["discord_1"]) != 1 || matrix.Routes["discord_1"][0] != "usrp_1" {
+		t.Errorf("Matrix %+v", matrix)
+	}
+}
+
+func TestStatusServer_Dashboard(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := get(t, r, "/", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "new WebSocket") {
+		t.Errorf("Dashboard %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := get(t, r, "/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown path gave %d", w.Code)
+	}
+
+	r.activity.observe(&AudioMessage{SourceID: "usrp_1", PTTActive: true, CallSign: "W1AW"}, time.Now())
+	var activity Activity
+	get(t, r, "/activity", &activity)
+	if len(activity.Talkers) != 1 {
+		t.Errorf("Activity %+v", activity)
+	}
+
+	server := httptest.NewServer(r.statusHandler())
+	defer server.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i := 0; i < 2; i++ {
+		var live Activity
+		if err := ws.ReadJSON(&live); err != nil {
+			t.Fatal(err)
+		}
+		if len(live.Talkers) != 1 || live.Talkers[0].CallSign != "W1AW" {
+			t.Errorf("Live activity %+v", live)
+		}
+	}
+}
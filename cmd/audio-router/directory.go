@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/directory"
+)
+
+// DirectoryConfig publishes this router's talkgroups to a directory service
+type DirectoryConfig struct {
+	URL             string                `json:"url"`              // Directory base URL
+	Token           string                `json:"token"`            // Publish secret
+	Endpoint        string                `json:"endpoint"`         // host:port remote hubs should link to
+	Protocol        string                `json:"protocol"`         // "udp" (default) or "tcp"
+	TalkGroups      []directory.TalkGroup `json:"talk_groups"`      // Hosted talkgroups (default: amateur.default_talk_group)
+	IntervalSeconds int                   `json:"interval_seconds"` // Refresh interval (default 60)
+}
+
+// directoryHub builds the registration advertised for this router
+func (r *AudioRouter) directoryHub(config *DirectoryConfig) *directory.Hub {
+	talkGroups := config.TalkGroups
+	if len(talkGroups) == 0 && r.config.Amateur.DefaultTalkGroup != 0 {
+		talkGroups = []directory.TalkGroup{{ID: r.config.Amateur.DefaultTalkGroup}}
+	}
+	return &directory.Hub{
+		Name:        r.config.Router.Name,
+		Description: r.config.Router.Description,
+		Endpoint:    config.Endpoint,
+		Protocol:    config.Protocol,
+		TalkGroups:  talkGroups,
+	}
+}
+
+// directoryWorker keeps the registration fresh until the router stops
+func (r *AudioRouter) directoryWorker(config *DirectoryConfig) {
+	client := directory.NewClient(config.URL, config.Token)
+	interval := time.Duration(config.IntervalSeconds) * time.Second
+	client.Run(r.ctx, r.directoryHub(config), interval)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbehnke/usrp-go/internal/transport"
+)
+
+// discordMetricsInterval is how often a Discord bridge's link metrics are
+// polled
+const discordMetricsInterval = 5 * time.Second
+
+// pollDiscordMetrics polls the link metrics a Discord bridge serves as JSON
+// at url into the router's exporter until ctx is done, one link per
+// voice channel labelled serviceID/link, so /metrics covers the Discord leg
+// alongside the router's own links
+func (r *AudioRouter) pollDiscordMetrics(ctx context.Context, serviceID, url string) {
+	client := &http.Client{Timeout: discordMetricsInterval}
+	links := make(map[string]*transport.RemoteMetrics)
+	ticker := time.NewTicker(discordMetricsInterval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		reports, err := fetchLinkReports(ctx, client, url)
+		switch {
+		case err != nil && !failing:
+			log.Printf("Discord service %s metrics unavailable: %v", serviceID, err)
+		case err == nil && failing:
+			log.Printf("Discord service %s metrics available again", serviceID)
+		}
+		failing = err != nil
+
+		for link, report := range reports {
+			metrics, ok := links[link]
+			if !ok {
+				metrics = transport.NewRemoteMetrics()
+				links[link] = metrics
+				r.linkMetrics.Register(serviceID+"/"+link, metrics)
+			}
+			metrics.Update(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			for link := range links {
+				r.linkMetrics.Unregister(serviceID + "/" + link)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchLinkReports gets the link metrics a Discord bridge serves on its
+// /metrics.json endpoint
+func fetchLinkReports(ctx context.Context, client *http.Client, url string) (map[string]transport.LinkReport, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("metrics request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("bridge returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var reports map[string]transport.LinkReport
+	if err := json.NewDecoder(resp.Body).Decode(&reports); err != nil {
+		return nil, fmt.Errorf("failed to decode metrics: %w", err)
+	}
+	return reports, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// IngestConfig configures the file-drop ingestion directory. Audio files
+// dropped into Directory are transmitted and then moved to ArchiveDir.
+type IngestConfig struct {
+	Directory           string   `json:"directory"`             // Watched directory
+	ArchiveDir          string   `json:"archive_dir"`           // Where processed files go (default <directory>/archive)
+	Destination         string   `json:"destination"`           // Service ID to send to (empty = route like any source)
+	TalkGroup           uint32   `json:"talk_group"`            // Talkgroup for the transmission
+	CallSign            string   `json:"call_sign"`             // Call sign reported for the transmission
+	Extensions          []string `json:"extensions"`            // Accepted file extensions (default .wav, .opus, .ogg)
+	PollIntervalSeconds int      `json:"poll_interval_seconds"` // Directory scan interval (default 2)
+}
+
+// ingestSourceID identifies ingested audio in routing and logs
+const ingestSourceID = "file-ingest"
+
+// ingestWorker watches the drop directory. A file is only picked up once its
+// size is unchanged across two scans, so half-written files are not sent.
+func (r *AudioRouter) ingestWorker(config *IngestConfig) {
+	interval := time.Duration(config.PollIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	archiveDir := config.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = filepath.Join(config.Directory, "archive")
+	}
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		log.Printf("Ingest disabled: cannot create archive directory %s: %v", archiveDir, err)
+		return
+	}
+
+	extensions := config.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{".wav", ".opus", ".ogg"}
+	}
+
+	log.Printf("Watching %s for audio files (archive: %s)", config.Directory, archiveDir)
+
+	sizes := make(map[string]int64)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		entries, err := os.ReadDir(config.Directory)
+		if err != nil {
+			log.Printf("Ingest scan error: %v", err)
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		current := make(map[string]int64)
+		for _, entry := range entries {
+			if entry.IsDir() || !hasExtension(entry.Name(), extensions) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			name := entry.Name()
+			if prev, ok := sizes[name]; !ok || prev != info.Size() {
+				current[name] = info.Size()
+				continue
+			}
+
+			path := filepath.Join(config.Directory, name)
+			suffix := ""
+			if err := r.ingestFile(config, path); err != nil {
+				log.Printf("Ingest of %s failed: %v", name, err)
+				suffix = ".failed"
+			}
+
+			archived := filepath.Join(archiveDir, time.Now().Format("20060102-150405-")+name+suffix)
+			if err := os.Rename(path, archived); err != nil {
+				log.Printf("Failed to archive %s: %v", name, err)
+			}
+
+			if r.ctx.Err() != nil {
+				return
+			}
+		}
+		sizes = current
+	}
+}
+
+// ingestFrames decodes a file into voice frames. WAV cue points split the
+// file into separate transmissions; other files are one transmission.
+func ingestFrames(path string) ([]*usrp.VoiceMessage, float64, error) {
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		if file, err := os.Open(path); err == nil {
+			reader, err := audio.NewWAVReader(file)
+			file.Close()
+			if err == nil {
+				return reader.ReadAll(), reader.Duration().Seconds(), nil
+			}
+			// Fall through to FFmpeg for compressed WAV variants
+		}
+	}
+
+	samples, err := audio.DecodeFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frameCount := (len(samples) + usrp.VoiceFrameSize - 1) / usrp.VoiceFrameSize
+	frames := make([]*usrp.VoiceMessage, 0, frameCount+1)
+
+	// One extra frame of silence carries the unkey
+	for frame := 0; frame <= frameCount; frame++ {
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, uint32(frame))}
+		if frame < frameCount {
+			copy(msg.AudioData[:], samples[frame*usrp.VoiceFrameSize:])
+			msg.Header.SetPTT(true)
+		}
+		frames = append(frames, msg)
+	}
+	return frames, float64(len(samples)) / audio.USRPSampleRate, nil
+}
+
+// ingestFile decodes one file and transmits it in real time
+func (r *AudioRouter) ingestFile(config *IngestConfig, path string) error {
+	frames, seconds, err := ingestFrames(path)
+	if err != nil {
+		return err
+	}
+	if seconds == 0 {
+		return fmt.Errorf("no audio in file")
+	}
+
+	var dest *ServiceConnection
+	if config.Destination != "" {
+		r.servicesMux.RLock()
+		dest = r.services[config.Destination]
+		r.servicesMux.RUnlock()
+		if dest == nil {
+			return fmt.Errorf("destination service %s is not running", config.Destination)
+		}
+	}
+
+	talkGroup := config.TalkGroup
+	if talkGroup == 0 {
+		talkGroup = r.config.Amateur.DefaultTalkGroup
+	}
+	callSign := config.CallSign
+	if callSign == "" {
+		callSign = r.config.Amateur.StationCall
+	}
+
+	log.Printf("Transmitting %s (%.1fs) on TG %d", filepath.Base(path), seconds, talkGroup)
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for frame, voice := range frames {
+		data := make([]byte, usrp.VoiceFrameSize*2)
+		for i, sample := range voice.AudioData {
+			data[i*2] = byte(sample)
+			data[i*2+1] = byte(sample >> 8)
+		}
+
+		msg := &AudioMessage{
+			SourceID:    ingestSourceID,
+			SourceType:  ServiceTypeGeneric,
+			SourceName:  "File Ingest",
+			Data:        data,
+			Format:      "pcm",
+			SampleRate:  audio.USRPSampleRate,
+			Channels:    1,
+			Duration:    20 * time.Millisecond,
+			Timestamp:   time.Now(),
+			SequenceNum: uint32(frame),
+			PTTActive:   voice.Header.IsPTT(),
+			CallSign:    callSign,
+			TalkGroup:   talkGroup,
+		}
+
+		if dest != nil {
+			r.sendToService(msg, dest)
+		} else {
+			select {
+			case r.audioHub <- msg:
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// hasExtension reports whether name ends in one of extensions (case-insensitive)
+func hasExtension(name string, extensions []string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
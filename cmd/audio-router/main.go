@@ -14,20 +14,29 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/dbehnke/usrp-go/internal/configfile"
+	"github.com/dbehnke/usrp-go/internal/transport"
 	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/record"
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
 
@@ -51,7 +60,7 @@ type ServiceInstance struct {
 
 	// Network configuration
 	Network struct {
-		Protocol   string `json:"protocol"`    // "udp", "tcp"
+		Protocol   string `json:"protocol"`    // "udp", "tcp", "unix" (usrp only; addresses are socket paths)
 		ListenAddr string `json:"listen_addr"` // For incoming (empty = don't listen)
 		ListenPort int    `json:"listen_port"`
 		RemoteAddr string `json:"remote_addr"` // For outgoing (empty = don't send)
@@ -60,8 +69,8 @@ type ServiceInstance struct {
 
 	// Audio configuration
 	Audio struct {
-		Format     string `json:"format"`      // "pcm", "opus", "ogg"
-		SampleRate int    `json:"sample_rate"` // Hz
+		Format     string `json:"format"`      // "pcm" or a default_format, converted to and from as audio is routed
+		SampleRate int    `json:"sample_rate"` // Hz, of "pcm" (resampled to and from USRP's 8kHz)
 		Channels   int    `json:"channels"`    // 1=mono, 2=stereo
 		Bitrate    int    `json:"bitrate"`     // For compressed formats
 	} `json:"audio"`
@@ -78,6 +87,111 @@ type ServiceInstance struct {
 		ExcludeServices []string `json:"exclude_services"` // Specific service IDs to exclude
 		Priority        int      `json:"priority"`         // Higher = higher priority (0-10)
 	} `json:"routing"`
+
+	// Talkgroups rewritten on the way out to this service, by talkgroup or
+	// range: {"3100-3199": 1} sends all of 3100-3199 as talkgroup 1
+	TalkGroupRewrite map[string]uint32 `json:"talk_group_rewrite,omitempty"`
+
+	// Traffic shaping toward this service (nil = unlimited)
+	Shaping *transport.ShaperConfig `json:"shaping,omitempty"`
+
+	// Piggybacked frame redundancy for lossy links (nil = disabled).
+	// Both ends of the link must enable it.
+	Redundancy *transport.RedundancyConfig `json:"redundancy,omitempty"`
+
+	// USRP header compatibility profile for this peer: a built-in name
+	// (allstarlink, strict, lenient, keyup-always) or a key of header_profiles
+	HeaderProfile string `json:"header_profile,omitempty"`
+
+	// Link encryption for USRP services: TLS over TCP, DTLS over UDP
+	// (nil = plaintext)
+	TLS *transport.TLSConfig `json:"tls,omitempty"`
+
+	// DiffServ code point for USRP packets (46 = EF for voice; 0 = unmarked)
+	DSCP int `json:"dscp,omitempty"`
+
+	// Address family for USRP services: "4" or "6" to force one, empty for
+	// dual-stack
+	IPVersion transport.IPVersion `json:"ip_version,omitempty"`
+
+	// Per-source receive limits for USRP listeners, dropping floods before
+	// they reach the audio hub (nil = unlimited)
+	RateLimit *transport.RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// Duplicate suppression for USRP listeners, dropping packets that a
+	// network or routing loop delivered twice (nil = deliver duplicates)
+	Dedupe *transport.DedupeConfig `json:"dedupe,omitempty"`
+
+	// Source CIDR filter for USRP services; packets and connections from
+	// other addresses are dropped (nil = accept all)
+	ACL *transport.ACLConfig `json:"acl,omitempty"`
+
+	// Outbound queue, of USRP stream links and of datagrams sent to the
+	// remote address, so a stalled peer cannot block routing (nil = 64
+	// messages, dropping the oldest)
+	SendQueue *transport.SendQueueConfig `json:"send_queue,omitempty"`
+
+	// Pre-shared key AES-GCM encryption of USRP UDP datagrams, for private
+	// backhaul between routers; both ends need the same key and it is not
+	// for amateur links (nil = plaintext)
+	Encryption *transport.EncryptionConfig `json:"encryption,omitempty"`
+
+	// Outbound proxy for dialed USRP TCP links, for hubs whose egress must
+	// go through one: socks5://[user:pass@]host:port or http://host:port
+	Proxy string `json:"proxy,omitempty"`
+
+	// Noise suppression of voice received from USRP services, before it is
+	// routed, for noisy RF links (nil = off)
+	Denoise *audio.DenoiseConfig `json:"denoise,omitempty"`
+
+	// Software squelch for always-keyed services such as WhoTalkie: audio
+	// is routed only while its level holds the gate open, and PTT follows
+	// the gate (nil = every packet is keyed)
+	Squelch *audio.NoiseGateConfig `json:"squelch,omitempty"`
+
+	// Voice activity detection in place of the level squelch: keys the
+	// service on speech rather than on any loud enough sound (nil = off)
+	VAD *audio.VADConfig `json:"vad,omitempty"`
+
+	// Detection of DTMF sent as audio by analog radios on USRP services,
+	// handled like USRP DTMF packets (nil = packets only)
+	InbandDTMF *audio.DTMFDetectorConfig `json:"inband_dtmf,omitempty"`
+
+	// CTCSS (PL) tone handling of voice received from USRP services: tone
+	// squelch and removal of the tone before routing (nil = off)
+	CTCSS *CTCSSConfig `json:"ctcss,omitempty"`
+
+	// Loudness normalization of voice received from USRP services to the
+	// service's target level, so every node reaches destinations at the
+	// same perceived volume (nil = off)
+	Loudness *audio.LoudnessConfig `json:"loudness,omitempty"`
+
+	// Filter chain (high-pass, low-pass, parametric EQ, de-emphasis) for
+	// voice received from USRP services, to correct muddy or tinny nodes
+	// (nil = off)
+	Filters *audio.FilterChainConfig `json:"filters,omitempty"`
+}
+
+// CTCSSConfig holds a USRP service's CTCSS handling
+type CTCSSConfig struct {
+	// Tone a node must send for its audio to be routed, in Hz (0 = no tone
+	// squelch). Detection takes one block, so the start of each
+	// transmission is lost.
+	Tone float64 `json:"tone"`
+
+	// Remove the tone, and anything else below 300 Hz, before routing, so
+	// digital destinations do not hear the hum
+	Strip bool `json:"strip"`
+
+	// Detector settings (nil = defaults)
+	Detector *audio.CTCSSDetectorConfig `json:"detector,omitempty"`
+}
+
+// ctcssState is one remote node's CTCSS handling
+type ctcssState struct {
+	detector *audio.CTCSSDetector  // nil without tone squelch
+	filter   *audio.HighPassFilter // nil unless stripping
+	open     bool                  // Tone squelch is passing audio
 }
 
 // AudioRouterConfig holds the complete router configuration
@@ -87,25 +201,31 @@ type AudioRouterConfig struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
 		ListenAddr  string `json:"listen_addr"`
-		StatusPort  int    `json:"status_port"` // HTTP status/metrics port
+		StatusPort  int    `json:"status_port"`  // HTTP status/metrics port
+		WatchConfig bool   `json:"watch_config"` // Reload the config file when it changes
 	} `json:"router"`
 
 	// Audio processing
 	Audio struct {
-		BufferSize       int    `json:"buffer_size"`        // Channel buffer size
-		ProcessingDelay  int    `json:"processing_delay"`   // ms
-		MaxConcurrentTx  int    `json:"max_concurrent_tx"`  // Max simultaneous transmissions
-		TxTimeoutSeconds int    `json:"tx_timeout_seconds"` // TX timeout
-		EnableConversion bool   `json:"enable_conversion"`  // Enable format conversion
-		DefaultFormat    string `json:"default_format"`     // Default audio format
+		BufferSize       int                 `json:"buffer_size"`        // Channel buffer size
+		ProcessingDelay  int                 `json:"processing_delay"`   // ms
+		MaxConcurrentTx  int                 `json:"max_concurrent_tx"`  // Max simultaneous transmissions
+		TxTimeoutSeconds int                 `json:"tx_timeout_seconds"` // TX timeout
+		EnableConversion bool                `json:"enable_conversion"`  // Enable format conversion
+		DefaultFormat    string              `json:"default_format"`     // "opus", "ogg", "mp3", "codec2-3200", "codec2-1600", "codec2-700C" (FFmpeg), "opus-native", "flac", "ulaw" or "alaw" (pure Go)
+		MaxConverters    int                 `json:"max_converters"`     // Talkers transcoded at once (0 = 16)
+		OpusPacketLoss   int                 `json:"opus_packet_loss"`   // Expected loss (%) "opus-native" adds in-band FEC for (0 = no FEC)
+		OpusDTX          bool                `json:"opus_dtx"`           // "opus-native" sends pauses as silence markers, decoded to comfort noise
+		FFmpeg           *audio.FFmpegConfig `json:"ffmpeg,omitempty"`   // FFmpeg binary, loglevel and extra encoder args
 	} `json:"audio"`
 
 	// Routing rules
 	Routing struct {
-		PreventLoops        bool     `json:"prevent_loops"`         // Prevent audio loops
-		EnablePriorityRules bool     `json:"enable_priority_rules"` // Use priority for conflicts
-		DefaultRouting      string   `json:"default_routing"`       // "all-to-all", "hub-only", "none"
-		BlockedPairs        []string `json:"blocked_pairs"`         // Service pairs to block (e.g. "discord1->usrp2")
+		PreventLoops        bool             `json:"prevent_loops"`         // Prevent audio loops
+		EnablePriorityRules bool             `json:"enable_priority_rules"` // Use priority for conflicts
+		DefaultRouting      string           `json:"default_routing"`       // "all-to-all", "hub-only", "none"
+		BlockedPairs        []string         `json:"blocked_pairs"`         // Service pairs to block by ID or type, globs allowed (e.g. "discord1->usrp2", "discord*->usrp*")
+		TalkGroups          []TalkGroupRoute `json:"talk_groups,omitempty"` // Talkgroups carried only to the services subscribed to them
 	} `json:"routing"`
 
 	// Amateur radio settings
@@ -116,6 +236,24 @@ type AudioRouterConfig struct {
 		LogTransmissions bool   `json:"log_transmissions"`
 	} `json:"amateur"`
 
+	// Parser input limits for packets received from the network (nil = defaults)
+	Limits *usrp.Limits `json:"usrp_limits,omitempty"`
+
+	// Custom USRP header profiles, selectable by services via header_profile
+	HeaderProfiles map[string]*usrp.HeaderProfile `json:"header_profiles,omitempty"`
+
+	// File-drop ingestion directory (nil = disabled)
+	Ingest *IngestConfig `json:"ingest,omitempty"`
+
+	// Recording of received USRP transmissions (nil = disabled)
+	Recording *record.Config `json:"recording,omitempty"`
+
+	// Talkgroup directory publishing (nil = disabled)
+	Directory *DirectoryConfig `json:"directory,omitempty"`
+
+	// Runtime service management on the status server (nil = disabled)
+	API *APIConfig `json:"api,omitempty"`
+
 	// Service instances
 	Services []ServiceInstance `json:"services"`
 }
@@ -126,6 +264,7 @@ type AudioMessage struct {
 	SourceID   string      `json:"source_id"`
 	SourceType ServiceType `json:"source_type"`
 	SourceName string      `json:"source_name"`
+	SourceAddr string      `json:"source_addr,omitempty"` // Remote peer within the service
 
 	// Audio data
 	Data       []byte        `json:"data"`
@@ -145,17 +284,93 @@ type AudioMessage struct {
 	RouteToTypes []ServiceType `json:"route_to_types"`
 	ExcludeIDs   []string      `json:"exclude_ids"`
 	Priority     int           `json:"priority"`
+
+	// The audio as voice frames, decoded once for every destination that
+	// needs it converted
+	frames    []*usrp.VoiceMessage
+	decodeErr error
+	decoded   bool
+}
+
+// squelcher decides from its audio whether an always-keyed service is
+// keyed: a level squelch (audio.NoiseGate) or voice detection (audio.VAD)
+type squelcher interface {
+	Process(samples []int16) bool
 }
 
 // ServiceConnection represents an active service connection
 type ServiceConnection struct {
 	Instance   *ServiceInstance
 	Connection net.Conn
-	LastSeen   time.Time
+	LastSeen   time.Time // Guarded by statsMux
 	TxActive   bool
 	RxActive   bool
 
-	// Statistics
+	// Outbound traffic shaper (nil = unlimited)
+	shaper *transport.Shaper
+
+	// Frame redundancy (nil = disabled)
+	redundancyEnc *transport.RedundancyEncoder
+	redundancyDec *transport.RedundancyDecoder
+
+	// USRP header quirks of the peer (nil = as specified)
+	profile *usrp.HeaderProfile
+
+	// The service's talk_group_rewrite, parsed
+	talkGroupRewrite []talkGroupRewrite
+
+	// Outbound USRP datagram encryption (nil = plaintext)
+	cipher *transport.PacketCipher
+
+	// USRP over a TCP or (D)TLS transport connection (nil = plain UDP, or
+	// not yet connected). The worker sets it under the router's
+	// servicesMux once connected; read it with serviceStream.
+	stream transport.Connection
+
+	// Queue and socket for datagrams sent to the service's remote address
+	// (nil = no remote address, or a stream connection)
+	outbound *outboundLink
+
+	// Plain UDP listener tracking each remote node separately, set by the
+	// worker under the router's servicesMux
+	server *transport.Server
+
+	// Noise suppressors for received voice, one per remote node (nil = off)
+	denoisers  map[string]*audio.Denoiser
+	denoiseMux sync.Mutex
+
+	// In-band DTMF detectors for received voice, one per remote node
+	// (nil = off)
+	dtmfDetectors map[string]*audio.DTMFDetector
+	dtmfMux       sync.Mutex
+
+	// CTCSS handling of received voice, one per remote node (nil = off)
+	ctcss    map[string]*ctcssState
+	ctcssMux sync.Mutex
+
+	// Loudness normalizers for received voice, one per remote node
+	// (nil = off)
+	normalizers  map[string]*audio.LoudnessNormalizer
+	normalizeMux sync.Mutex
+
+	// Filter chains for received voice, one per remote node (nil = off)
+	filters   map[string]*audio.FilterChain
+	filterMux sync.Mutex
+
+	// Software squelch (nil = off), its last decision, and the decoder it
+	// measures compressed audio with (nil for PCM)
+	squelch        squelcher
+	squelchKeyed   bool
+	squelchDecoder audio.Converter
+
+	// The service's worker runs until ctx is done, then closes done, so a
+	// service can be stopped on its own while the router runs
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Statistics, updated by the hub and by each peer's handler, and the
+	// lock guarding them and LastSeen
 	Stats struct {
 		MessagesSent     uint64
 		MessagesReceived uint64
@@ -163,13 +378,67 @@ type ServiceConnection struct {
 		BytesReceived    uint64
 		LastActivity     time.Time
 		Errors           uint64
+		Shaped           uint64
 	}
+	statsMux sync.Mutex
+}
+
+// countReceived records a message of n bytes received from the service
+func (c *ServiceConnection) countReceived(n int) {
+	c.statsMux.Lock()
+	defer c.statsMux.Unlock()
+	c.Stats.MessagesReceived++
+	c.Stats.BytesReceived += uint64(n)
+	c.Stats.LastActivity = time.Now()
+	c.LastSeen = c.Stats.LastActivity
+}
+
+// countSent records messages totalling n bytes sent to the service
+func (c *ServiceConnection) countSent(messages, n int) {
+	c.statsMux.Lock()
+	defer c.statsMux.Unlock()
+	c.Stats.MessagesSent += uint64(messages)
+	c.Stats.BytesSent += uint64(n)
+	c.Stats.LastActivity = time.Now()
+}
+
+// countError records a message from the service that could not be handled
+func (c *ServiceConnection) countError() {
+	c.statsMux.Lock()
+	c.Stats.Errors++
+	c.statsMux.Unlock()
+}
+
+// seen records that the service is still there
+func (c *ServiceConnection) seen() {
+	c.statsMux.Lock()
+	c.LastSeen = time.Now()
+	c.statsMux.Unlock()
 }
 
 // AudioRouter is the main hub-and-spoke audio router
 type AudioRouter struct {
-	config    *AudioRouterConfig
-	converter audio.Converter
+	config     *AudioRouterConfig
+	converters *audio.ConverterPool // One converter per talker, of the default format
+
+	// Converters of every format services use, including the default one,
+	// and resamplers of PCM at other rates, by stream
+	formatPools map[string]*audio.ConverterPool
+	pcmStreams  map[string]*pcmStream
+	convertMux  sync.Mutex
+
+	// File the service management API saves changes to (empty = don't
+	// save), and the lock serializing those changes with readers of
+	// config.Services
+	configFile string
+	configMux  sync.RWMutex
+
+	// Guards the routing rules and transmission limits, which a config
+	// reload changes under the running router
+	rulesMux sync.RWMutex
+
+	// routing.talk_groups, parsed
+	talkGroups []talkGroupRoute
 
 	// Service management
 	services    map[string]*ServiceConnection // serviceID -> connection
@@ -178,6 +447,7 @@ type AudioRouter struct {
 	// Audio routing
 	audioHub            chan *AudioMessage
 	activeTransmissions map[string]*AudioMessage // sourceID -> current transmission
+	preempted           map[string]*preemption   // sourceID -> transmission cut off until it unkeys
 	txMux               sync.RWMutex
 
 	// Control
@@ -190,16 +460,34 @@ type AudioRouter struct {
 		RoutedMessages      uint64
 		DroppedMessages     uint64
 		ConversionErrors    uint64
+		Preemptions         uint64
 		ActiveServices      int
 		ActiveTransmissions int
 		UptimeStart         time.Time
 	}
 	statsMux sync.RWMutex
+
+	// Per-talkgroup and per-source USRP traffic
+	usrpStats *usrp.StatsCollector
+
+	// Link metrics of USRP transports, served at /metrics
+	linkMetrics *transport.PrometheusExporter
+
+	// Converter counters by format, also served at /metrics
+	converterMetrics *audio.ConverterExporter
+	converterMeters  map[string]*audio.ConverterMeter
+	metersMux        sync.Mutex
+
+	// Records received transmissions; nil when recording is disabled
+	recorder *record.Recorder
+
+	// Talkers, last heard and levels, for the dashboard
+	activity *activityTracker
 }
 
 func main() {
 	var (
-		configFile = flag.String("config", "", "Configuration file path (JSON)")
+		configFile = flag.String("config", "", "Configuration file path (JSON, YAML or TOML)")
 		genConfig  = flag.Bool("generate-config", false, "Generate sample configuration file")
 		statusPort = flag.Int("status-port", 9090, "HTTP status/metrics port")
 		verbose    = flag.Bool("verbose", false, "Enable verbose logging")
@@ -236,6 +524,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create audio router: %v", err)
 	}
+	router.configFile = *configFile
 
 	if err := router.Start(); err != nil {
 		log.Fatalf("Failed to start audio router: %v", err)
@@ -248,11 +537,15 @@ func main() {
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
 
 	fmt.Println("🚀 Audio Router Hub is running!")
 	fmt.Println("📊 Send SIGUSR1 for statistics")
+	if *configFile != "" {
+		fmt.Println("🔄 Send SIGHUP to reload the configuration")
+	}
 	fmt.Printf("🌐 Status page: http://localhost:%d/status\n", config.Router.StatusPort)
+	fmt.Printf("📺 Dashboard: http://localhost:%d/\n", config.Router.StatusPort)
 	fmt.Println("Press Ctrl+C to stop...")
 
 	for {
@@ -260,6 +553,10 @@ func main() {
 		switch sig {
 		case syscall.SIGUSR1:
 			router.PrintStats()
+		case syscall.SIGHUP:
+			if err := router.ReloadConfig(); err != nil {
+				log.Printf("Config reload failed: %v", err)
+			}
 		case syscall.SIGINT, syscall.SIGTERM:
 			fmt.Println("\n🛑 Shutting down Audio Router Hub...")
 			return
@@ -311,32 +608,109 @@ func NewAudioRouter(config *AudioRouterConfig) (*AudioRouter, error) {
 		services:            make(map[string]*ServiceConnection),
 		audioHub:            make(chan *AudioMessage, config.Audio.BufferSize),
 		activeTransmissions: make(map[string]*AudioMessage),
+		preempted:           make(map[string]*preemption),
+		usrpStats:           usrp.NewStatsCollector(),
+		linkMetrics:         transport.NewPrometheusExporter("usrp"),
+		converterMetrics:    audio.NewConverterExporter("usrp"),
+		converterMeters:     make(map[string]*audio.ConverterMeter),
+		formatPools:         make(map[string]*audio.ConverterPool),
+		pcmStreams:          make(map[string]*pcmStream),
+		activity:            newActivityTracker(),
+		talkGroups:          parseTalkGroupRoutes(config.Routing.TalkGroups),
 		ctx:                 ctx,
 		cancel:              cancel,
 	}
 
 	router.stats.UptimeStart = time.Now()
 
-	// Create audio converter if enabled
+	if config.Limits != nil {
+		usrp.SetLimits(*config.Limits)
+	}
+
+	if config.Recording != nil {
+		recorder, err := record.NewRecorder(config.Recording)
+		if err != nil {
+			return nil, err
+		}
+		router.recorder = recorder
+	}
+
+	// Create audio converters if enabled
 	if config.Audio.EnableConversion {
-		var err error
-		switch config.Audio.DefaultFormat {
-		case "opus":
-			router.converter, err = audio.NewOpusConverter()
-		case "ogg":
-			router.converter, err = audio.NewOggOpusConverter()
-		default:
-			return nil, fmt.Errorf("unsupported default audio format: %s", config.Audio.DefaultFormat)
+		factory, err := converterFactory(config.Audio.DefaultFormat, nativeOpusConfig(config), config.Audio.FFmpeg)
+		if err != nil {
+			return nil, err
 		}
+		factory = router.meterConverters(config.Audio.DefaultFormat, factory)
 
+		// Fail at startup, not on the first transmission, if the format
+		// cannot be converted (e.g. FFmpeg is missing)
+		probe, err := factory()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create audio converter: %w", err)
 		}
+		probe.Close()
+
+		router.converters = audio.NewConverterPool(factory, converterPoolConfig(config))
+		router.formatPools[config.Audio.DefaultFormat] = router.converters
 	}
 
 	return router, nil
 }
 
+// converterFactory returns a factory for converters of a format,
+// running FFmpeg as ffmpeg says for the formats that need it and
+// configuring native Opus converters with opus
+func converterFactory(format string, opus *audio.ConverterConfig, ffmpeg *audio.FFmpegConfig) (audio.ConverterFactory, error) {
+	switch format {
+	case "opus":
+		return func() (audio.Converter, error) { return audio.NewOpusConverterWithFFmpeg(ffmpeg) }, nil
+	case "ogg":
+		return func() (audio.Converter, error) { return audio.NewOggOpusConverterWithFFmpeg(ffmpeg) }, nil
+	case "opus-native":
+		return func() (audio.Converter, error) { return audio.NewOpusNativeConverter(opus) }, nil
+	case "flac":
+		return func() (audio.Converter, error) { return audio.NewFLACConverter() }, nil
+	case "ulaw", "alaw":
+		return func() (audio.Converter, error) { return audio.NewG711Converter(audio.G711Law(format)) }, nil
+	case "mp3":
+		return func() (audio.Converter, error) { return audio.NewMP3ConverterWithFFmpeg(0, 0, ffmpeg) }, nil
+	case "codec2-3200", "codec2-1600", "codec2-700C":
+		mode := audio.Codec2Mode(strings.TrimPrefix(format, "codec2-"))
+		return func() (audio.Converter, error) { return audio.NewCodec2ConverterWithFFmpeg(mode, ffmpeg) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %s", format)
+	}
+}
+
+// meterConverters wraps factory so the converters it creates are timed and
+// counted, with every converter of a format sharing one set of counters
+func (r *AudioRouter) meterConverters(format string, factory audio.ConverterFactory) audio.ConverterFactory {
+	r.metersMux.Lock()
+	defer r.metersMux.Unlock()
+
+	meter, ok := r.converterMeters[format]
+	if !ok {
+		meter = audio.NewConverterMeter()
+		r.converterMeters[format] = meter
+		r.converterMetrics.Register(format, meter)
+	}
+	return audio.MeterFactory(factory, meter)
+}
+
+// nativeOpusConfig returns the FEC and DTX settings of "opus-native"
+// converters
+func nativeOpusConfig(config *AudioRouterConfig) *audio.ConverterConfig {
+	opus := &audio.ConverterConfig{
+		PacketLoss: config.Audio.OpusPacketLoss,
+		DTX:        config.Audio.OpusDTX,
+	}
+	if opus.DTX {
+		opus.ComfortNoise = usrp.DefaultComfortNoiseLevel
+	}
+	return opus
+}
+
 // Start starts the audio router hub
 func (r *AudioRouter) Start() error {
 	// Start the main audio routing hub
@@ -358,6 +732,21 @@ func (r *AudioRouter) Start() error {
 	// Start housekeeping
 	go r.housekeepingWorker()
 
+	// Reload the config file on changes
+	if r.config.Router.WatchConfig && r.configFile != "" {
+		go r.configWatcher()
+	}
+
+	// Start file-drop ingestion
+	if r.config.Ingest != nil && r.config.Ingest.Directory != "" {
+		go r.ingestWorker(r.config.Ingest)
+	}
+
+	// Publish hosted talkgroups to the directory
+	if r.config.Directory != nil && r.config.Directory.URL != "" {
+		go r.directoryWorker(r.config.Directory)
+	}
+
 	return nil
 }
 
@@ -371,12 +760,27 @@ func (r *AudioRouter) Stop() error {
 		if conn.Connection != nil {
 			conn.Connection.Close()
 		}
+		if conn.squelchDecoder != nil {
+			conn.squelchDecoder.Close()
+		}
+		if conn.outbound != nil {
+			conn.outbound.close()
+		}
 	}
 	r.servicesMux.Unlock()
 
-	// Stop audio converter
-	if r.converter != nil {
-		r.converter.Close()
+	// Stop audio converters
+	r.convertMux.Lock()
+	for _, pool := range r.formatPools {
+		pool.Close()
+	}
+	r.convertMux.Unlock()
+
+	// Finish recordings in progress
+	if r.recorder != nil {
+		if err := r.recorder.Close(); err != nil {
+			log.Printf("Recording error: %v", err)
+		}
 	}
 
 	return nil
@@ -385,30 +789,139 @@ func (r *AudioRouter) Stop() error {
 // startService starts a connection to a service
 func (r *AudioRouter) startService(service *ServiceInstance) error {
 	conn := &ServiceConnection{
-		Instance: service,
-		LastSeen: time.Now(),
+		Instance:         service,
+		LastSeen:         time.Now(),
+		shaper:           transport.NewShaper(service.Shaping),
+		talkGroupRewrite: parseTalkGroupRewrite(service.TalkGroupRewrite),
+	}
+	if service.Redundancy != nil {
+		conn.redundancyEnc = transport.NewRedundancyEncoder(service.Redundancy)
+		conn.redundancyDec = transport.NewRedundancyDecoder()
+	}
+	if service.HeaderProfile != "" {
+		profile, err := resolveHeaderProfile(r.config, service.HeaderProfile)
+		if err != nil {
+			return err
+		}
+		conn.profile = profile
+	}
+	if service.Denoise != nil {
+		conn.denoisers = make(map[string]*audio.Denoiser)
+	}
+	if service.InbandDTMF != nil {
+		conn.dtmfDetectors = make(map[string]*audio.DTMFDetector)
+	}
+	if service.CTCSS != nil {
+		conn.ctcss = make(map[string]*ctcssState)
+	}
+	if service.Loudness != nil {
+		conn.normalizers = make(map[string]*audio.LoudnessNormalizer)
+	}
+	if service.Filters != nil {
+		if _, err := audio.NewFilterChain(service.Filters); err != nil {
+			return fmt.Errorf("service %s filters: %w", service.ID, err)
+		}
+		conn.filters = make(map[string]*audio.FilterChain)
+	}
+	switch {
+	case service.VAD != nil:
+		conn.squelch = audio.NewVAD(service.VAD)
+	case service.Squelch != nil:
+		conn.squelch = audio.NewNoiseGate(service.Squelch)
+	}
+	if conn.squelch != nil {
+		if service.Audio.Format != "pcm" {
+			factory, err := converterFactory(service.Audio.Format, nativeOpusConfig(r.config), r.config.Audio.FFmpeg)
+			if err != nil {
+				return fmt.Errorf("service %s squelch: %w", service.ID, err)
+			}
+			factory = r.meterConverters(service.Audio.Format, factory)
+			if conn.squelchDecoder, err = factory(); err != nil {
+				return fmt.Errorf("service %s squelch: %w", service.ID, err)
+			}
+		}
+	}
+	if service.Encryption != nil {
+		packetCipher, err := transport.NewPacketCipher(service.Encryption)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", service.ID, err)
+		}
+		conn.cipher = packetCipher
+	}
+
+	if service.Network.RemoteAddr != "" && hasOutboundLink(service) {
+		conn.outbound = newOutboundLink(service)
 	}
 
+	conn.ctx, conn.cancel = context.WithCancel(r.ctx)
+	conn.done = make(chan struct{})
+
 	r.servicesMux.Lock()
 	r.services[service.ID] = conn
 	r.servicesMux.Unlock()
 
 	// Start service-specific worker
+	worker := r.genericServiceWorker
 	switch service.Type {
 	case ServiceTypeUSRP:
-		go r.usrpServiceWorker(conn)
+		worker = r.usrpServiceWorker
 	case ServiceTypeWhoTalkie:
-		go r.whoTalkieServiceWorker(conn)
+		worker = r.whoTalkieServiceWorker
 	case ServiceTypeDiscord:
-		go r.discordServiceWorker(conn)
-	case ServiceTypeGeneric:
-		go r.genericServiceWorker(conn)
+		worker = r.discordServiceWorker
 	}
+	go func() {
+		defer close(conn.done)
+		worker(conn)
+	}()
 
 	log.Printf("Started service: %s (%s) - %s", service.Name, service.Type, service.Description)
 	return nil
 }
 
+// serviceStopTimeout is how long stopping a service waits for its worker
+// to finish, which takes up to the workers' one second read deadlines
+const serviceStopTimeout = 5 * time.Second
+
+// stopService stops a running service while the router carries on,
+// waiting for its worker to release its sockets. It reports whether the
+// service was running.
+func (r *AudioRouter) stopService(id string) bool {
+	r.servicesMux.Lock()
+	conn, ok := r.services[id]
+	delete(r.services, id)
+	r.servicesMux.Unlock()
+	if !ok {
+		return false
+	}
+
+	conn.cancel()
+	if conn.Connection != nil {
+		conn.Connection.Close()
+	}
+	select {
+	case <-conn.done:
+	case <-time.After(serviceStopTimeout):
+		log.Printf("Service %s worker did not stop within %v", id, serviceStopTimeout)
+	}
+	if conn.squelchDecoder != nil {
+		conn.squelchDecoder.Close()
+	}
+	if conn.outbound != nil {
+		conn.outbound.close()
+	}
+	r.linkMetrics.Unregister(id)
+	r.activity.forget(id)
+
+	r.txMux.Lock()
+	delete(r.activeTransmissions, id)
+	delete(r.preempted, id)
+	r.txMux.Unlock()
+
+	log.Printf("Stopped service: %s (%s)", conn.Instance.Name, conn.Instance.Type)
+	return true
+}
+
 // audioHubWorker is the main audio routing hub
 func (r *AudioRouter) audioHubWorker() {
 	for {
@@ -428,16 +941,30 @@ func (r *AudioRouter) routeAudioMessage(msg *AudioMessage) {
 	r.statsMux.Unlock()
 
 	// Handle transmission management
-	if err := r.manageTransmission(msg); err != nil {
-		log.Printf("Transmission management error: %v", err)
+	preempted, err := r.manageTransmission(msg)
+	if err != nil {
+		if err != errPreempted {
+			log.Printf("Transmission management error: %v", err)
+		}
 		r.statsMux.Lock()
 		r.stats.DroppedMessages++
 		r.statsMux.Unlock()
 		return
 	}
+	if preempted != nil {
+		r.preempt(preempted, msg)
+	}
+	r.activity.observe(msg, time.Now())
 
 	// Determine routing destinations
 	destinations := r.getRoutingDestinations(msg)
+
+	// A talker's converters last one transmission: closed at unkey, once
+	// the unkey has been routed, and created afresh at the next keyup
+	if !msg.PTTActive {
+		defer r.endStreams(msg.SourceID, destinations)
+	}
+
 	if len(destinations) == 0 {
 		return // No destinations
 	}
@@ -459,39 +986,57 @@ func (r *AudioRouter) routeAudioMessage(msg *AudioMessage) {
 	r.statsMux.Unlock()
 }
 
-// manageTransmission handles transmission conflicts and timeouts
-func (r *AudioRouter) manageTransmission(msg *AudioMessage) error {
+// manageTransmission handles transmission conflicts and timeouts. A new
+// transmission over the concurrent limit is rejected, unless priority
+// rules let it preempt a lower-priority one, which it returns.
+func (r *AudioRouter) manageTransmission(msg *AudioMessage) (*AudioMessage, error) {
 	r.txMux.Lock()
 	defer r.txMux.Unlock()
 
+	r.rulesMux.RLock()
+	timeout := time.Duration(r.config.Audio.TxTimeoutSeconds) * time.Second
+	maxConcurrentTx := r.config.Audio.MaxConcurrentTx
+	priorityRules := r.config.Routing.EnablePriorityRules
+	r.rulesMux.RUnlock()
+
 	now := time.Now()
 
 	// Clean up expired transmissions
 	for sourceID, activeTx := range r.activeTransmissions {
-		if now.Sub(activeTx.Timestamp) > time.Duration(r.config.Audio.TxTimeoutSeconds)*time.Second {
+		if now.Sub(activeTx.Timestamp) > timeout {
 			delete(r.activeTransmissions, sourceID)
 		}
 	}
+	for sourceID, p := range r.preempted {
+		if now.Sub(p.lastHeard) > timeout {
+			delete(r.preempted, sourceID)
+		}
+	}
+
+	// A preempted source stays cut off until it unkeys
+	if p, ok := r.preempted[msg.SourceID]; ok {
+		p.lastHeard = now
+		if !msg.PTTActive {
+			delete(r.preempted, msg.SourceID)
+		}
+		return nil, errPreempted
+	}
 
 	// Check for conflicts
+	var preempted *AudioMessage
 	if msg.PTTActive {
 		// Starting transmission
-		if len(r.activeTransmissions) >= r.config.Audio.MaxConcurrentTx {
-			if r.config.Routing.EnablePriorityRules {
-				// Check if this message has higher priority than existing transmissions
-				canPreempt := false
-				for _, activeTx := range r.activeTransmissions {
-					if msg.Priority > activeTx.Priority {
-						canPreempt = true
-						break
-					}
-				}
-				if !canPreempt {
-					return fmt.Errorf("transmission rejected: max concurrent limit reached")
-				}
-			} else {
-				return fmt.Errorf("transmission rejected: max concurrent limit reached")
+		_, active := r.activeTransmissions[msg.SourceID]
+		if !active && len(r.activeTransmissions) >= maxConcurrentTx {
+			if priorityRules {
+				// Preempt the lowest-priority transmission below this one
+				preempted = lowestPriority(r.activeTransmissions, msg.Priority)
+			}
+			if preempted == nil {
+				return nil, fmt.Errorf("transmission rejected: max concurrent limit reached")
 			}
+			delete(r.activeTransmissions, preempted.SourceID)
+			r.preempted[preempted.SourceID] = &preemption{by: msg.SourceID, lastHeard: now}
 		}
 
 		r.activeTransmissions[msg.SourceID] = msg
@@ -502,9 +1047,12 @@ func (r *AudioRouter) manageTransmission(msg *AudioMessage) error {
 
 	r.statsMux.Lock()
 	r.stats.ActiveTransmissions = len(r.activeTransmissions)
+	if preempted != nil {
+		r.stats.Preemptions++
+	}
 	r.statsMux.Unlock()
 
-	return nil
+	return preempted, nil
 }
 
 // getRoutingDestinations determines where to route an audio message
@@ -521,57 +1069,96 @@ func (r *AudioRouter) getRoutingDestinations(msg *AudioMessage) []*ServiceConnec
 	}
 
 	for _, conn := range r.services {
-		destService := conn.Instance
-
-		// Skip if destination is disabled
-		if !destService.Enabled || !destService.Routing.CanReceive {
-			continue
+		if r.routes(sourceService, conn.Instance, msg) {
+			destinations = append(destinations, conn)
 		}
+	}
 
-		// Skip self
-		if destService.ID == msg.SourceID {
-			continue
-		}
+	return destinations
+}
 
-		// Check if explicitly excluded
-		excluded := false
-		for _, excludeID := range msg.ExcludeIDs {
-			if destService.ID == excludeID {
-				excluded = true
-				break
-			}
-		}
-		if excluded {
-			continue
+// routes reports whether a message from source, nil if it is not a
+// running service, goes to the service dest
+func (r *AudioRouter) routes(source *ServiceInstance, dest *ServiceInstance, msg *AudioMessage) bool {
+	// Skip if destination is disabled
+	if !dest.Enabled || !dest.Routing.CanReceive {
+		return false
+	}
+
+	// Skip self
+	if dest.ID == msg.SourceID {
+		return false
+	}
+
+	// Check if explicitly excluded
+	for _, excludeID := range msg.ExcludeIDs {
+		if dest.ID == excludeID {
+			return false
 		}
+	}
 
-		// Check service-level exclusions
-		if sourceService != nil {
-			excluded = false
-			for _, excludeID := range sourceService.Routing.ExcludeServices {
-				if destService.ID == excludeID {
-					excluded = true
-					break
-				}
-			}
-			if excluded {
-				continue
+	// Check service-level exclusions
+	sourceType := msg.SourceType
+	if source != nil {
+		for _, excludeID := range source.Routing.ExcludeServices {
+			if dest.ID == excludeID {
+				return false
 			}
 		}
+		sourceType = source.Type
+	}
 
-		// Apply routing rules
-		if r.shouldRoute(sourceService, destService, msg) {
-			destinations = append(destinations, conn)
+	// Check blocked pairs
+	if r.blockedPair(msg.SourceID, sourceType, dest) {
+		return false
+	}
+
+	// Check talkgroup subscriptions
+	if !r.talkGroupAllows(msg.TalkGroup, dest) {
+		return false
+	}
+
+	// Apply routing rules
+	return r.shouldRoute(source, dest, msg)
+}
+
+// blockedPair reports whether routing.blocked_pairs blocks audio from the
+// source sourceID, of type sourceType, to dest. A pair is
+// "source->destination", each side a service ID or type, or a glob of
+// them: "discord1->usrp2" blocks one direction between two services and
+// "discord*->usrp*" all Discord to USRP audio.
+func (r *AudioRouter) blockedPair(sourceID string, sourceType ServiceType, dest *ServiceInstance) bool {
+	r.rulesMux.RLock()
+	defer r.rulesMux.RUnlock()
+
+	for _, pair := range r.config.Routing.BlockedPairs {
+		from, to, _ := strings.Cut(pair, "->")
+		if pairMatches(strings.TrimSpace(from), sourceID, sourceType) &&
+			pairMatches(strings.TrimSpace(to), dest.ID, dest.Type) {
+			return true
 		}
 	}
+	return false
+}
 
-	return destinations
+// pairMatches reports whether one side of a blocked pair matches a service
+// by its ID or its type
+func pairMatches(pattern, id string, serviceType ServiceType) bool {
+	if ok, _ := path.Match(pattern, id); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, string(serviceType))
+	return ok
 }
 
 // shouldRoute determines if audio should be routed between two services
 func (r *AudioRouter) shouldRoute(source *ServiceInstance, dest *ServiceInstance, msg *AudioMessage) bool {
+	r.rulesMux.RLock()
+	defaultRouting := r.config.Routing.DefaultRouting
+	r.rulesMux.RUnlock()
+
 	// Default routing rules
-	switch r.config.Routing.DefaultRouting {
+	switch defaultRouting {
 	case "all-to-all":
 		return true
 	case "hub-only":
@@ -630,79 +1217,375 @@ func (r *AudioRouter) shouldRoute(source *ServiceInstance, dest *ServiceInstance
 func (r *AudioRouter) sendToService(msg *AudioMessage, destConn *ServiceConnection) bool {
 	destService := destConn.Instance
 
-	// Convert audio format if needed
-	audioData := msg.Data
-	if r.converter != nil && msg.Format != destService.Audio.Format {
-		// TODO: Implement format conversion based on service requirements
-		_ = audioData // Placeholder
+	// Enforce per-destination packet rate and burst limits; an unkey always
+	// goes, or the destination would stay keyed
+	if msg.PTTActive && !destConn.shaper.Allow() {
+		destConn.statsMux.Lock()
+		destConn.Stats.Shaped++
+		destConn.statsMux.Unlock()
+		return false
+	}
+
+	// Send based on service type, each sender converting the audio to
+	// the service's format
+	switch destService.Type {
+	case ServiceTypeUSRP:
+		return r.sendToUSRPService(msg, destConn)
+	case ServiceTypeWhoTalkie:
+		return r.sendToWhoTalkieService(msg, destConn)
+	case ServiceTypeDiscord:
+		return r.sendToDiscordService(msg, destConn)
+	case ServiceTypeGeneric:
+		return r.sendToGenericService(msg, destConn)
+	}
+
+	return false
+}
+
+// Service-specific worker and sender functions
+func (r *AudioRouter) usrpServiceWorker(conn *ServiceConnection) {
+	service := conn.Instance
+	log.Printf("Starting USRP service worker for %s", service.Name)
+
+	if service.Network.Protocol == "tcp" || service.Network.Protocol == "unix" || service.TLS != nil {
+		r.usrpStreamWorker(conn)
+		return
+	}
+
+	if service.Network.ListenAddr == "" {
+		<-conn.ctx.Done()
+		return
+	}
+
+	// Several nodes may send to the same port; each remote is its own peer
+	addr := net.JoinHostPort(service.Network.ListenAddr, strconv.Itoa(service.Network.ListenPort))
+	server := transport.NewServer(&transport.ServerConfig{
+		ListenAddr: addr,
+		DSCP:       service.DSCP,
+		IPVersion:  service.IPVersion,
+		RateLimit:  service.RateLimit,
+		Dedupe:     service.Dedupe,
+		ACL:        service.ACL,
+		Encryption: service.Encryption,
+		Metrics:    r.serviceMetrics(service),
+	})
+	if err := server.Listen(); err != nil {
+		log.Printf("Failed to listen on %s: %v", addr, err)
+		return
+	}
+	defer server.Close()
+	log.Printf("USRP service %s listening on %s", service.Name, addr)
+
+	server.OnPeer(func(p *transport.Peer) {
+		log.Printf("USRP service %s: new peer %s", service.Name, p)
+	})
+	server.OnPeerExpired(func(p *transport.Peer) {
+		log.Printf("USRP service %s: peer %s idle, expired", service.Name, p)
+		conn.denoiseMux.Lock()
+		delete(conn.denoisers, p.String())
+		conn.denoiseMux.Unlock()
+		conn.dtmfMux.Lock()
+		delete(conn.dtmfDetectors, p.String())
+		conn.dtmfMux.Unlock()
+		conn.ctcssMux.Lock()
+		delete(conn.ctcss, p.String())
+		conn.ctcssMux.Unlock()
+		conn.normalizeMux.Lock()
+		delete(conn.normalizers, p.String())
+		conn.normalizeMux.Unlock()
+		conn.filterMux.Lock()
+		delete(conn.filters, p.String())
+		conn.filterMux.Unlock()
+	})
+
+	handler := func(p *transport.Peer, rx *usrp.Received) error {
+		r.receiveUSRP(conn, rx)
+		return nil
+	}
+	for _, packetType := range usrpPacketTypes {
+		server.RegisterHandler(packetType, handler)
+	}
+	r.servicesMux.Lock()
+	conn.server = server
+	r.servicesMux.Unlock()
+
+	if err := server.Start(conn.ctx); err != nil && conn.ctx.Err() == nil {
+		log.Printf("USRP service %s stopped: %v", service.Name, err)
+	}
+}
+
+// usrpPacketTypes lists every USRP packet type the router accepts
+var usrpPacketTypes = []usrp.PacketType{
+	usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_DTMF, usrp.USRP_TYPE_TEXT, usrp.USRP_TYPE_PING,
+	usrp.USRP_TYPE_TLV, usrp.USRP_TYPE_VOICE_ADPCM, usrp.USRP_TYPE_VOICE_ULAW,
+}
+
+// serviceMetrics creates link metrics for a USRP service and exports them
+// under the service ID
+func (r *AudioRouter) serviceMetrics(service *ServiceInstance) transport.Metrics {
+	metrics := transport.NewAtomicMetrics()
+	r.linkMetrics.Register(service.ID, metrics)
+	return metrics
+}
+
+// usrpStreamWorker carries a USRP service over a point-to-point transport
+// connection: TCP, TLS, DTLS or a unix datagram socket. A remote address
+// dials out (and redials); otherwise the listen address accepts the peer. A
+// unix socket binds its listen path and sends to its remote path.
+func (r *AudioRouter) usrpStreamWorker(conn *ServiceConnection) {
+	service := conn.Instance
+
+	config := transport.DefaultConfig()
+	config.TLS = service.TLS
+	config.DSCP = service.DSCP
+	config.IPVersion = service.IPVersion
+	config.ACL = service.ACL
+	config.SendQueue = service.SendQueue
+	config.Proxy = service.Proxy
+	config.Metrics = r.serviceMetrics(service)
+	switch {
+	case service.Network.Protocol == "unix" && (service.Network.ListenAddr != "" || service.Network.RemoteAddr != ""):
+		config.LocalAddr = service.Network.ListenAddr
+		config.RemoteAddr = service.Network.RemoteAddr
+	case service.Network.Protocol != "unix" && service.Network.RemoteAddr != "":
+		config.RemoteAddr = net.JoinHostPort(service.Network.RemoteAddr, strconv.Itoa(service.Network.RemotePort))
+	case service.Network.Protocol != "unix" && service.Network.ListenAddr != "":
+		config.LocalAddr = net.JoinHostPort(service.Network.ListenAddr, strconv.Itoa(service.Network.ListenPort))
+	default:
+		log.Printf("USRP service %s has no %s address configured", service.Name, service.Network.Protocol)
+		return
+	}
+
+	stream, err := transport.NewConnection(service.Network.Protocol, config)
+	if err != nil {
+		log.Printf("Failed to create USRP %s connection for %s: %v", service.Network.Protocol, service.Name, err)
+		return
+	}
+	defer stream.Close()
+
+	if notifier, ok := stream.(transport.StateNotifier); ok {
+		notifier.OnStateChange(func(e transport.StateEvent) {
+			if e.Err != nil {
+				log.Printf("USRP service %s link %s: %v", service.Name, e.To, e.Err)
+			} else {
+				log.Printf("USRP service %s link %s", service.Name, e.To)
+			}
+		})
+	}
+
+	// Keep dialing until the peer comes up; Start redials after that
+	backoff := transport.NewBackoff(&transport.BackoffConfig{
+		Initial:    config.ReconnectInterval,
+		Max:        time.Minute,
+		Multiplier: 2,
+	})
+	for {
+		if err = stream.Connect(); err == nil {
+			break
+		}
+		log.Printf("USRP service %s: %v", service.Name, err)
+		select {
+		case <-conn.ctx.Done():
+			return
+		case <-time.After(backoff.Next()):
+		}
+	}
+	r.servicesMux.Lock()
+	conn.stream = stream
+	r.servicesMux.Unlock()
+	log.Printf("USRP service %s using %s (local %s, remote %s, encrypted %v)",
+		service.Name, service.Network.Protocol, stream.LocalAddr(), config.RemoteAddr, service.TLS != nil)
+
+	handler := func(msg usrp.Message) error {
+		r.receiveUSRP(conn, &usrp.Received{Message: msg, Source: stream.RemoteAddr(), Time: time.Now()})
+		return nil
+	}
+	for _, packetType := range usrpPacketTypes {
+		stream.RegisterHandler(packetType, handler)
+	}
+
+	if err := stream.Start(conn.ctx); err != nil && conn.ctx.Err() == nil {
+		log.Printf("USRP %s service %s stopped: %v", service.Network.Protocol, service.Name, err)
+	}
+}
+
+// receiveUSRP applies the peer's header profile, records statistics and
+// routes a received USRP packet
+func (r *AudioRouter) receiveUSRP(conn *ServiceConnection, rx *usrp.Received) {
+	if err := conn.profile.Inbound(rx.Message); err != nil {
+		log.Printf("USRP packet rejected: %v", err)
+		conn.countError()
+	} else {
+		r.usrpStats.Record(rx)
+		if r.toneSquelch(conn, rx) {
+			r.detectDTMF(conn, rx) // Before denoising, which may soften held tones
+			r.denoise(conn, rx)
+			r.filter(conn, rx)
+			r.normalize(conn, rx)
+			r.record(conn, rx)
+			if err := r.handleUSRPPacket(conn.Instance, rx); err != nil {
+				log.Printf("USRP packet handling error: %v", err)
+			}
+		}
+	}
+
+	conn.countReceived(rx.Length)
+}
+
+// toneSquelch applies the service's CTCSS handling to a received voice
+// frame, with the sending node's own detector, and reports whether the
+// packet should be routed. Voice is held back until the required tone is
+// found; when it goes, one unkeyed frame ends the transmission.
+func (r *AudioRouter) toneSquelch(conn *ServiceConnection, rx *usrp.Received) bool {
+	voice, ok := rx.Message.(*usrp.VoiceMessage)
+	if !ok || conn.ctcss == nil {
+		return true
+	}
+
+	config := conn.Instance.CTCSS
+	peer := rx.SourceString()
+	conn.ctcssMux.Lock()
+	state, ok := conn.ctcss[peer]
+	if !ok {
+		state = &ctcssState{}
+		if config.Tone != 0 {
+			state.detector = audio.NewCTCSSDetector(config.Detector)
+		}
+		if config.Strip {
+			state.filter = audio.NewCTCSSFilter(audio.USRPSampleRate)
+		}
+		conn.ctcss[peer] = state
+	}
+	conn.ctcssMux.Unlock()
+
+	if state.detector != nil {
+		tone := state.detector.Process(voice.AudioData[:])
+		switch {
+		case voice.Header.IsPTT() && math.Abs(tone-config.Tone) < 0.05:
+			state.open = true
+		case state.open:
+			state.open = false
+			voice.Header.SetPTT(false)
+		default:
+			return false
+		}
+		if !voice.Header.IsPTT() {
+			state.detector.Reset() // Each transmission must bring its own tone
+		}
+	}
+	if state.filter != nil {
+		state.filter.Process(voice.AudioData[:])
+	}
+	return true
+}
+
+// detectDTMF scans a received voice frame for DTMF sent as audio, with the
+// sending node's own detector, and handles any digits found
+func (r *AudioRouter) detectDTMF(conn *ServiceConnection, rx *usrp.Received) {
+	voice, ok := rx.Message.(*usrp.VoiceMessage)
+	if !ok || conn.dtmfDetectors == nil {
+		return
+	}
+
+	peer := rx.SourceString()
+	conn.dtmfMux.Lock()
+	detector, ok := conn.dtmfDetectors[peer]
+	if !ok {
+		detector = audio.NewDTMFDetector(conn.Instance.InbandDTMF)
+		conn.dtmfDetectors[peer] = detector
+	}
+	conn.dtmfMux.Unlock()
+
+	for _, digit := range detector.Process(voice.AudioData[:]) {
+		r.handleDTMF(conn.Instance, peer, digit)
+	}
+}
+
+// handleDTMF acts on a DTMF digit from a service, whether it arrived as a
+// USRP DTMF packet or was detected in the audio
+func (r *AudioRouter) handleDTMF(service *ServiceInstance, source string, digit rune) {
+	log.Printf("DTMF %c from %s (%s)", digit, service.Name, source)
+}
+
+// denoise suppresses noise in a received voice frame, with the sending
+// node's own suppressor so nodes' noise estimates are kept apart
+func (r *AudioRouter) denoise(conn *ServiceConnection, rx *usrp.Received) {
+	voice, ok := rx.Message.(*usrp.VoiceMessage)
+	if !ok || conn.denoisers == nil {
+		return
+	}
+
+	peer := rx.SourceString()
+	conn.denoiseMux.Lock()
+	denoiser, ok := conn.denoisers[peer]
+	if !ok {
+		denoiser = audio.NewDenoiser(conn.Instance.Denoise)
+		conn.denoisers[peer] = denoiser
+	}
+	conn.denoiseMux.Unlock()
+
+	denoiser.Process(voice.AudioData[:])
+}
+
+// filter runs a received voice frame through the service's filter chain,
+// with the sending node's own chain so filter state is kept apart
+func (r *AudioRouter) filter(conn *ServiceConnection, rx *usrp.Received) {
+	voice, ok := rx.Message.(*usrp.VoiceMessage)
+	if !ok || conn.filters == nil {
+		return
 	}
 
-	// Send based on service type
-	switch destService.Type {
-	case ServiceTypeUSRP:
-		return r.sendToUSRPService(msg, destConn)
-	case ServiceTypeWhoTalkie:
-		return r.sendToWhoTalkieService(msg, destConn)
-	case ServiceTypeDiscord:
-		return r.sendToDiscordService(msg, destConn)
-	case ServiceTypeGeneric:
-		return r.sendToGenericService(msg, destConn)
+	peer := rx.SourceString()
+	conn.filterMux.Lock()
+	chain, ok := conn.filters[peer]
+	if !ok {
+		// The config was checked by startService
+		chain, _ = audio.NewFilterChain(conn.Instance.Filters)
+		conn.filters[peer] = chain
 	}
+	conn.filterMux.Unlock()
 
-	return false
+	chain.Process(voice.AudioData[:])
 }
 
-// Service-specific worker and sender functions
-func (r *AudioRouter) usrpServiceWorker(conn *ServiceConnection) {
-	service := conn.Instance
-	log.Printf("Starting USRP service worker for %s", service.Name)
+// normalize brings a received voice frame to the service's loudness
+// target, with the sending node's own normalizer so each node's loudness is
+// measured apart
+func (r *AudioRouter) normalize(conn *ServiceConnection, rx *usrp.Received) {
+	voice, ok := rx.Message.(*usrp.VoiceMessage)
+	if !ok || conn.normalizers == nil {
+		return
+	}
 
-	// Set up UDP listening if configured
-	var listener net.PacketConn
-	if service.Network.ListenAddr != "" {
-		addr := fmt.Sprintf("%s:%d", service.Network.ListenAddr, service.Network.ListenPort)
-		var err error
-		listener, err = net.ListenPacket("udp", addr)
-		if err != nil {
-			log.Printf("Failed to listen on %s: %v", addr, err)
-			return
-		}
-		defer listener.Close()
-		log.Printf("USRP service %s listening on %s", service.Name, addr)
+	peer := rx.SourceString()
+	conn.normalizeMux.Lock()
+	normalizer, ok := conn.normalizers[peer]
+	if !ok {
+		normalizer = audio.NewLoudnessNormalizer(conn.Instance.Loudness)
+		conn.normalizers[peer] = normalizer
 	}
+	conn.normalizeMux.Unlock()
 
-	for {
-		select {
-		case <-r.ctx.Done():
-			return
-		default:
-			if listener != nil {
-				// Read USRP packets
-				buffer := make([]byte, 1024)
-				if err := listener.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
-					log.Printf("Failed to set read deadline: %v", err)
-					continue
-				}
-				n, remoteAddr, err := listener.ReadFrom(buffer)
-				if err != nil {
-					if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
-						log.Printf("USRP read error: %v", err)
-					}
-					continue
-				}
+	normalizer.Process(voice.AudioData[:])
+}
 
-				// Parse USRP packet
-				if err := r.handleUSRPPacket(service, buffer[:n], remoteAddr); err != nil {
-					log.Printf("USRP packet handling error: %v", err)
-				}
+// record passes a received voice frame to the recorder, and the callsign
+// of a TLV message to name the sender's recordings. Each node of a service
+// is recorded apart.
+func (r *AudioRouter) record(conn *ServiceConnection, rx *usrp.Received) {
+	if r.recorder == nil {
+		return
+	}
 
-				conn.Stats.MessagesReceived++
-				conn.Stats.BytesReceived += uint64(n)
-				conn.Stats.LastActivity = time.Now()
-				conn.LastSeen = time.Now()
-			} else {
-				time.Sleep(100 * time.Millisecond)
-			}
+	source := conn.Instance.ID + "-" + rx.SourceString()
+	switch msg := rx.Message.(type) {
+	case *usrp.VoiceMessage:
+		if err := r.recorder.WriteMessage(source, msg, rx.Time); err != nil {
+			log.Printf("Recording error: %v", err)
+		}
+	case *usrp.TLVMessage:
+		if callsign, ok := msg.GetCallsign(); ok {
+			r.recorder.SetCallsign(source, callsign)
 		}
 	}
 }
@@ -714,7 +1597,7 @@ func (r *AudioRouter) whoTalkieServiceWorker(conn *ServiceConnection) {
 	// Set up UDP listening if configured
 	var listener net.PacketConn
 	if service.Network.ListenAddr != "" {
-		addr := fmt.Sprintf("%s:%d", service.Network.ListenAddr, service.Network.ListenPort)
+		addr := net.JoinHostPort(service.Network.ListenAddr, strconv.Itoa(service.Network.ListenPort))
 		var err error
 		listener, err = net.ListenPacket("udp", addr)
 		if err != nil {
@@ -727,7 +1610,7 @@ func (r *AudioRouter) whoTalkieServiceWorker(conn *ServiceConnection) {
 
 	for {
 		select {
-		case <-r.ctx.Done():
+		case <-conn.ctx.Done():
 			return
 		default:
 			if listener != nil {
@@ -745,15 +1628,25 @@ func (r *AudioRouter) whoTalkieServiceWorker(conn *ServiceConnection) {
 					continue
 				}
 
+				// Unwrap redundant frames, skipping copies already delivered
+				frames := [][]byte{buffer[:n]}
+				if conn.redundancyDec != nil {
+					frames, err = conn.redundancyDec.Decode(buffer[:n])
+					if err != nil {
+						log.Printf("WhoTalkie redundancy error: %v", err)
+						conn.countError()
+						continue
+					}
+				}
+
 				// Handle WhoTalkie audio packet
-				if err := r.handleWhoTalkiePacket(service, buffer[:n], remoteAddr); err != nil {
-					log.Printf("WhoTalkie packet handling error: %v", err)
+				for _, frame := range frames {
+					if err := r.handleWhoTalkiePacket(conn, frame, remoteAddr); err != nil {
+						log.Printf("WhoTalkie packet handling error: %v", err)
+					}
 				}
 
-				conn.Stats.MessagesReceived++
-				conn.Stats.BytesReceived += uint64(n)
-				conn.Stats.LastActivity = time.Now()
-				conn.LastSeen = time.Now()
+				conn.countReceived(n)
 			} else {
 				time.Sleep(100 * time.Millisecond)
 			}
@@ -765,19 +1658,24 @@ func (r *AudioRouter) discordServiceWorker(conn *ServiceConnection) {
 	service := conn.Instance
 	log.Printf("Starting Discord service worker for %s", service.Name)
 
+	// The Discord bridge runs as its own process, serving its link metrics
+	if url, ok := service.Settings["metrics_url"].(string); ok && url != "" {
+		go r.pollDiscordMetrics(conn.ctx, service.ID, url)
+	}
+
 	// Discord integration would require Discord bot setup
 	// For now, this is a placeholder that would integrate with our Discord bridge
 	// The actual implementation would use the discord bridge from pkg/discord
 
 	for {
 		select {
-		case <-r.ctx.Done():
+		case <-conn.ctx.Done():
 			return
 		default:
 			// Discord audio handling would go here
 			// This would integrate with the DiscordBridge from pkg/discord
 			time.Sleep(1 * time.Second)
-			conn.LastSeen = time.Now()
+			conn.seen()
 		}
 	}
 }
@@ -791,7 +1689,7 @@ func (r *AudioRouter) genericServiceWorker(conn *ServiceConnection) {
 	var packetListener net.PacketConn
 
 	if service.Network.ListenAddr != "" {
-		addr := fmt.Sprintf("%s:%d", service.Network.ListenAddr, service.Network.ListenPort)
+		addr := net.JoinHostPort(service.Network.ListenAddr, strconv.Itoa(service.Network.ListenPort))
 
 		if service.Network.Protocol == "tcp" {
 			var err error
@@ -806,21 +1704,21 @@ func (r *AudioRouter) genericServiceWorker(conn *ServiceConnection) {
 			// Handle TCP connections
 			for {
 				select {
-				case <-r.ctx.Done():
+				case <-conn.ctx.Done():
 					return
 				default:
 					if err := listener.(*net.TCPListener).SetDeadline(time.Now().Add(1 * time.Second)); err != nil {
 						log.Printf("Failed to set TCP deadline: %v", err)
 						continue
 					}
-					conn, err := listener.Accept()
+					client, err := listener.Accept()
 					if err != nil {
 						if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
 							log.Printf("Generic TCP accept error: %v", err)
 						}
 						continue
 					}
-					go r.handleGenericTCPConnection(service, conn)
+					go r.handleGenericTCPConnection(conn, client)
 				}
 			}
 		} else {
@@ -840,7 +1738,7 @@ func (r *AudioRouter) genericServiceWorker(conn *ServiceConnection) {
 	if packetListener != nil {
 		for {
 			select {
-			case <-r.ctx.Done():
+			case <-conn.ctx.Done():
 				return
 			default:
 				buffer := make([]byte, 4096)
@@ -866,84 +1764,96 @@ func (r *AudioRouter) genericServiceWorker(conn *ServiceConnection) {
 		// No listening configured, just maintain connection
 		for {
 			select {
-			case <-r.ctx.Done():
+			case <-conn.ctx.Done():
 				return
 			default:
 				time.Sleep(1 * time.Second)
-				conn.LastSeen = time.Now()
+				conn.seen()
 			}
 		}
 	}
 }
 
 func (r *AudioRouter) sendToUSRPService(msg *AudioMessage, conn *ServiceConnection) bool {
-	service := conn.Instance
+	// Skip if no remote address configured (an accepted stream has its own)
+	if conn.outbound == nil && r.serviceStream(conn) == nil {
+		return false
+	}
 
-	// Skip if no remote address configured
-	if service.Network.RemoteAddr == "" {
+	// Convert audio to USRP voice frames if needed
+	frames, err := r.voiceFrames(msg)
+	if err != nil {
+		log.Printf("Cannot convert audio format %s to USRP: %v", msg.Format, err)
 		return false
 	}
+	if len(frames) == 0 {
+		if msg.PTTActive {
+			return true // The decoder holds the audio until it has a frame
+		}
+		frames = []*usrp.VoiceMessage{{}} // Unkey with a silent frame
+	}
 
-	// Convert audio to USRP format if needed
-	var usrpData []byte
-	if msg.Format == "pcm" {
-		// Create USRP voice packet
+	for i, frame := range frames {
+		// Create USRP voice packet; the frames are shared by every
+		// destination, so each gets its own copy
 		voice := &usrp.VoiceMessage{
-			Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, msg.SequenceNum),
+			Header:    usrp.NewHeader(usrp.USRP_TYPE_VOICE, msg.SequenceNum+uint32(i)),
+			AudioData: frame.AudioData,
 		}
-		voice.Header.SetPTT(msg.PTTActive)
-		voice.Header.TalkGroup = msg.TalkGroup
+		// Only the last frame of an unkey unkeys
+		voice.Header.SetPTT(msg.PTTActive || i < len(frames)-1)
+		voice.Header.TalkGroup = egressTalkGroup(conn, msg.TalkGroup)
 
-		// Copy audio data (assuming 16-bit PCM, 160 samples)
-		if len(msg.Data) >= 320 {
-			for i := 0; i < 160 && i*2+1 < len(msg.Data); i++ {
-				// Convert bytes to int16
-				voice.AudioData[i] = int16(msg.Data[i*2]) | int16(msg.Data[i*2+1])<<8
-			}
-		}
+		// Adjust header fields to the peer's conventions
+		conn.profile.Outbound(voice)
 
-		var err error
-		usrpData, err = voice.Marshal()
+		usrpData, err := voice.Marshal()
 		if err != nil {
 			log.Printf("Failed to marshal USRP packet: %v", err)
 			return false
 		}
-	} else {
-		// Use audio conversion if available
-		if r.converter != nil {
-			// Convert from source format to USRP
-			// This would use the audio converter
-			usrpData = msg.Data // Placeholder
-		} else {
-			log.Printf("Cannot convert audio format %s to USRP without converter", msg.Format)
+		if !r.sendUSRPPacket(conn, usrpData) {
 			return false
 		}
 	}
+	return true
+}
 
-	// Send UDP packet
-	remoteAddr := fmt.Sprintf("%s:%d", service.Network.RemoteAddr, service.Network.RemotePort)
-	udpAddr, err := net.ResolveUDPAddr("udp", remoteAddr)
-	if err != nil {
-		log.Printf("Failed to resolve USRP address %s: %v", remoteAddr, err)
-		return false
-	}
+// serviceStream returns the transport connection a USRP service's worker
+// has connected, if any
+func (r *AudioRouter) serviceStream(conn *ServiceConnection) transport.Connection {
+	r.servicesMux.RLock()
+	defer r.servicesMux.RUnlock()
+	return conn.stream
+}
 
-	udpConn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		log.Printf("Failed to dial USRP %s: %v", remoteAddr, err)
-		return false
+// sendUSRPPacket sends a marshaled USRP packet to a service
+func (r *AudioRouter) sendUSRPPacket(conn *ServiceConnection, usrpData []byte) bool {
+	service := conn.Instance
+
+	// Send over the transport connection when the service uses one
+	if stream := r.serviceStream(conn); stream != nil {
+		streamMsg, err := usrp.Parse(usrpData)
+		if err != nil {
+			log.Printf("Failed to parse USRP packet for %s: %v", service.Network.Protocol, err)
+			return false
+		}
+		if err := stream.SendMessageAsync(streamMsg); err != nil {
+			log.Printf("Failed to send USRP packet over %s: %v", service.Network.Protocol, err)
+			return false
+		}
+
+		conn.countSent(1, len(usrpData))
+		return true
 	}
-	defer udpConn.Close()
 
-	_, err = udpConn.Write(usrpData)
-	if err != nil {
+	// Send UDP packet over the service's link
+	if err := conn.outbound.send(conn.cipher.Seal(usrpData)); err != nil {
 		log.Printf("Failed to send USRP packet: %v", err)
 		return false
 	}
 
-	conn.Stats.MessagesSent++
-	conn.Stats.BytesSent += uint64(len(usrpData))
-	conn.Stats.LastActivity = time.Now()
+	conn.countSent(1, len(usrpData))
 
 	return true
 }
@@ -952,46 +1862,38 @@ func (r *AudioRouter) sendToWhoTalkieService(msg *AudioMessage, conn *ServiceCon
 	service := conn.Instance
 
 	// Skip if no remote address configured
-	if service.Network.RemoteAddr == "" {
+	if conn.outbound == nil {
 		return false
 	}
 
 	// Convert audio to WhoTalkie format (typically Opus)
-	var audioData []byte
-	if r.converter != nil && msg.Format != service.Audio.Format {
-		// Use audio converter to convert to Opus/Ogg
-		// This would require the specific WhoTalkie format
-		audioData = msg.Data // Placeholder
-	} else {
-		audioData = msg.Data
+	packets, err := r.encodeFor(msg, conn)
+	if err != nil {
+		log.Printf("Cannot convert audio format %s to %s for %s: %v", msg.Format, service.Audio.Format, service.ID, err)
+		return false
+	}
+	if !msg.PTTActive {
+		// The next transmission starts without copies of this one
+		defer conn.redundancyEnc.Reset()
+	}
+	if len(packets) == 0 {
+		return true // The encoder holds the audio until it has a packet
 	}
 
 	// Create WhoTalkie packet (simplified - would need actual WhoTalkie protocol)
 	// For now, just send raw audio data
-	remoteAddr := fmt.Sprintf("%s:%d", service.Network.RemoteAddr, service.Network.RemotePort)
-	udpAddr, err := net.ResolveUDPAddr("udp", remoteAddr)
-	if err != nil {
-		log.Printf("Failed to resolve WhoTalkie address %s: %v", remoteAddr, err)
-		return false
-	}
+	for _, audioData := range packets {
+		// Piggyback earlier frames for loss recovery
+		audioData = conn.redundancyEnc.Encode(audioData)
 
-	udpConn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		log.Printf("Failed to dial WhoTalkie %s: %v", remoteAddr, err)
-		return false
-	}
-	defer udpConn.Close()
+		if err := conn.outbound.send(audioData); err != nil {
+			log.Printf("Failed to send WhoTalkie packet: %v", err)
+			return false
+		}
 
-	_, err = udpConn.Write(audioData)
-	if err != nil {
-		log.Printf("Failed to send WhoTalkie packet: %v", err)
-		return false
+		conn.countSent(1, len(audioData))
 	}
 
-	conn.Stats.MessagesSent++
-	conn.Stats.BytesSent += uint64(len(audioData))
-	conn.Stats.LastActivity = time.Now()
-
 	return true
 }
 
@@ -1000,9 +1902,7 @@ func (r *AudioRouter) sendToDiscordService(msg *AudioMessage, conn *ServiceConne
 	// This would require the Discord bot to be connected and in a voice channel
 	// For now, this is a placeholder
 
-	conn.Stats.MessagesSent++
-	conn.Stats.BytesSent += uint64(len(msg.Data))
-	conn.Stats.LastActivity = time.Now()
+	conn.countSent(1, len(msg.Data))
 
 	// In a real implementation, this would:
 	// 1. Convert audio format to 48kHz PCM for Discord
@@ -1016,61 +1916,36 @@ func (r *AudioRouter) sendToGenericService(msg *AudioMessage, conn *ServiceConne
 	service := conn.Instance
 
 	// Skip if no remote address configured
-	if service.Network.RemoteAddr == "" {
+	if conn.outbound == nil {
 		return false
 	}
 
-	// Use audio data as-is for generic service
-	audioData := msg.Data
-
-	// Send based on protocol
-	remoteAddr := fmt.Sprintf("%s:%d", service.Network.RemoteAddr, service.Network.RemotePort)
+	// Convert audio to the service's format
+	packets, err := r.encodeFor(msg, conn)
+	if err != nil {
+		log.Printf("Cannot convert audio format %s to %s for %s: %v", msg.Format, service.Audio.Format, service.ID, err)
+		return false
+	}
+	if len(packets) == 0 {
+		return true // The encoder holds the audio until it has a packet
+	}
 
+	// Over the service's link: a TCP stream takes the packets as one
+	// write, while over UDP each is a datagram, so encoded frames stay
+	// whole
 	if service.Network.Protocol == "tcp" {
-		// TCP connection
-		tcpAddr, err := net.ResolveTCPAddr("tcp", remoteAddr)
-		if err != nil {
-			log.Printf("Failed to resolve generic TCP address %s: %v", remoteAddr, err)
-			return false
-		}
-
-		tcpConn, err := net.DialTCP("tcp", nil, tcpAddr)
-		if err != nil {
-			log.Printf("Failed to dial generic TCP %s: %v", remoteAddr, err)
-			return false
-		}
-		defer tcpConn.Close()
-
-		_, err = tcpConn.Write(audioData)
-		if err != nil {
-			log.Printf("Failed to send generic TCP packet: %v", err)
-			return false
-		}
-	} else {
-		// UDP connection
-		udpAddr, err := net.ResolveUDPAddr("udp", remoteAddr)
-		if err != nil {
-			log.Printf("Failed to resolve generic UDP address %s: %v", remoteAddr, err)
-			return false
-		}
-
-		udpConn, err := net.DialUDP("udp", nil, udpAddr)
-		if err != nil {
-			log.Printf("Failed to dial generic UDP %s: %v", remoteAddr, err)
-			return false
-		}
-		defer udpConn.Close()
-
-		_, err = udpConn.Write(audioData)
-		if err != nil {
-			log.Printf("Failed to send generic UDP packet: %v", err)
+		packets = [][]byte{bytes.Join(packets, nil)}
+	}
+	bytesSent := 0
+	for _, packet := range packets {
+		if err := conn.outbound.send(packet); err != nil {
+			log.Printf("Failed to send generic packet to %s: %v", service.ID, err)
 			return false
 		}
+		bytesSent += len(packet)
 	}
 
-	conn.Stats.MessagesSent++
-	conn.Stats.BytesSent += uint64(len(audioData))
-	conn.Stats.LastActivity = time.Now()
+	conn.countSent(1, bytesSent)
 
 	return true
 }
@@ -1104,83 +1979,22 @@ func (r *AudioRouter) performHousekeeping() {
 	r.statsMux.Lock()
 	r.stats.ActiveServices = activeCount
 	r.statsMux.Unlock()
-}
 
-// startStatusServer starts the HTTP status/metrics server
-func (r *AudioRouter) startStatusServer() {
-	if r.config.Router.StatusPort == 0 {
-		return
+	// Close converters of talkers who have gone quiet
+	r.convertMux.Lock()
+	for _, pool := range r.formatPools {
+		pool.Prune()
 	}
+	r.convertMux.Unlock()
 
-	addr := fmt.Sprintf(":%d", r.config.Router.StatusPort)
-	log.Printf("Starting HTTP status server on %s", addr)
-
-	// Create HTTP server
-	mux := http.NewServeMux()
-
-	// Status endpoint
-	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
-		r.statsMux.RLock()
-		stats := r.stats
-		r.statsMux.RUnlock()
-
-		r.servicesMux.RLock()
-		services := make([]map[string]interface{}, 0, len(r.services))
-		for id, conn := range r.services {
-			service := map[string]interface{}{
-				"id":        id,
-				"enabled":   conn.Instance.Enabled,
-				"connected": conn.Connection != nil,
-				"type":      string(conn.Instance.Type),
-			}
-			services = append(services, service)
-		}
-		r.servicesMux.RUnlock()
-
-		status := map[string]interface{}{
-			"router": map[string]interface{}{
-				"name":        r.config.Router.Name,
-				"status":      "running",
-				"uptime":      time.Since(stats.UptimeStart).String(),
-				"status_port": r.config.Router.StatusPort,
-			},
-			"services": services,
-			"statistics": map[string]interface{}{
-				"total_messages":       stats.TotalMessages,
-				"routed_messages":      stats.RoutedMessages,
-				"dropped_messages":     stats.DroppedMessages,
-				"conversion_errors":    stats.ConversionErrors,
-				"active_services":      stats.ActiveServices,
-				"active_transmissions": stats.ActiveTransmissions,
-			},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(status); err != nil {
-			http.Error(w, "failed to encode status", http.StatusInternalServerError)
-			log.Printf("encode status error: %v", err)
-			return
+	// Finish recordings of senders that never unkeyed, and apply retention
+	if r.recorder != nil {
+		if err := r.recorder.Expire(time.Now()); err != nil {
+			log.Printf("Recording error: %v", err)
 		}
-	})
-
-	// Health check endpoint
-	mux.HandleFunc("/health", func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}); err != nil {
-			http.Error(w, "failed to encode health", http.StatusInternalServerError)
-			log.Printf("encode health error: %v", err)
-			return
+		if err := r.recorder.Prune(); err != nil {
+			log.Printf("Recording error: %v", err)
 		}
-	})
-
-	server := &http.Server{
-		Addr:    addr,
-		Handler: mux,
-	}
-
-	log.Printf("Status server listening on %s", addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("HTTP server error: %v", err)
 	}
 }
 
@@ -1228,73 +2042,12 @@ func (r *AudioRouter) PrintStats() {
 	fmt.Println()
 }
 
-// parseUSRPPacket attempts to parse a USRP packet by checking the packet type
-func parseUSRPPacket(data []byte) (usrp.Message, error) {
-	if len(data) < 32 {
-		return nil, fmt.Errorf("packet too short for USRP header")
-	}
-
-	// Check magic string "USRP"
-	if string(data[0:4]) != "USRP" {
-		return nil, fmt.Errorf("invalid USRP magic string")
-	}
-
-	// Extract packet type (bytes 20-23, network byte order)
-	packetType := (uint32(data[20]) << 24) | (uint32(data[21]) << 16) | (uint32(data[22]) << 8) | uint32(data[23])
-
-	switch usrp.PacketType(packetType) {
-	case usrp.USRP_TYPE_VOICE:
-		msg := &usrp.VoiceMessage{}
-		if err := msg.Unmarshal(data); err != nil {
-			return nil, err
-		}
-		return msg, nil
-
-	case usrp.USRP_TYPE_DTMF:
-		msg := &usrp.DTMFMessage{}
-		if err := msg.Unmarshal(data); err != nil {
-			return nil, err
-		}
-		return msg, nil
-
-	case usrp.USRP_TYPE_VOICE_ULAW:
-		msg := &usrp.VoiceULawMessage{}
-		if err := msg.Unmarshal(data); err != nil {
-			return nil, err
-		}
-		return msg, nil
-
-	case usrp.USRP_TYPE_TLV:
-		msg := &usrp.TLVMessage{}
-		if err := msg.Unmarshal(data); err != nil {
-			return nil, err
-		}
-		return msg, nil
-
-	case usrp.USRP_TYPE_PING:
-		msg := &usrp.PingMessage{}
-		if err := msg.Unmarshal(data); err != nil {
-			return nil, err
-		}
-		return msg, nil
-
-	default:
-		return nil, fmt.Errorf("unsupported USRP packet type: %d", packetType)
-	}
-}
-
 // Packet handling functions
-func (r *AudioRouter) handleUSRPPacket(service *ServiceInstance, data []byte, remoteAddr net.Addr) error {
-	// Parse USRP packet
-	msg, err := parseUSRPPacket(data)
-	if err != nil {
-		return fmt.Errorf("failed to parse USRP packet: %w", err)
-	}
-
+func (r *AudioRouter) handleUSRPPacket(service *ServiceInstance, rx *usrp.Received) error {
 	// Convert to AudioMessage based on USRP packet type
 	var audioMsg *AudioMessage
 
-	switch typedMsg := msg.(type) {
+	switch typedMsg := rx.Message.(type) {
 	case *usrp.VoiceMessage:
 		// Convert USRP voice to AudioMessage
 		audioData := make([]byte, 320) // 160 samples * 2 bytes
@@ -1309,11 +2062,12 @@ func (r *AudioRouter) handleUSRPPacket(service *ServiceInstance, data []byte, re
 			SourceID:    service.ID,
 			SourceType:  service.Type,
 			SourceName:  service.Name,
+			SourceAddr:  rx.SourceString(),
 			Data:        audioData,
 			Format:      "pcm",
 			SampleRate:  8000,
 			Channels:    1,
-			Timestamp:   time.Now(),
+			Timestamp:   rx.Time,
 			SequenceNum: typedMsg.Header.Seq,
 			PTTActive:   typedMsg.Header.IsPTT(),
 			TalkGroup:   typedMsg.Header.TalkGroup,
@@ -1321,8 +2075,9 @@ func (r *AudioRouter) handleUSRPPacket(service *ServiceInstance, data []byte, re
 		}
 
 	case *usrp.DTMFMessage:
-		// Handle DTMF (could be converted to audio tone or metadata)
-		return nil // Skip DTMF for now
+		// DTMF is signalling for the router, not audio to route
+		r.handleDTMF(service, rx.SourceString(), rune(typedMsg.Digit))
+		return nil
 
 	default:
 		return nil // Skip other packet types
@@ -1337,9 +2092,26 @@ func (r *AudioRouter) handleUSRPPacket(service *ServiceInstance, data []byte, re
 	}
 }
 
-func (r *AudioRouter) handleWhoTalkiePacket(service *ServiceInstance, data []byte, remoteAddr net.Addr) error {
+func (r *AudioRouter) handleWhoTalkiePacket(conn *ServiceConnection, data []byte, remoteAddr net.Addr) error {
 	// WhoTalkie packets are typically Opus-encoded audio
 	// This is a simplified handler
+	service := conn.Instance
+
+	// WhoTalkie has no PTT of its own; without a squelch every packet
+	// counts as keyed
+	keyed := true
+	if conn.squelch != nil {
+		wasOpen := conn.squelchKeyed
+		open, err := r.squelchOpen(conn, data)
+		if err != nil {
+			return err
+		}
+		conn.squelchKeyed = open
+		if !open && !wasOpen {
+			return nil // Squelched
+		}
+		keyed = open // Closing sends this packet as the unkey
+	}
 
 	audioMsg := &AudioMessage{
 		SourceID:   service.ID,
@@ -1350,7 +2122,7 @@ func (r *AudioRouter) handleWhoTalkiePacket(service *ServiceInstance, data []byt
 		SampleRate: service.Audio.SampleRate,
 		Channels:   service.Audio.Channels,
 		Timestamp:  time.Now(),
-		PTTActive:  true, // Assume active transmission
+		PTTActive:  keyed,
 		Priority:   service.Routing.Priority,
 	}
 
@@ -1363,6 +2135,29 @@ func (r *AudioRouter) handleWhoTalkiePacket(service *ServiceInstance, data []byt
 	}
 }
 
+// squelchOpen runs a packet's audio through the service's squelch and
+// reports whether it is open. Packets the decoder holds on to leave the
+// squelch as it was.
+func (r *AudioRouter) squelchOpen(conn *ServiceConnection, data []byte) (bool, error) {
+	if conn.squelchDecoder == nil {
+		samples := make([]int16, len(data)/2)
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+		}
+		return conn.squelch.Process(samples), nil
+	}
+
+	frames, err := conn.squelchDecoder.FormatToUSRP(data)
+	if err != nil {
+		return false, fmt.Errorf("squelch decode: %w", err)
+	}
+	open := conn.squelchKeyed
+	for _, frame := range frames {
+		open = conn.squelch.Process(frame.AudioData[:])
+	}
+	return open, nil
+}
+
 func (r *AudioRouter) handleGenericPacket(service *ServiceInstance, data []byte, remoteAddr net.Addr) error {
 	// Generic packet handler - assumes raw audio data
 
@@ -1388,13 +2183,13 @@ func (r *AudioRouter) handleGenericPacket(service *ServiceInstance, data []byte,
 	}
 }
 
-func (r *AudioRouter) handleGenericTCPConnection(service *ServiceInstance, conn net.Conn) {
+func (r *AudioRouter) handleGenericTCPConnection(service *ServiceConnection, conn net.Conn) {
 	defer conn.Close()
 
 	buffer := make([]byte, 4096)
 	for {
 		select {
-		case <-r.ctx.Done():
+		case <-service.ctx.Done():
 			return
 		default:
 			if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
@@ -1409,7 +2204,7 @@ func (r *AudioRouter) handleGenericTCPConnection(service *ServiceInstance, conn
 				return
 			}
 
-			if err := r.handleGenericPacket(service, buffer[:n], conn.RemoteAddr()); err != nil {
+			if err := r.handleGenericPacket(service.Instance, buffer[:n], conn.RemoteAddr()); err != nil {
 				log.Printf("Generic TCP packet handling error: %v", err)
 			}
 		}
@@ -1417,15 +2212,12 @@ func (r *AudioRouter) handleGenericTCPConnection(service *ServiceInstance, conn
 }
 
 // Configuration management functions
+// loadConfig loads a JSON, YAML or TOML config file, with its includes
+// and environment references (see configfile.Decode)
 func loadConfig(filename string) (*AudioRouterConfig, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
 	var config AudioRouterConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if err := configfile.Decode(filename, &config); err != nil {
+		return nil, err
 	}
 
 	// Validate configuration
@@ -1501,9 +2293,138 @@ func validateConfig(config *AudioRouterConfig) error {
 		}
 	}
 
+	// Validate header profiles
+	for _, service := range config.Services {
+		if service.HeaderProfile != "" {
+			if _, err := resolveHeaderProfile(config, service.HeaderProfile); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+		if service.TLS != nil && service.Type != ServiceTypeUSRP {
+			return fmt.Errorf("service %s: tls is only supported for usrp services", service.ID)
+		}
+		if service.Audio.Format != "pcm" {
+			if _, err := converterFactory(service.Audio.Format, nil, nil); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+		if service.Network.Protocol == "unix" {
+			if service.Type != ServiceTypeUSRP {
+				return fmt.Errorf("service %s: unix sockets are only supported for usrp services", service.ID)
+			}
+			if service.TLS != nil {
+				return fmt.Errorf("service %s: tls is not supported over unix sockets", service.ID)
+			}
+		}
+		switch service.IPVersion {
+		case transport.IPAny, transport.IPv4, transport.IPv6:
+		default:
+			return fmt.Errorf("service %s: ip_version must be \"4\", \"6\" or empty", service.ID)
+		}
+		if service.ACL != nil {
+			if service.Type != ServiceTypeUSRP {
+				return fmt.Errorf("service %s: acl is only supported for usrp services", service.ID)
+			}
+			if _, err := transport.NewACL(service.ACL); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+		if service.SendQueue != nil {
+			if service.Type == ServiceTypeDiscord {
+				return fmt.Errorf("service %s: send_queue is not supported for discord services", service.ID)
+			}
+			switch service.SendQueue.Policy {
+			case "", transport.DropOldest, transport.DropNewest:
+			default:
+				return fmt.Errorf("service %s: send_queue policy must be %q or %q", service.ID, transport.DropOldest, transport.DropNewest)
+			}
+		}
+		if service.Encryption != nil {
+			if service.Type != ServiceTypeUSRP || service.Network.Protocol == "tcp" || service.Network.Protocol == "unix" || service.TLS != nil {
+				return fmt.Errorf("service %s: encryption is only supported for usrp services over plain udp", service.ID)
+			}
+			if _, err := transport.NewPacketCipher(service.Encryption); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+		if service.Proxy != "" {
+			if service.Type != ServiceTypeUSRP || service.Network.Protocol != "tcp" {
+				return fmt.Errorf("service %s: proxy is only supported for usrp services over tcp", service.ID)
+			}
+			if _, err := transport.NewProxyDialer(service.Proxy); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+		if service.Dedupe != nil {
+			if service.Type != ServiceTypeUSRP {
+				return fmt.Errorf("service %s: dedupe is only supported for usrp services", service.ID)
+			}
+			if service.Dedupe.Window < 0 {
+				return fmt.Errorf("service %s: dedupe window must not be negative", service.ID)
+			}
+		}
+		if service.CTCSS != nil {
+			if service.Type != ServiceTypeUSRP {
+				return fmt.Errorf("service %s: ctcss is only supported for usrp services", service.ID)
+			}
+			if service.CTCSS.Tone != 0 && !tones.IsCTCSSTone(service.CTCSS.Tone) {
+				return fmt.Errorf("service %s: %.1f Hz is not a standard CTCSS tone", service.ID, service.CTCSS.Tone)
+			}
+		}
+		if service.Filters != nil {
+			if service.Type != ServiceTypeUSRP {
+				return fmt.Errorf("service %s: filters are only supported for usrp services", service.ID)
+			}
+			if _, err := audio.NewFilterChain(service.Filters); err != nil {
+				return fmt.Errorf("service %s: %w", service.ID, err)
+			}
+		}
+	}
+
+	// Validate blocked pairs
+	for _, pair := range config.Routing.BlockedPairs {
+		from, to, ok := strings.Cut(pair, "->")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return fmt.Errorf("blocked pair %q must be \"source->destination\"", pair)
+		}
+		for _, side := range []string{from, to} {
+			if _, err := path.Match(side, ""); err != nil {
+				return fmt.Errorf("blocked pair %q: %w", pair, err)
+			}
+		}
+	}
+
+	// Validate talkgroup routes and rewrites
+	if err := validateTalkGroups(config); err != nil {
+		return err
+	}
+
+	// Validate directory publishing
+	if config.Directory != nil && config.Directory.URL != "" && config.Directory.Endpoint == "" {
+		return fmt.Errorf("directory publishing requires an endpoint")
+	}
+
+	// Validate ingestion destination
+	if config.Ingest != nil && config.Ingest.Destination != "" && !serviceIDs[config.Ingest.Destination] {
+		return fmt.Errorf("ingest destination %s is not a configured service", config.Ingest.Destination)
+	}
+
 	return nil
 }
 
+// resolveHeaderProfile looks up a header profile, preferring custom
+// definitions from the config over built-in profiles of the same name
+func resolveHeaderProfile(config *AudioRouterConfig, name string) (*usrp.HeaderProfile, error) {
+	if profile, ok := config.HeaderProfiles[name]; ok && profile != nil {
+		if profile.Name == "" {
+			profile.Name = name
+		}
+		return profile, nil
+	}
+	return usrp.LookupProfile(name)
+}
+
 func defaultConfig() *AudioRouterConfig {
 	return &AudioRouterConfig{
 		Router: struct {
@@ -1511,6 +2432,7 @@ func defaultConfig() *AudioRouterConfig {
 			Description string `json:"description"`
 			ListenAddr  string `json:"listen_addr"`
 			StatusPort  int    `json:"status_port"`
+			WatchConfig bool   `json:"watch_config"`
 		}{
 			Name:        "Audio Router Hub",
 			Description: "Hub-and-spoke amateur radio audio router",
@@ -1518,12 +2440,16 @@ func defaultConfig() *AudioRouterConfig {
 			StatusPort:  9090,
 		},
 		Audio: struct {
-			BufferSize       int    `json:"buffer_size"`
-			ProcessingDelay  int    `json:"processing_delay"`
-			MaxConcurrentTx  int    `json:"max_concurrent_tx"`
-			TxTimeoutSeconds int    `json:"tx_timeout_seconds"`
-			EnableConversion bool   `json:"enable_conversion"`
-			DefaultFormat    string `json:"default_format"`
+			BufferSize       int                 `json:"buffer_size"`
+			ProcessingDelay  int                 `json:"processing_delay"`
+			MaxConcurrentTx  int                 `json:"max_concurrent_tx"`
+			TxTimeoutSeconds int                 `json:"tx_timeout_seconds"`
+			EnableConversion bool                `json:"enable_conversion"`
+			DefaultFormat    string              `json:"default_format"`
+			MaxConverters    int                 `json:"max_converters"`
+			OpusPacketLoss   int                 `json:"opus_packet_loss"`
+			OpusDTX          bool                `json:"opus_dtx"`
+			FFmpeg           *audio.FFmpegConfig `json:"ffmpeg,omitempty"`
 		}{
 			BufferSize:       1000,
 			ProcessingDelay:  10,
@@ -1533,10 +2459,11 @@ func defaultConfig() *AudioRouterConfig {
 			DefaultFormat:    "opus",
 		},
 		Routing: struct {
-			PreventLoops        bool     `json:"prevent_loops"`
-			EnablePriorityRules bool     `json:"enable_priority_rules"`
-			DefaultRouting      string   `json:"default_routing"`
-			BlockedPairs        []string `json:"blocked_pairs"`
+			PreventLoops        bool             `json:"prevent_loops"`
+			EnablePriorityRules bool             `json:"enable_priority_rules"`
+			DefaultRouting      string           `json:"default_routing"`
+			BlockedPairs        []string         `json:"blocked_pairs"`
+			TalkGroups          []TalkGroupRoute `json:"talk_groups,omitempty"`
 		}{
 			PreventLoops:        true,
 			EnablePriorityRules: true,
@@ -1611,19 +2538,25 @@ func generateSampleConfig() {
 			Description string `json:"description"`
 			ListenAddr  string `json:"listen_addr"`
 			StatusPort  int    `json:"status_port"`
+			WatchConfig bool   `json:"watch_config"`
 		}{
 			Name:        "Amateur Radio Audio Router Hub",
 			Description: "Hub-and-spoke audio routing for amateur radio services",
 			ListenAddr:  "0.0.0.0",
 			StatusPort:  9090,
+			WatchConfig: true,
 		},
 		Audio: struct {
-			BufferSize       int    `json:"buffer_size"`
-			ProcessingDelay  int    `json:"processing_delay"`
-			MaxConcurrentTx  int    `json:"max_concurrent_tx"`
-			TxTimeoutSeconds int    `json:"tx_timeout_seconds"`
-			EnableConversion bool   `json:"enable_conversion"`
-			DefaultFormat    string `json:"default_format"`
+			BufferSize       int                 `json:"buffer_size"`
+			ProcessingDelay  int                 `json:"processing_delay"`
+			MaxConcurrentTx  int                 `json:"max_concurrent_tx"`
+			TxTimeoutSeconds int                 `json:"tx_timeout_seconds"`
+			EnableConversion bool                `json:"enable_conversion"`
+			DefaultFormat    string              `json:"default_format"`
+			MaxConverters    int                 `json:"max_converters"`
+			OpusPacketLoss   int                 `json:"opus_packet_loss"`
+			OpusDTX          bool                `json:"opus_dtx"`
+			FFmpeg           *audio.FFmpegConfig `json:"ffmpeg,omitempty"`
 		}{
 			BufferSize:       1000,
 			ProcessingDelay:  10,
@@ -1633,10 +2566,11 @@ func generateSampleConfig() {
 			DefaultFormat:    "opus",
 		},
 		Routing: struct {
-			PreventLoops        bool     `json:"prevent_loops"`
-			EnablePriorityRules bool     `json:"enable_priority_rules"`
-			DefaultRouting      string   `json:"default_routing"`
-			BlockedPairs        []string `json:"blocked_pairs"`
+			PreventLoops        bool             `json:"prevent_loops"`
+			EnablePriorityRules bool             `json:"enable_priority_rules"`
+			DefaultRouting      string           `json:"default_routing"`
+			BlockedPairs        []string         `json:"blocked_pairs"`
+			TalkGroups          []TalkGroupRoute `json:"talk_groups,omitempty"`
 		}{
 			PreventLoops:        true,
 			EnablePriorityRules: true,
@@ -1743,6 +2677,10 @@ func generateSampleConfig() {
 					ReceiveFrom: []string{"usrp", "discord"},
 					Priority:    3,
 				},
+				Shaping: &transport.ShaperConfig{
+					MaxPPS: 60,
+					Burst:  10,
+				},
 			},
 			{
 				ID:          "discord_1",
@@ -1751,10 +2689,10 @@ func generateSampleConfig() {
 				Description: "Discord voice channel bridge",
 				Enabled:     false,
 				Settings: map[string]interface{}{
-					"bot_token":  "YOUR_DISCORD_BOT_TOKEN",
-					"guild_id":   "123456789",
-					"channel_id": "987654321",
-					"callsign":   "W1AW",
+					"guild_id":    "123456789",
+					"channel_id":  "987654321",
+					"callsign":    "W1AW",
+					"metrics_url": "http://localhost:9102/metrics.json",
 				},
 				Audio: struct {
 					Format     string `json:"format"`
@@ -1801,5 +2739,5 @@ func generateSampleConfig() {
 	fmt.Println("2. Set your amateur radio callsign")
 	fmt.Println("3. Configure service endpoints (AllStarLink, WhoTalkie, Discord)")
 	fmt.Println("4. Enable the services you want to use")
-	fmt.Printf("5. Run: go run cmd/audio-router/main.go -config %s\n", filename)
+	fmt.Printf("5. Run: go run ./cmd/audio-router -config %s\n", filename)
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbehnke/usrp-go/internal/transport"
+)
+
+// outboundLink carries the packets the router sends a service. They are
+// queued, so routing never waits on the network and one slow destination
+// cannot hold up the rest, and sent by the link's own goroutine over a
+// socket kept open from one packet to the next: UDP datagrams, or a TCP
+// stream for generic TCP services. A socket that fails a write is closed
+// and redialed for the next packet; an address that fails to resolve is
+// tried again with it.
+type outboundLink struct {
+	address string
+	dialer  linkDialer
+	queue   chan []byte
+	policy  transport.DropPolicy
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	queued  uint64 // atomic
+	sent    uint64 // atomic
+	failed  uint64 // atomic
+	dropped uint64 // atomic
+}
+
+// linkDialer sends a link's packets over a socket it keeps open, dialing
+// it again after a failed write
+type linkDialer interface {
+	Send(address string, data []byte) error
+	Stats() transport.DialManagerStats
+	Close() error
+}
+
+// streamWriteTimeout drops a TCP connection that stops taking packets, so
+// it is redialed rather than holding up the link for good
+const streamWriteTimeout = 5 * time.Second
+
+// streamDialer is the linkDialer of a generic TCP link: one connection,
+// dialed for the first packet and again after a write fails
+type streamDialer struct {
+	conn      net.Conn
+	dials     uint64
+	reuses    uint64
+	evictions uint64
+	closed    bool
+	mutex     sync.Mutex
+}
+
+// Send writes data to the connection, dialing it first if need be
+func (d *streamDialer) Send(address string, data []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return fmt.Errorf("dialer is closed")
+	}
+	if d.conn == nil {
+		conn, err := net.DialTimeout("tcp", address, streamWriteTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to dial %s: %w", address, err)
+		}
+		d.conn = conn
+		d.dials++
+	} else {
+		d.reuses++
+	}
+
+	d.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := d.conn.Write(data); err != nil {
+		d.conn.Close()
+		d.conn = nil
+		d.evictions++
+		return err
+	}
+	return nil
+}
+
+// Stats returns the dialer's counters
+func (d *streamDialer) Stats() transport.DialManagerStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	stats := transport.DialManagerStats{Dials: d.dials, Reuses: d.reuses, Evictions: d.evictions}
+	if d.conn != nil {
+		stats.Open = 1
+	}
+	return stats
+}
+
+// Close closes the connection; later sends fail
+func (d *streamDialer) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.closed = true
+	if d.conn == nil {
+		return nil
+	}
+	err := d.conn.Close()
+	d.conn = nil
+	return err
+}
+
+// hasOutboundLink reports whether the router sends to a service over an
+// outbound link, rather than over a stream connection of the service's own
+func hasOutboundLink(service *ServiceInstance) bool {
+	switch service.Type {
+	case ServiceTypeUSRP:
+		return service.Network.Protocol == "udp" && service.TLS == nil
+	case ServiceTypeWhoTalkie, ServiceTypeGeneric:
+		return true
+	}
+	return false
+}
+
+// newOutboundLink starts a link to a service's remote address, with the
+// service's socket options and send queue
+func newOutboundLink(service *ServiceInstance) *outboundLink {
+	var dialer linkDialer = &streamDialer{}
+	if service.Type != ServiceTypeGeneric || service.Network.Protocol != "tcp" {
+		dialConfig := transport.DefaultDialManagerConfig()
+		dialConfig.DSCP = service.DSCP
+		dialConfig.IPVersion = service.IPVersion
+		dialer = transport.NewDialManager(dialConfig)
+	}
+
+	queueConfig := transport.DefaultSendQueueConfig()
+	if service.SendQueue != nil {
+		if service.SendQueue.Size > 0 {
+			queueConfig.Size = service.SendQueue.Size
+		}
+		if service.SendQueue.Policy != "" {
+			queueConfig.Policy = service.SendQueue.Policy
+		}
+	}
+
+	l := &outboundLink{
+		address: net.JoinHostPort(service.Network.RemoteAddr, strconv.Itoa(service.Network.RemotePort)),
+		dialer:  dialer,
+		queue:   make(chan []byte, queueConfig.Size),
+		policy:  queueConfig.Policy,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// send queues a datagram, applying the drop policy when the queue is full
+func (l *outboundLink) send(data []byte) error {
+	select {
+	case <-l.done:
+		return fmt.Errorf("link to %s is closed", l.address)
+	default:
+	}
+
+	for {
+		select {
+		case l.queue <- data:
+			atomic.AddUint64(&l.queued, 1)
+			return nil
+		default:
+		}
+
+		if l.policy == transport.DropNewest {
+			atomic.AddUint64(&l.dropped, 1)
+			return transport.ErrSendQueueFull
+		}
+		// Make room; the sender goroutine may have done so already
+		select {
+		case <-l.queue:
+			atomic.AddUint64(&l.dropped, 1)
+		default:
+		}
+	}
+}
+
+// run sends queued datagrams until the link is closed, logging when sends
+// start failing and when they recover rather than every failure
+func (l *outboundLink) run() {
+	defer close(l.stopped)
+
+	failing := false
+	for {
+		select {
+		case <-l.done:
+			return
+		case data := <-l.queue:
+			if err := l.dialer.Send(l.address, data); err != nil {
+				atomic.AddUint64(&l.failed, 1)
+				if !failing {
+					log.Printf("Sending to %s failed, will redial: %v", l.address, err)
+					failing = true
+				}
+				continue
+			}
+			atomic.AddUint64(&l.sent, 1)
+			if failing {
+				log.Printf("Sending to %s recovered", l.address)
+				failing = false
+			}
+		}
+	}
+}
+
+// close stops the link, discarding anything still queued, and closes its
+// socket
+func (l *outboundLink) close() {
+	l.once.Do(func() {
+		close(l.done)
+		<-l.stopped
+		l.dialer.Close()
+	})
+}
+
+// stats returns the link's queue counters
+func (l *outboundLink) stats() transport.SendQueueStats {
+	return transport.SendQueueStats{
+		Queued:  atomic.LoadUint64(&l.queued),
+		Sent:    atomic.LoadUint64(&l.sent),
+		Failed:  atomic.LoadUint64(&l.failed),
+		Dropped: atomic.LoadUint64(&l.dropped),
+		Depth:   len(l.queue),
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutboundLink_OneSocket(t *testing.T) {
+	pc, service := listener(t, "whotalkie", ServiceTypeWhoTalkie, "opus")
+	link := newOutboundLink(&service)
+	defer link.close()
+
+	for i := 0; i < 5; i++ {
+		if err := link.send([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var from net.Addr
+	buf := make([]byte, 16)
+	for i := 0; i < 5; i++ {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 || buf[0] != byte(i) {
+			t.Errorf("Packet %d arrived as %v", i, buf[:n])
+		}
+		if from != nil && addr.String() != from.String() {
+			t.Errorf("Packet %d came from %s, the first from %s", i, addr, from)
+		}
+		from = addr
+	}
+	if stats := link.dialer.Stats(); stats.Dials != 1 {
+		t.Errorf("Dialed %d sockets for 5 packets", stats.Dials)
+	}
+	if stats := link.stats(); stats.Queued != 5 || stats.Sent != 5 {
+		t.Errorf("Stats %+v", stats)
+	}
+}
+
+func TestOutboundLink_Redial(t *testing.T) {
+	// A port with nothing listening: sends fail once it refuses them
+	pc, service := listener(t, "whotalkie", ServiceTypeWhoTalkie, "opus")
+	address := pc.LocalAddr().String()
+	pc.Close()
+
+	link := newOutboundLink(&service)
+	defer link.close()
+	waitFor(t, "a refused send", func() bool {
+		link.send([]byte("lost"))
+		return link.stats().Failed > 0
+	})
+
+	// The peer comes back, and the link redials it
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		t.Skipf("Port taken meanwhile: %v", err)
+	}
+	defer pc.Close()
+	received := make(chan struct{})
+	go func() {
+		buf := make([]byte, 16)
+		pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := pc.ReadFrom(buf); err == nil {
+			close(received)
+		}
+	}()
+	waitFor(t, "a packet after the redial", func() bool {
+		link.send([]byte("found"))
+		select {
+		case <-received:
+			return true
+		default:
+			return false
+		}
+	})
+	if stats := link.dialer.Stats(); stats.Dials < 2 {
+		t.Errorf("Dialed %d sockets, want a redial", stats.Dials)
+	}
+}
+
+func TestOutboundLink_Closed(t *testing.T) {
+	_, service := listener(t, "whotalkie", ServiceTypeWhoTalkie, "opus")
+	link := newOutboundLink(&service)
+	link.close()
+	link.close()
+	if err := link.send([]byte("late")); err == nil {
+		t.Error("Closed link accepted a packet")
+	}
+}
+
+func TestOutboundLink_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	service := ServiceInstance{ID: "recorder", Type: ServiceTypeGeneric}
+	service.Network.Protocol = "tcp"
+	service.Network.RemoteAddr = "127.0.0.1"
+	service.Network.RemotePort = ln.Addr().(*net.TCPAddr).Port
+	link := newOutboundLink(&service)
+	defer link.close()
+
+	// One connection carries every packet
+	for _, packet := range []string{"one", "two", "six"} {
+		if err := link.send([]byte(packet)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("Link never connected")
+	}
+	buf := make([]byte, 9)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "onetwosix" {
+		t.Fatalf("Received %q: %v", buf, err)
+	}
+	if stats := link.dialer.Stats(); stats.Dials != 1 || stats.Open != 1 {
+		t.Errorf("Dialer %+v", stats)
+	}
+
+	// The peer hangs up, and the link dials it again
+	conn.Close()
+	waitFor(t, "a redial", func() bool {
+		link.send([]byte("more"))
+		return link.dialer.Stats().Dials == 2
+	})
+	select {
+	case conn = <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Link never reconnected")
+	}
+}
+
+func TestHasOutboundLink(t *testing.T) {
+	for _, tc := range []struct {
+		serviceType ServiceType
+		protocol    string
+		want        bool
+	}{
+		{ServiceTypeUSRP, "udp", true},
+		{ServiceTypeUSRP, "tcp", false},
+		{ServiceTypeWhoTalkie, "udp", true},
+		{ServiceTypeGeneric, "udp", true},
+		{ServiceTypeGeneric, "tcp", true},
+		{ServiceTypeDiscord, "udp", false},
+	} {
+		service := &ServiceInstance{Type: tc.serviceType}
+		service.Network.Protocol = tc.protocol
+		if got := hasOutboundLink(service); got != tc.want {
+			t.Errorf("%s over %s: %v", tc.serviceType, tc.protocol, got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// errPreempted drops the audio of a transmission a higher-priority one
+// has preempted, until its source unkeys
+var errPreempted = errors.New("transmission preempted")
+
+// preemption is a transmission cut off by a higher-priority one
+type preemption struct {
+	by        string    // Source ID of the transmission that preempted it
+	lastHeard time.Time // Last packet dropped, for expiry if the unkey is lost
+}
+
+// lowestPriority returns the transmission with the lowest priority below
+// priority, or nil if there is none. Of equal priorities the one from the
+// first source ID in order goes, so the choice is repeatable.
+func lowestPriority(transmissions map[string]*AudioMessage, priority int) *AudioMessage {
+	ids := make([]string, 0, len(transmissions))
+	for id := range transmissions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var lowest *AudioMessage
+	for _, id := range ids {
+		tx := transmissions[id]
+		if tx.Priority < priority && (lowest == nil || tx.Priority < lowest.Priority) {
+			lowest = tx
+		}
+	}
+	return lowest
+}
+
+// preempt cuts off a transmission for a higher-priority one: its
+// destinations hear it unkey, its converters close, and its service is
+// told why
+func (r *AudioRouter) preempt(tx, by *AudioMessage) {
+	log.Printf("Transmission from %s (priority %d) preempted by %s (priority %d)",
+		tx.SourceID, tx.Priority, by.SourceID, by.Priority)
+
+	unkey := &AudioMessage{
+		SourceID:     tx.SourceID,
+		SourceType:   tx.SourceType,
+		SourceName:   tx.SourceName,
+		SourceAddr:   tx.SourceAddr,
+		Data:         make([]byte, usrp.VoiceFrameSize*2),
+		Format:       "pcm",
+		SampleRate:   audio.USRPSampleRate,
+		Channels:     1,
+		Timestamp:    time.Now(),
+		SequenceNum:  tx.SequenceNum + 1,
+		CallSign:     tx.CallSign,
+		TalkGroup:    tx.TalkGroup,
+		RouteToTypes: tx.RouteToTypes,
+		ExcludeIDs:   tx.ExcludeIDs,
+		Priority:     tx.Priority,
+	}
+	r.activity.observe(unkey, unkey.Timestamp)
+
+	destinations := r.getRoutingDestinations(unkey)
+	for _, dest := range destinations {
+		r.sendToService(unkey, dest)
+	}
+	r.endStreams(tx.SourceID, destinations)
+
+	r.notifyPreempted(tx, by)
+}
+
+// notifyPreempted tells the service of a preempted transmission who
+// preempted it, with a USRP text message. Only USRP services are told;
+// other services have no way to hear it.
+func (r *AudioRouter) notifyPreempted(tx, by *AudioMessage) {
+	r.servicesMux.RLock()
+	conn := r.services[tx.SourceID]
+	connected := conn != nil && (conn.outbound != nil || conn.stream != nil)
+	r.servicesMux.RUnlock()
+	if !connected || conn.Instance.Type != ServiceTypeUSRP {
+		return
+	}
+
+	name := by.SourceName
+	if name == "" {
+		name = by.SourceID
+	}
+	text := "Preempted by " + name
+	if limit := usrp.CurrentLimits().MaxTextLength; limit > 0 && len(text) > limit {
+		text = text[:limit]
+	}
+	msg := &usrp.TextMessage{
+		Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, tx.SequenceNum+2),
+		Text:   []byte(text),
+	}
+	msg.Header.TalkGroup = egressTalkGroup(conn, tx.TalkGroup)
+	conn.profile.Outbound(msg)
+
+	data, err := msg.Marshal()
+	if err != nil {
+		log.Printf("Failed to marshal preemption notice: %v", err)
+		return
+	}
+	r.sendUSRPPacket(conn, data)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// level returns a frame of constant level as PCM
+func level(sample int16) []byte {
+	samples := make([]int16, usrp.VoiceFrameSize)
+	for i := range samples {
+		samples[i] = sample
+	}
+	return pcmBytes(samples)
+}
+
+// parseAll parses received USRP packets
+func parseAll(t *testing.T, packets [][]byte) []usrp.Message {
+	t.Helper()
+	var msgs []usrp.Message
+	for _, packet := range packets {
+		msg, err := usrp.Parse(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestPreemption(t *testing.T) {
+	lowPC, low := listener(t, "low", ServiceTypeUSRP, "pcm")
+	highPC, high := listener(t, "high", ServiceTypeUSRP, "pcm")
+	destPC, dest := listener(t, "dest", ServiceTypeUSRP, "pcm")
+	r := newConvertRouter(t, low, high, dest)
+	r.config.Audio.MaxConcurrentTx = 1
+	r.config.Routing.EnablePriorityRules = true
+
+	send := func(source string, priority int, sample int16, keyed bool) {
+		r.routeAudioMessage(&AudioMessage{SourceID: source, Format: "pcm", Data: level(sample),
+			Timestamp: time.Now(), PTTActive: keyed, Priority: priority, TalkGroup: 91})
+	}
+	send("low", 1, 1000, true)
+	send("high", 5, 2000, true)
+	send("high", 5, 2000, true) // Carries on over the limit it holds
+	send("low", 1, 1000, true)  // Cut off
+	send("low", 1, 1000, false) // Its unkey too
+
+	msgs := parseAll(t, receive(t, destPC))
+	if len(msgs) != 4 {
+		t.Fatalf("Destination received %d packets, want 4", len(msgs))
+	}
+	for i, want := range []struct {
+		sample int16
+		keyed  bool
+	}{{1000, true}, {0, false}, {2000, true}, {2000, true}} {
+		voice := msgs[i].(*usrp.VoiceMessage)
+		if voice.AudioData[0] != want.sample || voice.Header.IsPTT() != want.keyed {
+			t.Errorf("Packet %d: level %d, keyed %v; want %d, %v",
+				i, voice.AudioData[0], voice.Header.IsPTT(), want.sample, want.keyed)
+		}
+	}
+
+	// The preempted source is told, then hears the preempting one
+	msgs = parseAll(t, receive(t, lowPC))
+	if len(msgs) != 3 {
+		t.Fatalf("Preempted source received %d packets, want 3", len(msgs))
+	}
+	if text, ok := msgs[0].(*usrp.TextMessage); !ok || string(text.Text) != "Preempted by high" || text.Header.TalkGroup != 91 {
+		t.Errorf("Notice %+v", msgs[0])
+	}
+	if n := len(receive(t, highPC)); n != 2 {
+		t.Errorf("Preempting source received %d packets, want the first transmission and its unkey", n)
+	}
+
+	r.statsMux.RLock()
+	preemptions := r.stats.Preemptions
+	r.statsMux.RUnlock()
+	r.txMux.RLock()
+	cutOff := len(r.preempted)
+	r.txMux.RUnlock()
+	if preemptions != 1 || cutOff != 0 {
+		t.Errorf("%d preemptions, %d sources still cut off", preemptions, cutOff)
+	}
+
+	// Unkeyed, the preempted source can wait its turn
+	if _, err := r.manageTransmission(&AudioMessage{SourceID: "low", PTTActive: true, Priority: 1, Timestamp: time.Now()}); err == nil {
+		t.Error("Lower priority transmission accepted over the limit")
+	}
+}
+
+func TestLowestPriority(t *testing.T) {
+	transmissions := map[string]*AudioMessage{
+		"b": {SourceID: "b", Priority: 2},
+		"a": {SourceID: "a", Priority: 2},
+		"c": {SourceID: "c", Priority: 4},
+	}
+	for priority, want := range map[int]string{5: "a", 3: "a", 2: "", 0: ""} {
+		got := ""
+		if tx := lowestPriority(transmissions, priority); tx != nil {
+			got = tx.SourceID
+		}
+		if got != want {
+			t.Errorf("Priority %d preempts %q, want %q", priority, got, want)
+		}
+	}
+}
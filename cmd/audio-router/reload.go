@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dbehnke/usrp-go/internal/configfile"
+)
+
+// configDebounce lets a burst of writes to the config file settle before
+// it is reloaded
+const configDebounce = 500 * time.Millisecond
+
+// configWatcher reloads the config file whenever it, or a file it
+// includes, changes
+func (r *AudioRouter) configWatcher() {
+	var files []string
+	var changes <-chan struct{}
+	stopWatching := func() {}
+	defer func() { stopWatching() }()
+
+	for {
+		// Each reload may include other files
+		latest, err := configfile.Files(r.configFile)
+		if err != nil {
+			// Keep watching what was watched until the file loads again
+			latest = files
+			if latest == nil {
+				latest = []string{r.configFile}
+			}
+		}
+		if !slices.Equal(latest, files) {
+			stopWatching()
+			ctx, cancel := context.WithCancel(r.ctx)
+			if changes, err = watchFiles(ctx, latest); err != nil {
+				cancel()
+				log.Printf("Config file watching disabled: %v", err)
+				return
+			}
+			stopWatching = cancel
+			files = latest
+			log.Printf("Watching %s for changes", strings.Join(files, ", "))
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-changes:
+		}
+
+		// Editors and tools write in several steps; reload once they are done
+		timer := time.NewTimer(configDebounce)
+	settle:
+		for {
+			select {
+			case <-r.ctx.Done():
+				timer.Stop()
+				return
+			case <-changes:
+				timer.Reset(configDebounce)
+			case <-timer.C:
+				break settle
+			}
+		}
+
+		if err := r.ReloadConfig(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+		}
+	}
+}
+
+// ReloadConfig reloads the config file and applies what changed: added
+// services are started, removed ones stopped and edited ones restarted,
+// while services left as they were carry on undisturbed, transmissions
+// and all. Routing rules and transmission limits apply at once; other
+// router settings need a restart. An invalid file changes nothing.
+func (r *AudioRouter) ReloadConfig() error {
+	if r.configFile == "" {
+		return fmt.Errorf("no config file to reload")
+	}
+	config, err := loadConfig(r.configFile)
+	if err != nil {
+		return err
+	}
+
+	r.configMux.Lock()
+	defer r.configMux.Unlock()
+
+	previous := make(map[string]*ServiceInstance, len(r.config.Services))
+	for i := range r.config.Services {
+		previous[r.config.Services[i].ID] = &r.config.Services[i]
+	}
+	current := make(map[string]bool, len(config.Services))
+	for _, service := range config.Services {
+		current[service.ID] = true
+	}
+
+	var changes []string
+	for id := range previous {
+		if !current[id] {
+			r.stopService(id)
+			changes = append(changes, "removed "+id)
+		}
+	}
+	for i := range config.Services {
+		service := &config.Services[i]
+		old, ok := previous[service.ID]
+		if ok && reflect.DeepEqual(old, service) {
+			continue
+		}
+		if ok {
+			r.stopService(service.ID)
+			changes = append(changes, "updated "+service.ID)
+		} else {
+			changes = append(changes, "added "+service.ID)
+		}
+		if service.Enabled {
+			if err := r.startService(service); err != nil {
+				log.Printf("Warning: Failed to start service %s: %v", service.ID, err)
+			}
+		}
+	}
+	r.config.Services = config.Services
+
+	r.rulesMux.Lock()
+	if !reflect.DeepEqual(r.config.Routing, config.Routing) ||
+		r.config.Audio.MaxConcurrentTx != config.Audio.MaxConcurrentTx ||
+		r.config.Audio.TxTimeoutSeconds != config.Audio.TxTimeoutSeconds {
+		changes = append(changes, "routing rules")
+	}
+	r.config.Routing = config.Routing
+	r.talkGroups = parseTalkGroupRoutes(config.Routing.TalkGroups)
+	r.config.Audio.MaxConcurrentTx = config.Audio.MaxConcurrentTx
+	r.config.Audio.TxTimeoutSeconds = config.Audio.TxTimeoutSeconds
+	r.rulesMux.Unlock()
+
+	if needsRestart(r.config, config) {
+		log.Printf("Config reload: router settings other than services, routing and transmission limits changed; restart to apply them")
+	}
+	if len(changes) > 0 {
+		log.Printf("Config reloaded: %s", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// needsRestart reports whether the settings a reload cannot apply differ
+// between the running and reloaded configs
+func needsRestart(running, reloaded *AudioRouterConfig) bool {
+	a, b := *running, *reloaded
+	for _, config := range []*AudioRouterConfig{&a, &b} {
+		config.Services = nil
+		config.Routing = reloaded.Routing
+		config.Audio.MaxConcurrentTx = 0
+		config.Audio.TxTimeoutSeconds = 0
+	}
+	return !reflect.DeepEqual(a, b)
+}
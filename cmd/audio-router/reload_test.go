@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig saves config to the router's config file for it to reload
+func writeConfig(t *testing.T, r *AudioRouter, config *AudioRouterConfig) {
+	t.Helper()
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(r.configFile, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	r := newAPIRouter(t)
+	unaffected := running(r, "generic_1")
+
+	config, err := loadConfig(r.configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Routing.DefaultRouting = "none"
+	config.Audio.MaxConcurrentTx = 7
+	config.Services = append(config.Services,
+		ServiceInstance{ID: "generic_2", Type: ServiceTypeGeneric, Name: "Added", Enabled: true},
+		ServiceInstance{ID: "generic_3", Type: ServiceTypeGeneric, Name: "Disabled"})
+	writeConfig(t, r, config)
+	if err := r.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if running(r, "generic_1") != unaffected {
+		t.Error("Reload restarted an unchanged service")
+	}
+	if running(r, "generic_2") == nil || running(r, "generic_3") != nil {
+		t.Error("Reload did not start the enabled new service only")
+	}
+	if r.config.Routing.DefaultRouting != "none" || r.config.Audio.MaxConcurrentTx != 7 || len(r.config.Services) != 3 {
+		t.Errorf("Reloaded config %+v", r.config)
+	}
+
+	// Edit one service and remove another
+	added := running(r, "generic_2")
+	config.Services = config.Services[1:]
+	config.Services[0].Name = "Edited"
+	writeConfig(t, r, config)
+	if err := r.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if running(r, "generic_1") != nil {
+		t.Error("Removed service still running")
+	}
+	if conn := running(r, "generic_2"); conn == nil || conn == added || conn.Instance.Name != "Edited" {
+		t.Errorf("Edited service %+v not restarted", conn)
+	}
+
+	// An invalid file changes nothing
+	config.Services = append(config.Services, config.Services[0])
+	writeConfig(t, r, config)
+	if err := r.ReloadConfig(); err == nil {
+		t.Error("Duplicate service IDs reloaded")
+	}
+	if len(r.config.Services) != 2 || running(r, "generic_2") == nil {
+		t.Errorf("Failed reload changed services %+v", r.config.Services)
+	}
+}
+
+func TestNeedsRestart(t *testing.T) {
+	running := defaultConfig()
+	reloaded := defaultConfig()
+	reloaded.Routing.DefaultRouting = "none"
+	reloaded.Audio.TxTimeoutSeconds = 99
+	reloaded.Services = nil
+	if needsRestart(running, reloaded) {
+		t.Error("Routing, limits and services need a restart")
+	}
+	reloaded.Router.StatusPort++
+	if !needsRestart(running, reloaded) {
+		t.Error("Status port change applied without a restart")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio-router.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := watchFiles(ctx, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaced by renaming over it, as saveConfig does
+	time.Sleep(10 * time.Millisecond)
+	replacement := path + ".new"
+	if err := os.WriteFile(replacement, []byte(`{"services": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change not noticed")
+	}
+}
+
+func TestWatchFiles_Included(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "audio-router.yaml")
+	included := filepath.Join(dir, "services", "allstar.yaml")
+	if err := os.MkdirAll(filepath.Dir(included), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{main, included} {
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := watchFiles(ctx, []string{main, included})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other files in the watched directories are no change
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("Unwatched file noticed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(included, []byte("services: []"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change to the included file not noticed")
+	}
+}
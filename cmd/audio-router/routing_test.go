@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newRoutingRouter creates a router with two Discord and two USRP
+// services that can all receive, registered but not started
+func newRoutingRouter(t *testing.T, blockedPairs ...string) *AudioRouter {
+	t.Helper()
+	config := defaultConfig()
+	config.Audio.EnableConversion = false
+	config.Routing.BlockedPairs = blockedPairs
+	config.Services = nil
+	for _, id := range []string{"discord1", "discord2", "usrp1", "usrp2"} {
+		service := ServiceInstance{ID: id, Type: ServiceTypeUSRP, Enabled: true}
+		if strings.HasPrefix(id, "discord") {
+			service.Type = ServiceTypeDiscord
+		}
+		service.Routing.CanReceive = true
+		config.Services = append(config.Services, service)
+	}
+	if err := validateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewAudioRouter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.cancel)
+	for i := range config.Services {
+		r.services[config.Services[i].ID] = &ServiceConnection{Instance: &config.Services[i]}
+	}
+	return r
+}
+
+// destinations returns the IDs audio from source is routed to, sorted
+func destinations(r *AudioRouter, source string) string {
+	var ids []string
+	for _, conn := range r.getRoutingDestinations(&AudioMessage{SourceID: source, PTTActive: true}) {
+		ids = append(ids, conn.Instance.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestBlockedPairs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		pairs   []string
+		source  string
+		reaches string
+	}{
+		{"none", nil, "discord1", "discord2,usrp1,usrp2"},
+		{"one pair", []string{"discord1->usrp2"}, "discord1", "discord2,usrp1"},
+		{"one direction only", []string{"discord1->usrp2"}, "usrp2", "discord1,discord2,usrp1"},
+		{"spaces", []string{" discord1 -> usrp2 "}, "discord1", "discord2,usrp1"},
+		{"wildcards", []string{"discord*->usrp*"}, "discord2", "discord1"},
+		{"wildcards other way", []string{"discord*->usrp*"}, "usrp1", "discord1,discord2,usrp2"},
+		{"by type", []string{"usrp->discord"}, "usrp1", "usrp2"},
+		{"to everything", []string{"usrp2->*"}, "usrp2", ""},
+		{"unknown source", []string{"ingest->usrp1"}, "ingest", "discord1,discord2,usrp2"},
+	} {
+		r := newRoutingRouter(t, tc.pairs...)
+		if reaches := destinations(r, tc.source); reaches != tc.reaches {
+			t.Errorf("%s: %s reaches %q, want %q", tc.name, tc.source, reaches, tc.reaches)
+		}
+	}
+}
+
+func TestBlockedPairs_Matrix(t *testing.T) {
+	r := newRoutingRouter(t, "discord*->usrp*")
+	matrix := r.routingMatrix()
+	if got := strings.Join(matrix.Routes["discord1"], ","); got != "discord2" {
+		t.Errorf("discord1 routes to %s", got)
+	}
+	if got := strings.Join(matrix.Routes["usrp1"], ","); got != "discord1,discord2,usrp2" {
+		t.Errorf("usrp1 routes to %s", got)
+	}
+}
+
+func TestBlockedPairs_Invalid(t *testing.T) {
+	for _, pair := range []string{"discord1", "discord1->", "->usrp1", "discord[->usrp1"} {
+		config := defaultConfig()
+		config.Routing.BlockedPairs = []string{pair}
+		if err := validateConfig(config); err == nil {
+			t.Errorf("Blocked pair %q accepted", pair)
+		}
+	}
+}
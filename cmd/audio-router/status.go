@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dbehnke/usrp-go/internal/transport"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// redacted replaces secrets in the configuration served on /config
+const redacted = "[REDACTED]"
+
+// redactedPassword replaces the password in a redacted proxy URL
+const redactedPassword = "xxxxx"
+
+// startStatusServer starts the HTTP status/metrics server
+func (r *AudioRouter) startStatusServer() {
+	if r.config.Router.StatusPort == 0 {
+		return
+	}
+
+	addr := fmt.Sprintf(":%d", r.config.Router.StatusPort)
+	log.Printf("Starting HTTP status server on %s", addr)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: r.statusHandler(),
+	}
+
+	log.Printf("Status server listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("HTTP server error: %v", err)
+	}
+}
+
+// statusHandler serves the router's status, metrics and health endpoints,
+// the dashboard and the service management API
+func (r *AudioRouter) statusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", r.handleStatus)
+	mux.HandleFunc("GET /services", r.handleServices)
+	mux.HandleFunc("GET /config", r.handleConfig)
+	mux.HandleFunc("GET /metrics", r.handleMetrics)
+	mux.HandleFunc("GET /health", r.handleHealth)
+	mux.HandleFunc("GET /healthz", r.handleHealthz)
+	mux.HandleFunc("GET /routing", r.handleRouting)
+	mux.HandleFunc("GET /activity", r.handleActivity)
+	mux.HandleFunc("GET /ws", r.handleLive)
+	mux.HandleFunc("GET /{$}", handleDashboard)
+	mux.HandleFunc("GET /api/services", r.requireToken(r.handleListServices))
+	mux.HandleFunc("GET /api/services/{id}", r.requireToken(r.handleGetService))
+	mux.HandleFunc("POST /api/services/{id}", r.requireToken(r.handleCreateService))
+	mux.HandleFunc("PATCH /api/services/{id}", r.requireToken(r.handleUpdateService))
+	mux.HandleFunc("DELETE /api/services/{id}", r.requireToken(r.handleDeleteService))
+	return mux
+}
+
+// handleStatus reports the router's uptime and counters, and each
+// service's state in brief
+func (r *AudioRouter) handleStatus(w http.ResponseWriter, req *http.Request) {
+	r.statsMux.RLock()
+	stats := r.stats
+	r.statsMux.RUnlock()
+
+	r.servicesMux.RLock()
+	services := make([]map[string]interface{}, 0, len(r.services))
+	for id, conn := range r.services {
+		services = append(services, serviceStatus(id, conn))
+	}
+	r.servicesMux.RUnlock()
+
+	status := map[string]interface{}{
+		"router": map[string]interface{}{
+			"name":        r.config.Router.Name,
+			"status":      "running",
+			"uptime":      time.Since(stats.UptimeStart).String(),
+			"status_port": r.config.Router.StatusPort,
+		},
+		"services": services,
+		"statistics": map[string]interface{}{
+			"total_messages":       stats.TotalMessages,
+			"routed_messages":      stats.RoutedMessages,
+			"dropped_messages":     stats.DroppedMessages,
+			"conversion_errors":    stats.ConversionErrors,
+			"preemptions":          stats.Preemptions,
+			"active_services":      stats.ActiveServices,
+			"active_transmissions": stats.ActiveTransmissions,
+			"input_limit_rejects":  usrp.LimitStats(),
+		},
+		"usrp_traffic": r.usrpStats.Snapshot(),
+	}
+	if r.converters != nil {
+		status["converter"] = r.converters.Health()
+		status["converter_pool"] = r.converters.Stats()
+	}
+	r.metersMux.Lock()
+	if len(r.converterMeters) > 0 {
+		metrics := make(map[string]audio.ConverterMetrics, len(r.converterMeters))
+		for format, meter := range r.converterMeters {
+			metrics[format] = meter.Metrics()
+		}
+		status["converter_metrics"] = metrics
+	}
+	r.metersMux.Unlock()
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// serviceStatus reports a service's state and the counters of whatever
+// carries it. Must be called with servicesMux held.
+func serviceStatus(id string, conn *ServiceConnection) map[string]interface{} {
+	conn.statsMux.Lock()
+	shaped := conn.Stats.Shaped
+	conn.statsMux.Unlock()
+
+	service := map[string]interface{}{
+		"id":        id,
+		"enabled":   conn.Instance.Enabled,
+		"connected": conn.Connection != nil,
+		"type":      string(conn.Instance.Type),
+		"shaped":    shaped,
+	}
+	if conn.redundancyDec != nil {
+		service["redundancy"] = conn.redundancyDec.Stats()
+	}
+	if conn.server != nil {
+		service["peers"] = conn.server.Peers()
+		if conn.Instance.RateLimit != nil {
+			service["rate_limit"] = conn.server.RateLimitStats()
+		}
+		if conn.Instance.Dedupe != nil {
+			service["dedupe"] = conn.server.DedupeStats()
+		}
+		if conn.Instance.ACL != nil {
+			service["acl"] = conn.server.ACLStats()
+		}
+	}
+	if conn.cipher != nil {
+		// Sends are sealed by the router, receives opened by the listener
+		encryption := conn.cipher.Stats()
+		if conn.server != nil {
+			inbound := conn.server.EncryptionStats()
+			encryption.Sealed += inbound.Sealed
+			encryption.Opened += inbound.Opened
+			encryption.Rejected += inbound.Rejected
+		}
+		service["encryption"] = encryption
+	}
+	if conn.stream != nil {
+		service["send_queue"] = conn.stream.SendQueueStats()
+	}
+	if conn.outbound != nil {
+		service["send_queue"] = conn.outbound.stats()
+		service["sockets"] = conn.outbound.dialer.Stats()
+	}
+	if notifier, ok := conn.stream.(transport.StateNotifier); ok {
+		service["link_state"] = notifier.State().String()
+	}
+	return service
+}
+
+// handleServices reports each service in full, by ID: its state, message
+// counters and link metrics
+func (r *AudioRouter) handleServices(w http.ResponseWriter, req *http.Request) {
+	reports := r.linkMetrics.Reports()
+
+	r.servicesMux.RLock()
+	services := make([]map[string]interface{}, 0, len(r.services))
+	for id, conn := range r.services {
+		service := serviceStatus(id, conn)
+		conn.statsMux.Lock()
+		stats, lastSeen := conn.Stats, conn.LastSeen
+		conn.statsMux.Unlock()
+		service["name"] = conn.Instance.Name
+		service["description"] = conn.Instance.Description
+		service["last_seen"] = lastSeen
+		service["tx_active"] = conn.TxActive
+		service["rx_active"] = conn.RxActive
+		service["stats"] = map[string]interface{}{
+			"messages_sent":     stats.MessagesSent,
+			"messages_received": stats.MessagesReceived,
+			"bytes_sent":        stats.BytesSent,
+			"bytes_received":    stats.BytesReceived,
+			"errors":            stats.Errors,
+			"last_activity":     stats.LastActivity,
+		}
+		if report, ok := reports[id]; ok {
+			service["link"] = report
+		}
+		services = append(services, service)
+	}
+	r.servicesMux.RUnlock()
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i]["id"].(string) < services[j]["id"].(string)
+	})
+	writeJSON(w, http.StatusOK, services)
+}
+
+// handleConfig serves the router's configuration with its secrets redacted
+func (r *AudioRouter) handleConfig(w http.ResponseWriter, req *http.Request) {
+	r.configMux.RLock()
+	config, err := sanitizeConfig(r.config)
+	r.configMux.RUnlock()
+	if err != nil {
+		http.Error(w, "failed to encode config", http.StatusInternalServerError)
+		log.Printf("encode config error: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, config)
+}
+
+// handleMetrics serves the link and converter metrics to Prometheus
+func (r *AudioRouter) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.linkMetrics.WriteTo(w)
+	r.converterMetrics.WriteTo(w)
+}
+
+// handleHealth reports whether the router is healthy, or degraded with
+// routing carrying on without format conversion
+func (r *AudioRouter) handleHealth(w http.ResponseWriter, req *http.Request) {
+	health := map[string]string{"status": "healthy"}
+	if r.converters != nil {
+		if converter := r.converters.Health(); !converter.Healthy {
+			// FFmpeg is down or restarting; routing without conversion continues
+			health["status"] = "degraded"
+			health["converter"] = converter.LastError
+		}
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// handleHealthz is the liveness probe: OK while the router runs, and 503
+// once it is shutting down
+func (r *AudioRouter) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	if r.ctx.Err() != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "stopping"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// sanitizeConfig returns a copy of config with its secrets redacted: the
+// directory token, encryption keys, proxy passwords, and service settings
+// named like tokens, secrets, passwords or keys
+func sanitizeConfig(config *AudioRouterConfig) (*AudioRouterConfig, error) {
+	// A round trip through JSON copies everything the config dump shows
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var sanitized AudioRouterConfig
+	if err := json.Unmarshal(data, &sanitized); err != nil {
+		return nil, err
+	}
+
+	if sanitized.Directory != nil && sanitized.Directory.Token != "" {
+		sanitized.Directory.Token = redacted
+	}
+	if sanitized.API != nil && sanitized.API.Token != "" {
+		sanitized.API.Token = redacted
+	}
+	for i := range sanitized.Services {
+		redactService(&sanitized.Services[i])
+	}
+	return &sanitized, nil
+}
+
+// redactService redacts a service's secrets in place; service must be a
+// copy, not one of the router's own
+func redactService(service *ServiceInstance) {
+	if service.Encryption != nil && service.Encryption.Key != "" {
+		service.Encryption.Key = redacted
+	}
+	if proxy, err := url.Parse(service.Proxy); err == nil && proxy.User != nil {
+		service.Proxy = proxy.Redacted()
+	}
+	for name, value := range service.Settings {
+		if secretSetting(name) && value != "" {
+			service.Settings[name] = redacted
+		}
+	}
+}
+
+// secretSetting reports whether a service setting holds a secret, by its
+// name: bot_token, client_secret, password, api_key and the like
+func secretSetting(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"token", "secret", "password", "passwd"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return name == "key" || strings.HasSuffix(name, "_key")
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("encode response error: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// TalkGroupRoute carries talkgroups only to the services subscribed to
+// them, so one hub can carry several talkgroups side by side
+type TalkGroupRoute struct {
+	TalkGroups string   `json:"talk_groups"` // A talkgroup, a range or a list of both: "91", "3100-3199", "91,3100-3199"
+	Services   []string `json:"services"`    // Subscribers by service ID or type, globs allowed as in blocked_pairs
+}
+
+// talkGroupRange is an inclusive range of talkgroups
+type talkGroupRange struct {
+	first, last uint32
+}
+
+// talkGroupRoute is a TalkGroupRoute with its talkgroups parsed
+type talkGroupRoute struct {
+	spec     string
+	ranges   []talkGroupRange
+	services []string
+}
+
+// talkGroupRewrite is a talk_group_rewrite entry with its talkgroups parsed
+type talkGroupRewrite struct {
+	ranges []talkGroupRange
+	to     uint32
+}
+
+// parseTalkGroups parses a talkgroup, a range, or a comma-separated list of
+// them
+func parseTalkGroups(spec string) ([]talkGroupRange, error) {
+	var ranges []talkGroupRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		lo, err := strconv.ParseUint(strings.TrimSpace(first), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid talkgroup %q", part)
+		}
+		hi, err := strconv.ParseUint(strings.TrimSpace(last), 10, 32)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid talkgroup range %q", part)
+		}
+		ranges = append(ranges, talkGroupRange{uint32(lo), uint32(hi)})
+	}
+	return ranges, nil
+}
+
+// talkGroupIn reports whether a talkgroup is in ranges
+func talkGroupIn(ranges []talkGroupRange, tg uint32) bool {
+	for _, rg := range ranges {
+		if tg >= rg.first && tg <= rg.last {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTalkGroupRoutes parses validated talkgroup routes, once per load,
+// for the router to match packets against
+func parseTalkGroupRoutes(routes []TalkGroupRoute) []talkGroupRoute {
+	parsed := make([]talkGroupRoute, 0, len(routes))
+	for _, route := range routes {
+		ranges, _ := parseTalkGroups(route.TalkGroups)
+		parsed = append(parsed, talkGroupRoute{spec: route.TalkGroups, ranges: ranges, services: route.Services})
+	}
+	return parsed
+}
+
+// parseTalkGroupRewrite parses a service's validated talk_group_rewrite
+func parseTalkGroupRewrite(rewrite map[string]uint32) []talkGroupRewrite {
+	parsed := make([]talkGroupRewrite, 0, len(rewrite))
+	for spec, to := range rewrite {
+		ranges, _ := parseTalkGroups(spec)
+		parsed = append(parsed, talkGroupRewrite{ranges: ranges, to: to})
+	}
+	return parsed
+}
+
+// talkGroupAllows reports whether routing.talk_groups lets audio on a
+// talkgroup reach dest: always for a talkgroup no route names, otherwise
+// only if a route naming it subscribes dest
+func (r *AudioRouter) talkGroupAllows(tg uint32, dest *ServiceInstance) bool {
+	r.rulesMux.RLock()
+	defer r.rulesMux.RUnlock()
+
+	routed := false
+	for _, route := range r.talkGroups {
+		if !talkGroupIn(route.ranges, tg) {
+			continue
+		}
+		routed = true
+		for _, pattern := range route.services {
+			if pairMatches(pattern, dest.ID, dest.Type) {
+				return true
+			}
+		}
+	}
+	return !routed
+}
+
+// unroutedTalkGroup returns a talkgroup no talkgroup route names, the
+// lowest there is. Must be called with rulesMux held.
+func (r *AudioRouter) unroutedTalkGroup() uint32 {
+	tg := uint32(0)
+	for moved := true; moved; {
+		moved = false
+		for _, route := range r.talkGroups {
+			for _, rg := range route.ranges {
+				if tg >= rg.first && tg <= rg.last && rg.last < math.MaxUint32 {
+					tg, moved = rg.last+1, true
+				}
+			}
+		}
+	}
+	return tg
+}
+
+// egressTalkGroup returns the talkgroup audio on tg is sent to a service
+// on, after its talk_group_rewrite
+func egressTalkGroup(conn *ServiceConnection, tg uint32) uint32 {
+	for _, rewrite := range conn.talkGroupRewrite {
+		if talkGroupIn(rewrite.ranges, tg) {
+			return rewrite.to
+		}
+	}
+	return tg
+}
+
+// validateTalkGroups checks the talkgroup routes and every service's
+// talkgroup rewrites, whose talkgroups may not overlap: each talkgroup has
+// one rewrite at most
+func validateTalkGroups(config *AudioRouterConfig) error {
+	for _, route := range config.Routing.TalkGroups {
+		if _, err := parseTalkGroups(route.TalkGroups); err != nil {
+			return fmt.Errorf("talkgroup route: %w", err)
+		}
+		if len(route.Services) == 0 {
+			return fmt.Errorf("talkgroup route %s has no services", route.TalkGroups)
+		}
+		for _, pattern := range route.Services {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("talkgroup route %s: %w", route.TalkGroups, err)
+			}
+		}
+	}
+
+	for _, service := range config.Services {
+		var seen []talkGroupRange
+		for spec := range service.TalkGroupRewrite {
+			ranges, err := parseTalkGroups(spec)
+			if err != nil {
+				return fmt.Errorf("service %s talk_group_rewrite: %w", service.ID, err)
+			}
+			for _, rg := range ranges {
+				for _, other := range seen {
+					if rg.first <= other.last && other.first <= rg.last {
+						return fmt.Errorf("service %s talk_group_rewrite: talkgroups %d-%d are rewritten twice",
+							service.ID, max(rg.first, other.first), min(rg.last, other.last))
+					}
+				}
+			}
+			seen = append(seen, ranges...)
+		}
+	}
+	return nil
+}
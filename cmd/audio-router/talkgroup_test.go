@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// talkGroupDestinations returns the IDs audio from source on a talkgroup
+// is routed to, sorted
+func talkGroupDestinations(r *AudioRouter, source string, tg uint32) string {
+	var ids []string
+	for _, conn := range r.getRoutingDestinations(&AudioMessage{SourceID: source, TalkGroup: tg, PTTActive: true}) {
+		ids = append(ids, conn.Instance.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestTalkGroupRoutes(t *testing.T) {
+	r := newRoutingRouter(t)
+	r.config.Routing.TalkGroups = []TalkGroupRoute{
+		{TalkGroups: "91", Services: []string{"discord1", "usrp1"}},
+		{TalkGroups: "3100-3199, 9", Services: []string{"usrp"}},
+		{TalkGroups: "3150", Services: []string{"discord2"}},
+	}
+	if err := validateConfig(r.config); err != nil {
+		t.Fatal(err)
+	}
+	r.talkGroups = parseTalkGroupRoutes(r.config.Routing.TalkGroups)
+
+	for _, tc := range []struct {
+		source  string
+		tg      uint32
+		reaches string
+	}{
+		{"usrp2", 91, "discord1,usrp1"},
+		{"usrp1", 91, "discord1"},
+		{"discord1", 3100, "usrp1,usrp2"},
+		{"discord1", 9, "usrp1,usrp2"},
+		{"discord1", 3150, "discord2,usrp1,usrp2"},
+		{"usrp1", 3199, "usrp2"},
+		{"usrp1", 3200, "discord1,discord2,usrp2"},
+		{"usrp1", 0, "discord1,discord2,usrp2"},
+	} {
+		if reaches := talkGroupDestinations(r, tc.source, tc.tg); reaches != tc.reaches {
+			t.Errorf("%s on TG %d reaches %q, want %q", tc.source, tc.tg, reaches, tc.reaches)
+		}
+	}
+
+	// The dashboard shows each route's talkgroups apart
+	matrix := r.routingMatrix()
+	if len(matrix.TalkGroups) != 3 || matrix.TalkGroups[1].TalkGroups != "3100-3199, 9" {
+		t.Fatalf("Talkgroup matrices %+v", matrix.TalkGroups)
+	}
+	if to := strings.Join(matrix.TalkGroups[1].Routes["discord1"], ","); to != "usrp1,usrp2" {
+		t.Errorf("discord1 on TG 3100 reaches %q", to)
+	}
+	if to := strings.Join(matrix.Routes["usrp1"], ","); to != "discord1,discord2,usrp2" {
+		t.Errorf("usrp1 on other talkgroups reaches %q", to)
+	}
+}
+
+func TestUnroutedTalkGroup(t *testing.T) {
+	r := &AudioRouter{}
+	for _, tc := range []struct {
+		routes []TalkGroupRoute
+		want   uint32
+	}{
+		{nil, 0},
+		{[]TalkGroupRoute{{TalkGroups: "1-9"}}, 0},
+		{[]TalkGroupRoute{{TalkGroups: "5-9"}, {TalkGroups: "0-4,10"}}, 11},
+		{[]TalkGroupRoute{{TalkGroups: "0-4294967294"}}, 4294967295},
+	} {
+		r.talkGroups = parseTalkGroupRoutes(tc.routes)
+		if got := r.unroutedTalkGroup(); got != tc.want {
+			t.Errorf("Routes %+v: TG %d, want %d", tc.routes, got, tc.want)
+		}
+	}
+}
+
+func TestTalkGroupRewrite(t *testing.T) {
+	pc, dest := listener(t, "allstar", ServiceTypeUSRP, "pcm")
+	dest.TalkGroupRewrite = map[string]uint32{"3100-3199": 1, "91": 2}
+	r := newConvertRouter(t, ServiceInstance{ID: "bm", Type: ServiceTypeUSRP, Enabled: true}, dest)
+
+	for _, tg := range []uint32{3120, 91, 92} {
+		r.routeAudioMessage(&AudioMessage{SourceID: "bm", Format: "pcm", Data: pcmBytes(tone()),
+			PTTActive: true, TalkGroup: tg})
+	}
+	var sent []uint32
+	for _, packet := range receive(t, pc) {
+		msg, err := usrp.Parse(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, msg.(*usrp.VoiceMessage).Header.TalkGroup)
+	}
+	if len(sent) != 3 || sent[0] != 1 || sent[1] != 2 || sent[2] != 92 {
+		t.Errorf("Sent on talkgroups %v, want [1 2 92]", sent)
+	}
+}
+
+func TestTalkGroups_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		routes  []TalkGroupRoute
+		rewrite map[string]uint32
+	}{
+		{routes: []TalkGroupRoute{{TalkGroups: "", Services: []string{"usrp"}}}},
+		{routes: []TalkGroupRoute{{TalkGroups: "91-", Services: []string{"usrp"}}}},
+		{routes: []TalkGroupRoute{{TalkGroups: "200-100", Services: []string{"usrp"}}}},
+		{routes: []TalkGroupRoute{{TalkGroups: "4294967296", Services: []string{"usrp"}}}},
+		{routes: []TalkGroupRoute{{TalkGroups: "91"}}},
+		{routes: []TalkGroupRoute{{TalkGroups: "91", Services: []string{"usrp["}}}},
+		{rewrite: map[string]uint32{"x": 1}},
+		{rewrite: map[string]uint32{"3100-3199": 1, "3150": 2}},
+	} {
+		config := defaultConfig()
+		config.Routing.TalkGroups = tc.routes
+		config.Services[0].TalkGroupRewrite = tc.rewrite
+		if err := validateConfig(config); err == nil {
+			t.Errorf("Routes %+v, rewrite %v accepted", tc.routes, tc.rewrite)
+		}
+	}
+}
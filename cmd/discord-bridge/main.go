@@ -3,14 +3,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/dbehnke/usrp-go/internal/transport"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/record"
 	"github.com/dbehnke/usrp-go/pkg/discord"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
@@ -26,10 +32,32 @@ func main() {
 		fmt.Println("  go run cmd/examples/discord_bridge.go server     # USRP packet server (for testing)")
 		fmt.Println()
 		fmt.Println("Environment Variables:")
-		fmt.Println("  DISCORD_TOKEN     - Discord bot token (required)")
+		fmt.Println("  DISCORD_TOKEN     - Discord bot token, or where to read it: env:NAME, file:/path or secret:name (required)")
+		fmt.Println("  DISCORD_TOKEN_FILE - File holding the bot token, such as a Docker secret, in place of DISCORD_TOKEN")
+		fmt.Println("  DISCORD_SECRETS_COMMAND - Command run with the name to read secret:name tokens, e.g. vault kv get -field=token")
 		fmt.Println("  DISCORD_GUILD     - Discord server (guild) ID")
 		fmt.Println("  DISCORD_CHANNEL   - Discord voice channel ID")
+		fmt.Println("  DISCORD_CHANNELS  - Several voice channels on one bot, as guild:channel:talkgroup,...")
+		fmt.Println("  DISCORD_SHARDS    - Gateway shards for DISCORD_CHANNELS, as count or count:id,id to run some")
+		fmt.Println("  DISCORD_TRANSCRIPT_CHANNEL - Text channel ID logging radio transmissions")
+		fmt.Println("  DISCORD_TEXT_CHANNEL - Text channel ID bridged with USRP text messages")
+		fmt.Println("  DISCORD_STAGE_TOPIC - Topic to start a Stage channel with when it is not live")
+		fmt.Println("  DISCORD_RECORDING_DIR - Directory voice sessions are recorded to, shared with the audio router")
+		fmt.Println("  DISCORD_RECORDING_CONSENT - Guilds recorded, as guildid=announce,guildid=opt-in")
+		fmt.Println("  DISCORD_JITTER    - Set to 1 to play radio audio through a jitter buffer")
+		fmt.Println("  DISCORD_AGC       - Set to 1 to level the audio both ways")
+		fmt.Println("  DISCORD_SPEAKING_INDICATOR - Show the station on the air in the bot's nickname or presence")
+		fmt.Println("  DISCORD_TALK_PROFILE - Keying of users by their voice, as aggressiveness:hangtime:max, e.g. 2:800ms:3m")
+		fmt.Println("  DISCORD_TALK_PROFILES - Keying of particular users, as userid=1:1.5s:5m,userid=3:500ms:2m")
+		fmt.Println("  DISCORD_SOUNDS    - Announcements for /play, as name=file.wav,name=file.opus")
+		fmt.Println("  DISCORD_STATUS_CHANNEL - Text channel ID for a pinned status dashboard")
+		fmt.Println("  ROUTER_STATUS_URL - Audio router status endpoint the dashboard shows")
+		fmt.Println("  DISCORD_METRICS_ADDR - Address serving link metrics on /metrics, and /metrics.json for the audio router, e.g. :9102")
 		fmt.Println("  AMATEUR_CALLSIGN  - Amateur radio callsign")
+		fmt.Println("  DISCORD_CALLSIGNS - Callsigns of Discord users, as userid=CALL,userid=CALL")
+		fmt.Println("  DISCORD_REQUIRE_CALLSIGN - Set to 1 to key the radio only for users with a callsign")
+		fmt.Println("  DISCORD_ROLES     - Permissions by Discord role, as roleid=talk,roleid=command")
+		fmt.Println("  DISCORD_DEFAULT_PERMISSION - Permission of members with none of DISCORD_ROLES (default listen)")
 		fmt.Println()
 		fmt.Println("Requirements:")
 		fmt.Println("  - Discord bot with voice permissions")
@@ -56,10 +84,7 @@ func runDiscordTest() {
 	fmt.Println("🎮 Discord Bot Connection Test")
 	fmt.Println("=============================")
 
-	token := os.Getenv("DISCORD_TOKEN")
-	if token == "" {
-		log.Fatal("DISCORD_TOKEN environment variable is required")
-	}
+	token := discordToken()
 
 	// Create Discord bot configuration
 	config := discord.DefaultBridgeConfig()
@@ -67,7 +92,7 @@ func runDiscordTest() {
 	config.DiscordGuild = os.Getenv("DISCORD_GUILD")
 	config.DiscordChannel = os.Getenv("DISCORD_CHANNEL")
 
-	fmt.Printf("Token: %s...\n", token[:10])
+	fmt.Printf("Token: %s\n", token)
 	fmt.Printf("Guild: %s\n", config.DiscordGuild)
 	fmt.Printf("Channel: %s\n", config.DiscordChannel)
 
@@ -121,16 +146,51 @@ func runDiscordBridge() {
 	fmt.Println("===============================")
 
 	// Get configuration from environment
-	token := os.Getenv("DISCORD_TOKEN")
-	if token == "" {
-		log.Fatal("DISCORD_TOKEN environment variable is required")
-	}
+	token := discordToken()
 
 	config := discord.DefaultBridgeConfig()
 	config.DiscordToken = token
 	config.DiscordGuild = os.Getenv("DISCORD_GUILD")
 	config.DiscordChannel = os.Getenv("DISCORD_CHANNEL")
 	config.CallSign = os.Getenv("AMATEUR_CALLSIGN")
+	config.Callsigns = parseCallsigns(os.Getenv("DISCORD_CALLSIGNS"))
+	config.RequireCallsign = os.Getenv("DISCORD_REQUIRE_CALLSIGN") == "1"
+	config.TranscriptChannel = os.Getenv("DISCORD_TRANSCRIPT_CHANNEL")
+	config.SpeakingIndicator = discord.Indicator(os.Getenv("DISCORD_SPEAKING_INDICATOR"))
+	config.TextChannel = os.Getenv("DISCORD_TEXT_CHANNEL")
+	config.StageTopic = os.Getenv("DISCORD_STAGE_TOPIC")
+	if os.Getenv("DISCORD_JITTER") == "1" {
+		config.RadioJitter = audio.DefaultJitterBufferConfig()
+	}
+	if os.Getenv("DISCORD_AGC") == "1" {
+		config.RadioAGC = audio.DefaultAGCConfig()
+		config.DiscordAGC = audio.DefaultAGCConfig()
+	}
+	if err := parseTalkProfiles(config, os.Getenv("DISCORD_TALK_PROFILE"), os.Getenv("DISCORD_TALK_PROFILES")); err != nil {
+		log.Fatalf("Invalid talk profile: %v", err)
+	}
+	if roles := os.Getenv("DISCORD_ROLES"); roles != "" {
+		config.Roles = parseRoles(roles)
+		config.DefaultPermission = discord.Permission(os.Getenv("DISCORD_DEFAULT_PERMISSION"))
+		fmt.Printf("🛡️  Discord roles with permissions: %d\n", len(config.Roles))
+	}
+
+	if dir := os.Getenv("DISCORD_RECORDING_DIR"); dir != "" {
+		recordConfig := record.DefaultConfig()
+		recordConfig.Directory = dir
+		recorder, err := record.NewRecorder(recordConfig)
+		if err != nil {
+			log.Fatalf("Failed to create recorder: %v", err)
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Printf("Error closing recorder: %v", err)
+			}
+		}()
+		config.Recorder = recorder
+		config.RecordingConsent = parseConsent(os.Getenv("DISCORD_RECORDING_CONSENT"))
+		fmt.Printf("🔴 Recording %d guilds to %s\n", len(config.RecordingConsent), dir)
+	}
 
 	if config.CallSign == "" {
 		config.CallSign = "N0CALL"
@@ -140,23 +200,78 @@ func runDiscordBridge() {
 	fmt.Printf("🎮 Discord Guild: %s\n", config.DiscordGuild)
 	fmt.Printf("🔊 Discord Channel: %s\n", config.DiscordChannel)
 	fmt.Printf("📻 Amateur Callsign: %s\n", config.CallSign)
-
-	// Create bridge
-	bridge, err := discord.NewBridge(config)
-	if err != nil {
-		log.Fatalf("Failed to create bridge: %v", err)
-	}
-
-	// Start bridge
-	if err := bridge.Start(); err != nil {
-		log.Fatalf("Failed to start bridge: %v", err)
+	fmt.Printf("🪪 Discord users with callsigns: %d (required: %v)\n", len(config.Callsigns), config.RequireCallsign)
+
+	// Create and start a bridge, or one per channel of a multi-channel bot
+	var bridges []*discord.Bridge
+	if channels := os.Getenv("DISCORD_CHANNELS"); channels != "" {
+		manager, err := startChannelBridges(config, channels, os.Getenv("DISCORD_SHARDS"))
+		if err != nil {
+			log.Fatalf("Failed to start bridges: %v", err)
+		}
+		defer func() {
+			if err := manager.Stop(); err != nil {
+				log.Printf("Error stopping bot manager: %v", err)
+			}
+		}()
+		bridges = manager.bridges
+	} else {
+		bridge, err := discord.NewBridge(config)
+		if err != nil {
+			log.Fatalf("Failed to create bridge: %v", err)
+		}
+		if err := bridge.Start(); err != nil {
+			log.Fatalf("Failed to start bridge: %v", err)
+		}
+		bridges = append(bridges, bridge)
 	}
 	defer func() {
-		if err := bridge.Stop(); err != nil {
-			log.Printf("Error stopping bridge: %v", err)
+		for _, bridge := range bridges {
+			if err := bridge.Stop(); err != nil {
+				log.Printf("Error stopping bridge: %v", err)
+			}
 		}
 	}()
 
+	// Soundboard of announcements and courtesy tones, played with /play
+	if sounds := os.Getenv("DISCORD_SOUNDS"); sounds != "" {
+		soundboardConfig := discord.DefaultSoundboardConfig()
+		soundboardConfig.Sounds = parsePairs(sounds, "sound")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		for _, bridge := range bridges {
+			soundboard, err := discord.NewSoundboard(bridge.Bot(), soundboardConfig)
+			if err != nil {
+				log.Fatalf("Failed to create soundboard: %v", err)
+			}
+			go soundboard.Run(ctx)
+		}
+		fmt.Printf("🔔 Soundboard with %d sounds and the courtesy tones\n", len(soundboardConfig.Sounds))
+	}
+
+	// Status dashboard, from the router's stats
+	if channelID := os.Getenv("DISCORD_STATUS_CHANNEL"); channelID != "" {
+		dashboardConfig := discord.DefaultDashboardConfig()
+		dashboardConfig.ChannelID = channelID
+		if url := os.Getenv("ROUTER_STATUS_URL"); url != "" {
+			dashboardConfig.RouterURL = url
+		}
+		dashboard, err := discord.NewDashboard(bridges[0].Bot(), dashboardConfig)
+		if err != nil {
+			log.Fatalf("Failed to create status dashboard: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go dashboard.Run(ctx)
+		fmt.Printf("📋 Status dashboard in channel %s from %s\n", channelID, dashboardConfig.RouterURL)
+	}
+
+	// Link metrics of each channel, for Prometheus and the audio router
+	if addr := os.Getenv("DISCORD_METRICS_ADDR"); addr != "" {
+		serveMetrics(addr, bridges)
+		fmt.Printf("📈 Link metrics on http://%s/metrics\n", addr)
+	}
+
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -199,22 +314,49 @@ func runDiscordBridge() {
 			}
 
 			// Parse USRP packet
-			voiceMsg := &usrp.VoiceMessage{}
-			if err := voiceMsg.Unmarshal(buffer[:n]); err != nil {
+			msg, err := usrp.Parse(buffer[:n])
+			if err != nil {
 				log.Printf("Failed to unmarshal USRP packet: %v", err)
 				continue
 			}
 
+			// Metadata naming the station goes to every bridge's transcript
+			if tlv, ok := msg.(*usrp.TLVMessage); ok {
+				for _, bridge := range bridges {
+					bridge.SendUSRPMetadata(tlv)
+				}
+				continue
+			}
+			// Text goes to the bridges carrying its talk group
+			if text, ok := msg.(*usrp.TextMessage); ok {
+				for _, bridge := range bridges {
+					if tg := bridge.TalkGroup(); tg == 0 || tg == text.Header.TalkGroup {
+						bridge.SendUSRPText(text)
+					}
+				}
+				continue
+			}
+			voiceMsg, ok := msg.(*usrp.VoiceMessage)
+			if !ok {
+				continue
+			}
+
 			packetCount++
 			if voiceMsg.Header.IsPTT() {
 				fmt.Printf("📡 RX Packet %d: USRP voice, PTT ON, seq=%d\n",
 					packetCount, voiceMsg.Header.Seq)
+			}
 
-				// Send to Discord bridge
+			// Send to the Discord bridges carrying its talk group; unkeys
+			// too, which end transmissions in the transcript
+			for _, bridge := range bridges {
+				if tg := bridge.TalkGroup(); tg != 0 && tg != voiceMsg.Header.TalkGroup {
+					continue
+				}
 				if err := bridge.SendUSRPPacket(voiceMsg); err != nil {
 					log.Printf("Failed to send to Discord: %v", err)
-				} else {
-					fmt.Printf("🎮 → Discord: Sent voice packet\n")
+				} else if voiceMsg.Header.IsPTT() {
+					fmt.Printf("🎮 → Discord: Sent voice packet (TG %d)\n", bridge.TalkGroup())
 				}
 			}
 		}
@@ -226,12 +368,14 @@ func runDiscordBridge() {
 
 	go func() {
 		for range statusTicker.C {
-			if bridge.IsRunning() {
-				status := "Disconnected"
-				if bridge.IsDiscordConnected() {
-					status = "Connected"
+			for _, bridge := range bridges {
+				if bridge.IsRunning() {
+					status := "Disconnected"
+					if bridge.IsDiscordConnected() {
+						status = "Connected"
+					}
+					fmt.Printf("🔄 Bridge Status (TG %d): Running, Discord: %s\n", bridge.TalkGroup(), status)
 				}
-				fmt.Printf("🔄 Bridge Status: Running, Discord: %s\n", status)
 			}
 		}
 	}()
@@ -239,18 +383,29 @@ func runDiscordBridge() {
 	// Handle Discord to USRP packets
 	go func() {
 		for {
-			if packet, ok := bridge.GetUSRPPacket(); ok {
-				fmt.Printf("🎮 RX Discord: Converting to USRP, seq=%d\n", packet.Header.Seq)
-
-				// In a real implementation, you would send this via UDP
-				// to your amateur radio system
-				data, err := packet.Marshal()
-				if err != nil {
-					log.Printf("Failed to marshal USRP packet: %v", err)
-					continue
+			for _, bridge := range bridges {
+				if msg, ok := bridge.GetUSRPMetadata(); ok {
+					if callsign, ok := msg.GetCallsign(); ok {
+						fmt.Printf("🪪 Discord talker: %s\n", callsign)
+					}
+				}
+				if msg, ok := bridge.GetUSRPText(); ok {
+					fmt.Printf("📟 Discord text (TG %d): %s\n", msg.Header.TalkGroup, msg.Text)
 				}
 
-				fmt.Printf("📡 → Amateur Radio: %d bytes (would send via UDP)\n", len(data))
+				if packet, ok := bridge.GetUSRPPacket(); ok {
+					fmt.Printf("🎮 RX Discord: Converting to USRP, seq=%d, TG %d\n", packet.Header.Seq, packet.Header.TalkGroup)
+
+					// In a real implementation, you would send this via UDP
+					// to your amateur radio system
+					data, err := packet.Marshal()
+					if err != nil {
+						log.Printf("Failed to marshal USRP packet: %v", err)
+						continue
+					}
+
+					fmt.Printf("📡 → Amateur Radio: %d bytes (would send via UDP)\n", len(data))
+				}
 			}
 
 			time.Sleep(10 * time.Millisecond)
@@ -262,6 +417,234 @@ func runDiscordBridge() {
 	fmt.Println("\n🛑 Shutting down bridge...")
 }
 
+// serveMetrics serves the link metrics of every bridge's bot on addr, as
+// Prometheus text on /metrics and as JSON on /metrics.json, which the audio
+// router polls to export the Discord leg with its own links
+func serveMetrics(addr string, bridges []*discord.Bridge) {
+	exporter := transport.NewPrometheusExporter("usrp")
+	for _, bridge := range bridges {
+		exporter.Register("discord-"+bridge.Bot().GuildID(), bridge.Bot().Metrics())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.HandleFunc("/metrics.json", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(exporter.Reports()); err != nil {
+			log.Printf("encode metrics error: %v", err)
+		}
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+}
+
+// channelBridges is a multi-channel bot and a bridge for each channel
+type channelBridges struct {
+	*discord.BotManager
+	bridges []*discord.Bridge
+}
+
+// startChannelBridges starts one bot in several voice channels, given as
+// guild:channel:talkgroup,..., each bridged to its own talk group, on the
+// gateway shards given as count or count:id,id
+func startChannelBridges(config *discord.BridgeConfig, channels, shards string) (*channelBridges, error) {
+	botConfig := discord.DefaultBotConfig()
+	botConfig.BufferSize = config.BufferSize
+	botConfig.Callsigns = config.Callsigns
+	botConfig.RequireCallsign = config.RequireCallsign
+	botConfig.Roles = config.Roles
+	botConfig.DefaultPermission = config.DefaultPermission
+	botConfig.TalkProfiles = config.TalkProfiles
+	botConfig.TalkProfile = config.TalkProfile
+	botConfig.StageTopic = config.StageTopic
+	managerConfig := &discord.BotManagerConfig{Token: config.DiscordToken, Bot: botConfig}
+	if shards != "" {
+		var err error
+		if managerConfig.ShardCount, managerConfig.Shards, err = parseShards(shards); err != nil {
+			return nil, err
+		}
+	}
+	manager, err := discord.NewBotManager(managerConfig)
+	if err != nil {
+		return nil, err
+	}
+	cb := &channelBridges{BotManager: manager}
+
+	for _, entry := range strings.Split(channels, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("channel %q is not guild:channel:talkgroup", entry)
+		}
+		var talkGroup uint32
+		if _, err := fmt.Sscanf(parts[2], "%d", &talkGroup); err != nil {
+			return nil, fmt.Errorf("channel %q has an invalid talk group: %w", entry, err)
+		}
+
+		bot, err := manager.AddChannel(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		channelConfig := *config
+		channelConfig.DiscordGuild, channelConfig.DiscordChannel = parts[0], parts[1]
+		channelConfig.TalkGroup = talkGroup
+		bridge, err := discord.NewBridgeForBot(bot, &channelConfig)
+		if err != nil {
+			return nil, err
+		}
+		cb.bridges = append(cb.bridges, bridge)
+		fmt.Printf("🔊 Discord channel %s in guild %s ↔ TG %d\n", parts[1], parts[0], talkGroup)
+	}
+
+	if err := manager.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	for _, bridge := range cb.bridges {
+		if err := bridge.Start(); err != nil {
+			manager.Stop()
+			return nil, err
+		}
+	}
+	return cb, nil
+}
+
+// parseCallsigns parses Discord user callsigns given as
+// userid=CALL,userid=CALL
+func parseCallsigns(s string) map[string]string {
+	return parsePairs(s, "Discord callsign")
+}
+
+// parseRoles parses permissions by Discord role given as
+// roleid=talk,roleid=command
+func parseRoles(s string) map[string]discord.Permission {
+	roles := make(map[string]discord.Permission)
+	for roleID, permission := range parsePairs(s, "Discord role") {
+		roles[roleID] = discord.Permission(permission)
+	}
+	return roles
+}
+
+// parseShards parses the gateway shards to run, given as count for all of
+// them or count:id,id for some
+func parseShards(s string) (int, []int, error) {
+	countPart, idsPart, some := strings.Cut(s, ":")
+	var count int
+	if _, err := fmt.Sscanf(countPart, "%d", &count); err != nil {
+		return 0, nil, fmt.Errorf("invalid shard count %q: %w", countPart, err)
+	}
+	if !some {
+		return count, nil, nil
+	}
+	var ids []int
+	for _, part := range strings.Split(idsPart, ",") {
+		var id int
+		if _, err := fmt.Sscanf(strings.TrimSpace(part), "%d", &id); err != nil {
+			return 0, nil, fmt.Errorf("invalid shard %q: %w", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return count, ids, nil
+}
+
+// discordToken resolves the bot token from DISCORD_TOKEN or
+// DISCORD_TOKEN_FILE, asking DISCORD_SECRETS_COMMAND for secret:name
+// references
+func discordToken() discord.Secret {
+	if command := strings.Fields(os.Getenv("DISCORD_SECRETS_COMMAND")); len(command) > 0 {
+		discord.RegisterSecretProvider("secret", discord.CommandSecrets(command))
+	}
+	ref := os.Getenv("DISCORD_TOKEN")
+	if file := os.Getenv("DISCORD_TOKEN_FILE"); ref == "" && file != "" {
+		ref = "file:" + file
+	}
+	if ref == "" {
+		log.Fatal("DISCORD_TOKEN or DISCORD_TOKEN_FILE environment variable is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	token, err := discord.ResolveSecret(ctx, ref)
+	if err != nil {
+		log.Fatalf("Failed to read the Discord token: %v", err)
+	}
+	return token
+}
+
+// parseConsent parses the recording consent of guilds given as
+// guildid=announce,guildid=opt-in
+func parseConsent(s string) map[string]discord.Consent {
+	consent := make(map[string]discord.Consent)
+	for guildID, c := range parsePairs(s, "recording consent") {
+		consent[guildID] = discord.Consent(c)
+	}
+	return consent
+}
+
+// parseTalkProfiles sets the talk profile of all users and of particular
+// ones, given as aggressiveness:hangtime:max and userid=profile,...
+func parseTalkProfiles(config *discord.BridgeConfig, all, users string) error {
+	if all != "" {
+		profile, err := parseTalkProfile(all)
+		if err != nil {
+			return err
+		}
+		config.TalkProfile = profile
+	}
+	for userID, s := range parsePairs(users, "talk profile") {
+		profile, err := parseTalkProfile(s)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", userID, err)
+		}
+		if config.TalkProfiles == nil {
+			config.TalkProfiles = make(map[string]discord.TalkProfile)
+		}
+		config.TalkProfiles[userID] = *profile
+	}
+	return nil
+}
+
+// parseTalkProfile parses a talk profile given as
+// aggressiveness:hangtime:max, such as 2:800ms:3m (max 0 = unlimited)
+func parseTalkProfile(s string) (*discord.TalkProfile, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%q is not aggressiveness:hangtime:max", s)
+	}
+	profile := &discord.TalkProfile{}
+	if _, err := fmt.Sscanf(parts[0], "%d", &profile.Aggressiveness); err != nil {
+		return nil, fmt.Errorf("invalid aggressiveness %q: %w", parts[0], err)
+	}
+	var err error
+	if profile.Hangtime, err = time.ParseDuration(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid hangtime: %w", err)
+	}
+	if parts[2] != "0" {
+		if profile.MaxTransmit, err = time.ParseDuration(parts[2]); err != nil {
+			return nil, fmt.Errorf("invalid longest transmission: %w", err)
+		}
+	}
+	return profile, nil
+}
+
+// parsePairs parses key=value,key=value, logging malformed entries as
+// what
+func parsePairs(s, what string) map[string]string {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || key == "" || value == "" {
+			if entry != "" {
+				log.Printf("Ignoring malformed %s %q", what, entry)
+			}
+			continue
+		}
+		pairs[key] = value
+	}
+	return pairs
+}
+
 // runUSRPServer generates test USRP packets for testing
 func runUSRPServer() {
 	fmt.Println("📡 USRP Test Packet Server")
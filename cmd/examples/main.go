@@ -198,6 +198,9 @@ func runFormatDemo() {
 	fmt.Printf("TLV_TAG_SET_INFO (0x%02X): Station callsign and metadata\n", usrp.TLV_TAG_SET_INFO)
 	fmt.Printf("TLV_TAG_AMBE     (0x%02X): AMBE vocoder data\n", usrp.TLV_TAG_AMBE)
 	fmt.Printf("TLV_TAG_DTMF     (0x%02X): DTMF tone information\n", usrp.TLV_TAG_DTMF)
+	fmt.Printf("TLV_TAG_BEGIN_TX (0x%02X): DVSwitch start of transmission\n", usrp.TLV_TAG_BEGIN_TX)
+	fmt.Printf("TLV_TAG_END_TX   (0x%02X): DVSwitch end of transmission\n", usrp.TLV_TAG_END_TX)
+	fmt.Printf("TLV_TAG_TG_TUNE  (0x%02X): DVSwitch talkgroup tune\n", usrp.TLV_TAG_TG_TUNE)
 
 	fmt.Println("\n--- Compatibility Notes ---")
 	fmt.Println("✓ Compatible with AllStarLink chan_usrp.c")
@@ -15,6 +15,8 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -81,7 +83,8 @@ type Bridge struct {
 	destinations map[string]*net.UDPConn
 
 	// Metrics and monitoring
-	stats *BridgeStats
+	stats   *BridgeStats
+	traffic *usrp.StatsCollector
 
 	// Control channels
 	ctx    context.Context
@@ -236,6 +239,7 @@ func NewBridge(config *Config) (*Bridge, error) {
 		config:       config,
 		destinations: make(map[string]*net.UDPConn),
 		stats:        &BridgeStats{},
+		traffic:      usrp.NewStatsCollector(),
 		ctx:          ctx,
 		cancel:       cancel,
 	}
@@ -263,8 +267,8 @@ func NewBridge(config *Config) (*Bridge, error) {
 // Start initializes and starts the bridge
 func (b *Bridge) Start() error {
 	// Setup USRP listener
-	usrpAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
-		b.config.USRPListenAddr, b.config.USRPListenPort))
+	usrpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(
+		b.config.USRPListenAddr, strconv.Itoa(b.config.USRPListenPort)))
 	if err != nil {
 		return fmt.Errorf("failed to resolve USRP address: %w", err)
 	}
@@ -275,8 +279,8 @@ func (b *Bridge) Start() error {
 	}
 
 	// Setup AllStarLink connection
-	allstarAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
-		b.config.AllStarHost, b.config.AllStarPort))
+	allstarAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(
+		b.config.AllStarHost, strconv.Itoa(b.config.AllStarPort)))
 	if err != nil {
 		return fmt.Errorf("failed to resolve AllStarLink address: %w", err)
 	}
@@ -292,7 +296,7 @@ func (b *Bridge) Start() error {
 			continue
 		}
 
-		destAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", dest.Host, dest.Port))
+		destAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)))
 		if err != nil {
 			log.Printf("Warning: Failed to resolve destination %s: %v", dest.Name, err)
 			continue
@@ -376,6 +380,7 @@ func (b *Bridge) processUSRPPackets() {
 				log.Printf("Failed to unmarshal USRP packet: %v", err)
 				continue
 			}
+			b.traffic.Observe(voiceMsg, addr.String(), n, time.Now())
 
 			// Process the packet
 			if err := b.processVoicePacket(voiceMsg, addr); err != nil {
@@ -505,6 +510,22 @@ func (b *Bridge) PrintStats() {
 	fmt.Printf("Traffic: %d bytes received, %d bytes sent\n",
 		b.stats.BytesReceived, b.stats.BytesSent)
 	fmt.Printf("Last Activity: %s\n", time.Unix(b.stats.LastActivityTime, 0).Format(time.RFC3339))
+
+	traffic := b.traffic.Snapshot()
+	if len(traffic.TalkGroups) > 0 {
+		talkGroups := make([]uint32, 0, len(traffic.TalkGroups))
+		for tg := range traffic.TalkGroups {
+			talkGroups = append(talkGroups, tg)
+		}
+		sort.Slice(talkGroups, func(i, j int) bool { return talkGroups[i] < talkGroups[j] })
+
+		fmt.Println("Talkgroups:")
+		for _, tg := range talkGroups {
+			s := traffic.TalkGroups[tg]
+			fmt.Printf("  TG %d: %d packets, %v talk time, %d talkers, %.1f%% loss\n",
+				tg, s.Packets, s.TalkTime.Round(time.Second), s.UniqueTalkers, s.LossRate()*100)
+		}
+	}
 	fmt.Println()
 }
 
@@ -0,0 +1,61 @@
+// Talkgroup directory - federated routers publish the talkgroups they host
+// so operators can discover and link to remote hubs by name
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/directory"
+)
+
+func main() {
+	var (
+		listenAddr = flag.String("listen", ":8090", "HTTP listen address")
+		ttl        = flag.Duration("ttl", 5*time.Minute, "Registration lifetime without refresh")
+		token      = flag.String("token", os.Getenv("DIRECTORY_TOKEN"), "Shared secret required to publish (default $DIRECTORY_TOKEN)")
+	)
+	flag.Parse()
+
+	config := directory.DefaultServerConfig()
+	config.TTL = *ttl
+	config.Token = *token
+
+	server := &http.Server{
+		Addr:              *listenAddr,
+		Handler:           directory.NewServer(config),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Println("📖 USRP Talkgroup Directory")
+	fmt.Println("===========================")
+	fmt.Printf("Listening on %s (TTL %v)\n", *listenAddr, *ttl)
+	if *token == "" {
+		fmt.Println("⚠️  Publishing is open to anyone (set -token)")
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	fmt.Println("\n🛑 Shutting down directory...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
+}
@@ -1,11 +1,25 @@
 module github.com/dbehnke/usrp-go
 
-go 1.25
+go 1.25.0
 
-require github.com/bwmarrin/discordgo v0.28.1
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/bwmarrin/discordgo v0.28.1
+	github.com/go-gst/go-gst v0.0.2
+	github.com/gorilla/websocket v1.4.2
+	github.com/mewkiz/flac v1.0.14
+	github.com/pion/dtls/v3 v3.0.11
+	github.com/thesyncim/gopus v0.1.2
+	golang.org/x/sys v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/gorilla/websocket v1.4.2 // indirect
-	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	github.com/go-gst/go-glib v0.0.2 // indirect
+	github.com/icza/bitio v1.1.0 // indirect
+	github.com/mewkiz/pkg v0.0.0-20250417130911-3f050ff8c56d // indirect
+	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
+	github.com/pion/logging v0.2.4 // indirect
+	github.com/pion/transport/v4 v4.0.1 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
 )
@@ -0,0 +1,302 @@
+// Package configfile loads configuration files written in JSON, YAML or
+// TOML, chosen by extension, into structs by their JSON field names. Files
+// may reference environment variables as ${VAR} and pull in other files
+// with a top-level include.
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey lists the files, or glob patterns, a config file builds on
+const includeKey = "include"
+
+// envRef matches ${VAR} and ${VAR:-default}, and $${...} escaping them
+var envRef = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Decode loads the config file filename into v as encoding/json would, so
+// YAML and TOML files use the same field names as JSON ones.
+//
+// Environment references in string values are substituted once the file
+// is parsed: ${VAR} is the variable's value, an error if it is not set,
+// ${VAR:-default} falls back to default, and $${VAR} is a literal ${VAR}.
+// A value always stays a string, whatever the variable holds.
+//
+// A top-level "include" names further files, or glob patterns, relative
+// to the including file. Included files load first, in order, and the
+// including file's settings go on top: objects merge, lists append, and
+// other values replace those included.
+func Decode(filename string, v interface{}) error {
+	tree, err := load(filename, nil, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	return nil
+}
+
+// Files returns the config file filename and every file it includes,
+// directly or through other includes, as absolute paths
+func Files(filename string) ([]string, error) {
+	var files []string
+	if _, err := load(filename, nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Rewritable reports, as a nil error, whether the config file filename can
+// be replaced by the JSON encoding of what it decodes to without losing
+// anything: it must be JSON, without includes or environment references.
+func Rewritable(filename string) error {
+	if format(filename) != "json" {
+		return fmt.Errorf("%s is %s, not JSON", filename, strings.ToUpper(format(filename)))
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if envRef.Match(data) {
+		return fmt.Errorf("%s references environment variables", filename)
+	}
+	var tree map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	if _, ok := tree[includeKey]; ok {
+		return fmt.Errorf("%s includes other files", filename)
+	}
+	return nil
+}
+
+// format returns the format of a config file by its extension: "yaml",
+// "toml", or "json" for anything else
+func format(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// load reads a config file and the files it includes into one tree.
+// including lists the files including it, to catch include cycles; each
+// file read is added to files, if not nil.
+func load(filename string, including []string, files *[]string) (map[string]interface{}, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(including, path) {
+		return nil, fmt.Errorf("%s includes itself", filename)
+	}
+	if files != nil && !slices.Contains(*files, path) {
+		*files = append(*files, path)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	tree, err := parse(format(filename), data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := expand(tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	includes, err := includePaths(filepath.Dir(filename), tree[includeKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	delete(tree, includeKey)
+
+	merged := make(map[string]interface{})
+	for _, include := range includes {
+		included, err := load(include, append(including, path), files)
+		if err != nil {
+			return nil, err
+		}
+		merge(merged, included)
+	}
+	merge(merged, tree)
+	return merged, nil
+}
+
+// parse decodes a config file's text into a tree of maps, slices and
+// values
+func parse(format string, data []byte) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	switch format {
+	case "yaml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return tree, nil
+		}
+		m, ok := normalize(doc).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config must be a mapping")
+		}
+		return m, nil
+	case "toml":
+		return parseTOML(data)
+	default:
+		// Numbers stay exact, as they would decoding straight into the config
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, err
+		}
+		return tree, nil
+	}
+}
+
+// normalize converts the maps YAML decodes with non-string keys, such as
+// numbers, to string-keyed maps as JSON has
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalize(value)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// expand substitutes environment references in the string values of a
+// parsed config file, in place. Only values change, never the structure,
+// so a variable cannot add settings or break the file's syntax.
+func expand(tree map[string]interface{}) error {
+	var missing []string
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				v[key] = walk(value)
+			}
+		case []interface{}:
+			for i, value := range v {
+				v[i] = walk(value)
+			}
+		case string:
+			return envRef.ReplaceAllStringFunc(v, func(ref string) string {
+				match := envRef.FindStringSubmatch(ref)
+				if match[1] != "" {
+					return ref[1:] // $${VAR} escapes ${VAR}
+				}
+				if value, ok := os.LookupEnv(match[2]); ok {
+					return value
+				}
+				if strings.Contains(ref, ":-") {
+					return match[3]
+				}
+				missing = append(missing, match[2])
+				return ref
+			})
+		}
+		return v
+	}
+	walk(tree)
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("environment variables not set: %s", strings.Join(slices.Compact(missing), ", "))
+	}
+	return nil
+}
+
+// includePaths resolves an include setting, one path or pattern or a list
+// of them, relative to dir. Patterns matching nothing include nothing.
+func includePaths(dir string, include interface{}) ([]string, error) {
+	var patterns []string
+	switch include := include.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{include}
+	case []interface{}:
+		for _, pattern := range include {
+			s, ok := pattern.(string)
+			if !ok {
+				return nil, fmt.Errorf("include must list file names")
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, fmt.Errorf("include must be a file name or a list of them")
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// merge merges src into dst: objects merge, lists append and other values
+// replace dst's
+func merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				merge(existing, value)
+				continue
+			}
+		case []interface{}:
+			if existing, ok := dst[key].([]interface{}); ok {
+				dst[key] = append(existing, value...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,195 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	Router struct {
+		Name       string `json:"name"`
+		StatusPort int    `json:"status_port"`
+	} `json:"router"`
+	Directory struct {
+		Token string `json:"token"`
+	} `json:"directory"`
+	Services []struct {
+		ID       string                 `json:"id"`
+		Enabled  bool                   `json:"enabled"`
+		Settings map[string]interface{} `json:"settings"`
+	} `json:"services"`
+	TalkGroups map[string]string `json:"talk_groups"`
+	MaxTG      uint64            `json:"max_tg"`
+}
+
+// writeFiles writes files, by name, to a temporary directory, returning it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDecode_Formats(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"router.json": `{"router": {"name": "Hub", "status_port": 9090}, "max_tg": 18446744073709551615,
+			"services": [{"id": "usrp_1", "enabled": true}]}`,
+		"router.yaml": "router:\n  name: Hub\n  status_port: 9090\nmax_tg: 18446744073709551615\n" +
+			"services:\n  - id: usrp_1\n    enabled: true\ntalk_groups:\n  91: Worldwide\n",
+		"router.toml": "max_tg = 1\n[router]\nname = \"Hub\"\nstatus_port = 9090\n\n[[services]]\nid = \"usrp_1\"\nenabled = true\n",
+	})
+	for _, name := range []string{"router.json", "router.yaml", "router.toml"} {
+		var config testConfig
+		if err := Decode(filepath.Join(dir, name), &config); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if config.Router.Name != "Hub" || config.Router.StatusPort != 9090 ||
+			len(config.Services) != 1 || config.Services[0].ID != "usrp_1" || !config.Services[0].Enabled {
+			t.Errorf("%s decoded to %+v", name, config)
+		}
+		if name != "router.toml" && config.MaxTG != 18446744073709551615 {
+			t.Errorf("%s lost precision: %d", name, config.MaxTG)
+		}
+	}
+
+	var config testConfig
+	if err := Decode(filepath.Join(dir, "router.yaml"), &config); err != nil || config.TalkGroups["91"] != "Worldwide" {
+		t.Errorf("Numeric YAML keys %v: %v", config.TalkGroups, err)
+	}
+}
+
+func TestDecode_Environment(t *testing.T) {
+	t.Setenv("TEST_HUB_TOKEN", "s3cret")
+	dir := writeFiles(t, map[string]string{
+		"router.yaml": `
+router:
+  name: "${TEST_HUB_NAME:-Default Hub}"
+  status_port: 9191
+directory:
+  token: "${TEST_HUB_TOKEN}"
+services:
+  - id: usrp_1
+    settings:
+      template: "$${NOT_EXPANDED}"
+`,
+		"missing.json": `{"directory": {"token": "${TEST_HUB_UNSET}"}}`,
+	})
+
+	var config testConfig
+	if err := Decode(filepath.Join(dir, "router.yaml"), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Router.Name != "Default Hub" || config.Router.StatusPort != 9191 || config.Directory.Token != "s3cret" {
+		t.Errorf("Substituted %+v", config)
+	}
+	if config.Services[0].Settings["template"] != "${NOT_EXPANDED}" {
+		t.Errorf("Escaped reference %v", config.Services[0].Settings["template"])
+	}
+
+	err := Decode(filepath.Join(dir, "missing.json"), &config)
+	if err == nil || !strings.Contains(err.Error(), "TEST_HUB_UNSET") {
+		t.Errorf("Unset variable gave %v", err)
+	}
+}
+
+func TestDecode_EnvironmentIsData(t *testing.T) {
+	// Values that would be syntax in the file's text stay in their string
+	dir := writeFiles(t, map[string]string{
+		"router.json": `{"router": {"name": "${TEST_HUB_NAME}"}}`,
+		"router.yaml": "router:\n  name: ${TEST_HUB_NAME}\n",
+		"router.toml": "[router]\nname = \"${TEST_HUB_NAME}\"\n",
+	})
+	for _, name := range []string{"Hub \"one\", \"status_port\": 1", "Hub\n  status_port: 1", "Hub\"\nstatus_port = 1\n#"} {
+		t.Setenv("TEST_HUB_NAME", name)
+		for _, file := range []string{"router.json", "router.yaml", "router.toml"} {
+			var config testConfig
+			if err := Decode(filepath.Join(dir, file), &config); err != nil {
+				t.Fatalf("%s with %q: %v", file, name, err)
+			}
+			if config.Router.Name != name || config.Router.StatusPort != 0 {
+				t.Errorf("%s with %q decoded to %+v", file, name, config.Router)
+			}
+		}
+	}
+}
+
+func TestDecode_Include(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"router.yaml": `
+include:
+  - common.toml
+  - services/*.json
+router:
+  name: Override
+services:
+  - id: local
+`,
+		"common.toml":           "[router]\nname = \"Common\"\nstatus_port = 9090\n\n[directory]\ntoken = \"common\"\n",
+		"services/allstar.json": `{"services": [{"id": "allstar"}]}`,
+		"services/discord.json": `{"services": [{"id": "discord"}], "directory": {"token": "discord"}}`,
+		"loop.json":             `{"include": "loop2.json"}`,
+		"loop2.json":            `{"include": ["loop.json"]}`,
+	})
+
+	var config testConfig
+	if err := Decode(filepath.Join(dir, "router.yaml"), &config); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, service := range config.Services {
+		ids = append(ids, service.ID)
+	}
+	if strings.Join(ids, ",") != "allstar,discord,local" {
+		t.Errorf("Services %v, want included ones first", ids)
+	}
+	if config.Router.Name != "Override" || config.Router.StatusPort != 9090 || config.Directory.Token != "discord" {
+		t.Errorf("Merged %+v", config)
+	}
+
+	files, err := Files(filepath.Join(dir, "router.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, file := range files {
+		files[i], _ = filepath.Rel(dir, file)
+	}
+	if strings.Join(files, ",") != "router.yaml,common.toml,services/allstar.json,services/discord.json" {
+		t.Errorf("Files %v", files)
+	}
+
+	err = Decode(filepath.Join(dir, "loop.json"), &config)
+	if err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("Include cycle gave %v", err)
+	}
+}
+
+func TestRewritable(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"plain.json":    `{"router": {"name": "Hub"}}`,
+		"env.json":      `{"directory": {"token": "${TOKEN}"}}`,
+		"include.json":  `{"include": "plain.json"}`,
+		"router.yaml":   "router:\n  name: Hub\n",
+		"router.config": `{"router": {"name": "Hub"}}`,
+	})
+	for name, ok := range map[string]bool{
+		"plain.json":    true,
+		"router.config": true,
+		"env.json":      false,
+		"include.json":  false,
+		"router.yaml":   false,
+	} {
+		if err := Rewritable(filepath.Join(dir, name)); (err == nil) != ok {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package configfile
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML parses a TOML document into a tree of maps, slices and values
+// as JSON decodes to. Dates and times are kept as strings.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	if _, err := toml.Decode(string(data), &tree); err != nil {
+		return nil, err
+	}
+	return tomlTree(tree).(map[string]interface{}), nil
+}
+
+// tomlTree converts the arrays of tables and the dates TOML decodes to into
+// the slices and strings JSON has
+func tomlTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = tomlTree(value)
+		}
+		return v
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, table := range v {
+			s[i] = tomlTree(table)
+		}
+		return s
+	case []interface{}:
+		for i, value := range v {
+			v[i] = tomlTree(value)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
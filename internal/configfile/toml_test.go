@@ -0,0 +1,92 @@
+package configfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc := `
+# Router settings
+[router]
+name = "Hub \"one\""   # trailing comment
+status_port = 9_090
+watch_config = true
+
+[audio]
+opus_packet_loss = 10
+gain = -1.5e0
+formats = [
+  "pcm",
+  'opus',  # comment in an array
+]
+
+[[services]]
+id = "usrp_1"
+network = { protocol = "udp", listen_port = 0x7D0 }
+settings.path = 'C:\radio'
+
+[services.routing]
+exclude_services = []
+
+[[services]]
+id = "discord_1"
+"quoted key" = """
+first line \
+  continued
+second line"""
+raw = '''
+no \escapes'''
+started = 2024-05-01T12:00:00Z
+`
+	tree, err := parseTOML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"router": map[string]interface{}{"name": `Hub "one"`, "status_port": int64(9090), "watch_config": true},
+		"audio": map[string]interface{}{
+			"opus_packet_loss": int64(10),
+			"gain":             -1.5,
+			"formats":          []interface{}{"pcm", "opus"},
+		},
+		"services": []interface{}{
+			map[string]interface{}{
+				"id":       "usrp_1",
+				"network":  map[string]interface{}{"protocol": "udp", "listen_port": int64(2000)},
+				"settings": map[string]interface{}{"path": `C:\radio`},
+				"routing":  map[string]interface{}{"exclude_services": []interface{}{}},
+			},
+			map[string]interface{}{
+				"id":         "discord_1",
+				"quoted key": "first line continued\nsecond line",
+				"raw":        `no \escapes`,
+				"started":    "2024-05-01T12:00:00Z",
+			},
+		},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("Parsed\n%#v\nwant\n%#v", tree, want)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	for doc, want := range map[string]string{
+		"a = 1\na = 2":        "line 2",
+		"a = \"open":          "line 1",
+		"a = 1 b = 2":         "line 1",
+		"a = [1 2]":           "line 1",
+		"a = 012":             "line 1",
+		"[a\nb = 1":           "line 2",
+		"a = 1\n[a.b]":        "line 2",
+		"a = \"\\q\"":         "line 1",
+		"a = { b = 1 c = 2 }": "line 1",
+		"= 1":                 "line 1",
+	} {
+		_, err := parseTOML([]byte(doc))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q gave %v, want an error on %s", doc, err, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ErrRejected is returned when a packet or connection comes from a source
+// the ACL does not permit
+var ErrRejected = errors.New("transport: source rejected by acl")
+
+// maxRejectedSources caps the per-source rejection counts kept by an ACL;
+// rejections beyond it are still counted in the total
+const maxRejectedSources = 1024
+
+// ACLConfig holds source address filters as CIDRs or bare IPs. Deny entries
+// take precedence; when Allow is non-empty, only matching sources pass.
+type ACLConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ACLStats holds ACL counters
+type ACLStats struct {
+	Accepted        uint64            `json:"accepted"`
+	Rejected        uint64            `json:"rejected"`
+	RejectedSources map[string]uint64 `json:"rejected_sources,omitempty"` // Rejections per source IP
+}
+
+// ACL filters incoming packets and connections by source address
+type ACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	mutex    sync.Mutex
+	accepted uint64
+	rejected uint64
+	sources  map[string]uint64
+}
+
+// NewACL creates an ACL from the given configuration. A nil config or one
+// with no entries returns nil, which callers treat as "accept everything".
+func NewACL(config *ACLConfig) (*ACL, error) {
+	if config == nil || (len(config.Allow) == 0 && len(config.Deny) == 0) {
+		return nil, nil
+	}
+
+	allow, err := parseNetworks(config.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow entry: %w", err)
+	}
+	deny, err := parseNetworks(config.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny entry: %w", err)
+	}
+
+	return &ACL{
+		allow:   allow,
+		deny:    deny,
+		sources: make(map[string]uint64),
+	}, nil
+}
+
+// parseNetworks parses CIDRs, treating a bare IP as a single-host network
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Permit reports whether traffic from addr is allowed, recording the
+// decision in the ACL's counters
+func (a *ACL) Permit(addr net.Addr) bool {
+	if a == nil {
+		return true
+	}
+
+	ip := addrIP(addr)
+	ok := ip != nil && !matchAny(a.deny, ip) && (len(a.allow) == 0 || matchAny(a.allow, ip))
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if ok {
+		a.accepted++
+		return true
+	}
+
+	a.rejected++
+	key := sourceKey(addr)
+	if _, tracked := a.sources[key]; tracked || len(a.sources) < maxRejectedSources {
+		a.sources[key]++
+	}
+	return false
+}
+
+// Stats returns a copy of the ACL counters
+func (a *ACL) Stats() ACLStats {
+	if a == nil {
+		return ACLStats{}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stats := ACLStats{Accepted: a.accepted, Rejected: a.rejected}
+	if len(a.sources) > 0 {
+		stats.RejectedSources = make(map[string]uint64, len(a.sources))
+		for source, count := range a.sources {
+			stats.RejectedSources[source] = count
+		}
+	}
+	return stats
+}
+
+func matchAny(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP returns the IP of a UDP or TCP address, or nil
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func udpAddr(ip string) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.ParseIP(ip), Port: 32001}
+}
+
+func TestACL_Permit(t *testing.T) {
+	acl, err := NewACL(&ACLConfig{
+		Allow: []string{"192.0.2.0/24", "2001:db8::/32"},
+		Deny:  []string{"192.0.2.66"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.10", true},
+		{"::ffff:192.0.2.10", true}, // IPv4-mapped, as seen on dual-stack sockets
+		{"192.0.2.66", false},       // Deny wins over allow
+		{"198.51.100.1", false},     // Outside the allowlist
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, tt := range tests {
+		if got := acl.Permit(udpAddr(tt.ip)); got != tt.want {
+			t.Errorf("Permit(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	stats := acl.Stats()
+	if stats.Accepted != 3 || stats.Rejected != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.RejectedSources["192.0.2.66"] != 1 || len(stats.RejectedSources) != 3 {
+		t.Errorf("Unexpected rejected sources: %v", stats.RejectedSources)
+	}
+}
+
+func TestACL_DenyOnly(t *testing.T) {
+	acl, err := NewACL(&ACLConfig{Deny: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl.Permit(udpAddr("10.1.2.3")) {
+		t.Error("Expected denied network to be rejected")
+	}
+	if !acl.Permit(udpAddr("192.0.2.1")) {
+		t.Error("Expected other sources to pass without an allowlist")
+	}
+}
+
+func TestACL_Config(t *testing.T) {
+	if acl, err := NewACL(&ACLConfig{}); acl != nil || err != nil {
+		t.Errorf("Expected nil ACL for empty config, got %v, %v", acl, err)
+	}
+	if _, err := NewACL(&ACLConfig{Allow: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected invalid entry to be rejected")
+	}
+	if _, err := NewUDPConnection(&ConnectionConfig{LocalAddr: ":0", ACL: &ACLConfig{Deny: []string{"10.0.0.0/33"}}}); err == nil {
+		t.Error("Expected invalid CIDR to fail connection setup")
+	}
+}
+
+func TestUDPConnection_ACL(t *testing.T) {
+	receiver, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr: "127.0.0.1:0",
+		ACL:       &ACLConfig{Allow: []string{"192.0.2.0/24"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	sender, err := net.Dial("udp", receiver.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Write(ping)
+
+	receiver.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := receiver.Receive(); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Expected ErrRejected, got %v", err)
+	}
+	if receiver.remoteAddr != nil {
+		t.Error("A rejected source must not become the remote address")
+	}
+	if stats := receiver.ACLStats(); stats.Rejected != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestServer_ACL(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		ACL:        &ACLConfig{Deny: []string{"127.0.0.0/8"}},
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	node, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		node.Write(ping)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.ACLStats().Rejected < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := server.ACLStats(); stats.Rejected != 3 || stats.RejectedSources["127.0.0.1"] != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if peers := server.Peers(); len(peers) != 0 {
+		t.Errorf("Rejected source must not become a peer: %+v", peers)
+	}
+}
+
+func TestTCPConnection_ACL(t *testing.T) {
+	server, err := NewTCPConnection(&ConnectionConfig{
+		LocalAddr: "127.0.0.1:0",
+		ACL:       &ACLConfig{Allow: []string{"192.0.2.0/24"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := net.Dial("tcp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := server.accept(time.Now().Add(2 * time.Second)); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Expected ErrRejected, got %v", err)
+	}
+	if server.State() != StateDisconnected {
+		t.Errorf("Rejected peer must not bring the link up, state %s", server.State())
+	}
+}
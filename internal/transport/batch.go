@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// DefaultBatchSize is the number of datagrams a Server reads or writes per
+// system call where the platform supports it (recvmmsg/sendmmsg on Linux)
+const DefaultBatchSize = 32
+
+// datagram is one packet of a batch read or write
+type datagram struct {
+	data []byte       // Read buffer, or the packet to write
+	n    int          // Bytes read, or bytes written (0 = failed)
+	addr *net.UDPAddr // Source of a read, destination of a write
+}
+
+// batchConn moves several datagrams per call. A read may run alongside a
+// write, but reads and writes must each be serialized by the caller.
+type batchConn interface {
+	// readBatch blocks until at least one datagram arrives, then fills as
+	// many of dgrams as are ready
+	readBatch(dgrams []datagram) (int, error)
+	// writeBatch sends every datagram, returning how many were written and
+	// the first error
+	writeBatch(dgrams []datagram) (int, error)
+	// syscalls returns the number of system calls made so far
+	syscalls() uint64
+}
+
+// singleConn is the portable batchConn, one system call per datagram
+type singleConn struct {
+	conn  *net.UDPConn
+	calls uint64 // atomic
+}
+
+func (c *singleConn) readBatch(dgrams []datagram) (int, error) {
+	atomic.AddUint64(&c.calls, 1)
+	n, addr, err := c.conn.ReadFromUDP(dgrams[0].data)
+	if err != nil {
+		return 0, err
+	}
+	dgrams[0].n, dgrams[0].addr = n, addr
+	return 1, nil
+}
+
+func (c *singleConn) writeBatch(dgrams []datagram) (int, error) {
+	written := 0
+	var firstErr error
+	for i := range dgrams {
+		atomic.AddUint64(&c.calls, 1)
+		n, err := c.conn.WriteToUDP(dgrams[i].data, dgrams[i].addr)
+		dgrams[i].n = n
+		if err != nil {
+			dgrams[i].n = 0
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		written++
+	}
+	return written, firstErr
+}
+
+func (c *singleConn) syscalls() uint64 {
+	return atomic.LoadUint64(&c.calls)
+}
@@ -0,0 +1,263 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmsghdr mirrors struct mmsghdr, which x/sys does not define
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// mmsgBuffers holds the kernel-facing arrays for one direction
+type mmsgBuffers struct {
+	hdrs  []mmsghdr
+	iovs  []unix.Iovec
+	names []unix.RawSockaddrAny
+}
+
+func newMmsgBuffers(size int) mmsgBuffers {
+	return mmsgBuffers{
+		hdrs:  make([]mmsghdr, size),
+		iovs:  make([]unix.Iovec, size),
+		names: make([]unix.RawSockaddrAny, size),
+	}
+}
+
+// set points header i at data and a name of namelen bytes
+func (b *mmsgBuffers) set(i int, data []byte, namelen uint32) {
+	b.iovs[i] = unix.Iovec{}
+	if len(data) > 0 {
+		b.iovs[i].Base = &data[0]
+		b.iovs[i].SetLen(len(data))
+	}
+	b.hdrs[i] = mmsghdr{}
+	b.hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.names[i]))
+	b.hdrs[i].hdr.Namelen = namelen
+	b.hdrs[i].hdr.Iov = &b.iovs[i]
+	b.hdrs[i].hdr.SetIovlen(1)
+}
+
+// mmsgConn is the Linux batchConn, moving up to a batch of datagrams per
+// recvmmsg or sendmmsg call through the runtime poller
+type mmsgConn struct {
+	raw    syscall.RawConn
+	family int // Socket domain, AF_INET or AF_INET6
+	read   mmsgBuffers
+	write  mmsgBuffers
+	calls  uint64 // atomic
+}
+
+// newBatchConn returns a batchConn for conn, falling back to one datagram
+// per call for a batch size of 1 or a socket that cannot be inspected
+func newBatchConn(conn *net.UDPConn, size int) batchConn {
+	if size <= 1 {
+		return &singleConn{conn: conn}
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return &singleConn{conn: conn}
+	}
+	family := -1
+	raw.Control(func(fd uintptr) {
+		if domain, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_DOMAIN); err == nil {
+			family = domain
+		}
+	})
+	if family != unix.AF_INET && family != unix.AF_INET6 {
+		return &singleConn{conn: conn}
+	}
+
+	return &mmsgConn{
+		raw:    raw,
+		family: family,
+		read:   newMmsgBuffers(size),
+		write:  newMmsgBuffers(size),
+	}
+}
+
+func (c *mmsgConn) readBatch(dgrams []datagram) (int, error) {
+	if len(dgrams) > len(c.read.hdrs) {
+		dgrams = dgrams[:len(c.read.hdrs)]
+	}
+	for i := range dgrams {
+		c.read.set(i, dgrams[i].data, unix.SizeofSockaddrAny)
+	}
+
+	n, err := c.mmsg(unix.SYS_RECVMMSG, &c.read, len(dgrams))
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < n; i++ {
+		dgrams[i].n = int(c.read.hdrs[i].len)
+		dgrams[i].addr = sockaddrToUDP(&c.read.names[i])
+	}
+	return n, nil
+}
+
+func (c *mmsgConn) writeBatch(dgrams []datagram) (int, error) {
+	written := 0
+	var firstErr error
+	fail := func(i int, err error) {
+		dgrams[i].n = 0
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := 0; i < len(dgrams); {
+		// Fill headers up to the batch size, stopping short of an address
+		// the socket cannot reach
+		count := 0
+		var addrErr error
+		for count < len(c.write.hdrs) && i+count < len(dgrams) {
+			d := &dgrams[i+count]
+			namelen, err := udpToSockaddr(d.addr, c.family, &c.write.names[count])
+			if err != nil {
+				addrErr = err
+				break
+			}
+			c.write.set(count, d.data, namelen)
+			count++
+		}
+		if count == 0 {
+			fail(i, addrErr)
+			i++
+			continue
+		}
+
+		n, err := c.mmsg(unix.SYS_SENDMMSG, &c.write, count)
+		if err != nil {
+			var errno syscall.Errno
+			if !errors.As(err, &errno) {
+				// The socket itself failed (closed, deadline); stop here
+				for j := i; j < len(dgrams); j++ {
+					fail(j, err)
+				}
+				return written, firstErr
+			}
+			// sendmmsg reports an error only for the first datagram
+			fail(i, err)
+			i++
+			continue
+		}
+		for j := i; j < i+n; j++ {
+			dgrams[j].n = len(dgrams[j].data)
+		}
+		written += n
+		i += n
+	}
+	return written, firstErr
+}
+
+// mmsg runs recvmmsg or sendmmsg over the first count headers of b,
+// waiting in the poller while the socket would block
+func (c *mmsgConn) mmsg(trap uintptr, b *mmsgBuffers, count int) (int, error) {
+	var n int
+	var errno syscall.Errno
+	op := func(fd uintptr) bool {
+		atomic.AddUint64(&c.calls, 1)
+		r, _, e := unix.Syscall6(trap, fd, uintptr(unsafe.Pointer(&b.hdrs[0])), uintptr(count), 0, 0, 0)
+		if e == unix.EAGAIN {
+			return false
+		}
+		n, errno = int(r), e
+		return true
+	}
+
+	name := "sendmmsg"
+	var err error
+	if trap == unix.SYS_RECVMMSG {
+		name = "recvmmsg"
+		err = c.raw.Read(op)
+	} else {
+		err = c.raw.Write(op)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, os.NewSyscallError(name, errno)
+	}
+	return n, nil
+}
+
+func (c *mmsgConn) syscalls() uint64 {
+	return atomic.LoadUint64(&c.calls)
+}
+
+// sockaddrToUDP decodes a socket address filled in by recvmmsg
+func sockaddrToUDP(rsa *unix.RawSockaddrAny) *net.UDPAddr {
+	switch rsa.Addr.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		return &net.UDPAddr{
+			IP:   append(net.IP(nil), sa.Addr[:]...),
+			Port: int(port[0])<<8 | int(port[1]),
+		}
+	case unix.AF_INET6:
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		addr := &net.UDPAddr{
+			IP:   append(net.IP(nil), sa.Addr[:]...),
+			Port: int(port[0])<<8 | int(port[1]),
+		}
+		if sa.Scope_id != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.Scope_id)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	}
+	return nil
+}
+
+// udpToSockaddr encodes addr for a socket of the given family into rsa,
+// returning the encoded length
+func udpToSockaddr(addr *net.UDPAddr, family int, rsa *unix.RawSockaddrAny) (uint32, error) {
+	if addr == nil {
+		return 0, fmt.Errorf("missing destination address")
+	}
+
+	switch family {
+	case unix.AF_INET:
+		ip := addr.IP.To4()
+		if ip == nil {
+			return 0, fmt.Errorf("cannot send to %s from an IPv4 socket", addr)
+		}
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		*sa = unix.RawSockaddrInet4{Family: unix.AF_INET}
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+		copy(sa.Addr[:], ip)
+		return unix.SizeofSockaddrInet4, nil
+	case unix.AF_INET6:
+		ip := addr.IP.To16()
+		if ip == nil {
+			return 0, fmt.Errorf("invalid destination address %s", addr)
+		}
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		*sa = unix.RawSockaddrInet6{Family: unix.AF_INET6}
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+		copy(sa.Addr[:], ip)
+		if addr.Zone != "" {
+			if ifi, err := net.InterfaceByName(addr.Zone); err == nil {
+				sa.Scope_id = uint32(ifi.Index)
+			}
+		}
+		return unix.SizeofSockaddrInet6, nil
+	}
+	return 0, fmt.Errorf("unsupported socket family %d", family)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package transport
+
+import "net"
+
+// newBatchConn returns a batchConn for conn; without recvmmsg and sendmmsg
+// every datagram takes its own system call
+func newBatchConn(conn *net.UDPConn, size int) batchConn {
+	return &singleConn{conn: conn}
+}
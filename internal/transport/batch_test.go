@@ -0,0 +1,247 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func listenLoopback(t testing.TB, network, addr string) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP(network, &net.UDPAddr{IP: net.ParseIP(addr)})
+	if err != nil {
+		t.Skipf("%s loopback unavailable: %v", network, err)
+	}
+	return conn
+}
+
+func TestBatchConn_ReadWrite(t *testing.T) {
+	for _, tc := range []struct{ network, addr string }{
+		{"udp4", "127.0.0.1"},
+		{"udp6", "::1"},
+	} {
+		t.Run(tc.network, func(t *testing.T) {
+			receiver := listenLoopback(t, tc.network, tc.addr)
+			defer receiver.Close()
+			sender := listenLoopback(t, tc.network, tc.addr)
+			defer sender.Close()
+
+			dgrams := make([]datagram, 5)
+			for i := range dgrams {
+				dgrams[i] = datagram{data: []byte{byte(i), 0xaa}, addr: receiver.LocalAddr().(*net.UDPAddr)}
+			}
+			written, err := newBatchConn(sender, 4).writeBatch(dgrams)
+			if err != nil || written != len(dgrams) {
+				t.Fatalf("Expected %d datagrams written, got %d: %v", len(dgrams), written, err)
+			}
+			for i, d := range dgrams {
+				if d.n != 2 {
+					t.Errorf("Datagram %d: expected 2 bytes written, got %d", i, d.n)
+				}
+			}
+
+			reader := newBatchConn(receiver, 8)
+			receiver.SetReadDeadline(time.Now().Add(2 * time.Second))
+			bufs := make([]datagram, 8)
+			for i := range bufs {
+				bufs[i].data = make([]byte, 64)
+			}
+			var got [][]byte
+			for len(got) < len(dgrams) {
+				n, err := reader.readBatch(bufs)
+				if err != nil {
+					t.Fatalf("Read failed after %d datagrams: %v", len(got), err)
+				}
+				for _, d := range bufs[:n] {
+					if d.addr.Port != sender.LocalAddr().(*net.UDPAddr).Port || !d.addr.IP.Equal(net.ParseIP(tc.addr)) {
+						t.Errorf("Unexpected source %s", d.addr)
+					}
+					got = append(got, append([]byte(nil), d.data[:d.n]...))
+				}
+			}
+			for i, data := range got {
+				if !bytes.Equal(data, []byte{byte(i), 0xaa}) {
+					t.Errorf("Datagram %d: got %x", i, data)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchConn_SkipsUnreachable(t *testing.T) {
+	receiver := listenLoopback(t, "udp4", "127.0.0.1")
+	defer receiver.Close()
+	sender := listenLoopback(t, "udp4", "127.0.0.1")
+	defer sender.Close()
+
+	// An IPv6 destination cannot be reached from an IPv4 socket
+	dest := receiver.LocalAddr().(*net.UDPAddr)
+	dgrams := []datagram{
+		{data: []byte{1}, addr: dest},
+		{data: []byte{2}, addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 9}},
+		{data: []byte{3}, addr: dest},
+	}
+	written, err := newBatchConn(sender, 4).writeBatch(dgrams)
+	if err == nil {
+		t.Error("Expected an error for the unreachable destination")
+	}
+	if written != 2 || dgrams[0].n != 1 || dgrams[1].n != 0 || dgrams[2].n != 1 {
+		t.Errorf("Expected the other datagrams to be sent, wrote %d: %+v", written, dgrams)
+	}
+}
+
+func TestServer_BroadcastBatch(t *testing.T) {
+	server := NewServer(&ServerConfig{ListenAddr: "127.0.0.1:0", BatchSize: 2})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	// Five nodes register by pinging; the first is the talker
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make([]*net.UDPConn, 5)
+	for i := range nodes {
+		nodes[i] = listenLoopback(t, "udp4", "127.0.0.1")
+		defer nodes[i].Close()
+		nodes[i].WriteToUDP(ping, server.LocalAddr().(*net.UDPAddr))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.Peers()) < len(nodes) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	talker := server.Peer(nodes[0].LocalAddr().String())
+	if talker == nil {
+		t.Fatal("Talker did not register")
+	}
+
+	for i := 0; i < 2; i++ {
+		text := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("net check")}
+		if err := server.Broadcast(text, talker); err != nil {
+			t.Fatalf("Broadcast failed: %v", err)
+		}
+	}
+
+	for i, node := range nodes[1:] {
+		node.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 512)
+		for want := uint32(1); want <= 2; want++ {
+			n, err := node.Read(buf)
+			if err != nil {
+				t.Fatalf("Node %d: %v", i+1, err)
+			}
+			msg, err := usrp.Parse(buf[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every listener sees its own sequence
+			if seq := usrp.HeaderOf(msg).Seq; seq != want {
+				t.Errorf("Node %d: expected seq %d, got %d", i+1, want, seq)
+			}
+		}
+	}
+
+	nodes[0].SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := nodes[0].Read(make([]byte, 512)); err == nil {
+		t.Error("Talker should not hear its own broadcast")
+	}
+	if out := server.Metrics().Snapshot().PacketsOut; out != 8 {
+		t.Errorf("Expected 8 packets out, got %d", out)
+	}
+}
+
+// benchStreams is the number of concurrent 50pps voice streams a dense hub
+// carries; one benchmark op is one 20ms frame across all of them
+const benchStreams = 128
+
+func benchVoice(b *testing.B) []byte {
+	data, err := (&usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 1)}).Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// BenchmarkServerReceive reports receive system calls per frame with and
+// without recvmmsg
+func BenchmarkServerReceive(b *testing.B) {
+	for _, size := range []int{1, DefaultBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			receiver := listenLoopback(b, "udp4", "127.0.0.1")
+			defer receiver.Close()
+			receiver.SetReadBuffer(1 << 20)
+			dest := receiver.LocalAddr().(*net.UDPAddr)
+
+			senders := make([]*net.UDPConn, benchStreams)
+			for i := range senders {
+				senders[i] = listenLoopback(b, "udp4", "127.0.0.1")
+				defer senders[i].Close()
+			}
+			voice := benchVoice(b)
+
+			reader := newBatchConn(receiver, size)
+			dgrams := make([]datagram, size)
+			for i := range dgrams {
+				dgrams[i].data = make([]byte, usrp.CurrentLimits().MaxPacketSize)
+			}
+
+			b.ResetTimer()
+			start := reader.syscalls()
+			for i := 0; i < b.N; i++ {
+				for _, sender := range senders {
+					sender.WriteToUDP(voice, dest)
+				}
+				for got := 0; got < benchStreams; {
+					n, err := reader.readBatch(dgrams)
+					if err != nil {
+						b.Fatal(err)
+					}
+					got += n
+				}
+			}
+			b.ReportMetric(float64(reader.syscalls()-start)/float64(b.N), "syscalls/frame")
+		})
+	}
+}
+
+// BenchmarkServerBroadcast reports send system calls per frame fanned out
+// to every stream, with and without sendmmsg
+func BenchmarkServerBroadcast(b *testing.B) {
+	for _, size := range []int{1, DefaultBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			server := NewServer(&ServerConfig{ListenAddr: "127.0.0.1:0", BatchSize: size})
+			if err := server.Listen(); err != nil {
+				b.Fatal(err)
+			}
+			defer server.Close()
+			defer server.expireAll()
+
+			for i := 0; i < benchStreams; i++ {
+				node := listenLoopback(b, "udp4", "127.0.0.1")
+				defer node.Close()
+				server.peerFor(node.LocalAddr().(*net.UDPAddr), time.Now())
+			}
+			voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+
+			b.ResetTimer()
+			start := server.batch.syscalls()
+			for i := 0; i < b.N; i++ {
+				if err := server.Broadcast(voice, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(server.batch.syscalls()-start)/float64(b.N), "syscalls/frame")
+		})
+	}
+}
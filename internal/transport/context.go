@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// aLongTimeAgo is a deadline in the past, set to interrupt blocked I/O
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadlineFor returns the deadline for one operation under ctx: the
+// context's own deadline, else now plus timeout, else zero (none)
+func deadlineFor(ctx context.Context, timeout time.Duration) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	if timeout > 0 {
+		return time.Now().Add(timeout)
+	}
+	return time.Time{}
+}
+
+// bindContext applies ctx to one read, write or accept through the
+// socket's deadline setter: the deadline comes from deadlineFor, and
+// cancelling ctx interrupts the blocked call. With neither a deadline nor a
+// cancellable context the socket is left untouched. The returned release
+// function clears what was set and must be called when the call returns.
+func bindContext(ctx context.Context, timeout time.Duration, set func(time.Time) error) (func(), error) {
+	deadline := deadlineFor(ctx, timeout)
+	if !deadline.IsZero() {
+		if err := set(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+
+	stop := func() bool { return true }
+	fired := make(chan struct{})
+	if ctx.Done() != nil {
+		stop = context.AfterFunc(ctx, func() {
+			set(aLongTimeAgo)
+			close(fired)
+		})
+	}
+
+	return func() {
+		if !stop() {
+			// Cancelled; wait for the interrupt so it cannot land after
+			// the reset below
+			<-fired
+			set(time.Time{})
+			return
+		}
+		if !deadline.IsZero() {
+			set(time.Time{})
+		}
+	}, nil
+}
+
+// contextError reports ctx's error in place of err once ctx is done, so
+// callers see context.Canceled or context.DeadlineExceeded rather than the
+// socket timeout used to interrupt them
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// isDeadline reports whether err is a context or socket deadline
+func isDeadline(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func TestUDPConnection_ReceiveMessageContext_Cancel(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := receiver.ReceiveMessageContext(ctx)
+		result <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cancel did not interrupt the read")
+	}
+
+	// The interrupt must not poison later reads
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.ReceiveMessageContext(context.Background()); err != nil {
+		t.Errorf("Receive after cancel failed: %v", err)
+	}
+}
+
+func TestUDPConnection_ReceiveMessageContext_Deadline(t *testing.T) {
+	receiver, _ := newUDPPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := receiver.ReceiveMessageContext(ctx); !isDeadline(err) {
+		t.Errorf("Expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Deadline took %v to apply", elapsed)
+	}
+}
+
+func TestUDPConnection_ReadTimeout(t *testing.T) {
+	conn, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0", ReadTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = conn.ReceiveMessage()
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Expected ReadTimeout to apply, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ReadTimeout took %v to apply", elapsed)
+	}
+}
+
+func TestUDPConnection_SendMessageContext_Cancelled(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ping := &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}
+	if err := sender.SendMessageContext(ctx, ping); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	receiver.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := receiver.Receive(); err == nil {
+		t.Error("A cancelled send should not reach the wire")
+	}
+}
+
+func TestTCPConnection_SendMessageContext_Blocked(t *testing.T) {
+	server, client := newTCPPair(t)
+
+	// Accept the client, then time out waiting for a message
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	_, err := server.ReceiveMessageContext(ctx)
+	cancel()
+	if !isDeadline(err) || server.currentStream() == nil {
+		t.Fatalf("Expected to accept the client and time out, got %v", err)
+	}
+
+	// The server never reads, so the client eventually blocks on a full
+	// socket buffer; the context must bound that wait
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := client.SendMessageContext(ctx, voice)
+		cancel()
+		if err == nil {
+			continue
+		}
+		if !isDeadline(err) {
+			t.Fatalf("Expected a deadline error, got %v", err)
+		}
+		// A partial frame cannot be resumed, so the stream is dropped
+		if client.currentStream() != nil {
+			t.Error("Expected the interrupted stream to be dropped")
+		}
+		return
+	}
+	t.Fatal("Send never blocked")
+}
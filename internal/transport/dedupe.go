@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// DedupeConfig holds duplicate suppression settings
+type DedupeConfig struct {
+	Window  int           `json:"window"`   // Sequence numbers remembered per source
+	IdleTTL time.Duration `json:"idle_ttl"` // Sources silent this long are forgotten
+}
+
+// DefaultDedupeConfig remembers about five seconds of a voice stream
+func DefaultDedupeConfig() *DedupeConfig {
+	return &DedupeConfig{
+		Window:  256,
+		IdleTTL: time.Minute,
+	}
+}
+
+// DedupeStats holds duplicate filter counters
+type DedupeStats struct {
+	Passed     uint64 `json:"passed"`
+	Duplicates uint64 `json:"duplicates"`
+	Sources    int    `json:"sources"` // Sources currently tracked
+}
+
+// dedupeSource is the recent sequence history of one source. Each slot holds
+// the last sequence number that mapped to it, tagged so an empty slot never
+// matches seq 0.
+type dedupeSource struct {
+	slots    []uint64
+	highest  uint32
+	lastSeen time.Time
+}
+
+const dedupeSlotUsed = 1 << 32
+
+// Deduper drops packets whose (source, sequence) pair was already seen
+// within a sliding window, guarding against networks that duplicate
+// datagrams and against routing loops that deliver a packet twice.
+// Sequence 0 is treated as unnumbered and always passes.
+type Deduper struct {
+	config    DedupeConfig
+	sources   map[string]*dedupeSource
+	mutex     sync.Mutex
+	lastPrune time.Time
+	passed    uint64
+	dupes     uint64
+}
+
+// NewDeduper creates a duplicate filter. A nil config returns nil, which
+// callers treat as "disabled".
+func NewDeduper(config *DedupeConfig) *Deduper {
+	if config == nil {
+		return nil
+	}
+
+	cfg := *config
+	defaults := DefaultDedupeConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = defaults.IdleTTL
+	}
+
+	return &Deduper{
+		config:  cfg,
+		sources: make(map[string]*dedupeSource),
+	}
+}
+
+// Duplicate reports whether msg from source repeats a recently seen
+// sequence number, recording it if not
+func (d *Deduper) Duplicate(source net.Addr, msg usrp.Message, now time.Time) bool {
+	if d == nil {
+		return false
+	}
+	header := usrp.HeaderOf(msg)
+	if header == nil || header.Seq == 0 {
+		return false
+	}
+	seq := header.Seq
+
+	key := ""
+	if source != nil {
+		key = source.String()
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if now.Sub(d.lastPrune) >= d.config.IdleTTL {
+		d.prune(now)
+	}
+
+	src, exists := d.sources[key]
+	if !exists {
+		src = &dedupeSource{slots: make([]uint64, d.config.Window), highest: seq}
+		d.sources[key] = src
+	}
+	src.lastSeen = now
+
+	// A large backwards jump is the sender restarting its counter; the old
+	// history says nothing about the new stream
+	if seqDiff(seq, src.highest) < -jitterRestartGap {
+		for i := range src.slots {
+			src.slots[i] = 0
+		}
+		src.highest = seq
+	}
+
+	// Too old to judge; recording it would evict a newer sequence number
+	if seqDiff(seq, src.highest) <= -int32(len(src.slots)) {
+		d.passed++
+		return false
+	}
+
+	slot := &src.slots[int(seq%uint32(len(src.slots)))]
+	if *slot == dedupeSlotUsed|uint64(seq) {
+		d.dupes++
+		return true
+	}
+	*slot = dedupeSlotUsed | uint64(seq)
+	if seqDiff(seq, src.highest) > 0 {
+		src.highest = seq
+	}
+	d.passed++
+	return false
+}
+
+// prune forgets idle sources. Must be called with the mutex held.
+func (d *Deduper) prune(now time.Time) {
+	for key, src := range d.sources {
+		if now.Sub(src.lastSeen) > d.config.IdleTTL {
+			delete(d.sources, key)
+		}
+	}
+	d.lastPrune = now
+}
+
+// Stats returns the filter's counters
+func (d *Deduper) Stats() DedupeStats {
+	if d == nil {
+		return DedupeStats{}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return DedupeStats{Passed: d.passed, Duplicates: d.dupes, Sources: len(d.sources)}
+}
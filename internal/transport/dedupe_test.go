@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func dedupePing(seq uint32) usrp.Message {
+	return &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, seq)}
+}
+
+func TestDeduper_DropsRepeats(t *testing.T) {
+	dedupe := NewDeduper(&DedupeConfig{Window: 8})
+	a := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	b := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2000}
+	now := time.Now()
+
+	for _, seq := range []uint32{1, 2, 3} {
+		if dedupe.Duplicate(a, dedupePing(seq), now) {
+			t.Errorf("Seq %d should pass the first time", seq)
+		}
+	}
+	if !dedupe.Duplicate(a, dedupePing(2), now) {
+		t.Error("Expected repeated seq 2 to be dropped")
+	}
+
+	// Each source address has its own sequence space
+	if dedupe.Duplicate(b, dedupePing(2), now) {
+		t.Error("Seq 2 from another source should pass")
+	}
+
+	// Unnumbered packets are never treated as duplicates
+	for i := 0; i < 2; i++ {
+		if dedupe.Duplicate(a, dedupePing(0), now) {
+			t.Error("Seq 0 should always pass")
+		}
+	}
+
+	stats := dedupe.Stats()
+	if stats.Passed != 4 || stats.Duplicates != 1 || stats.Sources != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestDeduper_WindowSlides(t *testing.T) {
+	dedupe := NewDeduper(&DedupeConfig{Window: 4})
+	source := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	now := time.Now()
+
+	for seq := uint32(1); seq <= 6; seq++ {
+		dedupe.Duplicate(source, dedupePing(seq), now)
+	}
+	// Seq 1 has left the window, seq 5 has not
+	if dedupe.Duplicate(source, dedupePing(1), now) {
+		t.Error("Seq older than the window should pass")
+	}
+	if !dedupe.Duplicate(source, dedupePing(5), now) {
+		t.Error("Seq within the window should be dropped")
+	}
+}
+
+func TestDeduper_WrapAndRestart(t *testing.T) {
+	dedupe := NewDeduper(DefaultDedupeConfig())
+	source := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	now := time.Now()
+
+	for _, seq := range []uint32{0xfffffffe, 0xffffffff, 1, 2} {
+		if dedupe.Duplicate(source, dedupePing(seq), now) {
+			t.Errorf("Seq %#x should pass across wraparound", seq)
+		}
+	}
+	if !dedupe.Duplicate(source, dedupePing(0xffffffff), now) {
+		t.Error("Expected repeat from before the wrap to be dropped")
+	}
+
+	// A sender restarting far behind starts with fresh history
+	for _, seq := range []uint32{100000, 100001, 5} {
+		dedupe.Duplicate(source, dedupePing(seq), now)
+	}
+	if dedupe.Duplicate(source, dedupePing(100001), now) {
+		t.Error("Expected history to be cleared after a counter restart")
+	}
+}
+
+func TestDeduper_PrunesIdleSources(t *testing.T) {
+	dedupe := NewDeduper(&DedupeConfig{IdleTTL: time.Second})
+	now := time.Now()
+
+	dedupe.Duplicate(&net.UDPAddr{IP: net.ParseIP("192.0.2.1")}, dedupePing(1), now)
+	dedupe.Duplicate(&net.UDPAddr{IP: net.ParseIP("192.0.2.2")}, dedupePing(1), now.Add(2*time.Second))
+
+	if sources := dedupe.Stats().Sources; sources != 1 {
+		t.Errorf("Expected idle source to be pruned, tracking %d", sources)
+	}
+}
+
+func TestDeduper_Disabled(t *testing.T) {
+	var dedupe *Deduper
+	if NewDeduper(nil) != nil {
+		t.Fatal("Expected nil deduper without a config")
+	}
+	if dedupe.Duplicate(nil, dedupePing(1), time.Now()) || dedupe.Duplicate(nil, dedupePing(1), time.Now()) {
+		t.Error("A nil deduper must pass everything")
+	}
+}
+
+func TestServer_Dedupe(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		Dedupe:     DefaultDedupeConfig(),
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	node, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	// Every packet arrives twice, as on a network that duplicates datagrams
+	for seq := uint32(1); seq <= 5; seq++ {
+		data, err := dedupePing(seq).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.Write(data)
+		node.Write(data)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.DedupeStats().Passed+server.DedupeStats().Duplicates < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := server.DedupeStats()
+	if stats.Passed != 5 || stats.Duplicates != 5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	peers := server.Peers()
+	if len(peers) != 1 || peers[0].Duplicates != 5 {
+		t.Errorf("Unexpected peer state: %+v", peers)
+	}
+}
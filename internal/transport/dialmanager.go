@@ -0,0 +1,247 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// DialManagerConfig holds outbound socket pool settings
+type DialManagerConfig struct {
+	IdleTimeout time.Duration `json:"idle_timeout"` // Sockets unused this long are closed
+	MaxConns    int           `json:"max_conns"`    // Open sockets before the least recently used is closed; 0 = unlimited
+
+	// Socket options for dialed sockets, as in ConnectionConfig
+	WriteBufferSize int       `json:"write_buffer_size,omitempty"`
+	DSCP            int       `json:"dscp,omitempty"`
+	IPVersion       IPVersion `json:"ip_version,omitempty"`
+
+	// Metrics receives counters for every pooled socket (nil = a private
+	// AtomicMetrics, read through the manager's Metrics method)
+	Metrics Metrics `json:"-"`
+}
+
+// DefaultDialManagerConfig returns a default pool configuration
+func DefaultDialManagerConfig() *DialManagerConfig {
+	return &DialManagerConfig{
+		IdleTimeout: 2 * time.Minute,
+		MaxConns:    1024,
+	}
+}
+
+// DialManagerStats holds pool counters
+type DialManagerStats struct {
+	Dials     uint64 `json:"dials"`     // Sockets opened
+	Reuses    uint64 `json:"reuses"`    // Sends on an already open socket
+	Evictions uint64 `json:"evictions"` // Sockets closed for idleness, the size cap, or a write error
+	Open      int    `json:"open"`
+}
+
+// dialedConn is one pooled socket
+type dialedConn struct {
+	conn     *net.UDPConn
+	lastUsed time.Time
+}
+
+// DialManager keeps one connected UDP socket per destination address and
+// reuses it for every packet sent there, instead of dialing (and burning
+// an ephemeral port) per packet. Idle sockets are closed as the pool is
+// used; a socket that fails a write is closed and redialed on the next send.
+type DialManager struct {
+	config    DialManagerConfig
+	socket    *ConnectionConfig
+	metrics   Metrics
+	conns     map[string]*dialedConn
+	mutex     sync.Mutex
+	lastSweep time.Time
+	closed    bool
+
+	dials     uint64
+	reuses    uint64
+	evictions uint64
+}
+
+// NewDialManager creates an outbound socket pool
+func NewDialManager(config *DialManagerConfig) *DialManager {
+	cfg := *DefaultDialManagerConfig()
+	if config != nil {
+		cfg = *config
+		if cfg.IdleTimeout <= 0 {
+			cfg.IdleTimeout = DefaultDialManagerConfig().IdleTimeout
+		}
+	}
+
+	return &DialManager{
+		config: cfg,
+		socket: &ConnectionConfig{
+			WriteBufferSize: cfg.WriteBufferSize,
+			DSCP:            cfg.DSCP,
+			IPVersion:       cfg.IPVersion,
+		},
+		metrics: metricsOrDefault(cfg.Metrics),
+		conns:   make(map[string]*dialedConn),
+	}
+}
+
+// Conn returns the pooled socket for address ("host:port"), dialing it on
+// first use. The socket stays owned by the manager; do not close it.
+func (m *DialManager) Conn(address string) (*net.UDPConn, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil, fmt.Errorf("dial manager is closed")
+	}
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= m.config.IdleTimeout/2 {
+		m.sweep(now)
+	}
+
+	if dc, exists := m.conns[address]; exists {
+		dc.lastUsed = now
+		m.reuses++
+		return dc.conn, nil
+	}
+
+	conn, err := m.dial(address)
+	if err != nil {
+		m.metrics.Error()
+		return nil, err
+	}
+	if m.config.MaxConns > 0 && len(m.conns) >= m.config.MaxConns {
+		m.evictOldest()
+	}
+	m.conns[address] = &dialedConn{conn: conn, lastUsed: now}
+	m.dials++
+	return conn, nil
+}
+
+// dial opens a connected socket to address
+func (m *DialManager) dial(address string) (*net.UDPConn, error) {
+	remote, err := resolveUDPRemote(address, m.config.IPVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", address, err)
+	}
+
+	dialer := net.Dialer{Control: socketControl(m.socket)}
+	network := bindNetwork("udp", nil, remote.IP, m.config.IPVersion)
+	c, err := dialer.Dial(network, remote.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial UDP %s: %w", address, err)
+	}
+	conn := c.(*net.UDPConn)
+	if err := applyBuffers(conn, m.socket); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Send writes one datagram to address over its pooled socket
+func (m *DialManager) Send(address string, data []byte) error {
+	conn, err := m.Conn(address)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(data); err != nil {
+		m.metrics.Error()
+		m.drop(address, conn)
+		return fmt.Errorf("failed to send UDP packet to %s: %w", address, err)
+	}
+	m.metrics.PacketOut(len(data))
+	return nil
+}
+
+// SendMessage marshals msg and sends it to address. The header is sent as
+// given; numbering is the caller's.
+func (m *DialManager) SendMessage(address string, msg usrp.Message) error {
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("message validation failed: %w", err)
+	}
+	data, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return m.Send(address, data)
+}
+
+// drop closes address's socket if it is still conn, so the next send
+// redials
+func (m *DialManager) drop(address string, conn *net.UDPConn) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if dc, exists := m.conns[address]; exists && dc.conn == conn {
+		conn.Close()
+		delete(m.conns, address)
+		m.evictions++
+	}
+}
+
+// sweep closes sockets idle longer than the idle timeout. Must be called
+// with the mutex held.
+func (m *DialManager) sweep(now time.Time) {
+	for address, dc := range m.conns {
+		if now.Sub(dc.lastUsed) > m.config.IdleTimeout {
+			dc.conn.Close()
+			delete(m.conns, address)
+			m.evictions++
+		}
+	}
+	m.lastSweep = now
+}
+
+// evictOldest closes the least recently used socket. Must be called with
+// the mutex held.
+func (m *DialManager) evictOldest() {
+	var oldest string
+	var oldestUsed time.Time
+	for address, dc := range m.conns {
+		if oldest == "" || dc.lastUsed.Before(oldestUsed) {
+			oldest, oldestUsed = address, dc.lastUsed
+		}
+	}
+	if dc, exists := m.conns[oldest]; exists {
+		dc.conn.Close()
+		delete(m.conns, oldest)
+		m.evictions++
+	}
+}
+
+// Stats returns the pool counters
+func (m *DialManager) Stats() DialManagerStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return DialManagerStats{
+		Dials:     m.dials,
+		Reuses:    m.reuses,
+		Evictions: m.evictions,
+		Open:      len(m.conns),
+	}
+}
+
+// Metrics returns the pool's link metrics
+func (m *DialManager) Metrics() Metrics {
+	return m.metrics
+}
+
+// Close closes every pooled socket; later sends fail
+func (m *DialManager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	for address, dc := range m.conns {
+		dc.conn.Close()
+		delete(m.conns, address)
+	}
+	return nil
+}
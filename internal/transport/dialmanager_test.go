@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestDialManager_Reuse(t *testing.T) {
+	manager := NewDialManager(nil)
+	defer manager.Close()
+
+	node := listenLoopback(t, "udp4", "127.0.0.1")
+	defer node.Close()
+	node.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var sources []string
+	for i := 0; i < 3; i++ {
+		ping := &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, uint32(i+1))}
+		if err := manager.SendMessage(node.LocalAddr().String(), ping); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		n, from, err := node.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := usrp.Parse(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq := usrp.HeaderOf(msg).Seq; seq != uint32(i+1) {
+			t.Errorf("Expected the caller's seq %d, got %d", i+1, seq)
+		}
+		sources = append(sources, from.String())
+	}
+
+	// Every packet leaves from the same socket
+	if sources[0] != sources[1] || sources[1] != sources[2] {
+		t.Errorf("Expected one source port, got %v", sources)
+	}
+	stats := manager.Stats()
+	if stats.Dials != 1 || stats.Reuses != 2 || stats.Open != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if out := manager.Metrics().Snapshot().PacketsOut; out != 3 {
+		t.Errorf("Expected 3 packets out, got %d", out)
+	}
+}
+
+func TestDialManager_IdleCleanup(t *testing.T) {
+	manager := NewDialManager(&DialManagerConfig{IdleTimeout: 50 * time.Millisecond})
+	defer manager.Close()
+
+	first, err := manager.Conn("127.0.0.1:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Touching another destination sweeps the idle socket
+	if _, err := manager.Conn("127.0.0.1:10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Write([]byte{0}); err == nil {
+		t.Error("Expected the idle socket to be closed")
+	}
+	if stats := manager.Stats(); stats.Evictions != 1 || stats.Open != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestDialManager_MaxConns(t *testing.T) {
+	manager := NewDialManager(&DialManagerConfig{MaxConns: 2})
+	defer manager.Close()
+
+	for _, address := range []string{"127.0.0.1:9", "127.0.0.1:10", "127.0.0.1:9", "127.0.0.1:11"} {
+		if _, err := manager.Conn(address); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// :10 was least recently used when :11 needed room
+	manager.mutex.Lock()
+	_, kept := manager.conns["127.0.0.1:9"]
+	_, evicted := manager.conns["127.0.0.1:10"]
+	manager.mutex.Unlock()
+	if !kept || evicted {
+		t.Error("Expected the least recently used socket to be evicted")
+	}
+	if stats := manager.Stats(); stats.Open != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestDialManager_Close(t *testing.T) {
+	manager := NewDialManager(nil)
+	conn, err := manager.Conn("127.0.0.1:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Close()
+
+	if _, err := conn.Write([]byte{0}); err == nil {
+		t.Error("Expected pooled sockets to be closed")
+	}
+	if err := manager.Send("127.0.0.1:9", []byte{0}); err == nil {
+		t.Error("Expected send after close to fail")
+	}
+	if _, err := manager.Conn("not an address"); err == nil {
+		t.Error("Expected an error from a closed manager")
+	}
+}
+
+func TestDialManager_BadAddress(t *testing.T) {
+	manager := NewDialManager(nil)
+	defer manager.Close()
+
+	if err := manager.Send("missing-port", []byte{0}); err == nil {
+		t.Error("Expected an unresolvable address to fail")
+	}
+	if errors := manager.Metrics().Snapshot().Errors; errors != 1 {
+		t.Errorf("Expected the failed dial to be counted, got %d", errors)
+	}
+}
@@ -0,0 +1,517 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/pion/dtls/v3"
+)
+
+// DTLSConnection implements Connection over DTLS, keeping UDP's datagram
+// semantics (one USRP packet per record) while encrypting the link.
+//
+// Like TCPConnection it is point to point: with a RemoteAddr it dials out and
+// redials with backoff when the session fails, otherwise it listens on
+// LocalAddr and talks to the most recently accepted peer. Link state changes
+// are reported through OnStateChange.
+type DTLSConnection struct {
+	linkState
+	interceptors
+	sendQueue
+	handlerSet
+
+	config     *ConnectionConfig
+	localAddr  *net.UDPAddr
+	remoteAddr *net.UDPAddr
+	dtlsConfig *dtls.Config
+	acl        *ACL // Filter for accepted peers (nil = accept all)
+	metrics    Metrics
+
+	listener net.Listener
+	session  *dtls.Conn // Current peer session (nil when disconnected)
+	peer     net.Addr
+	sessMu   sync.Mutex
+	accepted chan struct{} // Signalled when the listener installs a session
+
+	sequenceNum uint32
+	seqMutex    sync.Mutex
+	writeMutex  sync.Mutex // Serializes write deadlines
+	closed      bool
+	closeMutex  sync.Mutex
+}
+
+// NewDTLSConnection creates a new DTLS connection. config.TLS must be set.
+func NewDTLSConnection(config *ConnectionConfig) (*DTLSConnection, error) {
+	if config == nil || config.TLS == nil {
+		return nil, fmt.Errorf("DTLS requires a TLS configuration")
+	}
+
+	if err := config.IPVersion.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SendQueue.validate(); err != nil {
+		return nil, fmt.Errorf("invalid send queue config: %w", err)
+	}
+
+	localAddr, err := net.ResolveUDPAddr(config.IPVersion.network("udp"), config.LocalAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local address: %w", err)
+	}
+
+	acl, err := NewACL(config.ACL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acl config: %w", err)
+	}
+
+	dc := &DTLSConnection{
+		config:    config,
+		acl:       acl,
+		metrics:   metricsOrDefault(config.Metrics),
+		localAddr: localAddr,
+		accepted:  make(chan struct{}, 1),
+	}
+
+	remoteHost := ""
+	if config.RemoteAddr != "" {
+		dc.remoteAddr, err = resolveUDPRemote(config.RemoteAddr, config.IPVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve remote address: %w", err)
+		}
+		remoteHost, _, _ = net.SplitHostPort(config.RemoteAddr)
+	}
+
+	dc.dtlsConfig, err = config.TLS.DTLS(remoteHost, dc.remoteAddr == nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DTLS config: %w", err)
+	}
+
+	return dc, nil
+}
+
+// Connect performs the DTLS handshake with the remote address, or starts
+// listening when no remote address is configured. Socket tuning options
+// apply to dialed sessions only; the listener uses OS defaults.
+func (dc *DTLSConnection) Connect() error {
+	dc.closeMutex.Lock()
+	defer dc.closeMutex.Unlock()
+
+	if dc.closed {
+		return fmt.Errorf("connection is closed")
+	}
+
+	if dc.remoteAddr != nil {
+		return dc.dial()
+	}
+
+	network := bindNetwork("udp", dc.localAddr.IP, nil, dc.config.IPVersion)
+	listener, err := dtls.Listen(network, dc.localAddr, dc.dtlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to listen on DTLS: %w", err)
+	}
+	dc.listener = listener
+	dc.localAddr = listener.Addr().(*net.UDPAddr)
+	go dc.acceptLoop()
+	return nil
+}
+
+// handshakeTimeout bounds a DTLS handshake
+func (dc *DTLSConnection) handshakeTimeout() time.Duration {
+	if dc.config.WriteTimeout > 0 {
+		return dc.config.WriteTimeout
+	}
+	return 5 * time.Second
+}
+
+// dial opens a new session to the remote address
+func (dc *DTLSConnection) dial() error {
+	lc := net.ListenConfig{Control: socketControl(dc.config)}
+	network := bindNetwork("udp", dc.localAddr.IP, dc.remoteAddr.IP, dc.config.IPVersion)
+	packetConn, err := lc.ListenPacket(context.Background(), network, dc.localAddr.String())
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	pconn := packetConn.(*net.UDPConn)
+	if err := applyBuffers(pconn, dc.config); err != nil {
+		pconn.Close()
+		return err
+	}
+
+	session, err := dtls.Client(pconn, dc.remoteAddr, dc.dtlsConfig)
+	if err != nil {
+		pconn.Close()
+		return fmt.Errorf("failed to create DTLS client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dc.handshakeTimeout())
+	defer cancel()
+	if err := session.HandshakeContext(ctx); err != nil {
+		session.Close()
+		return fmt.Errorf("DTLS handshake with %s failed: %w", dc.remoteAddr, err)
+	}
+
+	dc.setSession(session)
+	dc.up()
+	return nil
+}
+
+// acceptLoop installs each new peer as the current session
+func (dc *DTLSConnection) acceptLoop() {
+	for {
+		conn, err := dc.listener.Accept()
+		if err != nil {
+			if dc.isClosed() {
+				return
+			}
+			continue
+		}
+
+		// pion/dtls completes the handshake lazily, so a rejected peer is
+		// dropped before any cryptographic work
+		if !dc.acl.Permit(conn.RemoteAddr()) {
+			dc.metrics.Drop()
+			conn.Close()
+			continue
+		}
+
+		session := conn.(*dtls.Conn)
+		ctx, cancel := context.WithTimeout(context.Background(), dc.handshakeTimeout())
+		err = session.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			session.Close()
+			continue
+		}
+
+		dc.setSession(session)
+		dc.up()
+		select {
+		case dc.accepted <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setSession replaces the current session, closing any previous one
+func (dc *DTLSConnection) setSession(session *dtls.Conn) {
+	dc.sessMu.Lock()
+	defer dc.sessMu.Unlock()
+
+	if dc.session != nil {
+		dc.session.Close()
+	}
+	dc.session = session
+	dc.peer = session.RemoteAddr()
+}
+
+// dropSession closes the current session if it is still session, marking
+// the link lost because of err
+func (dc *DTLSConnection) dropSession(session *dtls.Conn, err error) {
+	dc.sessMu.Lock()
+	dropped := dc.session == session && session != nil
+	if dropped {
+		dc.session.Close()
+		dc.session = nil
+	}
+	dc.sessMu.Unlock()
+
+	if dropped && !dc.isClosed() {
+		dc.set(StateLost, err)
+	}
+}
+
+func (dc *DTLSConnection) currentSession() *dtls.Conn {
+	dc.sessMu.Lock()
+	defer dc.sessMu.Unlock()
+	return dc.session
+}
+
+// SendMessageAsync queues a USRP message for sending and returns without
+// waiting on the network. msg must not be modified after the call.
+func (dc *DTLSConnection) SendMessageAsync(msg usrp.Message) error {
+	return dc.sendQueue.push(msg, dc.config.SendQueue, dc.SendMessage)
+}
+
+// SendMessage sends a USRP message as one DTLS record, bounded by
+// WriteTimeout
+func (dc *DTLSConnection) SendMessage(msg usrp.Message) error {
+	return dc.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext sends a USRP message as one DTLS record, giving up when
+// ctx is cancelled or its deadline (else WriteTimeout) passes
+func (dc *DTLSConnection) SendMessageContext(ctx context.Context, msg usrp.Message) error {
+	session := dc.currentSession()
+	if session == nil {
+		return fmt.Errorf("connection not established")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Validate message
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("message validation failed: %w", err)
+	}
+
+	// Set sequence number
+	dc.seqMutex.Lock()
+	dc.sequenceNum++
+	seq := dc.sequenceNum
+	dc.seqMutex.Unlock()
+	if header := usrp.HeaderOf(msg); header != nil {
+		header.Seq = seq
+	}
+
+	return dc.sendChain(msg, func(msg usrp.Message) error {
+		return contextError(ctx, dc.write(ctx, session, msg))
+	})
+}
+
+// write marshals msg and sends it as one record on session
+func (dc *DTLSConnection) write(ctx context.Context, session *dtls.Conn, msg usrp.Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	dc.writeMutex.Lock()
+	defer dc.writeMutex.Unlock()
+	release, err := bindContext(ctx, dc.config.WriteTimeout, session.SetWriteDeadline)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Datagrams are independent, so a failed write degrades the link
+	// rather than ending the session
+	if _, err := session.Write(data); err != nil {
+		dc.metrics.Error()
+		dc.set(StateDegraded, err)
+		return fmt.Errorf("failed to send DTLS record: %w", err)
+	}
+	dc.metrics.PacketOut(len(data))
+	dc.healthy()
+
+	return nil
+}
+
+// ReceiveMessage receives and parses a USRP message from the session,
+// bounded by ReadTimeout
+func (dc *DTLSConnection) ReceiveMessage() (usrp.Message, error) {
+	return dc.ReceiveMessageContext(context.Background())
+}
+
+// ReceiveMessageContext receives and parses a USRP message from the
+// session, giving up when ctx is cancelled or its deadline (else
+// ReadTimeout) passes. A listening connection waits for its first peer
+// under the same bound.
+func (dc *DTLSConnection) ReceiveMessageContext(ctx context.Context) (usrp.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	session := dc.currentSession()
+	if session == nil {
+		if dc.listener == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+		var expired <-chan time.Time
+		if deadline := deadlineFor(ctx, dc.config.ReadTimeout); !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-expired:
+			return nil, fmt.Errorf("no DTLS peer before deadline: %w", os.ErrDeadlineExceeded)
+		case <-dc.accepted:
+		}
+		if session = dc.currentSession(); session == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+	}
+
+	release, err := bindContext(ctx, dc.config.ReadTimeout, session.SetReadDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rx, err := dc.Receive()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return rx.Message, nil
+}
+
+// Receive receives and parses a USRP message from the session along with its
+// source address, arrival time, and size. A listening connection waits for
+// its first peer.
+func (dc *DTLSConnection) Receive() (*usrp.Received, error) {
+	session := dc.currentSession()
+	if session == nil {
+		if dc.listener == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+		<-dc.accepted
+		if session = dc.currentSession(); session == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+	}
+
+	buffer := make([]byte, usrp.CurrentLimits().MaxPacketSize)
+	n, err := session.Read(buffer)
+	if err != nil {
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			dc.metrics.Error()
+			dc.dropSession(session, err)
+		}
+		return nil, fmt.Errorf("failed to read DTLS record: %w", err)
+	}
+	dc.metrics.PacketIn(n)
+
+	rx, err := usrp.ParseReceived(buffer[:n], session.RemoteAddr(), time.Now())
+	if err != nil {
+		dc.metrics.Drop()
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	if err := dc.receiveChain(rx); err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
+
+// Start begins the message processing loop. Dialed connections redial with
+// exponential backoff when the session fails; listening connections wait
+// for the next peer.
+func (dc *DTLSConnection) Start(ctx context.Context) error {
+	if dc.currentSession() == nil && dc.listener == nil {
+		return fmt.Errorf("connection not established")
+	}
+
+	dc.startWorkers(ctx, dc.config, dc.metrics)
+	backoff := backoffFor(dc.config)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		session := dc.currentSession()
+		if session == nil {
+			if dc.isClosed() {
+				return fmt.Errorf("connection is closed")
+			}
+			if dc.listener != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-dc.accepted:
+				case <-time.After(time.Second):
+				}
+			} else if err := dc.dial(); err != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff.Next()):
+				}
+			} else {
+				backoff.Reset()
+			}
+			continue
+		}
+
+		// Set read timeout
+		if err := session.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			dc.dropSession(session, err)
+			continue
+		}
+
+		rx, err := dc.Receive()
+		if err != nil {
+			// Timeouts just poll the context again; other errors drop the
+			// session and reconnect on the next iteration
+			continue
+		}
+		dc.dispatch(rx.Message)
+	}
+}
+
+func (dc *DTLSConnection) isClosed() bool {
+	dc.closeMutex.Lock()
+	defer dc.closeMutex.Unlock()
+	return dc.closed
+}
+
+// Close closes the session and listener
+func (dc *DTLSConnection) Close() error {
+	dc.closeMutex.Lock()
+	if dc.closed {
+		dc.closeMutex.Unlock()
+		return nil
+	}
+	dc.closed = true
+	dc.closeMutex.Unlock()
+	dc.sendQueue.close()
+
+	var err error
+	if dc.listener != nil {
+		err = dc.listener.Close()
+	}
+	dc.sessMu.Lock()
+	if dc.session != nil {
+		dc.session.Close()
+		dc.session = nil
+	}
+	dc.sessMu.Unlock()
+
+	dc.set(StateDisconnected, nil)
+	return err
+}
+
+// Metrics returns the connection's link metrics
+func (dc *DTLSConnection) Metrics() Metrics {
+	return dc.metrics
+}
+
+// ACLStats returns the ACL counters, or zero values when no ACL is configured
+func (dc *DTLSConnection) ACLStats() ACLStats {
+	return dc.acl.Stats()
+}
+
+// LocalAddr returns the local network address
+func (dc *DTLSConnection) LocalAddr() net.Addr {
+	if session := dc.currentSession(); session != nil && dc.listener == nil {
+		return session.LocalAddr()
+	}
+	if dc.listener != nil {
+		return dc.listener.Addr()
+	}
+	return dc.localAddr
+}
+
+// RemoteAddr returns the address of the current peer
+func (dc *DTLSConnection) RemoteAddr() net.Addr {
+	dc.sessMu.Lock()
+	defer dc.sessMu.Unlock()
+
+	if dc.peer != nil {
+		return dc.peer
+	}
+	if dc.remoteAddr != nil {
+		return dc.remoteAddr
+	}
+	return nil
+}
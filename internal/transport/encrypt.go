@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrDecrypt is returned for packets that fail authentication under the
+// pre-shared key: corrupted, forged, or sealed with a different key
+var ErrDecrypt = errors.New("transport: packet failed decryption")
+
+// EncryptionConfig holds pre-shared key settings for encrypted datagrams.
+// This is not amateur-legal; use it only for private deployments and
+// router-to-router backhaul.
+type EncryptionConfig struct {
+	Key string `json:"key"` // Hex-encoded AES key of 16, 24 or 32 bytes
+}
+
+// EncryptionStats holds packet cipher counters
+type EncryptionStats struct {
+	Sealed   uint64 `json:"sealed"`
+	Opened   uint64 `json:"opened"`
+	Rejected uint64 `json:"rejected"` // Packets that failed authentication
+}
+
+// PacketCipher encrypts whole datagrams with AES-GCM. Each sealed packet is
+// a random 12-byte nonce followed by the ciphertext and 16-byte tag.
+// Random nonces stay safe for about 2^32 packets per key, over two years of
+// continuous voice at 50 packets a second; rotate keys well before that.
+// It does not stop replays; pair it with a Deduper.
+type PacketCipher struct {
+	aead     cipher.AEAD
+	sealed   uint64
+	opened   uint64
+	rejected uint64
+}
+
+// NewPacketCipher creates a cipher from a pre-shared key. A nil config
+// returns nil, which Seal and Open treat as pass-through.
+func NewPacketCipher(config *EncryptionConfig) (*PacketCipher, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be hex: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES-GCM: %w", err)
+	}
+	return &PacketCipher{aead: aead}, nil
+}
+
+// Overhead is the number of bytes Seal adds to a packet
+func (c *PacketCipher) Overhead() int {
+	if c == nil {
+		return 0
+	}
+	return c.aead.NonceSize() + c.aead.Overhead()
+}
+
+// Seal encrypts a packet under a fresh random nonce
+func (c *PacketCipher) Seal(packet []byte) []byte {
+	if c == nil {
+		return packet
+	}
+
+	out := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(packet)+c.aead.Overhead())
+	if _, err := rand.Read(out); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(fmt.Sprintf("transport: failed to generate nonce: %v", err))
+	}
+	atomic.AddUint64(&c.sealed, 1)
+	return c.aead.Seal(out, out, packet, nil)
+}
+
+// Open authenticates and decrypts a sealed packet
+func (c *PacketCipher) Open(packet []byte) ([]byte, error) {
+	if c == nil {
+		return packet, nil
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(packet) < nonceSize+c.aead.Overhead() {
+		atomic.AddUint64(&c.rejected, 1)
+		return nil, ErrDecrypt
+	}
+	plaintext, err := c.aead.Open(nil, packet[:nonceSize], packet[nonceSize:], nil)
+	if err != nil {
+		atomic.AddUint64(&c.rejected, 1)
+		return nil, ErrDecrypt
+	}
+	atomic.AddUint64(&c.opened, 1)
+	return plaintext, nil
+}
+
+// Stats returns the cipher's counters
+func (c *PacketCipher) Stats() EncryptionStats {
+	if c == nil {
+		return EncryptionStats{}
+	}
+	return EncryptionStats{
+		Sealed:   atomic.LoadUint64(&c.sealed),
+		Opened:   atomic.LoadUint64(&c.opened),
+		Rejected: atomic.LoadUint64(&c.rejected),
+	}
+}
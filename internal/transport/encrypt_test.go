@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestPacketCipher_RoundTrip(t *testing.T) {
+	c, err := NewPacketCipher(&EncryptionConfig{Key: testKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := []byte("USRP voice frame")
+	sealed := c.Seal(packet)
+	if len(sealed) != len(packet)+c.Overhead() {
+		t.Fatalf("sealed length = %d, want %d", len(sealed), len(packet)+c.Overhead())
+	}
+	if bytes.Contains(sealed, packet) {
+		t.Fatal("sealed packet contains the plaintext")
+	}
+	if again := c.Seal(packet); bytes.Equal(again, sealed) {
+		t.Fatal("two seals of one packet are identical; nonce reused")
+	}
+
+	opened, err := c.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, packet) {
+		t.Fatalf("opened %q, want %q", opened, packet)
+	}
+
+	// Any flipped bit fails authentication
+	sealed[len(sealed)-1] ^= 1
+	if _, err := c.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("tampered packet: err = %v, want ErrDecrypt", err)
+	}
+	if _, err := c.Open(sealed[:5]); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("short packet: err = %v, want ErrDecrypt", err)
+	}
+
+	other, err := NewPacketCipher(&EncryptionConfig{Key: testKey[:32]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open(c.Seal(packet)); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong key: err = %v, want ErrDecrypt", err)
+	}
+
+	if stats := c.Stats(); stats.Sealed != 3 || stats.Opened != 1 || stats.Rejected != 2 {
+		t.Fatalf("stats = %+v, want 3 sealed, 1 opened, 2 rejected", stats)
+	}
+}
+
+func TestNewPacketCipher(t *testing.T) {
+	if c, err := NewPacketCipher(nil); c != nil || err != nil {
+		t.Fatalf("nil config = %v, %v; want disabled", c, err)
+	}
+	var disabled *PacketCipher
+	if got := disabled.Seal([]byte("x")); string(got) != "x" {
+		t.Fatal("disabled cipher changed the packet")
+	}
+
+	for _, key := range []string{"", "zz", "0011", testKey + "00"} {
+		if _, err := NewPacketCipher(&EncryptionConfig{Key: key}); err == nil {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+}
+
+func TestUDPConnection_Encryption(t *testing.T) {
+	receiver, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:   "127.0.0.1:0",
+		ReadTimeout: 2 * time.Second,
+		Encryption:  &EncryptionConfig{Key: testKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	// A plaintext sender is dropped without becoming the remote address
+	plain, err := net.Dial("udp", receiver.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Write(ping)
+	if _, err := receiver.ReceiveMessage(); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("plaintext packet: err = %v, want ErrDecrypt", err)
+	}
+	if receiver.remoteAddr != nil {
+		t.Fatal("plaintext sender became the remote address")
+	}
+
+	sender, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:  "127.0.0.1:0",
+		RemoteAddr: receiver.LocalAddr().String(),
+		Encryption: &EncryptionConfig{Key: testKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	text := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("backhaul")}
+	if err := sender.SendMessage(text); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := receiver.ReceiveMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := msg.(*usrp.TextMessage); !ok || string(got.Text) != "backhaul" {
+		t.Fatalf("received %#v, want the text message", msg)
+	}
+	if stats := receiver.EncryptionStats(); stats.Opened != 1 || stats.Rejected != 1 {
+		t.Fatalf("stats = %+v, want 1 opened, 1 rejected", stats)
+	}
+}
+
+func TestServer_Encryption(t *testing.T) {
+	server := NewServer(&ServerConfig{ListenAddr: "127.0.0.1:0", Encryption: &EncryptionConfig{Key: testKey}})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	received := make(chan usrp.PacketType, 4)
+	server.RegisterHandler(usrp.USRP_TYPE_PING, func(p *Peer, rx *usrp.Received) error {
+		received <- rx.Type()
+		return p.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	node, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:   "127.0.0.1:0",
+		RemoteAddr:  server.LocalAddr().String(),
+		ReadTimeout: 2 * time.Second,
+		Encryption:  &EncryptionConfig{Key: testKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	// Plaintext never creates a peer
+	plain, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Write(ping)
+
+	if err := node.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not receive the encrypted ping")
+	}
+	if _, err := node.ReceiveMessage(); err != nil {
+		t.Fatalf("encrypted reply: %v", err)
+	}
+
+	if peers := server.Peers(); len(peers) != 1 {
+		t.Fatalf("server has %d peers, want 1", len(peers))
+	}
+	if stats := server.EncryptionStats(); stats.Rejected != 1 {
+		t.Fatalf("stats = %+v, want 1 rejected", stats)
+	}
+}
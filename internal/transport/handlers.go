@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// defaultHandlerQueue is the worker pool queue length per worker when
+// HandlerQueue is unset
+const defaultHandlerQueue = 16
+
+// handlerSet holds a connection's message handlers and dispatches received
+// messages to them. Embed it to provide RegisterHandler, UnregisterHandler
+// and SetDefaultHandler.
+type handlerSet struct {
+	handlerMutex sync.RWMutex
+	handlers     map[usrp.PacketType]MessageHandler
+	fallback     MessageHandler
+	work         chan usrp.Message // Worker pool queue (nil = a goroutine per message)
+	workMetrics  Metrics           // Counts messages the full pool drops
+}
+
+// RegisterHandler registers a handler function for a specific packet type
+func (hs *handlerSet) RegisterHandler(packetType usrp.PacketType, handler MessageHandler) {
+	hs.handlerMutex.Lock()
+	defer hs.handlerMutex.Unlock()
+	if hs.handlers == nil {
+		hs.handlers = make(map[usrp.PacketType]MessageHandler)
+	}
+	hs.handlers[packetType] = handler
+}
+
+// UnregisterHandler removes the handler for a packet type; its messages go
+// to the default handler, if any
+func (hs *handlerSet) UnregisterHandler(packetType usrp.PacketType) {
+	hs.handlerMutex.Lock()
+	defer hs.handlerMutex.Unlock()
+	delete(hs.handlers, packetType)
+}
+
+// SetDefaultHandler sets a catch-all handler for packet types without a
+// registered handler (nil = ignore them)
+func (hs *handlerSet) SetDefaultHandler(handler MessageHandler) {
+	hs.handlerMutex.Lock()
+	defer hs.handlerMutex.Unlock()
+	hs.fallback = handler
+}
+
+// handle runs the handler for a message, if any
+func (hs *handlerSet) handle(msg usrp.Message) {
+	hs.handlerMutex.RLock()
+	handler, exists := hs.handlers[msg.GetType()]
+	if !exists {
+		handler = hs.fallback
+	}
+	hs.handlerMutex.RUnlock()
+
+	if handler != nil {
+		if err := handler(msg); err != nil {
+			log.Printf("USRP handler error: %v", err)
+		}
+	}
+}
+
+// startWorkers starts config.HandlerWorkers handler goroutines for the life
+// of ctx. Without workers configured, dispatch keeps starting a goroutine
+// per message.
+func (hs *handlerSet) startWorkers(ctx context.Context, config *ConnectionConfig, metrics Metrics) {
+	if config.HandlerWorkers <= 0 {
+		return
+	}
+	size := config.HandlerQueue
+	if size <= 0 {
+		size = config.HandlerWorkers * defaultHandlerQueue
+	}
+
+	work := make(chan usrp.Message, size)
+	for i := 0; i < config.HandlerWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-work:
+					hs.handle(msg)
+				}
+			}
+		}()
+	}
+
+	hs.handlerMutex.Lock()
+	hs.work = work
+	hs.workMetrics = metrics
+	hs.handlerMutex.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		hs.handlerMutex.Lock()
+		defer hs.handlerMutex.Unlock()
+		if hs.work == work {
+			hs.work = nil
+		}
+	})
+}
+
+// dispatch hands a message to its handler without blocking the receive
+// loop: on the worker pool when one is running, dropping the message if
+// the pool is backed up, else in a new goroutine
+func (hs *handlerSet) dispatch(msg usrp.Message) {
+	hs.handlerMutex.RLock()
+	work, metrics := hs.work, hs.workMetrics
+	hs.handlerMutex.RUnlock()
+
+	if work == nil {
+		go hs.handle(msg)
+		return
+	}
+	select {
+	case work <- msg:
+	default:
+		metrics.Drop()
+	}
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestHandlerSet_DefaultAndUnregister(t *testing.T) {
+	var hs handlerSet
+	var got []string
+	hs.RegisterHandler(usrp.USRP_TYPE_PING, func(msg usrp.Message) error {
+		got = append(got, "ping")
+		return nil
+	})
+	ping := &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}
+	text := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 2), Text: []byte("hi")}
+
+	// No default handler: unhandled types are ignored
+	hs.handle(ping)
+	hs.handle(text)
+
+	hs.SetDefaultHandler(func(msg usrp.Message) error {
+		got = append(got, "default")
+		return nil
+	})
+	hs.handle(text)
+
+	hs.UnregisterHandler(usrp.USRP_TYPE_PING)
+	hs.handle(ping)
+
+	hs.SetDefaultHandler(nil)
+	hs.handle(ping)
+
+	want := []string{"ping", "default", "default"}
+	if len(got) != len(want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("handled %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHandlerSet_WorkerPoolDropsWhenFull(t *testing.T) {
+	var hs handlerSet
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handled := make(chan struct{}, 10)
+	hs.RegisterHandler(usrp.USRP_TYPE_PING, func(msg usrp.Message) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		handled <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := NewAtomicMetrics()
+	hs.startWorkers(ctx, &ConnectionConfig{HandlerWorkers: 1, HandlerQueue: 2}, metrics)
+
+	ping := &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}
+	hs.dispatch(ping)
+	<-started // The worker is busy; the next two fill the queue
+	for i := 0; i < 5; i++ {
+		hs.dispatch(ping)
+	}
+	if drops := metrics.Snapshot().Drops; drops != 3 {
+		t.Fatalf("drops = %d, want 3", drops)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("handled %d messages, want 3", i)
+		}
+	}
+	select {
+	case <-handled:
+		t.Fatal("dropped message was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUDPConnection_HandlerWorkers(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+	receiver.config.HandlerWorkers = 2
+
+	handled := make(chan usrp.PacketType, 10)
+	receiver.SetDefaultHandler(func(msg usrp.Message) error {
+		handled <- msg.GetType()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go receiver.Start(ctx)
+
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case packetType := <-handled:
+		if packetType != usrp.USRP_TYPE_PING {
+			t.Fatalf("default handler got type %d, want PING", packetType)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("default handler not called")
+	}
+}
@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// ErrIntercepted is returned by Receive when a receive interceptor drops a
+// message by not calling next
+var ErrIntercepted = errors.New("transport: message dropped by interceptor")
+
+// Interceptor is one step of a send or receive chain. It may inspect or
+// modify msg, pass a different message to next, or drop the message by
+// returning without calling next. Errors it returns end the chain.
+type Interceptor func(msg usrp.Message, next func(usrp.Message) error) error
+
+// interceptors holds a connection's send and receive chains. Embed it to
+// provide InterceptSend and InterceptReceive.
+type interceptors struct {
+	mutex   sync.RWMutex
+	send    []Interceptor
+	receive []Interceptor
+}
+
+// InterceptSend appends an interceptor to the send chain. Send interceptors
+// run in registration order after the sequence number is assigned, so they
+// see (and may rewrite) the header that goes on the wire.
+func (ic *interceptors) InterceptSend(interceptor Interceptor) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+	ic.send = append(ic.send, interceptor)
+}
+
+// InterceptReceive appends an interceptor to the receive chain. Receive
+// interceptors run in registration order on every parsed message, before
+// Receive returns it or Start hands it to a handler.
+func (ic *interceptors) InterceptReceive(interceptor Interceptor) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+	ic.receive = append(ic.receive, interceptor)
+}
+
+// sendChain runs msg through the send interceptors and then final
+func (ic *interceptors) sendChain(msg usrp.Message, final func(usrp.Message) error) error {
+	ic.mutex.RLock()
+	chain := ic.send
+	ic.mutex.RUnlock()
+	return runChain(chain, msg, final)
+}
+
+// receiveChain runs a received message through the receive interceptors,
+// updating rx with the message that comes out of the chain
+func (ic *interceptors) receiveChain(rx *usrp.Received) error {
+	ic.mutex.RLock()
+	chain := ic.receive
+	ic.mutex.RUnlock()
+
+	if len(chain) == 0 {
+		return nil
+	}
+
+	delivered := false
+	err := runChain(chain, rx.Message, func(msg usrp.Message) error {
+		rx.Message = msg
+		delivered = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !delivered {
+		return ErrIntercepted
+	}
+	return nil
+}
+
+// runChain calls chain[0] with a next function that continues down the
+// chain, ending in final
+func runChain(chain []Interceptor, msg usrp.Message, final func(usrp.Message) error) error {
+	if len(chain) == 0 {
+		return final(msg)
+	}
+	return chain[0](msg, func(next usrp.Message) error {
+		return runChain(chain[1:], next, final)
+	})
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func newUDPPair(t *testing.T) (receiver, sender *UDPConnection) {
+	t.Helper()
+
+	receiver, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { receiver.Close() })
+
+	sender, err = NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0", RemoteAddr: receiver.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender.Close() })
+
+	receiver.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	return receiver, sender
+}
+
+func TestInterceptors_Send(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+
+	var order []string
+	sender.InterceptSend(func(msg usrp.Message, next func(usrp.Message) error) error {
+		order = append(order, "outer")
+		// Sequence rewriting: the transport has already numbered the message
+		usrp.HeaderOf(msg).Seq += 1000
+		return next(msg)
+	})
+	sender.InterceptSend(func(msg usrp.Message, next func(usrp.Message) error) error {
+		order = append(order, "inner")
+		// Drop DTMF entirely
+		if msg.GetType() == usrp.USRP_TYPE_DTMF {
+			return nil
+		}
+		return next(msg)
+	})
+
+	if err := sender.SendMessage(&usrp.DTMFMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_DTMF, 0), Digit: '5'}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	rx, err := receiver.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx.Type() != usrp.USRP_TYPE_PING {
+		t.Fatalf("Expected the dropped DTMF to be skipped, got %v", rx.Type())
+	}
+	if seq := usrp.HeaderOf(rx.Message).Seq; seq != 1002 {
+		t.Errorf("Expected rewritten sequence 1002, got %d", seq)
+	}
+	if len(order) != 4 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("Unexpected interceptor order: %v", order)
+	}
+}
+
+func TestInterceptors_Receive(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+
+	// Replace text with a stamped copy; drop pings
+	receiver.InterceptReceive(func(msg usrp.Message, next func(usrp.Message) error) error {
+		switch m := msg.(type) {
+		case *usrp.PingMessage:
+			return nil
+		case *usrp.TextMessage:
+			return next(&usrp.TextMessage{Header: m.Header, Text: append([]byte("N0CALL: "), m.Text...)})
+		}
+		return next(msg)
+	})
+
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage(&usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := receiver.Receive(); !errors.Is(err, ErrIntercepted) {
+		t.Fatalf("Expected ErrIntercepted for the dropped ping, got %v", err)
+	}
+	rx, err := receiver.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(rx.Message.(*usrp.TextMessage).Text); text != "N0CALL: hello" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestInterceptors_Error(t *testing.T) {
+	_, sender := newUDPPair(t)
+
+	refused := errors.New("refused")
+	sender.InterceptSend(func(msg usrp.Message, next func(usrp.Message) error) error {
+		return refused
+	})
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); !errors.Is(err, refused) {
+		t.Errorf("Expected interceptor error, got %v", err)
+	}
+	if out := sender.Metrics().Snapshot().PacketsOut; out != 0 {
+		t.Errorf("Expected nothing sent, got %d packets", out)
+	}
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// LatePolicy decides what happens to packets that arrive after their slot
+// has already been played out
+type LatePolicy string
+
+const (
+	LateDrop LatePolicy = "drop" // Discard late packets (default)
+	LatePass LatePolicy = "pass" // Deliver late packets immediately, out of order
+)
+
+// jitterRestartGap is the sequence distance beyond which a packet is taken
+// as the peer restarting its counter rather than as late or lost
+const jitterRestartGap = 1000
+
+// JitterConfig holds configuration for a receive-side jitter buffer
+type JitterConfig struct {
+	Depth      int           `json:"depth"`       // Frames held before playout starts
+	MaxDepth   int           `json:"max_depth"`   // Frames held before the oldest is discarded
+	Interval   time.Duration `json:"interval"`    // Playout clock period
+	LatePolicy LatePolicy    `json:"late_policy"` // "drop" or "pass"
+}
+
+// DefaultJitterConfig returns a 60ms buffer on the 20ms USRP frame clock
+func DefaultJitterConfig() *JitterConfig {
+	return &JitterConfig{
+		Depth:      3,
+		MaxDepth:   12,
+		Interval:   20 * time.Millisecond,
+		LatePolicy: LateDrop,
+	}
+}
+
+// JitterStats holds jitter buffer counters
+type JitterStats struct {
+	Received   uint64 // Packets pushed
+	Released   uint64 // Packets played out in order
+	Reordered  uint64 // Packets that arrived after a later sequence number
+	Late       uint64 // Packets that arrived after their slot
+	Duplicates uint64 // Packets already buffered
+	Lost       uint64 // Sequence numbers skipped at playout
+	Overflows  uint64 // Packets discarded because the buffer was full
+	Buffered   int    // Packets currently held
+}
+
+type jitterEntry struct {
+	seq     uint32
+	msg     usrp.Message
+	arrival time.Time
+}
+
+// JitterBuffer reorders packets by sequence number and releases them on a
+// steady clock. Packets are held until Depth are buffered or the oldest has
+// waited Depth intervals, so a short stream still drains. It is safe for
+// concurrent use.
+type JitterBuffer struct {
+	config  *JitterConfig
+	entries []jitterEntry // Sorted by sequence number
+	next    uint32        // Next sequence number to release
+	started bool          // next is valid
+	stats   JitterStats
+	mutex   sync.Mutex
+}
+
+// NewJitterBuffer creates a jitter buffer. A nil config returns nil, which
+// callers treat as "disabled".
+func NewJitterBuffer(config *JitterConfig) (*JitterBuffer, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	defaults := DefaultJitterConfig()
+	cfg := *config
+	if cfg.Depth <= 0 {
+		cfg.Depth = defaults.Depth
+	}
+	if cfg.MaxDepth < cfg.Depth {
+		cfg.MaxDepth = cfg.Depth * 4
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	switch cfg.LatePolicy {
+	case "":
+		cfg.LatePolicy = LateDrop
+	case LateDrop, LatePass:
+	default:
+		return nil, fmt.Errorf("unknown late packet policy: %s", cfg.LatePolicy)
+	}
+
+	return &JitterBuffer{
+		config:  &cfg,
+		entries: make([]jitterEntry, 0, cfg.MaxDepth),
+	}, nil
+}
+
+// Interval returns the playout clock period
+func (jb *JitterBuffer) Interval() time.Duration {
+	return jb.config.Interval
+}
+
+// seqDiff returns a-b accounting for 32-bit wraparound
+func seqDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// Push adds a received packet. It returns the packet back when it is late
+// and the policy is LatePass, meaning the caller should deliver it now.
+func (jb *JitterBuffer) Push(msg usrp.Message, at time.Time) usrp.Message {
+	header := usrp.HeaderOf(msg)
+	if header == nil {
+		return msg
+	}
+	seq := header.Seq
+
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	jb.stats.Received++
+
+	if jb.started {
+		diff := seqDiff(seq, jb.next)
+		if diff < -jitterRestartGap || diff > jitterRestartGap {
+			// Peer restarted its sequence; what is left of the old stream
+			// cannot be ordered against the new one
+			jb.started = false
+			jb.entries = jb.entries[:0]
+		} else if diff < 0 {
+			jb.stats.Late++
+			if jb.config.LatePolicy == LatePass {
+				return msg
+			}
+			return nil
+		}
+	}
+
+	// Find the insertion point in sequence order
+	i := len(jb.entries)
+	for i > 0 && seqDiff(jb.entries[i-1].seq, seq) > 0 {
+		i--
+	}
+	if i > 0 && jb.entries[i-1].seq == seq {
+		jb.stats.Duplicates++
+		return nil
+	}
+
+	if i < len(jb.entries) {
+		jb.stats.Reordered++
+	}
+	jb.entries = append(jb.entries, jitterEntry{})
+	copy(jb.entries[i+1:], jb.entries[i:])
+	jb.entries[i] = jitterEntry{seq: seq, msg: msg, arrival: at}
+
+	// Discard the oldest packet so latency stays bounded
+	if len(jb.entries) > jb.config.MaxDepth {
+		jb.next = jb.entries[0].seq + 1
+		jb.started = true
+		jb.entries = jb.entries[1:]
+		jb.stats.Overflows++
+	}
+
+	return nil
+}
+
+// Pop releases the next packet for playout at time now, if one is due.
+// Call it once per Interval.
+func (jb *JitterBuffer) Pop(now time.Time) (usrp.Message, bool) {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	if len(jb.entries) == 0 {
+		return nil, false
+	}
+
+	head := jb.entries[0]
+	due := len(jb.entries) >= jb.config.Depth ||
+		now.Sub(head.arrival) >= time.Duration(jb.config.Depth)*jb.config.Interval
+	if !due {
+		return nil, false
+	}
+
+	if jb.started {
+		if gap := seqDiff(head.seq, jb.next); gap > 0 {
+			jb.stats.Lost += uint64(gap)
+		}
+	}
+	jb.entries = jb.entries[1:]
+	jb.next = head.seq + 1
+	jb.started = true
+	jb.stats.Released++
+
+	return head.msg, true
+}
+
+// Stats returns a copy of the current counters
+func (jb *JitterBuffer) Stats() JitterStats {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	stats := jb.stats
+	stats.Buffered = len(jb.entries)
+	return stats
+}
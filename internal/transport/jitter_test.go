@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func voiceSeq(seq uint32) *usrp.VoiceMessage {
+	return &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, seq)}
+}
+
+// drain pops every due packet, advancing a fake clock one interval per pop
+func drain(jb *JitterBuffer, now time.Time) ([]uint32, time.Time) {
+	var seqs []uint32
+	for i := 0; i < 100; i++ {
+		now = now.Add(jb.Interval())
+		if msg, ok := jb.Pop(now); ok {
+			seqs = append(seqs, usrp.HeaderOf(msg).Seq)
+		}
+	}
+	return seqs, now
+}
+
+func TestJitterBuffer_Reorder(t *testing.T) {
+	jb, err := NewJitterBuffer(DefaultJitterConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+
+	for _, seq := range []uint32{1, 3, 2, 5, 4, 4} {
+		jb.Push(voiceSeq(seq), start)
+	}
+
+	// Held until Depth frames are buffered
+	if _, ok := jb.Pop(start); !ok {
+		t.Fatal("Expected release once depth is reached")
+	}
+	seqs, _ := drain(jb, start)
+	want := []uint32{2, 3, 4, 5}
+	if len(seqs) != len(want) {
+		t.Fatalf("Released %v, want %v", seqs, want)
+	}
+	for i := range want {
+		if seqs[i] != want[i] {
+			t.Fatalf("Released %v, want %v", seqs, want)
+		}
+	}
+
+	stats := jb.Stats()
+	if stats.Reordered != 2 || stats.Duplicates != 1 || stats.Released != 5 || stats.Lost != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestJitterBuffer_LateAndLost(t *testing.T) {
+	tests := []struct {
+		policy    LatePolicy
+		wantLate  bool // Late packet handed back by Push
+		wantCount uint64
+	}{
+		{LateDrop, false, 1},
+		{LatePass, true, 1},
+	}
+
+	for _, tt := range tests {
+		jb, err := NewJitterBuffer(&JitterConfig{Depth: 1, LatePolicy: tt.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+
+		jb.Push(voiceSeq(10), now)
+		jb.Push(voiceSeq(13), now) // 11 and 12 never arrive in time
+		seqs, now := drain(jb, now)
+		if len(seqs) != 2 {
+			t.Fatalf("%s: released %v", tt.policy, seqs)
+		}
+
+		late := jb.Push(voiceSeq(11), now)
+		if (late != nil) != tt.wantLate {
+			t.Errorf("%s: late packet returned = %v, want %v", tt.policy, late != nil, tt.wantLate)
+		}
+
+		stats := jb.Stats()
+		if stats.Late != tt.wantCount || stats.Lost != 2 {
+			t.Errorf("%s: unexpected stats: %+v", tt.policy, stats)
+		}
+	}
+}
+
+func TestJitterBuffer_DrainAndOverflow(t *testing.T) {
+	jb, err := NewJitterBuffer(&JitterConfig{Depth: 3, MaxDepth: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// A single frame is released once it has waited Depth intervals
+	jb.Push(voiceSeq(1), now)
+	if _, ok := jb.Pop(now.Add(jb.Interval())); ok {
+		t.Error("Released a lone frame before it waited Depth intervals")
+	}
+	if _, ok := jb.Pop(now.Add(3 * jb.Interval())); !ok {
+		t.Error("Lone frame never drained")
+	}
+
+	// Overfilling discards the oldest frames
+	for seq := uint32(2); seq < 10; seq++ {
+		jb.Push(voiceSeq(seq), now)
+	}
+	stats := jb.Stats()
+	if stats.Buffered != 4 || stats.Overflows != 4 {
+		t.Errorf("Unexpected stats after overflow: %+v", stats)
+	}
+	if msg, ok := jb.Pop(now); !ok || usrp.HeaderOf(msg).Seq != 6 {
+		t.Errorf("Expected seq 6 after overflow, got %v", msg)
+	}
+
+	// A large jump is a sequence restart, not loss
+	jb.Push(voiceSeq(50000), now)
+	if stats := jb.Stats(); stats.Late != 0 || stats.Buffered != 1 {
+		t.Errorf("Unexpected stats after restart: %+v", stats)
+	}
+
+	if _, err := NewJitterBuffer(&JitterConfig{LatePolicy: "rewind"}); err == nil {
+		t.Error("Expected error for unknown late policy")
+	}
+	if jb, err := NewJitterBuffer(nil); jb != nil || err != nil {
+		t.Error("Expected nil buffer for nil config")
+	}
+}
+
+func TestUDPConnection_StartWithJitter(t *testing.T) {
+	config := &ConnectionConfig{LocalAddr: "127.0.0.1:0", Jitter: DefaultJitterConfig()}
+	receiver, err := NewUDPConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	var mutex sync.Mutex
+	var seqs []uint32
+	done := make(chan struct{})
+	receiver.RegisterHandler(usrp.USRP_TYPE_VOICE, func(msg usrp.Message) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		seqs = append(seqs, usrp.HeaderOf(msg).Seq)
+		if len(seqs) == 5 {
+			close(done)
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go receiver.Start(ctx)
+
+	// Raw socket so the sequence numbers are ours, sent out of order
+	raw, err := net.Dial("udp", receiver.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	for _, seq := range []uint32{1, 2, 4, 3, 5} {
+		data, err := voiceSeq(seq).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := raw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Malformed packets must not stop the loop
+	if _, err := raw.Write([]byte("junk")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for jitter buffer playout")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, seq := range seqs {
+		if seq != uint32(i+1) {
+			t.Fatalf("Playout order %v, want 1..5", seqs)
+		}
+	}
+	if stats := receiver.JitterStats(); stats.Reordered != 1 {
+		t.Errorf("Unexpected jitter stats: %+v", stats)
+	}
+}
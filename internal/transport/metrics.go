@@ -0,0 +1,316 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics records link activity for a transport. Implementations must be
+// safe for concurrent use; transports call them from their send and receive
+// paths.
+type Metrics interface {
+	PacketIn(bytes int)    // A packet arrived from the network
+	PacketOut(bytes int)   // A packet was written to the network
+	Error()                // A send or receive failed
+	Drop()                 // A received packet was discarded (malformed, filtered, limited, queue full)
+	RTT(rtt time.Duration) // A round-trip time sample
+	Snapshot() MetricsSnapshot
+}
+
+// MetricsSnapshot is a point-in-time copy of link metrics
+type MetricsSnapshot struct {
+	PacketsIn  uint64        `json:"packets_in"`
+	PacketsOut uint64        `json:"packets_out"`
+	BytesIn    uint64        `json:"bytes_in"`
+	BytesOut   uint64        `json:"bytes_out"`
+	Errors     uint64        `json:"errors"`
+	Drops      uint64        `json:"drops"`
+	RTT        time.Duration `json:"rtt"`         // Smoothed round-trip time (0 = no samples)
+	RTTSamples uint64        `json:"rtt_samples"` // Number of RTT samples recorded
+}
+
+// LinkHealth is the state of a link that keeps a connection up, such as a
+// Discord voice connection
+type LinkHealth struct {
+	Reconnects uint64 `json:"reconnects"`  // Times the connection was re-established
+	QueueDepth int    `json:"queue_depth"` // Frames waiting to be sent now
+}
+
+// HealthReporter is implemented by Metrics of links with a connection to
+// report on; the exporter adds their health to their counters
+type HealthReporter interface {
+	Health() LinkHealth
+}
+
+// LinkReport is a link's metrics and health, as one process reports them
+// to another
+type LinkReport struct {
+	MetricsSnapshot
+	LinkHealth
+}
+
+// AtomicMetrics is the default Metrics implementation, using atomic
+// counters. RTT is smoothed as in TCP (RFC 6298, alpha 1/8).
+type AtomicMetrics struct {
+	packetsIn  uint64
+	packetsOut uint64
+	bytesIn    uint64
+	bytesOut   uint64
+	errors     uint64
+	drops      uint64
+
+	rttMutex   sync.Mutex
+	rtt        time.Duration
+	rttSamples uint64
+}
+
+// NewAtomicMetrics creates an empty AtomicMetrics
+func NewAtomicMetrics() *AtomicMetrics {
+	return &AtomicMetrics{}
+}
+
+// metricsOrDefault returns m, or a new AtomicMetrics when m is nil
+func metricsOrDefault(m Metrics) Metrics {
+	if m == nil {
+		return NewAtomicMetrics()
+	}
+	return m
+}
+
+// PacketIn records a received packet
+func (m *AtomicMetrics) PacketIn(bytes int) {
+	atomic.AddUint64(&m.packetsIn, 1)
+	atomic.AddUint64(&m.bytesIn, uint64(bytes))
+}
+
+// PacketOut records a sent packet
+func (m *AtomicMetrics) PacketOut(bytes int) {
+	atomic.AddUint64(&m.packetsOut, 1)
+	atomic.AddUint64(&m.bytesOut, uint64(bytes))
+}
+
+// Error records a send or receive failure
+func (m *AtomicMetrics) Error() {
+	atomic.AddUint64(&m.errors, 1)
+}
+
+// Drop records a discarded packet
+func (m *AtomicMetrics) Drop() {
+	atomic.AddUint64(&m.drops, 1)
+}
+
+// RTT records a round-trip time sample
+func (m *AtomicMetrics) RTT(rtt time.Duration) {
+	m.rttMutex.Lock()
+	defer m.rttMutex.Unlock()
+
+	if m.rttSamples == 0 {
+		m.rtt = rtt
+	} else {
+		m.rtt += (rtt - m.rtt) / 8
+	}
+	m.rttSamples++
+}
+
+// Snapshot returns a copy of the counters
+func (m *AtomicMetrics) Snapshot() MetricsSnapshot {
+	m.rttMutex.Lock()
+	rtt, samples := m.rtt, m.rttSamples
+	m.rttMutex.Unlock()
+
+	return MetricsSnapshot{
+		PacketsIn:  atomic.LoadUint64(&m.packetsIn),
+		PacketsOut: atomic.LoadUint64(&m.packetsOut),
+		BytesIn:    atomic.LoadUint64(&m.bytesIn),
+		BytesOut:   atomic.LoadUint64(&m.bytesOut),
+		Errors:     atomic.LoadUint64(&m.errors),
+		Drops:      atomic.LoadUint64(&m.drops),
+		RTT:        rtt,
+		RTTSamples: samples,
+	}
+}
+
+// RemoteMetrics are the metrics of a link kept by another process, such as
+// the Discord bridge, as last polled from it. Recording does nothing; the
+// counts come only from Update.
+type RemoteMetrics struct {
+	report LinkReport
+	mutex  sync.Mutex
+}
+
+// NewRemoteMetrics creates RemoteMetrics with nothing polled yet
+func NewRemoteMetrics() *RemoteMetrics {
+	return &RemoteMetrics{}
+}
+
+// Update replaces the metrics with those last reported
+func (m *RemoteMetrics) Update(report LinkReport) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.report = report
+}
+
+func (m *RemoteMetrics) PacketIn(bytes int)    {}
+func (m *RemoteMetrics) PacketOut(bytes int)   {}
+func (m *RemoteMetrics) Error()                {}
+func (m *RemoteMetrics) Drop()                 {}
+func (m *RemoteMetrics) RTT(rtt time.Duration) {}
+
+// Snapshot returns the counters last reported
+func (m *RemoteMetrics) Snapshot() MetricsSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.report.MetricsSnapshot
+}
+
+// Health returns the health last reported
+func (m *RemoteMetrics) Health() LinkHealth {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.report.LinkHealth
+}
+
+// PrometheusExporter serves the metrics of named links in the Prometheus
+// text exposition format, without depending on the Prometheus client
+type PrometheusExporter struct {
+	namespace string
+	links     map[string]Metrics
+	mutex     sync.RWMutex
+}
+
+// NewPrometheusExporter creates an exporter whose metric names start with
+// namespace (e.g. "usrp" gives usrp_transport_packets_total)
+func NewPrometheusExporter(namespace string) *PrometheusExporter {
+	return &PrometheusExporter{
+		namespace: namespace,
+		links:     make(map[string]Metrics),
+	}
+}
+
+// Register exports m under the link label, replacing any previous link with
+// the same name
+func (e *PrometheusExporter) Register(link string, m Metrics) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.links[link] = m
+}
+
+// Unregister stops exporting a link
+func (e *PrometheusExporter) Unregister(link string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.links, link)
+}
+
+// Reports returns the metrics and health of every registered link
+func (e *PrometheusExporter) Reports() map[string]LinkReport {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	reports := make(map[string]LinkReport, len(e.links))
+	for name, m := range e.links {
+		report := LinkReport{MetricsSnapshot: m.Snapshot()}
+		if reporter, ok := m.(HealthReporter); ok {
+			report.LinkHealth = reporter.Health()
+		}
+		reports[name] = report
+	}
+	return reports
+}
+
+// WriteTo writes every registered link's metrics to w
+func (e *PrometheusExporter) WriteTo(w io.Writer) (int64, error) {
+	e.mutex.RLock()
+	names := make([]string, 0, len(e.links))
+	snapshots := make(map[string]MetricsSnapshot, len(e.links))
+	healths := make(map[string]LinkHealth)
+	for name, m := range e.links {
+		names = append(names, name)
+		snapshots[name] = m.Snapshot()
+		if reporter, ok := m.(HealthReporter); ok {
+			healths[name] = reporter.Health()
+		}
+	}
+	e.mutex.RUnlock()
+	sort.Strings(names)
+
+	prefix := "transport_"
+	if e.namespace != "" {
+		prefix = e.namespace + "_" + prefix
+	}
+
+	var b strings.Builder
+	family := func(name, kind, help string, value func(MetricsSnapshot, string) string, directions ...string) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, name, help, prefix, name, kind)
+		for _, link := range names {
+			if len(directions) == 0 {
+				fmt.Fprintf(&b, "%s%s{link=\"%s\"} %s\n", prefix, name, escapeLabel(link), value(snapshots[link], ""))
+				continue
+			}
+			for _, dir := range directions {
+				fmt.Fprintf(&b, "%s%s{link=\"%s\",direction=\"%s\"} %s\n",
+					prefix, name, escapeLabel(link), dir, value(snapshots[link], dir))
+			}
+		}
+	}
+
+	family("packets_total", "counter", "Packets carried by the link.", func(s MetricsSnapshot, dir string) string {
+		if dir == "in" {
+			return fmt.Sprint(s.PacketsIn)
+		}
+		return fmt.Sprint(s.PacketsOut)
+	}, "in", "out")
+	family("bytes_total", "counter", "Bytes carried by the link.", func(s MetricsSnapshot, dir string) string {
+		if dir == "in" {
+			return fmt.Sprint(s.BytesIn)
+		}
+		return fmt.Sprint(s.BytesOut)
+	}, "in", "out")
+	family("errors_total", "counter", "Failed sends and receives.", func(s MetricsSnapshot, _ string) string {
+		return fmt.Sprint(s.Errors)
+	})
+	family("drops_total", "counter", "Received packets discarded before delivery.", func(s MetricsSnapshot, _ string) string {
+		return fmt.Sprint(s.Drops)
+	})
+	family("rtt_seconds", "gauge", "Smoothed round-trip time.", func(s MetricsSnapshot, _ string) string {
+		return fmt.Sprint(s.RTT.Seconds())
+	})
+
+	// Only links keeping a connection have health
+	health := func(name, kind, help string, value func(LinkHealth) string) {
+		if len(healths) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, name, help, prefix, name, kind)
+		for _, link := range names {
+			if h, ok := healths[link]; ok {
+				fmt.Fprintf(&b, "%s%s{link=\"%s\"} %s\n", prefix, name, escapeLabel(link), value(h))
+			}
+		}
+	}
+	health("reconnects_total", "counter", "Times the link's connection was re-established.", func(h LinkHealth) string {
+		return fmt.Sprint(h.Reconnects)
+	})
+	health("queue_depth", "gauge", "Frames waiting to be sent on the link.", func(h LinkHealth) string {
+		return fmt.Sprint(h.QueueDepth)
+	})
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics page
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
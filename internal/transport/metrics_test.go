@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestAtomicMetrics(t *testing.T) {
+	m := NewAtomicMetrics()
+	m.PacketIn(100)
+	m.PacketIn(50)
+	m.PacketOut(32)
+	m.Error()
+	m.Drop()
+	m.RTT(80 * time.Millisecond)
+	m.RTT(160 * time.Millisecond)
+
+	got := m.Snapshot()
+	want := MetricsSnapshot{
+		PacketsIn: 2, BytesIn: 150, PacketsOut: 1, BytesOut: 32, Errors: 1, Drops: 1,
+		RTT: 90 * time.Millisecond, RTTSamples: 2,
+	}
+	if got != want {
+		t.Errorf("Snapshot = %+v, want %+v", got, want)
+	}
+}
+
+func TestUDPConnection_Metrics(t *testing.T) {
+	shared := NewAtomicMetrics()
+	receiver, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0", Metrics: shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	sender, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0", RemoteAddr: receiver.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	if err := sender.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := net.Dial("udp", receiver.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	raw.Write([]byte("garbage"))
+
+	receiver.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 2; i++ {
+		receiver.Receive()
+	}
+
+	if out := sender.Metrics().Snapshot(); out.PacketsOut != 1 || out.BytesOut != usrp.HeaderSize {
+		t.Errorf("Unexpected sender metrics: %+v", out)
+	}
+	in := shared.Snapshot()
+	if in.PacketsIn != 2 || in.BytesIn != usrp.HeaderSize+7 || in.Drops != 1 || in.Errors != 0 {
+		t.Errorf("Unexpected receiver metrics: %+v", in)
+	}
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	link := NewAtomicMetrics()
+	link.PacketIn(10)
+	link.PacketOut(20)
+	link.RTT(250 * time.Millisecond)
+
+	exporter := NewPrometheusExporter("usrp")
+	exporter.Register(`hub "east"`, link)
+
+	var b strings.Builder
+	if _, err := exporter.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE usrp_transport_packets_total counter",
+		`usrp_transport_packets_total{link="hub \"east\"",direction="in"} 1`,
+		`usrp_transport_bytes_total{link="hub \"east\"",direction="out"} 20`,
+		`usrp_transport_drops_total{link="hub \"east\""} 0`,
+		`usrp_transport_rtt_seconds{link="hub \"east\""} 0.25`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in:\n%s", want, out)
+		}
+	}
+
+	exporter.Unregister(`hub "east"`)
+	b.Reset()
+	exporter.WriteTo(&b)
+	if strings.Contains(b.String(), "east") {
+		t.Error("Unregistered link still exported")
+	}
+}
+
+func TestPrometheusExporter_Health(t *testing.T) {
+	remote := NewRemoteMetrics()
+	remote.PacketIn(100) // Recording does nothing on remote metrics
+	remote.Update(LinkReport{
+		MetricsSnapshot: MetricsSnapshot{PacketsIn: 5, Drops: 1},
+		LinkHealth:      LinkHealth{Reconnects: 3, QueueDepth: 4},
+	})
+
+	exporter := NewPrometheusExporter("usrp")
+	exporter.Register("hub", NewAtomicMetrics())
+
+	// Links without health export no health families
+	var b strings.Builder
+	exporter.WriteTo(&b)
+	if strings.Contains(b.String(), "reconnects_total") {
+		t.Errorf("Health exported without a HealthReporter:\n%s", b.String())
+	}
+
+	exporter.Register("discord", remote)
+	b.Reset()
+	exporter.WriteTo(&b)
+	out := b.String()
+	for _, want := range []string{
+		`usrp_transport_packets_total{link="discord",direction="in"} 5`,
+		"# TYPE usrp_transport_reconnects_total counter",
+		`usrp_transport_reconnects_total{link="discord"} 3`,
+		`usrp_transport_queue_depth{link="discord"} 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `queue_depth{link="hub"}`) {
+		t.Error("Health exported for a link without it")
+	}
+
+	if reports := exporter.Reports(); reports["discord"].Reconnects != 3 || reports["hub"].Reconnects != 0 || len(reports) != 2 {
+		t.Errorf("Reports %+v", reports)
+	}
+}
@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// DefaultKeepaliveInterval is comfortably inside the 30s UDP mapping timeout
+// common on consumer routers
+const DefaultKeepaliveInterval = 15 * time.Second
+
+// punchInterval is the PING cadence while punching a hole to a peer
+const punchInterval = 250 * time.Millisecond
+
+// rendezvousTTL is how long a rendezvous server remembers a registration
+const rendezvousTTL = 30 * time.Second
+
+// Rendezvous messages travel as USRP TEXT packets:
+//
+//	client -> server: "RENDEZVOUS <id> <peer-id>"
+//	server -> client: "PEER <host:port>" once both sides have registered
+const (
+	rendezvousRegister = "RENDEZVOUS"
+	rendezvousPeer     = "PEER"
+)
+
+// touchSend records that a packet was just sent
+func (uc *UDPConnection) touchSend() {
+	atomic.StoreInt64(&uc.lastSend, time.Now().UnixNano())
+}
+
+// keepalive sends a PING whenever nothing has been sent to the remote
+// address for the keepalive interval
+func (uc *UDPConnection) keepalive(ctx context.Context) {
+	interval := uc.config.Keepalive
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			last := time.Unix(0, atomic.LoadInt64(&uc.lastSend))
+			if now.Sub(last) < interval || uc.remoteAddr == nil {
+				continue
+			}
+			if err := uc.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+				log.Printf("USRP keepalive to %s failed: %v", uc.remoteAddr, err)
+			}
+		}
+	}
+}
+
+// writePacket marshals msg and sends it to addr, bypassing the remote
+// address and sequence numbering
+func (uc *UDPConnection) writePacket(msg usrp.Message, addr *net.UDPAddr) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if _, err := uc.conn.WriteToUDP(data, addr); err != nil {
+		uc.metrics.Error()
+		return fmt.Errorf("failed to send UDP packet: %w", err)
+	}
+	uc.metrics.PacketOut(len(data))
+	uc.touchSend()
+	return nil
+}
+
+// readFrom waits until deadline for a packet from addr, discarding packets
+// from anyone else. It returns nil without error on timeout.
+func (uc *UDPConnection) readFrom(addr *net.UDPAddr, deadline time.Time) (*usrp.Received, error) {
+	buffer := make([]byte, usrp.CurrentLimits().MaxPacketSize)
+	for {
+		if err := uc.conn.SetReadDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+		n, from, err := uc.conn.ReadFromUDP(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, nil
+			}
+			uc.metrics.Error()
+			return nil, fmt.Errorf("failed to read UDP packet: %w", err)
+		}
+		uc.metrics.PacketIn(n)
+		if !sameUDPAddr(from, addr) {
+			uc.metrics.Drop()
+			continue
+		}
+		rx, err := usrp.ParseReceived(buffer[:n], from, time.Now())
+		if err != nil {
+			uc.metrics.Drop()
+			continue
+		}
+		return rx, nil
+	}
+}
+
+// Punch opens a path through NAT to peer by sending PINGs until a packet
+// from the peer arrives, then makes the peer the remote address. Both sides
+// must punch at the same time; each answers the first packet it sees with
+// one more PING so the other side completes too. Call before Start.
+func (uc *UDPConnection) Punch(ctx context.Context, peer *net.UDPAddr) error {
+	if uc.conn == nil {
+		return fmt.Errorf("connection not established")
+	}
+	defer uc.conn.SetReadDeadline(time.Time{})
+
+	ping := &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("hole punch to %s: %w", peer, ctx.Err())
+		default:
+		}
+
+		if err := uc.writePacket(ping, peer); err != nil {
+			return err
+		}
+		rx, err := uc.readFrom(peer, time.Now().Add(punchInterval))
+		if err != nil {
+			return err
+		}
+		if rx == nil {
+			continue
+		}
+
+		if err := uc.writePacket(ping, peer); err != nil {
+			return err
+		}
+		uc.remoteAddr = peer
+		return nil
+	}
+}
+
+// Rendezvous registers with a rendezvous server as id, waits for peerID to
+// register too, and punches a hole to the peer address the server reports.
+// On success the peer becomes the remote address. Call before Start.
+func (uc *UDPConnection) Rendezvous(ctx context.Context, server, id, peerID string) (*net.UDPAddr, error) {
+	if uc.conn == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+	if id == "" || peerID == "" || strings.ContainsAny(id+peerID, " \t\n") {
+		return nil, fmt.Errorf("rendezvous ids must be non-empty words")
+	}
+
+	serverAddr, err := resolveUDPRemote(server, uc.config.IPVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve rendezvous server: %w", err)
+	}
+
+	register := &usrp.TextMessage{
+		Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0),
+		Text:   []byte(rendezvousRegister + " " + id + " " + peerID),
+	}
+
+	var peer *net.UDPAddr
+	for peer == nil {
+		select {
+		case <-ctx.Done():
+			uc.conn.SetReadDeadline(time.Time{})
+			return nil, fmt.Errorf("rendezvous via %s: %w", server, ctx.Err())
+		default:
+		}
+
+		// Registrations are retransmitted until the server answers, which
+		// also keeps our mapping toward the server open
+		if err := uc.writePacket(register, serverAddr); err != nil {
+			return nil, err
+		}
+		rx, err := uc.readFrom(serverAddr, time.Now().Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		if rx == nil {
+			continue
+		}
+		text, ok := rx.Message.(*usrp.TextMessage)
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(string(text.Text))
+		if len(fields) != 2 || fields[0] != rendezvousPeer {
+			continue
+		}
+		peer, err = net.ResolveUDPAddr("udp", fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("rendezvous server sent a bad peer address: %w", err)
+		}
+	}
+
+	if err := uc.Punch(ctx, peer); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// sameUDPAddr compares addresses by IP and port, treating IPv4-mapped IPv6
+// addresses as their IPv4 form
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// rendezvousEntry is one client's pending registration
+type rendezvousEntry struct {
+	peer   *Peer
+	want   string
+	expiry time.Time
+}
+
+// RendezvousHandler returns a TEXT handler for a Server that introduces
+// clients registering with Rendezvous to each other: when two clients name
+// each other, both are sent the other's public address. Other TEXT packets
+// go to next, which may be nil.
+func RendezvousHandler(next PeerHandler) PeerHandler {
+	var mutex sync.Mutex
+	entries := make(map[string]*rendezvousEntry)
+
+	return func(p *Peer, rx *usrp.Received) error {
+		text, ok := rx.Message.(*usrp.TextMessage)
+		var fields []string
+		if ok {
+			fields = strings.Fields(string(text.Text))
+		}
+		if len(fields) != 3 || fields[0] != rendezvousRegister {
+			if next == nil {
+				return nil
+			}
+			return next(p, rx)
+		}
+		id, want := fields[1], fields[2]
+
+		mutex.Lock()
+		now := time.Now()
+		for key, entry := range entries {
+			if now.After(entry.expiry) {
+				delete(entries, key)
+			}
+		}
+		// Matched entries are kept until they expire, so a client whose
+		// PEER reply was lost is answered again when it retransmits
+		entries[id] = &rendezvousEntry{peer: p, want: want, expiry: now.Add(rendezvousTTL)}
+		other, matched := entries[want]
+		matched = matched && other.want == id
+		mutex.Unlock()
+
+		if !matched {
+			return nil
+		}
+		if err := p.SendMessage(peerText(other.peer)); err != nil {
+			return err
+		}
+		return other.peer.SendMessage(peerText(p))
+	}
+}
+
+// peerText builds the PEER reply announcing p's address
+func peerText(p *Peer) *usrp.TextMessage {
+	return &usrp.TextMessage{
+		Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0),
+		Text:   []byte(rendezvousPeer + " " + p.String()),
+	}
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestUDPConnection_Keepalive(t *testing.T) {
+	receiver, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	var pings int32
+	receiver.RegisterHandler(usrp.USRP_TYPE_PING, func(msg usrp.Message) error {
+		atomic.AddInt32(&pings, 1)
+		return nil
+	})
+
+	sender, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:  "127.0.0.1:0",
+		RemoteAddr: receiver.LocalAddr().String(),
+		Keepalive:  40 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go receiver.Start(ctx)
+	go sender.Start(ctx)
+
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n < 3 {
+		t.Errorf("Expected periodic keepalive PINGs on an idle link, got %d", n)
+	}
+}
+
+func TestUDPConnection_Rendezvous(t *testing.T) {
+	hub := NewServer(&ServerConfig{ListenAddr: "127.0.0.1:0"})
+	if err := hub.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+	hub.RegisterHandler(usrp.USRP_TYPE_TEXT, RendezvousHandler(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go hub.Start(ctx)
+
+	nodes := make([]*UDPConnection, 2)
+	for i := range nodes {
+		node, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := node.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer node.Close()
+		nodes[i] = node
+	}
+
+	type result struct {
+		peer *net.UDPAddr
+		err  error
+	}
+	results := make(chan result, 2)
+	ids := []string{"node-a", "node-b"}
+	for i, node := range nodes {
+		go func(node *UDPConnection, id, peerID string) {
+			peer, err := node.Rendezvous(ctx, hub.LocalAddr().String(), id, peerID)
+			results <- result{peer, err}
+		}(node, ids[i], ids[1-i])
+	}
+
+	for i := 0; i < 2; i++ {
+		if r := <-results; r.err != nil {
+			t.Fatalf("Rendezvous failed: %v", r.err)
+		}
+	}
+
+	for i, node := range nodes {
+		want := nodes[1-i].LocalAddr().(*net.UDPAddr)
+		if !sameUDPAddr(node.remoteAddr, want) {
+			t.Errorf("%s: remote address %s, want %s", ids[i], node.remoteAddr, want)
+		}
+	}
+
+	// The punched path carries traffic directly between the nodes
+	text := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("direct")}
+	if err := nodes[0].SendMessage(text); err != nil {
+		t.Fatal(err)
+	}
+	nodes[1].conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		rx, err := nodes[1].Receive()
+		if err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		if msg, ok := rx.Message.(*usrp.TextMessage); ok && string(msg.Text) == "direct" {
+			break
+		}
+	}
+}
+
+func TestRendezvousHandler_PassesOtherText(t *testing.T) {
+	var passed bool
+	handler := RendezvousHandler(func(p *Peer, rx *usrp.Received) error {
+		passed = true
+		return nil
+	})
+
+	rx := &usrp.Received{Message: &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("hello")}}
+	if err := handler(nil, rx); err != nil {
+		t.Fatal(err)
+	}
+	if !passed {
+		t.Error("Expected non-rendezvous text to reach the next handler")
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// PacedSenderConfig holds configuration for a PacedSender
+type PacedSenderConfig struct {
+	Interval  time.Duration // Time between voice frames
+	QueueSize int           // Messages buffered before Send blocks
+}
+
+// DefaultPacedSenderConfig returns the USRP frame cadence with one second of
+// queued audio
+func DefaultPacedSenderConfig() *PacedSenderConfig {
+	return &PacedSenderConfig{
+		Interval:  20 * time.Millisecond,
+		QueueSize: 50,
+	}
+}
+
+// PacedStats holds PacedSender counters
+type PacedStats struct {
+	Sent      uint64 // Messages handed to the send function
+	Errors    uint64 // Send function failures
+	Underruns uint64 // Ticks with an empty queue in the middle of a stream
+	Queued    int    // Messages currently waiting
+}
+
+// PacedSender queues outgoing messages and transmits one voice frame per
+// tick, so bursts from file playback or transcoders reach the peer at the
+// 20ms cadence AllStarLink expects. Non-voice messages (TLV, DTMF, text)
+// keep their place in the queue but go out without waiting for a tick of
+// their own.
+type PacedSender struct {
+	send   func(usrp.Message) error
+	config *PacedSenderConfig
+	queue  chan usrp.Message
+
+	sent      uint64
+	errors    uint64
+	underruns uint64
+}
+
+// NewPacedSender creates a paced sender that transmits through send, such as
+// a Connection's SendMessage
+func NewPacedSender(send func(usrp.Message) error, config *PacedSenderConfig) *PacedSender {
+	if config == nil {
+		config = DefaultPacedSenderConfig()
+	}
+	if config.Interval <= 0 {
+		config.Interval = 20 * time.Millisecond
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 50
+	}
+
+	return &PacedSender{
+		send:   send,
+		config: config,
+		queue:  make(chan usrp.Message, config.QueueSize),
+	}
+}
+
+// Send queues a message, blocking while the queue is full
+func (p *PacedSender) Send(ctx context.Context, msg usrp.Message) error {
+	select {
+	case p.queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend queues a message without blocking
+func (p *PacedSender) TrySend(msg usrp.Message) error {
+	select {
+	case p.queue <- msg:
+		return nil
+	default:
+		return fmt.Errorf("paced send queue full (%d messages)", cap(p.queue))
+	}
+}
+
+// Run transmits queued messages until the context is cancelled
+func (p *PacedSender) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	streaming := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			sentVoice := p.tick()
+			if !sentVoice && streaming {
+				atomic.AddUint64(&p.underruns, 1)
+			}
+			streaming = sentVoice
+		}
+	}
+}
+
+// tick sends queued messages up to and including the next voice frame and
+// reports whether a voice frame went out
+func (p *PacedSender) tick() bool {
+	for {
+		select {
+		case msg := <-p.queue:
+			if err := p.send(msg); err != nil {
+				atomic.AddUint64(&p.errors, 1)
+			} else {
+				atomic.AddUint64(&p.sent, 1)
+			}
+			if isVoice(msg) {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+// Stats returns the current counters
+func (p *PacedSender) Stats() PacedStats {
+	return PacedStats{
+		Sent:      atomic.LoadUint64(&p.sent),
+		Errors:    atomic.LoadUint64(&p.errors),
+		Underruns: atomic.LoadUint64(&p.underruns),
+		Queued:    len(p.queue),
+	}
+}
+
+// isVoice reports whether msg carries a frame of audio
+func isVoice(msg usrp.Message) bool {
+	switch msg.GetType() {
+	case usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_VOICE_ULAW, usrp.USRP_TYPE_VOICE_ADPCM:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestPacedSender_Cadence(t *testing.T) {
+	var mutex sync.Mutex
+	var times []time.Time
+	var types []usrp.PacketType
+	send := func(msg usrp.Message) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		times = append(times, time.Now())
+		types = append(types, msg.GetType())
+		return nil
+	}
+
+	sender := NewPacedSender(send, &PacedSenderConfig{Interval: 20 * time.Millisecond, QueueSize: 16})
+
+	// Queue a burst, as a transcoder would produce it, with a TLV in the middle
+	tlv, err := usrp.NewTLV(0).Callsign("N0CALL").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, uint32(i))}
+		if err := sender.Send(ctx, voice); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if err := sender.Send(ctx, tlv); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	go sender.Run(ctx)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	want := []usrp.PacketType{
+		usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_TLV,
+		usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_VOICE,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("Sent %d messages, want %d", len(types), len(want))
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("Message %d: type %d, want %d", i, types[i], want[i])
+		}
+	}
+
+	// Voice frames are spread out rather than sent back to back
+	var voiceTimes []time.Time
+	for i, typ := range types {
+		if typ == usrp.USRP_TYPE_VOICE {
+			voiceTimes = append(voiceTimes, times[i])
+		}
+	}
+	if span := voiceTimes[len(voiceTimes)-1].Sub(voiceTimes[0]); span < 60*time.Millisecond {
+		t.Errorf("5 voice frames spanned %v, want at least 60ms", span)
+	}
+
+	stats := sender.Stats()
+	if stats.Sent != 6 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.Underruns != 1 {
+		t.Errorf("Underruns = %d, want 1 (stream end)", stats.Underruns)
+	}
+}
+
+func TestPacedSender_QueueFull(t *testing.T) {
+	sender := NewPacedSender(func(usrp.Message) error { return nil }, &PacedSenderConfig{QueueSize: 2})
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+
+	for i := 0; i < 2; i++ {
+		if err := sender.TrySend(voice); err != nil {
+			t.Fatalf("TrySend %d: %v", i, err)
+		}
+	}
+	if err := sender.TrySend(voice); err == nil {
+		t.Error("Expected TrySend to fail on a full queue")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sender.Send(ctx, voice); err == nil {
+		t.Error("Expected Send to give up when the context expires")
+	}
+}
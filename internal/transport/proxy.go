@@ -0,0 +1,279 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// SOCKS5 protocol constants (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 5
+	socks5AuthNone     = 0
+	socks5AuthPassword = 2
+	socks5AuthRejected = 0xff
+	socks5Connect      = 1
+	socks5AddrIPv4     = 1
+	socks5AddrDomain   = 3
+	socks5AddrIPv6     = 4
+)
+
+// socks5Replies describes SOCKS5 reply codes
+var socks5Replies = map[byte]string{
+	1: "general server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// ProxyDialer dials TCP streams through a SOCKS5 or HTTP CONNECT proxy, for
+// hubs whose egress rules only allow traffic through a proxy
+type ProxyDialer struct {
+	scheme  string // "socks5" or "http"
+	address string // Proxy host:port
+	user    *url.Userinfo
+}
+
+// NewProxyDialer parses a proxy URL: socks5://[user:pass@]host:port or
+// http://[user:pass@]host:port. SOCKS5 targets are sent by name, so the
+// proxy resolves them.
+func NewProxyDialer(proxyURL string) (*ProxyDialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	p := &ProxyDialer{address: u.Host, user: u.User}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		p.scheme = "socks5"
+		if u.Port() == "" {
+			p.address = net.JoinHostPort(u.Hostname(), "1080")
+		}
+	case "http":
+		p.scheme = "http"
+		if u.Port() == "" {
+			p.address = net.JoinHostPort(u.Hostname(), "80")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (want socks5 or http)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyURL)
+	}
+	if p.scheme == "socks5" && p.user != nil {
+		password, _ := p.user.Password()
+		if len(p.user.Username()) > 255 || len(password) > 255 {
+			return nil, fmt.Errorf("SOCKS5 username and password are limited to 255 bytes")
+		}
+	}
+	return p, nil
+}
+
+// String returns the proxy URL without credentials
+func (p *ProxyDialer) String() string {
+	return p.scheme + "://" + p.address
+}
+
+// DialContext connects to the proxy with forward and asks it for a stream
+// to address. network picks the address family used to reach the proxy.
+// ctx bounds both the connection and the proxy handshake.
+func (p *ProxyDialer) DialContext(ctx context.Context, forward *net.Dialer, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target port %q", portStr)
+	}
+
+	conn, err := forward.DialContext(ctx, network, p.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial proxy %s: %w", p, err)
+	}
+
+	release, err := bindContext(ctx, 0, conn.SetDeadline)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if p.scheme == "socks5" {
+		err = p.socks5Connect(conn, host, uint16(port))
+	} else {
+		conn, err = p.httpConnect(conn, address)
+	}
+	release()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", p, contextError(ctx, err))
+	}
+	return conn, nil
+}
+
+// socks5Connect negotiates authentication and a CONNECT to host:port
+func (p *ProxyDialer) socks5Connect(conn net.Conn, host string, port uint16) error {
+	methods := []byte{socks5AuthNone}
+	if p.user != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("failed to send greeting: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("failed to read greeting reply: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if p.user == nil {
+			return fmt.Errorf("proxy requires a username and password")
+		}
+		if err := p.socks5Authenticate(conn); err != nil {
+			return err
+		}
+	case socks5AuthRejected:
+		return fmt.Errorf("no acceptable authentication method")
+	default:
+		return fmt.Errorf("unsupported authentication method %d", reply[1])
+	}
+
+	request := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("target host name too long")
+		}
+		request = append(request, socks5AddrDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socks5AddrIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socks5AddrIPv6)
+		request = append(request, ip.To16()...)
+	}
+	request = binary.BigEndian.AppendUint16(request, port)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("failed to send connect request: %w", err)
+	}
+
+	// Reply: version, status, reserved, then the bound address, which is
+	// read and discarded
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("failed to read connect reply: %w", err)
+	}
+	if header[1] != 0 {
+		reason, ok := socks5Replies[header[1]]
+		if !ok {
+			reason = "reply " + strconv.Itoa(int(header[1]))
+		}
+		return fmt.Errorf("connect failed: %s", reason)
+	}
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return fmt.Errorf("failed to read connect reply: %w", err)
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("unknown bound address type %d", header[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("failed to read connect reply: %w", err)
+	}
+	return nil
+}
+
+// socks5Authenticate performs username/password authentication
+func (p *ProxyDialer) socks5Authenticate(conn net.Conn) error {
+	username := p.user.Username()
+	password, _ := p.user.Password()
+
+	request := []byte{1, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("failed to send credentials: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("failed to read authentication reply: %w", err)
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("authentication failed")
+	}
+	return nil
+}
+
+// httpConnect asks an HTTP proxy to tunnel to address. The returned
+// connection replays any bytes the proxy sent after its response.
+func (p *ProxyDialer) httpConnect(conn net.Conn, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.user != nil {
+		password, _ := p.user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return conn, fmt.Errorf("failed to read CONNECT response: %w", err)
+	}
+	// A successful CONNECT response has no body; an error body is left
+	// unread since the connection is closed
+	if resp.StatusCode != http.StatusOK {
+		return conn, errors.New("CONNECT refused: " + resp.Status)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads drain a bufio.Reader first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer, then the connection
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
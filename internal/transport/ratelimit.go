@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimitIdle is how long a source's buckets are kept after its last packet
+const rateLimitIdle = time.Minute
+
+// RateLimitConfig holds per-source receive limits. Either rate may be zero
+// to leave that dimension unlimited.
+type RateLimitConfig struct {
+	PacketsPerSecond int `json:"packets_per_second"` // Sustained packets per second per source
+	PacketBurst      int `json:"packet_burst"`       // Packets allowed back-to-back above the rate
+	BytesPerSecond   int `json:"bytes_per_second"`   // Sustained bytes per second per source
+	ByteBurst        int `json:"byte_burst"`         // Bytes allowed back-to-back above the rate
+}
+
+// DefaultRateLimitConfig returns limits with headroom over one voice stream
+// (50 pps of 352-byte packets) plus keepalives and metadata
+func DefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		PacketsPerSecond: 100,
+		PacketBurst:      50,
+		BytesPerSecond:   64 * 1024,
+		ByteBurst:        32 * 1024,
+	}
+}
+
+// RateLimitStats holds rate limiter counters
+type RateLimitStats struct {
+	Passed  uint64 `json:"passed"`
+	Dropped uint64 `json:"dropped"`
+	Sources int    `json:"sources"` // Sources currently tracked
+}
+
+// sourceLimit holds one source's buckets
+type sourceLimit struct {
+	packets  *tokenBucket // nil = unlimited
+	bytes    *tokenBucket // nil = unlimited
+	lastSeen time.Time
+}
+
+// RateLimiter drops packets from sources exceeding their packet or byte
+// rate, so one runaway or malicious sender cannot saturate the receive path.
+// Sources are keyed by IP address: every port on a host shares one budget.
+type RateLimiter struct {
+	config    RateLimitConfig
+	sources   map[string]*sourceLimit
+	mutex     sync.Mutex
+	lastPrune time.Time
+	passed    uint64
+	dropped   uint64
+}
+
+// NewRateLimiter creates a rate limiter. A nil config or one with no rates
+// returns nil, which callers treat as "unlimited".
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+	if config == nil || (config.PacketsPerSecond <= 0 && config.BytesPerSecond <= 0) {
+		return nil
+	}
+
+	cfg := *config
+	if cfg.PacketBurst <= 0 {
+		cfg.PacketBurst = 1
+	}
+	if cfg.ByteBurst <= 0 {
+		cfg.ByteBurst = cfg.BytesPerSecond
+	}
+
+	return &RateLimiter{
+		config:  cfg,
+		sources: make(map[string]*sourceLimit),
+	}
+}
+
+// Allow reports whether a packet of size bytes from source may be accepted,
+// consuming from the source's budget if so
+func (rl *RateLimiter) Allow(source net.Addr, size int, now time.Time) bool {
+	if rl == nil {
+		return true
+	}
+
+	key := sourceKey(source)
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if now.Sub(rl.lastPrune) >= rateLimitIdle {
+		rl.prune(now)
+	}
+
+	limit, exists := rl.sources[key]
+	if !exists {
+		limit = &sourceLimit{}
+		if rl.config.PacketsPerSecond > 0 {
+			limit.packets = newTokenBucket(float64(rl.config.PacketsPerSecond), float64(rl.config.PacketBurst))
+		}
+		if rl.config.BytesPerSecond > 0 {
+			limit.bytes = newTokenBucket(float64(rl.config.BytesPerSecond), float64(rl.config.ByteBurst))
+		}
+		rl.sources[key] = limit
+	}
+	limit.lastSeen = now
+
+	// Check both budgets before consuming either, so a packet dropped for
+	// its size does not also use up a packet token
+	ok := true
+	if limit.packets != nil {
+		limit.packets.refill(now)
+		ok = limit.packets.tokens >= 1
+	}
+	if ok && limit.bytes != nil {
+		limit.bytes.refill(now)
+		ok = limit.bytes.tokens >= float64(size)
+	}
+
+	if !ok {
+		rl.dropped++
+		return false
+	}
+	if limit.packets != nil {
+		limit.packets.tokens--
+	}
+	if limit.bytes != nil {
+		limit.bytes.tokens -= float64(size)
+	}
+	rl.passed++
+	return true
+}
+
+// prune forgets sources idle for longer than rateLimitIdle. Must be called
+// with the mutex held.
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, limit := range rl.sources {
+		if now.Sub(limit.lastSeen) > rateLimitIdle {
+			delete(rl.sources, key)
+		}
+	}
+	rl.lastPrune = now
+}
+
+// Stats returns the limiter's counters
+func (rl *RateLimiter) Stats() RateLimitStats {
+	if rl == nil {
+		return RateLimitStats{}
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return RateLimitStats{Passed: rl.passed, Dropped: rl.dropped, Sources: len(rl.sources)}
+}
+
+// sourceKey returns the IP of a UDP or TCP address, or its string form
+func sourceKey(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	case nil:
+		return ""
+	default:
+		return addr.String()
+	}
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestRateLimiter_PerSource(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitConfig{PacketsPerSecond: 10, PacketBurst: 3})
+	now := time.Now()
+
+	flood := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	sameHost := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2000}
+	other := &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1000}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(flood, 32, now) {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected burst of 3 packets, got %d", allowed)
+	}
+
+	// Ports on the same host share a budget; other hosts are unaffected
+	if limiter.Allow(sameHost, 32, now) {
+		t.Error("Expected another port on the flooding host to be limited")
+	}
+	if !limiter.Allow(other, 32, now) {
+		t.Error("Expected a different source to be allowed")
+	}
+
+	// The budget refills at the sustained rate
+	if !limiter.Allow(flood, 32, now.Add(100*time.Millisecond)) {
+		t.Error("Expected a packet to pass after refill")
+	}
+
+	stats := limiter.Stats()
+	if stats.Passed != 5 || stats.Dropped != 8 || stats.Sources != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestRateLimiter_Bytes(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitConfig{PacketsPerSecond: 100, PacketBurst: 10, BytesPerSecond: 1000, ByteBurst: 1000})
+	source := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	now := time.Now()
+
+	if !limiter.Allow(source, 600, now) {
+		t.Fatal("First packet should pass")
+	}
+	if limiter.Allow(source, 600, now) {
+		t.Error("Second packet should exceed the byte budget")
+	}
+	if !limiter.Allow(source, 300, now) {
+		t.Error("A packet dropped for size must not consume a packet token")
+	}
+}
+
+func TestRateLimiter_PrunesIdleSources(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitConfig{PacketsPerSecond: 10})
+	now := time.Now()
+
+	limiter.Allow(&net.UDPAddr{IP: net.ParseIP("192.0.2.1")}, 32, now)
+	limiter.Allow(&net.UDPAddr{IP: net.ParseIP("192.0.2.2")}, 32, now.Add(2*rateLimitIdle))
+
+	if sources := limiter.Stats().Sources; sources != 1 {
+		t.Errorf("Expected idle source to be pruned, tracking %d", sources)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	if NewRateLimiter(nil) != nil || NewRateLimiter(&RateLimitConfig{}) != nil {
+		t.Fatal("Expected nil limiter without rates")
+	}
+
+	var limiter *RateLimiter
+	if !limiter.Allow(nil, 1<<20, time.Now()) {
+		t.Error("A nil limiter must allow everything")
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		RateLimit:  &RateLimitConfig{PacketsPerSecond: 1, PacketBurst: 5},
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	node, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	ping, err := (&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		node.Write(ping)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.RateLimitStats().Passed+server.RateLimitStats().Dropped < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := server.RateLimitStats()
+	if stats.Passed != 5 || stats.Dropped != 15 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	peers := server.Peers()
+	if len(peers) != 1 || peers[0].Packets != 5 || peers[0].RateLimited != 15 {
+		t.Errorf("Unexpected peer state: %+v", peers)
+	}
+}
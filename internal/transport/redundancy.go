@@ -0,0 +1,245 @@
+package transport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// Redundant packet layout (RFC 2198 style, all fields big-endian):
+//
+//	0      1        3       4
+//	+------+--------+-------+----------------------------+
+//	| 'R'  | seq    | count | count x block header        |
+//	+------+--------+-------+----------------------------+
+//	| redundant payloads (oldest first) | primary payload |
+//	+-----------------------------------+-----------------+
+//
+// Each block header is distance(1) + length(2), where distance is how many
+// frames before the primary frame the redundant copy was originally sent.
+const (
+	redundancyMagic       = 'R'
+	redundancyHeaderSize  = 4
+	redundancyBlockHeader = 3
+	redundancyWindow      = 256 // Sequence numbers remembered for deduplication
+)
+
+// RedundancyConfig configures piggybacked frame redundancy for lossy links
+type RedundancyConfig struct {
+	Copies   int `json:"copies"`   // Earlier frames carried in each packet (default 1)
+	Distance int `json:"distance"` // Frames between a frame and its copy (default 1)
+}
+
+// DefaultRedundancyConfig returns RED-style single redundancy: every frame
+// also rides on the next packet
+func DefaultRedundancyConfig() *RedundancyConfig {
+	return &RedundancyConfig{
+		Copies:   1,
+		Distance: 1,
+	}
+}
+
+// RedundancyEncoder wraps outgoing frames so that each packet also carries
+// copies of earlier frames. Bandwidth grows by a factor of Copies+1.
+type RedundancyEncoder struct {
+	copies   int
+	distance int
+	seq      uint16
+	history  [][]byte // Most recent frames, newest last
+	mutex    sync.Mutex
+}
+
+// NewRedundancyEncoder creates an encoder; a nil config returns nil, which
+// Encode treats as pass-through
+func NewRedundancyEncoder(config *RedundancyConfig) *RedundancyEncoder {
+	if config == nil {
+		return nil
+	}
+	copies, distance := config.Copies, config.Distance
+	if copies <= 0 {
+		copies = 1
+	}
+	if distance <= 0 {
+		distance = 1
+	}
+	if copies*distance > 255 {
+		distance = 255 / copies
+	}
+	return &RedundancyEncoder{copies: copies, distance: distance}
+}
+
+// Encode wraps frame together with its redundant predecessors
+func (e *RedundancyEncoder) Encode(frame []byte) []byte {
+	if e == nil {
+		return frame
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	type block struct {
+		distance int
+		data     []byte
+	}
+	var blocks []block
+	for k := e.copies; k >= 1; k-- {
+		d := k * e.distance
+		if idx := len(e.history) - d; idx >= 0 {
+			blocks = append(blocks, block{distance: d, data: e.history[idx]})
+		}
+	}
+
+	size := redundancyHeaderSize + len(frame)
+	for _, b := range blocks {
+		size += redundancyBlockHeader + len(b.data)
+	}
+
+	packet := make([]byte, 0, size)
+	packet = append(packet, redundancyMagic)
+	packet = binary.BigEndian.AppendUint16(packet, e.seq)
+	packet = append(packet, byte(len(blocks)))
+	for _, b := range blocks {
+		packet = append(packet, byte(b.distance))
+		packet = binary.BigEndian.AppendUint16(packet, uint16(len(b.data)))
+	}
+	for _, b := range blocks {
+		packet = append(packet, b.data...)
+	}
+	packet = append(packet, frame...)
+
+	// Remember the frame for later packets
+	e.history = append(e.history, append([]byte(nil), frame...))
+	if max := e.copies * e.distance; len(e.history) > max {
+		e.history = e.history[len(e.history)-max:]
+	}
+	e.seq++
+
+	return packet
+}
+
+// Reset forgets the frames sent so far, so the next transmission does not
+// carry copies of the end of the last one. The sequence number runs on.
+func (e *RedundancyEncoder) Reset() {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.history = nil
+}
+
+// RedundancyStats tracks receiver-side redundancy results
+type RedundancyStats struct {
+	Primary    uint64 `json:"primary"`    // Frames delivered from the primary payload
+	Recovered  uint64 `json:"recovered"`  // Frames delivered from a redundant copy
+	Duplicates uint64 `json:"duplicates"` // Copies discarded because the frame was already delivered
+}
+
+// RedundancyDecoder unwraps redundant packets and deduplicates frames
+type RedundancyDecoder struct {
+	seen    [redundancyWindow]bool
+	highest uint16
+	started bool
+	stats   RedundancyStats
+	mutex   sync.Mutex
+}
+
+// NewRedundancyDecoder creates a decoder
+func NewRedundancyDecoder() *RedundancyDecoder {
+	return &RedundancyDecoder{}
+}
+
+// Decode returns the frames in packet that have not been delivered before,
+// oldest first. Frames recovered from redundant copies therefore arrive
+// ahead of the primary frame they were carried with.
+func (d *RedundancyDecoder) Decode(packet []byte) ([][]byte, error) {
+	if len(packet) < redundancyHeaderSize || packet[0] != redundancyMagic {
+		return nil, fmt.Errorf("not a redundant packet")
+	}
+	seq := binary.BigEndian.Uint16(packet[1:3])
+	count := int(packet[3])
+
+	offset := redundancyHeaderSize + count*redundancyBlockHeader
+	if len(packet) < offset {
+		return nil, fmt.Errorf("redundant packet truncated: %d block headers in %d bytes", count, len(packet))
+	}
+
+	type block struct {
+		seq  uint16
+		data []byte
+	}
+	blocks := make([]block, 0, count+1)
+	for i := 0; i < count; i++ {
+		h := packet[redundancyHeaderSize+i*redundancyBlockHeader:]
+		length := int(binary.BigEndian.Uint16(h[1:3]))
+		if offset+length > len(packet) {
+			return nil, fmt.Errorf("redundant block %d exceeds packet length", i)
+		}
+		blocks = append(blocks, block{
+			seq:  seq - uint16(h[0]),
+			data: packet[offset : offset+length],
+		})
+		offset += length
+	}
+	blocks = append(blocks, block{seq: seq, data: packet[offset:]})
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var frames [][]byte
+	for i, b := range blocks {
+		primary := i == len(blocks)-1
+		if !d.mark(b.seq) {
+			d.stats.Duplicates++
+			continue
+		}
+		if primary {
+			d.stats.Primary++
+		} else {
+			d.stats.Recovered++
+		}
+		frames = append(frames, append([]byte(nil), b.data...))
+	}
+	return frames, nil
+}
+
+// mark records seq as delivered and reports whether it was new
+func (d *RedundancyDecoder) mark(seq uint16) bool {
+	if !d.started {
+		d.started = true
+		d.highest = seq
+		d.seen[seq%redundancyWindow] = true
+		return true
+	}
+
+	ahead := int16(seq - d.highest)
+	switch {
+	case int(ahead) >= redundancyWindow, int(ahead) < -jitterRestartGap:
+		// Far ahead, or far behind as when the sender restarts its
+		// counter: the old window says nothing about this frame
+		d.seen = [redundancyWindow]bool{}
+		d.highest = seq
+	case ahead > 0:
+		// Advance the window, forgetting slots that are now reused
+		for s := d.highest + 1; s != seq+1; s++ {
+			d.seen[s%redundancyWindow] = false
+		}
+		d.highest = seq
+	case int(-ahead) >= redundancyWindow:
+		// Too old to tell; treat as duplicate rather than replay stale audio
+		return false
+	}
+
+	if d.seen[seq%redundancyWindow] {
+		return false
+	}
+	d.seen[seq%redundancyWindow] = true
+	return true
+}
+
+// Stats returns a snapshot of decoder statistics
+func (d *RedundancyDecoder) Stats() RedundancyStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.stats
+}
@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRedundancy_RecoversSingleLoss(t *testing.T) {
+	enc := NewRedundancyEncoder(DefaultRedundancyConfig())
+	dec := NewRedundancyDecoder()
+
+	var delivered [][]byte
+	for i := 0; i < 10; i++ {
+		packet := enc.Encode([]byte(fmt.Sprintf("frame-%d", i)))
+
+		// Drop every third packet
+		if i%3 == 1 {
+			continue
+		}
+
+		frames, err := dec.Decode(packet)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		delivered = append(delivered, frames...)
+	}
+
+	if len(delivered) != 10 {
+		t.Fatalf("Expected all 10 frames recovered, got %d", len(delivered))
+	}
+	for i, frame := range delivered {
+		if want := fmt.Sprintf("frame-%d", i); string(frame) != want {
+			t.Errorf("Frame %d: got %q, want %q", i, frame, want)
+		}
+	}
+
+	stats := dec.Stats()
+	if stats.Recovered != 3 {
+		t.Errorf("Expected 3 recovered frames, got %d", stats.Recovered)
+	}
+	if stats.Primary != 7 {
+		t.Errorf("Expected 7 primary frames, got %d", stats.Primary)
+	}
+	if stats.Duplicates != 3 {
+		t.Errorf("Expected 3 duplicates, got %d", stats.Duplicates)
+	}
+}
+
+func TestRedundancy_InterleavedBurstLoss(t *testing.T) {
+	// Copies two and four frames back survive a burst of two lost packets
+	enc := NewRedundancyEncoder(&RedundancyConfig{Copies: 2, Distance: 2})
+	dec := NewRedundancyDecoder()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 12; i++ {
+		packet := enc.Encode([]byte{byte(i)})
+		if i == 5 || i == 6 {
+			continue
+		}
+		frames, err := dec.Decode(packet)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		for _, f := range frames {
+			if seen[string(f)] {
+				t.Fatalf("Frame %d delivered twice", f[0])
+			}
+			seen[string(f)] = true
+		}
+	}
+
+	for _, i := range []byte{5, 6} {
+		if !seen[string([]byte{i})] {
+			t.Errorf("Frame %d was not recovered", i)
+		}
+	}
+}
+
+func TestRedundancy_PassThroughAndErrors(t *testing.T) {
+	var enc *RedundancyEncoder = NewRedundancyEncoder(nil)
+	frame := []byte("raw")
+	if got := enc.Encode(frame); !bytes.Equal(got, frame) {
+		t.Errorf("Nil encoder should pass frames through, got %q", got)
+	}
+
+	dec := NewRedundancyDecoder()
+	bad := [][]byte{
+		nil,
+		[]byte("XYZ0"),
+		{redundancyMagic, 0, 1, 2, 1, 0},         // Two blocks declared, one header present
+		{redundancyMagic, 0, 1, 1, 1, 0, 9, 'a'}, // Block longer than packet
+	}
+	for i, packet := range bad {
+		if _, err := dec.Decode(packet); err == nil {
+			t.Errorf("Case %d: expected error", i)
+		}
+	}
+}
+
+func TestRedundancy_SenderRestart(t *testing.T) {
+	enc := NewRedundancyEncoder(DefaultRedundancyConfig())
+	dec := NewRedundancyDecoder()
+	for i := 0; i < 5000; i++ {
+		if _, err := dec.Decode(enc.Encode([]byte("old"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The sender restarts: its sequence numbers begin again from 0
+	enc = NewRedundancyEncoder(DefaultRedundancyConfig())
+	for i := 0; i < 3; i++ {
+		frames, err := dec.Decode(enc.Encode([]byte(fmt.Sprintf("new-%d", i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != 1 || string(frames[0]) != fmt.Sprintf("new-%d", i) {
+			t.Errorf("Packet %d after restart delivered %q", i, frames)
+		}
+	}
+}
+
+func TestRedundancy_EncoderReset(t *testing.T) {
+	enc := NewRedundancyEncoder(DefaultRedundancyConfig())
+	dec := NewRedundancyDecoder()
+	enc.Encode([]byte("last of the old transmission")) // Lost
+	enc.Reset()
+
+	frames, err := dec.Decode(enc.Encode([]byte("first")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || string(frames[0]) != "first" {
+		t.Errorf("New transmission delivered %q", frames)
+	}
+
+	var nilEnc *RedundancyEncoder
+	nilEnc.Reset()
+}
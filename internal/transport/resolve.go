@@ -0,0 +1,162 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// IPVersion restricts a transport to one address family
+type IPVersion string
+
+const (
+	IPAny IPVersion = ""  // Dual-stack: use whichever family works
+	IPv4  IPVersion = "4" // IPv4 only
+	IPv6  IPVersion = "6" // IPv6 only
+)
+
+// resolveTimeout bounds name lookups for dial targets
+const resolveTimeout = 5 * time.Second
+
+// validate checks the version is known
+func (v IPVersion) validate() error {
+	switch v {
+	case IPAny, IPv4, IPv6:
+		return nil
+	default:
+		return fmt.Errorf("unknown ip version %q (want \"\", \"4\" or \"6\")", string(v))
+	}
+}
+
+// network returns base ("udp" or "tcp") restricted to the version
+func (v IPVersion) network(base string) string {
+	switch v {
+	case IPv4, IPv6:
+		return base + string(v)
+	default:
+		return base
+	}
+}
+
+// allows reports whether ip belongs to the version's family
+func (v IPVersion) allows(ip net.IP) bool {
+	switch v {
+	case IPv4:
+		return ip.To4() != nil
+	case IPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// familyNetwork returns base qualified with ip's family
+func familyNetwork(base string, ip net.IP) string {
+	if ip.To4() != nil {
+		return base + "4"
+	}
+	return base + "6"
+}
+
+// orderCandidates filters addresses to the version and orders them happy
+// eyeballs style (RFC 8305): IPv6 first, then alternating families
+func orderCandidates(addrs []net.IPAddr, v IPVersion) []net.IPAddr {
+	var v6, v4 []net.IPAddr
+	for _, addr := range addrs {
+		if !v.allows(addr.IP) {
+			continue
+		}
+		if addr.IP.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	ordered := make([]net.IPAddr, 0, len(v6)+len(v4))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			ordered = append(ordered, v6[i])
+		}
+		if i < len(v4) {
+			ordered = append(ordered, v4[i])
+		}
+	}
+	return ordered
+}
+
+// resolveUDPRemote resolves a UDP dial target to the first candidate address
+// the host has a route to. Connecting a UDP socket sends nothing, but fails
+// immediately without a route, so on a v4-only or v6-only network the
+// unusable family is skipped instead of silently blackholing packets.
+func resolveUDPRemote(address string, v IPVersion) (*net.UDPAddr, error) {
+	host, portName, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort("udp", portName)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []net.IPAddr
+	if ip, zone, ok := parseLiteral(host); ok {
+		addrs = []net.IPAddr{{IP: ip, Zone: zone}}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		addrs, err = net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := orderCandidates(addrs, v)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no IPv%s address for %s", string(v), host)
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		addr := &net.UDPAddr{IP: candidate.IP, Port: port, Zone: candidate.Zone}
+		probe, err := net.DialUDP(familyNetwork("udp", addr.IP), nil, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		probe.Close()
+		return addr, nil
+	}
+	return nil, fmt.Errorf("no reachable address for %s: %w", address, lastErr)
+}
+
+// parseLiteral parses an IP literal with an optional IPv6 zone
+func parseLiteral(host string) (net.IP, string, bool) {
+	zone := ""
+	for i := 0; i < len(host); i++ {
+		if host[i] == '%' {
+			host, zone = host[:i], host[i+1:]
+			break
+		}
+	}
+	ip := net.ParseIP(host)
+	return ip, zone, ip != nil
+}
+
+// bindNetwork picks the network for a local socket. An explicit local IP
+// sets the family; a wildcard follows the remote address when there is one,
+// so a v4 peer is never dialed from a v6-only socket, and is otherwise
+// dual-stack unless the version says otherwise.
+func bindNetwork(base string, local net.IP, remote net.IP, v IPVersion) string {
+	switch {
+	case local != nil && !local.IsUnspecified():
+		return familyNetwork(base, local)
+	case local != nil && local.To4() != nil:
+		return base + "4" // 0.0.0.0 binds IPv4 only
+	case remote != nil:
+		return familyNetwork(base, remote)
+	default:
+		return v.network(base)
+	}
+}
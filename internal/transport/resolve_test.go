@@ -0,0 +1,184 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// requireIPv6 skips the test when the host has no IPv6 loopback
+func requireIPv6(t *testing.T) {
+	t.Helper()
+	ln, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	ln.Close()
+}
+
+func TestOrderCandidates(t *testing.T) {
+	addrs := []net.IPAddr{
+		{IP: net.ParseIP("192.0.2.1")},
+		{IP: net.ParseIP("192.0.2.2")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("192.0.2.3")},
+		{IP: net.ParseIP("2001:db8::2")},
+	}
+
+	tests := []struct {
+		version IPVersion
+		want    []string
+	}{
+		{IPAny, []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "192.0.2.3"}},
+		{IPv4, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+		{IPv6, []string{"2001:db8::1", "2001:db8::2"}},
+	}
+
+	for _, tt := range tests {
+		got := orderCandidates(addrs, tt.version)
+		if len(got) != len(tt.want) {
+			t.Fatalf("version %q: got %d candidates, want %d", tt.version, len(got), len(tt.want))
+		}
+		for i, addr := range got {
+			if addr.IP.String() != tt.want[i] {
+				t.Errorf("version %q: candidate %d = %s, want %s", tt.version, i, addr.IP, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestBindNetwork(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.1")
+	v6 := net.ParseIP("2001:db8::1")
+
+	tests := []struct {
+		name    string
+		local   net.IP
+		remote  net.IP
+		version IPVersion
+		want    string
+	}{
+		{"wildcard dual-stack", nil, nil, IPAny, "udp"},
+		{"wildcard forced v6", nil, nil, IPv6, "udp6"},
+		{"wildcard follows v4 remote", nil, v4, IPAny, "udp4"},
+		{"wildcard follows v6 remote", nil, v6, IPAny, "udp6"},
+		{"v4 wildcard", net.IPv4zero, nil, IPAny, "udp4"},
+		{"v6 wildcard forced v6", net.IPv6unspecified, nil, IPv6, "udp6"},
+		{"explicit local", net.IPv6loopback, v4, IPAny, "udp6"},
+	}
+
+	for _, tt := range tests {
+		if got := bindNetwork("udp", tt.local, tt.remote, tt.version); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIPVersion_Restricts(t *testing.T) {
+	if _, err := NewUDPConnection(&ConnectionConfig{LocalAddr: ":0", IPVersion: "5"}); err == nil {
+		t.Error("expected an unknown version to be rejected")
+	}
+
+	// A literal of the wrong family has no usable candidate
+	_, err := NewUDPConnection(&ConnectionConfig{LocalAddr: ":0", RemoteAddr: "127.0.0.1:34001", IPVersion: IPv6})
+	if err == nil {
+		t.Error("expected an IPv4 remote to be rejected when forcing IPv6")
+	}
+	_, err = NewTCPConnection(&ConnectionConfig{LocalAddr: "[::1]:0", IPVersion: IPv4})
+	if err == nil {
+		t.Error("expected an IPv6 local address to be rejected when forcing IPv4")
+	}
+
+	// Forcing IPv4 on a wildcard binds an IPv4 socket
+	conn, err := NewUDPConnection(&ConnectionConfig{LocalAddr: ":0", IPVersion: IPv4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if ip := conn.LocalAddr().(*net.UDPAddr).IP; ip.To4() == nil {
+		t.Errorf("expected an IPv4 socket, bound to %s", ip)
+	}
+}
+
+func TestUDPConnection_IPv6(t *testing.T) {
+	requireIPv6(t)
+
+	server, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "[::1]:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// A wildcard client binds the remote's family
+	client, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:  ":0",
+		RemoteAddr: server.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	server.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rx, err := server.Receive()
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if rx.Type() != usrp.USRP_TYPE_PING {
+		t.Errorf("got type %v, want PING", rx.Type())
+	}
+	if rx.Source.(*net.UDPAddr).IP.To4() != nil {
+		t.Errorf("expected an IPv6 source, got %s", rx.Source)
+	}
+}
+
+func TestTCPConnection_IPv6(t *testing.T) {
+	requireIPv6(t)
+
+	server, err := NewTCPConnection(&ConnectionConfig{LocalAddr: "[::1]:0", IPVersion: IPv6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := NewTCPConnection(&ConnectionConfig{
+		LocalAddr:    ":0",
+		RemoteAddr:   server.LocalAddr().String(),
+		WriteTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	rx, err := server.Receive()
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if rx.Type() != usrp.USRP_TYPE_PING {
+		t.Errorf("got type %v, want PING", rx.Type())
+	}
+}
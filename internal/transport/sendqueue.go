@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// ErrSendQueueFull is returned by SendMessageAsync when the queue is full
+// and the drop policy discards the new message
+var ErrSendQueueFull = errors.New("transport: send queue full")
+
+// DropPolicy selects which message an async send queue discards when full
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "drop-oldest" // Evict the oldest queued message (keeps audio current)
+	DropNewest DropPolicy = "drop-newest" // Refuse the new message
+)
+
+// SendQueueConfig holds async send queue settings
+type SendQueueConfig struct {
+	Size   int        `json:"size"`   // Messages buffered before the drop policy applies
+	Policy DropPolicy `json:"policy"` // "drop-oldest" (default) or "drop-newest"
+}
+
+// DefaultSendQueueConfig buffers a little over a second of 20ms voice frames
+func DefaultSendQueueConfig() *SendQueueConfig {
+	return &SendQueueConfig{
+		Size:   64,
+		Policy: DropOldest,
+	}
+}
+
+// validate checks the drop policy; a nil config is valid
+func (c *SendQueueConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.Policy {
+	case "", DropOldest, DropNewest:
+		return nil
+	}
+	return fmt.Errorf("unknown drop policy %q", c.Policy)
+}
+
+// SendQueueStats holds async send queue counters
+type SendQueueStats struct {
+	Queued  uint64 `json:"queued"`
+	Sent    uint64 `json:"sent"`
+	Failed  uint64 `json:"failed"`  // Dequeued but SendMessage returned an error
+	Dropped uint64 `json:"dropped"` // Discarded by the drop policy
+	Depth   int    `json:"depth"`   // Messages waiting now
+}
+
+// sendQueue is a bounded queue drained by its own goroutine, so callers of
+// SendMessageAsync never wait on a slow or blackholed destination. Embed it
+// to provide SendQueueStats; the goroutine starts on the first push.
+type sendQueue struct {
+	mutex  sync.Mutex
+	queue  chan usrp.Message // nil until the first push
+	done   chan struct{}
+	policy DropPolicy
+	closed bool
+
+	queued  uint64 // atomic
+	sent    uint64 // atomic
+	failed  uint64 // atomic
+	dropped uint64 // atomic
+}
+
+// push queues msg for send, applying the drop policy when the queue is full
+func (q *sendQueue) push(msg usrp.Message, config *SendQueueConfig, send func(usrp.Message) error) error {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return fmt.Errorf("connection is closed")
+	}
+	if q.queue == nil {
+		cfg := *DefaultSendQueueConfig()
+		if config != nil {
+			if config.Size > 0 {
+				cfg.Size = config.Size
+			}
+			if config.Policy != "" {
+				cfg.Policy = config.Policy
+			}
+		}
+		q.queue = make(chan usrp.Message, cfg.Size)
+		q.done = make(chan struct{})
+		q.policy = cfg.Policy
+		go q.run(q.queue, q.done, send)
+	}
+	queue, policy := q.queue, q.policy
+	q.mutex.Unlock()
+
+	for {
+		select {
+		case queue <- msg:
+			atomic.AddUint64(&q.queued, 1)
+			return nil
+		default:
+		}
+
+		if policy == DropNewest {
+			atomic.AddUint64(&q.dropped, 1)
+			return ErrSendQueueFull
+		}
+		// Make room; the sender goroutine may have done so already
+		select {
+		case <-queue:
+			atomic.AddUint64(&q.dropped, 1)
+		default:
+		}
+	}
+}
+
+// run sends queued messages until the queue is closed
+func (q *sendQueue) run(queue chan usrp.Message, done chan struct{}, send func(usrp.Message) error) {
+	for {
+		select {
+		case <-done:
+			return
+		case msg := <-queue:
+			if err := send(msg); err != nil {
+				atomic.AddUint64(&q.failed, 1)
+				continue
+			}
+			atomic.AddUint64(&q.sent, 1)
+		}
+	}
+}
+
+// close stops the sender goroutine, discarding anything still queued
+func (q *sendQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	if q.done != nil {
+		close(q.done)
+	}
+}
+
+// SendQueueStats returns the async send queue counters
+func (q *sendQueue) SendQueueStats() SendQueueStats {
+	q.mutex.Lock()
+	depth := len(q.queue)
+	q.mutex.Unlock()
+
+	return SendQueueStats{
+		Queued:  atomic.LoadUint64(&q.queued),
+		Sent:    atomic.LoadUint64(&q.sent),
+		Failed:  atomic.LoadUint64(&q.failed),
+		Dropped: atomic.LoadUint64(&q.dropped),
+		Depth:   depth,
+	}
+}
@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// blockedSender stands in for a blackholed destination: each send waits
+// until released, reporting what it sent
+type blockedSender struct {
+	release chan struct{}
+	sent    chan uint32
+}
+
+func newBlockedSender() *blockedSender {
+	return &blockedSender{release: make(chan struct{}), sent: make(chan uint32, 16)}
+}
+
+func (b *blockedSender) send(msg usrp.Message) error {
+	<-b.release
+	b.sent <- usrp.HeaderOf(msg).Seq
+	return nil
+}
+
+func queuedPing(seq uint32) usrp.Message {
+	return &usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, seq)}
+}
+
+// fillQueue pushes seq 1, waits for the sender goroutine to take it, then
+// pushes seqs 2..n without blocking
+func fillQueue(t *testing.T, q *sendQueue, config *SendQueueConfig, sender *blockedSender, n uint32) []error {
+	t.Helper()
+
+	if err := q.push(queuedPing(1), config, sender.send); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for q.SendQueueStats().Depth > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		for seq := uint32(2); seq <= n; seq++ {
+			errs = append(errs, q.push(queuedPing(seq), config, sender.send))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("SendMessageAsync blocked on a stalled destination")
+	}
+	return errs
+}
+
+func TestSendQueue_DropOldest(t *testing.T) {
+	var q sendQueue
+	defer q.close()
+	sender := newBlockedSender()
+	config := &SendQueueConfig{Size: 3, Policy: DropOldest}
+
+	for _, err := range fillQueue(t, &q, config, sender, 6) {
+		if err != nil {
+			t.Errorf("Drop-oldest should accept every message, got %v", err)
+		}
+	}
+
+	// The queue holds the three newest; 2 and 3 were evicted
+	close(sender.release)
+	for _, want := range []uint32{1, 4, 5, 6} {
+		select {
+		case seq := <-sender.sent:
+			if seq != want {
+				t.Errorf("Expected seq %d, got %d", want, seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for seq %d", want)
+		}
+	}
+
+	stats := q.SendQueueStats()
+	if stats.Queued != 6 || stats.Dropped != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestSendQueue_DropNewest(t *testing.T) {
+	var q sendQueue
+	defer q.close()
+	sender := newBlockedSender()
+	config := &SendQueueConfig{Size: 3, Policy: DropNewest}
+
+	errs := fillQueue(t, &q, config, sender, 6)
+	for i, err := range errs {
+		full := i >= 3
+		if full != errors.Is(err, ErrSendQueueFull) {
+			t.Errorf("Push of seq %d: unexpected result %v", i+2, err)
+		}
+	}
+
+	close(sender.release)
+	for _, want := range []uint32{1, 2, 3, 4} {
+		select {
+		case seq := <-sender.sent:
+			if seq != want {
+				t.Errorf("Expected seq %d, got %d", want, seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for seq %d", want)
+		}
+	}
+
+	if stats := q.SendQueueStats(); stats.Dropped != 2 || stats.Depth != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestSendQueue_Closed(t *testing.T) {
+	var q sendQueue
+	q.close()
+	if err := q.push(queuedPing(1), nil, func(usrp.Message) error { return nil }); err == nil {
+		t.Error("Expected push after close to fail")
+	}
+}
+
+func TestSendQueueConfig_Validate(t *testing.T) {
+	if _, err := NewUDPConnection(&ConnectionConfig{SendQueue: &SendQueueConfig{Policy: "drop-random"}}); err == nil {
+		t.Error("Expected unknown drop policy to be rejected")
+	}
+}
+
+func TestUDPConnection_SendMessageAsync(t *testing.T) {
+	receiver, sender := newUDPPair(t)
+
+	for i := 0; i < 3; i++ {
+		text := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, 0), Text: []byte("queued")}
+		if err := sender.SendMessageAsync(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for want := uint32(1); want <= 3; want++ {
+		msg, err := receiver.ReceiveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq := usrp.HeaderOf(msg).Seq; seq != want {
+			t.Errorf("Expected seq %d, got %d", want, seq)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for sender.SendQueueStats().Sent < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := sender.SendQueueStats(); stats.Queued != 3 || stats.Sent != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	sender.Close()
+	if err := sender.SendMessageAsync(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err == nil {
+		t.Error("Expected SendMessageAsync on a closed connection to fail")
+	}
+}
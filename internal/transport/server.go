@@ -0,0 +1,603 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// PeerHandler handles a packet received from a server peer
+type PeerHandler func(*Peer, *usrp.Received) error
+
+// ServerConfig holds configuration for a multi-peer UDP server
+type ServerConfig struct {
+	ListenAddr  string
+	IdleTimeout time.Duration // Peers silent for this long are expired
+	QueueSize   int           // Messages buffered per peer before drops
+
+	// Socket tuning, as in ConnectionConfig
+	ReadBufferSize  int
+	WriteBufferSize int
+	DSCP            int
+	ReusePort       bool
+	IPVersion       IPVersion
+
+	// BatchSize is the number of datagrams read per recvmmsg and written per
+	// sendmmsg on Linux (0 = DefaultBatchSize, 1 = one per system call)
+	BatchSize int
+
+	// RateLimit drops packets from sources exceeding a packet or byte rate
+	// before they reach a peer (nil = unlimited)
+	RateLimit *RateLimitConfig
+
+	// Dedupe drops packets repeating a sequence number recently seen from
+	// the same peer (nil = deliver duplicates)
+	Dedupe *DedupeConfig
+
+	// ACL drops packets from sources outside the configured networks
+	// before they are parsed or create a peer (nil = accept all)
+	ACL *ACLConfig
+
+	// Encryption seals every datagram with AES-GCM under a pre-shared key;
+	// packets that fail to decrypt never create a peer (nil = plaintext)
+	Encryption *EncryptionConfig
+
+	// Metrics receives counters for the server socket as a whole (nil = a
+	// private AtomicMetrics, read through the server's Metrics method)
+	Metrics Metrics
+}
+
+// DefaultServerConfig returns a default server configuration
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		ListenAddr:  ":0",
+		IdleTimeout: 30 * time.Second,
+		QueueSize:   64,
+	}
+}
+
+// PeerInfo is a point-in-time copy of a peer's state
+type PeerInfo struct {
+	Addr        string    `json:"addr"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Packets     uint64    `json:"packets"`
+	Bytes       uint64    `json:"bytes"`
+	Dropped     uint64    `json:"dropped"`      // Messages dropped because the peer's queue was full
+	RateLimited uint64    `json:"rate_limited"` // Packets dropped by the server's rate limit
+	Duplicates  uint64    `json:"duplicates"`   // Packets dropped as duplicates
+}
+
+// Peer is one remote address talking to a Server. Messages from a peer are
+// handled in order on the peer's own goroutine, so a slow peer does not
+// hold up the others.
+type Peer struct {
+	server *Server
+	addr   *net.UDPAddr
+	queue  chan *usrp.Received
+
+	handlers     map[usrp.PacketType]MessageHandler
+	handlerMutex sync.RWMutex
+
+	info       PeerInfo
+	infoMutex  sync.Mutex
+	sequence   uint32
+	seqMutex   sync.Mutex
+	expireOnce sync.Once
+}
+
+// Addr returns the peer's address
+func (p *Peer) Addr() *net.UDPAddr {
+	return p.addr
+}
+
+// String returns the peer's address as a string
+func (p *Peer) String() string {
+	return p.addr.String()
+}
+
+// Info returns a copy of the peer's state
+func (p *Peer) Info() PeerInfo {
+	p.infoMutex.Lock()
+	defer p.infoMutex.Unlock()
+	return p.info
+}
+
+// RegisterHandler registers a handler for this peer only, taking precedence
+// over the server's handler for the same packet type
+func (p *Peer) RegisterHandler(packetType usrp.PacketType, handler MessageHandler) {
+	p.handlerMutex.Lock()
+	defer p.handlerMutex.Unlock()
+	p.handlers[packetType] = handler
+}
+
+// SendMessage sends a USRP message to this peer from the server's socket,
+// numbered with the peer's own sequence
+func (p *Peer) SendMessage(msg usrp.Message) error {
+	data, err := p.marshal(msg)
+	if err != nil {
+		return err
+	}
+	return p.server.writeTo(data, p.addr)
+}
+
+// marshal numbers msg with the peer's next sequence number and encodes it
+func (p *Peer) marshal(msg usrp.Message) ([]byte, error) {
+	if err := msg.Validate(); err != nil {
+		return nil, fmt.Errorf("message validation failed: %w", err)
+	}
+
+	p.seqMutex.Lock()
+	p.sequence++
+	seq := p.sequence
+	p.seqMutex.Unlock()
+	if header := usrp.HeaderOf(msg); header != nil {
+		header.Seq = seq
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return p.server.cipher.Seal(data), nil
+}
+
+// run handles queued messages until the peer expires
+func (p *Peer) run() {
+	for rx := range p.queue {
+		p.handlerMutex.RLock()
+		handler, exists := p.handlers[rx.Type()]
+		p.handlerMutex.RUnlock()
+
+		var err error
+		if exists {
+			err = handler(rx.Message)
+		} else {
+			err = p.server.handle(p, rx)
+		}
+		if err != nil {
+			log.Printf("USRP handler error from %s: %v", p, err)
+		}
+	}
+}
+
+// Server listens on one UDP port and tracks each remote address as a
+// distinct peer, so several AllStarLink nodes can share a port.
+type Server struct {
+	config  *ServerConfig
+	conn    *net.UDPConn
+	batch   batchConn
+	limiter *RateLimiter
+	acl     *ACL
+	dedupe  *Deduper
+	cipher  *PacketCipher
+	metrics Metrics
+
+	peers     map[string]*Peer
+	peerMutex sync.RWMutex
+
+	handlers     map[usrp.PacketType]PeerHandler
+	handlerMutex sync.RWMutex
+	onPeer       func(*Peer)
+	onExpire     func(*Peer)
+
+	writeMutex sync.Mutex
+}
+
+// NewServer creates a new multi-peer UDP server
+func NewServer(config *ServerConfig) *Server {
+	if config == nil {
+		config = DefaultServerConfig()
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultServerConfig().IdleTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultServerConfig().QueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+
+	return &Server{
+		config:   config,
+		limiter:  NewRateLimiter(config.RateLimit),
+		dedupe:   NewDeduper(config.Dedupe),
+		metrics:  metricsOrDefault(config.Metrics),
+		peers:    make(map[string]*Peer),
+		handlers: make(map[usrp.PacketType]PeerHandler),
+	}
+}
+
+// Listen opens the server's UDP socket
+func (s *Server) Listen() error {
+	if err := s.config.IPVersion.validate(); err != nil {
+		return err
+	}
+
+	acl, err := NewACL(s.config.ACL)
+	if err != nil {
+		return fmt.Errorf("invalid acl config: %w", err)
+	}
+	s.acl = acl
+
+	packetCipher, err := NewPacketCipher(s.config.Encryption)
+	if err != nil {
+		return fmt.Errorf("invalid encryption config: %w", err)
+	}
+	s.cipher = packetCipher
+
+	addr, err := net.ResolveUDPAddr(s.config.IPVersion.network("udp"), s.config.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve listen address: %w", err)
+	}
+
+	socket := &ConnectionConfig{
+		ReadBufferSize:  s.config.ReadBufferSize,
+		WriteBufferSize: s.config.WriteBufferSize,
+		DSCP:            s.config.DSCP,
+		ReusePort:       s.config.ReusePort,
+	}
+	lc := net.ListenConfig{Control: socketControl(socket)}
+	network := bindNetwork("udp", addr.IP, nil, s.config.IPVersion)
+	packetConn, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	conn := packetConn.(*net.UDPConn)
+	if err := applyBuffers(conn, socket); err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn = conn
+	s.batch = newBatchConn(conn, s.config.BatchSize)
+	return nil
+}
+
+// RegisterHandler registers a handler for a packet type from any peer
+func (s *Server) RegisterHandler(packetType usrp.PacketType, handler PeerHandler) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+	s.handlers[packetType] = handler
+}
+
+// OnPeer sets a callback run when a new peer sends its first packet, before
+// that packet is handled. Per-peer handlers can be registered here.
+func (s *Server) OnPeer(callback func(*Peer)) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+	s.onPeer = callback
+}
+
+// OnPeerExpired sets a callback run when a peer is removed for inactivity
+func (s *Server) OnPeerExpired(callback func(*Peer)) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+	s.onExpire = callback
+}
+
+// handle runs the server-wide handler for a peer packet
+func (s *Server) handle(p *Peer, rx *usrp.Received) error {
+	s.handlerMutex.RLock()
+	handler, exists := s.handlers[rx.Type()]
+	s.handlerMutex.RUnlock()
+
+	if !exists {
+		return nil
+	}
+	return handler(p, rx)
+}
+
+// Start reads packets and dispatches them to peers until the context is
+// cancelled
+func (s *Server) Start(ctx context.Context) error {
+	if s.conn == nil {
+		return fmt.Errorf("server not listening")
+	}
+
+	dgrams := make([]datagram, s.config.BatchSize)
+	for i := range dgrams {
+		dgrams[i].data = make([]byte, usrp.CurrentLimits().MaxPacketSize+s.cipher.Overhead())
+	}
+	lastSweep := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.expireAll()
+			return ctx.Err()
+		default:
+		}
+
+		if time.Since(lastSweep) >= time.Second {
+			s.expireIdle(time.Now())
+			lastSweep = time.Now()
+		}
+
+		if err := s.conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return fmt.Errorf("failed to set read deadline: %w", err)
+		}
+
+		count, err := s.batch.readBatch(dgrams)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			s.metrics.Error()
+			s.expireAll()
+			return fmt.Errorf("failed to read UDP packet: %w", err)
+		}
+
+		now := time.Now()
+		for i := 0; i < count; i++ {
+			s.ingest(dgrams[i].data[:dgrams[i].n], dgrams[i].addr, now)
+		}
+	}
+}
+
+// ingest filters, parses and queues one received packet
+func (s *Server) ingest(data []byte, addr *net.UDPAddr, now time.Time) {
+	s.metrics.PacketIn(len(data))
+
+	// Filtered and over-limit packets are dropped before parsing
+	if !s.acl.Permit(addr) {
+		s.metrics.Drop()
+		return
+	}
+	if !s.limiter.Allow(addr, len(data), now) {
+		s.metrics.Drop()
+		if peer := s.Peer(addr.String()); peer != nil {
+			peer.infoMutex.Lock()
+			peer.info.RateLimited++
+			peer.infoMutex.Unlock()
+		}
+		return
+	}
+
+	packet, err := s.cipher.Open(data)
+	if err != nil {
+		s.metrics.Drop()
+		return
+	}
+	rx, err := usrp.ParseReceived(packet, addr, now)
+	if err != nil {
+		s.metrics.Drop()
+		return
+	}
+
+	peer := s.peerFor(addr, now)
+	peer.infoMutex.Lock()
+	peer.info.LastSeen = now
+	peer.info.Packets++
+	peer.info.Bytes += uint64(len(data))
+	peer.infoMutex.Unlock()
+
+	if s.dedupe.Duplicate(addr, rx.Message, now) {
+		s.metrics.Drop()
+		peer.infoMutex.Lock()
+		peer.info.Duplicates++
+		peer.infoMutex.Unlock()
+		return
+	}
+
+	select {
+	case peer.queue <- rx:
+	default:
+		s.metrics.Drop()
+		peer.infoMutex.Lock()
+		peer.info.Dropped++
+		peer.infoMutex.Unlock()
+	}
+}
+
+// peerFor returns the peer for addr, creating it on first contact
+func (s *Server) peerFor(addr *net.UDPAddr, now time.Time) *Peer {
+	key := addr.String()
+
+	s.peerMutex.RLock()
+	peer, exists := s.peers[key]
+	s.peerMutex.RUnlock()
+	if exists {
+		return peer
+	}
+
+	peer = &Peer{
+		server:   s,
+		addr:     addr,
+		queue:    make(chan *usrp.Received, s.config.QueueSize),
+		handlers: make(map[usrp.PacketType]MessageHandler),
+		info:     PeerInfo{Addr: key, FirstSeen: now, LastSeen: now},
+	}
+
+	s.handlerMutex.RLock()
+	onPeer := s.onPeer
+	s.handlerMutex.RUnlock()
+	if onPeer != nil {
+		onPeer(peer)
+	}
+
+	s.peerMutex.Lock()
+	s.peers[key] = peer
+	s.peerMutex.Unlock()
+
+	go peer.run()
+	return peer
+}
+
+// expireIdle removes peers silent for longer than the idle timeout
+func (s *Server) expireIdle(now time.Time) {
+	var expired []*Peer
+
+	s.peerMutex.Lock()
+	for key, peer := range s.peers {
+		if now.Sub(peer.Info().LastSeen) > s.config.IdleTimeout {
+			delete(s.peers, key)
+			expired = append(expired, peer)
+		}
+	}
+	s.peerMutex.Unlock()
+
+	for _, peer := range expired {
+		s.expire(peer)
+	}
+}
+
+// expireAll removes every peer
+func (s *Server) expireAll() {
+	s.peerMutex.Lock()
+	peers := s.peers
+	s.peers = make(map[string]*Peer)
+	s.peerMutex.Unlock()
+
+	for _, peer := range peers {
+		s.expire(peer)
+	}
+}
+
+// expire stops a removed peer's goroutine and notifies the callback
+func (s *Server) expire(peer *Peer) {
+	peer.expireOnce.Do(func() {
+		close(peer.queue)
+
+		s.handlerMutex.RLock()
+		onExpire := s.onExpire
+		s.handlerMutex.RUnlock()
+		if onExpire != nil {
+			onExpire(peer)
+		}
+	})
+}
+
+// Peer returns the active peer with the given address, or nil
+func (s *Server) Peer(addr string) *Peer {
+	s.peerMutex.RLock()
+	defer s.peerMutex.RUnlock()
+	return s.peers[addr]
+}
+
+// Peers returns a snapshot of the active peers sorted by address
+func (s *Server) Peers() []PeerInfo {
+	s.peerMutex.RLock()
+	infos := make([]PeerInfo, 0, len(s.peers))
+	for _, peer := range s.peers {
+		infos = append(infos, peer.Info())
+	}
+	s.peerMutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr < infos[j].Addr })
+	return infos
+}
+
+// RateLimitStats returns the rate limiter counters, or zero values when no
+// rate limit is configured
+func (s *Server) RateLimitStats() RateLimitStats {
+	return s.limiter.Stats()
+}
+
+// DedupeStats returns the duplicate filter counters, or zero values when
+// no filter is configured
+func (s *Server) DedupeStats() DedupeStats {
+	return s.dedupe.Stats()
+}
+
+// EncryptionStats returns the packet cipher counters, or zero values when
+// encryption is off
+func (s *Server) EncryptionStats() EncryptionStats {
+	return s.cipher.Stats()
+}
+
+// Metrics returns the server's link metrics
+func (s *Server) Metrics() Metrics {
+	return s.metrics
+}
+
+// ACLStats returns the ACL counters, or zero values when no ACL is configured
+func (s *Server) ACLStats() ACLStats {
+	return s.acl.Stats()
+}
+
+// Broadcast sends a message to every active peer except the one given. On
+// Linux the copies go out in batches of BatchSize per system call.
+func (s *Server) Broadcast(msg usrp.Message, except *Peer) error {
+	if s.conn == nil {
+		return fmt.Errorf("server not listening")
+	}
+
+	s.peerMutex.RLock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		if peer != except {
+			peers = append(peers, peer)
+		}
+	}
+	s.peerMutex.RUnlock()
+
+	// Each peer has its own sequence, so every copy is encoded separately
+	var firstErr error
+	dgrams := make([]datagram, 0, len(peers))
+	for _, peer := range peers {
+		data, err := peer.marshal(msg)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		dgrams = append(dgrams, datagram{data: data, addr: peer.addr})
+	}
+
+	s.writeMutex.Lock()
+	_, err := s.batch.writeBatch(dgrams)
+	s.writeMutex.Unlock()
+	for _, d := range dgrams {
+		if d.n > 0 {
+			s.metrics.PacketOut(d.n)
+		} else {
+			s.metrics.Error()
+		}
+	}
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to send UDP packet: %w", err)
+	}
+	return firstErr
+}
+
+// writeTo sends raw packet data to addr
+func (s *Server) writeTo(data []byte, addr *net.UDPAddr) error {
+	if s.conn == nil {
+		return fmt.Errorf("server not listening")
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if _, err := s.conn.WriteToUDP(data, addr); err != nil {
+		s.metrics.Error()
+		return fmt.Errorf("failed to send UDP packet: %w", err)
+	}
+	s.metrics.PacketOut(len(data))
+	return nil
+}
+
+// LocalAddr returns the server's listening address
+func (s *Server) LocalAddr() net.Addr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+// Close closes the server socket; Start returns and all peers expire
+func (s *Server) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
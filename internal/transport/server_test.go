@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestServer_DemultiplexesPeers(t *testing.T) {
+	server := NewServer(&ServerConfig{ListenAddr: "127.0.0.1:0", IdleTimeout: 300 * time.Millisecond})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var mutex sync.Mutex
+	counts := make(map[string]int)
+	perPeer := 0
+	expired := make(chan string, 2)
+
+	server.RegisterHandler(usrp.USRP_TYPE_VOICE, func(p *Peer, rx *usrp.Received) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		counts[p.String()]++
+		return nil
+	})
+
+	// Each new peer gets its own TLV handler
+	server.OnPeer(func(p *Peer) {
+		p.RegisterHandler(usrp.USRP_TYPE_TLV, func(msg usrp.Message) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			perPeer++
+			return nil
+		})
+	})
+	server.OnPeerExpired(func(p *Peer) { expired <- p.String() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+
+	nodeA, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nodeA.Close()
+	nodeB, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nodeB.Close()
+
+	voice, err := (&usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 1)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlvMsg, err := usrp.NewTLV(1).Callsign("N0CALL").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlv, err := tlvMsg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		nodeA.Write(voice)
+	}
+	nodeA.Write(tlv)
+	nodeB.Write(voice)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.Peers()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	peers := server.Peers()
+	if len(peers) != 2 {
+		t.Fatalf("Expected 2 peers, got %+v", peers)
+	}
+
+	// Reply to one peer only
+	peerA := server.Peer(nodeA.LocalAddr().String())
+	if peerA == nil {
+		t.Fatal("Peer A not tracked")
+	}
+	if err := peerA.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	nodeA.SetReadDeadline(time.Now().Add(time.Second))
+	buffer := make([]byte, 512)
+	n, err := nodeA.Read(buffer)
+	if err != nil {
+		t.Fatalf("Peer A reply not received: %v", err)
+	}
+	if msg, err := usrp.Parse(buffer[:n]); err != nil || msg.GetType() != usrp.USRP_TYPE_PING {
+		t.Errorf("Unexpected reply: %v %v", msg, err)
+	}
+
+	// Both peers go idle and expire
+	for i := 0; i < 2; i++ {
+		select {
+		case <-expired:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Peers did not expire")
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if counts[nodeA.LocalAddr().String()] != 3 || counts[nodeB.LocalAddr().String()] != 1 {
+		t.Errorf("Unexpected per-peer counts: %v", counts)
+	}
+	if perPeer != 1 {
+		t.Errorf("Per-peer TLV handler ran %d times, want 1", perPeer)
+	}
+	if len(server.Peers()) != 0 {
+		t.Errorf("Expected no peers after expiry, got %+v", server.Peers())
+	}
+}
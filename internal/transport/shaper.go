@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket is a simple token bucket refilled continuously at rate tokens
+// per second up to burst tokens. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// refill adds the tokens accumulated since the last call
+func (tb *tokenBucket) refill(now time.Time) {
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+}
+
+// allowN consumes n tokens if available
+func (tb *tokenBucket) allowN(now time.Time, n float64) bool {
+	tb.refill(now)
+	if tb.tokens < n {
+		return false
+	}
+	tb.tokens -= n
+	return true
+}
+
+// delay returns how long until n tokens are available
+func (tb *tokenBucket) delay(now time.Time, n float64) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= n || tb.rate <= 0 {
+		return 0
+	}
+	return time.Duration((n - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// ShaperConfig holds per-destination traffic shaping limits
+type ShaperConfig struct {
+	MaxPPS int `json:"max_pps"` // Sustained packets per second (0 = unlimited)
+	Burst  int `json:"burst"`   // Packets allowed back-to-back above the sustained rate
+}
+
+// Shaper limits the packet rate toward a single destination. It is
+// independent of pacing: a paced stream runs at 50 pps, but several mixed
+// sources can still exceed what a low-powered endpoint can absorb.
+type Shaper struct {
+	bucket  *tokenBucket
+	mutex   sync.Mutex
+	passed  uint64
+	dropped uint64
+}
+
+// NewShaper creates a shaper from the given configuration. A nil config or a
+// zero MaxPPS returns nil, which callers treat as "unlimited".
+func NewShaper(config *ShaperConfig) *Shaper {
+	if config == nil || config.MaxPPS <= 0 {
+		return nil
+	}
+
+	burst := config.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &Shaper{
+		bucket: newTokenBucket(float64(config.MaxPPS), float64(burst)),
+	}
+}
+
+// Allow reports whether a packet may be sent now, consuming a token if so
+func (s *Shaper) Allow() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mutex.Lock()
+	ok := s.bucket.allowN(time.Now(), 1)
+	s.mutex.Unlock()
+
+	if ok {
+		atomic.AddUint64(&s.passed, 1)
+	} else {
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return ok
+}
+
+// Wait blocks until a packet may be sent or the context is cancelled
+func (s *Shaper) Wait(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		wait := s.bucket.delay(now, 1)
+		if wait == 0 && s.bucket.allowN(now, 1) {
+			s.mutex.Unlock()
+			atomic.AddUint64(&s.passed, 1)
+			return nil
+		}
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Stats returns the number of packets passed and dropped by Allow
+func (s *Shaper) Stats() (passed, dropped uint64) {
+	if s == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&s.passed), atomic.LoadUint64(&s.dropped)
+}
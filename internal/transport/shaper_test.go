@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShaper_Burst(t *testing.T) {
+	shaper := NewShaper(&ShaperConfig{MaxPPS: 10, Burst: 3})
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if shaper.Allow() {
+			allowed++
+		}
+	}
+
+	if allowed != 3 {
+		t.Errorf("Expected burst of 3 packets, got %d", allowed)
+	}
+
+	passed, dropped := shaper.Stats()
+	if passed != 3 || dropped != 7 {
+		t.Errorf("Unexpected stats: passed=%d dropped=%d", passed, dropped)
+	}
+}
+
+func TestShaper_Refill(t *testing.T) {
+	shaper := NewShaper(&ShaperConfig{MaxPPS: 100, Burst: 1})
+
+	if !shaper.Allow() {
+		t.Fatal("First packet should pass")
+	}
+	if shaper.Allow() {
+		t.Fatal("Second immediate packet should be shaped")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !shaper.Allow() {
+		t.Error("Packet should pass after refill interval")
+	}
+}
+
+func TestShaper_Wait(t *testing.T) {
+	shaper := NewShaper(&ShaperConfig{MaxPPS: 50, Burst: 1})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := shaper.Wait(ctx); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	// 1 burst token + 2 refills at 20ms each
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait returned too quickly: %v", elapsed)
+	}
+}
+
+func TestShaper_Unlimited(t *testing.T) {
+	var shaper *Shaper = NewShaper(nil)
+	for i := 0; i < 1000; i++ {
+		if !shaper.Allow() {
+			t.Fatal("Nil shaper must never drop")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// DSCP code points commonly used for radio traffic
+const (
+	DSCPDefault   = 0  // Best effort (unmarked)
+	DSCPExpedited = 46 // EF, for voice
+	DSCPSignaling = 24 // CS3, for control and signaling
+)
+
+// bufferSetter is implemented by *net.UDPConn and *net.TCPConn
+type bufferSetter interface {
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
+// applyBuffers sets the socket buffer sizes from the config
+func applyBuffers(conn net.Conn, config *ConnectionConfig) error {
+	setter, ok := conn.(bufferSetter)
+	if !ok {
+		return nil
+	}
+	if config.ReadBufferSize > 0 {
+		if err := setter.SetReadBuffer(config.ReadBufferSize); err != nil {
+			return fmt.Errorf("failed to set read buffer: %w", err)
+		}
+	}
+	if config.WriteBufferSize > 0 {
+		if err := setter.SetWriteBuffer(config.WriteBufferSize); err != nil {
+			return fmt.Errorf("failed to set write buffer: %w", err)
+		}
+	}
+	return nil
+}
+
+// socketControl returns a dial/listen Control function applying the
+// config's DSCP marking and SO_REUSEPORT before the socket is bound, or nil
+// when neither is set
+func socketControl(config *ConnectionConfig) func(network, address string, c syscall.RawConn) error {
+	if config.DSCP == 0 && !config.ReusePort {
+		return nil
+	}
+	if config.DSCP < 0 || config.DSCP > 63 {
+		return func(string, string, syscall.RawConn) error {
+			return fmt.Errorf("dscp %d out of range 0-63", config.DSCP)
+		}
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if config.ReusePort {
+				if sockErr = setReusePort(fd); sockErr != nil {
+					return
+				}
+			}
+			if config.DSCP != 0 {
+				// DSCP occupies the upper six bits of the TOS/traffic class byte
+				sockErr = setTOS(fd, network, config.DSCP<<2)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
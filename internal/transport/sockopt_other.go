@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package transport
+
+import "fmt"
+
+// setReusePort is not supported on this platform
+func setReusePort(fd uintptr) error {
+	return fmt.Errorf("SO_REUSEPORT is not supported on this platform")
+}
+
+// setTOS is not supported on this platform
+func setTOS(fd uintptr, network string, tos int) error {
+	return fmt.Errorf("DSCP marking is not supported on this platform")
+}
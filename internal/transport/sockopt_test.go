@@ -0,0 +1,71 @@
+//go:build linux
+
+package transport
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUDPConnection_SocketOptions(t *testing.T) {
+	config := &ConnectionConfig{
+		LocalAddr:       "127.0.0.1:0",
+		ReadBufferSize:  128 * 1024,
+		WriteBufferSize: 128 * 1024,
+		DSCP:            DSCPExpedited,
+		ReusePort:       true,
+	}
+	first, err := NewUDPConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer first.Close()
+
+	raw, err := first.conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tos, reuse, rcvbuf int
+	raw.Control(func(fd uintptr) {
+		tos, _ = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS)
+		reuse, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT)
+		rcvbuf, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	})
+	if tos != DSCPExpedited<<2 {
+		t.Errorf("IP_TOS = %#x, want %#x", tos, DSCPExpedited<<2)
+	}
+	if reuse != 1 {
+		t.Errorf("SO_REUSEPORT = %d, want 1", reuse)
+	}
+	// Linux doubles the requested size; the rmem_max cap may lower it
+	if rcvbuf <= 0 {
+		t.Errorf("SO_RCVBUF = %d", rcvbuf)
+	}
+
+	// A second socket can share the port
+	shared := *config
+	shared.LocalAddr = first.LocalAddr().String()
+	second, err := NewUDPConnection(&shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Connect(); err != nil {
+		t.Fatalf("Second bind with SO_REUSEPORT failed: %v", err)
+	}
+	second.Close()
+}
+
+func TestSocketControl_InvalidDSCP(t *testing.T) {
+	conn, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0", DSCP: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Connect(); err == nil {
+		conn.Close()
+		t.Error("Expected error for out-of-range DSCP")
+	}
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package transport
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// setReusePort enables SO_REUSEPORT on a socket
+func setReusePort(fd uintptr) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+		return fmt.Errorf("failed to set SO_REUSEPORT: %w", err)
+	}
+	return nil
+}
+
+// setTOS sets the IPv4 TOS byte, and the IPv6 traffic class where the
+// socket may carry IPv6
+func setTOS(fd uintptr, network string, tos int) error {
+	if !strings.HasSuffix(network, "6") {
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, tos); err != nil {
+			return fmt.Errorf("failed to set IP_TOS: %w", err)
+		}
+	}
+	if !strings.HasSuffix(network, "4") {
+		// Fails harmlessly on IPv4-only sockets
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos); err != nil && strings.HasSuffix(network, "6") {
+			return fmt.Errorf("failed to set IPV6_TCLASS: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnectionState is the link state of a connection-oriented transport
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota // Not yet connected
+	StateConnected                           // First connection established
+	StateDegraded                            // Up, but sends are timing out
+	StateLost                                // Link dropped; reconnecting
+	StateReconnected                         // Link restored after a loss
+)
+
+// String returns the state name
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateDegraded:
+		return "degraded"
+	case StateLost:
+		return "lost"
+	case StateReconnected:
+		return "reconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// Up reports whether the link can carry traffic
+func (s ConnectionState) Up() bool {
+	return s == StateConnected || s == StateDegraded || s == StateReconnected
+}
+
+// StateEvent describes a connection state transition
+type StateEvent struct {
+	From ConnectionState
+	To   ConnectionState
+	Err  error // Cause of a Degraded or Lost transition
+	Time time.Time
+}
+
+// StateNotifier is implemented by transports with a link lifecycle (TCP,
+// DTLS), so callers can log or alert on link loss
+type StateNotifier interface {
+	OnStateChange(func(StateEvent))
+	State() ConnectionState
+}
+
+// linkState tracks a connection's state and notifies listeners on change.
+// Embed it to implement StateNotifier.
+type linkState struct {
+	mutex     sync.Mutex
+	state     ConnectionState
+	wasUp     bool
+	listeners []func(StateEvent)
+}
+
+// OnStateChange registers a callback run on every state transition.
+// Callbacks run synchronously and must not block.
+func (ls *linkState) OnStateChange(callback func(StateEvent)) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.listeners = append(ls.listeners, callback)
+}
+
+// State returns the current state
+func (ls *linkState) State() ConnectionState {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	return ls.state
+}
+
+// up records a successful (re)connection
+func (ls *linkState) up() {
+	ls.mutex.Lock()
+	next := StateConnected
+	if ls.wasUp {
+		next = StateReconnected
+	}
+	ls.wasUp = true
+	ls.mutex.Unlock()
+	ls.set(next, nil)
+}
+
+// healthy clears a Degraded state after traffic flows again
+func (ls *linkState) healthy() {
+	if ls.State() == StateDegraded {
+		ls.set(StateConnected, nil)
+	}
+}
+
+// set moves to state, notifying listeners if it changed
+func (ls *linkState) set(state ConnectionState, err error) {
+	ls.mutex.Lock()
+	if ls.state == state {
+		ls.mutex.Unlock()
+		return
+	}
+	event := StateEvent{From: ls.state, To: state, Err: err, Time: time.Now()}
+	ls.state = state
+	listeners := append([]func(StateEvent){}, ls.listeners...)
+	ls.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// BackoffConfig holds exponential backoff settings for redialing
+type BackoffConfig struct {
+	Initial    time.Duration `json:"initial"`    // First retry delay
+	Max        time.Duration `json:"max"`        // Upper bound on the delay
+	Multiplier float64       `json:"multiplier"` // Growth factor per failed attempt
+	Jitter     float64       `json:"jitter"`     // Random spread as a fraction of the delay (0-1)
+}
+
+// DefaultBackoffConfig returns a backoff from 1s up to 1 minute
+func DefaultBackoffConfig() *BackoffConfig {
+	return &BackoffConfig{
+		Initial:    time.Second,
+		Max:        time.Minute,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// Backoff produces exponentially growing retry delays. It is not safe for
+// concurrent use.
+type Backoff struct {
+	config  BackoffConfig
+	attempt int
+}
+
+// NewBackoff creates a backoff. A nil config uses DefaultBackoffConfig.
+func NewBackoff(config *BackoffConfig) *Backoff {
+	if config == nil {
+		config = DefaultBackoffConfig()
+	}
+
+	cfg := *config
+	if cfg.Initial <= 0 {
+		cfg.Initial = time.Second
+	}
+	if cfg.Max < cfg.Initial {
+		cfg.Max = cfg.Initial
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 1
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	} else if cfg.Jitter > 1 {
+		cfg.Jitter = 1
+	}
+	return &Backoff{config: cfg}
+}
+
+// Next returns the delay before the next attempt and advances the backoff
+func (b *Backoff) Next() time.Duration {
+	delay := float64(b.config.Initial)
+	for i := 0; i < b.attempt && delay < float64(b.config.Max); i++ {
+		delay *= b.config.Multiplier
+	}
+	if delay > float64(b.config.Max) {
+		delay = float64(b.config.Max)
+	}
+	b.attempt++
+
+	if b.config.Jitter > 0 {
+		delay += delay * b.config.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Reset starts the backoff over after a successful attempt
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
+
+// backoffFor returns the redial backoff for a connection configuration.
+// Without an explicit Backoff, ReconnectInterval is the initial delay.
+func backoffFor(config *ConnectionConfig) *Backoff {
+	if config.Backoff != nil {
+		return NewBackoff(config.Backoff)
+	}
+
+	backoff := DefaultBackoffConfig()
+	if config.ReconnectInterval > 0 {
+		backoff.Initial = config.ReconnectInterval
+	} else {
+		backoff.Initial = DefaultReconnectInterval
+	}
+	return NewBackoff(backoff)
+}
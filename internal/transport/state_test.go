@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(&BackoffConfig{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2})
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Millisecond {
+			t.Errorf("Attempt %d: delay %v, want %v", i, got, w*time.Millisecond)
+		}
+	}
+
+	b.Reset()
+	if got := b.Next(); got != 100*time.Millisecond {
+		t.Errorf("After reset: delay %v, want 100ms", got)
+	}
+
+	// Jitter stays within the configured spread
+	jittered := NewBackoff(&BackoffConfig{Initial: time.Second, Max: time.Second, Jitter: 0.5})
+	for i := 0; i < 50; i++ {
+		if d := jittered.Next(); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("Jittered delay %v outside [500ms, 1.5s]", d)
+		}
+	}
+}
+
+func TestLinkState(t *testing.T) {
+	var ls linkState
+	var events []StateEvent
+	ls.OnStateChange(func(e StateEvent) { events = append(events, e) })
+
+	lost := errors.New("connection reset")
+	ls.up()
+	ls.healthy() // No-op while connected
+	ls.set(StateDegraded, nil)
+	ls.healthy()
+	ls.set(StateLost, lost)
+	ls.set(StateLost, lost) // Repeats are not reported
+	ls.up()
+
+	want := []ConnectionState{StateConnected, StateDegraded, StateConnected, StateLost, StateReconnected}
+	if len(events) != len(want) {
+		t.Fatalf("Got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, state := range want {
+		if events[i].To != state {
+			t.Errorf("Event %d: %s, want %s", i, events[i].To, state)
+		}
+	}
+	if events[3].Err != lost || events[3].From != StateConnected {
+		t.Errorf("Lost event missing cause or origin: %+v", events[3])
+	}
+	if !ls.State().Up() || StateLost.Up() {
+		t.Error("Up() reports wrong link status")
+	}
+}
+
+func TestTCPConnection_StateEvents(t *testing.T) {
+	server, client := newTCPPair(t)
+
+	events := make(chan StateEvent, 8)
+	client.OnStateChange(func(e StateEvent) { events <- e })
+	if client.State() != StateConnected {
+		t.Fatalf("Client state %s, want connected", client.State())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	go client.Start(ctx)
+
+	// Wait for the server to accept, then cut the stream
+	deadline := time.Now().Add(2 * time.Second)
+	for server.currentStream() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.dropStream(server.currentStream(), nil)
+
+	expect := func(state ConnectionState) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.To != state {
+				t.Fatalf("State %s, want %s", e.To, state)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for %s", state)
+		}
+	}
+	expect(StateLost)
+	expect(StateReconnected)
+
+	client.Close()
+	expect(StateDisconnected)
+}
@@ -0,0 +1,601 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// tcpFrameHeader is the size of the big-endian length prefix in front of
+// every USRP packet on a TCP stream
+const tcpFrameHeader = 2
+
+// DefaultReconnectInterval is how long a dialed connection first waits before
+// redialing after the link drops; later attempts back off exponentially
+const DefaultReconnectInterval = 2 * time.Second
+
+// TCPConnection implements Connection over a TCP stream, for networks where
+// UDP is blocked. Each USRP packet is framed with a 2-byte big-endian length.
+//
+// With a RemoteAddr the connection dials out and redials with backoff when
+// the stream drops. Without one it listens on LocalAddr and talks to the most
+// recently accepted peer. A TLS configuration wraps every stream in TLS.
+// Link state changes are reported through OnStateChange.
+type TCPConnection struct {
+	linkState
+	interceptors
+	sendQueue
+	handlerSet
+
+	config     *ConnectionConfig
+	localAddr  *net.TCPAddr
+	remoteAddr *net.TCPAddr
+	tlsConfig  *tls.Config  // nil = plaintext
+	acl        *ACL         // Filter for accepted peers (nil = accept all)
+	proxy      *ProxyDialer // Outbound proxy for dialing (nil = direct)
+	metrics    Metrics
+
+	listener *net.TCPListener
+	stream   net.Conn // Current peer stream (nil when disconnected)
+	peer     net.Addr
+	streamMu sync.Mutex
+
+	writeMutex sync.Mutex
+	readBuf    []byte
+	pending    []byte // Bytes read but not yet returned as a frame
+
+	sequenceNum uint32
+	seqMutex    sync.Mutex
+	closed      bool
+	closeMutex  sync.Mutex
+}
+
+// NewTCPConnection creates a new TCP connection with the given configuration
+func NewTCPConnection(config *ConnectionConfig) (*TCPConnection, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if err := config.IPVersion.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SendQueue.validate(); err != nil {
+		return nil, fmt.Errorf("invalid send queue config: %w", err)
+	}
+
+	localAddr, err := net.ResolveTCPAddr(config.IPVersion.network("tcp"), config.LocalAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local address: %w", err)
+	}
+
+	var remoteAddr *net.TCPAddr
+	if config.RemoteAddr != "" {
+		remoteAddr, err = net.ResolveTCPAddr(config.IPVersion.network("tcp"), config.RemoteAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve remote address: %w", err)
+		}
+	}
+
+	acl, err := NewACL(config.ACL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acl config: %w", err)
+	}
+
+	var proxy *ProxyDialer
+	if config.Proxy != "" {
+		if proxy, err = NewProxyDialer(config.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	tc := &TCPConnection{
+		config:     config,
+		acl:        acl,
+		proxy:      proxy,
+		metrics:    metricsOrDefault(config.Metrics),
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		readBuf:    make([]byte, 4096),
+	}
+
+	if config.TLS != nil {
+		remoteHost := ""
+		if remoteAddr != nil {
+			remoteHost, _, _ = net.SplitHostPort(config.RemoteAddr)
+		}
+		tc.tlsConfig, err = config.TLS.TLS(remoteHost, remoteAddr == nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build TLS config: %w", err)
+		}
+	}
+
+	return tc, nil
+}
+
+// Connect dials the remote address, or starts listening when no remote
+// address is configured
+func (tc *TCPConnection) Connect() error {
+	tc.closeMutex.Lock()
+	defer tc.closeMutex.Unlock()
+
+	if tc.closed {
+		return fmt.Errorf("connection is closed")
+	}
+
+	if tc.remoteAddr != nil {
+		return tc.dial()
+	}
+
+	lc := net.ListenConfig{Control: socketControl(tc.config)}
+	network := bindNetwork("tcp", tc.localAddr.IP, nil, tc.config.IPVersion)
+	ln, err := lc.Listen(context.Background(), network, tc.localAddr.String())
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP: %w", err)
+	}
+	listener := ln.(*net.TCPListener)
+	tc.listener = listener
+	tc.localAddr = listener.Addr().(*net.TCPAddr)
+	return nil
+}
+
+// dial opens a new stream to the remote address. The configured name is
+// redialed rather than the address resolved at construction, so the dialer
+// races IPv6 and IPv4 candidates (happy eyeballs) and follows DNS changes.
+// Through a proxy the dialer reaches the proxy, which connects onward.
+func (tc *TCPConnection) dial() error {
+	dialer := net.Dialer{Timeout: tc.config.WriteTimeout, Control: socketControl(tc.config)}
+	if tc.localAddr != nil && (tc.localAddr.Port != 0 || tc.localAddr.IP != nil) {
+		dialer.LocalAddr = tc.localAddr
+	}
+	network := tc.config.IPVersion.network("tcp")
+
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if tc.proxy != nil {
+		// Bound the proxy handshake like the connect
+		ctx := context.Background()
+		if tc.config.WriteTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.config.WriteTimeout)
+			defer cancel()
+		}
+		conn, err = tc.proxy.DialContext(ctx, &dialer, network, tc.config.RemoteAddr)
+	} else {
+		conn, err = dialer.Dial(network, tc.config.RemoteAddr)
+	}
+	if err != nil {
+		tc.metrics.Error()
+		return fmt.Errorf("failed to dial TCP %s: %w", tc.remoteAddr, err)
+	}
+	// The three-way handshake takes one round trip (through a proxy, the
+	// proxy's onward connect too)
+	tc.metrics.RTT(time.Since(start))
+	if err := applyBuffers(conn, tc.config); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if tc.tlsConfig != nil {
+		secure := tls.Client(conn, tc.tlsConfig)
+		if err := tc.handshake(secure); err != nil {
+			return fmt.Errorf("TLS handshake with %s failed: %w", tc.remoteAddr, err)
+		}
+		conn = secure
+	}
+
+	tc.setStream(conn)
+	tc.up()
+	return nil
+}
+
+// handshake completes a TLS handshake within the write timeout, closing the
+// stream on failure
+func (tc *TCPConnection) handshake(conn *tls.Conn) error {
+	timeout := tc.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// accept waits for the next peer, honoring the listener deadline
+func (tc *TCPConnection) accept(deadline time.Time) error {
+	if err := tc.listener.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("failed to set accept deadline: %w", err)
+	}
+	conn, err := tc.listener.Accept()
+	if err != nil {
+		return fmt.Errorf("failed to accept TCP connection: %w", err)
+	}
+	if !tc.acl.Permit(conn.RemoteAddr()) {
+		tc.metrics.Drop()
+		conn.Close()
+		return fmt.Errorf("connection from %s: %w", conn.RemoteAddr(), ErrRejected)
+	}
+	if err := applyBuffers(conn, tc.config); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if tc.tlsConfig != nil {
+		secure := tls.Server(conn, tc.tlsConfig)
+		if err := tc.handshake(secure); err != nil {
+			return fmt.Errorf("TLS handshake with %s failed: %w", conn.RemoteAddr(), err)
+		}
+		conn = secure
+	}
+
+	tc.setStream(conn)
+	tc.up()
+	return nil
+}
+
+// setStream replaces the current stream, closing any previous one
+func (tc *TCPConnection) setStream(conn net.Conn) {
+	tc.streamMu.Lock()
+	defer tc.streamMu.Unlock()
+
+	if tc.stream != nil {
+		tc.stream.Close()
+	}
+	tc.stream = conn
+	tc.peer = conn.RemoteAddr()
+	tc.pending = tc.pending[:0]
+}
+
+// dropStream closes the current stream if it is still conn, marking the
+// link lost because of err
+func (tc *TCPConnection) dropStream(conn net.Conn, err error) {
+	tc.streamMu.Lock()
+	dropped := tc.stream == conn && conn != nil
+	if dropped {
+		tc.stream.Close()
+		tc.stream = nil
+	}
+	tc.streamMu.Unlock()
+
+	if dropped && !tc.isClosed() {
+		tc.set(StateLost, err)
+	}
+}
+
+func (tc *TCPConnection) currentStream() net.Conn {
+	tc.streamMu.Lock()
+	defer tc.streamMu.Unlock()
+	return tc.stream
+}
+
+// SendMessageAsync queues a USRP message for sending and returns without
+// waiting on the network. msg must not be modified after the call.
+func (tc *TCPConnection) SendMessageAsync(msg usrp.Message) error {
+	return tc.sendQueue.push(msg, tc.config.SendQueue, tc.SendMessage)
+}
+
+// SendMessage sends a length-prefixed USRP message over the stream, bounded
+// by WriteTimeout
+func (tc *TCPConnection) SendMessage(msg usrp.Message) error {
+	return tc.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext sends a length-prefixed USRP message over the stream,
+// giving up when ctx is cancelled or its deadline (else WriteTimeout)
+// passes. An interrupted write may leave a partial frame, so it ends the
+// stream like any other write error.
+func (tc *TCPConnection) SendMessageContext(ctx context.Context, msg usrp.Message) error {
+	conn := tc.currentStream()
+	if conn == nil {
+		return fmt.Errorf("connection not established")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Validate message
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("message validation failed: %w", err)
+	}
+
+	// Set sequence number
+	tc.seqMutex.Lock()
+	tc.sequenceNum++
+	seq := tc.sequenceNum
+	tc.seqMutex.Unlock()
+	if header := usrp.HeaderOf(msg); header != nil {
+		header.Seq = seq
+	}
+
+	return tc.sendChain(msg, func(msg usrp.Message) error {
+		return contextError(ctx, tc.write(ctx, conn, msg))
+	})
+}
+
+// write marshals msg and sends it as one frame on conn
+func (tc *TCPConnection) write(ctx context.Context, conn net.Conn, msg usrp.Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	frame := make([]byte, tcpFrameHeader+len(data))
+	binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	copy(frame[tcpFrameHeader:], data)
+
+	tc.writeMutex.Lock()
+	defer tc.writeMutex.Unlock()
+
+	start := time.Now()
+	release, err := bindContext(ctx, tc.config.WriteTimeout, conn.SetWriteDeadline)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(frame)
+	release()
+	if err != nil {
+		// A partial frame cannot be recovered, so any write error ends the stream
+		tc.metrics.Error()
+		tc.dropStream(conn, err)
+		return fmt.Errorf("failed to send TCP frame: %w", err)
+	}
+	tc.metrics.PacketOut(len(frame))
+
+	// A write that blocks for half the timeout means the peer or path is
+	// not keeping up
+	if elapsed := time.Since(start); tc.config.WriteTimeout > 0 && elapsed > tc.config.WriteTimeout/2 {
+		tc.set(StateDegraded, fmt.Errorf("TCP write blocked for %v", elapsed))
+	} else {
+		tc.healthy()
+	}
+
+	return nil
+}
+
+// ReceiveMessage receives and parses a USRP message from the stream,
+// bounded by ReadTimeout
+func (tc *TCPConnection) ReceiveMessage() (usrp.Message, error) {
+	return tc.ReceiveMessageContext(context.Background())
+}
+
+// ReceiveMessageContext receives and parses a USRP message from the stream,
+// giving up when ctx is cancelled or its deadline (else ReadTimeout)
+// passes. A listening connection waits for its first peer under the same
+// bound. Partial frames survive an interrupted read.
+func (tc *TCPConnection) ReceiveMessageContext(ctx context.Context) (usrp.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := tc.currentStream()
+	if conn == nil {
+		if tc.listener == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+		release, err := bindContext(ctx, 0, tc.listener.SetDeadline)
+		if err != nil {
+			return nil, err
+		}
+		err = tc.accept(deadlineFor(ctx, tc.config.ReadTimeout))
+		release()
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		conn = tc.currentStream()
+	}
+
+	release, err := bindContext(ctx, tc.config.ReadTimeout, conn.SetReadDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rx, err := tc.Receive()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return rx.Message, nil
+}
+
+// Receive receives and parses a USRP message from the stream along with its
+// source address, arrival time, and size
+func (tc *TCPConnection) Receive() (*usrp.Received, error) {
+	conn := tc.currentStream()
+	if conn == nil {
+		if tc.listener == nil {
+			return nil, fmt.Errorf("connection not established")
+		}
+		if err := tc.accept(time.Time{}); err != nil {
+			return nil, err
+		}
+		conn = tc.currentStream()
+	}
+
+	frame, err := tc.readFrame(conn)
+	if err != nil {
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			tc.metrics.Error()
+			tc.dropStream(conn, err)
+		}
+		return nil, fmt.Errorf("failed to read TCP frame: %w", err)
+	}
+	tc.metrics.PacketIn(tcpFrameHeader + len(frame))
+
+	rx, err := usrp.ParseReceived(frame, conn.RemoteAddr(), time.Now())
+	if err != nil {
+		tc.metrics.Drop()
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	rx.Length = tcpFrameHeader + len(frame)
+
+	if err := tc.receiveChain(rx); err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
+
+// readFrame returns the next complete frame. Partial frames survive read
+// timeouts, so a deadline never desynchronizes the stream.
+func (tc *TCPConnection) readFrame(conn net.Conn) ([]byte, error) {
+	for {
+		if len(tc.pending) >= tcpFrameHeader {
+			size := int(binary.BigEndian.Uint16(tc.pending))
+			if max := usrp.CurrentLimits().MaxPacketSize; size > max {
+				return nil, fmt.Errorf("frame length %d exceeds %d", size, max)
+			}
+			if len(tc.pending) >= tcpFrameHeader+size {
+				frame := make([]byte, size)
+				copy(frame, tc.pending[tcpFrameHeader:])
+				tc.pending = append(tc.pending[:0], tc.pending[tcpFrameHeader+size:]...)
+				return frame, nil
+			}
+		}
+
+		n, err := conn.Read(tc.readBuf)
+		tc.pending = append(tc.pending, tc.readBuf[:n]...)
+		if err != nil {
+			if err == io.EOF && len(tc.pending) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// Start begins the message processing loop. Dialed connections redial with
+// exponential backoff when the stream drops; listening connections wait for
+// the next peer.
+func (tc *TCPConnection) Start(ctx context.Context) error {
+	if tc.currentStream() == nil && tc.listener == nil {
+		return fmt.Errorf("connection not established")
+	}
+
+	tc.startWorkers(ctx, tc.config, tc.metrics)
+	backoff := backoffFor(tc.config)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		conn := tc.currentStream()
+		if conn == nil {
+			if tc.isClosed() {
+				return fmt.Errorf("connection is closed")
+			}
+			var err error
+			if tc.listener != nil {
+				err = tc.accept(time.Now().Add(time.Second))
+			} else if err = tc.dial(); err != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff.Next()):
+				}
+			} else {
+				backoff.Reset()
+			}
+			if err != nil {
+				continue
+			}
+			conn = tc.currentStream()
+		}
+
+		// Set read timeout
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			tc.dropStream(conn, err)
+			continue
+		}
+
+		rx, err := tc.Receive()
+		if err != nil {
+			// Timeouts just poll the context again; other errors drop the
+			// stream and reconnect on the next iteration
+			continue
+		}
+		tc.dispatch(rx.Message)
+	}
+}
+
+func (tc *TCPConnection) isClosed() bool {
+	tc.closeMutex.Lock()
+	defer tc.closeMutex.Unlock()
+	return tc.closed
+}
+
+// Close closes the stream and listener
+func (tc *TCPConnection) Close() error {
+	tc.closeMutex.Lock()
+	defer tc.closeMutex.Unlock()
+
+	if tc.closed {
+		return nil
+	}
+	tc.closed = true
+	tc.sendQueue.close()
+
+	var err error
+	if tc.listener != nil {
+		err = tc.listener.Close()
+	}
+	tc.streamMu.Lock()
+	if tc.stream != nil {
+		tc.stream.Close()
+		tc.stream = nil
+	}
+	tc.streamMu.Unlock()
+
+	tc.set(StateDisconnected, nil)
+	return err
+}
+
+// Metrics returns the connection's link metrics
+func (tc *TCPConnection) Metrics() Metrics {
+	return tc.metrics
+}
+
+// ACLStats returns the ACL counters, or zero values when no ACL is configured
+func (tc *TCPConnection) ACLStats() ACLStats {
+	return tc.acl.Stats()
+}
+
+// LocalAddr returns the local network address
+func (tc *TCPConnection) LocalAddr() net.Addr {
+	if conn := tc.currentStream(); conn != nil {
+		return conn.LocalAddr()
+	}
+	if tc.listener != nil {
+		return tc.listener.Addr()
+	}
+	return tc.localAddr
+}
+
+// RemoteAddr returns the address of the current peer
+func (tc *TCPConnection) RemoteAddr() net.Addr {
+	tc.streamMu.Lock()
+	defer tc.streamMu.Unlock()
+
+	if tc.peer != nil {
+		return tc.peer
+	}
+	if tc.remoteAddr != nil {
+		return tc.remoteAddr
+	}
+	return nil
+}
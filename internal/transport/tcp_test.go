@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func newTCPPair(t *testing.T) (server, client *TCPConnection) {
+	t.Helper()
+
+	server, err := NewTCPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := server.Connect(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	client, err = NewTCPConnection(&ConnectionConfig{
+		LocalAddr:         ":0",
+		RemoteAddr:        server.LocalAddr().String(),
+		WriteTimeout:      time.Second,
+		ReconnectInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+func TestTCPConnection_Framing(t *testing.T) {
+	server, client := newTCPPair(t)
+
+	// Several back-to-back frames of different sizes must come out intact
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	voice.Header.SetPTT(true)
+	voice.AudioData[0] = 1234
+	tlv, err := usrp.NewTLV(0).Callsign("N0CALL").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []usrp.Message{voice, tlv, voice} {
+		if err := client.SendMessage(msg); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+
+	wantTypes := []usrp.PacketType{usrp.USRP_TYPE_VOICE, usrp.USRP_TYPE_TLV, usrp.USRP_TYPE_VOICE}
+	for i, want := range wantTypes {
+		rx, err := server.Receive()
+		if err != nil {
+			t.Fatalf("Receive %d failed: %v", i, err)
+		}
+		if rx.Type() != want {
+			t.Errorf("Frame %d: type %d, want %d", i, rx.Type(), want)
+		}
+		if header := usrp.HeaderOf(rx.Message); header.Seq != uint32(i+1) {
+			t.Errorf("Frame %d: seq %d, want %d", i, header.Seq, i+1)
+		}
+		if rx.SourceString() != client.LocalAddr().String() {
+			t.Errorf("Source mismatch: got %s, want %s", rx.SourceString(), client.LocalAddr())
+		}
+	}
+
+	// The server replies over the accepted stream
+	if err := server.SendMessage(voice); err != nil {
+		t.Fatalf("Server SendMessage failed: %v", err)
+	}
+	msg, err := client.ReceiveMessage()
+	if err != nil {
+		t.Fatalf("Client receive failed: %v", err)
+	}
+	if got := msg.(*usrp.VoiceMessage).AudioData[0]; got != 1234 {
+		t.Errorf("Sample mismatch: got %d, want 1234", got)
+	}
+}
+
+func TestTCPConnection_Reconnect(t *testing.T) {
+	server, client := newTCPPair(t)
+
+	received := make(chan usrp.Message, 4)
+	server.RegisterHandler(usrp.USRP_TYPE_VOICE, func(msg usrp.Message) error {
+		received <- msg
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	go client.Start(ctx)
+
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	send := func() {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			if err := client.SendMessage(voice); err == nil {
+				select {
+				case <-received:
+					return
+				case <-time.After(200 * time.Millisecond):
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out sending over TCP")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	send()
+
+	// Drop the stream from the server side; the client must redial
+	server.dropStream(server.currentStream(), nil)
+	send()
+}
+
+func TestTCPConnection_NotConnected(t *testing.T) {
+	conn, err := NewTCPConnection(&ConnectionConfig{LocalAddr: ":0", RemoteAddr: "127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	if err := conn.SendMessage(voice); err == nil {
+		t.Error("Expected error sending before Connect")
+	}
+	if err := conn.Start(context.Background()); err == nil {
+		t.Error("Expected error starting before Connect")
+	}
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/pion/dtls/v3"
+)
+
+// TLSConfig holds certificate settings for encrypted links: TLS on TCP and
+// DTLS on UDP. Both ends need a certificate; the listening side may also
+// require one from its peers (mutual TLS).
+type TLSConfig struct {
+	CertFile           string `json:"cert_file,omitempty"`            // PEM certificate chain presented to peers
+	KeyFile            string `json:"key_file,omitempty"`             // PEM private key for CertFile
+	CAFile             string `json:"ca_file,omitempty"`              // PEM CA bundle used to verify peers (system roots if empty)
+	ServerName         string `json:"server_name,omitempty"`          // Expected name in the server certificate (defaults to the remote host)
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"` // Accept any server certificate (testing only)
+	RequireClientCert  bool   `json:"require_client_cert,omitempty"`  // Listening side rejects peers without a certificate signed by CAFile
+}
+
+// tlsMaterial is the loaded form of a TLSConfig
+type tlsMaterial struct {
+	certificates []tls.Certificate
+	pool         *x509.CertPool
+}
+
+// load reads the certificate, key and CA files
+func (c *TLSConfig) load() (*tlsMaterial, error) {
+	m := &tlsMaterial{}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		m.certificates = []tls.Certificate{cert}
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		m.pool = x509.NewCertPool()
+		if !m.pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+	}
+
+	if c.RequireClientCert && m.pool == nil {
+		return nil, fmt.Errorf("require_client_cert needs a ca_file")
+	}
+
+	return m, nil
+}
+
+// serverName returns the name to verify, falling back to the dialed host
+func (c *TLSConfig) serverName(remoteHost string) string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	return remoteHost
+}
+
+// TLS builds a crypto/tls configuration. remoteHost is used as the server
+// name when dialing and ServerName is unset; pass "" on the listening side.
+func (c *TLSConfig) TLS(remoteHost string, server bool) (*tls.Config, error) {
+	m, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: m.certificates,
+	}
+	if server {
+		if len(m.certificates) == 0 {
+			return nil, fmt.Errorf("listening with TLS requires a certificate")
+		}
+		config.ClientCAs = m.pool
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else {
+		config.RootCAs = m.pool
+		config.ServerName = c.serverName(remoteHost)
+		config.InsecureSkipVerify = c.InsecureSkipVerify
+	}
+
+	return config, nil
+}
+
+// DTLS builds a pion/dtls configuration with the same semantics as TLS
+func (c *TLSConfig) DTLS(remoteHost string, server bool) (*dtls.Config, error) {
+	m, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &dtls.Config{
+		Certificates:         m.certificates,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+	if server {
+		if len(m.certificates) == 0 {
+			return nil, fmt.Errorf("listening with DTLS requires a certificate")
+		}
+		config.ClientCAs = m.pool
+		if c.RequireClientCert {
+			config.ClientAuth = dtls.RequireAndVerifyClientCert
+		}
+	} else {
+		config.RootCAs = m.pool
+		config.ServerName = c.serverName(remoteHost)
+		config.InsecureSkipVerify = c.InsecureSkipVerify
+	}
+
+	return config, nil
+}
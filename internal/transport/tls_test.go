@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// writeTestPKI creates a CA plus server and client certificates signed by it
+// and returns matching TLS configurations for each side
+func writeTestPKI(t *testing.T) (server, client *TLSConfig) {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "usrp test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM := func(name, kind string, der []byte) string {
+		path := filepath.Join(dir, name)
+		data := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	caFile := writePEM("ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writePEM(name+".pem", "CERTIFICATE", der), writePEM(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+
+	serverCert, serverKey := issue("server", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := issue("client", 3, x509.ExtKeyUsageClientAuth)
+
+	server = &TLSConfig{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile, RequireClientCert: true}
+	client = &TLSConfig{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile}
+	return server, client
+}
+
+// roundTrip connects a listening and a dialing connection of the given
+// protocol and checks a voice frame arrives intact
+func roundTrip(t *testing.T, protocol string, serverTLS, clientTLS *TLSConfig) error {
+	t.Helper()
+
+	server, err := NewConnection(protocol, &ConnectionConfig{LocalAddr: "127.0.0.1:0", TLS: serverTLS})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := server.Connect(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	// The server completes its side of the handshake while waiting to receive
+	received := make(chan *usrp.Received, 1)
+	go func() {
+		if rx, err := server.Receive(); err == nil {
+			received <- rx
+		}
+	}()
+
+	client, err := NewConnection(protocol, &ConnectionConfig{
+		LocalAddr:    "127.0.0.1:0",
+		RemoteAddr:   server.LocalAddr().String(),
+		WriteTimeout: 2 * time.Second,
+		TLS:          clientTLS,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	voice.AudioData[5] = -4321
+	if err := client.SendMessage(voice); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	select {
+	case rx := <-received:
+		if got := rx.Message.(*usrp.VoiceMessage).AudioData[5]; got != -4321 {
+			t.Errorf("Sample mismatch: got %d, want -4321", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for encrypted frame")
+	}
+	return nil
+}
+
+func TestTLS_RoundTrip(t *testing.T) {
+	serverTLS, clientTLS := writeTestPKI(t)
+
+	for _, protocol := range []string{"tcp", "udp"} {
+		t.Run(protocol, func(t *testing.T) {
+			if err := roundTrip(t, protocol, serverTLS, clientTLS); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestTLS_RejectsUntrustedServer(t *testing.T) {
+	serverTLS, clientTLS := writeTestPKI(t)
+
+	// A client trusting a different CA must refuse the server
+	_, otherClient := writeTestPKI(t)
+	untrusting := *clientTLS
+	untrusting.CAFile = otherClient.CAFile
+
+	for _, protocol := range []string{"tcp", "udp"} {
+		t.Run(protocol, func(t *testing.T) {
+			server, err := NewConnection(protocol, &ConnectionConfig{LocalAddr: "127.0.0.1:0", TLS: serverTLS})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := server.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			go server.Receive()
+
+			client, err := NewConnection(protocol, &ConnectionConfig{
+				LocalAddr:    "127.0.0.1:0",
+				RemoteAddr:   server.LocalAddr().String(),
+				WriteTimeout: 2 * time.Second,
+				TLS:          &untrusting,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			if err := client.Connect(); err == nil {
+				t.Error("Expected handshake to fail against an untrusted server")
+			}
+		})
+	}
+}
+
+func TestTLSConfig_Validation(t *testing.T) {
+	if _, err := (&TLSConfig{}).TLS("", true); err == nil {
+		t.Error("Expected error listening without a certificate")
+	}
+	if _, err := (&TLSConfig{RequireClientCert: true}).TLS("", true); err == nil {
+		t.Error("Expected error requiring client certs without a CA")
+	}
+	if _, err := (&TLSConfig{CertFile: "missing.pem", KeyFile: "missing-key.pem"}).DTLS("", false); err == nil {
+		t.Error("Expected error for missing certificate files")
+	}
+	if _, err := NewDTLSConnection(DefaultConfig()); err == nil {
+		t.Error("Expected error creating DTLS without TLS config")
+	}
+}
@@ -2,7 +2,7 @@ package transport
 
 import (
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -15,8 +15,17 @@ import (
 type Connection interface {
 	Connect() error
 	SendMessage(usrp.Message) error
+	SendMessageContext(context.Context, usrp.Message) error
+	SendMessageAsync(usrp.Message) error
+	SendQueueStats() SendQueueStats
 	ReceiveMessage() (usrp.Message, error)
+	ReceiveMessageContext(context.Context) (usrp.Message, error)
+	Receive() (*usrp.Received, error)
 	RegisterHandler(usrp.PacketType, MessageHandler)
+	UnregisterHandler(usrp.PacketType)
+	SetDefaultHandler(MessageHandler)
+	InterceptSend(Interceptor)
+	InterceptReceive(Interceptor)
 	Start(context.Context) error
 	Close() error
 	LocalAddr() net.Addr
@@ -28,37 +37,140 @@ type MessageHandler func(usrp.Message) error
 
 // UDPConnection implements Connection interface using UDP transport
 type UDPConnection struct {
-	conn         *net.UDPConn
-	localAddr    *net.UDPAddr
-	remoteAddr   *net.UDPAddr
-	handlers     map[usrp.PacketType]MessageHandler
-	handlerMutex sync.RWMutex
-	sequenceNum  uint32
-	seqMutex     sync.Mutex
-	bufferPool   sync.Pool
-	closed       bool
-	closeMutex   sync.Mutex
+	interceptors
+	sendQueue
+	handlerSet
+
+	config      *ConnectionConfig
+	conn        *net.UDPConn
+	localAddr   *net.UDPAddr
+	remoteAddr  *net.UDPAddr
+	sequenceNum uint32
+	seqMutex    sync.Mutex
+	writeMutex  sync.Mutex // Serializes write deadlines
+	bufferPool  sync.Pool
+	jitter      *JitterBuffer // Receive-side reordering in Start (nil = disabled)
+	limiter     *RateLimiter  // Per-source receive limits in Start (nil = unlimited)
+	acl         *ACL          // Source filter applied before parsing (nil = accept all)
+	dedupe      *Deduper      // Duplicate suppression in Start (nil = disabled)
+	cipher      *PacketCipher // Datagram encryption (nil = plaintext)
+	lastSend    int64         // UnixNano of the last send, for keepalives (atomic)
+	metrics     Metrics
+	closed      bool
+	closeMutex  sync.Mutex
 }
 
 // ConnectionConfig holds configuration for UDP connections
 type ConnectionConfig struct {
 	LocalAddr       string
 	RemoteAddr      string
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	ReadBufferSize  int
-	WriteBufferSize int
+	ReadTimeout     time.Duration // Bounds ReceiveMessage, and ReceiveMessageContext without a deadline; 0 = none
+	WriteTimeout    time.Duration // Bounds SendMessage, and SendMessageContext without a deadline; 0 = none
+	ReadBufferSize  int           // Socket receive buffer (SO_RCVBUF) in bytes; 0 = OS default
+	WriteBufferSize int           // Socket send buffer (SO_SNDBUF) in bytes; 0 = OS default
+
+	// DSCP marks outgoing packets with a DiffServ code point (0-63), such
+	// as DSCPExpedited for voice; 0 leaves them unmarked
+	DSCP int
+
+	// ReusePort sets SO_REUSEPORT so several processes can bind the same
+	// port and share its traffic
+	ReusePort bool
+
+	// IPVersion restricts the connection to IPv4 or IPv6 (IPAny = dual-stack;
+	// dial targets prefer whichever family is reachable, IPv6 first)
+	IPVersion IPVersion
+
+	// ReconnectInterval is the first redial delay for dialed transports
+	// (TCP, DTLS); zero uses DefaultReconnectInterval
+	ReconnectInterval time.Duration
+
+	// Backoff overrides the redial backoff (nil = exponential from
+	// ReconnectInterval up to a minute)
+	Backoff *BackoffConfig
+
+	// Proxy dials TCP connections through a proxy, given as
+	// socks5://[user:pass@]host:port or http://[user:pass@]host:port
+	// (empty = dial directly; datagram transports ignore it)
+	Proxy string
+
+	// TLS enables TLS on TCP and DTLS on UDP (nil = plaintext)
+	TLS *TLSConfig
+
+	// Encryption seals every UDPConnection datagram with AES-GCM under a
+	// pre-shared key; both ends need the same key (nil = plaintext)
+	Encryption *EncryptionConfig
+
+	// Jitter enables a jitter buffer between receive and handler dispatch
+	// in UDPConnection.Start (nil = dispatch on arrival)
+	Jitter *JitterConfig
+
+	// RateLimit drops packets from sources exceeding a packet or byte rate
+	// in UDPConnection.Start (nil = unlimited)
+	RateLimit *RateLimitConfig
+
+	// Dedupe drops packets whose sequence number was already seen from the
+	// same source in UDPConnection.Start (nil = deliver duplicates)
+	Dedupe *DedupeConfig
+
+	// ACL drops UDP packets, and refuses TCP and DTLS peers, from sources
+	// outside the configured networks (nil = accept all)
+	ACL *ACLConfig
+
+	// SendQueue bounds the queue behind SendMessageAsync and picks what
+	// to drop when it is full (nil = DefaultSendQueueConfig)
+	SendQueue *SendQueueConfig
+
+	// HandlerWorkers runs handlers on this many goroutines fed by a queue
+	// of HandlerQueue messages (0 = 16 per worker), dropping messages when
+	// it is full; 0 starts a goroutine per message, which a flood can use
+	// to exhaust memory
+	HandlerWorkers int
+	HandlerQueue   int
+
+	// Keepalive sends a PING to the remote address from UDPConnection.Start
+	// whenever nothing else has been sent for this long, keeping NAT
+	// mappings open (0 = disabled; see DefaultKeepaliveInterval)
+	Keepalive time.Duration
+
+	// Metrics receives link counters (nil = a private AtomicMetrics, read
+	// through the connection's Metrics method)
+	Metrics Metrics
 }
 
 // DefaultConfig returns a default connection configuration
 func DefaultConfig() *ConnectionConfig {
 	return &ConnectionConfig{
-		LocalAddr:       ":0",
-		RemoteAddr:      "",
-		ReadTimeout:     5 * time.Second,
-		WriteTimeout:    5 * time.Second,
-		ReadBufferSize:  64 * 1024,
-		WriteBufferSize: 64 * 1024,
+		LocalAddr:         ":0",
+		RemoteAddr:        "",
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      5 * time.Second,
+		ReadBufferSize:    64 * 1024,
+		WriteBufferSize:   64 * 1024,
+		ReconnectInterval: DefaultReconnectInterval,
+	}
+}
+
+// NewConnection creates a connection for protocol "udp", "tcp" or "unix"
+// (datagram unix sockets). A TLS configuration selects DTLS for UDP and TLS
+// for TCP.
+func NewConnection(protocol string, config *ConnectionConfig) (Connection, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	switch protocol {
+	case "", "udp":
+		if config.TLS != nil {
+			return NewDTLSConnection(config)
+		}
+		return NewUDPConnection(config)
+	case "tcp":
+		return NewTCPConnection(config)
+	case "unix":
+		return NewUnixConnection(config)
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
 	}
 }
 
@@ -68,26 +180,54 @@ func NewUDPConnection(config *ConnectionConfig) (*UDPConnection, error) {
 		config = DefaultConfig()
 	}
 
-	localAddr, err := net.ResolveUDPAddr("udp", config.LocalAddr)
+	if err := config.IPVersion.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SendQueue.validate(); err != nil {
+		return nil, fmt.Errorf("invalid send queue config: %w", err)
+	}
+
+	localAddr, err := net.ResolveUDPAddr(config.IPVersion.network("udp"), config.LocalAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve local address: %w", err)
 	}
 
 	var remoteAddr *net.UDPAddr
 	if config.RemoteAddr != "" {
-		remoteAddr, err = net.ResolveUDPAddr("udp", config.RemoteAddr)
+		remoteAddr, err = resolveUDPRemote(config.RemoteAddr, config.IPVersion)
 		if err != nil {
 			return nil, fmt.Errorf("failed to resolve remote address: %w", err)
 		}
 	}
 
+	jitter, err := NewJitterBuffer(config.Jitter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jitter buffer config: %w", err)
+	}
+
+	acl, err := NewACL(config.ACL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acl config: %w", err)
+	}
+
+	packetCipher, err := NewPacketCipher(config.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption config: %w", err)
+	}
+
 	uc := &UDPConnection{
+		config:     config,
+		jitter:     jitter,
+		limiter:    NewRateLimiter(config.RateLimit),
+		acl:        acl,
+		dedupe:     NewDeduper(config.Dedupe),
+		cipher:     packetCipher,
+		metrics:    metricsOrDefault(config.Metrics),
 		localAddr:  localAddr,
 		remoteAddr: remoteAddr,
-		handlers:   make(map[usrp.PacketType]MessageHandler),
 		bufferPool: sync.Pool{
 			New: func() interface{} {
-				buf := make([]byte, usrp.MaxPayloadSize+64) // Header + max payload
+				buf := make([]byte, usrp.MaxPayloadSize+64+packetCipher.Overhead()) // Header + max payload
 				return &buf
 			},
 		},
@@ -105,10 +245,22 @@ func (uc *UDPConnection) Connect() error {
 		return fmt.Errorf("connection is closed")
 	}
 
-	conn, err := net.ListenUDP("udp", uc.localAddr)
+	var remoteIP net.IP
+	if uc.remoteAddr != nil {
+		remoteIP = uc.remoteAddr.IP
+	}
+	network := bindNetwork("udp", uc.localAddr.IP, remoteIP, uc.config.IPVersion)
+
+	lc := net.ListenConfig{Control: socketControl(uc.config)}
+	packetConn, err := lc.ListenPacket(context.Background(), network, uc.localAddr.String())
 	if err != nil {
 		return fmt.Errorf("failed to listen on UDP: %w", err)
 	}
+	conn := packetConn.(*net.UDPConn)
+	if err := applyBuffers(conn, uc.config); err != nil {
+		conn.Close()
+		return err
+	}
 
 	uc.conn = conn
 	uc.localAddr = conn.LocalAddr().(*net.UDPAddr)
@@ -116,8 +268,20 @@ func (uc *UDPConnection) Connect() error {
 	return nil
 }
 
-// SendMessage sends a USRP message over UDP
+// SendMessageAsync queues a USRP message for sending and returns without
+// waiting on the network. msg must not be modified after the call.
+func (uc *UDPConnection) SendMessageAsync(msg usrp.Message) error {
+	return uc.sendQueue.push(msg, uc.config.SendQueue, uc.SendMessage)
+}
+
+// SendMessage sends a USRP message over UDP, bounded by WriteTimeout
 func (uc *UDPConnection) SendMessage(msg usrp.Message) error {
+	return uc.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext sends a USRP message over UDP, giving up when ctx is
+// cancelled or its deadline (else WriteTimeout) passes
+func (uc *UDPConnection) SendMessageContext(ctx context.Context, msg usrp.Message) error {
 	if uc.conn == nil {
 		return fmt.Errorf("connection not established")
 	}
@@ -126,6 +290,10 @@ func (uc *UDPConnection) SendMessage(msg usrp.Message) error {
 		return fmt.Errorf("no remote address configured")
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Validate message
 	if err := msg.Validate(); err != nil {
 		return fmt.Errorf("message validation failed: %w", err)
@@ -155,23 +323,72 @@ func (uc *UDPConnection) SendMessage(msg usrp.Message) error {
 		m.Header.Seq = seq
 	}
 
+	return uc.sendChain(msg, func(msg usrp.Message) error {
+		uc.writeMutex.Lock()
+		defer uc.writeMutex.Unlock()
+
+		release, err := bindContext(ctx, uc.config.WriteTimeout, uc.conn.SetWriteDeadline)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return contextError(ctx, uc.write(msg))
+	})
+}
+
+// write marshals msg and sends it to the remote address
+func (uc *UDPConnection) write(msg usrp.Message) error {
 	// Marshal message
 	data, err := msg.Marshal()
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
+	data = uc.cipher.Seal(data)
 
 	// Send data
 	_, err = uc.conn.WriteToUDP(data, uc.remoteAddr)
 	if err != nil {
+		uc.metrics.Error()
 		return fmt.Errorf("failed to send UDP packet: %w", err)
 	}
+	uc.metrics.PacketOut(len(data))
+	uc.touchSend()
 
 	return nil
 }
 
-// ReceiveMessage receives and parses a USRP message from UDP
+// ReceiveMessage receives and parses a USRP message from UDP, bounded by
+// ReadTimeout
 func (uc *UDPConnection) ReceiveMessage() (usrp.Message, error) {
+	return uc.ReceiveMessageContext(context.Background())
+}
+
+// ReceiveMessageContext receives and parses a USRP message from UDP, giving
+// up when ctx is cancelled or its deadline (else ReadTimeout) passes
+func (uc *UDPConnection) ReceiveMessageContext(ctx context.Context) (usrp.Message, error) {
+	if uc.conn == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	release, err := bindContext(ctx, uc.config.ReadTimeout, uc.conn.SetReadDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rx, err := uc.Receive()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return rx.Message, nil
+}
+
+// Receive receives and parses a USRP message from UDP along with its
+// source address, arrival time, and size
+func (uc *UDPConnection) Receive() (*usrp.Received, error) {
 	if uc.conn == nil {
 		return nil, fmt.Errorf("connection not established")
 	}
@@ -184,67 +401,66 @@ func (uc *UDPConnection) ReceiveMessage() (usrp.Message, error) {
 	n, addr, err := uc.conn.ReadFromUDP(buffer)
 	if err != nil {
 		uc.bufferPool.Put(bufferPtr)
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			uc.metrics.Error()
+		}
 		return nil, fmt.Errorf("failed to read UDP packet: %w", err)
 	}
+	uc.metrics.PacketIn(n)
 
-	// Update remote address if not set
-	if uc.remoteAddr == nil {
-		uc.remoteAddr = addr
+	// Filter before parsing, and before a rejected source can become the
+	// learned remote address
+	if !uc.acl.Permit(addr) {
+		uc.metrics.Drop()
+		uc.bufferPool.Put(bufferPtr)
+		return nil, fmt.Errorf("packet from %s: %w", addr, ErrRejected)
 	}
 
-	// Parse packet type from header
-	if n < usrp.HeaderSize { // Minimum header size is 32 bytes
-		uc.bufferPool.Put(bufferPtr)
-		return nil, fmt.Errorf("packet too small: %d bytes", n)
-	}
-
-	// Packet type is at offset 20 in the 32-byte header (after Eye, Seq, Memory, Keyup, TalkGroup)
-	packetType := usrp.PacketType(binary.BigEndian.Uint32(buffer[20:24]))
-
-	// Create appropriate message type and unmarshal
-	var msg usrp.Message
-	switch packetType {
-	case usrp.USRP_TYPE_VOICE:
-		msg = &usrp.VoiceMessage{}
-	case usrp.USRP_TYPE_DTMF:
-		msg = &usrp.DTMFMessage{}
-	case usrp.USRP_TYPE_TEXT:
-		msg = &usrp.TextMessage{}
-	case usrp.USRP_TYPE_PING:
-		msg = &usrp.PingMessage{}
-	case usrp.USRP_TYPE_TLV:
-		msg = &usrp.TLVMessage{}
-	case usrp.USRP_TYPE_VOICE_ULAW:
-		msg = &usrp.VoiceULawMessage{}
-	case usrp.USRP_TYPE_VOICE_ADPCM:
-		msg = &usrp.VoiceADPCMMessage{}
-	default:
+	// Packets that fail authentication must not teach us a remote address
+	packet, err := uc.cipher.Open(buffer[:n])
+	if err != nil {
+		uc.metrics.Drop()
 		uc.bufferPool.Put(bufferPtr)
-		return nil, fmt.Errorf("unknown packet type: %d", packetType)
+		return nil, fmt.Errorf("packet from %s: %w", addr, err)
 	}
 
-	if err := msg.Unmarshal(buffer[:n]); err != nil {
-		uc.bufferPool.Put(bufferPtr)
-		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	// Update remote address if not set
+	if uc.remoteAddr == nil {
+		uc.remoteAddr = addr
 	}
 
+	rx, err := usrp.ParseReceived(packet, addr, time.Now())
+	if err != nil {
+		uc.metrics.Drop()
+		uc.bufferPool.Put(bufferPtr)
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
 	uc.bufferPool.Put(bufferPtr)
-	return msg, nil
-}
 
-// RegisterHandler registers a handler function for a specific packet type
-func (uc *UDPConnection) RegisterHandler(packetType usrp.PacketType, handler MessageHandler) {
-	uc.handlerMutex.Lock()
-	defer uc.handlerMutex.Unlock()
-	uc.handlers[packetType] = handler
+	if err := uc.receiveChain(rx); err != nil {
+		return nil, err
+	}
+	return rx, nil
 }
 
-// Start begins the message processing loop
+// Start begins the message processing loop. With a jitter buffer
+// configured, messages are reordered by sequence number and handed to
+// handlers on the buffer's playout clock instead of on arrival. With a
+// keepalive configured, idle periods are filled with PINGs.
 func (uc *UDPConnection) Start(ctx context.Context) error {
 	if uc.conn == nil {
 		return fmt.Errorf("connection not established")
 	}
 
+	uc.startWorkers(ctx, uc.config, uc.metrics)
+	if uc.jitter != nil {
+		go uc.playout(ctx)
+	}
+	if uc.config.Keepalive > 0 {
+		go uc.keepalive(ctx)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -255,32 +471,97 @@ func (uc *UDPConnection) Start(ctx context.Context) error {
 				return fmt.Errorf("failed to set read deadline: %w", err)
 			}
 
-			msg, err := uc.ReceiveMessage()
+			rx, err := uc.Receive()
 			if err != nil {
 				// Check if it's a timeout
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
 					continue
 				}
-				return fmt.Errorf("failed to receive message: %w", err)
+				// Socket failures end the loop; malformed packets must not
+				var opErr *net.OpError
+				if errors.As(err, &opErr) {
+					return fmt.Errorf("failed to receive message: %w", err)
+				}
+				continue
+			}
+
+			if !uc.limiter.Allow(rx.Source, rx.Length, rx.Time) {
+				uc.metrics.Drop()
+				continue
+			}
+
+			if uc.dedupe.Duplicate(rx.Source, rx.Message, rx.Time) {
+				uc.metrics.Drop()
+				continue
+			}
+
+			if uc.jitter != nil {
+				if late := uc.jitter.Push(rx.Message, rx.Time); late != nil {
+					uc.dispatch(late)
+				}
+				continue
 			}
+			uc.dispatch(rx.Message)
+		}
+	}
+}
+
+// playout releases jitter-buffered messages to handlers on a steady clock
+func (uc *UDPConnection) playout(ctx context.Context) {
+	ticker := time.NewTicker(uc.jitter.Interval())
+	defer ticker.Stop()
 
-			// Handle message
-			uc.handlerMutex.RLock()
-			handler, exists := uc.handlers[msg.GetType()]
-			uc.handlerMutex.RUnlock()
-
-			if exists {
-				go func() {
-					if err := handler(msg); err != nil {
-						// In a production system, you'd want proper logging here
-						fmt.Printf("Handler error: %v\n", err)
-					}
-				}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// Handle inline so playout order is preserved
+			if msg, ok := uc.jitter.Pop(now); ok {
+				uc.handle(msg)
 			}
 		}
 	}
 }
 
+// JitterStats returns the jitter buffer counters, or zero values when no
+// jitter buffer is configured
+func (uc *UDPConnection) JitterStats() JitterStats {
+	if uc.jitter == nil {
+		return JitterStats{}
+	}
+	return uc.jitter.Stats()
+}
+
+// RateLimitStats returns the rate limiter counters, or zero values when no
+// rate limit is configured
+func (uc *UDPConnection) RateLimitStats() RateLimitStats {
+	return uc.limiter.Stats()
+}
+
+// DedupeStats returns the duplicate filter counters, or zero values when
+// no filter is configured
+func (uc *UDPConnection) DedupeStats() DedupeStats {
+	return uc.dedupe.Stats()
+}
+
+// EncryptionStats returns the packet cipher counters, or zero values when
+// encryption is off
+func (uc *UDPConnection) EncryptionStats() EncryptionStats {
+	return uc.cipher.Stats()
+}
+
+// Metrics returns the connection's link metrics
+func (uc *UDPConnection) Metrics() Metrics {
+	return uc.metrics
+}
+
+// ACLStats returns the ACL counters, or zero values when no ACL is configured
+func (uc *UDPConnection) ACLStats() ACLStats {
+	return uc.acl.Stats()
+}
+
 // Close closes the UDP connection and cleans up resources
 func (uc *UDPConnection) Close() error {
 	uc.closeMutex.Lock()
@@ -291,6 +572,7 @@ func (uc *UDPConnection) Close() error {
 	}
 
 	uc.closed = true
+	uc.sendQueue.close()
 
 	if uc.conn != nil {
 		return uc.conn.Close()
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestUDPConnection_Receive(t *testing.T) {
+	receiver, err := NewUDPConnection(&ConnectionConfig{LocalAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("Failed to create receiver: %v", err)
+	}
+	if err := receiver.Connect(); err != nil {
+		t.Fatalf("Failed to connect receiver: %v", err)
+	}
+	defer receiver.Close()
+
+	sender, err := NewUDPConnection(&ConnectionConfig{
+		LocalAddr:  "127.0.0.1:0",
+		RemoteAddr: receiver.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create sender: %v", err)
+	}
+	if err := sender.Connect(); err != nil {
+		t.Fatalf("Failed to connect sender: %v", err)
+	}
+	defer sender.Close()
+
+	before := time.Now()
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	if err := sender.SendMessage(voice); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	if err := receiver.conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	rx, err := receiver.Receive()
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	if rx.Type() != usrp.USRP_TYPE_VOICE {
+		t.Errorf("Expected voice message, got type %d", rx.Type())
+	}
+	if rx.Length != usrp.HeaderSize+usrp.VoiceFrameSize*2 {
+		t.Errorf("Unexpected length: %d", rx.Length)
+	}
+	if rx.SourceString() != sender.LocalAddr().String() {
+		t.Errorf("Source mismatch: got %s, want %s", rx.SourceString(), sender.LocalAddr())
+	}
+	if rx.Time.Before(before) {
+		t.Errorf("Receive time %v precedes send time %v", rx.Time, before)
+	}
+}
@@ -0,0 +1,340 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// UnixConnection implements Connection over datagram unix sockets, for local
+// IPC between the router and co-located helpers (transcoders, recorders)
+// without allocating localhost UDP ports. LocalAddr and RemoteAddr are socket
+// paths; like UDP, a connection without a RemoteAddr replies to the first
+// sender it hears from. Senders must bind a LocalAddr of their own to receive
+// replies.
+type UnixConnection struct {
+	interceptors
+	sendQueue
+	handlerSet
+
+	config     *ConnectionConfig
+	conn       *net.UnixConn
+	localAddr  *net.UnixAddr // nil = unbound, send only
+	remoteAddr *net.UnixAddr
+	remoteMu   sync.RWMutex
+	metrics    Metrics
+
+	sequenceNum uint32
+	seqMutex    sync.Mutex
+	writeMutex  sync.Mutex // Serializes write deadlines
+	closed      bool
+	closeMutex  sync.Mutex
+}
+
+// NewUnixConnection creates a new unix datagram connection
+func NewUnixConnection(config *ConnectionConfig) (*UnixConnection, error) {
+	if config == nil || (config.LocalAddr == "" && config.RemoteAddr == "") {
+		return nil, fmt.Errorf("unix socket requires a local or remote path")
+	}
+	if err := config.SendQueue.validate(); err != nil {
+		return nil, fmt.Errorf("invalid send queue config: %w", err)
+	}
+
+	uc := &UnixConnection{
+		config:  config,
+		metrics: metricsOrDefault(config.Metrics),
+	}
+	if config.LocalAddr != "" {
+		uc.localAddr = &net.UnixAddr{Name: config.LocalAddr, Net: "unixgram"}
+	}
+	if config.RemoteAddr != "" {
+		uc.remoteAddr = &net.UnixAddr{Name: config.RemoteAddr, Net: "unixgram"}
+	}
+	return uc, nil
+}
+
+// Connect binds the local socket path, replacing a stale socket left by a
+// previous run. Without a local path the socket is unbound and send only.
+func (uc *UnixConnection) Connect() error {
+	uc.closeMutex.Lock()
+	defer uc.closeMutex.Unlock()
+
+	if uc.closed {
+		return fmt.Errorf("connection is closed")
+	}
+
+	if uc.localAddr == nil {
+		conn, err := net.DialUnix("unixgram", nil, uc.remoteAddr)
+		if err != nil {
+			return fmt.Errorf("failed to dial unix socket: %w", err)
+		}
+		uc.conn = conn
+		return nil
+	}
+
+	if err := removeStaleSocket(uc.localAddr.Name); err != nil {
+		return err
+	}
+	conn, err := net.ListenUnixgram("unixgram", uc.localAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on unix socket: %w", err)
+	}
+	uc.conn = conn
+	return nil
+}
+
+// removeStaleSocket deletes path if it is a socket; any other file is left
+// alone so a typo cannot delete data
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat unix socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale unix socket: %w", err)
+	}
+	return nil
+}
+
+// peer returns the current remote address
+func (uc *UnixConnection) peer() *net.UnixAddr {
+	uc.remoteMu.RLock()
+	defer uc.remoteMu.RUnlock()
+	return uc.remoteAddr
+}
+
+// SendMessageAsync queues a USRP message for sending and returns without
+// waiting on the network. msg must not be modified after the call.
+func (uc *UnixConnection) SendMessageAsync(msg usrp.Message) error {
+	return uc.sendQueue.push(msg, uc.config.SendQueue, uc.SendMessage)
+}
+
+// SendMessage sends a USRP message to the remote socket, bounded by
+// WriteTimeout
+func (uc *UnixConnection) SendMessage(msg usrp.Message) error {
+	return uc.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext sends a USRP message to the remote socket, giving up
+// when ctx is cancelled or its deadline (else WriteTimeout) passes
+func (uc *UnixConnection) SendMessageContext(ctx context.Context, msg usrp.Message) error {
+	if uc.conn == nil {
+		return fmt.Errorf("connection not established")
+	}
+	if uc.peer() == nil {
+		return fmt.Errorf("no remote address configured")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Validate message
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("message validation failed: %w", err)
+	}
+
+	// Set sequence number
+	uc.seqMutex.Lock()
+	uc.sequenceNum++
+	seq := uc.sequenceNum
+	uc.seqMutex.Unlock()
+	if header := usrp.HeaderOf(msg); header != nil {
+		header.Seq = seq
+	}
+
+	return uc.sendChain(msg, func(msg usrp.Message) error {
+		uc.writeMutex.Lock()
+		defer uc.writeMutex.Unlock()
+
+		release, err := bindContext(ctx, uc.config.WriteTimeout, uc.conn.SetWriteDeadline)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return contextError(ctx, uc.write(msg))
+	})
+}
+
+// write marshals msg and sends it to the remote socket
+func (uc *UnixConnection) write(msg usrp.Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// A dialed socket is already connected and rejects an explicit address
+	if uc.localAddr == nil {
+		_, err = uc.conn.Write(data)
+	} else {
+		_, err = uc.conn.WriteToUnix(data, uc.peer())
+	}
+	if err != nil {
+		uc.metrics.Error()
+		return fmt.Errorf("failed to send unix datagram: %w", err)
+	}
+	uc.metrics.PacketOut(len(data))
+	return nil
+}
+
+// ReceiveMessage receives and parses a USRP message from the socket,
+// bounded by ReadTimeout
+func (uc *UnixConnection) ReceiveMessage() (usrp.Message, error) {
+	return uc.ReceiveMessageContext(context.Background())
+}
+
+// ReceiveMessageContext receives and parses a USRP message from the socket,
+// giving up when ctx is cancelled or its deadline (else ReadTimeout) passes
+func (uc *UnixConnection) ReceiveMessageContext(ctx context.Context) (usrp.Message, error) {
+	if uc.conn == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	release, err := bindContext(ctx, uc.config.ReadTimeout, uc.conn.SetReadDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rx, err := uc.Receive()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return rx.Message, nil
+}
+
+// Receive receives and parses a USRP message from the socket along with its
+// source address, arrival time, and size
+func (uc *UnixConnection) Receive() (*usrp.Received, error) {
+	if uc.conn == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+
+	buffer := make([]byte, usrp.CurrentLimits().MaxPacketSize)
+	n, addr, err := uc.conn.ReadFromUnix(buffer)
+	if err != nil {
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			uc.metrics.Error()
+		}
+		return nil, fmt.Errorf("failed to read unix datagram: %w", err)
+	}
+	uc.metrics.PacketIn(n)
+
+	// Learn the peer from its first datagram; unbound senders have no
+	// address and cannot be replied to
+	var source net.Addr
+	if addr != nil && addr.Name != "" {
+		source = addr
+		uc.remoteMu.Lock()
+		if uc.remoteAddr == nil {
+			uc.remoteAddr = addr
+		}
+		uc.remoteMu.Unlock()
+	}
+
+	rx, err := usrp.ParseReceived(buffer[:n], source, time.Now())
+	if err != nil {
+		uc.metrics.Drop()
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	if err := uc.receiveChain(rx); err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
+
+// Start begins the message processing loop
+func (uc *UnixConnection) Start(ctx context.Context) error {
+	if uc.conn == nil {
+		return fmt.Errorf("connection not established")
+	}
+
+	uc.startWorkers(ctx, uc.config, uc.metrics)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := uc.conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return fmt.Errorf("failed to set read deadline: %w", err)
+		}
+
+		rx, err := uc.Receive()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			// Socket failures end the loop; malformed packets must not
+			var opErr *net.OpError
+			if errors.As(err, &opErr) {
+				return fmt.Errorf("failed to receive message: %w", err)
+			}
+			continue
+		}
+		uc.dispatch(rx.Message)
+	}
+}
+
+// Metrics returns the connection's link metrics
+func (uc *UnixConnection) Metrics() Metrics {
+	return uc.metrics
+}
+
+// Close closes the socket and removes its path
+func (uc *UnixConnection) Close() error {
+	uc.closeMutex.Lock()
+	defer uc.closeMutex.Unlock()
+
+	if uc.closed {
+		return nil
+	}
+	uc.closed = true
+	uc.sendQueue.close()
+
+	if uc.conn == nil {
+		return nil
+	}
+	err := uc.conn.Close()
+	if uc.localAddr != nil {
+		os.Remove(uc.localAddr.Name)
+	}
+	return err
+}
+
+// LocalAddr returns the local socket address
+func (uc *UnixConnection) LocalAddr() net.Addr {
+	if uc.conn != nil {
+		return uc.conn.LocalAddr()
+	}
+	if uc.localAddr == nil {
+		return nil
+	}
+	return uc.localAddr
+}
+
+// RemoteAddr returns the remote socket address
+func (uc *UnixConnection) RemoteAddr() net.Addr {
+	if peer := uc.peer(); peer != nil {
+		return peer
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestUnixConnection_RoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+
+	dir := t.TempDir()
+	routerPath := filepath.Join(dir, "router.sock")
+	helperPath := filepath.Join(dir, "helper.sock")
+
+	// A stale socket from a previous run is replaced
+	stale, err := NewUnixConnection(&ConnectionConfig{LocalAddr: routerPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	stale.conn.Close()
+
+	router, err := NewUnixConnection(&ConnectionConfig{LocalAddr: routerPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Connect(); err != nil {
+		t.Fatalf("Failed to replace stale socket: %v", err)
+	}
+	defer router.Close()
+
+	helper, err := NewConnection("unix", &ConnectionConfig{LocalAddr: helperPath, RemoteAddr: routerPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Close()
+
+	replies := make(chan usrp.Message, 1)
+	helper.RegisterHandler(usrp.USRP_TYPE_PING, func(msg usrp.Message) error {
+		replies <- msg
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go helper.Start(ctx)
+
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	voice.AudioData[0] = 4321
+	if err := helper.SendMessage(voice); err != nil {
+		t.Fatal(err)
+	}
+
+	router.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rx, err := router.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rx.Message.(*usrp.VoiceMessage).AudioData[0]; got != 4321 {
+		t.Errorf("Expected audio sample 4321, got %d", got)
+	}
+	if rx.Source.String() != helperPath {
+		t.Errorf("Expected source %s, got %s", helperPath, rx.Source)
+	}
+
+	// The router learned the helper's path and can reply
+	if err := router.SendMessage(&usrp.PingMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_PING, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-replies:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for reply")
+	}
+
+	router.Close()
+	if _, err := os.Stat(routerPath); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed on close, stat: %v", err)
+	}
+}
+
+func TestUnixConnection_RefusesNonSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := NewUnixConnection(&ConnectionConfig{LocalAddr: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Connect(); err == nil {
+		conn.Close()
+		t.Fatal("Expected a regular file at the socket path to be refused")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Regular file was removed: %v", err)
+	}
+}
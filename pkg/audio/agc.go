@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AGCConfig holds automatic gain control settings. Levels are dBFS RMS,
+// gains dB.
+type AGCConfig struct {
+	SampleRate  int           // Sample rate (8000 for USRP)
+	TargetLevel float64       // Level speech is brought to
+	MaxGain     float64       // Most boost applied to quiet audio
+	MinGain     float64       // Most cut applied to loud audio (negative)
+	Attack      time.Duration // How fast gain drops when audio gets louder
+	Release     time.Duration // How fast gain recovers when audio gets quieter
+	HoldLevel   float64       // Below this the gain is held, so pauses and noise are not boosted
+}
+
+// DefaultAGCConfig returns settings for 8kHz speech: -18 dBFS target, up to
+// 24 dB of boost, fast attack and a slow release that rides over pauses
+func DefaultAGCConfig() *AGCConfig {
+	return &AGCConfig{
+		SampleRate:  8000,
+		TargetLevel: -18,
+		MaxGain:     24,
+		MinGain:     -12,
+		Attack:      10 * time.Millisecond,
+		Release:     500 * time.Millisecond,
+		HoldLevel:   -50,
+	}
+}
+
+// agcDetectWindow is the time constant of the level detector
+const agcDetectWindow = 20 * time.Millisecond
+
+// AGC evens out audio levels, so a quiet Discord microphone and a hot
+// AllStarLink node reach listeners at the same loudness. It measures the
+// short-term RMS level and moves its gain toward the one that brings the
+// level to the target, quickly when the audio gets louder (attack) and
+// slowly when it gets quieter (release). Peaks the gain would still push
+// past full scale are clipped.
+//
+// Call Process with every frame in the path; Reset between unrelated
+// streams.
+type AGC struct {
+	target  float64 // Linear, as a fraction of full scale
+	maxGain float64 // Linear
+	minGain float64 // Linear
+	hold    float64 // Linear mean square
+
+	detect  float64 // Level detector smoothing coefficient
+	attack  float64 // Gain smoothing coefficients
+	release float64
+
+	meanSquare float64 // Detected level, as a fraction of full scale squared
+	gain       float64 // Linear
+
+	mutex sync.Mutex
+}
+
+// NewAGC creates an AGC. A nil config uses DefaultAGCConfig.
+func NewAGC(config *AGCConfig) *AGC {
+	defaults := DefaultAGCConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.Attack <= 0 {
+		cfg.Attack = defaults.Attack
+	}
+	if cfg.Release <= 0 {
+		cfg.Release = defaults.Release
+	}
+	if cfg.MinGain > cfg.MaxGain {
+		cfg.MinGain = cfg.MaxGain
+	}
+
+	hold := dbToLinear(cfg.HoldLevel)
+	return &AGC{
+		target:  dbToLinear(cfg.TargetLevel),
+		maxGain: dbToLinear(cfg.MaxGain),
+		minGain: dbToLinear(cfg.MinGain),
+		hold:    hold * hold,
+		detect:  smoothing(agcDetectWindow, cfg.SampleRate),
+		attack:  smoothing(cfg.Attack, cfg.SampleRate),
+		release: smoothing(cfg.Release, cfg.SampleRate),
+		gain:    1,
+	}
+}
+
+// Process applies gain to samples in place
+func (a *AGC) Process(samples []int16) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for i, s := range samples {
+		x := float64(s) / 32768
+		a.meanSquare = a.detect*a.meanSquare + (1-a.detect)*x*x
+
+		if a.meanSquare > a.hold {
+			want := a.target / math.Sqrt(a.meanSquare)
+			want = math.Max(a.minGain, math.Min(a.maxGain, want))
+			coefficient := a.release
+			if want < a.gain {
+				coefficient = a.attack
+			}
+			a.gain = coefficient*a.gain + (1-coefficient)*want
+		}
+
+		samples[i] = clampInt16(float64(s) * a.gain)
+	}
+}
+
+// Gain returns the gain being applied, in dB
+func (a *AGC) Gain() float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return 20 * math.Log10(a.gain)
+}
+
+// Reset returns to unity gain and forgets the measured level
+func (a *AGC) Reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.meanSquare = 0
+	a.gain = 1
+}
+
+// dbToLinear converts decibels to an amplitude ratio
+func dbToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// smoothing returns the one-pole filter coefficient with time constant tau
+func smoothing(tau time.Duration, sampleRate int) float64 {
+	return math.Exp(-1 / (tau.Seconds() * float64(sampleRate)))
+}
@@ -0,0 +1,48 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// agcLevel runs two seconds of a 1kHz tone at level dBFS RMS through agc
+// and returns the output level of the last frame
+func agcLevel(agc *AGC, level float64) float64 {
+	amplitude := 32768 * math.Sqrt2 * dbToLinear(level)
+	frame := make([]int16, 160)
+	for n := 0; n < 100; n++ {
+		for i := range frame {
+			frame[i] = int16(amplitude * math.Sin(2*math.Pi*1000*float64(n*160+i)/8000))
+		}
+		agc.Process(frame)
+	}
+	return 20 * math.Log10(rms(frame)/32768)
+}
+
+func TestAGC_EvensLevels(t *testing.T) {
+	for _, input := range []float64{-36, -18, -8} {
+		agc := NewAGC(nil)
+		if got := agcLevel(agc, input); math.Abs(got-(-18)) > 1 {
+			t.Errorf("Input at %.0f dBFS came out at %.1f dBFS, want -18 (gain %.1f dB)", input, got, agc.Gain())
+		}
+	}
+}
+
+func TestAGC_Limits(t *testing.T) {
+	agc := NewAGC(&AGCConfig{TargetLevel: -18, MaxGain: 6, MinGain: -6, HoldLevel: -70})
+	if got := agcLevel(agc, -40); math.Abs(got-(-34)) > 1 {
+		t.Errorf("Expected boost capped at 6 dB, got %.1f dBFS out", got)
+	}
+	if got := agcLevel(agc, -3); math.Abs(got-(-9)) > 1 {
+		t.Errorf("Expected cut capped at 6 dB, got %.1f dBFS out", got)
+	}
+
+	// Silence and noise below the hold level leave the gain alone
+	agc.Reset()
+	agcLevel(agc, -30)
+	before := agc.Gain()
+	agcLevel(agc, -80)
+	if after := agc.Gain(); math.Abs(after-before) > 0.1 {
+		t.Errorf("Expected gain held through silence, went from %.1f to %.1f dB", before, after)
+	}
+}
@@ -0,0 +1,194 @@
+package audio
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// AlignedFrame is one frame cut by a FrameAligner
+type AlignedFrame struct {
+	Samples []int16
+	Time    time.Time // When the first sample was captured; zero when the writer gave no times
+}
+
+// FrameAligner cuts PCM arriving in chunks of any size, such as 1920-byte
+// Discord frames or whatever FFmpeg has written so far, into frames of
+// exactly frameSize samples. Samples and half samples short of a frame are
+// carried into the next chunk, never dropped or padded mid-stream.
+//
+// Frame times count samples from the time of the chunk that started the
+// stream, rather than being taken from each chunk, so they do not drift
+// however the chunks fall. A chunk whose time is more than a frame away
+// from where the count says it belongs starts the count again (a gap or a
+// clock jump); the partial frame before it is padded out with silence.
+type FrameAligner struct {
+	frameSize  int
+	sampleRate int
+
+	odd     []byte  // Half a sample
+	samples []int16 // Samples not yet framed
+	anchor  time.Time
+	offset  int64 // Samples from anchor to samples[0]
+	ready   []AlignedFrame
+	seq     uint32
+
+	mutex sync.Mutex
+}
+
+// NewFrameAligner creates an aligner of frameSize-sample frames for audio
+// at sampleRate, counting every channel's samples for interleaved audio.
+// Zero values align 20ms USRP frames.
+func NewFrameAligner(frameSize, sampleRate int) *FrameAligner {
+	if frameSize <= 0 {
+		frameSize = usrp.VoiceFrameSize
+	}
+	if sampleRate <= 0 {
+		sampleRate = USRPSampleRate
+	}
+	return &FrameAligner{
+		frameSize:  frameSize,
+		sampleRate: sampleRate,
+		samples:    make([]int16, 0, frameSize*4),
+	}
+}
+
+// Write adds samples captured from at, or following on from the last
+// chunk when at is zero
+func (fa *FrameAligner) Write(samples []int16, at time.Time) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	fa.write(samples, at)
+}
+
+// WriteBytes adds little-endian 16-bit PCM as Write does. An odd trailing
+// byte is kept until the next chunk completes its sample.
+func (fa *FrameAligner) WriteBytes(pcm []byte, at time.Time) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	if len(fa.odd) > 0 && len(pcm) > 0 {
+		pcm = append(fa.odd, pcm...)
+		fa.odd = nil
+	}
+	if len(pcm)%2 == 1 {
+		fa.odd = []byte{pcm[len(pcm)-1]}
+		pcm = pcm[:len(pcm)-1]
+	}
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	fa.write(samples, at)
+}
+
+// write adds samples and cuts the frames they complete. Must be called
+// with the mutex held.
+func (fa *FrameAligner) write(samples []int16, at time.Time) {
+	if !at.IsZero() {
+		expected := fa.timeAt(fa.offset + int64(len(fa.samples)))
+		frame := time.Duration(fa.frameSize) * time.Second / time.Duration(fa.sampleRate)
+		if drift := at.Sub(expected); expected.IsZero() || drift > frame || drift < -frame {
+			fa.pad()
+			fa.anchor, fa.offset = at, 0
+		}
+	}
+
+	fa.samples = append(fa.samples, samples...)
+	start := 0
+	for ; len(fa.samples)-start >= fa.frameSize; start += fa.frameSize {
+		fa.cut(fa.samples[start : start+fa.frameSize])
+	}
+	fa.samples = fa.samples[:copy(fa.samples, fa.samples[start:])]
+}
+
+// cut queues frame as the next aligned frame. Must be called with the
+// mutex held.
+func (fa *FrameAligner) cut(frame []int16) {
+	fa.ready = append(fa.ready, AlignedFrame{
+		Samples: append([]int16(nil), frame...),
+		Time:    fa.timeAt(fa.offset),
+	})
+	fa.offset += int64(len(frame))
+}
+
+// timeAt returns the time of the sample offset samples after the anchor,
+// zero without an anchor
+func (fa *FrameAligner) timeAt(offset int64) time.Time {
+	if fa.anchor.IsZero() {
+		return time.Time{}
+	}
+	return fa.anchor.Add(time.Duration(offset * int64(time.Second) / int64(fa.sampleRate)))
+}
+
+// pad pads samples not yet framed out into a last frame of silence. Must
+// be called with the mutex held.
+func (fa *FrameAligner) pad() {
+	if len(fa.samples) == 0 {
+		return
+	}
+	frame := make([]int16, fa.frameSize)
+	copy(frame, fa.samples)
+	fa.cut(frame)
+	fa.samples = fa.samples[:0]
+}
+
+// Frames returns the frames completed since the last call
+func (fa *FrameAligner) Frames() []AlignedFrame {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	frames := fa.ready
+	fa.ready = nil
+	return frames
+}
+
+// VoiceMessages returns the frames completed since the last call as USRP
+// voice frames, numbered in order. It is meant for aligners of
+// usrp.VoiceFrameSize frames.
+func (fa *FrameAligner) VoiceMessages() []*usrp.VoiceMessage {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	var messages []*usrp.VoiceMessage
+	for _, frame := range fa.ready {
+		fa.seq++
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, fa.seq)}
+		copy(msg.AudioData[:], frame.Samples)
+		messages = append(messages, msg)
+	}
+	fa.ready = nil
+	return messages
+}
+
+// Flush ends a stream: samples short of a frame are padded with silence
+// into a last frame, ready to be read, and a half sample is dropped. The
+// next chunk starts a new stream.
+func (fa *FrameAligner) Flush() {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.pad()
+	fa.odd = nil
+	fa.anchor, fa.offset = time.Time{}, 0
+}
+
+// Buffered returns the number of samples waiting for the rest of a frame
+func (fa *FrameAligner) Buffered() int {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	return len(fa.samples)
+}
+
+// Reset drops everything not yet read. Voice frame numbering carries on.
+func (fa *FrameAligner) Reset() {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.odd = nil
+	fa.samples = fa.samples[:0]
+	fa.ready = nil
+	fa.anchor, fa.offset = time.Time{}, 0
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFrameAligner_Chunks(t *testing.T) {
+	// Ten seconds of a counting ramp as PCM bytes, written in chunks of
+	// random size, odd byte counts included
+	const total = 80000
+	pcm := make([]byte, total*2)
+	for i := 0; i < total; i++ {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(i)))
+	}
+
+	fa := NewFrameAligner(0, 0)
+	rng := rand.New(rand.NewSource(1))
+	start := time.Unix(1000, 0)
+	var frames []AlignedFrame
+	for offset := 0; offset < len(pcm); {
+		n := min(1+rng.Intn(1000), len(pcm)-offset)
+		// After the first, chunks arrive up to 5ms off the pace of the
+		// samples they carry
+		at := start
+		if offset > 0 {
+			at = start.Add(time.Duration(offset/2)*time.Second/8000 + time.Duration(rng.Intn(10)-5)*time.Millisecond)
+		}
+		fa.WriteBytes(pcm[offset:offset+n], at)
+		frames = append(frames, fa.Frames()...)
+		offset += n
+	}
+
+	if len(frames) != total/160 {
+		t.Fatalf("Got %d frames, want %d", len(frames), total/160)
+	}
+	for i, frame := range frames {
+		if len(frame.Samples) != 160 {
+			t.Fatalf("Frame %d has %d samples", i, len(frame.Samples))
+		}
+		for j, s := range frame.Samples {
+			if s != int16(i*160+j) {
+				t.Fatalf("Frame %d sample %d is %d, want %d", i, j, s, int16(i*160+j))
+			}
+		}
+		// Times count samples, so they stay on the 20ms grid
+		if want := start.Add(time.Duration(i) * 20 * time.Millisecond); !frame.Time.Equal(want) {
+			t.Fatalf("Frame %d at %v, want %v", i, frame.Time.Sub(start), want.Sub(start))
+		}
+	}
+	if fa.Buffered() != 0 {
+		t.Errorf("%d samples left over", fa.Buffered())
+	}
+}
+
+func TestFrameAligner_GapsAndFlush(t *testing.T) {
+	fa := NewFrameAligner(0, 0)
+	start := time.Unix(1000, 0)
+
+	// 1.5 frames, then a chunk a second later: the half frame is padded
+	// out and the count starts again
+	fa.Write(make([]int16, 240), start)
+	fa.Write(make([]int16, 160), start.Add(time.Second))
+	frames := fa.Frames()
+	if len(frames) != 3 {
+		t.Fatalf("Got %d frames, want 3", len(frames))
+	}
+	for i, want := range []time.Duration{0, 20 * time.Millisecond, time.Second} {
+		if got := frames[i].Time.Sub(start); got != want {
+			t.Errorf("Frame %d at %v, want %v", i, got, want)
+		}
+	}
+
+	// Flush pads the last frame with silence
+	fa.Write([]int16{1, 2, 3}, time.Time{})
+	fa.Flush()
+	messages := fa.VoiceMessages()
+	if len(messages) != 1 || messages[0].AudioData[2] != 3 || messages[0].AudioData[3] != 0 {
+		t.Fatalf("Flush returned %d frames", len(messages))
+	}
+	if fa.Buffered() != 0 {
+		t.Errorf("%d samples left after Flush", fa.Buffered())
+	}
+
+	// Interleaved Discord audio: 1920 samples a frame at 96000 a second
+	discord := NewFrameAligner(1920, 96000)
+	discord.WriteBytes(make([]byte, 3840*2+1), start)
+	frames = discord.Frames()
+	if len(frames) != 2 || frames[1].Time.Sub(start) != 20*time.Millisecond {
+		t.Errorf("Got %d Discord frames", len(frames))
+	}
+}
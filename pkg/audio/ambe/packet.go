@@ -0,0 +1,127 @@
+// Package ambe drives AMBE-3000R hardware vocoders (DV3000, ThumbDV, or an
+// AMBEServer sharing one over the network) to transcode the AMBE frames
+// DMR and D-STAR carry in USRP TLV messages to and from PCM voice.
+package ambe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// AMBE-3000R packet framing
+const (
+	packetStart  = 0x61
+	headerLength = 4 // Start byte, 16-bit payload length, packet type
+
+	packetControl = 0x00
+	packetChannel = 0x01 // AMBE bits
+	packetSpeech  = 0x02 // PCM samples
+
+	fieldSpeech     = 0x00 // Speech packet: sample count, then big-endian samples
+	fieldChannel    = 0x01 // Channel packet: bit count, then packed bits
+	fieldRateT      = 0x09 // Select a predefined rate by index
+	fieldRateP      = 0x0A // Select a rate by six rate control words
+	fieldParity     = 0x2F // Trailing parity byte
+	fieldProductID  = 0x30
+	fieldReset      = 0x33
+	fieldReady      = 0x39
+	fieldParityMode = 0x3F
+
+	maxPayload = 1024 // Longer than any packet the chip sends
+)
+
+// packet is one AMBE-3000R packet
+type packet struct {
+	kind    byte
+	payload []byte // Fields, without any trailing parity field
+}
+
+// marshal frames the packet for the wire
+func (p packet) marshal() []byte {
+	out := make([]byte, headerLength, headerLength+len(p.payload))
+	out[0] = packetStart
+	binary.BigEndian.PutUint16(out[1:], uint16(len(p.payload)))
+	out[3] = p.kind
+	return append(out, p.payload...)
+}
+
+// readPacket reads the next packet, skipping noise before a start byte
+// (left behind by a reset or a half-read packet). The parity field the chip
+// appends until parity mode is turned off is dropped from control packets;
+// speech and channel packets carry explicit counts and ignore it.
+func readPacket(r *bufio.Reader) (packet, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		if b == packetStart {
+			break
+		}
+	}
+
+	var header [headerLength - 1]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return packet{}, err
+	}
+	length := int(binary.BigEndian.Uint16(header[:2]))
+	if length > maxPayload {
+		return packet{}, fmt.Errorf("packet length %d exceeds %d", length, maxPayload)
+	}
+
+	p := packet{kind: header[2], payload: make([]byte, length)}
+	if _, err := io.ReadFull(r, p.payload); err != nil {
+		return packet{}, err
+	}
+	if n := len(p.payload); p.kind == packetControl && n >= 2 && p.payload[n-2] == fieldParity {
+		p.payload = p.payload[:n-2]
+	}
+	return p, nil
+}
+
+// speechPacket builds a speech packet carrying pcm
+func speechPacket(pcm []int16) packet {
+	payload := make([]byte, 2, 2+len(pcm)*2)
+	payload[0] = fieldSpeech
+	payload[1] = byte(len(pcm))
+	for _, s := range pcm {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(s))
+	}
+	return packet{kind: packetSpeech, payload: payload}
+}
+
+// channelPacket builds a channel packet carrying bits of AMBE data
+func channelPacket(bits int, data []byte) packet {
+	payload := append([]byte{fieldChannel, byte(bits)}, data...)
+	return packet{kind: packetChannel, payload: payload}
+}
+
+// samples decodes a speech packet's PCM
+func (p packet) samples() ([]int16, error) {
+	if p.kind != packetSpeech || len(p.payload) < 2 || p.payload[0] != fieldSpeech {
+		return nil, fmt.Errorf("expected speech packet, got type 0x%02x", p.kind)
+	}
+	count := int(p.payload[1])
+	if len(p.payload) < 2+count*2 {
+		return nil, fmt.Errorf("speech packet truncated: %d samples in %d bytes", count, len(p.payload)-2)
+	}
+	pcm := make([]int16, count)
+	for i := range pcm {
+		pcm[i] = int16(binary.BigEndian.Uint16(p.payload[2+i*2:]))
+	}
+	return pcm, nil
+}
+
+// channelData decodes a channel packet's AMBE bits
+func (p packet) channelData() ([]byte, error) {
+	if p.kind != packetChannel || len(p.payload) < 2 || p.payload[0] != fieldChannel {
+		return nil, fmt.Errorf("expected channel packet, got type 0x%02x", p.kind)
+	}
+	size := (int(p.payload[1]) + 7) / 8
+	if len(p.payload) < 2+size {
+		return nil, fmt.Errorf("channel packet truncated: %d bits in %d bytes", p.payload[1], len(p.payload)-2)
+	}
+	return p.payload[2 : 2+size], nil
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package ambe
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// baudRates maps supported serial speeds to termios constants
+var baudRates = map[int]uint32{
+	115200: unix.B115200,
+	230400: unix.B230400,
+	460800: unix.B460800,
+	921600: unix.B921600,
+}
+
+// openSerial opens a serial device in raw 8N1 mode without flow control
+func openSerial(device string, baudRate int) (*os.File, error) {
+	if baudRate == 0 {
+		baudRate = 460800
+	}
+	speed, ok := baudRates[baudRate]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", baudRate)
+	}
+
+	// Non-blocking so reads honour deadlines
+	file, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", device, err)
+	}
+
+	fd := int(file.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a serial device: %w", device, err)
+	}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP |
+		unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	termios.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+	termios.Ispeed = speed
+	termios.Ospeed = speed
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to configure %s: %w", device, err)
+	}
+
+	// Discard whatever the dongle sent before we opened it
+	if err := unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIOFLUSH); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to flush %s: %w", device, err)
+	}
+	return file, nil
+}
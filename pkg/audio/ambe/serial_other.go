@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ambe
+
+import (
+	"fmt"
+	"io"
+)
+
+// openSerial is not supported on this platform; use an AMBEServer
+func openSerial(device string, baudRate int) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("serial AMBE dongles are only supported on Linux; use an AMBEServer address")
+}
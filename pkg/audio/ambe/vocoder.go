@@ -0,0 +1,333 @@
+package ambe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// Mode selects the AMBE rate the vocoder is programmed for
+type Mode string
+
+const (
+	ModeDMR   Mode = "dmr"   // AMBE+2 3600x2450 with FEC, 72-bit frames (DMR, YSF, NXDN)
+	ModeDMR49 Mode = "dmr49" // AMBE+2 2450 without FEC, 49-bit frames
+	ModeDStar Mode = "dstar" // AMBE 3600x2400 with FEC, 72-bit frames (D-STAR)
+)
+
+// modeInfo describes a mode's frame size, rate setup, and TLV tag
+type modeInfo struct {
+	bits int
+	rate []byte // Control fields selecting the rate
+	tag  usrp.TLVTag
+}
+
+// modes holds the supported rates. Rate control words are from the
+// AMBE-3000R manual's rate tables.
+var modes = map[Mode]modeInfo{
+	ModeDMR: {
+		bits: 72,
+		rate: []byte{fieldRateP, 0x04, 0x31, 0x07, 0x54, 0x24, 0x00, 0x00, 0x00, 0x00, 0x00, 0x6F, 0x48},
+		tag:  usrp.TLV_TAG_AMBE,
+	},
+	ModeDMR49: {
+		bits: 49,
+		rate: []byte{fieldRateT, 33},
+		tag:  usrp.TLV_TAG_AMBE_49,
+	},
+	ModeDStar: {
+		bits: 72,
+		rate: []byte{fieldRateP, 0x01, 0x30, 0x07, 0x63, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x48},
+		tag:  usrp.TLV_TAG_DSAMBE,
+	},
+}
+
+// Config holds vocoder settings. Set Device for a USB dongle or Address
+// for an AMBEServer.
+type Config struct {
+	Device   string        // Serial device, e.g. /dev/ttyUSB0
+	BaudRate int           // Serial speed: 460800 for ThumbDV, 230400 for older DV3000U
+	Address  string        // AMBEServer host:port
+	Network  string        // AMBEServer transport: "udp" (default) or "tcp"
+	Mode     Mode          // AMBE rate
+	Timeout  time.Duration // Longest wait for each reply
+}
+
+// DefaultConfig returns a ThumbDV configuration for DMR
+func DefaultConfig() *Config {
+	return &Config{
+		Device:   "/dev/ttyUSB0",
+		BaudRate: 460800,
+		Network:  "udp",
+		Mode:     ModeDMR,
+		Timeout:  time.Second,
+	}
+}
+
+// Vocoder transcodes between AMBE frames and 8 kHz PCM on an AMBE-3000R.
+// The chip handles one request at a time, so calls are serialized.
+type Vocoder struct {
+	config    *Config
+	mode      modeInfo
+	conn      io.ReadWriteCloser
+	reader    *bufio.Reader
+	productID string
+	mutex     sync.Mutex
+	closed    bool
+}
+
+// NewVocoder opens the dongle or AMBEServer, resets the chip, and programs
+// the configured rate
+func NewVocoder(config *Config) (*Vocoder, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	mode, ok := modes[config.Mode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported AMBE mode %q (want %q, %q or %q)", config.Mode, ModeDMR, ModeDMR49, ModeDStar)
+	}
+
+	var conn io.ReadWriteCloser
+	var err error
+	if config.Address != "" {
+		network := config.Network
+		if network == "" {
+			network = "udp"
+		}
+		conn, err = net.DialTimeout(network, config.Address, config.timeout())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to AMBEServer: %w", err)
+		}
+	} else {
+		conn, err = openSerial(config.Device, config.BaudRate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	v := &Vocoder{
+		config: config,
+		mode:   mode,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if err := v.init(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return v, nil
+}
+
+// timeout returns the reply timeout, defaulting to one second
+func (c *Config) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return time.Second
+}
+
+// init resets the chip, turns off parity, reads its product ID, and selects
+// the rate
+func (v *Vocoder) init() error {
+	reply, err := v.request(packet{kind: packetControl, payload: []byte{fieldReset}})
+	if err != nil {
+		return fmt.Errorf("failed to reset vocoder: %w", err)
+	}
+	if !bytes.Equal(reply.payload, []byte{fieldReady}) {
+		return fmt.Errorf("vocoder did not report ready after reset")
+	}
+
+	if err := v.control(fieldParityMode, 0); err != nil {
+		return fmt.Errorf("failed to disable parity: %w", err)
+	}
+
+	reply, err = v.request(packet{kind: packetControl, payload: []byte{fieldProductID}})
+	if err != nil {
+		return fmt.Errorf("failed to read product ID: %w", err)
+	}
+	if len(reply.payload) < 1 || reply.payload[0] != fieldProductID {
+		return fmt.Errorf("unexpected product ID reply")
+	}
+	v.productID = string(bytes.TrimRight(reply.payload[1:], "\x00"))
+
+	if err := v.control(v.mode.rate[0], v.mode.rate[1:]...); err != nil {
+		return fmt.Errorf("failed to set AMBE rate: %w", err)
+	}
+	return nil
+}
+
+// control sends a control field and checks the chip's status reply
+func (v *Vocoder) control(field byte, data ...byte) error {
+	reply, err := v.request(packet{kind: packetControl, payload: append([]byte{field}, data...)})
+	if err != nil {
+		return err
+	}
+	if len(reply.payload) < 2 || reply.payload[0] != field {
+		return fmt.Errorf("unexpected reply to control field 0x%02x", field)
+	}
+	if reply.payload[1] != 0 {
+		return fmt.Errorf("control field 0x%02x rejected with status %d", field, reply.payload[1])
+	}
+	return nil
+}
+
+// request sends a packet and waits for the reply, bounded by Timeout
+func (v *Vocoder) request(p packet) (packet, error) {
+	if d, ok := v.conn.(interface{ SetDeadline(time.Time) error }); ok {
+		if err := d.SetDeadline(time.Now().Add(v.config.timeout())); err != nil {
+			return packet{}, fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+	if _, err := v.conn.Write(p.marshal()); err != nil {
+		return packet{}, fmt.Errorf("failed to write packet: %w", err)
+	}
+	reply, err := readPacket(v.reader)
+	if err != nil {
+		return packet{}, fmt.Errorf("failed to read reply: %w", err)
+	}
+	return reply, nil
+}
+
+// ProductID returns the chip's product string, e.g. "AMBE3000R"
+func (v *Vocoder) ProductID() string {
+	return v.productID
+}
+
+// Mode returns the programmed AMBE rate
+func (v *Vocoder) Mode() Mode {
+	return v.config.Mode
+}
+
+// FrameBytes returns the size of one packed AMBE frame
+func (v *Vocoder) FrameBytes() int {
+	return (v.mode.bits + 7) / 8
+}
+
+// Tag returns the USRP TLV tag that carries the mode's AMBE frames
+func (v *Vocoder) Tag() usrp.TLVTag {
+	return v.mode.tag
+}
+
+// Decode converts one AMBE frame to 160 PCM samples (20 ms at 8 kHz)
+func (v *Vocoder) Decode(frame []byte) ([]int16, error) {
+	if len(frame) != v.FrameBytes() {
+		return nil, fmt.Errorf("AMBE frame must be %d bytes, got %d", v.FrameBytes(), len(frame))
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		return nil, fmt.Errorf("vocoder is closed")
+	}
+
+	reply, err := v.request(channelPacket(v.mode.bits, frame))
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := reply.samples()
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) != usrp.VoiceFrameSize {
+		return nil, fmt.Errorf("vocoder returned %d samples, want %d", len(pcm), usrp.VoiceFrameSize)
+	}
+	return pcm, nil
+}
+
+// Encode converts 160 PCM samples (20 ms at 8 kHz) to one AMBE frame
+func (v *Vocoder) Encode(pcm []int16) ([]byte, error) {
+	if len(pcm) != usrp.VoiceFrameSize {
+		return nil, fmt.Errorf("PCM frame must be %d samples, got %d", usrp.VoiceFrameSize, len(pcm))
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.closed {
+		return nil, fmt.Errorf("vocoder is closed")
+	}
+
+	reply, err := v.request(speechPacket(pcm))
+	if err != nil {
+		return nil, err
+	}
+	frame, err := reply.channelData()
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) != v.FrameBytes() {
+		return nil, fmt.Errorf("vocoder returned %d byte frame, want %d", len(frame), v.FrameBytes())
+	}
+	return frame, nil
+}
+
+// USRPToFormat encodes a USRP voice frame as one AMBE frame
+func (v *Vocoder) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	return v.Encode(voiceMsg.AudioData[:])
+}
+
+// FormatToUSRP decodes concatenated AMBE frames into USRP voice frames
+func (v *Vocoder) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	size := v.FrameBytes()
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("AMBE data of %d bytes is not a whole number of %d byte frames", len(data), size)
+	}
+
+	var messages []*usrp.VoiceMessage
+	for offset := 0; offset < len(data); offset += size {
+		pcm, err := v.Decode(data[offset : offset+size])
+		if err != nil {
+			return messages, err
+		}
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+		copy(msg.AudioData[:], pcm)
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// TLVToVoice decodes the AMBE frames of a TLV message into voice frames
+// that keep its sequence number, talkgroup and PTT state
+func (v *Vocoder) TLVToVoice(msg *usrp.TLVMessage) ([]*usrp.VoiceMessage, error) {
+	data, ok := msg.GetTLV(v.mode.tag)
+	if !ok {
+		return nil, fmt.Errorf("TLV message has no tag 0x%02x AMBE data", uint8(v.mode.tag))
+	}
+	messages, err := v.FormatToUSRP(data)
+	for _, voice := range messages {
+		voice.Header = msg.Header
+		voice.Header.Type = uint32(usrp.USRP_TYPE_VOICE)
+	}
+	return messages, err
+}
+
+// VoiceToTLV encodes a voice frame as a TLV message carrying one AMBE
+// frame, keeping its sequence number, talkgroup and PTT state
+func (v *Vocoder) VoiceToTLV(msg *usrp.VoiceMessage) (*usrp.TLVMessage, error) {
+	frame, err := v.Encode(msg.AudioData[:])
+	if err != nil {
+		return nil, err
+	}
+	return usrp.NewTLV(msg.Header.Seq).
+		Tag(v.mode.tag, frame).
+		TalkGroup(msg.Header.TalkGroup).
+		PTT(msg.Header.IsPTT()).
+		Build()
+}
+
+// Close releases the dongle or AMBEServer connection
+func (v *Vocoder) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.closed {
+		return nil
+	}
+	v.closed = true
+	return v.conn.Close()
+}
@@ -0,0 +1,234 @@
+package ambe
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+var _ audio.Converter = (*Vocoder)(nil)
+
+// fakeServer is an AMBEServer stand-in. It "decodes" each AMBE byte b to
+// samples of b*100 and "encodes" by the reverse, so round trips are exact.
+type fakeServer struct {
+	conn  *net.UDPConn
+	mutex sync.Mutex
+	rates [][]byte // Rate fields received
+}
+
+// programmed returns the rate fields received
+func (s *fakeServer) programmed() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rates
+}
+
+// newFakeServer starts a fake AMBEServer on loopback
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{conn: conn}
+	go s.serve()
+	t.Cleanup(func() { conn.Close() })
+	return s
+}
+
+// serve answers requests until the socket closes
+func (s *fakeServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req, err := readPacket(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil {
+			continue
+		}
+
+		var reply []byte
+		switch req.kind {
+		case packetControl:
+			switch field := req.payload[0]; field {
+			case fieldReset:
+				// Parity is still on, and a reset may leave noise behind
+				p := packet{kind: packetControl, payload: []byte{fieldReady, fieldParity, 0x00}}
+				reply = append([]byte{0xFF, 0x00}, p.marshal()...)
+			case fieldProductID:
+				reply = packet{kind: packetControl, payload: []byte{fieldProductID, 'A', 'M', 'B', 'E', '3', '0', '0', '0', 'R', 0}}.marshal()
+			case fieldRateP, fieldRateT:
+				s.mutex.Lock()
+				s.rates = append(s.rates, append([]byte(nil), req.payload...))
+				s.mutex.Unlock()
+				reply = packet{kind: packetControl, payload: []byte{field, 0}}.marshal()
+			default:
+				reply = packet{kind: packetControl, payload: []byte{field, 0}}.marshal()
+			}
+		case packetChannel:
+			data, _ := req.channelData()
+			pcm := make([]int16, usrp.VoiceFrameSize)
+			for i := range pcm {
+				pcm[i] = int16(data[i%len(data)]) * 100
+			}
+			reply = speechPacket(pcm).marshal()
+		case packetSpeech:
+			pcm, _ := req.samples()
+			data := make([]byte, 9)
+			for i := range data {
+				data[i] = byte(pcm[i] / 100)
+			}
+			bits := 72
+			if rates := s.programmed(); len(rates) > 0 && rates[0][0] == fieldRateT {
+				bits, data = 49, data[:7]
+			}
+			reply = channelPacket(bits, data).marshal()
+		}
+		s.conn.WriteToUDP(reply, addr)
+	}
+}
+
+// newTestVocoder connects a vocoder to a fake server
+func newTestVocoder(t *testing.T, mode Mode) (*Vocoder, *fakeServer) {
+	t.Helper()
+	server := newFakeServer(t)
+	config := DefaultConfig()
+	config.Address = server.conn.LocalAddr().String()
+	config.Mode = mode
+	v, err := NewVocoder(config)
+	if err != nil {
+		t.Fatalf("NewVocoder failed: %v", err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v, server
+}
+
+func TestVocoder_Init(t *testing.T) {
+	v, server := newTestVocoder(t, ModeDStar)
+
+	if v.ProductID() != "AMBE3000R" {
+		t.Errorf("Expected product AMBE3000R, got %q", v.ProductID())
+	}
+	if rates := server.programmed(); len(rates) != 1 || !bytes.Equal(rates[0], modes[ModeDStar].rate) {
+		t.Errorf("Expected D-STAR rate to be programmed, got %x", rates)
+	}
+	if v.FrameBytes() != 9 || v.Tag() != usrp.TLV_TAG_DSAMBE {
+		t.Errorf("Got %d byte frames with tag 0x%02x", v.FrameBytes(), uint8(v.Tag()))
+	}
+}
+
+func TestVocoder_RoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		mode  Mode
+		bytes int
+	}{
+		{ModeDMR, 9},
+		{ModeDMR49, 7},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			v, _ := newTestVocoder(t, tt.mode)
+
+			frame := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}[:tt.bytes]
+			pcm, err := v.Decode(frame)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if len(pcm) != usrp.VoiceFrameSize || pcm[0] != 100 || pcm[1] != 200 {
+				t.Fatalf("Unexpected PCM: %d samples starting %v", len(pcm), pcm[:2])
+			}
+
+			encoded, err := v.Encode(pcm)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if !bytes.Equal(encoded, frame) {
+				t.Errorf("Round trip: got %x, want %x", encoded, frame)
+			}
+
+			if _, err := v.Decode(frame[:3]); err == nil {
+				t.Error("Expected error for a short frame")
+			}
+			if _, err := v.Encode(pcm[:80]); err == nil {
+				t.Error("Expected error for a short PCM frame")
+			}
+		})
+	}
+}
+
+func TestVocoder_TLV(t *testing.T) {
+	v, _ := newTestVocoder(t, ModeDMR)
+
+	voice := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 42)}
+	voice.Header.TalkGroup = 3100
+	voice.Header.SetPTT(true)
+	for i := range voice.AudioData {
+		voice.AudioData[i] = int16(i%9+1) * 100
+	}
+
+	tlv, err := v.VoiceToTLV(voice)
+	if err != nil {
+		t.Fatalf("VoiceToTLV failed: %v", err)
+	}
+	if data, ok := tlv.GetTLV(usrp.TLV_TAG_AMBE); !ok || len(data) != 9 {
+		t.Fatalf("Expected a 9 byte AMBE tag, got %x", data)
+	}
+	if tlv.Header.Seq != 42 || tlv.Header.TalkGroup != 3100 || !tlv.Header.IsPTT() {
+		t.Errorf("Header not carried over: %+v", tlv.Header)
+	}
+
+	messages, err := v.TLVToVoice(tlv)
+	if err != nil {
+		t.Fatalf("TLVToVoice failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].AudioData != voice.AudioData {
+		t.Fatal("Voice frame did not survive the round trip")
+	}
+	if messages[0].Header.Type != uint32(usrp.USRP_TYPE_VOICE) || messages[0].Header.TalkGroup != 3100 {
+		t.Errorf("Unexpected voice header: %+v", messages[0].Header)
+	}
+
+	// Two frames in one payload decode to two voice frames
+	messages, err = v.FormatToUSRP(make([]byte, 18))
+	if err != nil || len(messages) != 2 {
+		t.Errorf("Expected 2 frames, got %d (%v)", len(messages), err)
+	}
+	if _, err := v.FormatToUSRP(make([]byte, 10)); err == nil {
+		t.Error("Expected error for a partial frame")
+	}
+	if _, err := v.TLVToVoice(&usrp.TLVMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TLV, 1)}); err == nil {
+		t.Error("Expected error for a TLV message without AMBE data")
+	}
+}
+
+func TestVocoder_Errors(t *testing.T) {
+	if _, err := NewVocoder(&Config{Address: "127.0.0.1:1", Mode: "p25"}); err == nil {
+		t.Error("Expected error for unsupported mode")
+	}
+
+	// Nothing answering: init times out
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	config := DefaultConfig()
+	config.Address = conn.LocalAddr().String()
+	config.Timeout = 50 * time.Millisecond
+	if _, err := NewVocoder(config); err == nil {
+		t.Error("Expected error when the AMBEServer does not answer")
+	}
+
+	v, _ := newTestVocoder(t, ModeDMR)
+	v.Close()
+	if _, err := v.Decode(make([]byte, 9)); err == nil {
+		t.Error("Expected error after Close")
+	}
+}
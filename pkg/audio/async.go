@@ -0,0 +1,308 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// ErrQueueFull is returned by AsyncConverter writes when FFmpeg is not
+// keeping up and the input queue is full
+var ErrQueueFull = errors.New("audio: converter queue full")
+
+// AsyncConverterConfig holds an AsyncConverter's buffer limits
+type AsyncConverterConfig struct {
+	InputQueue  int  // Writes waiting for FFmpeg, per direction
+	OutputQueue int  // Converted chunks or frames waiting to be received, per direction
+	BlockOnFull bool // Writes wait for room rather than fail with ErrQueueFull
+}
+
+// DefaultAsyncConverterConfig returns queues holding a second of 20 ms
+// frames each way, with writes failing rather than blocking when full
+func DefaultAsyncConverterConfig() *AsyncConverterConfig {
+	return &AsyncConverterConfig{
+		InputQueue:  50,
+		OutputQueue: 50,
+	}
+}
+
+// AsyncConverterStats holds AsyncConverter counters
+type AsyncConverterStats struct {
+	Queued  int    `json:"queued"`  // Writes waiting for FFmpeg
+	Written uint64 `json:"written"` // Writes handed to FFmpeg
+	Dropped uint64 `json:"dropped"` // Writes refused with ErrQueueFull
+	Failed  uint64 `json:"failed"`  // Writes lost because FFmpeg was down
+}
+
+// AsyncConverter runs FFmpeg conversions without waiting on them. Writes
+// are queued and fed to FFmpeg in the background, and output is delivered
+// on the Encoded and Decoded channels as soon as FFmpeg produces it, so
+// there is no read timeout to tune and nothing FFmpeg buffers internally
+// is lost. A slow receiver holds FFmpeg up, which fills the input queue,
+// which fails or blocks writes: backpressure reaches the producer rather
+// than growing memory. The FFmpeg processes are supervised as for
+// StreamingConverter.
+type AsyncConverter struct {
+	sc     *StreamingConverter
+	config AsyncConverterConfig
+
+	toFormat   chan []byte // PCM waiting for the encoder
+	fromFormat chan []byte // Format data waiting for the decoder; nil with EncodeOnly
+	encoded    chan []byte
+	decoded    chan *usrp.VoiceMessage
+	workers    sync.WaitGroup
+
+	mutex   sync.Mutex // Guards the counters
+	written uint64
+	dropped uint64
+	failed  uint64
+}
+
+// NewAsyncConverter starts FFmpeg for config and the workers feeding and
+// reading it. A nil async uses DefaultAsyncConverterConfig.
+func NewAsyncConverter(config *ConverterConfig, async *AsyncConverterConfig) (*AsyncConverter, error) {
+	defaults := DefaultAsyncConverterConfig()
+	if async == nil {
+		async = defaults
+	}
+	cfg := *async
+	if cfg.InputQueue <= 0 {
+		cfg.InputQueue = defaults.InputQueue
+	}
+	if cfg.OutputQueue <= 0 {
+		cfg.OutputQueue = defaults.OutputQueue
+	}
+
+	sc, err := NewStreamingConverter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &AsyncConverter{
+		sc:       sc,
+		config:   cfg,
+		toFormat: make(chan []byte, cfg.InputQueue),
+		encoded:  make(chan []byte, cfg.OutputQueue),
+		decoded:  make(chan *usrp.VoiceMessage, cfg.OutputQueue),
+	}
+
+	ac.workers.Add(2)
+	go ac.writer(sc.toFormat, ac.toFormat)
+	go ac.reader(sc.toFormat, ac.deliverEncoded, func() { close(ac.encoded) })
+
+	if sc.fromFormat == nil {
+		close(ac.decoded)
+		return ac, nil
+	}
+	ac.fromFormat = make(chan []byte, cfg.InputQueue)
+	framer := NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate)
+	var downmix *pcmDownmixer
+	if sc.downmix != nil {
+		downmix = newPCMDownmixer(sc.downmix.matrix)
+	}
+	ac.workers.Add(2)
+	go ac.writer(sc.fromFormat, ac.fromFormat)
+	go ac.reader(sc.fromFormat, func(data []byte) bool {
+		downmix.write(framer, data)
+		for _, msg := range framer.VoiceMessages() {
+			select {
+			case ac.decoded <- msg:
+			case <-ac.sc.done:
+				return false
+			}
+		}
+		return true
+	}, func() { close(ac.decoded) })
+	return ac, nil
+}
+
+// WriteUSRP queues a voice frame for encoding. The result arrives on
+// Encoded.
+func (ac *AsyncConverter) WriteUSRP(voiceMsg *usrp.VoiceMessage) error {
+	pcmBytes := make([]byte, len(voiceMsg.AudioData)*2)
+	for i, sample := range voiceMsg.AudioData {
+		binary.LittleEndian.PutUint16(pcmBytes[i*2:], uint16(sample))
+	}
+	return ac.enqueue(ac.toFormat, pcmBytes)
+}
+
+// WriteFormat queues format data for decoding. The voice frames arrive on
+// Decoded.
+func (ac *AsyncConverter) WriteFormat(data []byte) error {
+	if ac.fromFormat == nil {
+		return fmt.Errorf("converter only encodes")
+	}
+	return ac.enqueue(ac.fromFormat, append([]byte(nil), data...))
+}
+
+// Encoded returns the channel of encoded output, in chunks as FFmpeg
+// writes them. It is closed when the converter closes.
+func (ac *AsyncConverter) Encoded() <-chan []byte {
+	return ac.encoded
+}
+
+// Decoded returns the channel of decoded voice frames. It is closed when
+// the converter closes, at once for converters that only encode.
+func (ac *AsyncConverter) Decoded() <-chan *usrp.VoiceMessage {
+	return ac.decoded
+}
+
+// enqueue adds data to a writer's queue, failing or waiting when it is full
+func (ac *AsyncConverter) enqueue(queue chan []byte, data []byte) error {
+	select {
+	case <-ac.sc.done:
+		return fmt.Errorf("converter is closed")
+	default:
+	}
+
+	if ac.config.BlockOnFull {
+		select {
+		case queue <- data:
+			return nil
+		case <-ac.sc.done:
+			return fmt.Errorf("converter is closed")
+		}
+	}
+
+	select {
+	case queue <- data:
+		return nil
+	default:
+		ac.mutex.Lock()
+		ac.dropped++
+		ac.mutex.Unlock()
+		return ErrQueueFull
+	}
+}
+
+// writer feeds queued data to p, through restarts, until the converter
+// closes. Writes block while FFmpeg is not reading, so they happen without
+// the converter's mutex.
+func (ac *AsyncConverter) writer(p *ffmpegProcess, queue chan []byte) {
+	defer ac.workers.Done()
+
+	for {
+		var data []byte
+		select {
+		case <-ac.sc.done:
+			return
+		case data = <-queue:
+		}
+
+		ac.sc.mutex.Lock()
+		stdin, running := p.stdin, p.running
+		ac.sc.mutex.Unlock()
+
+		var err error
+		if running {
+			_, err = stdin.Write(data)
+		}
+		ac.mutex.Lock()
+		if running && err == nil {
+			ac.written++
+		} else {
+			ac.failed++
+		}
+		ac.mutex.Unlock()
+	}
+}
+
+// reader hands p's output to deliver as it arrives, following p through
+// restarts, until the converter closes or deliver gives up. done runs on
+// the way out.
+func (ac *AsyncConverter) reader(p *ffmpegProcess, deliver func([]byte) bool, done func()) {
+	defer ac.workers.Done()
+	defer done()
+
+	buf := make([]byte, 8192)
+	for {
+		ac.sc.mutex.Lock()
+		stdout, exited, closed := p.stdout, p.exited, ac.sc.closed
+		ac.sc.mutex.Unlock()
+		if closed {
+			return
+		}
+
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 && !deliver(buf[:n]) {
+				return
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		// The process died or was replaced; wait for the supervisor to
+		// start another
+		select {
+		case <-ac.sc.done:
+			return
+		case <-exited:
+		}
+		if !ac.awaitRestart(p, stdout) {
+			return
+		}
+	}
+}
+
+// awaitRestart waits until p has output other than stdout, reporting false
+// if the converter closes first
+func (ac *AsyncConverter) awaitRestart(p *ffmpegProcess, stdout io.ReadCloser) bool {
+	for {
+		ac.sc.mutex.Lock()
+		restarted := p.stdout != stdout && p.running
+		ac.sc.mutex.Unlock()
+		if restarted {
+			return true
+		}
+
+		select {
+		case <-ac.sc.done:
+			return false
+		case <-time.After(ffmpegRestartMin):
+		}
+	}
+}
+
+// deliverEncoded sends a copy of encoded output to the receiver, waiting
+// while it is behind
+func (ac *AsyncConverter) deliverEncoded(data []byte) bool {
+	select {
+	case ac.encoded <- append([]byte(nil), data...):
+		return true
+	case <-ac.sc.done:
+		return false
+	}
+}
+
+// Health reports on the FFmpeg processes, as StreamingConverter does
+func (ac *AsyncConverter) Health() ConverterHealth {
+	return ac.sc.Health()
+}
+
+// Stats returns the converter's counters
+func (ac *AsyncConverter) Stats() AsyncConverterStats {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	return AsyncConverterStats{
+		Queued:  len(ac.toFormat) + len(ac.fromFormat),
+		Written: ac.written,
+		Dropped: ac.dropped,
+		Failed:  ac.failed,
+	}
+}
+
+// Close stops FFmpeg and the workers and closes the output channels.
+// Queued writes are discarded.
+func (ac *AsyncConverter) Close() error {
+	err := ac.sc.Close()
+	ac.workers.Wait()
+	return err
+}
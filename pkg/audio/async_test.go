@@ -0,0 +1,99 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsyncConverter_Streams(t *testing.T) {
+	// cat passes PCM straight through both ways
+	ac, err := NewAsyncConverter(fakeFFmpeg(t, "exec cat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ac.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := ac.WriteUSRP(toneFrame(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := 0
+	timeout := time.After(5 * time.Second)
+	for received < 20*320 {
+		select {
+		case data := <-ac.Encoded():
+			received += len(data)
+		case <-timeout:
+			t.Fatalf("Timed out with %d of %d bytes encoded", received, 20*320)
+		}
+	}
+
+	// Odd-sized chunks are framed across writes
+	want := toneFrame(7)
+	data := make([]byte, 320)
+	for i, sample := range want.AudioData {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	ac.WriteFormat(data[:101])
+	ac.WriteFormat(data[101:])
+	select {
+	case msg := <-ac.Decoded():
+		if msg.AudioData != want.AudioData {
+			t.Error("Decoded frame differs from the one sent")
+		}
+	case <-timeout:
+		t.Fatal("Timed out waiting for a decoded frame")
+	}
+
+	if stats := ac.Stats(); stats.Written != 22 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := ac.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-ac.Encoded(); ok {
+		t.Error("Expected Encoded closed with the converter")
+	}
+	if err := ac.WriteUSRP(toneFrame(0)); err == nil {
+		t.Error("Expected error writing to a closed converter")
+	}
+}
+
+func TestAsyncConverter_Backpressure(t *testing.T) {
+	// FFmpeg that never reads soon stops taking input
+	ac, err := NewAsyncConverter(fakeFFmpeg(t, "exec sleep 10"), &AsyncConverterConfig{InputQueue: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := make([]byte, 64*1024)
+	for i := 0; ; i++ {
+		err := ac.WriteFormat(chunk)
+		if errors.Is(err, ErrQueueFull) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 20 {
+			t.Fatal("Expected the queue to fill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := ac.Stats(); stats.Dropped != 1 || stats.Queued != 1 {
+		t.Errorf("Expected one queued and one dropped write, got %+v", stats)
+	}
+
+	// Close does not wait on the stuck writes
+	start := time.Now()
+	if err := ac.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %v", elapsed)
+	}
+}
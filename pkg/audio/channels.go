@@ -0,0 +1,182 @@
+package audio
+
+import (
+	"fmt"
+)
+
+// ChannelMatrix remixes interleaved audio from one channel layout to
+// another: each output channel is a weighted sum of the input channels.
+// Mono to stereo, stereo to mono, taking one channel of several, or a
+// custom downmix are all matrices.
+type ChannelMatrix struct {
+	in, out int
+	gains   []float64 // Row-major: gains[o*in+i] is input i's share of output o
+}
+
+// NewChannelMatrix creates a matrix from gains, one row per output channel
+// with a gain for each input channel. [[0.5, 0.5]] mixes stereo to mono;
+// [[1], [1]] copies mono to both sides of stereo.
+func NewChannelMatrix(gains [][]float64) (*ChannelMatrix, error) {
+	if len(gains) == 0 || len(gains[0]) == 0 {
+		return nil, fmt.Errorf("channel matrix is empty")
+	}
+	m := &ChannelMatrix{in: len(gains[0]), out: len(gains)}
+	for o, row := range gains {
+		if len(row) != m.in {
+			return nil, fmt.Errorf("channel matrix row %d has %d gains, want %d", o+1, len(row), m.in)
+		}
+		m.gains = append(m.gains, row...)
+	}
+	return m, nil
+}
+
+// DefaultChannelMatrix returns the usual remix from in channels to out:
+// mono is copied to every output, everything is mixed equally into mono,
+// and otherwise channels map across in order, extra inputs folding into
+// the outputs and extra outputs repeating the inputs
+func DefaultChannelMatrix(in, out int) (*ChannelMatrix, error) {
+	if in <= 0 || out <= 0 {
+		return nil, fmt.Errorf("channel counts must be positive, got %d and %d", in, out)
+	}
+
+	m := &ChannelMatrix{in: in, out: out, gains: make([]float64, in*out)}
+	for o := 0; o < out; o++ {
+		// Outputs past the inputs repeat them; inputs past the outputs
+		// are shared among them
+		var sources []int
+		for i := 0; i < in; i++ {
+			if i%out == o || (out > in && o%in == i) {
+				sources = append(sources, i)
+			}
+		}
+		for _, i := range sources {
+			m.gains[o*in+i] = 1 / float64(len(sources))
+		}
+	}
+	return m, nil
+}
+
+// SelectChannel returns a matrix taking one channel, numbered from 1, of
+// in channels as mono, e.g. the left of a stereo pair carrying a different
+// feed on each side
+func SelectChannel(in, channel int) (*ChannelMatrix, error) {
+	if channel < 1 || channel > in {
+		return nil, fmt.Errorf("channel %d out of range 1-%d", channel, in)
+	}
+	m := &ChannelMatrix{in: in, out: 1, gains: make([]float64, in)}
+	m.gains[channel-1] = 1
+	return m, nil
+}
+
+// In returns the number of input channels
+func (m *ChannelMatrix) In() int {
+	return m.in
+}
+
+// Out returns the number of output channels
+func (m *ChannelMatrix) Out() int {
+	return m.out
+}
+
+// Mix appends the remix of the interleaved samples in src to dst and
+// returns it. A trailing partial frame of src is ignored.
+func (m *ChannelMatrix) Mix(dst, src []int16) []int16 {
+	frames := len(src) / m.in
+	for f := 0; f < frames; f++ {
+		frame := src[f*m.in : (f+1)*m.in]
+		for o := 0; o < m.out; o++ {
+			gains := m.gains[o*m.in : (o+1)*m.in]
+			var acc float64
+			for i, s := range frame {
+				acc += gains[i] * float64(s)
+			}
+			dst = append(dst, clampInt16(acc))
+		}
+	}
+	return dst
+}
+
+// Apply returns the remix of the interleaved samples
+func (m *ChannelMatrix) Apply(samples []int16) []int16 {
+	return m.Mix(make([]int16, 0, len(samples)/m.in*m.out), samples)
+}
+
+// ChannelResampler resamples interleaved audio with a filter per channel,
+// remixing channels on the way: Discord's 48kHz stereo to USRP's 8kHz mono
+// and back. It remixes on whichever side has fewer channels, so a downmix
+// is resampled once rather than once per input channel. Like Resampler it
+// keeps history across Process calls and is not safe for concurrent use.
+type ChannelResampler struct {
+	mix     *ChannelMatrix
+	before  bool // Remix before resampling rather than after
+	filters []*Resampler
+	planes  [][]int16
+}
+
+// NewChannelResampler creates a streaming resampler from inRate to outRate
+// that remixes with mix. A nil mix resamples mono.
+func NewChannelResampler(inRate, outRate int, mix *ChannelMatrix, quality ResampleQuality) (*ChannelResampler, error) {
+	if mix == nil {
+		mix, _ = DefaultChannelMatrix(1, 1)
+	}
+	cr := &ChannelResampler{mix: mix, before: mix.out <= mix.in}
+	channels := mix.in
+	if cr.before {
+		channels = mix.out
+	}
+	for c := 0; c < channels; c++ {
+		r, err := NewResampler(inRate, outRate, quality)
+		if err != nil {
+			return nil, err
+		}
+		cr.filters = append(cr.filters, r)
+	}
+	cr.planes = make([][]int16, channels)
+	return cr, nil
+}
+
+// Process resamples and remixes the next block of interleaved samples
+func (cr *ChannelResampler) Process(in []int16) []int16 {
+	if cr.before {
+		in = cr.mix.Apply(in)
+	}
+
+	channels := len(cr.filters)
+	var out []int16
+	if channels == 1 {
+		out = cr.filters[0].Process(in)
+	} else {
+		frames := len(in) / channels
+		for c, filter := range cr.filters {
+			plane := cr.planes[c][:0]
+			for f := 0; f < frames; f++ {
+				plane = append(plane, in[f*channels+c])
+			}
+			cr.planes[c] = filter.Process(plane)
+		}
+		// Every filter is in the same state, so the planes match in length
+		out = make([]int16, len(cr.planes[0])*channels)
+		for c, plane := range cr.planes {
+			for f, s := range plane {
+				out[f*channels+c] = s
+			}
+		}
+	}
+
+	if !cr.before {
+		out = cr.mix.Apply(out)
+	}
+	return out
+}
+
+// Delay returns the filter's latency in output frames
+func (cr *ChannelResampler) Delay() int {
+	return cr.filters[0].Delay()
+}
+
+// Reset clears the filter history, as at the start of a new stream
+func (cr *ChannelResampler) Reset() {
+	for _, filter := range cr.filters {
+		filter.Reset()
+	}
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+func TestChannelMatrix(t *testing.T) {
+	stereo := []int16{100, 300, -200, 200, 1, 2, 7} // Trailing half frame
+	tests := []struct {
+		name string
+		in   []int16
+		mix  func() (*ChannelMatrix, error)
+		want []int16
+	}{
+		{"stereo to mono", stereo, func() (*ChannelMatrix, error) { return DefaultChannelMatrix(2, 1) }, []int16{200, 0, 2}},
+		{"mono to stereo", []int16{5, -5}, func() (*ChannelMatrix, error) { return DefaultChannelMatrix(1, 2) }, []int16{5, 5, -5, -5}},
+		{"stereo passthrough", stereo, func() (*ChannelMatrix, error) { return DefaultChannelMatrix(2, 2) }, stereo[:6]},
+		{"right channel", stereo, func() (*ChannelMatrix, error) { return SelectChannel(2, 2) }, []int16{300, 200, 2}},
+		{"custom downmix", stereo, func() (*ChannelMatrix, error) {
+			return NewChannelMatrix([][]float64{{1, -1}})
+		}, []int16{-200, -400, -1}},
+		{"quad to stereo", []int16{100, 200, 300, 400}, func() (*ChannelMatrix, error) { return DefaultChannelMatrix(4, 2) }, []int16{200, 300}},
+	}
+	for _, tt := range tests {
+		m, err := tt.mix()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := m.Apply(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Loud stereo mixes clip rather than wrap
+	boost, _ := NewChannelMatrix([][]float64{{1, 1}})
+	if got := boost.Apply([]int16{30000, 30000}); got[0] != 32767 {
+		t.Errorf("Mix of two loud channels gave %d", got[0])
+	}
+
+	if _, err := SelectChannel(2, 3); err == nil {
+		t.Error("Selected channel 3 of 2")
+	}
+	if _, err := NewChannelMatrix([][]float64{{1, 1}, {1}}); err == nil {
+		t.Error("Accepted ragged matrix")
+	}
+	if _, err := DefaultChannelMatrix(0, 1); err == nil {
+		t.Error("Accepted zero channels")
+	}
+}
+
+func TestChannelResampler(t *testing.T) {
+	// 1kHz in the left channel of 48kHz stereo and silence in the right,
+	// mixed equally down to 8kHz mono
+	downmix, _ := DefaultChannelMatrix(2, 1)
+	down, err := NewChannelResampler(48000, 8000, downmix, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tone := signal.NewSine(1000, 0.5, 48000)
+	left := make([]int16, 960)
+	var mono []int16
+	for i := 0; i < 50; i++ {
+		tone.Fill(left)
+		stereo := make([]int16, 1920)
+		for j, s := range left {
+			stereo[j*2] = s
+		}
+		out := down.Process(stereo)
+		if len(out) != 160 {
+			t.Fatalf("20ms of stereo became %d samples", len(out))
+		}
+		mono = append(mono, out...)
+	}
+	want := 0.25 * 32767 / math.Sqrt2
+	if got := rms(mono[len(mono)/2:]); math.Abs(got-want) > want*0.05 {
+		t.Errorf("Downmixed level %.0f, want %.0f", got, want)
+	}
+
+	// Back up to stereo: both channels carry the same audio
+	upmix, _ := DefaultChannelMatrix(1, 2)
+	up, err := NewChannelResampler(8000, 48000, upmix, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stereo := up.Process(mono[:160])
+	if len(stereo) != 1920 {
+		t.Fatalf("20ms of mono became %d samples", len(stereo))
+	}
+	for i := 0; i < len(stereo); i += 2 {
+		if stereo[i] != stereo[i+1] {
+			t.Fatalf("Channels differ at frame %d: %d, %d", i/2, stereo[i], stereo[i+1])
+		}
+	}
+
+	// Stereo resampled as stereo keeps the channels apart
+	both, _ := DefaultChannelMatrix(2, 2)
+	passthrough, err := NewChannelResampler(8000, 16000, both, ResampleFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make([]int16, 320)
+	for i := 0; i < len(in); i += 2 {
+		in[i] = 10000
+	}
+	for i := 0; i < 5; i++ {
+		out := passthrough.Process(in)
+		if i == 4 && (math.Abs(float64(out[len(out)-2])-10000) > 100 || math.Abs(float64(out[len(out)-1])) > 100) {
+			t.Errorf("Channels bled: left %d, right %d", out[len(out)-2], out[len(out)-1])
+		}
+	}
+}
+
+func TestConverterConfig_Downmix(t *testing.T) {
+	// Stereo decoded PCM, split mid-frame and mid-sample across writes,
+	// taking the right channel only
+	config := &ConverterConfig{Channels: 2, Channel: 2}
+	matrix, err := config.downmix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newPCMDownmixer(matrix)
+	if d.channels() != 2 {
+		t.Fatalf("Decoding %d channels, want 2", d.channels())
+	}
+
+	pcm := make([]byte, 320*2*2)
+	for i := 0; i < 320; i++ {
+		binary.LittleEndian.PutUint16(pcm[i*4:], 0xffff)
+		binary.LittleEndian.PutUint16(pcm[i*4+2:], uint16(int16(i)))
+	}
+	framer := NewFrameAligner(0, 0)
+	d.write(framer, pcm[:3])
+	d.write(framer, pcm[3:1001])
+	d.write(framer, pcm[1001:])
+	frames := framer.Frames()
+	if len(frames) != 2 {
+		t.Fatalf("Got %d frames, want 2", len(frames))
+	}
+	for i, frame := range frames {
+		for j, s := range frame.Samples {
+			if s != int16(i*160+j) {
+				t.Fatalf("Frame %d sample %d is %d", i, j, s)
+			}
+		}
+	}
+
+	// Mono with no selection leaves the mix to the backend
+	if m, err := (&ConverterConfig{Channels: 1}).downmix(); err != nil || m != nil {
+		t.Errorf("Mono config gave a downmix: %v, %v", m, err)
+	}
+	if _, err := (&ConverterConfig{Channels: 2, Downmix: []float64{1}}).downmix(); err == nil {
+		t.Error("Accepted one gain for two channels")
+	}
+	if newPCMDownmixer(nil).channels() != 1 {
+		t.Error("Nil downmixer does not decode mono")
+	}
+}
@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// Codec2Mode selects a Codec2 bit rate, named as FFmpeg's libcodec2 -mode
+type Codec2Mode string
+
+const (
+	Codec2Mode3200 Codec2Mode = "3200" // 20 ms frames of 8 bytes, as carried by M17 voice streams
+	Codec2Mode1600 Codec2Mode = "1600" // 40 ms frames of 8 bytes, as carried by M17 voice+data streams
+	Codec2Mode700C Codec2Mode = "700C" // 40 ms frames of 4 bytes (28 bits), as used by FreeDV 700C/D/E
+)
+
+// codec2Frame describes one Codec2 frame of a mode
+type codec2Frame struct {
+	duration time.Duration
+	bytes    int
+}
+
+// codec2Frames holds the frame layout of each supported mode
+var codec2Frames = map[Codec2Mode]codec2Frame{
+	Codec2Mode3200: {20 * time.Millisecond, 8},
+	Codec2Mode1600: {40 * time.Millisecond, 8},
+	Codec2Mode700C: {40 * time.Millisecond, 4},
+}
+
+// Codec2Converter converts between USRP voice frames and raw Codec2 frames
+// (FFmpeg's codec2raw format: concatenated frames, no header) using
+// FFmpeg built with libcodec2. Codec2 is not available in pure Go.
+//
+// Modes with 40 ms frames consume two USRP frames per Codec2 frame, so
+// USRPToFormat returns no data for every other call.
+type Codec2Converter struct {
+	*StreamingConverter
+	mode    Codec2Mode
+	frame   codec2Frame
+	pending []int16 // USRP samples not yet encoded
+}
+
+// NewCodec2Converter creates a converter for USRP <-> Codec2 conversion
+func NewCodec2Converter(mode Codec2Mode) (*Codec2Converter, error) {
+	return NewCodec2ConverterWithFFmpeg(mode, nil)
+}
+
+// NewCodec2ConverterWithFFmpeg is NewCodec2Converter running FFmpeg as
+// ffmpeg says. A nil ffmpeg runs "ffmpeg" from PATH.
+func NewCodec2ConverterWithFFmpeg(mode Codec2Mode, ffmpeg *FFmpegConfig) (*Codec2Converter, error) {
+	frame, ok := codec2Frames[mode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Codec2 mode %q (want %q, %q or %q)",
+			mode, Codec2Mode3200, Codec2Mode1600, Codec2Mode700C)
+	}
+
+	sc, err := NewStreamingConverter(&ConverterConfig{
+		InputFormat:  "codec2raw",
+		OutputFormat: "codec2raw",
+		InputRate:    8000,
+		OutputRate:   8000,
+		Channels:     1,
+		FrameSize:    frame.duration,
+		Codec2Mode:   mode,
+		FFmpeg:       ffmpeg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Codec2Converter{
+		StreamingConverter: sc,
+		mode:               mode,
+		frame:              frame,
+		pending:            make([]int16, 0, usrp.VoiceFrameSize*2),
+	}, nil
+}
+
+// Mode returns the converter's Codec2 mode
+func (cc *Codec2Converter) Mode() Codec2Mode {
+	return cc.mode
+}
+
+// FrameBytes returns the size of one encoded Codec2 frame
+func (cc *Codec2Converter) FrameBytes() int {
+	return cc.frame.bytes
+}
+
+// USRPToFormat encodes USRP voice frames into whole Codec2 frames. It
+// returns nil data while half of a 40 ms frame is buffered.
+func (cc *Codec2Converter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	sc := cc.StreamingConverter
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	cc.pending = append(cc.pending, voiceMsg.AudioData[:]...)
+	samples := int(cc.frame.duration.Milliseconds()) * USRPSampleRate / 1000
+	if len(cc.pending) < samples {
+		return nil, nil
+	}
+
+	pcmBytes := make([]byte, samples*2)
+	for i, sample := range cc.pending[:samples] {
+		binary.LittleEndian.PutUint16(pcmBytes[i*2:], uint16(sample))
+	}
+	cc.pending = cc.pending[:copy(cc.pending, cc.pending[samples:])]
+
+	if err := sc.toFormat.write(pcmBytes); err != nil {
+		return nil, fmt.Errorf("failed to write PCM data: %w", err)
+	}
+
+	// Codec2 frames are fixed size; read exactly one
+	result := make([]byte, cc.frame.bytes)
+	for n := 0; n < len(result); {
+		m, err := sc.readWithTimeout(sc.toFormat.stdout, result[n:], 100*time.Millisecond)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Codec2 data: %w", sc.toFormat.readError(err))
+		}
+		n += m
+	}
+	return result, nil
+}
+
+// Flush ends a transmission, padding a half-filled 40 ms frame with
+// silence so the last 20 ms of speech are encoded rather than dropped or
+// prepended to the next transmission
+func (cc *Codec2Converter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	sc := cc.StreamingConverter
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+
+	if len(cc.pending) > 0 {
+		samples := int(cc.frame.duration.Milliseconds()) * USRPSampleRate / 1000
+		pcmBytes := make([]byte, samples*2)
+		for i, sample := range cc.pending {
+			binary.LittleEndian.PutUint16(pcmBytes[i*2:], uint16(sample))
+		}
+		cc.pending = cc.pending[:0]
+		if err := sc.toFormat.write(pcmBytes); err != nil {
+			sc.resetFramer()
+			return nil, nil, fmt.Errorf("failed to write PCM data: %w", err)
+		}
+	}
+	return sc.flush()
+}
@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+)
+
+var _ Converter = (*Codec2Converter)(nil)
+
+func TestCodec2Converter_InvalidMode(t *testing.T) {
+	for _, mode := range []Codec2Mode{"", "2400", "700c"} {
+		if _, err := NewCodec2Converter(mode); err == nil {
+			t.Errorf("Expected error for mode %q", mode)
+		}
+	}
+}
+
+func TestCodec2Converter_RoundTrip(t *testing.T) {
+	tests := []struct {
+		mode       Codec2Mode
+		frameBytes int
+		perFrames  int // USRP frames per Codec2 frame
+	}{
+		{Codec2Mode3200, 8, 1},
+		{Codec2Mode1600, 8, 2},
+		{Codec2Mode700C, 4, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			converter, err := NewCodec2Converter(tt.mode)
+			if err != nil {
+				t.Skipf("FFmpeg not available: %v", err)
+			}
+			defer converter.Close()
+
+			if converter.Mode() != tt.mode || converter.FrameBytes() != tt.frameBytes {
+				t.Fatalf("Got mode %q with %d byte frames", converter.Mode(), converter.FrameBytes())
+			}
+
+			var encoded []byte
+			for n := 0; n < 10; n++ {
+				data, err := converter.USRPToFormat(toneFrame(n))
+				if err != nil {
+					if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "broken pipe") {
+						t.Skipf("FFmpeg without libcodec2: %v", err)
+					}
+					t.Fatalf("Frame %d: %v", n, err)
+				}
+				if (n+1)%tt.perFrames != 0 {
+					if data != nil {
+						t.Fatalf("Frame %d: expected no data mid Codec2 frame, got %d bytes", n, len(data))
+					}
+					continue
+				}
+				if len(data) != tt.frameBytes {
+					t.Fatalf("Frame %d: expected %d bytes, got %d", n, tt.frameBytes, len(data))
+				}
+				encoded = append(encoded, data...)
+			}
+
+			messages, err := converter.FormatToUSRP(encoded)
+			if err != nil {
+				t.Fatalf("Codec2 to USRP conversion failed: %v", err)
+			}
+			t.Logf("Decoded %d bytes of Codec2 %s into %d USRP frames", len(encoded), tt.mode, len(messages))
+		})
+	}
+}
@@ -1,13 +1,13 @@
 // Package audio provides audio conversion utilities for USRP packets
-// using FFmpeg for format conversion between PCM and compressed formats like Opus/Ogg
+// using FFmpeg for format conversion between PCM and compressed formats like Opus/Ogg and Codec2,
+// with pure Go Opus and FLAC codecs for deployments without FFmpeg
 package audio
 
 import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"log"
-	"os/exec"
+	"slices"
 	"sync"
 	"time"
 
@@ -26,6 +26,61 @@ type Converter interface {
 	Close() error
 }
 
+// Flusher is implemented by converters that hold audio between calls:
+// encoder lookahead, half-filled codec frames, decoded samples short of a
+// USRP frame. Call Flush when a transmission ends (at unkey). It returns
+// the encoded tail of what went through USRPToFormat and the samples
+// FormatToUSRP had yet to frame, padded with silence into a last frame,
+// then resets codec state so nothing carries over into the next
+// transmission.
+type Flusher interface {
+	Flush() ([]byte, []*usrp.VoiceMessage, error)
+}
+
+// FlushConverter flushes converter if it holds audio between calls;
+// converters that do not have nothing to flush
+func FlushConverter(converter Converter) ([]byte, []*usrp.VoiceMessage, error) {
+	if flusher, ok := converter.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil, nil, nil
+}
+
+// flushFrames frames every buffered sample into USRP voice frames, padding
+// the last with silence, and empties the buffer
+func flushFrames(buffer *[]int16, seq *uint32) []*usrp.VoiceMessage {
+	var messages []*usrp.VoiceMessage
+	for samples := *buffer; len(samples) > 0; samples = samples[min(len(samples), usrp.VoiceFrameSize):] {
+		*seq++
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, *seq)}
+		copy(msg.AudioData[:], samples)
+		messages = append(messages, msg)
+	}
+	*buffer = (*buffer)[:0]
+	return messages
+}
+
+// Purpose says what a converter's output is for
+type Purpose string
+
+const (
+	PurposeLive    Purpose = "live"    // Streams to listeners and bridges, where bandwidth matters
+	PurposeArchive Purpose = "archive" // Recordings, which must be lossless
+)
+
+// NewConverterFor returns the pure Go converter suited to purpose: native
+// Opus packets for live paths and FLAC for archives
+func NewConverterFor(purpose Purpose) (Converter, error) {
+	switch purpose {
+	case PurposeLive:
+		return NewOpusNativeConverter(nil)
+	case PurposeArchive:
+		return NewFLACConverter()
+	default:
+		return nil, fmt.Errorf("unknown converter purpose %q (want %q or %q)", purpose, PurposeLive, PurposeArchive)
+	}
+}
+
 // StreamingConverter handles real-time audio conversion using FFmpeg
 type StreamingConverter struct {
 	inputFormat  string // FFmpeg input format (e.g., "s16le", "opus")
@@ -34,17 +89,15 @@ type StreamingConverter struct {
 	outputRate   int    // Output sample rate
 	channels     int    // Number of audio channels
 
-	// FFmpeg processes for bidirectional conversion
-	toFormatCmd   *exec.Cmd // USRP -> Target format
-	fromFormatCmd *exec.Cmd // Target format -> USRP
-
-	toFormatIn    io.WriteCloser
-	toFormatOut   io.ReadCloser
-	fromFormatIn  io.WriteCloser
-	fromFormatOut io.ReadCloser
+	// FFmpeg processes for bidirectional conversion, restarted by their
+	// supervisors when they die
+	toFormat    *ffmpegProcess // USRP -> Target format
+	fromFormat  *ffmpegProcess // Target format -> USRP; nil with EncodeOnly
+	supervisors sync.WaitGroup
+	done        chan struct{} // Closed by Close to stop the supervisors
 
-	// Buffers for handling streaming data
-	pcmBuffer []int16 // Accumulate PCM samples
+	framer  *FrameAligner // Decoded PCM not yet framed
+	downmix *pcmDownmixer // Mixes decoded multi-channel PCM to mono; nil when the backend decodes to mono
 
 	mutex  sync.Mutex // Thread safety
 	closed bool
@@ -56,13 +109,84 @@ type ConverterConfig struct {
 	OutputFormat string
 	InputRate    int // Sample rate (8000 for USRP)
 	OutputRate   int
-	Channels     int           // 1 for mono (USRP default)
+	Channels     int           // Channels of the target format: 1 for mono (USRP default), 2 for stereo
+	Channel      int           // Channel of the target format decoded to USRP, from 1 (0 = mix all channels)
+	Downmix      []float64     // Gain of each target format channel in the USRP mono mix, overriding Channel (nil = equal mix)
 	BitRate      int           // For compressed formats (kbps)
 	FrameSize    time.Duration // Audio frame duration
+	Codec2Mode   Codec2Mode    // For "codec2raw" (libcodec2 -mode)
+	EncodeOnly   bool          // Skip the decoding FFmpeg, for converters that decode in Go
+	FFmpegPath   string        // FFmpeg binary; "ffmpeg" from PATH when empty
+	FFmpeg       *FFmpegConfig // How to run FFmpeg, its Path overriding FFmpegPath; nil runs it as FFmpegPath says
+	Backend      Backend       // Conversion engine for NewConverter; FFmpeg when empty
+	SoXPath      string        // SoX binary for the SoX backend; "sox" from PATH when empty
+	PacketLoss   int           // Expected packet loss (%) the native Opus encoder adds in-band FEC for (0 = no FEC)
+	DTX          bool          // Native Opus encoder sends silence as 1-byte markers (discontinuous transmission)
+	ComfortNoise float64       // Level (dBFS RMS) the native Opus decoder fills silence markers with (0 = digital silence)
+}
+
+// Backend is the engine a converter runs conversions on
+type Backend string
+
+const (
+	BackendFFmpeg    Backend = "ffmpeg"    // FFmpeg child processes
+	BackendGStreamer Backend = "gstreamer" // In-process GStreamer pipelines; needs a build with -tags gstreamer
+	BackendSoX       Backend = "sox"       // SoX child processes; PCM and G.711 formats only
+	BackendAuto      Backend = "auto"      // The lightest backend that is installed and handles the formats
+)
+
+// NewConverter creates a converter for config on its Backend
+func NewConverter(config *ConverterConfig) (Converter, error) {
+	var sc *StreamingConverter
+	var err error
+	switch config.Backend {
+	case "", BackendFFmpeg:
+		sc, err = NewStreamingConverter(config)
+	case BackendSoX:
+		sc, err = NewSoXConverter(config)
+	case BackendGStreamer:
+		return newGStreamerConverter(config)
+	case BackendAuto:
+		return newAutoConverter(config)
+	default:
+		return nil, fmt.Errorf("unknown converter backend %q (want %q, %q, %q or %q)",
+			config.Backend, BackendFFmpeg, BackendSoX, BackendGStreamer, BackendAuto)
+	}
+	if err != nil {
+		// Don't return a nil *StreamingConverter as a non-nil Converter
+		return nil, err
+	}
+	return sc, nil
+}
+
+// FFmpegConfig says how converters run FFmpeg, for hosts where it is not
+// on PATH (NixOS, containers) or is a custom build
+type FFmpegConfig struct {
+	Path      string   `json:"path"`       // FFmpeg binary; "ffmpeg" from PATH when empty
+	LogLevel  string   `json:"loglevel"`   // -loglevel; "error" when empty. Quieter levels leave Health without FFmpeg's reasons
+	ExtraArgs []string `json:"extra_args"` // Encoder output options, added after the converter's own, e.g. ["-application", "voip"]
+}
+
+// ffmpegPath returns the FFmpeg binary to run
+func (config *ConverterConfig) ffmpegPath() string {
+	switch {
+	case config.FFmpeg != nil && config.FFmpeg.Path != "":
+		return config.FFmpeg.Path
+	case config.FFmpegPath != "":
+		return config.FFmpegPath
+	default:
+		return "ffmpeg"
+	}
 }
 
 // NewOpusConverter creates a converter for USRP <-> Opus conversion
 func NewOpusConverter() (*StreamingConverter, error) {
+	return NewOpusConverterWithFFmpeg(nil)
+}
+
+// NewOpusConverterWithFFmpeg is NewOpusConverter running FFmpeg as ffmpeg
+// says. A nil ffmpeg runs "ffmpeg" from PATH.
+func NewOpusConverterWithFFmpeg(ffmpeg *FFmpegConfig) (*StreamingConverter, error) {
 	config := &ConverterConfig{
 		InputFormat:  "s16le",
 		OutputFormat: "opus",
@@ -71,38 +195,183 @@ func NewOpusConverter() (*StreamingConverter, error) {
 		Channels:     1,                     // Mono
 		BitRate:      64,                    // 64 kbps
 		FrameSize:    20 * time.Millisecond, // 20ms frames (matches USRP)
+		FFmpeg:       ffmpeg,
 	}
 	return NewStreamingConverter(config)
 }
 
 // NewOggOpusConverter creates a converter for USRP <-> Ogg/Opus conversion
-func NewOggOpusConverter() (*StreamingConverter, error) {
+func NewOggOpusConverter() (*OggOpusConverter, error) {
+	return NewOggOpusConverterWithFFmpeg(nil)
+}
+
+// NewOggOpusConverterWithFFmpeg is NewOggOpusConverter running FFmpeg as
+// ffmpeg says. A nil ffmpeg runs "ffmpeg" from PATH.
+func NewOggOpusConverterWithFFmpeg(ffmpeg *FFmpegConfig) (*OggOpusConverter, error) {
+	decoder, err := NewOggOpusDecoder()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &ConverterConfig{
-		InputFormat:  "s16le",
+		InputFormat:  "ogg",
 		OutputFormat: "ogg",
 		InputRate:    8000,
 		OutputRate:   8000,
 		Channels:     1,
 		BitRate:      64,
 		FrameSize:    20 * time.Millisecond,
+		EncodeOnly:   true,
+		FFmpeg:       ffmpeg,
+	}
+	sc, err := NewStreamingConverter(config)
+	if err != nil {
+		return nil, err
+	}
+	return &OggOpusConverter{StreamingConverter: sc, decoder: decoder}, nil
+}
+
+// mp3Bitrates lists the Layer III bit rates (kbps) allowed at each sample
+// rate family: MPEG-1 above 24kHz, MPEG-2 and 2.5 at and below it
+var mp3Bitrates = map[bool][]int{
+	true:  {32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	false: {8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mp3SampleRates lists the sample rates MP3 supports
+var mp3SampleRates = []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000}
+
+// NewMP3Converter creates a converter for USRP -> MP3 streams, for
+// integrations that only accept MP3 (scanner feeds, web players). bitRate
+// is in kbps and sampleRate is the MP3 output rate; zero values give
+// 16 kbps at 22050 Hz, the usual scanner feed format. Reverse conversion
+// decodes MP3 back to USRP frames.
+func NewMP3Converter(bitRate, sampleRate int) (*StreamingConverter, error) {
+	return NewMP3ConverterWithFFmpeg(bitRate, sampleRate, nil)
+}
+
+// NewMP3ConverterWithFFmpeg is NewMP3Converter running FFmpeg as ffmpeg
+// says. A nil ffmpeg runs "ffmpeg" from PATH.
+func NewMP3ConverterWithFFmpeg(bitRate, sampleRate int, ffmpeg *FFmpegConfig) (*StreamingConverter, error) {
+	if bitRate == 0 {
+		bitRate = 16
+	}
+	if sampleRate == 0 {
+		sampleRate = 22050
+	}
+	if !slices.Contains(mp3SampleRates, sampleRate) {
+		return nil, fmt.Errorf("unsupported MP3 sample rate %d Hz", sampleRate)
+	}
+	if allowed := mp3Bitrates[sampleRate > 24000]; !slices.Contains(allowed, bitRate) {
+		return nil, fmt.Errorf("unsupported MP3 bit rate %d kbps at %d Hz (want one of %v)", bitRate, sampleRate, allowed)
+	}
+
+	config := &ConverterConfig{
+		InputFormat:  "mp3",
+		OutputFormat: "mp3",
+		InputRate:    8000,
+		OutputRate:   sampleRate,
+		Channels:     1,
+		BitRate:      bitRate,
+		FrameSize:    20 * time.Millisecond,
+		FFmpeg:       ffmpeg,
 	}
 	return NewStreamingConverter(config)
 }
 
+// downmix returns the matrix mixing the target format's channels to USRP
+// mono, or nil when the backend's own equal mix will do
+func (config *ConverterConfig) downmix() (*ChannelMatrix, error) {
+	channels := max(config.Channels, 1)
+	switch {
+	case config.Downmix != nil:
+		if len(config.Downmix) != channels {
+			return nil, fmt.Errorf("downmix has %d gains for %d channels", len(config.Downmix), channels)
+		}
+		return NewChannelMatrix([][]float64{config.Downmix})
+	case config.Channel != 0:
+		return SelectChannel(channels, config.Channel)
+	}
+	return nil, nil
+}
+
+// pcmDownmixer mixes decoded multi-channel PCM down to mono on its way to
+// a framer, carrying bytes short of a whole multi-channel frame over to
+// the next write. A nil pcmDownmixer passes mono PCM straight through.
+type pcmDownmixer struct {
+	matrix  *ChannelMatrix
+	pending []byte
+}
+
+// newPCMDownmixer returns a downmixer for matrix, or nil for none
+func newPCMDownmixer(matrix *ChannelMatrix) *pcmDownmixer {
+	if matrix == nil {
+		return nil
+	}
+	return &pcmDownmixer{matrix: matrix}
+}
+
+// channels returns the channels of the PCM written
+func (d *pcmDownmixer) channels() int {
+	if d == nil {
+		return 1
+	}
+	return d.matrix.In()
+}
+
+// write mixes pcm down and writes it to framer
+func (d *pcmDownmixer) write(framer *FrameAligner, pcm []byte) {
+	if d == nil {
+		framer.WriteBytes(pcm, time.Time{})
+		return
+	}
+
+	d.pending = append(d.pending, pcm...)
+	frameBytes := d.matrix.In() * 2
+	whole := len(d.pending) / frameBytes * frameBytes
+	samples := make([]int16, whole/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(d.pending[i*2:]))
+	}
+	framer.Write(d.matrix.Apply(samples), time.Time{})
+	d.pending = d.pending[:copy(d.pending, d.pending[whole:])]
+}
+
+// reset drops a partial frame held over
+func (d *pcmDownmixer) reset() {
+	if d != nil {
+		d.pending = d.pending[:0]
+	}
+}
+
 // NewStreamingConverter creates a new streaming audio converter
 func NewStreamingConverter(config *ConverterConfig) (*StreamingConverter, error) {
+	return newStreamingConverter(config, "FFmpeg", (*StreamingConverter).initFFmpegProcesses)
+}
+
+// newStreamingConverter creates a streaming converter whose processes are
+// started by init
+func newStreamingConverter(config *ConverterConfig, program string, init func(*StreamingConverter, *ConverterConfig) error) (*StreamingConverter, error) {
+	downmix, err := config.downmix()
+	if err != nil {
+		return nil, err
+	}
+
 	sc := &StreamingConverter{
 		inputFormat:  config.InputFormat,
 		outputFormat: config.OutputFormat,
 		inputRate:    config.InputRate,
 		outputRate:   config.OutputRate,
 		channels:     config.Channels,
-		pcmBuffer:    make([]int16, 0, usrp.VoiceFrameSize*4), // Buffer multiple frames
+		framer:       NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate),
+		downmix:      newPCMDownmixer(downmix),
+		done:         make(chan struct{}),
 	}
 
-	// Initialize FFmpeg processes for both directions
-	if err := sc.initFFmpegProcesses(config); err != nil {
-		return nil, fmt.Errorf("failed to initialize FFmpeg: %w", err)
+	// Start processes for both directions
+	if err := init(sc, config); err != nil {
+		sc.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", program, err)
 	}
 
 	return sc, nil
@@ -110,64 +379,86 @@ func NewStreamingConverter(config *ConverterConfig) (*StreamingConverter, error)
 
 // initFFmpegProcesses sets up FFmpeg processes for bidirectional conversion
 func (sc *StreamingConverter) initFFmpegProcesses(config *ConverterConfig) error {
+	path, logLevel := config.ffmpegPath(), "error" // Keep stderr to errors, for error messages
+	var extraArgs []string
+	if ffmpeg := config.FFmpeg; ffmpeg != nil {
+		if ffmpeg.LogLevel != "" {
+			logLevel = ffmpeg.LogLevel
+		}
+		extraArgs = ffmpeg.ExtraArgs
+	}
+
 	// USRP (PCM) -> Target format
-	sc.toFormatCmd = exec.Command("ffmpeg",
+	toFormatArgs := []string{
+		"-hide_banner", "-loglevel", logLevel,
 		"-y",          // Overwrite output without prompting
 		"-f", "s16le", // Input: signed 16-bit little-endian
 		"-ar", fmt.Sprintf("%d", config.InputRate), // Input sample rate
-		"-ac", fmt.Sprintf("%d", config.Channels), // Input channels
+		"-ac", "1", // USRP mono
 		"-i", "pipe:0", // Read from stdin
 		"-f", config.OutputFormat, // Output format
 		"-ar", fmt.Sprintf("%d", config.OutputRate), // Output sample rate
 		"-ac", fmt.Sprintf("%d", config.Channels), // Output channels
-	)
+	}
 
 	// Add codec-specific options
 	if config.OutputFormat == "opus" || config.OutputFormat == "ogg" {
-		sc.toFormatCmd.Args = append(sc.toFormatCmd.Args,
+		toFormatArgs = append(toFormatArgs,
 			"-c:a", "libopus",
 			"-b:a", fmt.Sprintf("%dk", config.BitRate),
 			"-frame_duration", "20", // 20ms frames to match USRP
 		)
 	}
+	if config.OutputFormat == "mp3" {
+		toFormatArgs = append(toFormatArgs,
+			"-c:a", "libmp3lame",
+			"-b:a", fmt.Sprintf("%dk", config.BitRate),
+			"-write_xing", "0", // No VBR header: the stream is never rewound
+			"-flush_packets", "1", // Emit each MP3 frame as it is encoded
+		)
+	}
+	if config.OutputFormat == "codec2raw" {
+		toFormatArgs = append(toFormatArgs,
+			"-c:a", "libcodec2",
+			"-mode", string(config.Codec2Mode),
+			"-flush_packets", "1", // Emit each frame as it is encoded
+		)
+	}
 
-	sc.toFormatCmd.Args = append(sc.toFormatCmd.Args, "pipe:1") // Write to stdout
+	// Operator options come last so they override the ones above
+	toFormatArgs = append(toFormatArgs, extraArgs...)
+	toFormatArgs = append(toFormatArgs, "pipe:1") // Write to stdout
+
+	sc.toFormat = &ffmpegProcess{program: "FFmpeg", name: "to-format", path: path, args: toFormatArgs}
+	if err := sc.launch(sc.toFormat); err != nil {
+		return err
+	}
+	if config.EncodeOnly {
+		return nil
+	}
 
 	// Target format -> USRP (PCM)
-	sc.fromFormatCmd = exec.Command("ffmpeg",
+	fromFormatArgs := []string{
+		"-hide_banner", "-loglevel", logLevel,
 		"-y",                     // Overwrite output without prompting
 		"-f", config.InputFormat, // Input format
+	}
+
+	// Raw Codec2 has no header, so the demuxer must be told the mode
+	if config.InputFormat == "codec2raw" {
+		fromFormatArgs = append(fromFormatArgs, "-mode", string(config.Codec2Mode))
+	}
+
+	fromFormatArgs = append(fromFormatArgs,
 		"-i", "pipe:0", // Read from stdin
 		"-f", "s16le", // Output: signed 16-bit little-endian
 		"-ar", "8000", // USRP sample rate
-		"-ac", "1", // USRP mono
+		"-ac", fmt.Sprintf("%d", sc.downmix.channels()), // USRP mono, unless mixed down here
 		"pipe:1", // Write to stdout
 	)
 
-	// Set up pipes
-	var err error
-	if sc.toFormatIn, err = sc.toFormatCmd.StdinPipe(); err != nil {
-		return err
-	}
-	if sc.toFormatOut, err = sc.toFormatCmd.StdoutPipe(); err != nil {
-		return err
-	}
-	if sc.fromFormatIn, err = sc.fromFormatCmd.StdinPipe(); err != nil {
-		return err
-	}
-	if sc.fromFormatOut, err = sc.fromFormatCmd.StdoutPipe(); err != nil {
-		return err
-	}
-
-	// Start processes
-	if err := sc.toFormatCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start to-format FFmpeg: %w", err)
-	}
-	if err := sc.fromFormatCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start from-format FFmpeg: %w", err)
-	}
-
-	return nil
+	sc.fromFormat = &ffmpegProcess{program: "FFmpeg", name: "from-format", path: path, args: fromFormatArgs}
+	return sc.launch(sc.fromFormat)
 }
 
 // USRPToFormat converts USRP voice message to target format
@@ -186,15 +477,15 @@ func (sc *StreamingConverter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte,
 	}
 
 	// Send PCM data to FFmpeg
-	if _, err := sc.toFormatIn.Write(pcmBytes); err != nil {
+	if err := sc.toFormat.write(pcmBytes); err != nil {
 		return nil, fmt.Errorf("failed to write PCM data: %w", err)
 	}
 
 	// Read converted data (non-blocking with timeout)
 	result := make([]byte, 4096) // Buffer for compressed data
-	n, err := sc.readWithTimeout(sc.toFormatOut, result, 100*time.Millisecond)
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("failed to read converted data: %w", err)
+	n, err := sc.readWithTimeout(sc.toFormat.stdout, result, 100*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read converted data: %w", sc.toFormat.readError(err))
 	}
 
 	return result[:n], nil
@@ -210,46 +501,64 @@ func (sc *StreamingConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, e
 	}
 
 	// Send compressed data to FFmpeg
-	if _, err := sc.fromFormatIn.Write(data); err != nil {
+	if err := sc.fromFormat.write(data); err != nil {
 		return nil, fmt.Errorf("failed to write format data: %w", err)
 	}
 
 	// Read PCM data
 	pcmBuffer := make([]byte, 8192) // Buffer for PCM output
-	n, err := sc.readWithTimeout(sc.fromFormatOut, pcmBuffer, 100*time.Millisecond)
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("failed to read PCM data: %w", err)
-	}
-
-	// Convert bytes to int16 samples
-	samples := make([]int16, n/2)
-	for i := 0; i < len(samples); i++ {
-		samples[i] = int16(binary.LittleEndian.Uint16(pcmBuffer[i*2:]))
+	n, err := sc.readWithTimeout(sc.fromFormat.stdout, pcmBuffer, 100*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PCM data: %w", sc.fromFormat.readError(err))
 	}
 
-	// Add to buffer
-	sc.pcmBuffer = append(sc.pcmBuffer, samples...)
-
-	// Create USRP voice messages (160 samples each)
-	var messages []*usrp.VoiceMessage
-	seq := uint32(time.Now().Unix()) // Simple sequence numbering
+	// Create USRP voice messages (160 samples each), keeping partial
+	// frames and samples for the next read
+	sc.downmix.write(sc.framer, pcmBuffer[:n])
+	return sc.framer.VoiceMessages(), nil
+}
 
-	for len(sc.pcmBuffer) >= usrp.VoiceFrameSize {
-		msg := &usrp.VoiceMessage{
-			Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, seq),
-		}
+// resetFramer drops decoded samples not yet framed. Must be called with
+// the mutex held.
+func (sc *StreamingConverter) resetFramer() {
+	sc.framer.Reset()
+	sc.downmix.reset()
+}
 
-		// Copy 160 samples to message
-		copy(msg.AudioData[:], sc.pcmBuffer[:usrp.VoiceFrameSize])
+// Flush ends a transmission. FFmpeg holds back encoder lookahead and
+// partial frames until its input ends, so each process is given end of
+// input, drained, and replaced by a fresh one.
+func (sc *StreamingConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
 
-		// Remove consumed samples from buffer
-		sc.pcmBuffer = sc.pcmBuffer[usrp.VoiceFrameSize:]
+	if sc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+	return sc.flush()
+}
 
-		messages = append(messages, msg)
-		seq++
+// flush drains and restarts the FFmpeg processes and frames the decoded
+// samples left over. Must be called with the mutex held.
+func (sc *StreamingConverter) flush() ([]byte, []*usrp.VoiceMessage, error) {
+	tail, err := sc.recycle(sc.toFormat)
+	if err != nil {
+		sc.resetFramer() // Never into the next transmission
+		return nil, nil, fmt.Errorf("failed to flush encoder: %w", err)
+	}
+	if sc.fromFormat == nil {
+		return tail, nil, nil
 	}
 
-	return messages, nil
+	pcm, err := sc.recycle(sc.fromFormat)
+	if err != nil {
+		sc.resetFramer()
+		return tail, nil, fmt.Errorf("failed to flush decoder: %w", err)
+	}
+	sc.downmix.write(sc.framer, pcm)
+	sc.downmix.reset()
+	sc.framer.Flush()
+	return tail, sc.framer.VoiceMessages(), nil
 }
 
 // readWithTimeout reads from a reader with a timeout
@@ -273,49 +582,33 @@ func (sc *StreamingConverter) readWithTimeout(reader io.Reader, buf []byte, time
 	}
 }
 
-// Close stops FFmpeg processes and cleans up resources
+// Close stops FFmpeg processes and their supervisors
 func (sc *StreamingConverter) Close() error {
 	sc.mutex.Lock()
-	defer sc.mutex.Unlock()
-
 	if sc.closed {
+		sc.mutex.Unlock()
 		return nil
 	}
 	sc.closed = true
-
-	// Close pipes
-	if sc.toFormatIn != nil {
-		sc.toFormatIn.Close()
-	}
-	if sc.toFormatOut != nil {
-		sc.toFormatOut.Close()
-	}
-	if sc.fromFormatIn != nil {
-		sc.fromFormatIn.Close()
-	}
-	if sc.fromFormatOut != nil {
-		sc.fromFormatOut.Close()
+	close(sc.done)
+	for _, p := range sc.processes() {
+		p.stop()
 	}
+	sc.mutex.Unlock()
 
-	// Stop processes
-	if sc.toFormatCmd != nil {
-		if err := sc.toFormatCmd.Process.Kill(); err != nil {
-			log.Printf("Error killing toFormat process: %v", err)
-		}
-		if err := sc.toFormatCmd.Wait(); err != nil {
-			log.Printf("Error waiting for toFormat process: %v", err)
-		}
-	}
-	if sc.fromFormatCmd != nil {
-		if err := sc.fromFormatCmd.Process.Kill(); err != nil {
-			log.Printf("Error killing fromFormat process: %v", err)
-		}
-		if err := sc.fromFormatCmd.Wait(); err != nil {
-			log.Printf("Error waiting for fromFormat process: %v", err)
+	sc.supervisors.Wait()
+	return nil
+}
+
+// processes returns the converter's FFmpeg processes
+func (sc *StreamingConverter) processes() []*ffmpegProcess {
+	var processes []*ffmpegProcess
+	for _, p := range []*ffmpegProcess{sc.toFormat, sc.fromFormat} {
+		if p != nil {
+			processes = append(processes, p)
 		}
 	}
-
-	return nil
+	return processes
 }
 
 // AudioBridge provides high-level audio bridging between USRP and other formats
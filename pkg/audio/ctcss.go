@@ -0,0 +1,204 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+)
+
+const (
+	// ctcssCutoff is where CTCSS removal starts passing audio: above the
+	// highest tone (254.1 Hz) and below the 300 Hz bottom of the voice band
+	ctcssCutoff = 300
+
+	// ctcssBandCutoff is the top of the band the detector listens in, just
+	// above the highest tone
+	ctcssBandCutoff = 280
+)
+
+// HighPassFilter is a Butterworth high-pass filter, built from cascaded
+// biquads
+type HighPassFilter struct {
+	sections []biquad
+	mutex    sync.Mutex
+}
+
+// NewHighPassFilter creates a high-pass filter of an even order from 2 to
+// 16; each two orders steepen the roll-off below cutoff by 12 dB/octave
+func NewHighPassFilter(cutoff float64, order, sampleRate int) (*HighPassFilter, error) {
+	if order < 2 || order > 16 || order%2 != 0 {
+		return nil, fmt.Errorf("invalid high-pass filter order %d (want an even order from 2 to 16)", order)
+	}
+	if cutoff <= 0 || cutoff >= float64(sampleRate)/2 {
+		return nil, fmt.Errorf("high-pass cutoff %.0f Hz out of range for %d Hz audio", cutoff, sampleRate)
+	}
+
+	return &HighPassFilter{sections: butterworth(highPassBiquad, cutoff, order, sampleRate)}, nil
+}
+
+// NewCTCSSFilter creates the filter that strips CTCSS tones from voice: an
+// 8th-order high-pass at 300 Hz, taking the lowest tones down by over
+// 60 dB and the highest by about 12 dB while leaving speech alone
+func NewCTCSSFilter(sampleRate int) *HighPassFilter {
+	if sampleRate <= 0 {
+		sampleRate = USRPSampleRate
+	}
+	f, _ := NewHighPassFilter(ctcssCutoff, 8, sampleRate)
+	return f
+}
+
+// Process filters samples in place
+func (f *HighPassFilter) Process(samples []int16) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, s := range samples {
+		x := float64(s)
+		for j := range f.sections {
+			x = f.sections[j].process(x)
+		}
+		samples[i] = clampInt16(x)
+	}
+}
+
+// Reset clears the filter's history
+func (f *HighPassFilter) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i := range f.sections {
+		f.sections[i].reset()
+	}
+}
+
+// CTCSSDetectorConfig holds CTCSS detector settings
+type CTCSSDetectorConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	MinLevel   float64       `json:"min_level"`   // Quietest tone that counts, in dBFS peak
+	Block      time.Duration `json:"block"`       // Measurement period; longer tells close tones apart more surely but reacts more slowly
+}
+
+// DefaultCTCSSDetectorConfig returns a detector for 8kHz audio finding
+// tones down to -40 dBFS in 250ms
+func DefaultCTCSSDetectorConfig() *CTCSSDetectorConfig {
+	return &CTCSSDetectorConfig{
+		SampleRate: 8000,
+		MinLevel:   -40,
+		Block:      250 * time.Millisecond,
+	}
+}
+
+// ctcssPurity is the least share of the sub-audible band's energy the
+// strongest tone must carry, so rumble and hum are not taken for a tone
+const ctcssPurity = 0.5
+
+// CTCSSDetector finds which standard CTCSS (PL) tone, if any, is under the
+// audio. It low-passes the audio down to the sub-audible band, so speech
+// on top does not hide the tone, and measures every standard tone
+// in it with the Goertzel algorithm once per block. Use one detector per
+// source.
+type CTCSSDetector struct {
+	tones    []float64
+	coeffs   []float64 // Goertzel coefficient per tone
+	block    int       // Samples per block
+	minPower float64   // Least Goertzel power of a tone at MinLevel
+	band     []biquad  // Low-pass down to the sub-audible band
+
+	pending []float64 // Sub-audible samples not yet in a block
+	tone    float64   // Tone found in the last block, 0 for none
+
+	mutex sync.Mutex
+}
+
+// NewCTCSSDetector creates a CTCSS detector. A nil config uses
+// DefaultCTCSSDetectorConfig.
+func NewCTCSSDetector(config *CTCSSDetectorConfig) *CTCSSDetector {
+	defaults := DefaultCTCSSDetectorConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = defaults.Block
+	}
+
+	d := &CTCSSDetector{
+		tones: tones.CTCSSTones(),
+		block: int(cfg.Block.Seconds() * float64(cfg.SampleRate)),
+		band:  butterworth(lowPassBiquad, ctcssBandCutoff, 8, cfg.SampleRate),
+	}
+	for _, f := range d.tones {
+		d.coeffs = append(d.coeffs, 2*math.Cos(2*math.Pi*f/float64(cfg.SampleRate)))
+	}
+	amplitude := dbToLinear(cfg.MinLevel)
+	d.minPower = math.Pow(amplitude*float64(d.block)/2, 2)
+	return d
+}
+
+// Process scans samples and returns the tone present as of the latest
+// complete block, 0 for none
+func (d *CTCSSDetector) Process(samples []int16) float64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, s := range samples {
+		x := float64(s) / 32768
+		for i := range d.band {
+			x = d.band[i].process(x)
+		}
+		d.pending = append(d.pending, x)
+		if len(d.pending) == d.block {
+			d.tone = d.detect(d.pending)
+			d.pending = d.pending[:0]
+		}
+	}
+	return d.tone
+}
+
+// detect returns the tone in one block of sub-audible audio, 0 for none
+func (d *CTCSSDetector) detect(block []float64) float64 {
+	var energy float64
+	for _, x := range block {
+		energy += x * x
+	}
+
+	best, bestPower := 0, 0.0
+	for i, coeff := range d.coeffs {
+		var s1, s2 float64
+		for _, x := range block {
+			s1, s2 = x+coeff*s1-s2, s1
+		}
+		if power := s1*s1 + s2*s2 - coeff*s1*s2; power > bestPower {
+			best, bestPower = i, power
+		}
+	}
+
+	// A sine's Goertzel power is N/2 times its energy in the block
+	if bestPower < d.minPower || bestPower*2/float64(len(block)) < ctcssPurity*energy {
+		return 0
+	}
+	return d.tones[best]
+}
+
+// Tone returns the tone found in the latest complete block, 0 for none
+func (d *CTCSSDetector) Tone() float64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.tone
+}
+
+// Reset forgets any tone found
+func (d *CTCSSDetector) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.pending = d.pending[:0]
+	d.tone = 0
+	for i := range d.band {
+		d.band[i].reset()
+	}
+}
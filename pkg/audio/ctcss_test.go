@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+)
+
+// ctcssAudio returns one second of 20ms frames of speech-band tones at
+// -10 dBFS and noise at -50 dBFS, with a CTCSS tone at -20 dBFS under them
+// unless tone is 0
+func ctcssAudio(t *testing.T, tone float64) [][]int16 {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	voice := signal.NewDualTone(440, 1000, dbToLinear(-10), 8000)
+	var encoder *tones.CTCSSEncoder
+	if tone != 0 {
+		var err error
+		if encoder, err = tones.NewCTCSSEncoder(tone, -20, 8000); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	noise := 32768 * dbToLinear(-50)
+	var frames [][]int16
+	for n := 0; n < 50; n++ {
+		frame := make([]int16, 160)
+		voice.Fill(frame)
+		for i := range frame {
+			frame[i] += int16(rng.NormFloat64() * noise)
+		}
+		if encoder != nil {
+			encoder.Mix(frame)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestCTCSSDetector_Tones(t *testing.T) {
+	for _, tone := range []float64{67.0, 100.0, 103.5, 250.3, 254.1} {
+		d := NewCTCSSDetector(nil)
+		var got float64
+		for _, frame := range ctcssAudio(t, tone) {
+			got = d.Process(frame)
+		}
+		if got != tone {
+			t.Errorf("Detected %.1f Hz under speech, want %.1f Hz", got, tone)
+		}
+	}
+
+	// Speech and noise alone carry no tone
+	d := NewCTCSSDetector(nil)
+	for _, frame := range ctcssAudio(t, 0) {
+		if got := d.Process(frame); got != 0 {
+			t.Fatalf("Detected %.1f Hz with no tone", got)
+		}
+	}
+
+	// Reset forgets the tone
+	for _, frame := range ctcssAudio(t, 100.0) {
+		d.Process(frame)
+	}
+	d.Reset()
+	if got := d.Tone(); got != 0 {
+		t.Errorf("Expected no tone after Reset, got %.1f Hz", got)
+	}
+}
+
+func TestCTCSSFilter_Response(t *testing.T) {
+	for _, tc := range []struct {
+		frequency float64
+		minDB     float64
+		maxDB     float64
+	}{
+		{67.0, -200, -60},
+		{254.1, -200, -10},
+		{1000, -1, 1},
+		{3000, -1, 1},
+	} {
+		f := NewCTCSSFilter(8000)
+		samples := make([]int16, 8000)
+		signal.NewSine(tc.frequency, 0.5, 8000).Fill(samples)
+		in := rms(samples[4000:])
+		f.Process(samples)
+		gain := 20 * math.Log10(rms(samples[4000:])/in+1e-12)
+		if gain < tc.minDB || gain > tc.maxDB {
+			t.Errorf("%.1f Hz: gain %.1f dB, want %.0f to %.0f dB", tc.frequency, gain, tc.minDB, tc.maxDB)
+		}
+	}
+
+	if _, err := NewHighPassFilter(300, 5, 8000); err == nil {
+		t.Error("Expected error for an odd order")
+	}
+	if _, err := NewHighPassFilter(5000, 4, 8000); err == nil {
+		t.Error("Expected error for a cutoff above Nyquist")
+	}
+}
@@ -0,0 +1,242 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+// DenoiseConfig holds noise suppressor settings
+type DenoiseConfig struct {
+	SampleRate   int     `json:"sample_rate"`   // Sample rate (8000 for USRP)
+	MaxReduction float64 `json:"max_reduction"` // Most a noise-only band is attenuated, in dB
+}
+
+// DefaultDenoiseConfig returns settings for 8kHz radio audio, taking up to
+// 15 dB off the noise: enough to tame hiss without making speech watery
+func DefaultDenoiseConfig() *DenoiseConfig {
+	return &DenoiseConfig{
+		SampleRate:   8000,
+		MaxReduction: 15,
+	}
+}
+
+const (
+	// denoiseWindowMs is the shortest analysis window; it is rounded up to
+	// a power of two samples
+	denoiseWindowMs = 32
+
+	// denoiseSpeechRatio is how far above the noise estimate, in power, a
+	// band counts as speech and stops updating the estimate
+	denoiseSpeechRatio = 4
+
+	// denoiseNoiseRise is how fast the noise estimate climbs through
+	// speech, in dB per second, so it still follows a rising noise floor
+	denoiseNoiseRise = 6
+
+	// denoiseSmoothing weighs the previous frame's clean speech in the
+	// a priori SNR estimate (decision-directed)
+	denoiseSmoothing = 0.98
+)
+
+// Denoiser suppresses stationary noise, the hiss and hum of weak RF
+// signals, before audio reaches listeners on clean links like Discord. It
+// is a spectral suppressor in pure Go, so there is no RNNoise or speex
+// library to install: each band's noise floor is tracked by following its
+// quietest level, and bands are attenuated by a Wiener gain from their
+// estimated speech-to-noise ratio. Speech passes; noise between and under
+// words is taken down by up to MaxReduction.
+//
+// Output lags input by Delay samples. Use one Denoiser per stream.
+type Denoiser struct {
+	size   int       // FFT size
+	hop    int       // Samples between frames; half the FFT size
+	window []float64 // Square root Hann, for analysis and synthesis
+
+	frame   []float64 // Last size input samples
+	fill    int       // New samples in frame since the last transform
+	overlap []float64 // Second half of the last synthesized frame
+	output  []float64 // Denoised samples not yet returned
+
+	noise     []float64 // Estimated noise power per band
+	clean     []float64 // Previous frame's estimated speech power per band
+	spectrum  []complex128
+	floor     float64 // Least gain, linear
+	rise      float64 // Noise estimate growth per frame
+	estimated bool
+
+	mutex sync.Mutex
+}
+
+// NewDenoiser creates a noise suppressor. A nil config uses
+// DefaultDenoiseConfig.
+func NewDenoiser(config *DenoiseConfig) *Denoiser {
+	defaults := DefaultDenoiseConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.MaxReduction <= 0 {
+		cfg.MaxReduction = defaults.MaxReduction
+	}
+
+	size := 1
+	for size < cfg.SampleRate*denoiseWindowMs/1000 {
+		size *= 2
+	}
+	hop := size / 2
+	bands := size/2 + 1
+
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size)))
+	}
+
+	return &Denoiser{
+		size:     size,
+		hop:      hop,
+		window:   window,
+		frame:    make([]float64, size),
+		overlap:  make([]float64, size-hop),
+		output:   make([]float64, hop), // Enough that Process always has output
+		noise:    make([]float64, bands),
+		clean:    make([]float64, bands),
+		spectrum: make([]complex128, size),
+		floor:    dbToLinear(-cfg.MaxReduction),
+		rise:     math.Pow(10, denoiseNoiseRise/10*float64(hop)/float64(cfg.SampleRate)),
+	}
+}
+
+// Delay returns how many samples output lags input
+func (d *Denoiser) Delay() int {
+	return d.size
+}
+
+// Process denoises samples in place
+func (d *Denoiser) Process(samples []int16) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, s := range samples {
+		d.frame[d.size-d.hop+d.fill] = float64(s)
+		d.fill++
+		if d.fill == d.hop {
+			d.transform()
+			copy(d.frame, d.frame[d.hop:])
+			d.fill = 0
+		}
+	}
+
+	for i := range samples {
+		samples[i] = clampInt16(d.output[i])
+	}
+	d.output = d.output[:copy(d.output, d.output[len(samples):])]
+}
+
+// transform denoises the current frame and adds its first hop of output
+func (d *Denoiser) transform() {
+	for i, x := range d.frame {
+		d.spectrum[i] = complex(x*d.window[i], 0)
+	}
+	fft(d.spectrum, false)
+
+	for k := range d.noise {
+		bin := d.spectrum[k]
+		magnitude := real(bin)*real(bin) + imag(bin)*imag(bin)
+
+		// Average the noise over bands without speech; creep up under
+		// speech in case the noise floor rose with it
+		switch {
+		case !d.estimated:
+			d.noise[k] = magnitude
+		case magnitude < denoiseSpeechRatio*d.noise[k]:
+			d.noise[k] = 0.9*d.noise[k] + 0.1*magnitude
+		default:
+			d.noise[k] *= d.rise
+		}
+		noise := d.noise[k] + 1e-9
+
+		// Wiener gain from the decision-directed a priori SNR
+		posterior := magnitude / noise
+		prior := denoiseSmoothing*d.clean[k]/noise + (1-denoiseSmoothing)*math.Max(posterior-1, 0)
+		gain := math.Max(prior/(1+prior), d.floor)
+		d.clean[k] = gain * gain * magnitude
+
+		d.spectrum[k] = bin * complex(gain, 0)
+		if k > 0 && k < d.size/2 {
+			d.spectrum[d.size-k] = cmplx.Conj(d.spectrum[k])
+		}
+	}
+	d.estimated = true
+	fft(d.spectrum, true)
+
+	// Overlap-add; squared square root Hann windows at 50% overlap sum to one
+	for i := 0; i < d.hop; i++ {
+		d.output = append(d.output, d.overlap[i]+real(d.spectrum[i])*d.window[i])
+	}
+	for i := d.hop; i < d.size; i++ {
+		d.overlap[i-d.hop] = real(d.spectrum[i]) * d.window[i]
+	}
+}
+
+// Reset forgets the noise estimate and any audio in flight
+func (d *Denoiser) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for i := range d.frame {
+		d.frame[i] = 0
+	}
+	for i := range d.overlap {
+		d.overlap[i] = 0
+	}
+	for k := range d.noise {
+		d.noise[k], d.clean[k] = 0, 0
+	}
+	d.fill = 0
+	d.output = append(d.output[:0], make([]float64, d.hop)...)
+	d.estimated = false
+}
+
+// fft transforms x in place with an iterative radix-2 FFT; len(x) must be
+// a power of two. The inverse is scaled by 1/len(x).
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for length := 2; length <= n; length <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(length))
+		for start := 0; start < n; start += length {
+			w := complex(1, 0)
+			for k := 0; k < length/2; k++ {
+				even, odd := x[start+k], x[start+k+length/2]*w
+				x[start+k] = even + odd
+				x[start+k+length/2] = even - odd
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		scale := complex(1/float64(n), 0)
+		for i := range x {
+			x[i] *= scale
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFFT_RoundTrip(t *testing.T) {
+	x := make([]complex128, 64)
+	for i := range x {
+		x[i] = complex(float64(i%7), 0)
+	}
+	y := append([]complex128(nil), x...)
+	fft(y, false)
+
+	// A DFT by definition agrees with the FFT
+	for k := 0; k < len(x); k++ {
+		var sum complex128
+		for n, v := range x {
+			angle := -2 * math.Pi * float64(k*n) / float64(len(x))
+			sum += v * complex(math.Cos(angle), math.Sin(angle))
+		}
+		if d := sum - y[k]; math.Hypot(real(d), imag(d)) > 1e-9 {
+			t.Fatalf("Bin %d: FFT %v, DFT %v", k, y[k], sum)
+		}
+	}
+
+	fft(y, true)
+	for i := range x {
+		if d := x[i] - y[i]; math.Hypot(real(d), imag(d)) > 1e-9 {
+			t.Fatalf("Sample %d: got %v back, want %v", i, y[i], x[i])
+		}
+	}
+}
+
+// TestDenoiser_Suppression verifies noise is taken down between words and
+// the words themselves come through
+func TestDenoiser_Suppression(t *testing.T) {
+	d := NewDenoiser(nil)
+	rng := rand.New(rand.NewSource(1))
+
+	var noiseIn, noiseOut, toneIn, toneOut float64
+	for frame := 0; frame < 300; frame++ {
+		talking := frame%50 >= 25 // Half a second on, half off
+		clean := make([]int16, 160)
+		samples := make([]int16, 160)
+		for i := range samples {
+			if talking {
+				clean[i] = int16(8000 * math.Sin(2*math.Pi*500*float64(frame*160+i)/8000))
+			}
+			samples[i] = clean[i] + int16(rng.NormFloat64()*300)
+		}
+		before := append([]int16(nil), samples...)
+		d.Process(samples)
+
+		// Skip convergence and the frames either side of each edge
+		if frame < 100 || frame%25 < 3 || frame%25 > 22 {
+			continue
+		}
+		if talking {
+			toneIn += energy(before)
+			toneOut += energy(samples)
+		} else {
+			noiseIn += energy(before)
+			noiseOut += energy(samples)
+		}
+	}
+
+	reduction := 10 * math.Log10(noiseIn/noiseOut)
+	if reduction < 10 {
+		t.Errorf("Noise reduced by only %.1f dB", reduction)
+	}
+	t.Logf("Noise reduction: %.1f dB", reduction)
+	if loss := 10 * math.Log10(toneIn/toneOut); math.Abs(loss) > 1 {
+		t.Errorf("Speech level changed by %.1f dB", loss)
+	}
+}
+
+func TestDenoiser_Delay(t *testing.T) {
+	d := NewDenoiser(&DenoiseConfig{SampleRate: 8000, MaxReduction: 1})
+	samples := make([]int16, 1000)
+	samples[0] = 10000
+	d.Process(samples)
+	peak := 0
+	for i, s := range samples {
+		if s > samples[peak] {
+			peak = i
+		}
+	}
+	if peak != d.Delay() {
+		t.Errorf("Impulse came out at %d, want Delay %d", peak, d.Delay())
+	}
+}
@@ -0,0 +1,226 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DriftConfig holds clock drift compensator settings
+type DriftConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	Target     time.Duration `json:"target"`      // Audio to keep buffered between the two clocks
+	MaxFill    time.Duration `json:"max_fill"`    // Most audio buffered; a source running further ahead is cut back to Target
+	MaxPPM     float64       `json:"max_ppm"`     // Largest rate correction, in parts per million
+	Window     time.Duration `json:"window"`      // Time constant of the fill level average, so bursty writes do not wobble the rate
+}
+
+// DefaultDriftConfig returns a compensator for 8kHz audio holding 60ms
+// between the clocks and correcting up to 200 ppm, well beyond the spread
+// of the crystals in sound cards, radios and servers
+func DefaultDriftConfig() *DriftConfig {
+	return &DriftConfig{
+		SampleRate: 8000,
+		Target:     60 * time.Millisecond,
+		MaxFill:    500 * time.Millisecond,
+		MaxPPM:     200,
+		Window:     10 * time.Second,
+	}
+}
+
+// DriftStats holds drift compensator counters
+type DriftStats struct {
+	Written   uint64        `json:"written"`   // Samples written
+	Read      uint64        `json:"read"`      // Samples read
+	Underruns uint64        `json:"underruns"` // Times the source fell behind and the buffer ran dry
+	Overflows uint64        `json:"overflows"` // Times the source ran ahead past MaxFill
+	Fill      time.Duration `json:"fill"`      // Average audio buffered
+	PPM       float64       `json:"ppm"`       // Rate correction now; positive when the source's clock is fast
+	Drift     float64       `json:"drift"`     // Clock difference learned, in ppm; the correction averages out to this
+}
+
+// Drift control loop gains. The fill level settles over a couple of
+// minutes, slow enough that the rate changes are inaudible and jitter
+// averages out, while the integral term learns the clocks' steady drift
+// so the fill returns to the target rather than sitting off it.
+const (
+	driftProportional = 10.0  // ppm per ms of fill error
+	driftIntegral     = 0.025 // ppm per ms of fill error, per second
+)
+
+// DriftCompensator carries audio from a source on one clock to a sink on
+// another: a bridge reading a USRP stream on its own 20ms ticker, or
+// playing Discord audio out to a radio. Clocks differ by some ppm, so over
+// hours a plain buffer between them grows without bound or runs dry. The
+// compensator watches its fill level and resamples by a few ppm, reading
+// slightly faster or slower than the source writes, to hold the fill at
+// Target. The source calls Write as audio arrives and the sink calls Read
+// on its own clock.
+type DriftCompensator struct {
+	rate     int
+	target   float64 // Samples
+	maxFill  float64 // Samples
+	maxPPM   float64
+	window   time.Duration
+	buffer   []int16
+	pos      float64 // Read position in buffer, in samples
+	primed   bool    // Filled to the target since the last underrun
+	fill     float64 // Average fill, in samples; negative before the first Read
+	integral float64 // ppm
+	ppm      float64
+
+	stats DriftStats
+	mutex sync.Mutex
+}
+
+// NewDriftCompensator creates a drift compensator. A nil config uses
+// DefaultDriftConfig.
+func NewDriftCompensator(config *DriftConfig) *DriftCompensator {
+	defaults := DefaultDriftConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.Target <= 0 {
+		cfg.Target = defaults.Target
+	}
+	if cfg.MaxFill <= cfg.Target {
+		cfg.MaxFill = max(defaults.MaxFill, 2*cfg.Target)
+	}
+	if cfg.MaxPPM <= 0 {
+		cfg.MaxPPM = defaults.MaxPPM
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+
+	return &DriftCompensator{
+		rate:    cfg.SampleRate,
+		target:  cfg.Target.Seconds() * float64(cfg.SampleRate),
+		maxFill: cfg.MaxFill.Seconds() * float64(cfg.SampleRate),
+		maxPPM:  cfg.MaxPPM,
+		window:  cfg.Window,
+		fill:    -1,
+	}
+}
+
+// Write adds samples from the source
+func (dc *DriftCompensator) Write(samples []int16) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.buffer = append(dc.buffer, samples...)
+	dc.stats.Written += uint64(len(samples))
+
+	// A source far ahead, after a stall on the sink's side, is cut back
+	// rather than played late for the rest of the session
+	if dc.level() > dc.maxFill {
+		dc.pos += math.Floor(dc.level() - dc.target)
+		dc.trim()
+		dc.fill = dc.level()
+		dc.stats.Overflows++
+	}
+}
+
+// Read returns the next n samples for the sink, resampled to hold the fill
+// level. Until the source has filled the buffer to the target, after
+// starting or running dry, it returns silence.
+func (dc *DriftCompensator) Read(n int) []int16 {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	out := make([]int16, n)
+	dc.stats.Read += uint64(n)
+	if !dc.primed {
+		if dc.level() < dc.target {
+			return out
+		}
+		dc.primed = true
+	}
+
+	dc.control(n)
+	step := 1 + dc.ppm*1e-6
+	for i := range out {
+		// Cubic interpolation needs a sample either side of the two
+		// around pos
+		k := int(dc.pos)
+		if k+2 >= len(dc.buffer) {
+			dc.primed = false
+			dc.stats.Underruns++
+			break
+		}
+		ym1 := float64(dc.buffer[max(k-1, 0)])
+		out[i] = clampInt16(hermite(ym1, float64(dc.buffer[k]), float64(dc.buffer[k+1]), float64(dc.buffer[k+2]), dc.pos-float64(k)))
+		dc.pos += step
+	}
+
+	dc.trim()
+	return out
+}
+
+// control updates the average fill level and the rate correction for a
+// read of n samples. Must be called with the mutex held.
+func (dc *DriftCompensator) control(n int) {
+	if dc.fill < 0 {
+		dc.fill = dc.level()
+	}
+	alpha := 1 - math.Pow(smoothing(dc.window, dc.rate), float64(n))
+	dc.fill += alpha * (dc.level() - dc.fill)
+
+	errMS := (dc.fill - dc.target) * 1000 / float64(dc.rate)
+	dt := float64(n) / float64(dc.rate)
+	dc.integral = min(max(dc.integral+driftIntegral*errMS*dt, -dc.maxPPM), dc.maxPPM)
+	dc.ppm = min(max(driftProportional*errMS+dc.integral, -dc.maxPPM), dc.maxPPM)
+}
+
+// level returns the samples buffered ahead of the read position. Must be
+// called with the mutex held.
+func (dc *DriftCompensator) level() float64 {
+	return float64(len(dc.buffer)) - dc.pos
+}
+
+// trim discards samples read, keeping the one behind the read position
+// for the interpolation. Must be called with the mutex held.
+func (dc *DriftCompensator) trim() {
+	if drop := int(dc.pos) - 1; drop > 0 {
+		dc.buffer = dc.buffer[:copy(dc.buffer, dc.buffer[drop:])]
+		dc.pos -= float64(drop)
+	}
+}
+
+// hermite interpolates between y0 and y1 at t in [0, 1) with a Catmull-Rom
+// spline through the four samples around them
+func hermite(ym1, y0, y1, y2, t float64) float64 {
+	c1 := (y1 - ym1) / 2
+	c2 := ym1 - 2.5*y0 + 2*y1 - y2/2
+	c3 := (y2-ym1)/2 + 1.5*(y0-y1)
+	return ((c3*t+c2)*t+c1)*t + y0
+}
+
+// Stats returns a copy of the current counters
+func (dc *DriftCompensator) Stats() DriftStats {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	stats := dc.stats
+	stats.Fill = time.Duration(max(dc.fill, 0) / float64(dc.rate) * float64(time.Second))
+	stats.PPM = dc.ppm
+	stats.Drift = dc.integral
+	return stats
+}
+
+// Reset empties the buffer for a new stream. The learned drift is kept,
+// since the clocks have not changed.
+func (dc *DriftCompensator) Reset() {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.buffer = dc.buffer[:0]
+	dc.pos = 0
+	dc.primed = false
+	dc.fill = -1
+	dc.ppm = dc.integral
+}
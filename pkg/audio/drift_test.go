@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+// runDrift plays an hour of 20ms frames from a source whose clock runs ppm
+// fast into a sink on the true clock, and returns the compensator. The
+// audio is at 1kHz to keep the hour quick.
+func runDrift(t *testing.T, ppm float64) *DriftCompensator {
+	t.Helper()
+	dc := NewDriftCompensator(&DriftConfig{SampleRate: 1000})
+	frame := make([]int16, 20)
+	period := 20 * time.Millisecond.Seconds()
+	next := 0.0 // When the source writes its next frame, in true seconds
+	for read := 1; read <= 180000; read++ {
+		now := float64(read) * period
+		for next <= now {
+			dc.Write(frame)
+			next += period / (1 + ppm*1e-6)
+		}
+		dc.Read(len(frame))
+	}
+	return dc
+}
+
+func TestDriftCompensator_HoldsFill(t *testing.T) {
+	for _, ppm := range []float64{100, -100, 0} {
+		dc := runDrift(t, ppm)
+		stats := dc.Stats()
+
+		// One underrun at the start, while the buffer first fills, and
+		// none after
+		if stats.Underruns > 1 || stats.Overflows != 0 {
+			t.Errorf("%+.0f ppm: %d underruns, %d overflows", ppm, stats.Underruns, stats.Overflows)
+		}
+		if stats.Fill < 40*time.Millisecond || stats.Fill > 80*time.Millisecond {
+			t.Errorf("%+.0f ppm: fill %v after an hour, want about 60ms", ppm, stats.Fill)
+		}
+		if math.Abs(stats.Drift-ppm) > 15 {
+			t.Errorf("%+.0f ppm: learned %.1f ppm of drift", ppm, stats.Drift)
+		}
+	}
+}
+
+func TestDriftCompensator_Audio(t *testing.T) {
+	dc := NewDriftCompensator(nil)
+	tone := signal.NewSine(1000, 0.25, 8000)
+
+	// Silence until the buffer holds the target
+	frame := make([]int16, 160)
+	tone.Fill(frame)
+	dc.Write(frame)
+	if out := dc.Read(160); rms(out) != 0 {
+		t.Fatalf("Played %.0f RMS before filling", rms(out))
+	}
+
+	var out []int16
+	for i := 0; i < 50; i++ {
+		tone.Fill(frame)
+		dc.Write(frame)
+		out = append(out, dc.Read(160)...)
+	}
+	want := 0.25 * 32767 / math.Sqrt2
+	if got := rms(out[len(out)/2:]); math.Abs(got-want) > want*0.05 {
+		t.Errorf("Tone level %.0f, want %.0f", got, want)
+	}
+
+	// A stalled sink is caught up to the target rather than played late
+	for i := 0; i < 25; i++ {
+		dc.Write(frame)
+	}
+	if stats := dc.Stats(); stats.Overflows != 1 {
+		t.Errorf("Got %d overflows, want 1", stats.Overflows)
+	}
+
+	dc.Reset()
+	if out := dc.Read(160); rms(out) != 0 {
+		t.Errorf("Played %.0f RMS after Reset", rms(out))
+	}
+}
@@ -0,0 +1,193 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DTMFDetectorConfig holds DTMF detector settings
+type DTMFDetectorConfig struct {
+	SampleRate  int           `json:"sample_rate"`  // Sample rate (8000 for USRP)
+	MinLevel    float64       `json:"min_level"`    // Quietest tone that counts, per tone, in dBFS
+	MinDuration time.Duration `json:"min_duration"` // Shortest tone that counts as a key press
+}
+
+// DefaultDTMFDetectorConfig returns settings for radio DTMF at 8kHz: tones
+// down to -30 dBFS, held for at least 40ms
+func DefaultDTMFDetectorConfig() *DTMFDetectorConfig {
+	return &DTMFDetectorConfig{
+		SampleRate:  8000,
+		MinLevel:    -30,
+		MinDuration: 40 * time.Millisecond,
+	}
+}
+
+// dtmfRows and dtmfColumns are the DTMF tone frequencies, and dtmfKeys the
+// keypad they index
+var (
+	dtmfRows    = [4]float64{697, 770, 852, 941}
+	dtmfColumns = [4]float64{1209, 1336, 1477, 1633}
+	dtmfKeys    = [4][4]rune{
+		{'1', '2', '3', 'A'},
+		{'4', '5', '6', 'B'},
+		{'7', '8', '9', 'C'},
+		{'*', '0', '#', 'D'},
+	}
+)
+
+const (
+	// dtmfBlock is the Goertzel block length at 8kHz, the usual choice for
+	// DTMF: its bins separate neighbouring tones while a block (25.6ms)
+	// still fits inside the shortest legal tone
+	dtmfBlock = 205
+
+	// dtmfTwist is how much louder, in dB, one tone of a pair may be than
+	// the other
+	dtmfTwist = 8
+
+	// dtmfPurity is the least share of a block's energy the two tones must
+	// carry, which rejects speech and music that happen to hit both
+	dtmfPurity = 0.7
+)
+
+// DTMFDetector finds DTMF digits sent as audio, as analog radios do, rather
+// than as USRP DTMF packets. It measures the eight DTMF frequencies in
+// fixed blocks with the Goertzel algorithm and reports a digit once its
+// tone pair has held for MinDuration; the key must be released before the
+// same digit is reported again. Use one detector per source.
+type DTMFDetector struct {
+	block    int        // Samples per Goertzel block
+	coeffs   [8]float64 // Goertzel coefficients, rows then columns
+	minPower float64    // Least Goertzel power of a tone at MinLevel
+	confirm  int        // Blocks a digit must hold
+
+	pending []float64 // Samples not yet in a block
+	current rune      // Digit in the last block, 0 for none
+	count   int       // Consecutive blocks of current
+	sent    bool      // current has been reported
+
+	mutex sync.Mutex
+}
+
+// NewDTMFDetector creates a DTMF detector. A nil config uses
+// DefaultDTMFDetectorConfig.
+func NewDTMFDetector(config *DTMFDetectorConfig) *DTMFDetector {
+	defaults := DefaultDTMFDetectorConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.MinDuration <= 0 {
+		cfg.MinDuration = defaults.MinDuration
+	}
+
+	block := dtmfBlock * cfg.SampleRate / 8000
+	d := &DTMFDetector{block: block}
+	for i, f := range append(dtmfRows[:], dtmfColumns[:]...) {
+		d.coeffs[i] = 2 * math.Cos(2*math.Pi*f/float64(cfg.SampleRate))
+	}
+
+	// A tone of amplitude A gives a Goertzel power of (A*N/2)^2
+	amplitude := math.Sqrt2 * dbToLinear(cfg.MinLevel)
+	d.minPower = math.Pow(amplitude*float64(block)/2, 2)
+
+	blockTime := time.Duration(block) * time.Second / time.Duration(cfg.SampleRate)
+	d.confirm = int((cfg.MinDuration + blockTime - 1) / blockTime)
+	return d
+}
+
+// Process scans samples and returns the digits whose key presses were
+// confirmed in them, in order
+func (d *DTMFDetector) Process(samples []int16) []rune {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var digits []rune
+	for _, s := range samples {
+		d.pending = append(d.pending, float64(s)/32768)
+		if len(d.pending) < d.block {
+			continue
+		}
+
+		digit := d.detect(d.pending)
+		d.pending = d.pending[:0]
+		if digit != d.current {
+			d.current, d.count, d.sent = digit, 0, false
+		}
+		d.count++
+		if digit != 0 && !d.sent && d.count >= d.confirm {
+			digits = append(digits, digit)
+			d.sent = true
+		}
+	}
+	return digits
+}
+
+// detect returns the digit in one block, 0 for none
+func (d *DTMFDetector) detect(block []float64) rune {
+	var energy float64
+	for _, x := range block {
+		energy += x * x
+	}
+
+	var powers [8]float64
+	for i, coeff := range d.coeffs {
+		var s1, s2 float64
+		for _, x := range block {
+			s1, s2 = x+coeff*s1-s2, s1
+		}
+		powers[i] = s1*s1 + s2*s2 - coeff*s1*s2
+	}
+
+	row, rowPower := strongest(powers[:4])
+	column, columnPower := strongest(powers[4:])
+	if rowPower < d.minPower || columnPower < d.minPower {
+		return 0
+	}
+
+	// Each tone must stand clear of the rest of its group
+	for i, p := range powers[:4] {
+		if i != row && p*4 > rowPower {
+			return 0
+		}
+	}
+	for i, p := range powers[4:] {
+		if i != column && p*4 > columnPower {
+			return 0
+		}
+	}
+
+	twist := 10 * math.Log10(rowPower/columnPower)
+	if math.Abs(twist) > dtmfTwist {
+		return 0
+	}
+
+	// A sine's Goertzel power is N/2 times its energy in the block
+	if (rowPower+columnPower)*2/float64(len(block)) < dtmfPurity*energy {
+		return 0
+	}
+	return dtmfKeys[row][column]
+}
+
+// strongest returns the index and value of the largest power
+func strongest(powers []float64) (int, float64) {
+	best := 0
+	for i, p := range powers {
+		if p > powers[best] {
+			best = i
+		}
+	}
+	return best, powers[best]
+}
+
+// Reset forgets any tone in progress
+func (d *DTMFDetector) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.pending = d.pending[:0]
+	d.current, d.count, d.sent = 0, 0, false
+}
@@ -0,0 +1,86 @@
+package audio
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+// dtmfAudio keys each digit for on frames, then leaves off frames of noise
+// at -50 dBFS, and returns the audio in 20ms frames
+func dtmfAudio(t *testing.T, digits string, on, off int) [][]int16 {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	noise := 32768 * dbToLinear(-50)
+	var frames [][]int16
+	for _, digit := range digits {
+		tone, err := signal.NewDTMF(digit, 0.5, 8000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < on+off; n++ {
+			frame := make([]int16, 160)
+			if n < on {
+				tone.Fill(frame)
+			}
+			for i := range frame {
+				frame[i] += int16(rng.NormFloat64() * noise)
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+func TestDTMFDetector_Digits(t *testing.T) {
+	const keypad = "123A456B789C*0#D"
+	d := NewDTMFDetector(nil)
+	var got []rune
+	for _, frame := range dtmfAudio(t, keypad, 3, 3) { // 60ms on, 60ms off
+		got = append(got, d.Process(frame)...)
+	}
+	if string(got) != keypad {
+		t.Errorf("Detected %q, want %q", string(got), keypad)
+	}
+
+	// A long press is one digit; a press shorter than MinDuration is none
+	d.Reset()
+	got = nil
+	for _, frame := range dtmfAudio(t, "55", 25, 5) {
+		got = append(got, d.Process(frame)...)
+	}
+	for _, frame := range dtmfAudio(t, "9", 1, 5) {
+		got = append(got, d.Process(frame)...)
+	}
+	if string(got) != "55" {
+		t.Errorf("Detected %q, want \"55\"", string(got))
+	}
+}
+
+func TestDTMFDetector_RejectsOtherAudio(t *testing.T) {
+	d := NewDTMFDetector(nil)
+	frame := make([]int16, 160)
+
+	// One tone of a pair is not a digit, nor is a pair mixed with more
+	single := signal.NewSine(770, 0.5, 8000)
+	for n := 0; n < 50; n++ {
+		single.Fill(frame)
+		if digits := d.Process(frame); len(digits) > 0 {
+			t.Fatalf("Single tone detected as %q", string(digits))
+		}
+	}
+	tone, _ := signal.NewDTMF('7', 0.4, 8000)
+	other := signal.NewSine(1100, 0.3, 8000)
+	extra := make([]int16, 160)
+	for n := 0; n < 50; n++ {
+		tone.Fill(frame)
+		other.Fill(extra)
+		for i := range frame {
+			frame[i] += extra[i]
+		}
+		if digits := d.Process(frame); len(digits) > 0 {
+			t.Fatalf("Tone pair under a third tone detected as %q", string(digits))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// EchoConfig holds acoustic echo canceller settings
+type EchoConfig struct {
+	SampleRate int           // Sample rate of both paths (8000 for USRP)
+	TailLength time.Duration // Longest echo path to model (speaker -> mic delay + reverb)
+	StepSize   float64       // NLMS adaptation step (0 < mu <= 1)
+}
+
+// DefaultEchoConfig returns settings suited to a radio and a Discord client
+// sharing a room: 8kHz audio with a 128ms echo tail
+func DefaultEchoConfig() *EchoConfig {
+	return &EchoConfig{
+		SampleRate: 8000,
+		TailLength: 128 * time.Millisecond,
+		StepSize:   0.3,
+	}
+}
+
+// EchoCanceller removes the far-end signal that leaks back into the near-end
+// path of a full-duplex pair. It is a normalized LMS adaptive filter with
+// Geigel double-talk detection, implemented in pure Go so no speex/webrtc
+// libraries are needed.
+//
+// Call Playback with every frame sent toward the speaker side (far end) and
+// Process with every frame captured from the microphone side (near end).
+type EchoCanceller struct {
+	weights []float64 // Adaptive filter taps
+	history []float64 // Circular buffer of far-end samples, len(weights)
+	pos     int       // Next write position in history
+	energy  float64   // Running sum of squares over history
+	mu      float64
+
+	pending []int16 // Far-end samples played but not yet aligned with near-end
+
+	mutex sync.Mutex
+}
+
+// NewEchoCanceller creates an echo canceller
+func NewEchoCanceller(config *EchoConfig) *EchoCanceller {
+	if config == nil {
+		config = DefaultEchoConfig()
+	}
+	if config.SampleRate <= 0 {
+		config.SampleRate = 8000
+	}
+
+	taps := int(config.TailLength.Seconds() * float64(config.SampleRate))
+	if taps <= 0 {
+		taps = 1024
+	}
+
+	mu := config.StepSize
+	if mu <= 0 || mu > 1 {
+		mu = 0.3
+	}
+
+	return &EchoCanceller{
+		weights: make([]float64, taps),
+		history: make([]float64, taps),
+		mu:      mu,
+	}
+}
+
+// Playback records far-end samples as they are sent to the speaker side
+func (ec *EchoCanceller) Playback(samples []int16) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	ec.pending = append(ec.pending, samples...)
+
+	// Never let the reference run away from the capture side by more than
+	// the modelled tail; older audio cannot appear as echo anymore
+	if max := len(ec.weights) * 2; len(ec.pending) > max {
+		ec.pending = ec.pending[len(ec.pending)-max:]
+	}
+}
+
+// Process removes echo from near-end samples in place
+func (ec *EchoCanceller) Process(samples []int16) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	n := len(ec.weights)
+	for i, s := range samples {
+		// Shift the next far-end sample into the history
+		var ref float64
+		if len(ec.pending) > 0 {
+			ref = float64(ec.pending[0])
+			ec.pending = ec.pending[1:]
+		}
+		old := ec.history[ec.pos]
+		ec.energy += ref*ref - old*old
+		if ec.energy < 0 {
+			ec.energy = 0
+		}
+		ec.history[ec.pos] = ref
+
+		// Estimate the echo: y = w · x (x newest first)
+		var estimate, farPeak float64
+		idx := ec.pos
+		for k := 0; k < n; k++ {
+			x := ec.history[idx]
+			estimate += ec.weights[k] * x
+			if a := math.Abs(x); a > farPeak {
+				farPeak = a
+			}
+			idx--
+			if idx < 0 {
+				idx = n - 1
+			}
+		}
+
+		near := float64(s)
+		residual := near - estimate
+
+		// Geigel double-talk detector: freeze adaptation while the near end
+		// is louder than any echo the far end could have produced
+		doubleTalk := math.Abs(near) > 0.5*farPeak
+		if !doubleTalk && ec.energy > 1 {
+			step := ec.mu * residual / (ec.energy + 1)
+			idx = ec.pos
+			for k := 0; k < n; k++ {
+				ec.weights[k] += step * ec.history[idx]
+				idx--
+				if idx < 0 {
+					idx = n - 1
+				}
+			}
+		}
+
+		ec.pos++
+		if ec.pos == n {
+			ec.pos = 0
+		}
+
+		samples[i] = clampInt16(residual)
+	}
+}
+
+// Reset clears the adaptive filter and reference history
+func (ec *EchoCanceller) Reset() {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	for i := range ec.weights {
+		ec.weights[i] = 0
+		ec.history[i] = 0
+	}
+	ec.pos = 0
+	ec.energy = 0
+	ec.pending = ec.pending[:0]
+}
+
+// clampInt16 rounds and saturates a float sample to the int16 range
+func clampInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
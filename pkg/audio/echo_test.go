@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestEchoCanceller_Convergence verifies that a delayed, attenuated copy of
+// the far-end signal is removed from the near-end path
+func TestEchoCanceller_Convergence(t *testing.T) {
+	ec := NewEchoCanceller(&EchoConfig{
+		SampleRate: 8000,
+		TailLength: 16 * time.Millisecond,
+		StepSize:   0.5,
+	})
+
+	rng := rand.New(rand.NewSource(1))
+	const delay = 40
+	var line []int16 // Far-end signal as heard by the microphone
+
+	var inEnergy, outEnergy float64
+	for frame := 0; frame < 400; frame++ {
+		far := make([]int16, 160)
+		for i := range far {
+			far[i] = int16(rng.Intn(16000) - 8000)
+		}
+		line = append(line, far...)
+		ec.Playback(far)
+
+		// Microphone hears the speaker 5ms later at half amplitude
+		near := make([]int16, 160)
+		for i := range near {
+			j := len(line) - 160 + i - delay
+			if j >= 0 {
+				near[i] = line[j] / 2
+			}
+		}
+
+		before := energy(near)
+		ec.Process(near)
+
+		// Measure after convergence
+		if frame >= 300 {
+			inEnergy += before
+			outEnergy += energy(near)
+		}
+	}
+
+	erle := 10 * math.Log10(inEnergy/(outEnergy+1))
+	if erle < 20 {
+		t.Errorf("Echo return loss enhancement too low: %.1f dB", erle)
+	}
+	t.Logf("ERLE after convergence: %.1f dB", erle)
+}
+
+// TestEchoCanceller_NearEndPassThrough verifies near-end speech survives
+// when there is no far-end signal
+func TestEchoCanceller_NearEndPassThrough(t *testing.T) {
+	ec := NewEchoCanceller(nil)
+
+	near := make([]int16, 160)
+	for i := range near {
+		near[i] = int16(5000 * math.Sin(2*math.Pi*440*float64(i)/8000))
+	}
+	want := append([]int16(nil), near...)
+
+	ec.Process(near)
+	for i := range near {
+		if near[i] != want[i] {
+			t.Fatalf("Sample %d altered without far-end signal: got %d, want %d", i, near[i], want[i])
+		}
+	}
+}
+
+func energy(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return sum
+}
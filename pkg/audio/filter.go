@@ -0,0 +1,271 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+// biquad is one second-order IIR filter section (direct form I)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64 // Normalized so a0 = 1
+	x1, x2, y1, y2     float64
+}
+
+// highPassBiquad returns an RBJ high-pass section at cutoff with quality q
+func highPassBiquad(cutoff, q float64, sampleRate int) biquad {
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// lowPassBiquad returns an RBJ low-pass section at cutoff with quality q
+func lowPassBiquad(cutoff, q float64, sampleRate int) biquad {
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// highShelfBiquad returns an RBJ high-shelf section at cutoff with quality
+// q, boosting above it by gain dB
+func highShelfBiquad(cutoff, q, gain float64, sampleRate int) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	root := 2 * math.Sqrt(a) * alpha
+	a0 := (a + 1) - (a-1)*cos + root
+	return biquad{
+		b0: a * ((a + 1) + (a-1)*cos + root) / a0,
+		b1: -2 * a * ((a - 1) + (a+1)*cos) / a0,
+		b2: a * ((a + 1) + (a-1)*cos - root) / a0,
+		a1: 2 * ((a - 1) - (a+1)*cos) / a0,
+		a2: ((a + 1) - (a-1)*cos - root) / a0,
+	}
+}
+
+// lowShelfBiquad returns an RBJ low-shelf section at cutoff with quality
+// q, boosting below it by gain dB
+func lowShelfBiquad(cutoff, q, gain float64, sampleRate int) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	root := 2 * math.Sqrt(a) * alpha
+	a0 := (a + 1) + (a-1)*cos + root
+	return biquad{
+		b0: a * ((a + 1) - (a-1)*cos + root) / a0,
+		b1: 2 * a * ((a - 1) - (a+1)*cos) / a0,
+		b2: a * ((a + 1) - (a-1)*cos - root) / a0,
+		a1: -2 * ((a - 1) + (a+1)*cos) / a0,
+		a2: ((a + 1) + (a-1)*cos - root) / a0,
+	}
+}
+
+// peakingBiquad returns an RBJ peaking EQ section at center with quality
+// q, boosting (or cutting, when negative) by gain dB
+func peakingBiquad(center, q, gain float64, sampleRate int) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * center / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha/a
+	return biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+// deemphasisBiquad returns a first-order low-pass at corner, falling
+// 6 dB/octave above it as FM de-emphasis does, scaled to unity gain at
+// 1kHz so speech keeps its level
+func deemphasisBiquad(corner float64, sampleRate int) biquad {
+	// Bilinear transform of 1/(1 + s/wc), prewarped at the corner
+	k := math.Tan(math.Pi * corner / float64(sampleRate))
+	f := biquad{
+		b0: k / (1 + k),
+		b1: k / (1 + k),
+		a1: (k - 1) / (1 + k),
+	}
+	scale := 1 / f.response(1000, sampleRate)
+	f.b0 *= scale
+	f.b1 *= scale
+	return f
+}
+
+// response returns the section's gain at frequency, as a linear magnitude
+func (f *biquad) response(frequency float64, sampleRate int) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*frequency/float64(sampleRate))) // z^-1
+	num := complex(f.b0, 0) + complex(f.b1, 0)*z + complex(f.b2, 0)*z*z
+	den := 1 + complex(f.a1, 0)*z + complex(f.a2, 0)*z*z
+	return cmplx.Abs(num / den)
+}
+
+// butterworth returns the sections of a Butterworth filter of an even
+// order, built from section (highPassBiquad or lowPassBiquad)
+func butterworth(section func(cutoff, q float64, sampleRate int) biquad, cutoff float64, order, sampleRate int) []biquad {
+	var sections []biquad
+	for k := 0; k < order/2; k++ {
+		// Butterworth pole pairs
+		q := 1 / (2 * math.Cos(math.Pi*float64(2*k+1)/float64(2*order)))
+		sections = append(sections, section(cutoff, q, sampleRate))
+	}
+	return sections
+}
+
+// process filters one sample
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// reset clears the section's history
+func (f *biquad) reset() {
+	f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+}
+
+// FilterStage is one stage of a filter chain. Types:
+//
+//   - "highpass", "lowpass": Butterworth filters at Frequency of an even
+//     Order (default 2, each two orders adding 12 dB/octave)
+//   - "peak": a parametric EQ band centred on Frequency, Gain dB high (or
+//     deep, when negative) and Q wide (default 1)
+//   - "lowshelf", "highshelf": Gain dB below or above Frequency
+//   - "deemphasis": a 6 dB/octave roll-off above Frequency (default 212 Hz,
+//     the 750µs land mobile curve), unity at 1kHz, for audio taken from a
+//     receiver's discriminator before de-emphasis
+type FilterStage struct {
+	Type      string  `json:"type"`
+	Frequency float64 `json:"frequency"`       // Cutoff, centre or corner, in Hz
+	Gain      float64 `json:"gain,omitempty"`  // Peak and shelf gain, in dB
+	Q         float64 `json:"q,omitempty"`     // Peak and shelf quality (default 1 for peaks, 0.707 for shelves)
+	Order     int     `json:"order,omitempty"` // High- and low-pass order
+}
+
+// FilterChainConfig holds a filter chain's stages, applied in order
+type FilterChainConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	Stages     []FilterStage `json:"stages"`
+}
+
+// deemphasisCorner is the corner of the 750µs de-emphasis curve, in Hz
+const deemphasisCorner = 212
+
+// FilterChain applies high-pass, low-pass, parametric EQ and de-emphasis
+// stages in turn, to correct muddy or tinny audio from a source. Use one
+// chain per source.
+type FilterChain struct {
+	sampleRate int
+	sections   []biquad
+	mutex      sync.Mutex
+}
+
+// NewFilterChain builds a filter chain, failing on an unknown stage type
+// or a frequency outside the audio band
+func NewFilterChain(config *FilterChainConfig) (*FilterChain, error) {
+	if config == nil {
+		config = &FilterChainConfig{}
+	}
+	sampleRate := config.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = USRPSampleRate
+	}
+
+	c := &FilterChain{sampleRate: sampleRate}
+	for i, stage := range config.Stages {
+		if stage.Type == "deemphasis" && stage.Frequency == 0 {
+			stage.Frequency = deemphasisCorner
+		}
+		if stage.Frequency <= 0 || stage.Frequency >= float64(sampleRate)/2 {
+			return nil, fmt.Errorf("filter stage %d (%s): frequency %.0f Hz out of range for %d Hz audio", i+1, stage.Type, stage.Frequency, sampleRate)
+		}
+
+		switch stage.Type {
+		case "highpass", "lowpass":
+			if stage.Order == 0 {
+				stage.Order = 2
+			}
+			if stage.Order < 2 || stage.Order > 16 || stage.Order%2 != 0 {
+				return nil, fmt.Errorf("filter stage %d (%s): invalid order %d (want an even order from 2 to 16)", i+1, stage.Type, stage.Order)
+			}
+			section := highPassBiquad
+			if stage.Type == "lowpass" {
+				section = lowPassBiquad
+			}
+			c.sections = append(c.sections, butterworth(section, stage.Frequency, stage.Order, sampleRate)...)
+		case "peak":
+			if stage.Q <= 0 {
+				stage.Q = 1
+			}
+			c.sections = append(c.sections, peakingBiquad(stage.Frequency, stage.Q, stage.Gain, sampleRate))
+		case "lowshelf", "highshelf":
+			if stage.Q <= 0 {
+				stage.Q = 1 / math.Sqrt2
+			}
+			if stage.Type == "lowshelf" {
+				c.sections = append(c.sections, lowShelfBiquad(stage.Frequency, stage.Q, stage.Gain, sampleRate))
+			} else {
+				c.sections = append(c.sections, highShelfBiquad(stage.Frequency, stage.Q, stage.Gain, sampleRate))
+			}
+		case "deemphasis":
+			c.sections = append(c.sections, deemphasisBiquad(stage.Frequency, sampleRate))
+		default:
+			return nil, fmt.Errorf("filter stage %d: unknown type %q (want highpass, lowpass, peak, lowshelf, highshelf or deemphasis)", i+1, stage.Type)
+		}
+	}
+	return c, nil
+}
+
+// Process filters samples in place
+func (c *FilterChain) Process(samples []int16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, s := range samples {
+		x := float64(s)
+		for j := range c.sections {
+			x = c.sections[j].process(x)
+		}
+		samples[i] = clampInt16(x)
+	}
+}
+
+// Response returns the chain's gain at frequency, in dB
+func (c *FilterChain) Response(frequency float64) float64 {
+	gain := 1.0
+	for i := range c.sections {
+		gain *= c.sections[i].response(frequency, c.sampleRate)
+	}
+	return 20 * math.Log10(gain)
+}
+
+// Reset clears the chain's history
+func (c *FilterChain) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range c.sections {
+		c.sections[i].reset()
+	}
+}
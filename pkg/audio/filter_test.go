@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+func TestFilterChain_Response(t *testing.T) {
+	var config FilterChainConfig
+	err := json.Unmarshal([]byte(`{"stages": [
+		{"type": "highpass", "frequency": 300, "order": 4},
+		{"type": "peak", "frequency": 1000, "gain": 6, "q": 2},
+		{"type": "highshelf", "frequency": 2500, "gain": -6}
+	]}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := NewFilterChain(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		frequency float64
+		want      float64
+		tolerance float64
+	}{
+		{100, -38, 2},  // 4th-order high-pass, 1.6 octaves down
+		{300, -3, 0.5}, // Butterworth cutoff
+		{1000, 6, 0.5}, // Peak
+		{3900, -6, 1},  // Shelf
+	} {
+		if got := chain.Response(tc.frequency); math.Abs(got-tc.want) > tc.tolerance {
+			t.Errorf("%.0f Hz: response %.1f dB, want %.1f dB", tc.frequency, got, tc.want)
+		}
+	}
+
+	// What Process does matches Response
+	samples := make([]int16, 8000)
+	signal.NewSine(1000, 0.25, 8000).Fill(samples)
+	in := rms(samples[4000:])
+	chain.Process(samples)
+	if gain := 20 * math.Log10(rms(samples[4000:])/in); math.Abs(gain-chain.Response(1000)) > 0.2 {
+		t.Errorf("Processed gain %.2f dB, response %.2f dB", gain, chain.Response(1000))
+	}
+}
+
+func TestFilterChain_Deemphasis(t *testing.T) {
+	chain, err := NewFilterChain(&FilterChainConfig{Stages: []FilterStage{{Type: "deemphasis"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 dB/octave, unity at 1kHz
+	if got := chain.Response(1000); math.Abs(got) > 0.01 {
+		t.Errorf("Expected 0 dB at 1kHz, got %.2f", got)
+	}
+	if slope := chain.Response(500) - chain.Response(1000); slope < 5 || slope > 7 {
+		t.Errorf("Expected about 6 dB/octave above the corner, got %.1f", slope)
+	}
+}
+
+func TestFilterChain_Invalid(t *testing.T) {
+	for _, stage := range []FilterStage{
+		{Type: "bandstop", Frequency: 1000},
+		{Type: "lowpass", Frequency: 5000},
+		{Type: "highpass", Frequency: 300, Order: 3},
+		{Type: "peak"},
+	} {
+		if _, err := NewFilterChain(&FilterChainConfig{Stages: []FilterStage{stage}}); err == nil {
+			t.Errorf("Expected an error for %+v", stage)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// flacSignature starts every FLAC stream
+const flacSignature = "fLaC"
+
+// flacStreamInfo describes 8 kHz 16-bit mono audio in blocks of blockSize
+// samples
+func flacStreamInfo(blockSize int) *meta.StreamInfo {
+	return &meta.StreamInfo{
+		BlockSizeMin:  uint16(blockSize),
+		BlockSizeMax:  uint16(blockSize),
+		SampleRate:    USRPSampleRate,
+		NChannels:     1,
+		BitsPerSample: 16,
+	}
+}
+
+// flacFrame wraps mono samples in a FLAC frame. Verbatim subframes are
+// replaced by the encoder with whichever predictor compresses best.
+func flacFrame(samples []int16) *frame.Frame {
+	pcm := make([]int32, len(samples))
+	for i, sample := range samples {
+		pcm[i] = int32(sample)
+	}
+	return &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(len(samples)),
+			SampleRate:        USRPSampleRate,
+			Channels:          frame.ChannelsMono,
+			BitsPerSample:     16,
+		},
+		Subframes: []*frame.Subframe{{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   pcm,
+			NSamples:  len(pcm),
+		}},
+	}
+}
+
+// skipFLACHeader returns data without its leading "fLaC" signature and
+// metadata blocks, if it starts with them
+func skipFLACHeader(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(flacSignature)) {
+		return data, nil
+	}
+	offset := len(flacSignature)
+	for {
+		if len(data) < offset+4 {
+			return nil, fmt.Errorf("FLAC metadata truncated")
+		}
+		last := data[offset]&0x80 != 0
+		length := int(binary.BigEndian.Uint32(data[offset:]) & 0xFFFFFF)
+		offset += 4 + length
+		if offset > len(data) {
+			return nil, fmt.Errorf("FLAC metadata truncated")
+		}
+		if last {
+			return data[offset:], nil
+		}
+	}
+}
+
+// FLACConverter converts between USRP voice frames and a FLAC stream in
+// pure Go. Each USRP frame becomes one 160 sample FLAC frame, the first
+// preceded by the stream header, so the concatenated output is a playable
+// file. FLAC is lossless, so audio round trips exactly.
+type FLACConverter struct {
+	encoder *flac.Encoder
+	out     bytes.Buffer  // Encoder output not yet handed out
+	framer  *FrameAligner // Decoded samples not yet framed
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewFLACConverter creates a FLAC converter
+func NewFLACConverter() (*FLACConverter, error) {
+	fc := &FLACConverter{framer: NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate)}
+	encoder, err := flac.NewEncoder(&fc.out, flacStreamInfo(usrp.VoiceFrameSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create FLAC encoder: %w", err)
+	}
+	fc.encoder = encoder
+	return fc, nil
+}
+
+// USRPToFormat encodes one USRP voice frame as a FLAC frame, prefixed by
+// the stream header on the first call
+func (fc *FLACConverter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	if err := fc.encoder.WriteFrame(flacFrame(voiceMsg.AudioData[:])); err != nil {
+		return nil, fmt.Errorf("failed to encode FLAC: %w", err)
+	}
+
+	out := bytes.Clone(fc.out.Bytes())
+	fc.out.Reset()
+	return out, nil
+}
+
+// FormatToUSRP decodes whole FLAC frames, optionally preceded by the stream
+// header, into USRP voice frames. Only 8 kHz mono streams are accepted;
+// samples that do not fill a whole frame are kept for the next call.
+func (fc *FLACConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	data, err := skipFLACHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	var pcm []int16
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		f, err := frame.Parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode FLAC: %w", err)
+		}
+		if f.SampleRate != USRPSampleRate || f.Channels.Count() != 1 {
+			return nil, fmt.Errorf("FLAC frame is %d Hz with %d channels, want %d Hz mono", f.SampleRate, f.Channels.Count(), USRPSampleRate)
+		}
+		shift := int(f.BitsPerSample) - 16
+		for _, sample := range f.Subframes[0].Samples {
+			if shift > 0 {
+				sample >>= shift
+			} else {
+				sample <<= -shift
+			}
+			pcm = append(pcm, int16(sample))
+		}
+	}
+	fc.framer.Write(pcm, time.Time{})
+	return fc.framer.VoiceMessages(), nil
+}
+
+// Flush ends a transmission: decoded samples short of a frame are padded
+// into a last frame, and the next transmission starts a new FLAC stream,
+// header first, so each transmission is a playable file of its own
+func (fc *FLACConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+	fc.out.Reset()
+	encoder, err := flac.NewEncoder(&fc.out, flacStreamInfo(usrp.VoiceFrameSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create FLAC encoder: %w", err)
+	}
+	fc.encoder = encoder
+	fc.framer.Flush()
+	return nil, fc.framer.VoiceMessages(), nil
+}
+
+// Close releases the converter; there are no external processes to stop
+func (fc *FLACConverter) Close() error {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.closed = true
+	return nil
+}
+
+// FLACWriterConfig holds FLAC recording settings
+type FLACWriterConfig struct {
+	BlockSize int           // Samples per FLAC frame; larger blocks compress better
+	MaxGap    time.Duration // Longest silence inserted for one gap
+}
+
+// DefaultFLACWriterConfig returns 4096 sample blocks with gaps capped at 5s
+func DefaultFLACWriterConfig() *FLACWriterConfig {
+	return &FLACWriterConfig{
+		BlockSize: 4096,
+		MaxGap:    5 * time.Second,
+	}
+}
+
+// flacWriteSeeker hides the Close method of the recording's file, which
+// the FLAC encoder would otherwise call
+type flacWriteSeeker struct {
+	io.WriteSeeker
+}
+
+// FLACWriter records USRP voice frames to an 8 kHz 16-bit mono FLAC file,
+// for archives that must be lossless but smaller than WAV. Like a WAVWriter
+// in silence mode it records keyed frames in real time, filling gaps
+// between transmissions with silence. Close fills in the stream's length
+// and checksum.
+type FLACWriter struct {
+	encoder *flac.Encoder
+	w       io.WriteSeeker
+	config  *FLACWriterConfig
+	block   []int16   // Samples not yet encoded
+	samples int       // Sample frames recorded
+	lastEnd time.Time // When the last keyed frame finished playing
+	closed  bool
+}
+
+// NewFLACWriter starts a FLAC recording on w. A nil config uses
+// DefaultFLACWriterConfig.
+func NewFLACWriter(w io.WriteSeeker, config *FLACWriterConfig) (*FLACWriter, error) {
+	if config == nil {
+		config = DefaultFLACWriterConfig()
+	}
+	if config.BlockSize < 16 || config.BlockSize > 65535 {
+		return nil, fmt.Errorf("FLAC block size must be 16 to 65535 samples, got %d", config.BlockSize)
+	}
+
+	encoder, err := flac.NewEncoder(flacWriteSeeker{w}, flacStreamInfo(config.BlockSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write FLAC header: %w", err)
+	}
+	return &FLACWriter{
+		encoder: encoder,
+		w:       w,
+		config:  config,
+		block:   make([]int16, 0, config.BlockSize),
+	}, nil
+}
+
+// WriteMessage records one voice frame that arrived at the given time. Time
+// missing between keyed frames is filled with silence; a zero time records
+// the frame back to back with the previous one.
+func (fw *FLACWriter) WriteMessage(msg *usrp.VoiceMessage, at time.Time) error {
+	if fw.closed {
+		return fmt.Errorf("FLAC writer is closed")
+	}
+	if !msg.Header.IsPTT() {
+		return nil
+	}
+
+	if !at.IsZero() && !fw.lastEnd.IsZero() {
+		// Allow a frame of jitter before calling it a gap
+		if gap := at.Sub(fw.lastEnd); gap > voiceFrameDuration {
+			n := int(min(gap, fw.config.MaxGap) * USRPSampleRate / time.Second)
+			if err := fw.write(make([]int16, n)); err != nil {
+				return err
+			}
+		}
+	}
+	if !at.IsZero() {
+		fw.lastEnd = at.Add(voiceFrameDuration)
+	}
+	return fw.write(msg.AudioData[:])
+}
+
+// write buffers samples, encoding each block as it fills
+func (fw *FLACWriter) write(samples []int16) error {
+	fw.samples += len(samples)
+	for len(samples) > 0 {
+		n := min(len(samples), fw.config.BlockSize-len(fw.block))
+		fw.block = append(fw.block, samples[:n]...)
+		samples = samples[n:]
+		if len(fw.block) == fw.config.BlockSize {
+			if err := fw.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush encodes the buffered samples as one frame
+func (fw *FLACWriter) flush() error {
+	if len(fw.block) == 0 {
+		return nil
+	}
+	if err := fw.encoder.WriteFrame(flacFrame(fw.block)); err != nil {
+		return fmt.Errorf("failed to write FLAC frame: %w", err)
+	}
+	fw.block = fw.block[:0]
+	return nil
+}
+
+// Duration returns the length of audio recorded so far
+func (fw *FLACWriter) Duration() time.Duration {
+	return time.Duration(fw.samples) * time.Second / USRPSampleRate
+}
+
+// Close encodes the final short block and updates the stream header. It
+// does not close the underlying writer.
+func (fw *FLACWriter) Close() error {
+	if fw.closed {
+		return nil
+	}
+	fw.closed = true
+
+	if err := fw.flush(); err != nil {
+		return err
+	}
+	if err := fw.encoder.Close(); err != nil {
+		return fmt.Errorf("failed to update FLAC header: %w", err)
+	}
+	_, err := fw.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,170 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mewkiz/flac"
+)
+
+var _ Converter = (*FLACConverter)(nil)
+
+func TestFLACConverter_RoundTrip(t *testing.T) {
+	encoder, err := NewFLACConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	decoder, err := NewFLACConverter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	var stream []byte
+	for i := 0; i < 10; i++ {
+		msg := toneFrame(i)
+		data, err := encoder.USRPToFormat(msg)
+		if err != nil {
+			t.Fatalf("USRPToFormat failed: %v", err)
+		}
+		if i == 0 && !bytes.HasPrefix(data, []byte("fLaC")) {
+			t.Fatal("Expected the first frame to carry the stream header")
+		}
+		stream = append(stream, data...)
+
+		messages, err := decoder.FormatToUSRP(data)
+		if err != nil {
+			t.Fatalf("FormatToUSRP failed: %v", err)
+		}
+		if len(messages) != 1 || messages[0].AudioData != msg.AudioData {
+			t.Fatalf("Frame %d did not round trip losslessly", i)
+		}
+	}
+
+	// The concatenated output is a valid FLAC stream
+	parsed, err := flac.Parse(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Output is not a FLAC stream: %v", err)
+	}
+	if parsed.Info.SampleRate != USRPSampleRate || parsed.Info.NChannels != 1 {
+		t.Errorf("Unexpected stream info: %+v", parsed.Info)
+	}
+
+	if _, err := decoder.FormatToUSRP([]byte{0xFF, 0xF8, 0x00}); err == nil {
+		t.Error("Expected error for a truncated frame")
+	}
+}
+
+func TestFLACWriter(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "recording.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := NewFLACWriter(file, &FLACWriterConfig{BlockSize: 1024, MaxGap: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two overs half a second apart
+	start := time.Now()
+	var want []int16
+	for i := 0; i < 50; i++ {
+		if i == 25 {
+			if err := writer.WriteMessage(voiceFrame(0, false), time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, make([]int16, USRPSampleRate/2)...)
+		}
+		at := start.Add(time.Duration(i) * voiceFrameDuration)
+		if i >= 25 {
+			at = at.Add(500 * time.Millisecond)
+		}
+		msg := toneFrame(i)
+		msg.Header.SetPTT(true)
+		if err := writer.WriteMessage(msg, at); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+		want = append(want, msg.AudioData[:]...)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := writer.WriteMessage(toneFrame(0), time.Time{}); err == nil {
+		t.Error("Expected error writing after Close")
+	}
+	if writer.Duration() != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s recorded, got %v", writer.Duration())
+	}
+
+	size, _ := file.Seek(0, io.SeekEnd)
+	if wavSize := int64(44 + len(want)*2); size >= wavSize {
+		t.Errorf("FLAC file is %d bytes, no smaller than the %d byte WAV", size, wavSize)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := flac.New(file)
+	if err != nil {
+		t.Fatalf("Recording is not a FLAC stream: %v", err)
+	}
+	if stream.Info.NSamples != uint64(len(want)) {
+		t.Errorf("Header records %d samples, want %d", stream.Info.NSamples, len(want))
+	}
+	var got []int16
+	for {
+		f, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to decode recording: %v", err)
+		}
+		for _, sample := range f.Subframes[0].Samples {
+			got = append(got, int16(sample))
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Decoded %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Sample %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if _, err := NewFLACWriter(nil, &FLACWriterConfig{BlockSize: 8}); err == nil {
+		t.Error("Expected error for a tiny block size")
+	}
+}
+
+func TestNewConverterFor(t *testing.T) {
+	live, err := NewConverterFor(PurposeLive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	if _, ok := live.(*OpusNativeConverter); !ok {
+		t.Errorf("Expected Opus for live paths, got %T", live)
+	}
+
+	archive, err := NewConverterFor(PurposeArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if _, ok := archive.(*FLACConverter); !ok {
+		t.Errorf("Expected FLAC for archives, got %T", archive)
+	}
+
+	if _, err := NewConverterFor("broadcast"); err == nil {
+		t.Error("Expected error for an unknown purpose")
+	}
+}
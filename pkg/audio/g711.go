@@ -0,0 +1,243 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// G711Law selects a G.711 companding law
+type G711Law string
+
+const (
+	ULaw G711Law = "ulaw" // μ-law: North America and Japan, USRP_TYPE_VOICE_ULAW
+	ALaw G711Law = "alaw" // A-law: Europe and most international trunks
+)
+
+// alawSegmentEnd is the largest 13-bit magnitude in each A-law segment
+var alawSegmentEnd = [8]int32{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+// ALawEncode converts a 16-bit linear PCM sample to G.711 A-law
+func ALawEncode(sample int16) byte {
+	s := int32(sample) >> 3 // A-law carries 13 bits
+	mask := byte(0xD5)      // Even bits inverted, sign bit set for positive
+	if s < 0 {
+		mask = 0x55
+		s = -s - 1
+	}
+
+	segment := 0
+	for segment < len(alawSegmentEnd) && s > alawSegmentEnd[segment] {
+		segment++
+	}
+	if segment == len(alawSegmentEnd) {
+		return 0x7F ^ mask // Clip
+	}
+
+	a := byte(segment << 4)
+	if segment < 2 {
+		a |= byte(s>>1) & 0x0F
+	} else {
+		a |= byte(s>>segment) & 0x0F
+	}
+	return a ^ mask
+}
+
+// alawDecodeTable maps every A-law byte to its linear PCM value
+var alawDecodeTable = func() [256]int16 {
+	var table [256]int16
+	for i := range table {
+		a := byte(i) ^ 0x55
+		sample := int32(a&0x0F) << 4
+		switch segment := (a & 0x70) >> 4; segment {
+		case 0:
+			sample += 8
+		case 1:
+			sample += 0x108
+		default:
+			sample = (sample + 0x108) << (segment - 1)
+		}
+		if a&0x80 == 0 {
+			sample = -sample
+		}
+		table[i] = int16(sample)
+	}
+	return table
+}()
+
+// ALawDecode converts a G.711 A-law byte to a 16-bit linear PCM sample
+func ALawDecode(a byte) int16 {
+	return alawDecodeTable[a]
+}
+
+// g711EncodeTables maps every 16-bit sample to its μ-law and A-law byte,
+// built on first use (128 KiB)
+var g711EncodeTables = sync.OnceValue(func() *[2][65536]byte {
+	var tables [2][65536]byte
+	for i := range tables[0] {
+		sample := int16(uint16(i))
+		tables[0][i] = usrp.ULawEncode(sample)
+		tables[1][i] = ALawEncode(sample)
+	}
+	return &tables
+})
+
+// encodeTable returns the law's sample-to-byte table
+func (law G711Law) encodeTable() *[65536]byte {
+	if law == ALaw {
+		return &g711EncodeTables()[1]
+	}
+	return &g711EncodeTables()[0]
+}
+
+// validate reports an unknown law
+func (law G711Law) validate() error {
+	if law != ULaw && law != ALaw {
+		return fmt.Errorf("unknown G.711 law %q (want %q or %q)", law, ULaw, ALaw)
+	}
+	return nil
+}
+
+// EncodeG711 companders linear PCM samples into dst, which must hold
+// len(pcm) bytes, and returns dst[:len(pcm)]
+func EncodeG711(law G711Law, dst []byte, pcm []int16) []byte {
+	table := law.encodeTable()
+	dst = dst[:len(pcm)]
+	for i, sample := range pcm {
+		dst[i] = table[uint16(sample)]
+	}
+	return dst
+}
+
+// DecodeG711 expands G.711 bytes into dst, which must hold len(data)
+// samples, and returns dst[:len(data)]
+func DecodeG711(law G711Law, dst []int16, data []byte) []int16 {
+	dst = dst[:len(data)]
+	if law == ALaw {
+		for i, b := range data {
+			dst[i] = alawDecodeTable[b]
+		}
+		return dst
+	}
+	for i, b := range data {
+		dst[i] = usrp.ULawDecode(b)
+	}
+	return dst
+}
+
+// G711Converter converts between USRP voice frames and raw G.711 byte
+// streams (as carried by SIP/RTP payload types 0 and 8) in pure Go. Each
+// USRP frame becomes 160 bytes; incoming bytes are re-framed into 160
+// sample frames whatever the RTP packetization.
+type G711Converter struct {
+	law     G711Law
+	pending []byte // Received bytes not yet framed
+	seq     uint32
+	mutex   sync.Mutex
+	closed  bool
+}
+
+// NewG711Converter creates a G.711 converter for law
+func NewG711Converter(law G711Law) (*G711Converter, error) {
+	if err := law.validate(); err != nil {
+		return nil, err
+	}
+	return &G711Converter{
+		law:     law,
+		pending: make([]byte, 0, usrp.VoiceFrameSize*4),
+	}, nil
+}
+
+// Law returns the converter's companding law
+func (gc *G711Converter) Law() G711Law {
+	return gc.law
+}
+
+// USRPToFormat companders one USRP voice frame into 160 G.711 bytes
+func (gc *G711Converter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	if gc.isClosed() {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	return EncodeG711(gc.law, make([]byte, usrp.VoiceFrameSize), voiceMsg.AudioData[:]), nil
+}
+
+// FormatToUSRP expands G.711 bytes into USRP voice frames. Bytes that do
+// not fill a whole frame are kept for the next call.
+func (gc *G711Converter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	gc.pending = append(gc.pending, data...)
+	var messages []*usrp.VoiceMessage
+	offset := 0
+	for len(gc.pending)-offset >= usrp.VoiceFrameSize {
+		gc.seq++
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, gc.seq)}
+		DecodeG711(gc.law, msg.AudioData[:], gc.pending[offset:offset+usrp.VoiceFrameSize])
+		offset += usrp.VoiceFrameSize
+		messages = append(messages, msg)
+	}
+	gc.pending = gc.pending[:copy(gc.pending, gc.pending[offset:])]
+	return messages, nil
+}
+
+// Flush ends a transmission, padding bytes short of a frame into a last
+// frame. G.711 is stateless, so there is no encoder tail.
+func (gc *G711Converter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+	pcm := DecodeG711(gc.law, make([]int16, len(gc.pending)), gc.pending)
+	gc.pending = gc.pending[:0]
+	return nil, flushFrames(&pcm, &gc.seq), nil
+}
+
+// ULawToFormat converts a USRP μ-law frame to G.711 bytes: a straight copy
+// for μ-law, a transcode for A-law
+func (gc *G711Converter) ULawToFormat(msg *usrp.VoiceULawMessage) []byte {
+	if gc.law == ULaw {
+		return append([]byte(nil), msg.AudioData[:]...)
+	}
+	return EncodeG711(gc.law, make([]byte, usrp.VoiceFrameSize), msg.ToPCM().AudioData[:])
+}
+
+// FormatToULaw converts one frame of G.711 bytes to a USRP μ-law frame,
+// the inverse of ULawToFormat. data must hold exactly 160 bytes.
+func (gc *G711Converter) FormatToULaw(data []byte) (*usrp.VoiceULawMessage, error) {
+	if len(data) != usrp.VoiceFrameSize {
+		return nil, fmt.Errorf("G.711 frame must be %d bytes, got %d", usrp.VoiceFrameSize, len(data))
+	}
+
+	msg := &usrp.VoiceULawMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE_ULAW, 0)}
+	if gc.law == ULaw {
+		copy(msg.AudioData[:], data)
+		return msg, nil
+	}
+	var pcm [usrp.VoiceFrameSize]int16
+	EncodeG711(ULaw, msg.AudioData[:], DecodeG711(gc.law, pcm[:], data))
+	return msg, nil
+}
+
+// isClosed reports whether Close was called
+func (gc *G711Converter) isClosed() bool {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+	return gc.closed
+}
+
+// Close releases the converter; there are no external processes to stop
+func (gc *G711Converter) Close() error {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	gc.closed = true
+	return nil
+}
@@ -0,0 +1,193 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+var _ Converter = (*G711Converter)(nil)
+
+func TestALaw_KnownValues(t *testing.T) {
+	tests := []struct {
+		sample int16
+		alaw   byte
+	}{
+		{0, 0xD5},
+		{-1, 0x55},
+		{32767, 0xAA},
+		{-32768, 0x2A},
+		{1000, 0xFA},
+	}
+	for _, tt := range tests {
+		if got := ALawEncode(tt.sample); got != tt.alaw {
+			t.Errorf("ALawEncode(%d) = 0x%02x, want 0x%02x", tt.sample, got, tt.alaw)
+		}
+	}
+
+	decodes := map[byte]int16{0xD5: 8, 0x55: -8, 0xAA: 32256, 0x2A: -32256}
+	for a, want := range decodes {
+		if got := ALawDecode(a); got != want {
+			t.Errorf("ALawDecode(0x%02x) = %d, want %d", a, got, want)
+		}
+	}
+}
+
+func TestALaw_RoundTripError(t *testing.T) {
+	// A-law quantization error stays within half a step: 8 in the linear
+	// segments, then about 3% of the magnitude
+	for s := -32768; s <= 32767; s += 5 {
+		decoded := int(ALawDecode(ALawEncode(int16(s))))
+		diff, mag := decoded-s, s
+		if diff < 0 {
+			diff = -diff
+		}
+		if mag < 0 {
+			mag = -mag
+		}
+		limit := 16 + mag/32
+		if mag > 32256 {
+			limit = 32768 - 32256 + 16 // Clipped
+		}
+		if diff > limit {
+			t.Fatalf("sample %d decoded as %d (error %d > %d)", s, decoded, diff, limit)
+		}
+	}
+
+	// Every code survives a decode/encode cycle
+	for i := 0; i < 256; i++ {
+		if got := ALawEncode(ALawDecode(byte(i))); got != byte(i) {
+			t.Fatalf("code 0x%02x re-encoded as 0x%02x", i, got)
+		}
+	}
+}
+
+func TestG711_TablesMatchEncoders(t *testing.T) {
+	pcm := make([]int16, 65536)
+	for i := range pcm {
+		pcm[i] = int16(uint16(i))
+	}
+	ulaw := EncodeG711(ULaw, make([]byte, len(pcm)), pcm)
+	alaw := EncodeG711(ALaw, make([]byte, len(pcm)), pcm)
+	for i, sample := range pcm {
+		if ulaw[i] != usrp.ULawEncode(sample) {
+			t.Fatalf("μ-law table[%d] = 0x%02x, want 0x%02x", sample, ulaw[i], usrp.ULawEncode(sample))
+		}
+		if alaw[i] != ALawEncode(sample) {
+			t.Fatalf("A-law table[%d] = 0x%02x, want 0x%02x", sample, alaw[i], ALawEncode(sample))
+		}
+	}
+}
+
+func TestG711Converter_Reframes(t *testing.T) {
+	for _, law := range []G711Law{ULaw, ALaw} {
+		converter, err := NewG711Converter(law)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		voice := toneFrame(3)
+		data, err := converter.USRPToFormat(voice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != usrp.VoiceFrameSize {
+			t.Fatalf("%s: frame encoded to %d bytes", law, len(data))
+		}
+
+		// RTP commonly carries 30 ms (240 bytes): one frame now, a second
+		// once the next packet completes it
+		stream := append(append([]byte(nil), data...), data...)
+		stream = append(stream, data...)
+		frames, err := converter.FormatToUSRP(stream[:240])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != 1 {
+			t.Fatalf("%s: 240 bytes gave %d frames, want 1", law, len(frames))
+		}
+		frames, err = converter.FormatToUSRP(stream[240:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != 2 {
+			t.Fatalf("%s: 240 more bytes gave %d frames, want 2", law, len(frames))
+		}
+
+		for i, sample := range frames[1].AudioData {
+			diff := int(sample) - int(voice.AudioData[i])
+			if diff < -300 || diff > 300 {
+				t.Fatalf("%s: sample %d decoded as %d, sent %d", law, i, sample, voice.AudioData[i])
+			}
+		}
+		converter.Close()
+	}
+
+	if _, err := NewG711Converter("g722"); err == nil {
+		t.Error("unknown law accepted")
+	}
+}
+
+func TestG711Converter_ULawMessages(t *testing.T) {
+	ulawMsg := &usrp.VoiceULawMessage{}
+	ulawMsg.FromPCM(toneFrame(1))
+
+	ulaw, err := NewG711Converter(ULaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := ulaw.ULawToFormat(ulawMsg); !bytes.Equal(data, ulawMsg.AudioData[:]) {
+		t.Fatal("μ-law payload was not passed through unchanged")
+	}
+
+	// μ-law to A-law and back loses at most a step
+	alaw, err := NewG711Converter(ALaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := alaw.FormatToULaw(alaw.ULawToFormat(ulawMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.GetType() != usrp.USRP_TYPE_VOICE_ULAW {
+		t.Fatalf("type = %v, want μ-law voice", back.GetType())
+	}
+	for i := range back.AudioData {
+		diff := int(usrp.ULawDecode(back.AudioData[i])) - int(usrp.ULawDecode(ulawMsg.AudioData[i]))
+		if diff < -300 || diff > 300 {
+			t.Fatalf("sample %d drifted by %d through A-law", i, diff)
+		}
+	}
+
+	if _, err := alaw.FormatToULaw(make([]byte, 80)); err == nil {
+		t.Error("short frame accepted")
+	}
+}
+
+func TestG711Converter_Flush(t *testing.T) {
+	converter, err := NewG711Converter(ULaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	data, _ := converter.USRPToFormat(toneFrame(0))
+	if frames, _ := converter.FormatToUSRP(data[:100]); len(frames) != 0 {
+		t.Fatalf("100 bytes gave %d frames, want 0", len(frames))
+	}
+
+	// The 100 held samples come out padded with silence
+	_, final, err := converter.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(final) != 1 || final[0].AudioData[99] == 0 || final[0].AudioData[100] != 0 {
+		t.Fatalf("Expected one padded frame, got %d", len(final))
+	}
+
+	// and do not leak into the next transmission
+	if frames, _ := converter.FormatToUSRP(data[:100]); len(frames) != 0 {
+		t.Errorf("Flushed bytes carried over: %d frames", len(frames))
+	}
+}
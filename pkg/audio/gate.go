@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// NoiseGateConfig holds noise gate settings. Levels are dBFS RMS.
+type NoiseGateConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	Threshold  float64       `json:"threshold"`   // Level that opens the gate
+	Hysteresis float64       `json:"hysteresis"`  // dB below Threshold the level must fall to start closing
+	Hold       time.Duration `json:"hold"`        // How long the level must stay low before the gate closes
+}
+
+// DefaultNoiseGateConfig returns a gate that opens on speech at -40 dBFS,
+// rides through gaps between words, and closes half a second after the
+// level drops 6 dB below that
+func DefaultNoiseGateConfig() *NoiseGateConfig {
+	return &NoiseGateConfig{
+		SampleRate: 8000,
+		Threshold:  -40,
+		Hysteresis: 6,
+		Hold:       500 * time.Millisecond,
+	}
+}
+
+// NoiseGate mutes audio below a level. Used as a software squelch it gives
+// always-keyed sources a PTT: the gate opens when someone talks and closes
+// once they have been quiet for the hold time. Hysteresis keeps a level
+// hovering around the threshold from chattering the gate.
+type NoiseGate struct {
+	open  float64 // Mean square that opens the gate
+	close float64 // Mean square below which the hold runs down
+	hold  int     // Samples
+
+	isOpen bool
+	quiet  int // Samples below the close level while open
+
+	mutex sync.Mutex
+}
+
+// NewNoiseGate creates a noise gate. A nil config uses
+// DefaultNoiseGateConfig.
+func NewNoiseGate(config *NoiseGateConfig) *NoiseGate {
+	defaults := DefaultNoiseGateConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.Hysteresis < 0 {
+		cfg.Hysteresis = 0
+	}
+
+	open := dbToLinear(cfg.Threshold)
+	close := dbToLinear(cfg.Threshold - cfg.Hysteresis)
+	return &NoiseGate{
+		open:  open * open,
+		close: close * close,
+		hold:  int(cfg.Hold.Seconds() * float64(cfg.SampleRate)),
+	}
+}
+
+// Process gates a block of samples in place, muting it if the gate is
+// closed, and reports whether the gate is open. An empty block leaves the
+// gate as it is.
+func (g *NoiseGate) Process(samples []int16) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(samples) == 0 {
+		return g.isOpen
+	}
+
+	var sum float64
+	for _, s := range samples {
+		x := float64(s) / 32768
+		sum += x * x
+	}
+	meanSquare := sum / float64(len(samples))
+
+	switch {
+	case meanSquare >= g.open:
+		g.isOpen = true
+		g.quiet = 0
+	case g.isOpen && meanSquare < g.close:
+		g.quiet += len(samples)
+		if g.quiet > g.hold {
+			g.isOpen = false
+		}
+	case g.isOpen:
+		// Between the close and open levels: stay open
+		g.quiet = 0
+	}
+
+	if !g.isOpen {
+		for i := range samples {
+			samples[i] = 0
+		}
+	}
+	return g.isOpen
+}
+
+// Squelch gates a voice frame and sets its PTT to whether the gate is
+// open, keying up an always-keyed source only while there is signal
+func (g *NoiseGate) Squelch(msg *usrp.VoiceMessage) bool {
+	open := g.Process(msg.AudioData[:])
+	msg.Header.SetPTT(open)
+	return open
+}
+
+// Open reports whether the gate is open
+func (g *NoiseGate) Open() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.isOpen
+}
+
+// Reset closes the gate
+func (g *NoiseGate) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.isOpen = false
+	g.quiet = 0
+}
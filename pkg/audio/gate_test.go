@@ -0,0 +1,44 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoiseGate_Squelch(t *testing.T) {
+	gate := NewNoiseGate(&NoiseGateConfig{Threshold: -40, Hysteresis: 6, Hold: 100 * time.Millisecond})
+
+	// -50 dBFS noise stays squelched and is muted
+	noise := voiceFrame(100, true)
+	if gate.Squelch(noise) || noise.Header.IsPTT() || noise.AudioData[0] != 0 {
+		t.Fatal("Expected noise below the threshold squelched")
+	}
+
+	// Speech opens it
+	speech := voiceFrame(3000, false)
+	if !gate.Squelch(speech) || !speech.Header.IsPTT() || speech.AudioData[0] != 3000 {
+		t.Fatal("Expected speech to open the squelch and pass")
+	}
+
+	// Between the close level and the threshold it stays open
+	for i := 0; i < 20; i++ {
+		if !gate.Process(voiceFrame(250, false).AudioData[:]) { // -42 dBFS
+			t.Fatal("Expected hysteresis to hold the gate open")
+		}
+	}
+
+	// Quiet frames are passed for the hold time, then the gate closes
+	frames := 0
+	for gate.Process(voiceFrame(100, false).AudioData[:]) {
+		frames++
+		if frames > 10 {
+			t.Fatal("Gate never closed")
+		}
+	}
+	if frames != 5 {
+		t.Errorf("Expected 5 frames of hold, got %d", frames)
+	}
+	if gate.Open() {
+		t.Error("Expected Open to report the closed gate")
+	}
+}
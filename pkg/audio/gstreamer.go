@@ -0,0 +1,341 @@
+//go:build gstreamer
+
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/go-gst/go-gst/pkg/gst"
+	"github.com/go-gst/go-gst/pkg/gstapp"
+)
+
+// gstreamerPullWait bounds how long a conversion waits for the pipeline's
+// first output. Output that is not ready yet is returned by a later call.
+const gstreamerPullWait = 20 * time.Millisecond
+
+// gstreamerAvailable reports whether this build includes GStreamer
+const gstreamerAvailable = true
+
+// gstreamerInit initializes GStreamer once per process
+var gstreamerInit sync.Once
+
+// gstPipeline is one direction's GStreamer pipeline, fed by an appsrc named
+// "src" and drained through an appsink named "sink"
+type gstPipeline struct {
+	name     string // "to-format" or "from-format", for messages
+	pipeline gst.Pipeline
+	src      gstapp.AppSrc
+	sink     gstapp.AppSink
+	err      error // First error the pipeline posted
+}
+
+// newGstPipeline parses and starts a pipeline
+func newGstPipeline(name, description string) (*gstPipeline, error) {
+	element, err := gst.ParseLaunch(description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s GStreamer pipeline: %w", name, err)
+	}
+	pipeline, ok := element.(gst.Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("%s GStreamer description is not a pipeline", name)
+	}
+	src, ok := pipeline.GetByName("src").(gstapp.AppSrc)
+	if !ok {
+		return nil, fmt.Errorf("%s GStreamer pipeline has no appsrc", name)
+	}
+	sink, ok := pipeline.GetByName("sink").(gstapp.AppSink)
+	if !ok {
+		return nil, fmt.Errorf("%s GStreamer pipeline has no appsink", name)
+	}
+
+	gp := &gstPipeline{name: name, pipeline: pipeline, src: src, sink: sink}
+	if pipeline.SetState(gst.StatePlaying) == gst.StateChangeFailure {
+		pipeline.SetState(gst.StateNull)
+		if err := gp.check(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to start %s GStreamer pipeline", name)
+	}
+	return gp, nil
+}
+
+// check picks up an error posted on the pipeline's bus, such as a missing
+// plugin or bad data, and returns the first one seen
+func (gp *gstPipeline) check() error {
+	if gp.err != nil {
+		return gp.err
+	}
+	if msg := gp.pipeline.GetBus().TimedPopFiltered(0, gst.MessageError); msg != nil {
+		_, err := msg.ParseError()
+		gp.err = fmt.Errorf("GStreamer %s pipeline failed: %w", gp.name, err)
+	}
+	return gp.err
+}
+
+// push feeds data into the pipeline
+func (gp *gstPipeline) push(data []byte) error {
+	if err := gp.check(); err != nil {
+		return err
+	}
+
+	buffer := gst.NewBufferAllocate(nil, uint(len(data)), nil)
+	mapped, ok := buffer.Map(gst.MapWrite)
+	if !ok {
+		return fmt.Errorf("failed to map GStreamer buffer")
+	}
+	_, err := mapped.Write(data)
+	mapped.Unmap()
+	if err != nil {
+		return fmt.Errorf("failed to fill GStreamer buffer: %w", err)
+	}
+
+	if ret := gp.src.PushBuffer(buffer); ret != gst.FlowOK {
+		return fmt.Errorf("GStreamer %s pipeline refused data: %s", gp.name, ret)
+	}
+	return nil
+}
+
+// pull collects the output ready now, waiting up to wait for the first
+func (gp *gstPipeline) pull(wait time.Duration) []byte {
+	var out []byte
+	timeout := gst.ClockTime(wait)
+	for {
+		sample := gp.sink.TryPullSample(timeout)
+		if sample == nil {
+			return out
+		}
+		buffer := sample.GetBuffer()
+		if buffer == nil {
+			continue
+		}
+		mapped, ok := buffer.Map(gst.MapRead)
+		if !ok {
+			continue
+		}
+		data := make([]byte, mapped.Length())
+		mapped.ReadAt(data, 0)
+		mapped.Unmap()
+
+		out = append(out, data...)
+		timeout = 0
+	}
+}
+
+// drain ends the stream so every element writes out what it holds,
+// collects that output, and restarts the pipeline for a new stream
+func (gp *gstPipeline) drain() ([]byte, error) {
+	if err := gp.check(); err != nil {
+		return nil, err
+	}
+	gp.src.EndOfStream()
+	// The appsink returns nothing more once end of stream reaches it
+	out := gp.pull(ffmpegFlushWait)
+
+	gp.pipeline.SetState(gst.StateNull)
+	if gp.pipeline.SetState(gst.StatePlaying) == gst.StateChangeFailure {
+		gp.err = fmt.Errorf("failed to restart %s GStreamer pipeline", gp.name)
+		return out, gp.err
+	}
+	return out, nil
+}
+
+// stop shuts the pipeline down
+func (gp *gstPipeline) stop() {
+	gp.pipeline.SetState(gst.StateNull)
+}
+
+// GStreamerConverter converts between USRP voice frames and compressed
+// formats with GStreamer pipelines running in process, for hosts that
+// already ship GStreamer: there are no child processes to spawn and no
+// pipes between them, which saves latency. It speaks the same formats as
+// the FFmpeg converter, apart from Codec2, which GStreamer lacks.
+//
+// Select it with Backend "gstreamer" in the config given to NewConverter,
+// in a build with -tags gstreamer.
+type GStreamerConverter struct {
+	toFormat   *gstPipeline  // USRP -> Target format
+	fromFormat *gstPipeline  // Target format -> USRP; nil with EncodeOnly
+	framer     *FrameAligner // Decoded PCM not yet framed
+	downmix    *pcmDownmixer // Mixes decoded multi-channel PCM to mono; nil when the pipeline decodes to mono
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// newGStreamerConverter creates a GStreamerConverter for NewConverter
+func newGStreamerConverter(config *ConverterConfig) (Converter, error) {
+	return NewGStreamerConverter(config)
+}
+
+// NewGStreamerConverter builds and starts the pipelines for config
+func NewGStreamerConverter(config *ConverterConfig) (*GStreamerConverter, error) {
+	gstreamerInit.Do(gst.Init)
+
+	encoder, err := gstEncoder(config)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := gstDecoder(config)
+	if err != nil {
+		return nil, err
+	}
+	downmix, err := config.downmix()
+	if err != nil {
+		return nil, err
+	}
+
+	gc := &GStreamerConverter{
+		framer:  NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate),
+		downmix: newPCMDownmixer(downmix),
+	}
+	gc.toFormat, err = newGstPipeline("to-format", fmt.Sprintf(
+		"appsrc name=src format=time is-live=true do-timestamp=true "+
+			"caps=audio/x-raw,format=S16LE,layout=interleaved,rate=%d,channels=1 ! "+
+			"audioconvert ! audioresample ! audio/x-raw,rate=%d,channels=%d ! "+
+			"%s ! appsink name=sink sync=false",
+		config.InputRate, config.OutputRate, config.Channels, encoder))
+	if err != nil {
+		return nil, err
+	}
+	if config.EncodeOnly {
+		return gc, nil
+	}
+
+	gc.fromFormat, err = newGstPipeline("from-format", fmt.Sprintf(
+		"appsrc name=src %s ! audioconvert ! audioresample ! "+
+			"audio/x-raw,format=S16LE,layout=interleaved,rate=%d,channels=%d ! "+
+			"appsink name=sink sync=false",
+		decoder, USRPSampleRate, gc.downmix.channels()))
+	if err != nil {
+		gc.toFormat.stop()
+		return nil, err
+	}
+	return gc, nil
+}
+
+// gstEncoder returns the pipeline elements producing OutputFormat, as the
+// FFmpeg muxer of the same name would
+func gstEncoder(config *ConverterConfig) (string, error) {
+	switch config.OutputFormat {
+	case "s16le":
+		return "audioconvert ! audio/x-raw,format=S16LE,layout=interleaved", nil
+	case "opus", "ogg":
+		return fmt.Sprintf("opusenc bitrate=%d frame-size=20 ! oggmux", config.BitRate*1000), nil
+	case "mp3":
+		return fmt.Sprintf("lamemp3enc target=bitrate cbr=true bitrate=%d", config.BitRate), nil
+	default:
+		return "", fmt.Errorf("GStreamer backend cannot encode %q", config.OutputFormat)
+	}
+}
+
+// gstDecoder returns the appsrc caps and elements decoding InputFormat
+func gstDecoder(config *ConverterConfig) (string, error) {
+	switch config.InputFormat {
+	case "s16le":
+		return fmt.Sprintf("caps=audio/x-raw,format=S16LE,layout=interleaved,rate=%d,channels=%d", config.OutputRate, config.Channels), nil
+	case "opus", "ogg", "mp3":
+		return "! decodebin", nil
+	default:
+		return "", fmt.Errorf("GStreamer backend cannot decode %q", config.InputFormat)
+	}
+}
+
+// USRPToFormat feeds one voice frame to the encoder and returns the output
+// ready so far; encoders that buffer return it on later calls
+func (gc *GStreamerConverter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	pcm := make([]byte, len(voiceMsg.AudioData)*2)
+	for i, sample := range voiceMsg.AudioData {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(sample))
+	}
+	if err := gc.toFormat.push(pcm); err != nil {
+		return nil, err
+	}
+	return gc.toFormat.pull(gstreamerPullWait), nil
+}
+
+// FormatToUSRP feeds format data to the decoder and returns the voice
+// frames decoded so far. Samples that do not fill a whole frame are kept
+// for the next call.
+func (gc *GStreamerConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	if gc.fromFormat == nil {
+		return nil, fmt.Errorf("converter only encodes")
+	}
+
+	if err := gc.fromFormat.push(data); err != nil {
+		return nil, err
+	}
+	gc.downmix.write(gc.framer, gc.fromFormat.pull(gstreamerPullWait))
+	return gc.framer.VoiceMessages(), nil
+}
+
+// Flush ends a transmission: both pipelines are sent end of stream,
+// drained, and restarted
+func (gc *GStreamerConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+
+	tail, err := gc.toFormat.drain()
+	if err != nil || gc.fromFormat == nil {
+		return tail, nil, err
+	}
+	pcm, err := gc.fromFormat.drain()
+	gc.downmix.write(gc.framer, pcm)
+	gc.downmix.reset()
+	gc.framer.Flush()
+	return tail, gc.framer.VoiceMessages(), err
+}
+
+// Health reports whether the pipelines have posted an error
+func (gc *GStreamerConverter) Health() ConverterHealth {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	health := ConverterHealth{Healthy: !gc.closed}
+	for _, gp := range []*gstPipeline{gc.toFormat, gc.fromFormat} {
+		if gp == nil {
+			continue
+		}
+		if err := gp.check(); err != nil {
+			health.Healthy = false
+			health.LastError = err.Error()
+		}
+	}
+	return health
+}
+
+// Close stops the pipelines
+func (gc *GStreamerConverter) Close() error {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.closed {
+		return nil
+	}
+	gc.closed = true
+	gc.toFormat.stop()
+	if gc.fromFormat != nil {
+		gc.fromFormat.stop()
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !gstreamer
+
+package audio
+
+import "fmt"
+
+// gstreamerAvailable reports whether this build includes GStreamer
+const gstreamerAvailable = false
+
+// newGStreamerConverter reports that GStreamer support was left out of
+// this build, which avoids needing GStreamer's libraries and cgo
+func newGStreamerConverter(config *ConverterConfig) (Converter, error) {
+	return nil, fmt.Errorf("built without GStreamer support; rebuild with -tags gstreamer")
+}
@@ -0,0 +1,22 @@
+//go:build !gstreamer
+
+package audio
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewConverter_Backends(t *testing.T) {
+	config := &ConverterConfig{InputFormat: "s16le", OutputFormat: "s16le", InputRate: 8000, OutputRate: 8000, Channels: 1}
+
+	config.Backend = BackendGStreamer
+	if _, err := NewConverter(config); err == nil || !strings.Contains(err.Error(), "-tags gstreamer") {
+		t.Errorf("Expected a pointer to the gstreamer build tag, got %v", err)
+	}
+
+	config.Backend = "bogus"
+	if _, err := NewConverter(config); err == nil {
+		t.Error("Expected error for an unknown backend")
+	}
+}
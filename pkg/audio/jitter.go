@@ -0,0 +1,403 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// JitterBufferConfig holds adaptive jitter buffer settings
+type JitterBufferConfig struct {
+	SampleRate    int           `json:"sample_rate"`    // Sample rate (8000 for USRP)
+	FrameDuration time.Duration `json:"frame_duration"` // Playout clock period
+	TargetDelay   time.Duration `json:"target_delay"`   // Delay to start at, before any jitter is measured
+	MinDelay      time.Duration `json:"min_delay"`      // Least delay the target adapts down to
+	MaxDelay      time.Duration `json:"max_delay"`      // Most delay the target adapts up to, and the most audio held; equal to MinDelay for a fixed delay
+}
+
+// DefaultJitterBufferConfig returns a buffer on the 20ms USRP frame clock
+// starting at 60ms of delay and adapting between 40 and 200ms
+func DefaultJitterBufferConfig() *JitterBufferConfig {
+	return &JitterBufferConfig{
+		SampleRate:    8000,
+		FrameDuration: 20 * time.Millisecond,
+		TargetDelay:   60 * time.Millisecond,
+		MinDelay:      40 * time.Millisecond,
+		MaxDelay:      200 * time.Millisecond,
+	}
+}
+
+// JitterBufferStats holds jitter buffer counters
+type JitterBufferStats struct {
+	Received   uint64        `json:"received"`   // Frames pushed
+	Played     uint64        `json:"played"`     // Frames played out
+	Late       uint64        `json:"late"`       // Frames discarded for arriving after their slot
+	Duplicates uint64        `json:"duplicates"` // Frames discarded as already buffered
+	Lost       uint64        `json:"lost"`       // Frames that never arrived in time
+	Concealed  uint64        `json:"concealed"`  // Frames made up by concealment
+	Underruns  uint64        `json:"underruns"`  // Concealed frames that stretched the delay
+	Dropped    uint64        `json:"dropped"`    // Frames discarded to bring the delay down
+	Overflows  uint64        `json:"overflows"`  // Frames discarded because MaxDelay was held
+	Buffered   int           `json:"buffered"`   // Frames held now
+	Target     time.Duration `json:"target"`     // Delay aimed for now
+	Jitter     time.Duration `json:"jitter"`     // Interarrival jitter estimate
+}
+
+// PLCFunc conceals a missing frame. It is given the last frame played (nil
+// if none has been) and how many frames in a row have now been concealed,
+// starting at 1, and returns the frame to play instead.
+type PLCFunc func(last []int16, n int) []int16
+
+// FadeConcealment is the default PLCFunc: it repeats the last frame, 6 dB
+// quieter each time, so a short gap is bridged and a long one fades out
+func FadeConcealment(last []int16, n int) []int16 {
+	frame := make([]int16, len(last))
+	gain := math.Pow(0.5, float64(n))
+	for i, s := range last {
+		frame[i] = int16(float64(s) * gain)
+	}
+	return frame
+}
+
+const (
+	// jitterRestartGap is the sequence distance beyond which a frame is
+	// taken as the sender restarting its counter rather than as late or
+	// lost
+	jitterRestartGap = 1000
+
+	// jitterMultiple is how many jitter estimates of delay the target
+	// allows on top of one frame, which covers nearly every arrival
+	jitterMultiple = 3
+
+	// jitterWindow is how many frames the delay must run over the target
+	// for before a frame is dropped to catch up; bursts make the delay
+	// swing within a window, so only its least counts
+	jitterWindow = 50
+)
+
+// PacketDecoder decodes the packets of a jitter buffer fed with PushPacket.
+// Decoding at playout, in sequence order, lets a codec recover a lost
+// packet from redundancy in the packet after it, as Opus in-band FEC does,
+// or conceal it from its own state.
+type PacketDecoder interface {
+	// DecodePacket decodes one packet
+	DecodePacket(packet []byte) ([]int16, error)
+
+	// RecoverPacket returns audio in place of a lost packet, given the
+	// packet after it, or nil when that has not arrived either
+	RecoverPacket(next []byte) ([]int16, error)
+}
+
+// jitterFrame is one buffered frame, as samples or as a packet to decode
+type jitterFrame struct {
+	seq     uint32
+	samples []int16
+	packet  []byte
+	arrival time.Time
+}
+
+// JitterBuffer turns frames arriving in bursts, out of order or not at all
+// into a steady frame clock. Frames are ordered by sequence number and held
+// for a target delay, which adapts to the measured interarrival jitter
+// (estimated as in RFC 3550) between MinDelay and MaxDelay: an underrun
+// stretches the delay by a concealed frame, and a buffer whose delay stays
+// more than a frame over the target for a second drops one to catch up. Frames arriving after
+// their slot are discarded, and gaps are filled by a PLCFunc. A buffer fed
+// compressed packets instead decodes them at playout with a PacketDecoder,
+// which then fills the gaps itself. Use one buffer per stream.
+type JitterBuffer struct {
+	frame     time.Duration
+	frameSize int // Samples per frame
+	minFrames int
+	maxFrames int
+	plc       PLCFunc
+	decoder   PacketDecoder
+
+	frames    []jitterFrame // Sorted by sequence number
+	playing   bool
+	next      uint32        // Next sequence number to play, while playing
+	last      []int16       // Last frame played
+	concealed int           // Frames concealed in a row
+	jitter    float64       // Interarrival jitter estimate, in frames
+	initial   float64       // jitter before any is measured
+	transit   float64       // Previous frame's arrival less its send time, in frames
+	arrived   bool          // transit, origin and base are valid
+	origin    time.Time     // Arrival transit times are measured from
+	base      uint32        // Sequence number transit times are measured from
+	played    int           // Frames played in the current window
+	least     time.Duration // Least delay of a frame played in the window
+	stats     JitterBufferStats
+
+	mutex sync.Mutex
+}
+
+// NewJitterBuffer creates a jitter buffer. A nil config uses
+// DefaultJitterBufferConfig.
+func NewJitterBuffer(config *JitterBufferConfig) *JitterBuffer {
+	defaults := DefaultJitterBufferConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.FrameDuration <= 0 {
+		cfg.FrameDuration = defaults.FrameDuration
+	}
+	if cfg.MinDelay <= 0 {
+		cfg.MinDelay = defaults.MinDelay
+	}
+	if cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = max(defaults.MaxDelay, cfg.MinDelay)
+	}
+	if cfg.TargetDelay <= 0 {
+		cfg.TargetDelay = defaults.TargetDelay
+	}
+	cfg.TargetDelay = min(max(cfg.TargetDelay, cfg.MinDelay), cfg.MaxDelay)
+
+	frames := func(d time.Duration) int {
+		return max(1, int((d+cfg.FrameDuration-1)/cfg.FrameDuration))
+	}
+	// Start from the jitter that gives the configured target
+	initial := float64(frames(cfg.TargetDelay)-1) / jitterMultiple
+	return &JitterBuffer{
+		frame:     cfg.FrameDuration,
+		frameSize: int(cfg.FrameDuration.Seconds() * float64(cfg.SampleRate)),
+		minFrames: frames(cfg.MinDelay),
+		maxFrames: frames(cfg.MaxDelay),
+		plc:       FadeConcealment,
+		jitter:    initial,
+		initial:   initial,
+	}
+}
+
+// SetConcealment replaces the loss concealment; nil restores
+// FadeConcealment
+func (jb *JitterBuffer) SetConcealment(plc PLCFunc) {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+	if plc == nil {
+		plc = FadeConcealment
+	}
+	jb.plc = plc
+}
+
+// SetDecoder sets the decoder of packets pushed with PushPacket, which
+// also recovers lost ones in place of the PLCFunc
+func (jb *JitterBuffer) SetDecoder(decoder PacketDecoder) {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+	jb.decoder = decoder
+}
+
+// FrameDuration returns the playout clock period
+func (jb *JitterBuffer) FrameDuration() time.Duration {
+	return jb.frame
+}
+
+// target returns the delay aimed for, in frames. Must be called with the
+// mutex held.
+func (jb *JitterBuffer) target() int {
+	frames := 1 + int(math.Ceil(jitterMultiple*jb.jitter))
+	return min(max(frames, jb.minFrames), jb.maxFrames)
+}
+
+// Push adds a frame with its sequence number, received at time at. It
+// reports false when the frame was discarded as late or a duplicate.
+func (jb *JitterBuffer) Push(seq uint32, samples []int16, at time.Time) bool {
+	return jb.push(jitterFrame{seq: seq, samples: append([]int16(nil), samples...), arrival: at})
+}
+
+// PushPacket adds a packet for the decoder set with SetDecoder, as Push
+// does a frame
+func (jb *JitterBuffer) PushPacket(seq uint32, packet []byte, at time.Time) bool {
+	return jb.push(jitterFrame{seq: seq, packet: append([]byte(nil), packet...), arrival: at})
+}
+
+// push adds a frame
+func (jb *JitterBuffer) push(frame jitterFrame) bool {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	seq, at := frame.seq, frame.arrival
+
+	jb.stats.Received++
+
+	if jb.playing {
+		diff := int32(seq - jb.next)
+		if diff < -jitterRestartGap || diff > jitterRestartGap {
+			// Sender restarted its sequence; what is left of the old
+			// stream cannot be ordered against the new one
+			jb.restart()
+		} else if diff < 0 {
+			jb.stats.Late++
+			return false
+		}
+	}
+
+	// Interarrival jitter, as in RFC 3550
+	if !jb.arrived {
+		jb.origin, jb.base = at, seq
+	}
+	transit := float64(at.Sub(jb.origin))/float64(jb.frame) - float64(int32(seq-jb.base))
+	if jb.arrived {
+		jb.jitter += (math.Abs(transit-jb.transit) - jb.jitter) / 16
+	}
+	jb.transit, jb.arrived = transit, true
+
+	// Find the insertion point in sequence order
+	i := len(jb.frames)
+	for i > 0 && int32(jb.frames[i-1].seq-seq) > 0 {
+		i--
+	}
+	if i > 0 && jb.frames[i-1].seq == seq {
+		jb.stats.Duplicates++
+		return false
+	}
+	jb.frames = append(jb.frames, jitterFrame{})
+	copy(jb.frames[i+1:], jb.frames[i:])
+	jb.frames[i] = frame
+
+	// Discard the oldest frame so the delay stays bounded
+	if len(jb.frames) > jb.maxFrames {
+		if jb.playing {
+			jb.next = jb.frames[0].seq + 1
+		}
+		jb.frames = jb.frames[1:]
+		jb.stats.Overflows++
+	}
+	return true
+}
+
+// Pop returns the frame to play at time now, concealing one that is
+// missing. Call it once per FrameDuration; it reports false while the
+// buffer is filling and once a stream has ended, having gone MaxDelay
+// without a frame.
+func (jb *JitterBuffer) Pop(now time.Time) ([]int16, bool) {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	target := jb.target()
+	if !jb.playing {
+		if len(jb.frames) == 0 {
+			return nil, false
+		}
+		head := jb.frames[0]
+		if len(jb.frames) < target && now.Sub(head.arrival) < time.Duration(target)*jb.frame {
+			return nil, false
+		}
+		jb.playing = true
+		jb.next = head.seq
+	}
+
+	if len(jb.frames) > 0 && jb.frames[0].seq == jb.next {
+		if jb.played == 0 || now.Sub(jb.frames[0].arrival) < jb.least {
+			jb.least = now.Sub(jb.frames[0].arrival)
+		}
+		if jb.played++; jb.played >= jitterWindow {
+			// Ran more than a frame over the target all window: catch up
+			if jb.least > time.Duration(target+1)*jb.frame && len(jb.frames) > 1 && jb.frames[1].seq == jb.next+1 {
+				jb.frames = jb.frames[1:]
+				jb.next++
+				jb.stats.Dropped++
+			}
+			jb.played = 0
+		}
+
+		head := jb.frames[0]
+		jb.frames = jb.frames[1:]
+		jb.next++
+		frame := head.samples
+		if head.packet != nil {
+			var err error
+			if frame, err = jb.decode(head.packet); err != nil {
+				// Undecodable: conceal it as if it were lost
+				jb.stats.Lost++
+				return jb.conceal(nil), true
+			}
+		}
+		jb.last, jb.concealed = frame, 0
+		jb.stats.Played++
+		return frame, true
+	}
+
+	switch {
+	case len(jb.frames) > 0:
+		// Later frames are here, so this one is lost
+		jb.next++
+		jb.stats.Lost++
+	case jb.concealed >= jb.maxFrames:
+		// Nothing for MaxDelay: the stream has ended
+		jb.restart()
+		return nil, false
+	default:
+		// Underrun: play a concealed frame in this one's place, which adds
+		// a frame of delay
+		jb.stats.Underruns++
+	}
+
+	var next []byte
+	if len(jb.frames) > 0 && jb.frames[0].seq == jb.next {
+		next = jb.frames[0].packet
+	}
+	return jb.conceal(next), true
+}
+
+// decode decodes a packet, which needs a decoder. Must be called with the
+// mutex held.
+func (jb *JitterBuffer) decode(packet []byte) ([]int16, error) {
+	if jb.decoder == nil {
+		return nil, fmt.Errorf("no decoder for jitter buffered packets")
+	}
+	return jb.decoder.DecodePacket(packet)
+}
+
+// conceal returns a frame in place of a missing one, recovered by the
+// decoder from next (the packet after it, if here) or made up by the
+// PLCFunc. Must be called with the mutex held.
+func (jb *JitterBuffer) conceal(next []byte) []int16 {
+	jb.concealed++
+	jb.stats.Concealed++
+	if jb.decoder != nil {
+		if frame, err := jb.decoder.RecoverPacket(next); err == nil {
+			return frame
+		}
+	}
+	last := jb.last
+	if last == nil {
+		last = make([]int16, jb.frameSize)
+	}
+	return jb.plc(last, jb.concealed)
+}
+
+// restart forgets the stream, keeping the counters. Must be called with the
+// mutex held.
+func (jb *JitterBuffer) restart() {
+	jb.frames = jb.frames[:0]
+	jb.playing = false
+	jb.last, jb.concealed = nil, 0
+	jb.arrived = false
+	jb.played = 0
+}
+
+// Stats returns a copy of the current counters
+func (jb *JitterBuffer) Stats() JitterBufferStats {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	stats := jb.stats
+	stats.Buffered = len(jb.frames)
+	stats.Target = time.Duration(jb.target()) * jb.frame
+	stats.Jitter = time.Duration(jb.jitter * float64(jb.frame))
+	return stats
+}
+
+// Reset forgets the stream and its jitter estimate, keeping the counters
+func (jb *JitterBuffer) Reset() {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+	jb.restart()
+	jb.jitter = jb.initial
+}
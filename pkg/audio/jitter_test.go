@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// seqFrame returns a 20ms frame holding seq in every sample, so played
+// frames can be told apart
+func seqFrame(seq uint32) []int16 {
+	frame := make([]int16, 160)
+	for i := range frame {
+		frame[i] = int16(seq)
+	}
+	return frame
+}
+
+func TestJitterBuffer_Bursts(t *testing.T) {
+	jb := NewJitterBuffer(nil)
+	start := time.Now()
+	frame := jb.FrameDuration()
+
+	// Frames 100-159 sent every 20ms arrive three at a time, and 130 and
+	// 131 swap places
+	var played []int16
+	seq := uint32(100)
+	for tick := 0; tick < 100; tick++ {
+		now := start.Add(time.Duration(tick) * frame)
+		if tick%3 == 2 && seq < 160 {
+			for _, s := range []uint32{seq, seq + 1, seq + 2} {
+				switch s {
+				case 130:
+					s = 131
+				case 131:
+					s = 130
+				}
+				jb.Push(s, seqFrame(s), now)
+			}
+			seq += 3
+		}
+		if samples, ok := jb.Pop(now); ok {
+			played = append(played, samples[0])
+		}
+	}
+
+	for i := 0; i < 60; i++ {
+		if i >= len(played) || played[i] != int16(100+i) {
+			t.Fatalf("Played %v, want 100-159 in order", played)
+		}
+	}
+	stats := jb.Stats()
+	if stats.Played != 60 || stats.Lost != 0 || stats.Late != 0 {
+		t.Errorf("Expected 60 frames played and none lost or late, got %+v", stats)
+	}
+	if stats.Jitter <= 0 {
+		t.Errorf("Expected bursts to register as jitter, got %v", stats.Jitter)
+	}
+
+	// With nothing arriving the stream ends after MaxDelay of concealment
+	if len(played) != 60+int(stats.Concealed) || stats.Concealed > 10 {
+		t.Errorf("Expected at most 10 concealed frames after the stream, got %d", stats.Concealed)
+	}
+	if _, ok := jb.Pop(start.Add(time.Hour)); ok {
+		t.Error("Expected nothing to play once the stream ended")
+	}
+}
+
+func TestJitterBuffer_LossAndLate(t *testing.T) {
+	jb := NewJitterBuffer(&JitterBufferConfig{MinDelay: 40 * time.Millisecond, MaxDelay: 40 * time.Millisecond})
+	var calls []int
+	jb.SetConcealment(func(last []int16, n int) []int16 {
+		calls = append(calls, n)
+		return FadeConcealment(last, n)
+	})
+	start := time.Now()
+	frame := jb.FrameDuration()
+
+	var played []int16
+	for tick := 0; tick < 10; tick++ {
+		now := start.Add(time.Duration(tick) * frame)
+		if tick != 4 {
+			jb.Push(uint32(tick), seqFrame(uint32(1000+tick)), now)
+		}
+		if samples, ok := jb.Pop(now); ok {
+			played = append(played, samples[0])
+		}
+	}
+
+	// Frame 4 was lost: the frame before it is repeated at half level
+	want := []int16{1000, 1001, 1002, 1003, 501, 1005, 1006, 1007, 1008}
+	if len(played) != len(want) {
+		t.Fatalf("Played %v, want %v", played, want)
+	}
+	for i := range want {
+		if played[i] != want[i] {
+			t.Fatalf("Played %v, want %v", played, want)
+		}
+	}
+	if len(calls) != 1 || calls[0] != 1 {
+		t.Errorf("Expected one call to the concealment hook, got %v", calls)
+	}
+
+	// Frame 4 turning up now is too late
+	if jb.Push(4, seqFrame(1004), start.Add(10*frame)) {
+		t.Error("Expected a late frame to be discarded")
+	}
+	if stats := jb.Stats(); stats.Lost != 1 || stats.Late != 1 {
+		t.Errorf("Expected 1 lost and 1 late frame, got %+v", stats)
+	}
+}
+
+func TestJitterBuffer_Adapts(t *testing.T) {
+	jb := NewJitterBuffer(nil)
+	start := time.Now()
+	frame := jb.FrameDuration()
+	rng := rand.New(rand.NewSource(1))
+
+	// Arrivals up to 80ms late raise the target
+	for seq := uint32(0); seq < 200; seq++ {
+		delay := time.Duration(rng.Int63n(int64(80 * time.Millisecond)))
+		jb.Push(seq, seqFrame(seq), start.Add(time.Duration(seq)*frame+delay))
+		jb.Pop(start.Add(time.Duration(seq) * frame))
+	}
+	if target := jb.Stats().Target; target <= 60*time.Millisecond {
+		t.Errorf("Expected the target to rise above 60ms with 80ms of jitter, got %v", target)
+	}
+
+	// A steady stream after a backlog of 8 frames brings it down to
+	// MinDelay, dropping frames to catch up
+	jb.Reset()
+	resumed := start.Add(time.Hour)
+	for seq := uint32(0); seq < 8; seq++ {
+		jb.Push(seq, seqFrame(seq), resumed)
+	}
+	for seq := uint32(8); seq < 500; seq++ {
+		now := resumed.Add(time.Duration(seq) * frame)
+		jb.Push(seq, seqFrame(seq), now)
+		jb.Pop(now)
+	}
+	stats := jb.Stats()
+	if stats.Target != 40*time.Millisecond || stats.Buffered > 3 {
+		t.Errorf("Expected the delay to settle at 40ms, got %+v", stats)
+	}
+	if stats.Dropped == 0 {
+		t.Error("Expected frames dropped to catch up")
+	}
+}
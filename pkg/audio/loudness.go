@@ -0,0 +1,301 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Loudness measurement after ITU-R BS.1770 / EBU R128: K-weighted mean
+// square over 400ms blocks stepped every 100ms, gated at -70 LUFS
+// absolute and 10 LU below the ungated integrated loudness
+const (
+	loudnessOffset   = -0.691 // Makes a full-scale 1kHz sine read -3.01 LUFS
+	loudnessSubBlock = 100 * time.Millisecond
+	loudnessBlock    = 4  // Sub-blocks per 400ms momentary block
+	loudnessShort    = 30 // Sub-blocks per 3s short-term window
+
+	loudnessAbsoluteGate = -70.0
+	loudnessRelativeGate = -10.0
+
+	// Block loudness histogram, which integrates without keeping every
+	// block: 0.1 LU bins from the absolute gate up
+	loudnessBinWidth = 0.1
+	loudnessBins     = 800
+)
+
+// loudness converts a K-weighted mean square to LUFS
+func loudness(meanSquare float64) float64 {
+	if meanSquare <= 0 {
+		return math.Inf(-1)
+	}
+	return loudnessOffset + 10*math.Log10(meanSquare)
+}
+
+// LoudnessMeter measures loudness in LUFS as EBU R128 specifies:
+// momentary (400ms), short-term (3s) and gated integrated loudness. It
+// reads 16-bit mono audio at any sample rate. Silence reads as -Inf.
+type LoudnessMeter struct {
+	weighting [2]biquad // K-weighting: head shelf, then RLB high-pass
+	subBlock  int       // Samples per sub-block
+	sum       float64   // Squares so far in the current sub-block
+	count     int
+	recent    []float64 // Mean squares of the latest sub-blocks, oldest first
+	histogram [loudnessBins]struct{ weight, power float64 }
+	forget    float64 // Weight kept by old blocks at each new one (1 = integrate forever)
+	mutex     sync.Mutex
+}
+
+// NewLoudnessMeter creates a meter for audio at sampleRate
+func NewLoudnessMeter(sampleRate int) *LoudnessMeter {
+	if sampleRate <= 0 {
+		sampleRate = USRPSampleRate
+	}
+	return &LoudnessMeter{
+		weighting: [2]biquad{
+			highShelfBiquad(1500, 1/math.Sqrt2, 4, sampleRate),
+			highPassBiquad(38, 0.5, sampleRate),
+		},
+		subBlock: int(loudnessSubBlock.Seconds() * float64(sampleRate)),
+		forget:   1,
+	}
+}
+
+// Process measures samples
+func (m *LoudnessMeter) Process(samples []int16) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, s := range samples {
+		x := float64(s) / 32768
+		for i := range m.weighting {
+			x = m.weighting[i].process(x)
+		}
+		m.sum += x * x
+		if m.count++; m.count == m.subBlock {
+			m.endSubBlock()
+		}
+	}
+}
+
+// endSubBlock files a finished sub-block and the block it completes. Must
+// be called with the mutex held.
+func (m *LoudnessMeter) endSubBlock() {
+	m.recent = append(m.recent, m.sum/float64(m.count))
+	if len(m.recent) > loudnessShort {
+		m.recent = m.recent[1:]
+	}
+	m.sum, m.count = 0, 0
+	if len(m.recent) < loudnessBlock {
+		return
+	}
+
+	power := mean(m.recent[len(m.recent)-loudnessBlock:])
+	if m.forget < 1 {
+		for i := range m.histogram {
+			m.histogram[i].weight *= m.forget
+			m.histogram[i].power *= m.forget
+		}
+	}
+	if bin := loudnessBin(loudness(power)); bin >= 0 {
+		m.histogram[bin].weight++
+		m.histogram[bin].power += power
+	}
+}
+
+// loudnessBin returns the histogram bin of a block's loudness, -1 when it
+// is below the absolute gate
+func loudnessBin(l float64) int {
+	if l <= loudnessAbsoluteGate {
+		return -1
+	}
+	return min(int((l-loudnessAbsoluteGate)/loudnessBinWidth), loudnessBins-1)
+}
+
+// mean returns the average of values
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Momentary returns the loudness of the latest 400ms
+func (m *LoudnessMeter) Momentary() float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.recent) < loudnessBlock {
+		return math.Inf(-1)
+	}
+	return loudness(mean(m.recent[len(m.recent)-loudnessBlock:]))
+}
+
+// ShortTerm returns the loudness of the latest 3s, or as much as has been
+// measured
+func (m *LoudnessMeter) ShortTerm() float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.recent) == 0 {
+		return math.Inf(-1)
+	}
+	return loudness(mean(m.recent))
+}
+
+// Integrated returns the gated loudness of everything measured since the
+// meter was created or reset; silence and pauses are gated out
+func (m *LoudnessMeter) Integrated() float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.integrated()
+}
+
+// integrated computes Integrated. Must be called with the mutex held.
+func (m *LoudnessMeter) integrated() float64 {
+	gated := func(from int) float64 {
+		var weight, power float64
+		for _, b := range m.histogram[max(from, 0):] {
+			weight += b.weight
+			power += b.power
+		}
+		if weight == 0 {
+			return 0
+		}
+		return power / weight
+	}
+
+	ungated := loudness(gated(0))
+	if math.IsInf(ungated, -1) {
+		return ungated
+	}
+	return loudness(gated(loudnessBin(ungated + loudnessRelativeGate)))
+}
+
+// Reset forgets everything measured
+func (m *LoudnessMeter) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.weighting {
+		m.weighting[i].reset()
+	}
+	m.sum, m.count = 0, 0
+	m.recent = m.recent[:0]
+	m.histogram = [loudnessBins]struct{ weight, power float64 }{}
+}
+
+// LoudnessConfig holds loudness normalizer settings
+type LoudnessConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	Target     float64       `json:"target"`      // Integrated loudness to reach, in LUFS
+	MaxGain    float64       `json:"max_gain"`    // Most gain applied either way, in dB
+	Window     time.Duration `json:"window"`      // Time constant of the loudness integration, so a source that changes level is followed
+	Ceiling    float64       `json:"ceiling"`     // Peak level no sample is raised above, in dBFS
+	Speed      time.Duration `json:"speed"`       // Time constant of gain changes
+}
+
+// DefaultLoudnessConfig returns settings for 8kHz speech: the EBU R128
+// target of -23 LUFS, up to 20 dB of gain, following a source's level over
+// about 30s and peaking no higher than -1 dBFS
+func DefaultLoudnessConfig() *LoudnessConfig {
+	return &LoudnessConfig{
+		SampleRate: 8000,
+		Target:     -23,
+		MaxGain:    20,
+		Window:     30 * time.Second,
+		Ceiling:    -1,
+		Speed:      time.Second,
+	}
+}
+
+// LoudnessNormalizer brings a source to a target integrated loudness, so
+// bridged sources reach listeners at the same perceived volume. Unlike the
+// AGC, which rides the level of every syllable, it measures the source's
+// gated loudness over a long window and applies one slowly moving gain,
+// leaving the dynamics of speech alone. Use one normalizer per source.
+type LoudnessNormalizer struct {
+	meter   *LoudnessMeter
+	target  float64
+	maxGain float64
+	ceiling float64 // Linear, in sample units
+	speed   float64 // Gain smoothing coefficient, per sample
+	gain    float64 // dB
+
+	mutex sync.Mutex
+}
+
+// NewLoudnessNormalizer creates a loudness normalizer. A nil config uses
+// DefaultLoudnessConfig.
+func NewLoudnessNormalizer(config *LoudnessConfig) *LoudnessNormalizer {
+	defaults := DefaultLoudnessConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.Target == 0 {
+		cfg.Target = defaults.Target
+	}
+	if cfg.MaxGain <= 0 {
+		cfg.MaxGain = defaults.MaxGain
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.Ceiling == 0 {
+		cfg.Ceiling = defaults.Ceiling
+	}
+	if cfg.Speed <= 0 {
+		cfg.Speed = defaults.Speed
+	}
+
+	meter := NewLoudnessMeter(cfg.SampleRate)
+	meter.forget = math.Exp(-loudnessSubBlock.Seconds() / cfg.Window.Seconds())
+	return &LoudnessNormalizer{
+		meter:   meter,
+		target:  cfg.Target,
+		maxGain: cfg.MaxGain,
+		ceiling: 32767 * dbToLinear(min(cfg.Ceiling, 0)),
+		speed:   smoothing(cfg.Speed, cfg.SampleRate),
+	}
+}
+
+// Process measures samples and applies the gain in place
+func (n *LoudnessNormalizer) Process(samples []int16) {
+	n.meter.Process(samples)
+	measured := n.meter.Integrated()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	desired := n.gain
+	if !math.IsInf(measured, -1) {
+		desired = min(max(n.target-measured, -n.maxGain), n.maxGain)
+	}
+	for i, s := range samples {
+		n.gain = desired + n.speed*(n.gain-desired)
+		x := float64(s) * dbToLinear(n.gain)
+		samples[i] = clampInt16(min(max(x, -n.ceiling), n.ceiling))
+	}
+}
+
+// Loudness returns the source's measured integrated loudness in LUFS
+func (n *LoudnessNormalizer) Loudness() float64 {
+	return n.meter.Integrated()
+}
+
+// Gain returns the gain being applied, in dB
+func (n *LoudnessNormalizer) Gain() float64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.gain
+}
+
+// Reset forgets the source's loudness and returns the gain to 0 dB
+func (n *LoudnessNormalizer) Reset() {
+	n.meter.Reset()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.gain = 0
+}
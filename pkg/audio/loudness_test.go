@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+// sine returns seconds of a 1kHz sine at a peak level in dBFS
+func sine(level, seconds float64) []int16 {
+	samples := make([]int16, int(seconds*8000))
+	signal.NewSine(1000, dbToLinear(level), 8000).Fill(samples)
+	return samples
+}
+
+func TestLoudnessMeter(t *testing.T) {
+	m := NewLoudnessMeter(8000)
+	if l := m.Integrated(); !math.IsInf(l, -1) {
+		t.Errorf("Expected -Inf before any audio, got %.1f", l)
+	}
+
+	// A 1kHz sine reads 3 LU below its peak level
+	m.Process(sine(-20, 5))
+	for name, l := range map[string]float64{
+		"momentary":  m.Momentary(),
+		"short-term": m.ShortTerm(),
+		"integrated": m.Integrated(),
+	} {
+		if math.Abs(l+23) > 0.5 {
+			t.Errorf("Expected %s loudness near -23 LUFS, got %.2f", name, l)
+		}
+	}
+
+	// Silence is gated out of the integrated loudness, and a quiet passage
+	// more than 10 LU down is too
+	m.Process(make([]int16, 5*8000))
+	m.Process(sine(-45, 5))
+	if l := m.Integrated(); math.Abs(l+23) > 0.5 {
+		t.Errorf("Expected gating to hold the integrated loudness near -23 LUFS, got %.2f", l)
+	}
+	if l := m.ShortTerm(); l > -45 {
+		t.Errorf("Expected the short-term loudness to follow the quiet passage, got %.2f", l)
+	}
+
+	m.Reset()
+	if l := m.Momentary(); !math.IsInf(l, -1) {
+		t.Errorf("Expected -Inf after Reset, got %.1f", l)
+	}
+}
+
+func TestLoudnessNormalizer(t *testing.T) {
+	for _, level := range []float64{-40, -10} {
+		n := NewLoudnessNormalizer(nil)
+		var out []int16
+		for i := 0; i < 10; i++ {
+			samples := sine(level, 1)
+			n.Process(samples)
+			out = samples
+		}
+
+		m := NewLoudnessMeter(8000)
+		m.Process(out)
+		if l := m.Integrated(); math.Abs(l+23) > 1 {
+			t.Errorf("Source at %.0f dBFS: expected output near -23 LUFS, got %.2f (gain %.1f dB)", level, l, n.Gain())
+		}
+	}
+
+	// Gain is limited, and peaks never pass the ceiling
+	n := NewLoudnessNormalizer(&LoudnessConfig{Target: -5, MaxGain: 6})
+	var peak float64
+	for i := 0; i < 10; i++ {
+		samples := sine(-20, 1)
+		n.Process(samples)
+		for _, s := range samples {
+			peak = math.Max(peak, math.Abs(float64(s)))
+		}
+	}
+	if g := n.Gain(); math.Abs(g-6) > 0.1 {
+		t.Errorf("Expected the gain held at 6 dB, got %.1f", g)
+	}
+	if ceiling := 32767 * dbToLinear(-1); peak > ceiling+1 {
+		t.Errorf("Expected peaks under %.0f, got %.0f", ceiling, peak)
+	}
+}
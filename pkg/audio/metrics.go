@@ -0,0 +1,289 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// ConverterMetrics is a point-in-time copy of converter counters. Encoding
+// takes USRP frames in and gives bytes out; decoding takes bytes in and
+// gives frames out.
+type ConverterMetrics struct {
+	EncodeCalls  uint64        `json:"encode_calls"`  // USRPToFormat calls, and flushes
+	DecodeCalls  uint64        `json:"decode_calls"`  // FormatToUSRP calls
+	EncodeErrors uint64        `json:"encode_errors"` // Encode calls that failed
+	DecodeErrors uint64        `json:"decode_errors"` // Decode calls that failed
+	FramesIn     uint64        `json:"frames_in"`     // USRP frames encoded
+	FramesOut    uint64        `json:"frames_out"`    // USRP frames decoded
+	BytesIn      uint64        `json:"bytes_in"`      // Encoded bytes decoded
+	BytesOut     uint64        `json:"bytes_out"`     // Encoded bytes produced
+	EncodeTime   time.Duration `json:"encode_time"`   // Total time spent encoding
+	DecodeTime   time.Duration `json:"decode_time"`   // Total time spent decoding
+}
+
+// EncodeLatency returns the average time an encode call took
+func (m ConverterMetrics) EncodeLatency() time.Duration {
+	if m.EncodeCalls == 0 {
+		return 0
+	}
+	return m.EncodeTime / time.Duration(m.EncodeCalls)
+}
+
+// DecodeLatency returns the average time a decode call took
+func (m ConverterMetrics) DecodeLatency() time.Duration {
+	if m.DecodeCalls == 0 {
+		return 0
+	}
+	return m.DecodeTime / time.Duration(m.DecodeCalls)
+}
+
+// MetricsReporter is implemented by whatever can report converter
+// counters: a metered converter, or a meter shared by many
+type MetricsReporter interface {
+	Metrics() ConverterMetrics
+}
+
+// ConverterMeter accumulates the counters of one or more converters, such
+// as every converter a pool creates for one format, so the counts outlive
+// the converters themselves. It is safe for concurrent use.
+type ConverterMeter struct {
+	encodeCalls  uint64
+	decodeCalls  uint64
+	encodeErrors uint64
+	decodeErrors uint64
+	framesIn     uint64
+	framesOut    uint64
+	bytesIn      uint64
+	bytesOut     uint64
+	encodeTime   int64
+	decodeTime   int64
+}
+
+// NewConverterMeter creates an empty ConverterMeter
+func NewConverterMeter() *ConverterMeter {
+	return &ConverterMeter{}
+}
+
+// encoded records an encode call of frames USRP frames
+func (m *ConverterMeter) encoded(frames, bytes int, elapsed time.Duration, err error) {
+	atomic.AddUint64(&m.encodeCalls, 1)
+	atomic.AddInt64(&m.encodeTime, int64(elapsed))
+	if err != nil {
+		atomic.AddUint64(&m.encodeErrors, 1)
+		return
+	}
+	atomic.AddUint64(&m.framesIn, uint64(frames))
+	atomic.AddUint64(&m.bytesOut, uint64(bytes))
+}
+
+// decoded records a decode call
+func (m *ConverterMeter) decoded(bytes, frames int, elapsed time.Duration, err error) {
+	atomic.AddUint64(&m.decodeCalls, 1)
+	atomic.AddInt64(&m.decodeTime, int64(elapsed))
+	atomic.AddUint64(&m.bytesIn, uint64(bytes))
+	if err != nil {
+		atomic.AddUint64(&m.decodeErrors, 1)
+		return
+	}
+	atomic.AddUint64(&m.framesOut, uint64(frames))
+}
+
+// Metrics returns a copy of the counters
+func (m *ConverterMeter) Metrics() ConverterMetrics {
+	return ConverterMetrics{
+		EncodeCalls:  atomic.LoadUint64(&m.encodeCalls),
+		DecodeCalls:  atomic.LoadUint64(&m.decodeCalls),
+		EncodeErrors: atomic.LoadUint64(&m.encodeErrors),
+		DecodeErrors: atomic.LoadUint64(&m.decodeErrors),
+		FramesIn:     atomic.LoadUint64(&m.framesIn),
+		FramesOut:    atomic.LoadUint64(&m.framesOut),
+		BytesIn:      atomic.LoadUint64(&m.bytesIn),
+		BytesOut:     atomic.LoadUint64(&m.bytesOut),
+		EncodeTime:   time.Duration(atomic.LoadInt64(&m.encodeTime)),
+		DecodeTime:   time.Duration(atomic.LoadInt64(&m.decodeTime)),
+	}
+}
+
+// MeteredConverter wraps a converter, timing and counting every call into
+// a meter. It passes Flush and Health through to the converter it wraps.
+type MeteredConverter struct {
+	converter Converter
+	meter     *ConverterMeter
+}
+
+// NewMeteredConverter wraps converter, recording into meter. A nil meter
+// gives the converter one of its own.
+func NewMeteredConverter(converter Converter, meter *ConverterMeter) *MeteredConverter {
+	if meter == nil {
+		meter = NewConverterMeter()
+	}
+	return &MeteredConverter{converter: converter, meter: meter}
+}
+
+// MeterFactory wraps factory so every converter it creates records into
+// meter
+func MeterFactory(factory ConverterFactory, meter *ConverterMeter) ConverterFactory {
+	return func() (Converter, error) {
+		converter, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return NewMeteredConverter(converter, meter), nil
+	}
+}
+
+// USRPToFormat encodes a voice frame
+func (mc *MeteredConverter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	start := time.Now()
+	data, err := mc.converter.USRPToFormat(voiceMsg)
+	mc.meter.encoded(1, len(data), time.Since(start), err)
+	return data, err
+}
+
+// FormatToUSRP decodes data into voice frames
+func (mc *MeteredConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	start := time.Now()
+	messages, err := mc.converter.FormatToUSRP(data)
+	mc.meter.decoded(len(data), len(messages), time.Since(start), err)
+	return messages, err
+}
+
+// Flush flushes the wrapped converter, counting it as an encode call
+func (mc *MeteredConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	start := time.Now()
+	data, messages, err := FlushConverter(mc.converter)
+	mc.meter.encoded(0, len(data), time.Since(start), err)
+	if err == nil {
+		atomic.AddUint64(&mc.meter.framesOut, uint64(len(messages)))
+	}
+	return data, messages, err
+}
+
+// Health reports the wrapped converter's health. Converters without
+// external processes are always healthy.
+func (mc *MeteredConverter) Health() ConverterHealth {
+	if reporter, ok := mc.converter.(HealthReporter); ok {
+		return reporter.Health()
+	}
+	return ConverterHealth{Healthy: true}
+}
+
+// Metrics returns the counters of the meter the converter records into
+func (mc *MeteredConverter) Metrics() ConverterMetrics {
+	return mc.meter.Metrics()
+}
+
+// Close closes the wrapped converter
+func (mc *MeteredConverter) Close() error {
+	return mc.converter.Close()
+}
+
+// ConverterExporter serves the counters of named converters in the
+// Prometheus text exposition format, alongside the transport link metrics
+type ConverterExporter struct {
+	namespace  string
+	converters map[string]MetricsReporter
+	mutex      sync.RWMutex
+}
+
+// NewConverterExporter creates an exporter whose metric names start with
+// namespace (e.g. "usrp" gives usrp_converter_calls_total)
+func NewConverterExporter(namespace string) *ConverterExporter {
+	return &ConverterExporter{
+		namespace:  namespace,
+		converters: make(map[string]MetricsReporter),
+	}
+}
+
+// Register exports r under the converter label, replacing any previous
+// reporter with the same name
+func (e *ConverterExporter) Register(converter string, r MetricsReporter) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.converters[converter] = r
+}
+
+// Unregister stops exporting a converter
+func (e *ConverterExporter) Unregister(converter string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.converters, converter)
+}
+
+// WriteTo writes every registered converter's counters to w
+func (e *ConverterExporter) WriteTo(w io.Writer) (int64, error) {
+	e.mutex.RLock()
+	names := make([]string, 0, len(e.converters))
+	snapshots := make(map[string]ConverterMetrics, len(e.converters))
+	for name, r := range e.converters {
+		names = append(names, name)
+		snapshots[name] = r.Metrics()
+	}
+	e.mutex.RUnlock()
+	sort.Strings(names)
+
+	prefix := "converter_"
+	if e.namespace != "" {
+		prefix = e.namespace + "_" + prefix
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var b strings.Builder
+	family := func(name, kind, help string, value func(m ConverterMetrics, encode bool) string) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, name, help, prefix, name, kind)
+		for _, converter := range names {
+			for _, op := range []string{"encode", "decode"} {
+				fmt.Fprintf(&b, "%s%s{converter=\"%s\",op=\"%s\"} %s\n",
+					prefix, name, escape.Replace(converter), op, value(snapshots[converter], op == "encode"))
+			}
+		}
+	}
+
+	family("calls_total", "counter", "Encode and decode calls.", func(m ConverterMetrics, encode bool) string {
+		if encode {
+			return fmt.Sprint(m.EncodeCalls)
+		}
+		return fmt.Sprint(m.DecodeCalls)
+	})
+	family("errors_total", "counter", "Encode and decode calls that failed.", func(m ConverterMetrics, encode bool) string {
+		if encode {
+			return fmt.Sprint(m.EncodeErrors)
+		}
+		return fmt.Sprint(m.DecodeErrors)
+	})
+	family("seconds_total", "counter", "Time spent in encode and decode calls.", func(m ConverterMetrics, encode bool) string {
+		if encode {
+			return fmt.Sprint(m.EncodeTime.Seconds())
+		}
+		return fmt.Sprint(m.DecodeTime.Seconds())
+	})
+	family("frames_total", "counter", "USRP frames encoded and decoded.", func(m ConverterMetrics, encode bool) string {
+		if encode {
+			return fmt.Sprint(m.FramesIn)
+		}
+		return fmt.Sprint(m.FramesOut)
+	})
+	family("bytes_total", "counter", "Encoded bytes produced and decoded.", func(m ConverterMetrics, encode bool) string {
+		if encode {
+			return fmt.Sprint(m.BytesOut)
+		}
+		return fmt.Sprint(m.BytesIn)
+	})
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics page
+func (e *ConverterExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
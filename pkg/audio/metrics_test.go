@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+func TestMeteredConverter(t *testing.T) {
+	meter := NewConverterMeter()
+	factory := MeterFactory(func() (Converter, error) { return NewG711Converter(ULaw) }, meter)
+
+	// Two converters from the factory share the meter
+	var data []byte
+	for i := 0; i < 2; i++ {
+		converter, err := factory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = converter.USRPToFormat(usrp.NewSilenceFrame(1, true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := converter.FormatToUSRP(data); err != nil {
+			t.Fatal(err)
+		}
+		if health := converter.(HealthReporter).Health(); !health.Healthy {
+			t.Error("Pure Go converter reported unhealthy")
+		}
+		converter.Close()
+	}
+
+	got := meter.Metrics()
+	if got.EncodeCalls != 2 || got.DecodeCalls != 2 || got.FramesIn != 2 || got.FramesOut != 2 {
+		t.Errorf("Metrics = %+v", got)
+	}
+	if got.BytesOut != uint64(2*len(data)) || got.BytesIn != got.BytesOut {
+		t.Errorf("Counted %d bytes out and %d in, want %d", got.BytesOut, got.BytesIn, 2*len(data))
+	}
+	if got.EncodeLatency() != got.EncodeTime/2 {
+		t.Errorf("Encode time %v, latency %v", got.EncodeTime, got.EncodeLatency())
+	}
+
+	// A failed decode is counted as an error, not as frames
+	converter := NewMeteredConverter(mustG711(t), meter)
+	converter.Close()
+	converter.FormatToUSRP(data)
+	if m := converter.Metrics(); m.DecodeErrors != 1 || m.FramesOut != 2 {
+		t.Errorf("After a failed decode: %+v", m)
+	}
+}
+
+func TestConverterExporter(t *testing.T) {
+	meter := NewConverterMeter()
+	converter := NewMeteredConverter(mustG711(t), meter)
+	converter.USRPToFormat(usrp.NewSilenceFrame(1, true))
+
+	e := NewConverterExporter("usrp")
+	e.Register(`ulaw "pool"`, meter)
+
+	var b strings.Builder
+	if _, err := e.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE usrp_converter_calls_total counter",
+		`usrp_converter_calls_total{converter="ulaw \"pool\"",op="encode"} 1`,
+		`usrp_converter_calls_total{converter="ulaw \"pool\"",op="decode"} 0`,
+		`usrp_converter_frames_total{converter="ulaw \"pool\"",op="encode"} 1`,
+		`usrp_converter_bytes_total{converter="ulaw \"pool\"",op="encode"} 160`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output lacks %q:\n%s", want, out)
+		}
+	}
+
+	e.Unregister(`ulaw "pool"`)
+	b.Reset()
+	e.WriteTo(&b)
+	if strings.Contains(b.String(), "ulaw") {
+		t.Error("Unregistered converter still exported")
+	}
+}
+
+func mustG711(t *testing.T) Converter {
+	t.Helper()
+	converter, err := NewG711Converter(ULaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return converter
+}
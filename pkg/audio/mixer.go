@@ -0,0 +1,211 @@
+package audio
+
+import (
+	"sync"
+	"time"
+)
+
+// MixerConfig holds mixer settings
+type MixerConfig struct {
+	SampleRate int           `json:"sample_rate"` // Sample rate (8000 for USRP)
+	FrameSize  int           `json:"frame_size"`  // Samples per mixed frame (160 for USRP)
+	MaxQueue   int           `json:"max_queue"`   // Frames queued per source before the oldest are dropped
+	Ducking    float64       `json:"ducking"`     // How far sources below the highest active priority are turned down, in dB (0 = no ducking)
+	Attack     time.Duration `json:"attack"`      // How fast ducked sources are turned down
+	Release    time.Duration `json:"release"`     // How fast they come back once the priority source stops
+	Hold       time.Duration `json:"hold"`        // How long a source stays active after its last frame, so ducking does not pump between words
+}
+
+// DefaultMixerConfig returns a mixer of 20ms USRP frames ducking lower
+// priority sources by 20 dB, held for 500ms after the priority source
+// stops
+func DefaultMixerConfig() *MixerConfig {
+	return &MixerConfig{
+		SampleRate: 8000,
+		FrameSize:  160,
+		MaxQueue:   10,
+		Ducking:    20,
+		Attack:     20 * time.Millisecond,
+		Release:    300 * time.Millisecond,
+		Hold:       500 * time.Millisecond,
+	}
+}
+
+// MixerStats holds mixer counters
+type MixerStats struct {
+	Sources  int    `json:"sources"`  // Sources known now
+	Mixed    uint64 `json:"mixed"`    // Frames mixed
+	Ducked   uint64 `json:"ducked"`   // Source frames mixed while ducked
+	Overruns uint64 `json:"overruns"` // Source frames dropped from full queues
+}
+
+// mixerSource is one source's queue and gain
+type mixerSource struct {
+	priority int
+	queue    []int16
+	idle     int     // Frames mixed since this source last had audio
+	gain     float64 // Linear, moving toward 1 or the ducked gain
+}
+
+// Mixer sums audio from several sources into one stream of frames. When
+// sources of different priorities are active at once, such as net control
+// talking over a roundtable, the lower ones are ducked: turned down by
+// Ducking dB rather than muted, and brought back up smoothly once the
+// higher priority source has been quiet for Hold. Sources write frames
+// whenever they arrive, and Mix is called on the frame clock.
+type Mixer struct {
+	frameSize int
+	maxQueue  int
+	ducked    float64 // Linear gain of ducked sources
+	attack    float64 // Gain smoothing coefficients, per sample
+	release   float64
+	hold      int // Frames
+
+	sources map[string]*mixerSource
+	stats   MixerStats
+
+	mutex sync.Mutex
+}
+
+// NewMixer creates a mixer. A nil config uses DefaultMixerConfig.
+func NewMixer(config *MixerConfig) *Mixer {
+	defaults := DefaultMixerConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.FrameSize <= 0 {
+		cfg.FrameSize = defaults.FrameSize
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = defaults.MaxQueue
+	}
+	if cfg.Ducking < 0 {
+		cfg.Ducking = 0
+	}
+	if cfg.Attack <= 0 {
+		cfg.Attack = defaults.Attack
+	}
+	if cfg.Release <= 0 {
+		cfg.Release = defaults.Release
+	}
+
+	frame := time.Duration(cfg.FrameSize) * time.Second / time.Duration(cfg.SampleRate)
+	return &Mixer{
+		frameSize: cfg.FrameSize,
+		maxQueue:  cfg.MaxQueue,
+		ducked:    dbToLinear(-cfg.Ducking),
+		attack:    smoothing(cfg.Attack, cfg.SampleRate),
+		release:   smoothing(cfg.Release, cfg.SampleRate),
+		hold:      int((cfg.Hold + frame - 1) / frame),
+		sources:   make(map[string]*mixerSource),
+	}
+}
+
+// Write queues samples from a source at a priority; higher priorities duck
+// lower ones. A source's priority is the one it last wrote with.
+func (m *Mixer) Write(source string, priority int, samples []int16) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.sources[source]
+	if !ok {
+		s = &mixerSource{gain: 1, idle: m.hold + 1}
+		m.sources[source] = s
+	}
+	s.priority = priority
+	s.queue = append(s.queue, samples...)
+	if excess := len(s.queue) - m.maxQueue*m.frameSize; excess > 0 {
+		s.queue = s.queue[excess:]
+		m.stats.Overruns += uint64((excess + m.frameSize - 1) / m.frameSize)
+	}
+}
+
+// Mix returns the next frame: a frame from each source with audio queued,
+// each at its ducking gain, summed with saturation. Sources short of a
+// frame are padded with silence.
+func (m *Mixer) Mix() []int16 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// The highest priority active now, counting the hold
+	top, active := 0, false
+	for _, s := range m.sources {
+		if len(s.queue) > 0 || s.idle <= m.hold {
+			if !active || s.priority > top {
+				top, active = s.priority, true
+			}
+		}
+	}
+
+	mixed := make([]float64, m.frameSize)
+	for _, s := range m.sources {
+		target, coeff := 1.0, m.release
+		if s.priority < top {
+			target, coeff = m.ducked, m.attack
+		}
+
+		if len(s.queue) == 0 {
+			// Nothing to play, but the gain still moves, so a source that
+			// resumes mid-duck does not burst in at full level
+			s.idle++
+			for i := 0; i < m.frameSize; i++ {
+				s.gain = target + coeff*(s.gain-target)
+			}
+			continue
+		}
+
+		n := min(m.frameSize, len(s.queue))
+		for i := 0; i < m.frameSize; i++ {
+			s.gain = target + coeff*(s.gain-target)
+			if i < n {
+				mixed[i] += float64(s.queue[i]) * s.gain
+			}
+		}
+		s.queue = s.queue[n:]
+		s.idle = 0
+		if s.priority < top {
+			m.stats.Ducked++
+		}
+	}
+
+	frame := make([]int16, m.frameSize)
+	for i, x := range mixed {
+		frame[i] = clampInt16(x)
+	}
+	m.stats.Mixed++
+	return frame
+}
+
+// Active reports whether any source has audio queued or is within its
+// hold
+func (m *Mixer) Active() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, s := range m.sources {
+		if len(s.queue) > 0 || s.idle <= m.hold {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove forgets a source, such as a talker who has left
+func (m *Mixer) Remove(source string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sources, source)
+}
+
+// Stats returns a copy of the current counters
+func (m *Mixer) Stats() MixerStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.stats
+	stats.Sources = len(m.sources)
+	return stats
+}
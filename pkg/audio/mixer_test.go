@@ -0,0 +1,99 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+)
+
+func TestMixer_Ducking(t *testing.T) {
+	m := NewMixer(nil)
+	sine := signal.NewSine(440, 0.25, 8000)
+	tone := func() []int16 {
+		frame := make([]int16, 160)
+		sine.Fill(frame)
+		return frame
+	}
+	silence := make([]int16, 160)
+
+	// A roundtable alone plays at full level
+	var level float64
+	for i := 0; i < 10; i++ {
+		m.Write("roundtable", 1, tone())
+		level = rms(m.Mix())
+	}
+	full := rms(tone())
+	if math.Abs(level-full) > full*0.01 {
+		t.Fatalf("Expected the lone source at %.0f, got %.0f", full, level)
+	}
+
+	// Net control keying up ducks it by 20 dB, silent or not
+	for i := 0; i < 20; i++ {
+		m.Write("roundtable", 1, tone())
+		m.Write("netcontrol", 5, silence)
+		level = rms(m.Mix())
+	}
+	if got := 20 * math.Log10(level/full); math.Abs(got+20) > 1 {
+		t.Errorf("Expected the roundtable ducked by 20 dB, got %.1f dB", got)
+	}
+
+	// Still ducked through net control's hold, then back up
+	for i := 0; i < 10; i++ {
+		m.Write("roundtable", 1, tone())
+		level = rms(m.Mix())
+	}
+	if got := 20 * math.Log10(level/full); got > -15 {
+		t.Errorf("Expected the roundtable still ducked during the hold, got %.1f dB", got)
+	}
+	for i := 0; i < 100; i++ {
+		m.Write("roundtable", 1, tone())
+		level = rms(m.Mix())
+	}
+	if math.Abs(level-full) > full*0.01 {
+		t.Errorf("Expected the roundtable back at %.0f, got %.0f", full, level)
+	}
+
+	stats := m.Stats()
+	if stats.Sources != 2 || stats.Ducked < 20 || stats.Mixed != 140 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	m.Remove("netcontrol")
+	if stats := m.Stats(); stats.Sources != 1 {
+		t.Errorf("Expected 1 source after Remove, got %d", stats.Sources)
+	}
+}
+
+func TestMixer_Sum(t *testing.T) {
+	m := NewMixer(&MixerConfig{Ducking: 0, MaxQueue: 2})
+
+	// Equal priorities are summed as they are, saturating
+	loud := make([]int16, 160)
+	for i := range loud {
+		loud[i] = 30000
+	}
+	m.Write("a", 3, loud)
+	m.Write("b", 3, loud)
+	if frame := m.Mix(); frame[80] != math.MaxInt16 {
+		t.Errorf("Expected the sum to saturate, got %d", frame[80])
+	}
+
+	// A full queue drops its oldest frames
+	for i := 0; i < 5; i++ {
+		m.Write("a", 3, loud)
+	}
+	if stats := m.Stats(); stats.Overruns != 3 {
+		t.Errorf("Expected 3 overruns, got %d", stats.Overruns)
+	}
+
+	// Nothing queued and past the hold mixes to silence
+	for i := 0; i < 40; i++ {
+		m.Mix()
+	}
+	if m.Active() {
+		t.Error("Expected the mixer idle")
+	}
+	if frame := m.Mix(); rms(frame) != 0 {
+		t.Error("Expected silence from an idle mixer")
+	}
+}
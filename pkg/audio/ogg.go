@@ -0,0 +1,454 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/thesyncim/gopus"
+)
+
+// Ogg page layout (RFC 3533)
+const (
+	oggCapture       = "OggS"
+	oggHeaderSize    = 27   // Fixed header, before the segment table
+	oggFlagContinued = 0x01 // First packet continues from the previous page
+	oggFlagBOS       = 0x02 // First page of a logical stream
+	oggFlagEOS       = 0x04 // Last page of a logical stream
+)
+
+// oggCRCTable holds the Ogg CRC-32: polynomial 0x04C11DB7, unreflected, no
+// initial value or final XOR
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC adds data to a running Ogg checksum
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// OggDemuxer splits an Ogg stream into packets as it arrives, in chunks of
+// any size. It follows one logical stream, the first it sees, and after
+// that ends the next one (chained streams). Pages that fail their checksum are
+// skipped by scanning for the next capture pattern; a packet left
+// incomplete by a lost page is dropped.
+type OggDemuxer struct {
+	buf     []byte // Bytes not yet parsed into pages
+	serial  uint32 // Logical stream being followed
+	locked  bool   // A stream is being followed
+	lastSeq uint32 // Sequence number of the stream's previous page
+	partial []byte // Packet continuing onto the next page
+	midPkt  bool   // partial holds a packet in progress
+}
+
+// NewOggDemuxer creates an Ogg demuxer
+func NewOggDemuxer() *OggDemuxer {
+	return &OggDemuxer{}
+}
+
+// Feed adds stream data and returns the packets it completes
+func (d *OggDemuxer) Feed(data []byte) [][]byte {
+	d.buf = append(d.buf, data...)
+
+	var packets [][]byte
+	for {
+		start := bytes.Index(d.buf, []byte(oggCapture))
+		if start < 0 {
+			// Keep a possible partial capture pattern
+			keep := min(len(d.buf), len(oggCapture)-1)
+			d.buf = d.buf[:copy(d.buf, d.buf[len(d.buf)-keep:])]
+			return packets
+		}
+		d.buf = d.buf[:copy(d.buf, d.buf[start:])]
+
+		size, ok := d.pageSize()
+		if !ok {
+			return packets // Wait for the rest of the page
+		}
+		if size < 0 || !oggPageValid(d.buf[:size]) {
+			// Not a real page: resync past this capture pattern
+			d.buf = d.buf[:copy(d.buf, d.buf[1:])]
+			continue
+		}
+		packets = d.page(d.buf[:size], packets)
+		d.buf = d.buf[:copy(d.buf, d.buf[size:])]
+	}
+}
+
+// pageSize returns the length of the page at the start of the buffer, -1 if
+// the header is malformed, or false if more data is needed to tell
+func (d *OggDemuxer) pageSize() (int, bool) {
+	if len(d.buf) < oggHeaderSize {
+		return 0, false
+	}
+	if d.buf[4] != 0 {
+		return -1, true // Only version 0 exists
+	}
+	segments := int(d.buf[26])
+	if len(d.buf) < oggHeaderSize+segments {
+		return 0, false
+	}
+	size := oggHeaderSize + segments
+	for _, lace := range d.buf[oggHeaderSize : oggHeaderSize+segments] {
+		size += int(lace)
+	}
+	if len(d.buf) < size {
+		return 0, false
+	}
+	return size, true
+}
+
+// oggPageValid checks a page's CRC, which is computed with the CRC field
+// zeroed
+func oggPageValid(page []byte) bool {
+	crc := oggCRC(0, page[:22])
+	crc = oggCRC(crc, make([]byte, 4))
+	crc = oggCRC(crc, page[26:])
+	return crc == binary.LittleEndian.Uint32(page[22:26])
+}
+
+// page appends the packets completed by a verified page
+func (d *OggDemuxer) page(page []byte, packets [][]byte) [][]byte {
+	flags := page[5]
+	serial := binary.LittleEndian.Uint32(page[14:18])
+	seq := binary.LittleEndian.Uint32(page[18:22])
+
+	switch {
+	case !d.locked:
+		// Follow this stream, from its first page or from wherever we joined
+		d.serial, d.locked, d.midPkt = serial, true, false
+	case serial != d.serial:
+		return packets // Another multiplexed stream
+	case seq != d.lastSeq+1:
+		d.midPkt = false // Lost a page
+	}
+	d.lastSeq = seq
+
+	segments := int(page[26])
+	lacing := page[oggHeaderSize : oggHeaderSize+segments]
+	body := page[oggHeaderSize+segments:]
+
+	// A stale packet the page does not continue is dropped, and a
+	// continuation with nothing to continue is skipped to its end
+	continued := flags&oggFlagContinued != 0
+	if !continued || !d.midPkt {
+		d.partial = d.partial[:0]
+	}
+	skipping := continued && !d.midPkt
+
+	offset := 0
+	for _, lace := range lacing {
+		if !skipping {
+			d.partial = append(d.partial, body[offset:offset+int(lace)]...)
+		}
+		offset += int(lace)
+		if lace < 255 {
+			if !skipping {
+				packets = append(packets, bytes.Clone(d.partial))
+			}
+			d.partial = d.partial[:0]
+			skipping = false
+		}
+	}
+	d.midPkt = segments > 0 && lacing[segments-1] == 255 && !skipping
+
+	if flags&oggFlagEOS != 0 {
+		// Follow whichever stream starts next
+		d.locked, d.midPkt = false, false
+	}
+	return packets
+}
+
+// OggOpusDecoder decodes an Ogg/Opus stream (RFC 7845), as FFmpeg's "ogg"
+// and "opus" muxers write, into USRP voice frames in pure Go. Data may
+// arrive in chunks of any size. The encoder delay announced by OpusHead is
+// trimmed, and decoding may start mid-stream, without the header pages.
+type OggOpusDecoder struct {
+	demuxer *OggDemuxer
+	decoder *gopus.Decoder
+	decoded []int16
+	framer  *FrameAligner // Decoded samples not yet framed
+	preSkip int           // USRP samples still to discard
+}
+
+// NewOggOpusDecoder creates an Ogg/Opus decoder
+func NewOggOpusDecoder() (*OggOpusDecoder, error) {
+	// Always decode to mono; stereo streams are downmixed
+	decoder, err := gopus.NewDecoder(gopus.DefaultDecoderConfig(USRPSampleRate, 1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus decoder: %w", err)
+	}
+	return &OggOpusDecoder{
+		demuxer: NewOggDemuxer(),
+		decoder: decoder,
+		decoded: make([]int16, opusMaxFrame),
+		framer:  NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate),
+	}, nil
+}
+
+// Decode feeds Ogg data and returns the voice frames it completes. Samples
+// that do not fill a whole frame are kept for the next call.
+func (od *OggOpusDecoder) Decode(data []byte) ([]*usrp.VoiceMessage, error) {
+	for _, packet := range od.demuxer.Feed(data) {
+		switch {
+		case bytes.HasPrefix(packet, []byte("OpusHead")):
+			if len(packet) < 19 {
+				return nil, fmt.Errorf("OpusHead packet truncated to %d bytes", len(packet))
+			}
+			// Pre-skip counts 48 kHz samples
+			od.preSkip = int(binary.LittleEndian.Uint16(packet[10:12])) * USRPSampleRate / 48000
+			continue
+		case bytes.HasPrefix(packet, []byte("OpusTags")):
+			continue
+		}
+
+		n, err := od.decoder.DecodeInt16(packet, od.decoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Opus: %w", err)
+		}
+		pcm := od.decoded[:n]
+		skip := min(od.preSkip, len(pcm))
+		od.preSkip -= skip
+		od.framer.Write(pcm[skip:], time.Time{})
+	}
+	return od.framer.VoiceMessages(), nil
+}
+
+// Flush returns the samples not yet framed, padded into a last frame, and
+// resets the decoder to begin a new stream
+func (od *OggOpusDecoder) Flush() []*usrp.VoiceMessage {
+	od.framer.Flush()
+	messages := od.framer.VoiceMessages()
+	od.demuxer = NewOggDemuxer()
+	od.decoder.Reset()
+	od.preSkip = 0
+	return messages
+}
+
+// OggOpusConverter converts between USRP voice frames and an Ogg/Opus
+// stream. Encoding runs through FFmpeg; the stream is demuxed and decoded
+// in Go, since FFmpeg cannot be handed a live Ogg stream chunk by chunk and
+// answer each with its audio.
+type OggOpusConverter struct {
+	*StreamingConverter
+	decoder *OggOpusDecoder
+}
+
+// FormatToUSRP decodes Ogg/Opus stream data into USRP voice frames
+func (oc *OggOpusConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	return oc.decoder.Decode(data)
+}
+
+// Flush ends a transmission: FFmpeg finishes the Ogg stream, and a fresh
+// one starts with the next transmission
+func (oc *OggOpusConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+	final := oc.decoder.Flush()
+	tail, _, err := oc.flush()
+	return tail, final, err
+}
+
+// OggOpusWriterConfig holds Ogg/Opus recording settings
+type OggOpusWriterConfig struct {
+	BitRate int           // Opus bitrate (kbps)
+	MaxGap  time.Duration // Longest silence inserted for one gap
+}
+
+// DefaultOggOpusWriterConfig returns 24 kbps, ample for 8 kHz speech, with
+// gaps capped at 5s
+func DefaultOggOpusWriterConfig() *OggOpusWriterConfig {
+	return &OggOpusWriterConfig{
+		BitRate: 24,
+		MaxGap:  5 * time.Second,
+	}
+}
+
+// oggOpusPagePackets is how many 20 ms packets go in one page: a second,
+// so a recording cut short loses little. Large packets close a page early,
+// before its 255 lacing values run out.
+const oggOpusPagePackets = 50
+
+// OggOpusWriter records USRP voice frames to an Ogg/Opus file in pure Go,
+// for recordings a fraction of the size of WAV that any player opens. Like
+// a FLACWriter it records keyed frames in real time, filling gaps between
+// transmissions with silence. It needs no seeking, so it can also write to
+// a pipe or network stream.
+type OggOpusWriter struct {
+	w       io.Writer
+	config  *OggOpusWriterConfig
+	encoder *OpusNativeConverter
+	serial  uint32
+	seq     uint32   // Next page sequence number
+	packets [][]byte // Packets of the page being filled
+	lacing  int      // Lacing values they take
+	granule int64    // 48 kHz samples encoded, pre-skip included
+	preSkip int64
+	frames  int       // Frames recorded
+	lastEnd time.Time // When the last keyed frame finished playing
+	closed  bool
+}
+
+// NewOggOpusWriter starts an Ogg/Opus recording on w, writing the OpusHead
+// and OpusTags header pages. A nil config uses DefaultOggOpusWriterConfig.
+func NewOggOpusWriter(w io.Writer, config *OggOpusWriterConfig) (*OggOpusWriter, error) {
+	if config == nil {
+		config = DefaultOggOpusWriterConfig()
+	}
+	encoder, err := NewOpusNativeConverter(&ConverterConfig{BitRate: config.BitRate})
+	if err != nil {
+		return nil, err
+	}
+
+	ow := &OggOpusWriter{
+		w:       w,
+		config:  config,
+		encoder: encoder,
+		serial:  uint32(time.Now().UnixNano()),
+		preSkip: int64(encoder.encoder.Lookahead() * 48000 / USRPSampleRate),
+	}
+
+	// OpusHead (RFC 7845 5.1): version 1, mono, pre-skip, the input rate
+	// and no gain or channel mapping
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8], head[9] = 1, 1
+	binary.LittleEndian.PutUint16(head[10:], uint16(ow.preSkip))
+	binary.LittleEndian.PutUint32(head[12:], USRPSampleRate)
+	if err := ow.page(oggFlagBOS, 0, [][]byte{head}); err != nil {
+		return nil, err
+	}
+
+	// OpusTags: the vendor string and no comments
+	vendor := "usrp-go"
+	tags := make([]byte, 0, 16+len(vendor))
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+	if err := ow.page(0, 0, [][]byte{tags}); err != nil {
+		return nil, err
+	}
+
+	ow.granule = ow.preSkip
+	return ow, nil
+}
+
+// WriteMessage records one voice frame that arrived at the given time. Time
+// missing between keyed frames is filled with silence; a zero time records
+// the frame back to back with the previous one.
+func (ow *OggOpusWriter) WriteMessage(msg *usrp.VoiceMessage, at time.Time) error {
+	if ow.closed {
+		return fmt.Errorf("Ogg/Opus writer is closed")
+	}
+	if !msg.Header.IsPTT() {
+		return nil
+	}
+
+	if !at.IsZero() && !ow.lastEnd.IsZero() {
+		// Allow a frame of jitter before calling it a gap
+		if gap := at.Sub(ow.lastEnd); gap > voiceFrameDuration {
+			silence := usrp.NewSilenceFrame(0, true)
+			for range int(min(gap, ow.config.MaxGap) / voiceFrameDuration) {
+				if err := ow.write(silence); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if !at.IsZero() {
+		ow.lastEnd = at.Add(voiceFrameDuration)
+	}
+	return ow.write(msg)
+}
+
+// write encodes one frame, writing out each page as it fills
+func (ow *OggOpusWriter) write(msg *usrp.VoiceMessage) error {
+	packet, err := ow.encoder.USRPToFormat(msg)
+	if err != nil {
+		return err
+	}
+	ow.frames++
+	ow.granule += 960 // 20 ms at 48 kHz
+	ow.packets = append(ow.packets, packet)
+	ow.lacing += len(packet)/255 + 1
+	if len(ow.packets) < oggOpusPagePackets && ow.lacing <= 255-opusMaxPacket/255-1 {
+		return nil
+	}
+	err = ow.page(0, ow.granule, ow.packets)
+	ow.packets, ow.lacing = ow.packets[:0], 0
+	return err
+}
+
+// page writes packets as one page, ending at granule
+func (ow *OggOpusWriter) page(flags byte, granule int64, packets [][]byte) error {
+	page := make([]byte, oggHeaderSize)
+	copy(page, oggCapture)
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:], ow.serial)
+	binary.LittleEndian.PutUint32(page[18:], ow.seq)
+	for _, packet := range packets {
+		for n := len(packet); ; n -= 255 {
+			page = append(page, byte(min(n, 255)))
+			if n < 255 {
+				break
+			}
+		}
+	}
+	page[26] = byte(len(page) - oggHeaderSize)
+	for _, packet := range packets {
+		page = append(page, packet...)
+	}
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(0, page))
+
+	ow.seq++
+	if _, err := ow.w.Write(page); err != nil {
+		return fmt.Errorf("failed to write Ogg page: %w", err)
+	}
+	return nil
+}
+
+// Duration returns the length of audio recorded so far
+func (ow *OggOpusWriter) Duration() time.Duration {
+	return time.Duration(ow.frames) * voiceFrameDuration
+}
+
+// Close writes the last page, marked as the end of the stream. It does not
+// close the underlying writer.
+func (ow *OggOpusWriter) Close() error {
+	if ow.closed {
+		return nil
+	}
+	ow.closed = true
+	defer ow.encoder.Close()
+	return ow.page(oggFlagEOS, ow.granule, ow.packets)
+}
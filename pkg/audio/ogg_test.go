@@ -0,0 +1,206 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+var _ Converter = (*OggOpusConverter)(nil)
+
+// oggPage builds a page with the given lacing values and body
+func oggPage(flags byte, serial, seq uint32, lacing, body []byte) []byte {
+	page := make([]byte, oggHeaderSize, oggHeaderSize+len(lacing)+len(body))
+	copy(page, oggCapture)
+	page[5] = flags
+	binary.LittleEndian.PutUint32(page[14:], serial)
+	binary.LittleEndian.PutUint32(page[18:], seq)
+	page[26] = byte(len(lacing))
+	page = append(append(page, lacing...), body...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(0, page))
+	return page
+}
+
+// lace returns the lacing values of a packet
+func lace(packet []byte) []byte {
+	lacing := bytes.Repeat([]byte{255}, len(packet)/255)
+	return append(lacing, byte(len(packet)%255))
+}
+
+// oggStream muxes packets into a stream, perPage packets to a page
+func oggStream(serial uint32, packets [][]byte, perPage int) []byte {
+	var stream []byte
+	var seq uint32
+	for start := 0; start < len(packets); start += perPage {
+		var lacing, body []byte
+		for _, packet := range packets[start:min(start+perPage, len(packets))] {
+			lacing = append(lacing, lace(packet)...)
+			body = append(body, packet...)
+		}
+		var flags byte
+		if start+perPage >= len(packets) {
+			flags = oggFlagEOS
+		}
+		stream = append(stream, oggPage(flags, serial, seq, lacing, body)...)
+		seq++
+	}
+	return stream
+}
+
+// opusHead returns an OpusHead packet announcing preSkip 48 kHz samples
+func opusHead(preSkip uint16) []byte {
+	head := []byte("OpusHead\x01\x01\x00\x00\x80\xbb\x00\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	return head
+}
+
+func TestOggDemuxer_Packets(t *testing.T) {
+	short := []byte("hello")
+	long := bytes.Repeat([]byte{0xAB}, 600)
+	empty := []byte{}
+
+	// The long packet spans pages: 255+255 on the first, 90 on the second
+	stream := oggPage(oggFlagBOS, 7, 0, append(lace(short), 255, 255), append(short, long[:510]...))
+	stream = append(stream, oggPage(oggFlagContinued, 7, 1, []byte{90, 0}, long[510:])...)
+	// Another stream's pages are ignored
+	stream = append(stream, oggPage(oggFlagBOS, 8, 0, lace(short), short)...)
+
+	// Garbage, then a corrupt page, before the stream resumes
+	corrupt := oggPage(0, 7, 2, lace(short), short)
+	corrupt[len(corrupt)-1] ^= 0xFF
+	stream = append(stream, []byte("noiseOggSnoise")...)
+	stream = append(stream, corrupt...)
+	stream = append(stream, oggPage(0, 7, 2, lace(short), short)...)
+
+	// Fed a byte at a time, as arrives off a slow socket
+	demuxer := NewOggDemuxer()
+	var packets [][]byte
+	for i := range stream {
+		packets = append(packets, demuxer.Feed(stream[i:i+1])...)
+	}
+
+	want := [][]byte{short, long, empty, short}
+	if len(packets) != len(want) {
+		t.Fatalf("Expected %d packets, got %d", len(want), len(packets))
+	}
+	for i := range want {
+		if !bytes.Equal(packets[i], want[i]) {
+			t.Errorf("Packet %d: got %d bytes, want %d", i, len(packets[i]), len(want[i]))
+		}
+	}
+}
+
+func TestOggDemuxer_LostPage(t *testing.T) {
+	long := bytes.Repeat([]byte{0xCD}, 300)
+	next := []byte("next")
+
+	// The page finishing the long packet is lost, so it is dropped and the
+	// rest of the continuation on page 2 is skipped up to the next packet
+	stream := oggPage(0, 3, 0, []byte{255}, long[:255])
+	stream = append(stream, oggPage(oggFlagContinued, 3, 2, []byte{45, 4}, append(long[255:], next...))...)
+
+	packets := NewOggDemuxer().Feed(stream)
+	if len(packets) != 1 || !bytes.Equal(packets[0], next) {
+		t.Errorf("Expected only the packet after the loss, got %q", packets)
+	}
+}
+
+func TestOggOpusDecoder(t *testing.T) {
+	encoder, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+
+	packets := [][]byte{opusHead(312), []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00")}
+	for i := 0; i < 50; i++ {
+		packet, err := encoder.USRPToFormat(toneFrame(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+	}
+	stream := oggStream(1234, packets, 10)
+
+	decoder, err := NewOggOpusDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []*usrp.VoiceMessage
+	for len(stream) > 0 {
+		chunk := stream[:min(len(stream), 333)]
+		stream = stream[len(chunk):]
+		decoded, err := decoder.Decode(chunk)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		messages = append(messages, decoded...)
+	}
+
+	// 8000 samples, less the 52 sample pre-skip, make 49 whole frames
+	if len(messages) != 49 {
+		t.Fatalf("Expected 49 frames, got %d", len(messages))
+	}
+	if level := rms(messages[len(messages)-1].AudioData[:]); level < 2000 {
+		t.Errorf("Decoded tone is too quiet: RMS %.0f", level)
+	}
+
+	if _, err := decoder.Decode(oggStream(1, [][]byte{[]byte("OpusHead")}, 1)); err == nil {
+		t.Error("Expected error for a truncated OpusHead")
+	}
+}
+
+func TestOggOpusWriter(t *testing.T) {
+	var file bytes.Buffer
+	writer, err := NewOggOpusWriter(&file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second of tone, 100ms of silence between transmissions, another
+	// second of tone
+	start := time.Unix(1000, 0)
+	for i := 0; i < 50; i++ {
+		msg := toneFrame(i)
+		msg.Header.SetPTT(true)
+		if err := writer.WriteMessage(msg, start.Add(time.Duration(i)*voiceFrameDuration)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resume := start.Add(1100 * time.Millisecond)
+	for i := 0; i < 50; i++ {
+		msg := toneFrame(i)
+		msg.Header.SetPTT(true)
+		if err := writer.WriteMessage(msg, resume.Add(time.Duration(i)*voiceFrameDuration)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := writer.Duration(); d != 2100*time.Millisecond {
+		t.Errorf("Duration %v, want 2.1s", d)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := NewOggOpusDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := decoder.Decode(file.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages = append(messages, decoder.Flush()...)
+	if len(messages) != 105 {
+		t.Fatalf("Decoded %d frames, want 105", len(messages))
+	}
+	if level := rms(messages[52].AudioData[:]); level > 200 {
+		t.Errorf("Gap decoded at RMS %.0f, want silence", level)
+	}
+	if level := rms(messages[80].AudioData[:]); level < 2000 {
+		t.Errorf("Decoded tone is too quiet: RMS %.0f", level)
+	}
+}
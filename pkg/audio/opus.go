@@ -0,0 +1,256 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/thesyncim/gopus"
+)
+
+// opusMaxPacket is the largest Opus packet the encoder may produce
+// (RFC 6716 3.2.1 caps one frame at 1275 bytes)
+const opusMaxPacket = 1275
+
+// opusMaxFrame is the longest Opus packet duration (120 ms) in USRP samples
+const opusMaxFrame = 960
+
+// IsOpusSilence reports whether packet is a silence marker: the 1-byte,
+// TOC-only packet an Opus encoder with DTX sends in place of a frame when
+// there is nothing to say. Senders may drop markers to save bandwidth;
+// receivers fill them with comfort noise.
+func IsOpusSilence(packet []byte) bool {
+	return len(packet) == 1
+}
+
+// OpusNativeConverter converts between USRP voice frames and raw Opus
+// packets in pure Go, without FFmpeg. Each USRP frame becomes one 20 ms
+// Opus packet; decoded packets of any duration are re-framed into 160
+// sample USRP frames.
+//
+// Unlike the FFmpeg "opus" converter, which emits an Ogg stream, it speaks
+// bare Opus packets, the form RTP, WebRTC and Discord voice carry.
+type OpusNativeConverter struct {
+	encoder *gopus.Encoder
+	decoder *gopus.Decoder
+	upmix   *ChannelMatrix              // USRP mono to the encoder's channels
+	noise   *usrp.ComfortNoiseGenerator // Fills silence markers; nil for digital silence
+
+	packet    []byte        // Encoder output buffer
+	pcm       []int16       // Encoder input, interleaved when stereo
+	decoded   []int16       // Decoder output
+	recovered []float32     // FEC decoder output
+	framer    *FrameAligner // Decoded samples not yet framed
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewOpusNativeConverter creates a pure Go Opus converter. Only Channels,
+// BitRate (kbps), PacketLoss, DTX and ComfortNoise of config are used: the
+// USRP side is always 8 kHz mono, and Opus packets decode at any rate. A
+// nil config uses mono at 64 kbps without FEC or DTX, as NewOpusConverter
+// does.
+//
+// With PacketLoss set, each packet also carries a low bitrate copy of the
+// one before (in-band FEC), sized for that much loss, which RecoverPacket
+// decodes when the earlier packet goes missing. With DTX set, pauses
+// between words are encoded as silence markers (see IsOpusSilence) after
+// the encoder has heard about 200ms of silence.
+func NewOpusNativeConverter(config *ConverterConfig) (*OpusNativeConverter, error) {
+	channels, bitRate, packetLoss := 1, 64, 0
+	var noise *usrp.ComfortNoiseGenerator
+	if config != nil {
+		if config.Channels > 0 {
+			channels = config.Channels
+		}
+		if config.BitRate > 0 {
+			bitRate = config.BitRate
+		}
+		if config.PacketLoss < 0 || config.PacketLoss > 100 {
+			return nil, fmt.Errorf("opus packet loss must be 0-100%%, got %d", config.PacketLoss)
+		}
+		packetLoss = config.PacketLoss
+		if config.ComfortNoise < 0 {
+			noise = usrp.NewComfortNoiseGenerator(config.ComfortNoise, time.Now().UnixNano())
+		}
+		if config.FrameSize != 0 && config.FrameSize != 20*time.Millisecond {
+			return nil, fmt.Errorf("native Opus frames must be 20ms to match USRP, got %v", config.FrameSize)
+		}
+	}
+
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{
+		SampleRate:  USRPSampleRate,
+		Channels:    channels,
+		Application: gopus.ApplicationVoIP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus encoder: %w", err)
+	}
+	upmix, err := DefaultChannelMatrix(1, channels)
+	if err != nil {
+		return nil, err
+	}
+	if err := encoder.SetBitrate(bitRate * 1000); err != nil {
+		return nil, fmt.Errorf("failed to set Opus bitrate: %w", err)
+	}
+	if packetLoss > 0 {
+		encoder.SetFEC(true)
+		if err := encoder.SetPacketLoss(packetLoss); err != nil {
+			return nil, fmt.Errorf("failed to set Opus packet loss: %w", err)
+		}
+	}
+	if config != nil && config.DTX {
+		encoder.SetDTX(true)
+	}
+
+	// Always decode to mono; stereo packets are downmixed
+	decoder, err := gopus.NewDecoder(gopus.DefaultDecoderConfig(USRPSampleRate, 1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus decoder: %w", err)
+	}
+
+	return &OpusNativeConverter{
+		encoder:   encoder,
+		decoder:   decoder,
+		upmix:     upmix,
+		noise:     noise,
+		packet:    make([]byte, opusMaxPacket),
+		pcm:       make([]int16, usrp.VoiceFrameSize*channels),
+		decoded:   make([]int16, opusMaxFrame),
+		recovered: make([]float32, usrp.VoiceFrameSize),
+		framer:    NewFrameAligner(usrp.VoiceFrameSize, USRPSampleRate),
+	}, nil
+}
+
+// USRPToFormat encodes one USRP voice frame as an Opus packet
+func (oc *OpusNativeConverter) USRPToFormat(voiceMsg *usrp.VoiceMessage) ([]byte, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	// Stereo carries the mono frame on both channels
+	oc.pcm = oc.upmix.Mix(oc.pcm[:0], voiceMsg.AudioData[:])
+
+	n, err := oc.encoder.EncodeInt16(oc.pcm, oc.packet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Opus: %w", err)
+	}
+
+	// The packet buffer is reused; hand out a copy
+	out := make([]byte, n)
+	copy(out, oc.packet[:n])
+	return out, nil
+}
+
+// FormatToUSRP decodes one Opus packet into USRP voice frames. Samples that
+// do not fill a whole frame are kept for the next packet. A nil packet
+// conceals one lost packet; a silence marker decodes to comfort noise.
+func (oc *OpusNativeConverter) FormatToUSRP(data []byte) ([]*usrp.VoiceMessage, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+
+	n, err := oc.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	oc.framer.Write(oc.decoded[:n], time.Time{})
+	return oc.framer.VoiceMessages(), nil
+}
+
+// DecodePacket decodes one Opus packet to 8 kHz mono samples. With
+// RecoverPacket it makes the converter a PacketDecoder, so a JitterBuffer
+// of Opus packets decodes them in order and recovers losses with FEC; do
+// not mix it with FormatToUSRP on the same converter.
+func (oc *OpusNativeConverter) DecodePacket(packet []byte) ([]int16, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	n, err := oc.decode(packet)
+	if err != nil {
+		return nil, err
+	}
+	return append([]int16(nil), oc.decoded[:n]...), nil
+}
+
+// decode decodes packet into oc.decoded, filling silence markers with
+// comfort noise rather than the decoder's own rendering of them. Must be
+// called with the mutex held.
+func (oc *OpusNativeConverter) decode(packet []byte) (int, error) {
+	n, err := oc.decoder.DecodeInt16(packet, oc.decoded)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode Opus: %w", err)
+	}
+	if IsOpusSilence(packet) {
+		clear(oc.decoded[:n])
+		if oc.noise != nil {
+			oc.noise.Fill(oc.decoded[:n])
+		}
+	}
+	return n, nil
+}
+
+// RecoverPacket returns 20ms in place of a lost packet: decoded from the
+// FEC data in next, the packet after it, when that carries any, and
+// otherwise concealed by the decoder (PLC)
+func (oc *OpusNativeConverter) RecoverPacket(next []byte) ([]int16, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, fmt.Errorf("converter is closed")
+	}
+	if next == nil {
+		n, err := oc.decoder.DecodeInt16(nil, oc.decoded[:usrp.VoiceFrameSize])
+		if err != nil {
+			return nil, fmt.Errorf("failed to conceal Opus packet: %w", err)
+		}
+		return append([]int16(nil), oc.decoded[:n]...), nil
+	}
+
+	n, err := oc.decoder.DecodeWithFEC(next, oc.recovered, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover Opus packet: %w", err)
+	}
+	frame := make([]int16, n)
+	for i, x := range oc.recovered[:n] {
+		frame[i] = clampInt16(float64(x) * 32768)
+	}
+	return frame, nil
+}
+
+// Flush ends a transmission: decoded samples short of a frame are padded
+// into a last frame and both codecs are reset. Packets are encoded whole,
+// so there is no encoder tail.
+func (oc *OpusNativeConverter) Flush() ([]byte, []*usrp.VoiceMessage, error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if oc.closed {
+		return nil, nil, fmt.Errorf("converter is closed")
+	}
+	oc.encoder.Reset()
+	oc.decoder.Reset()
+	oc.framer.Flush()
+	return nil, oc.framer.VoiceMessages(), nil
+}
+
+// Close releases the converter; there are no external processes to stop
+func (oc *OpusNativeConverter) Close() error {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	oc.closed = true
+	return nil
+}
@@ -0,0 +1,284 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+	"github.com/thesyncim/gopus"
+)
+
+var _ Converter = (*OpusNativeConverter)(nil)
+
+// toneFrame returns USRP frame n of a continuous 440 Hz tone
+func toneFrame(n int) *usrp.VoiceMessage {
+	msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, uint32(n))}
+	for i := range msg.AudioData {
+		msg.AudioData[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(n*usrp.VoiceFrameSize+i)/USRPSampleRate))
+	}
+	return msg
+}
+
+// rms returns the root mean square of a frame
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestOpusNativeConverter_RoundTrip(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		converter, err := NewOpusNativeConverter(&ConverterConfig{Channels: channels, BitRate: 32})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var frames []*usrp.VoiceMessage
+		for n := 0; n < 25; n++ {
+			packet, err := converter.USRPToFormat(toneFrame(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packet) == 0 || len(packet) > opusMaxPacket {
+				t.Fatalf("packet of %d bytes", len(packet))
+			}
+			decoded, err := converter.FormatToUSRP(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, decoded...)
+		}
+		if len(frames) != 25 {
+			t.Fatalf("%d channels: decoded %d frames, want 25", channels, len(frames))
+		}
+
+		// Past the codec's start-up, the tone comes back at about its level
+		want := rms(toneFrame(0).AudioData[:])
+		if got := rms(frames[20].AudioData[:]); got < want*0.7 || got > want*1.3 {
+			t.Errorf("%d channels: decoded level %.0f, want about %.0f", channels, got, want)
+		}
+		converter.Close()
+	}
+}
+
+func TestOpusNativeConverter_Reframes(t *testing.T) {
+	converter, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	// A 60 ms packet from another encoder yields three USRP frames, and a
+	// 10 ms one is held until a second completes a frame
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{SampleRate: USRPSampleRate, Channels: 1, Application: gopus.ApplicationVoIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := make([]byte, opusMaxPacket)
+	encode := func(samples int) []byte {
+		if err := encoder.SetFrameSize(samples); err != nil {
+			t.Fatal(err)
+		}
+		n, err := encoder.EncodeInt16(make([]int16, samples), packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), packet[:n]...)
+	}
+
+	frames, err := converter.FormatToUSRP(encode(480))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("60ms packet gave %d frames, want 3", len(frames))
+	}
+	if frames[1].Header.Seq != frames[0].Header.Seq+1 || frames[2].Header.Seq != frames[1].Header.Seq+1 {
+		t.Fatal("frames are not numbered consecutively")
+	}
+
+	for i, want := range []int{0, 1} {
+		frames, err = converter.FormatToUSRP(encode(80))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != want {
+			t.Fatalf("10ms packet %d gave %d frames, want %d", i, len(frames), want)
+		}
+	}
+
+	// A lost packet is concealed
+	if _, err := converter.FormatToUSRP(nil); err != nil {
+		t.Fatalf("concealment: %v", err)
+	}
+}
+
+func TestOpusNativeConverter_Errors(t *testing.T) {
+	if _, err := NewOpusNativeConverter(&ConverterConfig{Channels: 3}); err == nil {
+		t.Error("3 channels accepted")
+	}
+	if _, err := NewOpusNativeConverter(&ConverterConfig{PacketLoss: 101}); err == nil {
+		t.Error("101% packet loss accepted")
+	}
+
+	converter, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := converter.FormatToUSRP([]byte{0xff, 0xff, 0xff}); err == nil {
+		t.Error("garbage packet decoded")
+	}
+
+	converter.Close()
+	if _, err := converter.USRPToFormat(toneFrame(0)); err == nil {
+		t.Error("closed converter encoded")
+	}
+}
+
+func TestOpusNativeConverter_FEC(t *testing.T) {
+	var _ PacketDecoder = (*OpusNativeConverter)(nil)
+
+	encoder, err := NewOpusNativeConverter(&ConverterConfig{BitRate: 32, PacketLoss: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	decoder, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	jb := NewJitterBuffer(nil)
+	jb.SetDecoder(decoder)
+	start := time.Now()
+	frame := jb.FrameDuration()
+
+	// Packet 30 is lost on the way; the buffer rebuilds it from the FEC
+	// copy in packet 31
+	var played [][]int16
+	for n := 0; n < 50; n++ {
+		packet, err := encoder.USRPToFormat(toneFrame(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := start.Add(time.Duration(n) * frame)
+		if n != 30 {
+			jb.PushPacket(uint32(n), packet, now)
+		}
+		if samples, ok := jb.Pop(now); ok {
+			played = append(played, samples)
+		}
+	}
+
+	stats := jb.Stats()
+	if stats.Lost != 1 || stats.Concealed != 1 {
+		t.Fatalf("Lost %d, concealed %d, want 1 and 1", stats.Lost, stats.Concealed)
+	}
+	want := rms(toneFrame(0).AudioData[:])
+	for i, samples := range played[20:] {
+		if got := rms(samples); got < want*0.5 {
+			t.Errorf("Frame %d: level %.0f, want about %.0f", i+20, got, want)
+		}
+	}
+}
+
+func TestOpusNativeConverter_DTX(t *testing.T) {
+	encoder, err := NewOpusNativeConverter(&ConverterConfig{BitRate: 32, DTX: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	decoder, err := NewOpusNativeConverter(&ConverterConfig{ComfortNoise: -50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	// A second of speech, then a second of silence
+	markers := 0
+	for n := 0; n < 100; n++ {
+		frame := toneFrame(n)
+		if n >= 50 {
+			frame = usrp.NewSilenceFrame(uint32(n), true)
+		}
+		packet, err := encoder.USRPToFormat(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsOpusSilence(packet) {
+			continue // Speech, or the refresh frames DTX still sends
+		}
+		if n < 50 {
+			t.Fatalf("Frame %d of speech sent as silence", n)
+		}
+		markers++
+
+		decoded, err := decoder.FormatToUSRP(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range decoded {
+			level := 20 * math.Log10(rms(msg.AudioData[:])/32768)
+			if level < -53 || level > -47 {
+				t.Errorf("Silence marker filled at %.1f dBFS, want about -50", level)
+			}
+		}
+	}
+	if markers < 30 {
+		t.Errorf("Only %d of 50 silent frames sent as markers", markers)
+	}
+
+	// Without comfort noise, markers decode to digital silence
+	plain, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	samples, err := plain.DecodePacket([]byte{0x08})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != usrp.VoiceFrameSize || rms(samples) != 0 {
+		t.Errorf("Silence marker decoded to %d samples at level %.0f", len(samples), rms(samples))
+	}
+}
+
+func TestOpusNativeConverter_Flush(t *testing.T) {
+	converter, err := NewOpusNativeConverter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{SampleRate: USRPSampleRate, Channels: 1, Application: gopus.ApplicationVoIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.SetFrameSize(80); err != nil {
+		t.Fatal(err)
+	}
+	packet := make([]byte, opusMaxPacket)
+	n, err := encoder.EncodeInt16(make([]int16, 80), packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A 10 ms packet is half a frame; unkey pads it into a whole one
+	if frames, _ := converter.FormatToUSRP(packet[:n]); len(frames) != 0 {
+		t.Fatalf("10ms packet gave %d frames, want 0", len(frames))
+	}
+	tail, final, err := converter.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tail != nil || len(final) != 1 {
+		t.Fatalf("Expected no tail and one final frame, got %d bytes and %d frames", len(tail), len(final))
+	}
+	if frames, _ := converter.FormatToUSRP(packet[:n]); len(frames) != 0 {
+		t.Errorf("Flushed samples carried over: %d frames", len(frames))
+	}
+}
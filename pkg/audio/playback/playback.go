@@ -0,0 +1,281 @@
+// Package playback plays announcements into a USRP stream: station IDs,
+// net preambles, connect and disconnect confirmations. Audio files and
+// generated tones are queued as clips and sent as keyed 20ms voice frames,
+// numbered in sequence, paced in real time and ended with an unkey, as a
+// node's own transmissions would be.
+package playback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// Clip is audio to play: 8 kHz mono samples and a name for logs
+type Clip struct {
+	Name    string
+	Samples []int16
+}
+
+// LoadFile reads an audio file as a clip. WAV and Ogg/Opus files are
+// decoded in Go; anything else is handed to FFmpeg.
+func LoadFile(path string) (*Clip, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".opus" || ext == ".ogg" {
+		if samples, err := decodeOggOpus(path); err == nil {
+			return &Clip{Name: filepath.Base(path), Samples: samples}, nil
+		}
+		// Fall through to FFmpeg for Ogg/Vorbis and the like
+	}
+
+	samples, err := audio.DecodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Clip{Name: filepath.Base(path), Samples: samples}, nil
+}
+
+// decodeOggOpus decodes a whole Ogg/Opus file
+func decodeOggOpus(path string) ([]int16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	decoder, err := audio.NewOggOpusDecoder()
+	if err != nil {
+		return nil, err
+	}
+	frames, err := decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	frames = append(frames, decoder.Flush()...)
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no Opus audio in %s", path)
+	}
+
+	samples := make([]int16, 0, len(frames)*usrp.VoiceFrameSize)
+	for _, frame := range frames {
+		samples = append(samples, frame.AudioData[:]...)
+	}
+	return samples, nil
+}
+
+// ToneClip renders a tone sequence, such as a courtesy tone or DTMF
+// digits, as a clip
+func ToneClip(name string, sequence tones.Sequence) (*Clip, error) {
+	samples, err := sequence.Render(audio.USRPSampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &Clip{Name: name, Samples: samples}, nil
+}
+
+// Config holds player settings
+type Config struct {
+	TalkGroup uint32        `json:"talkgroup"` // Talkgroup of the frames sent
+	Lead      time.Duration `json:"lead"`      // Keyed silence before the audio, so the far end's receivers have opened
+	Tail      time.Duration `json:"tail"`      // Keyed silence after it, before the unkey
+	Gap       time.Duration `json:"gap"`       // Unkeyed pause between announcements
+	MaxQueue  int           `json:"max_queue"` // Announcements waiting before Enqueue refuses more
+}
+
+// DefaultConfig returns 100ms of lead-in, no tail, a second between
+// announcements and up to 10 waiting
+func DefaultConfig() *Config {
+	return &Config{
+		Lead:     100 * time.Millisecond,
+		Gap:      time.Second,
+		MaxQueue: 10,
+	}
+}
+
+// Stats holds player counters
+type Stats struct {
+	Queued  int    `json:"queued"`  // Announcements waiting now
+	Played  uint64 `json:"played"`  // Announcements played
+	Frames  uint64 `json:"frames"`  // Voice frames sent
+	Dropped uint64 `json:"dropped"` // Announcements refused with the queue full, or cleared
+	Errors  uint64 `json:"errors"`  // Frames the send function failed
+}
+
+// Player queues announcements and plays them one after another. Each
+// announcement is one transmission: its clips back to back between the
+// lead and the tail, then an unkey. Enqueue from anywhere; Run sends.
+type Player struct {
+	send    func(*usrp.VoiceMessage) error
+	config  Config
+	queue   chan []*Clip
+	seq     uint32
+	playing bool
+
+	stats Stats
+	mutex sync.Mutex
+}
+
+// NewPlayer creates a player that sends frames through send, such as a
+// connection's SendMessage. A nil config uses DefaultConfig.
+func NewPlayer(send func(*usrp.VoiceMessage) error, config *Config) *Player {
+	defaults := DefaultConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.Lead < 0 {
+		cfg.Lead = 0
+	}
+	if cfg.Tail < 0 {
+		cfg.Tail = 0
+	}
+	if cfg.Gap < 0 {
+		cfg.Gap = 0
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = defaults.MaxQueue
+	}
+
+	return &Player{
+		send:   send,
+		config: cfg,
+		queue:  make(chan []*Clip, cfg.MaxQueue),
+	}
+}
+
+// Enqueue queues clips to play as one announcement, such as a spoken ID
+// followed by a courtesy tone. It fails rather than blocks when the queue
+// is full.
+func (p *Player) Enqueue(clips ...*Clip) error {
+	if len(clips) == 0 {
+		return fmt.Errorf("nothing to play")
+	}
+	select {
+	case p.queue <- clips:
+		return nil
+	default:
+		p.mutex.Lock()
+		p.stats.Dropped++
+		p.mutex.Unlock()
+		return fmt.Errorf("playback queue full (%d announcements)", cap(p.queue))
+	}
+}
+
+// Clear drops the announcements waiting. One playing now finishes.
+func (p *Player) Clear() {
+	for {
+		select {
+		case <-p.queue:
+			p.mutex.Lock()
+			p.stats.Dropped++
+			p.mutex.Unlock()
+		default:
+			return
+		}
+	}
+}
+
+// Busy reports whether an announcement is playing or waiting, so callers
+// can hold off traffic of their own
+func (p *Player) Busy() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.playing || len(p.queue) > 0
+}
+
+// Run plays queued announcements until the context is cancelled. An
+// announcement cut off by cancellation is still unkeyed.
+func (p *Player) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case clips := <-p.queue:
+			p.mutex.Lock()
+			p.playing = true
+			p.mutex.Unlock()
+
+			err := p.play(ctx, clips)
+
+			p.mutex.Lock()
+			p.playing = false
+			p.stats.Played++
+			p.mutex.Unlock()
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.config.Gap):
+			}
+		}
+	}
+}
+
+// play sends one announcement, a frame per 20ms tick
+func (p *Player) play(ctx context.Context, clips []*Clip) error {
+	lead := int(p.config.Lead / (20 * time.Millisecond))
+	tail := int(p.config.Tail / (20 * time.Millisecond))
+	samples := make([]int16, lead*usrp.VoiceFrameSize)
+	for _, clip := range clips {
+		samples = append(samples, clip.Samples...)
+	}
+	samples = append(samples, make([]int16, tail*usrp.VoiceFrameSize)...)
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for offset := 0; offset < len(samples); offset += usrp.VoiceFrameSize {
+		msg := p.frame(true)
+		copy(msg.AudioData[:], samples[offset:])
+		p.transmit(msg)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			p.transmit(p.frame(false))
+			return ctx.Err()
+		}
+	}
+	p.transmit(p.frame(false))
+	return nil
+}
+
+// frame returns the next voice frame in sequence, keyed or not
+func (p *Player) frame(ptt bool) *usrp.VoiceMessage {
+	p.seq++
+	msg := usrp.NewSilenceFrame(p.seq, ptt)
+	msg.Header.TalkGroup = p.config.TalkGroup
+	return msg
+}
+
+// transmit sends a frame and counts the outcome
+func (p *Player) transmit(msg *usrp.VoiceMessage) {
+	err := p.send(msg)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		p.stats.Errors++
+	} else {
+		p.stats.Frames++
+	}
+}
+
+// Stats returns a copy of the current counters
+func (p *Player) Stats() Stats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := p.stats
+	stats.Queued = len(p.queue)
+	return stats
+}
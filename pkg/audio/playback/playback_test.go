@@ -0,0 +1,156 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// capture collects the frames a player sends and when
+type capture struct {
+	frames []*usrp.VoiceMessage
+	times  []time.Time
+	mutex  sync.Mutex
+}
+
+func (c *capture) send(msg *usrp.VoiceMessage) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.frames = append(c.frames, msg)
+	c.times = append(c.times, time.Now())
+	return nil
+}
+
+func (c *capture) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.frames)
+}
+
+// waitFor polls until the capture holds n frames
+func (c *capture) waitFor(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.count() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d frames, want %d", c.count(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPlayer_Announcement(t *testing.T) {
+	c := &capture{}
+	p := NewPlayer(c.send, &Config{
+		TalkGroup: 9,
+		Lead:      40 * time.Millisecond,
+		Tail:      20 * time.Millisecond,
+		Gap:       10 * time.Millisecond,
+	})
+
+	// 1.25 frames of audio then a tone: padded out to whole frames
+	clip := &Clip{Name: "id", Samples: make([]int16, 200)}
+	for i := range clip.Samples {
+		clip.Samples[i] = 1000
+	}
+	roger, err := tones.Courtesy("roger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tone, err := ToneClip("roger", roger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Enqueue(clip, tone); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Enqueue(clip); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	audio := (len(clip.Samples) + len(tone.Samples) + usrp.VoiceFrameSize - 1) / usrp.VoiceFrameSize
+	first := 2 + audio + 1 + 1 // Lead, audio, tail, unkey
+	second := 2 + 2 + 1 + 1
+	c.waitFor(t, first+second)
+
+	for i, msg := range c.frames {
+		if msg.Header.Seq != uint32(i+1) {
+			t.Fatalf("Frame %d has seq %d", i, msg.Header.Seq)
+		}
+		if msg.Header.TalkGroup != 9 {
+			t.Fatalf("Frame %d on talkgroup %d", i, msg.Header.TalkGroup)
+		}
+		unkey := i == first-1 || i == first+second-1
+		if msg.Header.IsPTT() == unkey {
+			t.Fatalf("Frame %d PTT %v", i, msg.Header.IsPTT())
+		}
+	}
+
+	// Lead-in is silent and the clip starts on the frame after it
+	if c.frames[1].AudioData[0] != 0 || c.frames[2].AudioData[0] != 1000 {
+		t.Errorf("Clip does not start after the lead: %d, %d", c.frames[1].AudioData[0], c.frames[2].AudioData[0])
+	}
+	if c.frames[3].AudioData[39] != 1000 || c.frames[3].AudioData[40] == 1000 {
+		t.Errorf("Tone does not follow the clip")
+	}
+
+	// Paced at 20ms a frame, not sent in a burst
+	if elapsed := c.times[first-1].Sub(c.times[0]); elapsed < time.Duration(first-2)*20*time.Millisecond {
+		t.Errorf("%d frames sent in %v", first, elapsed)
+	}
+
+	stats := p.Stats()
+	if stats.Played != 2 || stats.Frames != uint64(first+second) || stats.Errors != 0 {
+		t.Errorf("Stats %+v", stats)
+	}
+}
+
+func TestPlayer_Queue(t *testing.T) {
+	p := NewPlayer(func(*usrp.VoiceMessage) error { return errors.New("closed") }, &Config{MaxQueue: 2})
+
+	clip := &Clip{Samples: make([]int16, 160)}
+	if err := p.Enqueue(); err == nil {
+		t.Error("Queued an empty announcement")
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Enqueue(clip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Enqueue(clip); err == nil {
+		t.Error("Queued past MaxQueue")
+	}
+	if !p.Busy() {
+		t.Error("Not busy with announcements waiting")
+	}
+
+	p.Clear()
+	if p.Busy() {
+		t.Error("Busy after Clear")
+	}
+	if stats := p.Stats(); stats.Dropped != 3 || stats.Queued != 0 {
+		t.Errorf("Stats %+v", stats)
+	}
+
+	// A cancelled announcement still unkeys, and send failures are counted
+	if err := p.Enqueue(&Clip{Samples: make([]int16, 160*50)}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run returned %v", err)
+	}
+	if stats := p.Stats(); stats.Errors < 3 || stats.Errors > 10 || stats.Frames != 0 {
+		t.Errorf("Stats %+v", stats)
+	}
+}
@@ -0,0 +1,242 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// ConverterFactory creates a converter for a new stream
+type ConverterFactory func() (Converter, error)
+
+// ConverterPoolConfig holds converter pool settings
+type ConverterPoolConfig struct {
+	MaxConverters int           // Most converters open at once; the least recently used is closed to make room (0 = unlimited)
+	IdleTimeout   time.Duration // Converters unused this long are closed
+}
+
+// DefaultConverterPoolConfig returns room for 16 talkers, each converter
+// closed after a minute of silence
+func DefaultConverterPoolConfig() *ConverterPoolConfig {
+	return &ConverterPoolConfig{
+		MaxConverters: 16,
+		IdleTimeout:   time.Minute,
+	}
+}
+
+// ConverterPoolStats holds converter pool counters
+type ConverterPoolStats struct {
+	Active  int    `json:"active"`  // Converters open now
+	Created uint64 `json:"created"` // Converters created
+	Evicted uint64 `json:"evicted"` // Converters closed for being idle or to make room
+}
+
+// pooledConverter is one stream's converter
+type pooledConverter struct {
+	converter Converter
+	lastUsed  time.Time
+}
+
+// ConverterPool gives each stream (a talker, a transmission) its own
+// converter, so simultaneous streams are transcoded in parallel and codec
+// state never bleeds from one into another. Converters are created on
+// first use and closed when idle, released, or evicted to stay within
+// MaxConverters.
+type ConverterPool struct {
+	factory    ConverterFactory
+	config     ConverterPoolConfig
+	converters map[string]*pooledConverter
+	mutex      sync.Mutex
+	lastPrune  time.Time
+	created    uint64
+	evicted    uint64
+	closed     bool
+}
+
+// NewConverterPool creates a pool of converters made by factory. A nil
+// config uses DefaultConverterPoolConfig.
+func NewConverterPool(factory ConverterFactory, config *ConverterPoolConfig) *ConverterPool {
+	defaults := DefaultConverterPoolConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaults.IdleTimeout
+	}
+	return &ConverterPool{
+		factory:    factory,
+		config:     cfg,
+		converters: make(map[string]*pooledConverter),
+		lastPrune:  time.Now(),
+	}
+}
+
+// Get returns the converter for a stream, creating it if needed. The
+// converter stays owned by the pool: callers must not close it.
+func (p *ConverterPool) Get(id string) (Converter, error) {
+	now := time.Now()
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("converter pool is closed")
+	}
+	if now.Sub(p.lastPrune) >= p.config.IdleTimeout {
+		p.prune(now)
+	}
+	if pc, ok := p.converters[id]; ok {
+		pc.lastUsed = now
+		p.mutex.Unlock()
+		return pc.converter, nil
+	}
+	p.mutex.Unlock()
+
+	// Starting a converter may spawn FFmpeg; don't hold up other streams
+	converter, err := p.factory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create converter for stream %s: %w", id, err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		converter.Close()
+		return nil, fmt.Errorf("converter pool is closed")
+	}
+	if pc, ok := p.converters[id]; ok {
+		// Another caller created one first
+		converter.Close()
+		pc.lastUsed = now
+		return pc.converter, nil
+	}
+	if p.config.MaxConverters > 0 && len(p.converters) >= p.config.MaxConverters {
+		p.evictOldest()
+	}
+	p.converters[id] = &pooledConverter{converter: converter, lastUsed: now}
+	p.created++
+	return converter, nil
+}
+
+// Flush ends a stream's transmission, returning what its converter held
+// (see Flusher) and leaving it reset for the stream's next transmission.
+// A stream without a converter has nothing to flush.
+func (p *ConverterPool) Flush(id string) ([]byte, []*usrp.VoiceMessage, error) {
+	p.mutex.Lock()
+	pc, ok := p.converters[id]
+	if ok {
+		pc.lastUsed = time.Now()
+	}
+	p.mutex.Unlock()
+
+	if !ok {
+		return nil, nil, nil
+	}
+	return FlushConverter(pc.converter)
+}
+
+// Release closes a stream's converter, e.g. when its transmission ends
+func (p *ConverterPool) Release(id string) error {
+	p.mutex.Lock()
+	pc, ok := p.converters[id]
+	delete(p.converters, id)
+	p.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return pc.converter.Close()
+}
+
+// Prune closes converters idle for longer than IdleTimeout. Get prunes as
+// it goes; call Prune periodically to reclaim converters when traffic
+// stops altogether.
+func (p *ConverterPool) Prune() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.prune(time.Now())
+}
+
+// prune closes idle converters. Must be called with the mutex held.
+func (p *ConverterPool) prune(now time.Time) {
+	for id, pc := range p.converters {
+		if now.Sub(pc.lastUsed) > p.config.IdleTimeout {
+			pc.converter.Close()
+			delete(p.converters, id)
+			p.evicted++
+		}
+	}
+	p.lastPrune = now
+}
+
+// evictOldest closes the least recently used converter. Must be called
+// with the mutex held.
+func (p *ConverterPool) evictOldest() {
+	var oldestID string
+	var oldest *pooledConverter
+	for id, pc := range p.converters {
+		if oldest == nil || pc.lastUsed.Before(oldest.lastUsed) {
+			oldestID, oldest = id, pc
+		}
+	}
+	if oldest != nil {
+		oldest.converter.Close()
+		delete(p.converters, oldestID)
+		p.evicted++
+	}
+}
+
+// Len returns the number of open converters
+func (p *ConverterPool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.converters)
+}
+
+// Stats returns the pool's counters
+func (p *ConverterPool) Stats() ConverterPoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return ConverterPoolStats{
+		Active:  len(p.converters),
+		Created: p.created,
+		Evicted: p.evicted,
+	}
+}
+
+// Health combines the health of the pool's converters that report it
+func (p *ConverterPool) Health() ConverterHealth {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	health := ConverterHealth{Healthy: !p.closed}
+	for _, pc := range p.converters {
+		if reporter, ok := pc.converter.(HealthReporter); ok {
+			h := reporter.Health()
+			health.Healthy = health.Healthy && h.Healthy
+			health.Restarts += h.Restarts
+			if h.LastError != "" {
+				health.LastError = h.LastError
+			}
+		}
+	}
+	return health
+}
+
+// Close closes every converter in the pool
+func (p *ConverterPool) Close() error {
+	p.mutex.Lock()
+	converters := p.converters
+	p.converters = make(map[string]*pooledConverter)
+	p.closed = true
+	p.mutex.Unlock()
+
+	var firstErr error
+	for _, pc := range converters {
+		if err := pc.converter.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
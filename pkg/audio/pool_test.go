@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackedConverter is a G.711 converter that records being closed
+type trackedConverter struct {
+	*G711Converter
+	closed bool
+}
+
+func (tc *trackedConverter) Close() error {
+	tc.closed = true
+	return tc.G711Converter.Close()
+}
+
+// trackedFactory returns a factory and the converters it has made
+func trackedFactory() (ConverterFactory, *[]*trackedConverter) {
+	var made []*trackedConverter
+	var mutex sync.Mutex
+	return func() (Converter, error) {
+		g, err := NewG711Converter(ULaw)
+		if err != nil {
+			return nil, err
+		}
+		tc := &trackedConverter{G711Converter: g}
+		mutex.Lock()
+		made = append(made, tc)
+		mutex.Unlock()
+		return tc, nil
+	}, &made
+}
+
+func TestConverterPool_PerStream(t *testing.T) {
+	factory, made := trackedFactory()
+	pool := NewConverterPool(factory, nil)
+	defer pool.Close()
+
+	// Talkers transcode in parallel, each with its own converter
+	var wg sync.WaitGroup
+	for talker := 0; talker < 4; talker++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				converter, err := pool.Get(id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := converter.USRPToFormat(toneFrame(i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("talker%d", talker))
+	}
+	wg.Wait()
+
+	if stats := pool.Stats(); stats.Active != 4 || stats.Created != 4 {
+		t.Errorf("Expected 4 converters, got %+v", stats)
+	}
+
+	first, _ := pool.Get("talker0")
+	if again, _ := pool.Get("talker0"); again != first {
+		t.Error("Expected the same converter for the same stream")
+	}
+
+	if err := pool.Release("talker0"); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != 3 || !first.(*trackedConverter).closed {
+		t.Error("Expected Release to close the stream's converter")
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range *made {
+		if !tc.closed {
+			t.Errorf("Converter %d left open by Close", i)
+		}
+	}
+	if _, err := pool.Get("talker1"); err == nil {
+		t.Error("Expected error from a closed pool")
+	}
+}
+
+func TestConverterPool_Eviction(t *testing.T) {
+	factory, made := trackedFactory()
+	pool := NewConverterPool(factory, &ConverterPoolConfig{MaxConverters: 2, IdleTimeout: 50 * time.Millisecond})
+	defer pool.Close()
+
+	pool.Get("a")
+	time.Sleep(time.Millisecond)
+	pool.Get("b")
+	time.Sleep(time.Millisecond)
+	pool.Get("a") // b is now the least recently used
+	pool.Get("c")
+
+	if pool.Len() != 2 || !(*made)[1].closed || (*made)[0].closed {
+		t.Fatal("Expected the least recently used converter to make room")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	pool.Prune()
+	if stats := pool.Stats(); stats.Active != 0 || stats.Evicted != 3 {
+		t.Errorf("Expected idle converters pruned, got %+v", stats)
+	}
+
+	failing := NewConverterPool(func() (Converter, error) { return nil, fmt.Errorf("no FFmpeg") }, nil)
+	if _, err := failing.Get("a"); err == nil {
+		t.Error("Expected the factory's error")
+	}
+}
+
+func TestConverterPool_Flush(t *testing.T) {
+	factory, made := trackedFactory()
+	pool := NewConverterPool(factory, nil)
+	defer pool.Close()
+
+	if _, final, err := pool.Flush("idle"); err != nil || final != nil {
+		t.Errorf("Expected nothing to flush for an unknown stream, got %d frames (%v)", len(final), err)
+	}
+
+	converter, _ := pool.Get("talker")
+	converter.FormatToUSRP(make([]byte, 80))
+	_, final, err := pool.Flush("talker")
+	if err != nil || len(final) != 1 {
+		t.Fatalf("Expected one final frame, got %d (%v)", len(final), err)
+	}
+	if pool.Len() != 1 || (*made)[0].closed {
+		t.Error("Expected the flushed converter to stay open for the next transmission")
+	}
+}
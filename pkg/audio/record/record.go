@@ -0,0 +1,432 @@
+// Package record writes transmissions to audio files for logging and
+// review: one WAV, Ogg/Opus or FLAC file per transmission, named by time,
+// source and talkgroup, with a JSON sidecar describing it. Long
+// transmissions are split into parts by size or length, and old
+// recordings are pruned by age and total size.
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// Format is a recording file format
+type Format string
+
+const (
+	FormatWAV  Format = "wav"  // 16-bit PCM, the simplest to process
+	FormatOpus Format = "opus" // Ogg/Opus, a tenth the size of WAV
+	FormatFLAC Format = "flac" // Lossless, about half the size of WAV
+)
+
+// Config holds recorder settings
+type Config struct {
+	Directory    string        `json:"directory"`      // Root of the recordings, one subdirectory per day
+	Format       Format        `json:"format"`         // File format
+	MaxFileSize  int64         `json:"max_file_size"`  // Bytes after which a transmission continues in a new part (0 = no limit)
+	MaxDuration  time.Duration `json:"max_duration"`   // Length after which a transmission continues in a new part (0 = no limit)
+	Idle         time.Duration `json:"idle"`           // How long a transmission may go without frames before it is closed, for senders that never unkey
+	MaxAge       time.Duration `json:"max_age"`        // Recordings older than this are deleted (0 = keep forever)
+	MaxTotalSize int64         `json:"max_total_size"` // Bytes of recordings kept; the oldest are deleted beyond it (0 = no limit)
+}
+
+// DefaultConfig returns WAV recordings in "recordings", split every 10
+// minutes and kept for 30 days
+func DefaultConfig() *Config {
+	return &Config{
+		Directory:   "recordings",
+		Format:      FormatWAV,
+		MaxDuration: 10 * time.Minute,
+		Idle:        5 * time.Second,
+		MaxAge:      30 * 24 * time.Hour,
+	}
+}
+
+// Metadata is the JSON sidecar written next to each recording
+type Metadata struct {
+	File      string    `json:"file"`               // Recording file name, in the same directory
+	Format    Format    `json:"format"`             // File format
+	Source    string    `json:"source"`             // Who sent it, as the caller named them
+	Callsign  string    `json:"callsign,omitempty"` // Station callsign, when known
+	TalkGroup uint32    `json:"talkgroup"`          // Talkgroup of the first frame
+	Start     time.Time `json:"start"`              // When the first frame arrived
+	Duration  float64   `json:"duration"`           // Seconds of audio
+	Part      int       `json:"part,omitempty"`     // Part number of a split transmission, from 2
+	Size      int64     `json:"size"`               // File size in bytes
+}
+
+// Stats holds recorder counters
+type Stats struct {
+	Active     int    `json:"active"`     // Transmissions being recorded now
+	Recordings uint64 `json:"recordings"` // Files finished
+	Bytes      uint64 `json:"bytes"`      // Bytes of files finished
+	Pruned     uint64 `json:"pruned"`     // Recordings deleted by retention
+	Errors     uint64 `json:"errors"`     // Recordings abandoned on write errors
+}
+
+// pruneInterval is the least time between retention passes, which walk
+// the whole directory
+const pruneInterval = time.Minute
+
+// writer is the common shape of the audio package's file writers
+type writer interface {
+	WriteMessage(msg *usrp.VoiceMessage, at time.Time) error
+	Duration() time.Duration
+	Close() error
+}
+
+// recording is one file being written
+type recording struct {
+	file     *os.File
+	writer   writer
+	meta     Metadata
+	path     string
+	lastSeen time.Time
+}
+
+// Recorder records transmissions from any number of sources at once. Feed
+// it every voice frame with WriteMessage; an unkeyed frame ends the
+// source's transmission and finishes its file.
+type Recorder struct {
+	config    Config
+	active    map[string]*recording
+	callsigns map[string]string
+	lastPrune time.Time
+	stats     Stats
+	mutex     sync.Mutex
+}
+
+// NewRecorder creates a recorder, making its directory if needed. A nil
+// config uses DefaultConfig.
+func NewRecorder(config *Config) (*Recorder, error) {
+	defaults := DefaultConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.Directory == "" {
+		cfg.Directory = defaults.Directory
+	}
+	if cfg.Format == "" {
+		cfg.Format = defaults.Format
+	}
+	if cfg.Idle <= 0 {
+		cfg.Idle = defaults.Idle
+	}
+	switch cfg.Format {
+	case FormatWAV, FormatOpus, FormatFLAC:
+	default:
+		return nil, fmt.Errorf("unknown recording format %q (want %q, %q or %q)", cfg.Format, FormatWAV, FormatOpus, FormatFLAC)
+	}
+	if err := os.MkdirAll(cfg.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	return &Recorder{
+		config:    cfg,
+		active:    make(map[string]*recording),
+		callsigns: make(map[string]string),
+	}, nil
+}
+
+// SetCallsign names the station behind source, for the sidecars of its
+// recordings from now on, including the one in progress
+func (r *Recorder) SetCallsign(source, callsign string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.callsigns[source] = callsign
+	if rec, ok := r.active[source]; ok {
+		rec.meta.Callsign = callsign
+	}
+}
+
+// WriteMessage records a voice frame from source that arrived at at. A
+// keyed frame starts a recording if source has none; an unkeyed one
+// finishes it.
+func (r *Recorder) WriteMessage(source string, msg *usrp.VoiceMessage, at time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rec, ok := r.active[source]
+	if !msg.Header.IsPTT() {
+		if ok {
+			return r.finish(source, rec)
+		}
+		return nil
+	}
+
+	part := 0
+	if ok && r.full(rec) {
+		part = max(rec.meta.Part, 1) + 1
+		if err := r.finish(source, rec); err != nil {
+			return err
+		}
+		ok = false
+	}
+	if !ok {
+		var err error
+		if rec, err = r.start(source, msg, at); err != nil {
+			return err
+		}
+		rec.meta.Part = part
+	}
+
+	rec.lastSeen = at
+	if at.IsZero() {
+		rec.lastSeen = time.Now()
+	}
+	if err := rec.writer.WriteMessage(msg, at); err != nil {
+		r.abandon(source, rec)
+		return fmt.Errorf("failed to record %s: %w", source, err)
+	}
+	return nil
+}
+
+// full reports whether a recording has reached its size or length limit.
+// Must be called with the mutex held.
+func (r *Recorder) full(rec *recording) bool {
+	if r.config.MaxDuration > 0 && rec.writer.Duration() >= r.config.MaxDuration {
+		return true
+	}
+	if r.config.MaxFileSize > 0 {
+		if size, err := rec.file.Seek(0, io.SeekCurrent); err == nil && size >= r.config.MaxFileSize {
+			return true
+		}
+	}
+	return false
+}
+
+// start opens a recording for source's transmission beginning with msg.
+// Must be called with the mutex held.
+func (r *Recorder) start(source string, msg *usrp.VoiceMessage, at time.Time) (*recording, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.UTC()
+	dir := filepath.Join(r.config.Directory, at.Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	base := fmt.Sprintf("%s_%s_tg%d", at.Format("150405.000"), sanitize(source), msg.Header.TalkGroup)
+	path := filepath.Join(dir, base+"."+string(r.config.Format))
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d.%s", base, n, r.config.Format))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	var w writer
+	switch r.config.Format {
+	case FormatWAV:
+		w, err = audio.NewWAVWriter(file, nil)
+	case FormatOpus:
+		w, err = audio.NewOggOpusWriter(file, nil)
+	case FormatFLAC:
+		w, err = audio.NewFLACWriter(file, nil)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	rec := &recording{
+		file:   file,
+		writer: w,
+		path:   path,
+		meta: Metadata{
+			File:      filepath.Base(path),
+			Format:    r.config.Format,
+			Source:    source,
+			Callsign:  r.callsigns[source],
+			TalkGroup: msg.Header.TalkGroup,
+			Start:     at,
+		},
+	}
+	r.active[source] = rec
+	return rec, nil
+}
+
+// finish closes a recording and writes its sidecar. Must be called with
+// the mutex held.
+func (r *Recorder) finish(source string, rec *recording) error {
+	delete(r.active, source)
+	err := rec.writer.Close()
+	if size, serr := rec.file.Seek(0, io.SeekEnd); serr == nil {
+		rec.meta.Size = size
+	}
+	if cerr := rec.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		r.stats.Errors++
+		return fmt.Errorf("failed to finish recording %s: %w", rec.path, err)
+	}
+
+	rec.meta.Duration = rec.writer.Duration().Seconds()
+	sidecar, err := json.MarshalIndent(rec.meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording metadata: %w", err)
+	}
+	if err := os.WriteFile(sidecarPath(rec.path), sidecar, 0o644); err != nil {
+		return fmt.Errorf("failed to write recording metadata: %w", err)
+	}
+	r.stats.Recordings++
+	r.stats.Bytes += uint64(rec.meta.Size)
+
+	if time.Since(r.lastPrune) >= pruneInterval {
+		r.lastPrune = time.Now()
+		r.prune(time.Now())
+	}
+	return nil
+}
+
+// abandon closes and deletes a recording that could not be written. Must
+// be called with the mutex held.
+func (r *Recorder) abandon(source string, rec *recording) {
+	delete(r.active, source)
+	rec.file.Close()
+	os.Remove(rec.path)
+	r.stats.Errors++
+}
+
+// Expire finishes the recordings of sources that have sent nothing for
+// the idle time, as of now. Call it periodically.
+func (r *Recorder) Expire(now time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var errs []error
+	for source, rec := range r.active {
+		if now.Sub(rec.lastSeen) >= r.config.Idle {
+			errs = append(errs, r.finish(source, rec))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prune applies the retention policy now: recordings older than MaxAge are
+// deleted, then the oldest until the rest fit in MaxTotalSize. Recordings
+// in progress are left alone.
+func (r *Recorder) Prune() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastPrune = time.Now()
+	return r.prune(r.lastPrune)
+}
+
+// prune implements Prune. Must be called with the mutex held.
+func (r *Recorder) prune(now time.Time) error {
+	if r.config.MaxAge <= 0 && r.config.MaxTotalSize <= 0 {
+		return nil
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	err := filepath.WalkDir(r.config.Directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch Format(strings.TrimPrefix(filepath.Ext(path), ".")) {
+		case FormatWAV, FormatOpus, FormatFLAC:
+		default:
+			return nil // Sidecars and anything else
+		}
+		for _, rec := range r.active {
+			if rec.path == path {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Deleted under us
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan recordings: %w", err)
+	}
+
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files {
+		expired := r.config.MaxAge > 0 && now.Sub(f.modTime) > r.config.MaxAge
+		over := r.config.MaxTotalSize > 0 && total > r.config.MaxTotalSize
+		if !expired && !over {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete recording: %w", err)
+		}
+		os.Remove(sidecarPath(f.path))
+		os.Remove(filepath.Dir(f.path)) // Only succeeds once the day is empty
+		total -= f.size
+		r.stats.Pruned++
+	}
+	return nil
+}
+
+// Stats returns a copy of the current counters
+func (r *Recorder) Stats() Stats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stats := r.stats
+	stats.Active = len(r.active)
+	return stats
+}
+
+// Close finishes every recording in progress
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var errs []error
+	for source, rec := range r.active {
+		errs = append(errs, r.finish(source, rec))
+	}
+	return errors.Join(errs...)
+}
+
+// sidecarPath returns the metadata file of a recording
+func sidecarPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+// sanitize makes a source name safe in a file name
+func sanitize(source string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, source)
+}
@@ -0,0 +1,151 @@
+package record
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// frame returns a keyed or unkeyed voice frame on talkgroup 9
+func frame(ptt bool) *usrp.VoiceMessage {
+	msg := usrp.NewSilenceFrame(0, ptt)
+	msg.Header.TalkGroup = 9
+	for i := range msg.AudioData {
+		msg.AudioData[i] = int16(i * 100)
+	}
+	return msg
+}
+
+// transmit records n frames from source starting at start, then unkeys
+func transmit(t *testing.T, r *Recorder, source string, start time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := r.WriteMessage(source, frame(true), start.Add(time.Duration(i)*20*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.WriteMessage(source, frame(false), start.Add(time.Duration(n)*20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorder_Formats(t *testing.T) {
+	for _, format := range []Format{FormatWAV, FormatOpus, FormatFLAC} {
+		dir := t.TempDir()
+		r, err := NewRecorder(&Config{Directory: dir, Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetCallsign("node 1", "W1AW")
+		start := time.Date(2026, 3, 14, 15, 9, 26, 500e6, time.UTC)
+		transmit(t, r, "node 1", start, 50)
+
+		path := filepath.Join(dir, "2026-03-14", "150926.500_node_1_tg9."+string(format))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "2026-03-14", "150926.500_node_1_tg9.json"))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		var meta Metadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			t.Fatal(err)
+		}
+		if meta.Callsign != "W1AW" || meta.TalkGroup != 9 || meta.Duration != 1 || meta.Size != info.Size() || !meta.Start.Equal(start) {
+			t.Errorf("%s: sidecar %+v", format, meta)
+		}
+		if stats := r.Stats(); stats.Recordings != 1 || stats.Active != 0 {
+			t.Errorf("%s: stats %+v", format, stats)
+		}
+	}
+
+	if _, err := NewRecorder(&Config{Directory: t.TempDir(), Format: "mp3"}); err == nil {
+		t.Error("Expected error for an unknown format")
+	}
+}
+
+func TestRecorder_RotationAndExpiry(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(&Config{Directory: dir, MaxDuration: time.Second, Idle: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2.5s in one transmission makes three parts
+	start := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	transmit(t, r, "a", start, 125)
+	files, _ := filepath.Glob(filepath.Join(dir, "2026-03-14", "*.wav"))
+	if len(files) != 3 {
+		t.Fatalf("Got %d parts, want 3: %v", len(files), files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "2026-03-14", "120002.000_a_tg9.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Part != 3 || meta.Duration != 0.5 {
+		t.Errorf("Last part: %+v", meta)
+	}
+
+	// A sender that never unkeys is closed once idle
+	if err := r.WriteMessage("b", frame(true), start); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Expire(start.Add(500 * time.Millisecond)); err != nil || r.Stats().Active != 1 {
+		t.Fatalf("Expired early: %v", err)
+	}
+	if err := r.Expire(start.Add(2 * time.Second)); err != nil || r.Stats().Active != 0 {
+		t.Fatalf("Not expired: %v", err)
+	}
+}
+
+func TestRecorder_Retention(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(&Config{Directory: dir, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	transmit(t, r, "old", start, 10)
+	transmit(t, r, "new", start.Add(time.Minute), 10)
+
+	// Age the first recording past MaxAge
+	old := filepath.Join(dir, "2026-03-14", "120000.000_old_tg9.wav")
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(old, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Old recording kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2026-03-14", "120000.000_old_tg9.json")); !os.IsNotExist(err) {
+		t.Error("Old sidecar kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2026-03-14", "120100.000_new_tg9.wav")); err != nil {
+		t.Errorf("New recording deleted: %v", err)
+	}
+
+	// A size cap deletes the oldest until the rest fit
+	r.config.MaxTotalSize = 1
+	if err := r.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2026-03-14")); !os.IsNotExist(err) {
+		t.Error("Empty day directory kept")
+	}
+	if stats := r.Stats(); stats.Pruned != 2 {
+		t.Errorf("Pruned %d, want 2", stats.Pruned)
+	}
+}
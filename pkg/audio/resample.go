@@ -0,0 +1,210 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// ResampleQuality trades CPU for stopband attenuation
+type ResampleQuality string
+
+const (
+	ResampleFast   ResampleQuality = "fast"   // ~50 dB, 8 taps per input sample
+	ResampleMedium ResampleQuality = "medium" // ~70 dB, 16 taps per input sample
+	ResampleHigh   ResampleQuality = "high"   // ~90 dB, 32 taps per input sample
+)
+
+// resampleDesign holds the filter parameters for a quality
+type resampleDesign struct {
+	zeroCrossings int     // Sinc lobes each side of the centre
+	beta          float64 // Kaiser window shape
+	rolloff       float64 // Cutoff as a fraction of the lower Nyquist rate
+}
+
+// design returns the filter parameters for q; "" means medium
+func (q ResampleQuality) design() (resampleDesign, error) {
+	switch q {
+	case ResampleFast:
+		return resampleDesign{zeroCrossings: 4, beta: 5.5, rolloff: 0.85}, nil
+	case ResampleMedium, "":
+		return resampleDesign{zeroCrossings: 8, beta: 7.5, rolloff: 0.9}, nil
+	case ResampleHigh:
+		return resampleDesign{zeroCrossings: 16, beta: 9.5, rolloff: 0.94}, nil
+	}
+	return resampleDesign{}, fmt.Errorf("unknown resample quality %q (want %q, %q or %q)",
+		q, ResampleFast, ResampleMedium, ResampleHigh)
+}
+
+// maxResamplePhases bounds the interpolation factor so odd rate pairs
+// cannot build huge filter tables
+const maxResamplePhases = 1024
+
+// Resampler converts a stream of mono samples between two rates with a
+// polyphase Kaiser-windowed sinc filter. Filter history is kept across
+// Process calls, so a stream chopped into frames resamples exactly as it
+// would in one piece, without clicks at frame boundaries. The output lags
+// the input by Delay samples.
+//
+// A Resampler is not safe for concurrent use; give each stream its own.
+type Resampler struct {
+	up, down int       // Interpolation and decimation factors
+	taps     int       // Filter taps per phase
+	coeffs   []float64 // Phase-major: coeffs[phase*taps+k]
+	history  []float64 // Last taps-1 input samples, then the current input
+	index    int       // Input sample of the next output, relative to the current input
+	phase    int       // Filter phase of the next output
+}
+
+// NewResampler creates a streaming resampler from inRate to outRate
+func NewResampler(inRate, outRate int, quality ResampleQuality) (*Resampler, error) {
+	return newResampler(inRate, outRate, quality, false)
+}
+
+// newResampler builds the filter. aligned starts the first output at input
+// time zero instead of one filter delay earlier, for one-shot use.
+func newResampler(inRate, outRate int, quality ResampleQuality, aligned bool) (*Resampler, error) {
+	if inRate <= 0 || outRate <= 0 {
+		return nil, fmt.Errorf("sample rates must be positive, got %d and %d", inRate, outRate)
+	}
+	design, err := quality.design()
+	if err != nil {
+		return nil, err
+	}
+
+	g := gcd(inRate, outRate)
+	up, down := outRate/g, inRate/g
+	if up > maxResamplePhases {
+		return nil, fmt.Errorf("cannot resample %d Hz to %d Hz: ratio %d/%d is too fine", inRate, outRate, up, down)
+	}
+
+	// The prototype filter runs at the interpolated rate up*inRate and must
+	// cut off below the lower of the two Nyquist rates
+	wider := max(up, down)
+	taps := (2*design.zeroCrossings*wider + up - 1) / up
+	length := taps * up
+	centre := length / 2
+	cutoff := design.rolloff / float64(wider)
+
+	prototype := make([]float64, length)
+	var sum float64
+	for n := range prototype {
+		x := float64(n - centre)
+		v := cutoff * sinc(cutoff*x) * kaiser(x/float64(centre), design.beta)
+		prototype[n] = v
+		sum += v
+	}
+
+	// Scale for unity DC gain once the zero-stuffed input is filtered, and
+	// split into phases
+	r := &Resampler{
+		up:      up,
+		down:    down,
+		taps:    taps,
+		coeffs:  make([]float64, length),
+		history: make([]float64, taps-1),
+	}
+	for phase := 0; phase < up; phase++ {
+		for k := 0; k < taps; k++ {
+			r.coeffs[phase*taps+k] = prototype[phase+k*up] * float64(up) / sum
+		}
+	}
+	if aligned {
+		r.index, r.phase = centre/up, centre%up
+	}
+	return r, nil
+}
+
+// Delay returns the filter's latency in output samples
+func (r *Resampler) Delay() int {
+	return (r.taps * r.up / 2) / r.down
+}
+
+// Process resamples the next block of the stream. Output length follows the
+// rate ratio, carrying any fraction over to the next call: 160 samples at
+// 8 kHz always become 960 at 48 kHz, and 960 at 48 kHz become 160 at 8 kHz.
+func (r *Resampler) Process(in []int16) []int16 {
+	keep := r.taps - 1
+	buffer := r.history[:keep]
+	for _, s := range in {
+		buffer = append(buffer, float64(s))
+	}
+
+	out := make([]int16, 0, (len(in)*r.up)/r.down+1)
+	for r.index < len(in) {
+		coeffs := r.coeffs[r.phase*r.taps : (r.phase+1)*r.taps]
+		newest := r.index + keep
+		var acc float64
+		for k, c := range coeffs {
+			acc += c * buffer[newest-k]
+		}
+		out = append(out, clampInt16(acc))
+
+		r.phase += r.down
+		r.index += r.phase / r.up
+		r.phase %= r.up
+	}
+	r.index -= len(in)
+
+	// Keep the newest taps-1 samples as history, reusing the buffer
+	r.history = buffer[:copy(buffer, buffer[len(buffer)-keep:])]
+	return out
+}
+
+// Reset clears the filter history, as at the start of a new stream
+func (r *Resampler) Reset() {
+	clear(r.history)
+	r.history = r.history[:r.taps-1]
+	r.index, r.phase = 0, 0
+}
+
+// Resample converts a whole clip from inRate to outRate. Unlike a streaming
+// Resampler the result is time-aligned with the input and holds
+// ceil(len(samples)*outRate/inRate) samples.
+func Resample(samples []int16, inRate, outRate int, quality ResampleQuality) ([]int16, error) {
+	r, err := newResampler(inRate, outRate, quality, true)
+	if err != nil {
+		return nil, err
+	}
+
+	want := (len(samples)*r.up + r.down - 1) / r.down
+	out := r.Process(samples)
+	// Flush the filter's look-ahead with silence
+	for len(out) < want {
+		out = append(out, r.Process(make([]int16, r.taps))...)
+	}
+	return out[:want], nil
+}
+
+// sinc is the normalized sinc function sin(πx)/(πx)
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser evaluates a Kaiser window at x in [-1, 1]
+func kaiser(x, beta float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// gcd returns the greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
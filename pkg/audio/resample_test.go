@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// tone returns seconds of a sine at freq Hz sampled at rate
+func tone(freq float64, rate int, seconds float64, amplitude float64) []int16 {
+	samples := make([]int16, int(float64(rate)*seconds))
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return samples
+}
+
+// snr returns the signal-to-noise ratio of got against want in dB,
+// ignoring margin samples at each end
+func snr(want, got []int16, margin int) float64 {
+	var signal, noise float64
+	for i := margin; i < len(want)-margin; i++ {
+		d := float64(got[i]) - float64(want[i])
+		signal += float64(want[i]) * float64(want[i])
+		noise += d * d
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestResample_SNR(t *testing.T) {
+	tests := []struct {
+		quality ResampleQuality
+		minSNR  float64
+	}{
+		{ResampleFast, 40},
+		{ResampleMedium, 60},
+		{ResampleHigh, 75},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.quality), func(t *testing.T) {
+			input := tone(1000, 8000, 1, 10000)
+
+			up, err := Resample(input, 8000, 48000, tt.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(up) != 48000 {
+				t.Fatalf("Expected 48000 samples, got %d", len(up))
+			}
+			if got := snr(tone(1000, 48000, 1, 10000), up, 600); got < tt.minSNR {
+				t.Errorf("8k->48k SNR %.1f dB, want at least %.1f dB", got, tt.minSNR)
+			}
+
+			down, err := Resample(up, 48000, 8000, tt.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(down) != 8000 {
+				t.Fatalf("Expected 8000 samples, got %d", len(down))
+			}
+			if got := snr(input, down, 100); got < tt.minSNR {
+				t.Errorf("8k->48k->8k SNR %.1f dB, want at least %.1f dB", got, tt.minSNR)
+			}
+		})
+	}
+}
+
+// TestResample_RejectsAliases checks that content above the 8 kHz Nyquist
+// rate is filtered out instead of folding back into the voice band, as plain
+// decimation would do
+func TestResample_RejectsAliases(t *testing.T) {
+	tests := []struct {
+		quality    ResampleQuality
+		maxLeakage float64 // dB relative to the input
+	}{
+		{ResampleFast, -40},
+		{ResampleMedium, -60},
+		{ResampleHigh, -75},
+	}
+
+	input := tone(6000, 48000, 1, 10000) // Aliases to 2 kHz at 8 kHz
+	for _, tt := range tests {
+		down, err := Resample(input, 48000, 8000, tt.quality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leakage := 20 * math.Log10(rms(down[100:len(down)-100])/rms(input))
+		if leakage > tt.maxLeakage {
+			t.Errorf("%s: 6 kHz leaked at %.1f dB, want below %.1f dB", tt.quality, leakage, tt.maxLeakage)
+		}
+	}
+}
+
+// TestResampler_Streaming checks that frame-by-frame resampling yields whole
+// frames and the same samples as one long call
+func TestResampler_Streaming(t *testing.T) {
+	input := tone(440, 8000, 0.5, 8000)
+
+	whole, err := NewResampler(8000, 48000, ResampleMedium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := whole.Process(input)
+
+	framed, err := NewResampler(8000, 48000, ResampleMedium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int16
+	for i := 0; i < len(input); i += 160 {
+		frame := framed.Process(input[i : i+160])
+		if len(frame) != 960 {
+			t.Fatalf("Frame %d: expected 960 samples, got %d", i/160, len(frame))
+		}
+		got = append(got, frame...)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Streaming produced %d samples, one call %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Sample %d: streaming %d, one call %d", i, got[i], want[i])
+		}
+	}
+
+	// The stream lags by Delay output samples
+	delay := whole.Delay()
+	reference := tone(440, 48000, 0.5, 8000)
+	if s := snr(reference[:len(reference)-delay], want[delay:], 600); s < 60 {
+		t.Errorf("Delayed stream SNR %.1f dB, want at least 60 dB", s)
+	}
+
+	// Odd block sizes carry the fraction over
+	down, err := NewResampler(48000, 8000, ResampleMedium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, n := range []int{7, 500, 1, 1412} {
+		total += len(down.Process(make([]int16, n)))
+	}
+	if total != 320 {
+		t.Errorf("Expected 320 samples from 1920 input, got %d", total)
+	}
+
+	down.Reset()
+	if n := len(down.Process(make([]int16, 960))); n != 160 {
+		t.Errorf("Expected 160 samples after Reset, got %d", n)
+	}
+}
+
+func TestResample_Errors(t *testing.T) {
+	if _, err := NewResampler(0, 8000, ResampleMedium); err == nil {
+		t.Error("Expected error for zero input rate")
+	}
+	if _, err := NewResampler(8000, 48000, "best"); err == nil {
+		t.Error("Expected error for unknown quality")
+	}
+	if _, err := Resample(nil, 8000, 7919*1000, ResampleFast); err == nil {
+		t.Error("Expected error for an unreasonable ratio")
+	}
+
+	// Arbitrary ratios work, and the zero value means medium
+	out, err := Resample(tone(1000, 44100, 0.1, 10000), 44100, 8000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 800 {
+		t.Errorf("Expected 800 samples, got %d", len(out))
+	}
+}
+
+func BenchmarkResampler_8kTo48k(b *testing.B) {
+	r, _ := NewResampler(8000, 48000, ResampleMedium)
+	frame := tone(1000, 8000, 0.02, 10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Process(frame)
+	}
+}
+
+func BenchmarkResampler_48kTo8k(b *testing.B) {
+	r, _ := NewResampler(48000, 8000, ResampleMedium)
+	frame := tone(1000, 48000, 0.02, 10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Process(frame)
+	}
+}
@@ -0,0 +1,171 @@
+package signal
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pattern names a kind of reference signal
+type Pattern string
+
+const (
+	PatternSilence Pattern = "silence" // Digital silence
+	PatternSine    Pattern = "sine"    // A pure tone
+	PatternNoise   Pattern = "noise"   // White noise
+	PatternSweep   Pattern = "sweep"   // A repeating linear sweep
+	PatternDTMF    Pattern = "dtmf"    // DTMF digits in turn, repeating
+)
+
+// Spec describes reference audio: what to generate, how loud and for how
+// long. Zero fields take the defaults noted.
+type Spec struct {
+	Pattern      Pattern       `json:"pattern"`
+	Frequency    float64       `json:"frequency"`     // Tone, or sweep start, in Hz (1000 for tones, 300 for sweeps)
+	EndFrequency float64       `json:"end_frequency"` // Sweep end in Hz (3000)
+	Amplitude    float64       `json:"amplitude"`     // Peak as a fraction of full scale (0.5, -6 dBFS)
+	Duration     time.Duration `json:"duration"`      // Length of the audio Frames returns (1s)
+	Period       time.Duration `json:"period"`        // Sweep length before it restarts (10s), or each DTMF digit's length (100ms)
+	Gap          time.Duration `json:"gap"`           // Silence after each DTMF digit (none)
+	Digits       string        `json:"digits"`        // DTMF digits ("1234567890*#")
+	SampleRate   int           `json:"sample_rate"`   // DefaultSampleRate
+	Seed         int64         `json:"seed"`          // Noise seed, for repeatable noise
+}
+
+// withDefaults returns spec with zero fields filled in
+func (spec Spec) withDefaults() Spec {
+	if spec.Amplitude == 0 {
+		spec.Amplitude = 0.5
+	}
+	if spec.Duration <= 0 {
+		spec.Duration = time.Second
+	}
+	if spec.SampleRate <= 0 {
+		spec.SampleRate = DefaultSampleRate
+	}
+	switch spec.Pattern {
+	case PatternSine:
+		if spec.Frequency == 0 {
+			spec.Frequency = 1000
+		}
+	case PatternSweep:
+		if spec.Frequency == 0 {
+			spec.Frequency = 300
+		}
+		if spec.EndFrequency == 0 {
+			spec.EndFrequency = 3000
+		}
+		if spec.Period <= 0 {
+			spec.Period = 10 * time.Second
+		}
+	case PatternDTMF:
+		if spec.Digits == "" {
+			spec.Digits = "1234567890*#"
+		}
+		if spec.Period <= 0 {
+			spec.Period = 100 * time.Millisecond
+		}
+	}
+	return spec
+}
+
+// New creates a generator for spec. It runs on indefinitely; Duration
+// only bounds Frames.
+func New(spec Spec) (Generator, error) {
+	spec = spec.withDefaults()
+	switch spec.Pattern {
+	case PatternSilence, "":
+		return Silence{}, nil
+	case PatternSine:
+		return NewSine(spec.Frequency, spec.Amplitude, spec.SampleRate), nil
+	case PatternNoise:
+		return NewNoise(spec.Amplitude, spec.Seed), nil
+	case PatternSweep:
+		return NewSweep(spec.Frequency, spec.EndFrequency, spec.Period, spec.Amplitude, spec.SampleRate), nil
+	case PatternDTMF:
+		return NewDTMFSequence(spec.Digits, spec.Period, spec.Gap, spec.Amplitude, spec.SampleRate)
+	}
+	return nil, fmt.Errorf("unknown signal pattern %q", spec.Pattern)
+}
+
+// Frames renders Duration of spec as frames of frameSize samples, the last
+// padded with silence. A frameSize of 0 gives 20ms frames, USRP's 160
+// samples at 8kHz.
+func Frames(spec Spec, frameSize int) ([][]int16, error) {
+	gen, err := New(spec)
+	if err != nil {
+		return nil, err
+	}
+	spec = spec.withDefaults()
+	if frameSize <= 0 {
+		frameSize = spec.SampleRate / 50
+	}
+
+	total := int(spec.Duration.Seconds() * float64(spec.SampleRate))
+	frames := make([][]int16, 0, (total+frameSize-1)/frameSize)
+	for n := 0; n < total; n += frameSize {
+		frame := make([]int16, frameSize)
+		gen.Fill(frame[:min(frameSize, total-n)])
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// DTMFSequence plays DTMF digits one after another, each for a fixed time
+// with optional silence after it, and starts over after the last
+type DTMFSequence struct {
+	tones    []*DualTone
+	on, off  int // Samples of tone and of silence per digit
+	digit    int
+	position int // Samples into the current digit
+}
+
+// NewDTMFSequence creates a generator playing digits in turn, each for on
+// and followed by off of silence
+func NewDTMFSequence(digits string, on, off time.Duration, amplitude float64, sampleRate int) (*DTMFSequence, error) {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	if digits == "" {
+		return nil, fmt.Errorf("no DTMF digits")
+	}
+	ds := &DTMFSequence{
+		on:  int(on.Seconds() * float64(sampleRate)),
+		off: max(int(off.Seconds()*float64(sampleRate)), 0),
+	}
+	if ds.on <= 0 {
+		return nil, fmt.Errorf("DTMF digits must sound for a positive time, got %v", on)
+	}
+	for _, digit := range digits {
+		tone, err := NewDTMF(digit, amplitude, sampleRate)
+		if err != nil {
+			return nil, err
+		}
+		ds.tones = append(ds.tones, tone)
+	}
+	return ds, nil
+}
+
+// Digit returns the index in the digits of the one playing next
+func (ds *DTMFSequence) Digit() int {
+	return ds.digit
+}
+
+// Fill writes the next len(samples) samples of the sequence
+func (ds *DTMFSequence) Fill(samples []int16) {
+	for len(samples) > 0 {
+		var n int
+		if ds.position < ds.on {
+			n = min(len(samples), ds.on-ds.position)
+			ds.tones[ds.digit].Fill(samples[:n])
+		} else {
+			n = min(len(samples), ds.on+ds.off-ds.position)
+			clear(samples[:n])
+		}
+		samples = samples[n:]
+		ds.position += n
+		if ds.position >= ds.on+ds.off {
+			ds.position = 0
+			ds.digit = (ds.digit + 1) % len(ds.tones)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package signal synthesizes reference audio (sine, noise, sweep, DTMF) as
+// 16-bit PCM for tests, self-tests, and tone injection, and for bridges,
+// examples, mocks and load tools that need known audio to send. Describe
+// the audio with a Spec and use New for a generator or Frames for the
+// audio cut into frames.
+//
+// Amplitudes are linear fractions of full scale (0.0-1.0); use DBFS to convert
+// from a level in dBFS. All generators compute in float64 and saturate when
+// converting, so no amplitude setting can wrap around int16.
+package signal
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// DefaultSampleRate is the USRP sample rate
+const DefaultSampleRate = 8000
+
+// Generator writes successive samples of a signal. Generators are stateful
+// (phase is carried across calls) and not safe for concurrent use.
+type Generator interface {
+	Fill(samples []int16)
+}
+
+// DBFS converts a level in dBFS to a linear amplitude
+func DBFS(level float64) float64 {
+	return math.Pow(10, level/20)
+}
+
+// toSample scales a [-1, 1] value by full scale with saturation
+func toSample(v float64) int16 {
+	v = math.Round(v * math.MaxInt16)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// clampAmplitude limits amplitude to [0, 1]
+func clampAmplitude(a float64) float64 {
+	return math.Max(0, math.Min(1, a))
+}
+
+// Sine generates a pure tone
+type Sine struct {
+	frequency  float64
+	amplitude  float64
+	sampleRate float64
+	phase      float64
+}
+
+// NewSine creates a sine generator
+func NewSine(frequency, amplitude float64, sampleRate int) *Sine {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &Sine{
+		frequency:  frequency,
+		amplitude:  clampAmplitude(amplitude),
+		sampleRate: float64(sampleRate),
+	}
+}
+
+// Fill writes the next len(samples) samples of the tone
+func (s *Sine) Fill(samples []int16) {
+	step := 2 * math.Pi * s.frequency / s.sampleRate
+	for i := range samples {
+		samples[i] = toSample(s.amplitude * math.Sin(s.phase))
+		s.phase = math.Mod(s.phase+step, 2*math.Pi)
+	}
+}
+
+// DualTone generates the sum of two tones at equal level (DTMF and similar)
+type DualTone struct {
+	low, high *Sine
+}
+
+// NewDualTone creates a dual-tone generator. The combined peak equals
+// amplitude, so each component is generated at half of it.
+func NewDualTone(f1, f2, amplitude float64, sampleRate int) *DualTone {
+	amplitude = clampAmplitude(amplitude)
+	return &DualTone{
+		low:  NewSine(f1, amplitude/2, sampleRate),
+		high: NewSine(f2, amplitude/2, sampleRate),
+	}
+}
+
+// Fill writes the next len(samples) samples of the tone pair
+func (d *DualTone) Fill(samples []int16) {
+	high := make([]int16, len(samples))
+	d.low.Fill(samples)
+	d.high.Fill(high)
+	for i := range samples {
+		// Each component is at most half scale, so the sum cannot overflow
+		samples[i] += high[i]
+	}
+}
+
+// dtmfFrequencies maps keypad digits to their (row, column) frequencies
+var dtmfFrequencies = map[rune][2]float64{
+	'1': {697, 1209}, '2': {697, 1336}, '3': {697, 1477}, 'A': {697, 1633},
+	'4': {770, 1209}, '5': {770, 1336}, '6': {770, 1477}, 'B': {770, 1633},
+	'7': {852, 1209}, '8': {852, 1336}, '9': {852, 1477}, 'C': {852, 1633},
+	'*': {941, 1209}, '0': {941, 1336}, '#': {941, 1477}, 'D': {941, 1633},
+}
+
+// DTMFFrequencies returns the row and column frequencies of a DTMF digit
+func DTMFFrequencies(digit rune) (low, high float64, ok bool) {
+	f, ok := dtmfFrequencies[digit]
+	return f[0], f[1], ok
+}
+
+// NewDTMF creates a generator for a DTMF digit ('0'-'9', 'A'-'D', '*', '#')
+func NewDTMF(digit rune, amplitude float64, sampleRate int) (*DualTone, error) {
+	low, high, ok := DTMFFrequencies(digit)
+	if !ok {
+		return nil, fmt.Errorf("invalid DTMF digit: %q", digit)
+	}
+	return NewDualTone(low, high, amplitude, sampleRate), nil
+}
+
+// Noise generates uniform white noise
+type Noise struct {
+	amplitude float64
+	rng       *rand.Rand
+}
+
+// NewNoise creates a white noise generator with the given peak amplitude
+func NewNoise(amplitude float64, seed int64) *Noise {
+	return &Noise{
+		amplitude: clampAmplitude(amplitude),
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Fill writes len(samples) samples of noise
+func (n *Noise) Fill(samples []int16) {
+	for i := range samples {
+		samples[i] = toSample(n.amplitude * (n.rng.Float64()*2 - 1))
+	}
+}
+
+// Sweep generates a phase-continuous linear frequency sweep that restarts
+// from the start frequency after each period
+type Sweep struct {
+	start, end float64
+	period     int // Samples per sweep
+	amplitude  float64
+	sampleRate float64
+	position   int
+	phase      float64
+}
+
+// NewSweep creates a sweep from start to end Hz over period
+func NewSweep(start, end float64, period time.Duration, amplitude float64, sampleRate int) *Sweep {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	samples := int(period.Seconds() * float64(sampleRate))
+	if samples <= 0 {
+		samples = sampleRate
+	}
+	return &Sweep{
+		start:      start,
+		end:        end,
+		period:     samples,
+		amplitude:  clampAmplitude(amplitude),
+		sampleRate: float64(sampleRate),
+	}
+}
+
+// Frequency returns the instantaneous frequency of the next sample
+func (s *Sweep) Frequency() float64 {
+	progress := float64(s.position) / float64(s.period)
+	return s.start + (s.end-s.start)*progress
+}
+
+// Fill writes the next len(samples) samples of the sweep
+func (s *Sweep) Fill(samples []int16) {
+	for i := range samples {
+		samples[i] = toSample(s.amplitude * math.Sin(s.phase))
+		s.phase = math.Mod(s.phase+2*math.Pi*s.Frequency()/s.sampleRate, 2*math.Pi)
+		s.position++
+		if s.position >= s.period {
+			s.position = 0
+		}
+	}
+}
+
+// Silence generates digital silence
+type Silence struct{}
+
+// Fill zeroes samples
+func (Silence) Fill(samples []int16) {
+	for i := range samples {
+		samples[i] = 0
+	}
+}
@@ -0,0 +1,184 @@
+package signal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// goertzel returns the relative power of frequency in samples
+func goertzel(samples []int16, frequency float64, sampleRate int) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*frequency/float64(sampleRate))
+	var s1, s2 float64
+	for _, x := range samples {
+		s0 := float64(x) + coeff*s1 - s2
+		s2, s1 = s1, s0
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+func peak(samples []int16) int {
+	p := 0
+	for _, s := range samples {
+		v := int(s)
+		if v < 0 {
+			v = -v
+		}
+		if v > p {
+			p = v
+		}
+	}
+	return p
+}
+
+func TestSine_FullScaleDoesNotOverflow(t *testing.T) {
+	samples := make([]int16, 8000)
+	NewSine(1000, 1.0, 8000).Fill(samples)
+
+	if p := peak(samples); p < 32000 {
+		t.Errorf("Expected near full-scale peak, got %d", p)
+	}
+
+	// A wrapped sample shows up as a sign flip between neighbours near the peak
+	for i := 1; i < len(samples); i++ {
+		if d := int(samples[i]) - int(samples[i-1]); d > 30000 || d < -30000 {
+			t.Fatalf("Discontinuity at sample %d: %d -> %d", i, samples[i-1], samples[i])
+		}
+	}
+}
+
+func TestSine_Frequency(t *testing.T) {
+	samples := make([]int16, 8000)
+	NewSine(440, DBFS(-6), 8000).Fill(samples)
+
+	crossings := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			crossings++
+		}
+	}
+	if crossings < 878 || crossings > 882 {
+		t.Errorf("Expected ~880 zero crossings for 440 Hz, got %d", crossings)
+	}
+
+	if p := peak(samples); math.Abs(float64(p)-0.501*32767) > 100 {
+		t.Errorf("Expected -6 dBFS peak (~16400), got %d", p)
+	}
+}
+
+func TestDTMF(t *testing.T) {
+	if _, err := NewDTMF('X', 0.5, 8000); err == nil {
+		t.Error("Expected error for invalid digit")
+	}
+
+	gen, err := NewDTMF('5', 1.0, 8000)
+	if err != nil {
+		t.Fatalf("NewDTMF failed: %v", err)
+	}
+	samples := make([]int16, 800)
+	gen.Fill(samples)
+
+	if p := peak(samples); p > math.MaxInt16 {
+		t.Errorf("Peak out of range: %d", p)
+	}
+
+	tone := goertzel(samples, 770, 8000) + goertzel(samples, 1336, 8000)
+	other := goertzel(samples, 697, 8000) + goertzel(samples, 1209, 8000)
+	if tone < 100*other {
+		t.Errorf("DTMF '5' energy not concentrated at 770/1336 Hz: %.3g vs %.3g", tone, other)
+	}
+}
+
+func TestNoise_Amplitude(t *testing.T) {
+	samples := make([]int16, 8000)
+	NewNoise(0.25, 1).Fill(samples)
+
+	if p := peak(samples); p > 8192 || p < 7000 {
+		t.Errorf("Expected peak just under 8192, got %d", p)
+	}
+}
+
+func TestSweep_Restarts(t *testing.T) {
+	sweep := NewSweep(300, 3000, 100*time.Millisecond, 0.5, 8000)
+	samples := make([]int16, 400)
+
+	sweep.Fill(samples)
+	if f := sweep.Frequency(); f < 1600 || f > 1700 {
+		t.Errorf("Expected ~1650 Hz halfway through, got %.0f", f)
+	}
+
+	sweep.Fill(samples)
+	if f := sweep.Frequency(); f != 300 {
+		t.Errorf("Expected sweep to restart at 300 Hz, got %.0f", f)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	// 50ms at 8kHz: two whole 20ms frames and a half frame padded out
+	frames, err := Frames(Spec{Pattern: PatternSine, Frequency: 440, Amplitude: 0.25, Duration: 50 * time.Millisecond}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("Got %d frames, want 3", len(frames))
+	}
+	for i, frame := range frames {
+		if len(frame) != 160 {
+			t.Fatalf("Frame %d has %d samples", i, len(frame))
+		}
+	}
+	if p := peak(frames[0]); math.Abs(float64(p)-0.25*32767) > 100 {
+		t.Errorf("Peak %d, want ~8192", p)
+	}
+	if p := peak(frames[2][80:]); p != 0 {
+		t.Errorf("Padding peaks at %d", p)
+	}
+
+	// Defaults fill in whatever the spec leaves out
+	for _, pattern := range []Pattern{PatternSilence, PatternSine, PatternNoise, PatternSweep, PatternDTMF} {
+		frames, err := Frames(Spec{Pattern: pattern}, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", pattern, err)
+		}
+		if len(frames) != 50 {
+			t.Errorf("%s: one second gave %d frames", pattern, len(frames))
+		}
+		if p := peak(frames[10]); (p == 0) != (pattern == PatternSilence) {
+			t.Errorf("%s: peak %d", pattern, p)
+		}
+	}
+
+	if _, err := New(Spec{Pattern: "voice"}); err == nil {
+		t.Error("Created an unknown pattern")
+	}
+	if _, err := New(Spec{Pattern: PatternDTMF, Digits: "12X"}); err == nil {
+		t.Error("Created DTMF with an invalid digit")
+	}
+}
+
+func TestDTMFSequence(t *testing.T) {
+	seq, err := NewDTMFSequence("19", 50*time.Millisecond, 50*time.Millisecond, 0.5, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill in odd sizes to cross the digit boundaries mid-call
+	samples := make([]int16, 1600)
+	for n := 0; n < len(samples); n += 70 {
+		seq.Fill(samples[n:min(n+70, len(samples))])
+	}
+
+	one, gap, nine := samples[:400], samples[400:800], samples[800:1200]
+	if goertzel(one, 697, 8000) < 100*goertzel(one, 852, 8000) {
+		t.Error("First digit is not '1'")
+	}
+	if p := peak(gap); p != 0 {
+		t.Errorf("Gap peaks at %d", p)
+	}
+	if goertzel(nine, 852, 8000) < 100*goertzel(nine, 697, 8000) {
+		t.Error("Second digit is not '9'")
+	}
+	if seq.Digit() != 0 {
+		t.Errorf("Sequence at digit %d after both played, want 0", seq.Digit())
+	}
+}
@@ -0,0 +1,119 @@
+package audio
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// soxFormats maps the FFmpeg raw format names SoX can handle to SoX's
+// file type options. SoX only does uncompressed and G.711 audio here;
+// anything else needs FFmpeg.
+var soxFormats = map[string][]string{
+	"s16le": {"-t", "raw", "-e", "signed-integer", "-b", "16", "-L"},
+	"s16be": {"-t", "raw", "-e", "signed-integer", "-b", "16", "-B"},
+	"u8":    {"-t", "raw", "-e", "unsigned-integer", "-b", "8"},
+	"s8":    {"-t", "raw", "-e", "signed-integer", "-b", "8"},
+	"f32le": {"-t", "raw", "-e", "floating-point", "-b", "32", "-L"},
+	"mulaw": {"-t", "raw", "-e", "mu-law", "-b", "8"},
+	"alaw":  {"-t", "raw", "-e", "a-law", "-b", "8"},
+}
+
+// soxSupports reports whether SoX can convert between config's formats
+func soxSupports(config *ConverterConfig) bool {
+	_, encodes := soxFormats[config.OutputFormat]
+	_, decodes := soxFormats[config.InputFormat]
+	return encodes && (decodes || config.EncodeOnly)
+}
+
+// soxPath returns the SoX binary config runs
+func soxPath(config *ConverterConfig) string {
+	if config.SoXPath != "" {
+		return config.SoXPath
+	}
+	return "sox"
+}
+
+// NewSoXConverter creates a streaming converter that runs SoX instead of
+// FFmpeg. SoX starts faster and is far smaller than FFmpeg, which suits
+// rate and sample format changes between raw PCM formats (and G.711), but
+// it cannot encode compressed formats such as Opus or MP3.
+func NewSoXConverter(config *ConverterConfig) (*StreamingConverter, error) {
+	if !soxSupports(config) {
+		return nil, fmt.Errorf("SoX cannot convert between %q and %q", config.InputFormat, config.OutputFormat)
+	}
+	return newStreamingConverter(config, "SoX", (*StreamingConverter).initSoXProcesses)
+}
+
+// initSoXProcesses sets up SoX processes for bidirectional conversion
+func (sc *StreamingConverter) initSoXProcesses(config *ConverterConfig) error {
+	path := soxPath(config)
+
+	// USRP (PCM) -> Target format
+	toFormatArgs := soxArgs(
+		soxFormats["s16le"], config.InputRate, 1,
+		soxFormats[config.OutputFormat], config.OutputRate, config.Channels)
+	sc.toFormat = &ffmpegProcess{program: "SoX", name: "to-format", path: path, args: toFormatArgs}
+	if err := sc.launch(sc.toFormat); err != nil {
+		return err
+	}
+	if config.EncodeOnly {
+		return nil
+	}
+
+	// Target format -> USRP (PCM)
+	fromFormatArgs := soxArgs(
+		soxFormats[config.InputFormat], config.OutputRate, config.Channels,
+		soxFormats["s16le"], USRPSampleRate, sc.downmix.channels())
+	sc.fromFormat = &ffmpegProcess{program: "SoX", name: "from-format", path: path, args: fromFormatArgs}
+	return sc.launch(sc.fromFormat)
+}
+
+// soxArgs returns the arguments converting stdin to stdout. SoX resamples
+// and remixes by itself when the rates or channels differ.
+func soxArgs(in []string, inRate, inChannels int, out []string, outRate, outChannels int) []string {
+	args := []string{
+		"-q", "-V1", // No progress, errors only
+		"--buffer", "320", // One USRP frame, so output is not held back
+	}
+	args = append(args, in...)
+	args = append(args, "-r", fmt.Sprintf("%d", inRate), "-c", fmt.Sprintf("%d", inChannels), "-")
+	args = append(args, out...)
+	return append(args, "-r", fmt.Sprintf("%d", outRate), "-c", fmt.Sprintf("%d", outChannels), "-")
+}
+
+// newAutoConverter tries each backend able to handle config, lightest
+// first: SoX for plain PCM work, then FFmpeg, then GStreamer when built
+// in. A backend whose binary is missing, or that fails to start, is
+// skipped for the next.
+func newAutoConverter(config *ConverterConfig) (Converter, error) {
+	var failures []string
+
+	if !soxSupports(config) {
+		failures = append(failures, fmt.Sprintf("sox: cannot convert %q/%q", config.InputFormat, config.OutputFormat))
+	} else if _, err := exec.LookPath(soxPath(config)); err != nil {
+		failures = append(failures, fmt.Sprintf("sox: %v", err))
+	} else if converter, err := NewSoXConverter(config); err != nil {
+		failures = append(failures, fmt.Sprintf("sox: %v", err))
+	} else {
+		return converter, nil
+	}
+
+	if _, err := exec.LookPath(config.ffmpegPath()); err != nil {
+		failures = append(failures, fmt.Sprintf("ffmpeg: %v", err))
+	} else if converter, err := NewStreamingConverter(config); err != nil {
+		failures = append(failures, fmt.Sprintf("ffmpeg: %v", err))
+	} else {
+		return converter, nil
+	}
+
+	if !gstreamerAvailable {
+		failures = append(failures, "gstreamer: not built in")
+	} else if converter, err := newGStreamerConverter(config); err != nil {
+		failures = append(failures, fmt.Sprintf("gstreamer: %v", err))
+	} else {
+		return converter, nil
+	}
+
+	return nil, fmt.Errorf("no converter backend available (%s)", strings.Join(failures, "; "))
+}
@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSoXConverter_Args(t *testing.T) {
+	// The fake records its arguments beside itself
+	config := fakeFFmpeg(t, `echo "$@" >> "$0.args"; exec cat`)
+	config.SoXPath = config.FFmpegPath
+	config.OutputRate = 16000
+	config.Backend = BackendSoX
+	converter, err := NewConverter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.Close()
+
+	var lines []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(lines) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for both processes, got %q", lines)
+		}
+		time.Sleep(5 * time.Millisecond)
+		data, _ := os.ReadFile(config.SoXPath + ".args")
+		lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	pcm := "-t raw -e signed-integer -b 16 -L"
+	want := map[string]bool{
+		pcm + " -r 8000 -c 1 - " + pcm + " -r 16000 -c 1 -": false, // Encoder resamples up
+		pcm + " -r 16000 -c 1 - " + pcm + " -r 8000 -c 1 -": false, // Decoder back down
+	}
+	for _, line := range lines {
+		for args := range want {
+			if strings.HasSuffix(line, args) {
+				want[args] = true
+			}
+		}
+	}
+	for args, seen := range want {
+		if !seen {
+			t.Errorf("Expected a process run with %q, got %q", args, lines)
+		}
+	}
+
+	config.OutputFormat = "opus"
+	if _, err := NewSoXConverter(config); err == nil {
+		t.Error("Expected SoX to refuse a compressed format")
+	}
+}
+
+func TestNewConverter_Auto(t *testing.T) {
+	config := fakeFFmpeg(t, "exec cat")
+	config.Backend = BackendAuto
+	fake := config.FFmpegPath
+
+	program := func() string {
+		t.Helper()
+		converter, err := NewConverter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer converter.Close()
+		return converter.(*StreamingConverter).toFormat.program
+	}
+
+	// SoX is preferred for PCM
+	config.SoXPath = fake
+	if got := program(); got != "SoX" {
+		t.Errorf("Expected SoX for PCM, got %s", got)
+	}
+
+	// FFmpeg takes over for formats SoX lacks
+	config.OutputFormat = "opus"
+	if got := program(); got != "FFmpeg" {
+		t.Errorf("Expected FFmpeg for Opus, got %s", got)
+	}
+	config.OutputFormat = "s16le"
+
+	// and when SoX is missing
+	config.SoXPath = filepath.Join(t.TempDir(), "missing")
+	if got := program(); got != "FFmpeg" {
+		t.Errorf("Expected FFmpeg without SoX, got %s", got)
+	}
+
+	config.FFmpegPath = config.SoXPath
+	if _, err := NewConverter(config); err == nil || !strings.Contains(err.Error(), "no converter backend") {
+		t.Errorf("Expected an error listing the backends tried, got %v", err)
+	}
+}
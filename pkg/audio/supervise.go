@@ -0,0 +1,306 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FFmpeg restart backoff. A process that ran for ffmpegStableRun before
+// dying restarts after ffmpegRestartMin again.
+var (
+	ffmpegRestartMin = 100 * time.Millisecond
+	ffmpegRestartMax = 10 * time.Second
+	ffmpegStableRun  = 30 * time.Second
+)
+
+// ffmpegExitWait bounds how long a failed write or read waits for FFmpeg's
+// exit status and last words
+const ffmpegExitWait = 100 * time.Millisecond
+
+// ffmpegFlushWait bounds how long a flush waits for FFmpeg to write out
+// what it holds and exit
+const ffmpegFlushWait = 500 * time.Millisecond
+
+// stderrTailSize bounds the FFmpeg stderr kept for error messages
+const stderrTailSize = 2048
+
+// stderrTail keeps the end of an FFmpeg process's stderr
+type stderrTail struct {
+	mutex sync.Mutex
+	buf   []byte
+}
+
+// Write appends stderr output, dropping the oldest beyond stderrTailSize
+func (st *stderrTail) Write(p []byte) (int, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.buf = append(st.buf, p...)
+	if len(st.buf) > stderrTailSize {
+		st.buf = st.buf[:copy(st.buf, st.buf[len(st.buf)-stderrTailSize:])]
+	}
+	return len(p), nil
+}
+
+// String returns the last few lines of stderr on one line
+func (st *stderrTail) String() string {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	lines := strings.FieldsFunc(string(st.buf), func(r rune) bool { return r == '\n' || r == '\r' })
+	return strings.Join(lines[max(0, len(lines)-3):], "; ")
+}
+
+// ffmpegProcess is one direction's FFmpeg pipeline. Its fields are guarded
+// by the owning converter's mutex.
+type ffmpegProcess struct {
+	program  string   // "FFmpeg" or "SoX", for messages
+	name     string   // "to-format" or "from-format", for messages
+	path     string   // Binary
+	args     []string // Kept to restart with
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   io.ReadCloser
+	stderr   *stderrTail
+	exited   chan struct{} // Closed once cmd.Wait returns
+	running  bool
+	started  time.Time
+	exitErr  error // Why the process last exited or failed to start
+	restarts int
+}
+
+// start launches the process with fresh pipes
+func (p *ffmpegProcess) start() error {
+	cmd := exec.Command(p.path, p.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// Not StdoutPipe: Wait would close it as soon as the process exits,
+	// losing output a flush has yet to read
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	stderr := &stderrTail{}
+	cmd.Stderr = stderr
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return fmt.Errorf("failed to start %s %s: %w", p.name, p.program, err)
+	}
+
+	if p.stdout != nil {
+		p.stdout.Close()
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	p.cmd, p.stdin, p.stdout, p.stderr = cmd, stdin, stdout, stderr
+	p.exited = exited
+	p.running, p.started = true, time.Now()
+	return nil
+}
+
+// failure adds the end of FFmpeg's stderr, which usually says what went
+// wrong, to err
+func (p *ffmpegProcess) failure(err error) error {
+	if tail := p.stderr.String(); tail != "" {
+		return fmt.Errorf("%w (%s: %s)", err, strings.ToLower(p.program), tail)
+	}
+	return err
+}
+
+// died explains a broken pipe: it waits briefly for the process to exit
+// so the error carries the exit status and stderr
+func (p *ffmpegProcess) died(err error) error {
+	select {
+	case <-p.exited:
+		err = fmt.Errorf("%s %s process died: %s", p.program, p.name, p.cmd.ProcessState)
+	case <-time.After(ffmpegExitWait):
+	}
+	return p.failure(err)
+}
+
+// write sends data to FFmpeg, failing fast while the process is down
+func (p *ffmpegProcess) write(data []byte) error {
+	if !p.running {
+		return fmt.Errorf("%s %s process is down: %w", p.program, p.name, p.exitErr)
+	}
+	if _, err := p.stdin.Write(data); err != nil {
+		return p.died(err)
+	}
+	return nil
+}
+
+// readError explains an error reading FFmpeg's output. End of output means
+// the process died; anything else, such as a timeout, is returned as is.
+func (p *ffmpegProcess) readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, os.ErrClosed) {
+		return p.died(err)
+	}
+	return err
+}
+
+// recycle ends p's input, collects what FFmpeg writes out before exiting,
+// and starts a fresh process in its place so codec state starts over. The
+// supervisor sees the old process exit and follows the new one without
+// counting a restart. Must be called with the mutex held.
+func (sc *StreamingConverter) recycle(p *ffmpegProcess) ([]byte, error) {
+	if !p.running {
+		return nil, fmt.Errorf("%s %s process is down: %w", p.program, p.name, p.exitErr)
+	}
+	p.stdin.Close()
+
+	var out []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := sc.readWithTimeout(p.stdout, buf, ffmpegFlushWait)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	// Killed if it dawdles
+	select {
+	case <-p.exited:
+	case <-time.After(ffmpegFlushWait):
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+
+	if err := p.start(); err != nil {
+		p.running, p.exitErr = false, err
+		return out, err
+	}
+	return out, nil
+}
+
+// stop closes the pipes and kills the process
+func (p *ffmpegProcess) stop() {
+	if p.cmd == nil {
+		return // Never started
+	}
+	p.stdin.Close()
+	p.stdout.Close()
+	if p.running {
+		p.cmd.Process.Kill()
+	}
+}
+
+// launch starts p under supervision
+func (sc *StreamingConverter) launch(p *ffmpegProcess) error {
+	if err := p.start(); err != nil {
+		return err
+	}
+	sc.supervisors.Add(1)
+	go sc.supervise(p)
+	return nil
+}
+
+// supervise waits for p to exit and restarts it, backing off while it keeps
+// failing, until the converter closes
+func (sc *StreamingConverter) supervise(p *ffmpegProcess) {
+	defer sc.supervisors.Done()
+
+	delay := ffmpegRestartMin
+	for {
+		sc.mutex.Lock()
+		cmd, exited := p.cmd, p.exited
+		sc.mutex.Unlock()
+		<-exited
+
+		sc.mutex.Lock()
+		if p.cmd != cmd {
+			// Recycled by a flush; follow the new process
+			sc.mutex.Unlock()
+			continue
+		}
+		p.running = false
+		err := fmt.Errorf("exited")
+		if state := cmd.ProcessState; state != nil && !state.Success() {
+			err = errors.New(state.String())
+		}
+		p.exitErr = p.failure(err)
+		closed := sc.closed
+		if time.Since(p.started) >= ffmpegStableRun {
+			delay = ffmpegRestartMin
+		}
+		sc.mutex.Unlock()
+		if closed {
+			return
+		}
+		log.Printf("%s %s process died: %v", p.program, p.name, p.exitErr)
+
+		for {
+			select {
+			case <-sc.done:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, ffmpegRestartMax)
+
+			sc.mutex.Lock()
+			if sc.closed {
+				sc.mutex.Unlock()
+				return
+			}
+			err := p.start()
+			if err == nil {
+				p.restarts++
+			} else {
+				p.exitErr = err
+			}
+			sc.mutex.Unlock()
+
+			if err == nil {
+				break
+			}
+			log.Printf("Failed to restart %s %s process: %v", p.program, p.name, err)
+		}
+	}
+}
+
+// ConverterHealth reports the state of a converter's FFmpeg processes
+type ConverterHealth struct {
+	Healthy   bool   `json:"healthy"`              // Every FFmpeg process is running
+	Restarts  int    `json:"restarts"`             // FFmpeg restarts since the converter started
+	LastError string `json:"last_error,omitempty"` // Why an FFmpeg process last died, with its stderr
+}
+
+// HealthReporter is implemented by converters that depend on external
+// processes
+type HealthReporter interface {
+	Health() ConverterHealth
+}
+
+// Health reports whether the FFmpeg processes are up, how often they have
+// been restarted, and the last failure
+func (sc *StreamingConverter) Health() ConverterHealth {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	health := ConverterHealth{Healthy: !sc.closed}
+	for _, p := range sc.processes() {
+		health.Healthy = health.Healthy && p.running
+		health.Restarts += p.restarts
+		if p.exitErr != nil {
+			health.LastError = p.exitErr.Error()
+		}
+	}
+	return health
+}
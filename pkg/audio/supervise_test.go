@@ -0,0 +1,186 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg installs a shell script to stand in for FFmpeg and shortens
+// the restart backoff
+func fakeFFmpeg(t *testing.T, script string) *ConverterConfig {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake FFmpeg needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	restartMin, restartMax := ffmpegRestartMin, ffmpegRestartMax
+	ffmpegRestartMin, ffmpegRestartMax = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() { ffmpegRestartMin, ffmpegRestartMax = restartMin, restartMax })
+
+	return &ConverterConfig{
+		InputFormat:  "s16le",
+		OutputFormat: "s16le",
+		InputRate:    8000,
+		OutputRate:   8000,
+		Channels:     1,
+		FFmpegPath:   path,
+	}
+}
+
+// waitHealth polls until ok accepts the converter's health
+func waitHealth(t *testing.T, sc *StreamingConverter, ok func(ConverterHealth) bool) ConverterHealth {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		health := sc.Health()
+		if ok(health) {
+			return health
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for converter health, last %+v", health)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamingConverter_RestartsFFmpeg(t *testing.T) {
+	// cat passes PCM straight through
+	sc, err := NewStreamingConverter(fakeFFmpeg(t, "exec cat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	if health := sc.Health(); !health.Healthy || health.Restarts != 0 {
+		t.Fatalf("Expected a healthy converter, got %+v", health)
+	}
+	if data, err := sc.USRPToFormat(toneFrame(0)); err != nil || len(data) != 320 {
+		t.Fatalf("Expected 320 bytes back, got %d (%v)", len(data), err)
+	}
+
+	sc.mutex.Lock()
+	sc.toFormat.cmd.Process.Kill()
+	sc.mutex.Unlock()
+
+	health := waitHealth(t, sc, func(h ConverterHealth) bool { return h.Healthy && h.Restarts == 1 })
+	if !strings.Contains(health.LastError, "killed") {
+		t.Errorf("Expected the kill to be reported, got %q", health.LastError)
+	}
+	if data, err := sc.USRPToFormat(toneFrame(1)); err != nil || len(data) != 320 {
+		t.Errorf("Expected conversion to resume after the restart, got %d bytes (%v)", len(data), err)
+	}
+}
+
+func TestStreamingConverter_CapturesStderr(t *testing.T) {
+	sc, err := NewStreamingConverter(fakeFFmpeg(t, "echo \"Unknown encoder 'libopus'\" >&2; exit 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health := waitHealth(t, sc, func(h ConverterHealth) bool { return h.Restarts >= 2 })
+	if !strings.Contains(health.LastError, "Unknown encoder 'libopus'") {
+		t.Errorf("Expected FFmpeg's complaint in the last error, got %q", health.LastError)
+	}
+
+	// Conversions fail with the reason rather than timing out
+	if _, err := sc.USRPToFormat(toneFrame(0)); err == nil || !strings.Contains(err.Error(), "Unknown encoder") {
+		t.Errorf("Expected the FFmpeg failure to surface, got %v", err)
+	}
+
+	start := time.Now()
+	if err := sc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %v", elapsed)
+	}
+	if health := sc.Health(); health.Healthy {
+		t.Error("Expected a closed converter to be unhealthy")
+	}
+}
+
+func TestStreamingConverter_Flush(t *testing.T) {
+	sc, err := NewStreamingConverter(fakeFFmpeg(t, "exec cat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	// Stand in for output FFmpeg holds back until its input ends
+	sc.mutex.Lock()
+	err = sc.toFormat.write([]byte("lookahead"))
+	sc.mutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames, err := sc.FormatToUSRP(make([]byte, 200)); err != nil || len(frames) != 0 {
+		t.Fatalf("Expected 100 samples held, got %d frames (%v)", len(frames), err)
+	}
+
+	tail, final, err := sc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tail) != "lookahead" {
+		t.Errorf("Expected the held output as the tail, got %q", tail)
+	}
+	if len(final) != 1 {
+		t.Errorf("Expected the held samples as one final frame, got %d", len(final))
+	}
+
+	// Fresh processes carry on, and the recycling is not counted as a crash
+	if data, err := sc.USRPToFormat(toneFrame(0)); err != nil || len(data) != 320 {
+		t.Fatalf("Expected 320 bytes back after the flush, got %d (%v)", len(data), err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if health := sc.Health(); !health.Healthy || health.Restarts != 0 {
+		t.Errorf("Expected a healthy converter without restarts, got %+v", health)
+	}
+}
+
+func TestStreamingConverter_FFmpegConfig(t *testing.T) {
+	// The fake records its arguments beside itself
+	config := fakeFFmpeg(t, `echo "$@" >> "$0.args"; exec cat`)
+	config.FFmpeg = &FFmpegConfig{LogLevel: "warning", ExtraArgs: []string{"-application", "voip"}}
+	sc, err := NewStreamingConverter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	var lines []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(lines) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for both processes, got %q", lines)
+		}
+		time.Sleep(5 * time.Millisecond)
+		data, _ := os.ReadFile(config.FFmpegPath + ".args")
+		lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	extra := 0
+	for _, line := range lines {
+		if !strings.Contains(line, "-loglevel warning") {
+			t.Errorf("Expected the configured loglevel, got %q", line)
+		}
+		if strings.Contains(line, "-application") {
+			extra++
+			if !strings.HasSuffix(line, "-application voip pipe:1") {
+				t.Errorf("Expected extra args last among the output options, got %q", line)
+			}
+		}
+	}
+	// Only the encoder takes them
+	if extra != 1 {
+		t.Errorf("Expected extra args on one process, got %d", extra)
+	}
+}
@@ -0,0 +1,210 @@
+// Package tones renders the tones a repeater controller sends: courtesy
+// tones and roger beeps after a transmission, error beeps, DTMF digits
+// regenerated toward analog nodes, and CTCSS under outgoing audio. Output
+// is 16-bit PCM, or keyed 160-sample USRP voice frames ready to send.
+package tones
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// rampTime is the fade at each end of a tone, so tones start and stop
+// without clicks
+const rampTime = 5 * time.Millisecond
+
+// Tone is one step of a sequence: up to two frequencies sounded together
+// (none for a pause) at a peak level in dBFS
+type Tone struct {
+	Frequencies []float64
+	Duration    time.Duration
+	Level       float64
+}
+
+// Sequence is tones played one after another
+type Sequence []Tone
+
+// Duration returns how long the sequence plays
+func (s Sequence) Duration() time.Duration {
+	var total time.Duration
+	for _, tone := range s {
+		total += tone.Duration
+	}
+	return total
+}
+
+// Render returns the sequence as PCM at sampleRate (8000 when zero)
+func (s Sequence) Render(sampleRate int) ([]int16, error) {
+	if sampleRate <= 0 {
+		sampleRate = signal.DefaultSampleRate
+	}
+
+	var out []int16
+	for i, tone := range s {
+		samples := make([]int16, int(tone.Duration.Seconds()*float64(sampleRate)))
+		amplitude := signal.DBFS(tone.Level)
+		switch len(tone.Frequencies) {
+		case 0:
+			// Pause
+		case 1:
+			signal.NewSine(tone.Frequencies[0], amplitude, sampleRate).Fill(samples)
+		case 2:
+			signal.NewDualTone(tone.Frequencies[0], tone.Frequencies[1], amplitude, sampleRate).Fill(samples)
+		default:
+			return nil, fmt.Errorf("tone %d has %d frequencies; at most 2 are supported", i, len(tone.Frequencies))
+		}
+		fade(samples, int(rampTime.Seconds()*float64(sampleRate)))
+		out = append(out, samples...)
+	}
+	return out, nil
+}
+
+// Frames renders the sequence into keyed USRP voice frames numbered from
+// seq, padding the last frame with silence
+func (s Sequence) Frames(seq uint32) ([]*usrp.VoiceMessage, error) {
+	samples, err := s.Render(signal.DefaultSampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []*usrp.VoiceMessage
+	for len(samples) > 0 {
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, seq)}
+		msg.Header.SetPTT(true)
+		samples = samples[copy(msg.AudioData[:], samples):]
+		frames = append(frames, msg)
+		seq++
+	}
+	return frames, nil
+}
+
+// fade ramps the first and last n samples with a raised cosine
+func fade(samples []int16, n int) {
+	n = min(n, len(samples)/2)
+	for i := 0; i < n; i++ {
+		gain := 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(n))
+		samples[i] = int16(float64(samples[i]) * gain)
+		samples[len(samples)-1-i] = int16(float64(samples[len(samples)-1-i]) * gain)
+	}
+}
+
+// courtesyLevel is the peak level of the built-in courtesy tones, well
+// under speech so they never startle
+const courtesyLevel = -12
+
+// beep returns a single tone at the courtesy level
+func beep(frequency float64, ms int) Tone {
+	return Tone{Frequencies: []float64{frequency}, Duration: time.Duration(ms) * time.Millisecond, Level: courtesyLevel}
+}
+
+// pause returns silence
+func pause(ms int) Tone {
+	return Tone{Duration: time.Duration(ms) * time.Millisecond}
+}
+
+// courtesyTones are the built-in tone sets, after the ones common on
+// repeater controllers
+var courtesyTones = map[string]Sequence{
+	"beep":       {beep(880, 100)},
+	"roger":      {beep(1200, 70), beep(1600, 70)},
+	"bumblebee":  {beep(440, 50), beep(554, 50), beep(659, 50), beep(880, 50)},
+	"descending": {beep(1200, 60), beep(900, 60), beep(600, 60)},
+	"error":      {beep(400, 200), pause(100), beep(400, 200)},
+}
+
+// Courtesy returns a built-in tone set by name: "beep", "roger" (a roger
+// beep), "bumblebee", "descending", or "error" (an error beep)
+func Courtesy(name string) (Sequence, error) {
+	sequence, ok := courtesyTones[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown courtesy tone %q (want one of %v)", name, CourtesyNames())
+	}
+	return append(Sequence(nil), sequence...), nil
+}
+
+// CourtesyNames returns the names of the built-in tone sets, sorted
+func CourtesyNames() []string {
+	names := make([]string, 0, len(courtesyTones))
+	for name := range courtesyTones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DTMF returns the sequence keying digits, each sounded for on and
+// followed by off, at a peak level in dBFS
+func DTMF(digits string, on, off time.Duration, level float64) (Sequence, error) {
+	var sequence Sequence
+	for _, digit := range digits {
+		low, high, ok := signal.DTMFFrequencies(digit)
+		if !ok {
+			return nil, fmt.Errorf("invalid DTMF digit: %q", digit)
+		}
+		sequence = append(sequence,
+			Tone{Frequencies: []float64{low, high}, Duration: on, Level: level},
+			Tone{Duration: off})
+	}
+	return sequence, nil
+}
+
+// ctcssTones are the standard EIA CTCSS tones, in Hz
+var ctcssTones = []float64{
+	67.0, 69.3, 71.9, 74.4, 77.0, 79.7, 82.5, 85.4, 88.5, 91.5,
+	94.8, 97.4, 100.0, 103.5, 107.2, 110.9, 114.8, 118.8, 123.0, 127.3,
+	131.8, 136.5, 141.3, 146.2, 150.0, 151.4, 156.7, 159.8, 162.2, 165.5,
+	167.9, 171.3, 173.8, 177.3, 179.9, 183.5, 186.2, 189.9, 192.8, 196.6,
+	199.5, 203.5, 206.5, 210.7, 218.1, 225.7, 229.1, 233.6, 241.8, 250.3,
+	254.1,
+}
+
+// CTCSSTones returns the standard CTCSS tone frequencies, ascending
+func CTCSSTones() []float64 {
+	return append([]float64(nil), ctcssTones...)
+}
+
+// IsCTCSSTone reports whether frequency is a standard CTCSS tone, to
+// within 0.05 Hz
+func IsCTCSSTone(frequency float64) bool {
+	for _, f := range ctcssTones {
+		if math.Abs(f-frequency) < 0.05 {
+			return true
+		}
+	}
+	return false
+}
+
+// CTCSSEncoder mixes a continuous CTCSS tone under audio, for analog
+// nodes whose transmitters do not add their own
+type CTCSSEncoder struct {
+	tone    *signal.Sine
+	scratch []int16
+}
+
+// NewCTCSSEncoder creates an encoder for a standard CTCSS frequency at a
+// peak level in dBFS; around -20 dBFS gives the usual 10-15% of deviation
+func NewCTCSSEncoder(frequency, level float64, sampleRate int) (*CTCSSEncoder, error) {
+	if !IsCTCSSTone(frequency) {
+		return nil, fmt.Errorf("%.1f Hz is not a standard CTCSS tone", frequency)
+	}
+	return &CTCSSEncoder{tone: signal.NewSine(frequency, signal.DBFS(level), sampleRate)}, nil
+}
+
+// Mix adds the tone to samples in place, continuing it from the previous
+// call; the sum saturates rather than wraps
+func (e *CTCSSEncoder) Mix(samples []int16) {
+	if cap(e.scratch) < len(samples) {
+		e.scratch = make([]int16, len(samples))
+	}
+	tone := e.scratch[:len(samples)]
+	e.tone.Fill(tone)
+	for i, t := range tone {
+		sum := int32(samples[i]) + int32(t)
+		samples[i] = int16(max(math.MinInt16, min(math.MaxInt16, sum)))
+	}
+}
@@ -0,0 +1,99 @@
+package tones_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+)
+
+func TestCourtesy_Frames(t *testing.T) {
+	roger, err := tones.Courtesy("roger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := roger.Frames(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 140ms is seven whole 20ms frames
+	if len(frames) != 7 {
+		t.Fatalf("Expected 7 frames, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		if !frame.Header.IsPTT() || frame.Header.Seq != uint32(10+i) {
+			t.Errorf("Frame %d: PTT %v, seq %d", i, frame.Header.IsPTT(), frame.Header.Seq)
+		}
+	}
+
+	// Tones fade in rather than click
+	if first := frames[0].AudioData[0]; first != 0 {
+		t.Errorf("Expected the tone to start from silence, got %d", first)
+	}
+	peak := 0.0
+	for _, s := range frames[3].AudioData {
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+	if want := 32767 * math.Pow(10, -12.0/20); math.Abs(peak-want) > want*0.05 {
+		t.Errorf("Expected a peak near %.0f, got %.0f", want, peak)
+	}
+
+	for _, name := range tones.CourtesyNames() {
+		if _, err := tones.Courtesy(name); err != nil {
+			t.Errorf("Courtesy(%q): %v", name, err)
+		}
+	}
+	if _, err := tones.Courtesy("klaxon"); err == nil {
+		t.Error("Expected error for an unknown tone set")
+	}
+}
+
+func TestDTMF_Regenerated(t *testing.T) {
+	sequence, err := tones.DTMF("147*#D", 80*time.Millisecond, 80*time.Millisecond, -6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := sequence.Frames(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector := audio.NewDTMFDetector(nil)
+	var digits []rune
+	for _, frame := range frames {
+		digits = append(digits, detector.Process(frame.AudioData[:])...)
+	}
+	if string(digits) != "147*#D" {
+		t.Errorf("Detector heard %q", string(digits))
+	}
+
+	if _, err := tones.DTMF("12X", time.Millisecond, time.Millisecond, -6); err == nil {
+		t.Error("Expected error for an invalid digit")
+	}
+}
+
+func TestCTCSSEncoder(t *testing.T) {
+	if _, err := tones.NewCTCSSEncoder(100.1, -20, 8000); err == nil {
+		t.Error("Expected error for a non-standard tone")
+	}
+
+	encoder, err := tones.NewCTCSSEncoder(100.0, -20, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loud audio saturates instead of wrapping
+	frame := make([]int16, 160)
+	for i := range frame {
+		frame[i] = math.MaxInt16
+	}
+	encoder.Mix(frame)
+	for i, s := range frame {
+		if s < math.MaxInt16-3300 {
+			t.Fatalf("Sample %d wrapped to %d", i, s)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+// VADConfig holds voice activity detector settings
+type VADConfig struct {
+	SampleRate     int           `json:"sample_rate"`    // Sample rate (8000 for USRP)
+	Aggressiveness int           `json:"aggressiveness"` // 0 (detects the most speech) to 3 (rejects the most noise), as in WebRTC's VAD modes
+	Hangover       time.Duration `json:"hangover"`       // How long detection stays on after speech stops, bridging gaps between words
+}
+
+// DefaultVADConfig returns a detector for 8kHz audio at aggressiveness 2,
+// holding on 300ms after speech
+func DefaultVADConfig() *VADConfig {
+	return &VADConfig{
+		SampleRate:     8000,
+		Aggressiveness: 2,
+		Hangover:       300 * time.Millisecond,
+	}
+}
+
+// vadBandEdges are the edges of the bands a frame is split into, in Hz;
+// like WebRTC's VAD, the speech band is split finer at the low end
+var vadBandEdges = []float64{80, 250, 500, 1000, 2000, 3000, 4000}
+
+// vadModes holds per-aggressiveness thresholds: how far above its noise
+// floor a band must be to count (dB), how many bands must count, and the
+// quietest frame or band that can be speech (dBFS)
+var vadModes = [4]struct {
+	snr      float64
+	bands    int
+	minLevel float64
+}{
+	{snr: 4, bands: 1, minLevel: -60},
+	{snr: 6, bands: 2, minLevel: -55},
+	{snr: 9, bands: 2, minLevel: -50},
+	{snr: 12, bands: 3, minLevel: -45},
+}
+
+const (
+	// vadNoiseAdapt is how much of each non-speech frame's band level is
+	// blended into the noise floor
+	vadNoiseAdapt = 0.1
+
+	// vadNoiseRise is how fast the noise floor creeps up through speech,
+	// in dB per second, so a source that gets noisier is not taken for
+	// one that never stops talking
+	vadNoiseRise = 3
+)
+
+// VAD detects speech in audio frames. Unlike a level threshold, it judges
+// each band of the speech spectrum against that band's own noise floor,
+// tracked as it goes, so steady hiss or hum at any level is rejected while
+// quiet speech over a clean channel is not. It is a pure Go stand-in for
+// WebRTC's VAD, with the same four aggressiveness modes. Use one VAD per
+// source.
+type VAD struct {
+	sampleRate int
+	mode       int
+	hangover   int // Samples
+
+	noise     []float64 // Noise floor per band, dB
+	estimated bool
+	remaining int // Samples of hangover left
+	active    bool
+
+	mutex sync.Mutex
+}
+
+// NewVAD creates a voice activity detector. A nil config uses
+// DefaultVADConfig; aggressiveness outside 0-3 is clamped.
+func NewVAD(config *VADConfig) *VAD {
+	defaults := DefaultVADConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	cfg.Aggressiveness = min(max(cfg.Aggressiveness, 0), len(vadModes)-1)
+
+	return &VAD{
+		sampleRate: cfg.SampleRate,
+		mode:       cfg.Aggressiveness,
+		hangover:   int(cfg.Hangover.Seconds() * float64(cfg.SampleRate)),
+		noise:      make([]float64, len(vadBandEdges)-1),
+	}
+}
+
+// Process judges a frame of samples, typically 10-30ms, and reports
+// whether speech is active: detected in this frame or within the
+// hangover. An empty frame leaves the decision as it is.
+func (v *VAD) Process(samples []int16) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if len(samples) == 0 {
+		return v.active
+	}
+
+	if v.speech(samples) {
+		v.active = true
+		v.remaining = v.hangover
+	} else if v.remaining -= len(samples); v.remaining < 0 {
+		v.active = false
+		v.remaining = 0
+	}
+	return v.active
+}
+
+// speech decides whether one frame holds speech and updates the noise
+// floors. Must be called with the mutex held.
+func (v *VAD) speech(samples []int16) bool {
+	size := 1
+	for size < len(samples) {
+		size *= 2
+	}
+	spectrum := make([]complex128, size)
+	var sum float64
+	for i, s := range samples {
+		x := float64(s) / 32768
+		sum += x * x
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(samples)))
+		spectrum[i] = complex(x*window, 0)
+	}
+	fft(spectrum, false)
+	level := 10 * math.Log10(sum/float64(len(samples))+1e-12)
+
+	// Band levels, dB
+	levels := make([]float64, len(v.noise))
+	binWidth := float64(v.sampleRate) / float64(size)
+	for b := range levels {
+		var energy float64
+		low := int(math.Ceil(vadBandEdges[b] / binWidth))
+		high := min(int(vadBandEdges[b+1]/binWidth), size/2)
+		for k := low; k <= high; k++ {
+			energy += math.Pow(cmplx.Abs(spectrum[k]), 2)
+		}
+		levels[b] = 10 * math.Log10(energy/float64(len(samples))+1e-12)
+	}
+
+	if !v.estimated {
+		copy(v.noise, levels)
+		v.estimated = true
+	}
+
+	mode := vadModes[v.mode]
+	count := 0
+	for b, l := range levels {
+		// Bands with next to nothing in them swing wildly in dB; skip them
+		if l > mode.minLevel && l-v.noise[b] > mode.snr {
+			count++
+		}
+	}
+	speech := count >= mode.bands && level > mode.minLevel
+
+	rise := vadNoiseRise * float64(len(samples)) / float64(v.sampleRate)
+	for b, l := range levels {
+		switch {
+		case l < v.noise[b]:
+			v.noise[b] = l // Noise is never louder than the quietest frame
+		case speech:
+			v.noise[b] += rise
+		default:
+			v.noise[b] += vadNoiseAdapt * (l - v.noise[b])
+		}
+	}
+	return speech
+}
+
+// Active reports the last decision
+func (v *VAD) Active() bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.active
+}
+
+// Reset forgets the noise floors and ends any hangover
+func (v *VAD) Reset() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.estimated = false
+	v.active = false
+	v.remaining = 0
+}
@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// vadFrame returns 20ms of white noise at noise dBFS plus, when tone is
+// above zero, a 500Hz tone with harmonics at that amplitude
+func vadFrame(rng *rand.Rand, n int, noise float64, tone float64) []int16 {
+	frame := make([]int16, 160)
+	sigma := 32768 * dbToLinear(noise)
+	for i := range frame {
+		t := float64(n*160+i) / 8000
+		v := rng.NormFloat64() * sigma
+		for h := 1; h <= 4; h++ {
+			v += tone / float64(h) * math.Sin(2*math.Pi*500*float64(h)*t)
+		}
+		frame[i] = clampInt16(v)
+	}
+	return frame
+}
+
+func TestVAD_SpeechOverNoise(t *testing.T) {
+	for _, noise := range []float64{-70, -35} {
+		vad := NewVAD(&VADConfig{Aggressiveness: 2, Hangover: 100 * time.Millisecond})
+		rng := rand.New(rand.NewSource(1))
+
+		// Steady noise, however loud, is not speech
+		for n := 0; n < 100; n++ {
+			if vad.Process(vadFrame(rng, n, noise, 0)) && n >= 10 {
+				t.Fatalf("Noise at %.0f dBFS detected as speech at frame %d", noise, n)
+			}
+		}
+
+		// Speech 15 dB over it, at a level speech can have, is
+		amplitude := 32768 * dbToLinear(math.Max(noise+15, -30))
+		for n := 100; n < 150; n++ {
+			if !vad.Process(vadFrame(rng, n, noise, amplitude)) && n >= 102 {
+				t.Fatalf("Speech over %.0f dBFS noise missed at frame %d", noise, n)
+			}
+		}
+
+		// and detection holds for the hangover once it stops
+		held := 0
+		for n := 150; vad.Process(vadFrame(rng, n, noise, 0)); n++ {
+			if held++; held > 20 {
+				t.Fatalf("Detection never ended over %.0f dBFS noise", noise)
+			}
+		}
+		if held != 5 {
+			t.Errorf("Expected 5 frames of hangover, got %d", held)
+		}
+	}
+}
+
+func TestVAD_Aggressiveness(t *testing.T) {
+	// A faint tone barely above the noise counts only at low aggressiveness
+	detected := func(aggressiveness int) int {
+		vad := NewVAD(&VADConfig{Aggressiveness: aggressiveness})
+		rng := rand.New(rand.NewSource(1))
+		for n := 0; n < 50; n++ {
+			vad.Process(vadFrame(rng, n, -40, 0))
+		}
+		count := 0
+		amplitude := 32768 * dbToLinear(-45)
+		for n := 50; n < 100; n++ {
+			if vad.Process(vadFrame(rng, n, -40, amplitude)) {
+				count++
+			}
+		}
+		return count
+	}
+	if low, high := detected(0), detected(3); low <= high {
+		t.Errorf("Expected aggressiveness 0 to detect more than 3, got %d and %d frames", low, high)
+	}
+}
@@ -0,0 +1,175 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// USRPSampleRate is the sample rate of USRP voice frames
+const USRPSampleRate = 8000
+
+// ParseWAV decodes a 16-bit PCM WAV file into interleaved samples
+func ParseWAV(data []byte) (samples []int16, sampleRate int, channels int, err error) {
+	samples, sampleRate, channels, _, err = parseWAV(data)
+	return samples, sampleRate, channels, err
+}
+
+// parseWAV decodes a 16-bit PCM WAV file, also returning the sample frame
+// offsets of its cue points
+func parseWAV(data []byte) (samples []int16, sampleRate int, channels int, cues []int, err error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, 0, nil, fmt.Errorf("not a RIFF/WAVE file")
+	}
+
+	var format, bits uint16
+	var pcm []byte
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			size = len(body) // Tolerate truncated final chunk
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, 0, nil, fmt.Errorf("WAV fmt chunk too short: %d bytes", size)
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bits = binary.LittleEndian.Uint16(body[14:16])
+		case "data":
+			pcm = body
+		case "cue ":
+			// Count, then 24-byte points whose last field is the offset
+			for p := 4; p+24 <= len(body); p += 24 {
+				cues = append(cues, int(binary.LittleEndian.Uint32(body[p+20:p+24])))
+			}
+		}
+
+		// Chunks are word aligned
+		pos += 8 + size + size%2
+	}
+
+	if channels == 0 {
+		return nil, 0, 0, nil, fmt.Errorf("WAV file has no fmt chunk")
+	}
+	// 0xFFFE is WAVE_FORMAT_EXTENSIBLE, which we accept for plain 16-bit PCM
+	if (format != 1 && format != 0xFFFE) || bits != 16 {
+		return nil, 0, 0, nil, fmt.Errorf("unsupported WAV encoding: format %d, %d bits", format, bits)
+	}
+	if pcm == nil {
+		return nil, 0, 0, nil, fmt.Errorf("WAV file has no data chunk")
+	}
+
+	samples = make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	return samples, sampleRate, channels, cues, nil
+}
+
+// ToUSRPFormat downmixes interleaved samples to mono and resamples them to
+// 8kHz with linear interpolation
+func ToUSRPFormat(samples []int16, sampleRate, channels int) []int16 {
+	if channels > 1 {
+		mono := make([]int16, len(samples)/channels)
+		for i := range mono {
+			var sum int
+			for c := 0; c < channels; c++ {
+				sum += int(samples[i*channels+c])
+			}
+			mono[i] = int16(sum / channels)
+		}
+		samples = mono
+	}
+
+	if sampleRate == USRPSampleRate || sampleRate <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	ratio := float64(sampleRate) / USRPSampleRate
+	out := make([]int16, int(float64(len(samples))/ratio))
+	for i := range out {
+		pos := float64(i) * ratio
+		idx := int(pos)
+		frac := pos - float64(idx)
+		a := float64(samples[idx])
+		b := a
+		if idx+1 < len(samples) {
+			b = float64(samples[idx+1])
+		}
+		out[i] = clampInt16(a + (b-a)*frac)
+	}
+	return out
+}
+
+// DecodeFile reads an audio file as 8kHz mono PCM. 16-bit WAV files are
+// decoded natively; anything else (Opus, Ogg, MP3, ...) is handed to FFmpeg.
+func DecodeFile(path string) ([]int16, error) {
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		samples, rate, channels, err := ParseWAV(data)
+		if err == nil {
+			return ToUSRPFormat(samples, rate, channels), nil
+		}
+		// Fall through to FFmpeg for compressed WAV variants
+	}
+
+	cmd := exec.Command("ffmpeg",
+		"-v", "error",
+		"-i", path,
+		"-f", "s16le", // Output: signed 16-bit little-endian
+		"-ar", fmt.Sprintf("%d", USRPSampleRate),
+		"-ac", "1",
+		"pipe:1",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed to decode %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	samples := make([]int16, len(out)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(out[i*2:]))
+	}
+	return samples, nil
+}
+
+// EncodeWAV builds a 16-bit PCM WAV file from interleaved samples
+func EncodeWAV(samples []int16, sampleRate, channels int) []byte {
+	dataSize := len(samples) * 2
+	buf := make([]byte, 44+dataSize)
+
+	copy(buf[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(36+dataSize))
+	copy(buf[8:12], "WAVE")
+	copy(buf[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(buf[16:20], 16)
+	binary.LittleEndian.PutUint16(buf[20:22], 1) // PCM
+	binary.LittleEndian.PutUint16(buf[22:24], uint16(channels))
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(buf[28:32], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(buf[32:34], uint16(channels*2))
+	binary.LittleEndian.PutUint16(buf[34:36], 16)
+	copy(buf[36:40], "data")
+	binary.LittleEndian.PutUint32(buf[40:44], uint32(dataSize))
+
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[44+i*2:], uint16(s))
+	}
+	return buf
+}
@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWAV_RoundTrip tests WAV encoding and parsing
+func TestWAV_RoundTrip(t *testing.T) {
+	samples := []int16{0, 100, -100, 32767, -32768, 42}
+	data := EncodeWAV(samples, 8000, 1)
+
+	got, rate, channels, err := ParseWAV(data)
+	if err != nil {
+		t.Fatalf("ParseWAV failed: %v", err)
+	}
+	if rate != 8000 || channels != 1 {
+		t.Errorf("Format mismatch: got %d Hz / %d ch", rate, channels)
+	}
+	if len(got) != len(samples) {
+		t.Fatalf("Sample count mismatch: got %d, want %d", len(got), len(samples))
+	}
+	for i := range samples {
+		if got[i] != samples[i] {
+			t.Errorf("Sample %d: got %d, want %d", i, got[i], samples[i])
+		}
+	}
+}
+
+// TestParseWAV_Invalid tests rejection of malformed or unsupported files
+func TestParseWAV_Invalid(t *testing.T) {
+	eightBit := EncodeWAV([]int16{1, 2}, 8000, 1)
+	eightBit[34] = 8 // bits per sample
+
+	tests := map[string][]byte{
+		"empty":    nil,
+		"not riff": []byte("OggS0000WAVE"),
+		"8-bit":    eightBit,
+		"no data":  EncodeWAV(nil, 8000, 1)[:36],
+	}
+	for name, data := range tests {
+		if _, _, _, err := ParseWAV(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestToUSRPFormat tests downmixing and resampling to 8kHz mono
+func TestToUSRPFormat(t *testing.T) {
+	// 48kHz stereo, one second, left=1000 right=3000
+	stereo := make([]int16, 48000*2)
+	for i := 0; i < len(stereo); i += 2 {
+		stereo[i] = 1000
+		stereo[i+1] = 3000
+	}
+
+	mono := ToUSRPFormat(stereo, 48000, 2)
+	if len(mono) != 8000 {
+		t.Fatalf("Expected 8000 samples, got %d", len(mono))
+	}
+	for i, s := range mono {
+		if s != 2000 {
+			t.Fatalf("Sample %d: got %d, want 2000", i, s)
+		}
+	}
+}
+
+// TestDecodeFile_WAV tests native decoding of a WAV file on disk
+func TestDecodeFile_WAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "announce.wav")
+	if err := os.WriteFile(path, EncodeWAV(make([]int16, 16000), 16000, 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := DecodeFile(path)
+	if err != nil {
+		t.Fatalf("DecodeFile failed: %v", err)
+	}
+	if len(samples) != 8000 {
+		t.Errorf("Expected 8000 samples, got %d", len(samples))
+	}
+}
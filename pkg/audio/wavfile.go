@@ -0,0 +1,263 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// WAVGapMode selects how a WAVWriter records the time between transmissions
+type WAVGapMode string
+
+const (
+	WAVGapSilence WAVGapMode = "silence" // Fill gaps with silence so the file plays in real time
+	WAVGapMarkers WAVGapMode = "markers" // Drop gaps and mark each transmission with a cue point
+)
+
+// voiceFrameDuration is the length of one USRP voice frame
+const voiceFrameDuration = 20 * time.Millisecond
+
+// WAVWriterConfig holds WAV recording settings
+type WAVWriterConfig struct {
+	Gaps   WAVGapMode    // How gaps between frames are recorded
+	MaxGap time.Duration // Longest silence inserted for one gap
+}
+
+// DefaultWAVWriterConfig returns real-time recording with gaps capped at 5s
+func DefaultWAVWriterConfig() *WAVWriterConfig {
+	return &WAVWriterConfig{
+		Gaps:   WAVGapSilence,
+		MaxGap: 5 * time.Second,
+	}
+}
+
+// WAVWriter records USRP voice frames to an 8 kHz 16-bit mono WAV file.
+// Only keyed frames carry audio; an unkeyed frame ends a transmission. The
+// header is written up front and patched with the final sizes by Close.
+type WAVWriter struct {
+	w       io.WriteSeeker
+	config  *WAVWriterConfig
+	samples int       // Sample frames written
+	markers []int     // Sample offsets where transmissions start
+	keyed   bool      // Inside a transmission
+	lastEnd time.Time // When the last keyed frame finished playing
+	buf     []byte
+	closed  bool
+}
+
+// NewWAVWriter starts a WAV recording on w. A nil config uses
+// DefaultWAVWriterConfig.
+func NewWAVWriter(w io.WriteSeeker, config *WAVWriterConfig) (*WAVWriter, error) {
+	if config == nil {
+		config = DefaultWAVWriterConfig()
+	}
+	if config.Gaps != WAVGapSilence && config.Gaps != WAVGapMarkers {
+		return nil, fmt.Errorf("unknown WAV gap mode %q (want %q or %q)", config.Gaps, WAVGapSilence, WAVGapMarkers)
+	}
+
+	// Sizes are zero until Close
+	if _, err := w.Write(EncodeWAV(nil, USRPSampleRate, 1)); err != nil {
+		return nil, fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	return &WAVWriter{
+		w:      w,
+		config: config,
+		buf:    make([]byte, usrp.VoiceFrameSize*2),
+	}, nil
+}
+
+// WriteMessage records one voice frame that arrived at the given time. With
+// silence gaps, time missing between keyed frames is filled with silence;
+// a zero time records the frame back to back with the previous one.
+func (ww *WAVWriter) WriteMessage(msg *usrp.VoiceMessage, at time.Time) error {
+	if ww.closed {
+		return fmt.Errorf("WAV writer is closed")
+	}
+	if !msg.Header.IsPTT() {
+		ww.keyed = false
+		return nil
+	}
+
+	if !ww.keyed && ww.config.Gaps == WAVGapMarkers {
+		ww.markers = append(ww.markers, ww.samples)
+	}
+	ww.keyed = true
+
+	if ww.config.Gaps == WAVGapSilence && !at.IsZero() && !ww.lastEnd.IsZero() {
+		// Allow a frame of jitter before calling it a gap
+		if gap := at.Sub(ww.lastEnd); gap > voiceFrameDuration {
+			if err := ww.writeSilence(min(gap, ww.config.MaxGap)); err != nil {
+				return err
+			}
+		}
+	}
+	if !at.IsZero() {
+		ww.lastEnd = at.Add(voiceFrameDuration)
+	}
+
+	for i, sample := range msg.AudioData {
+		binary.LittleEndian.PutUint16(ww.buf[i*2:], uint16(sample))
+	}
+	if _, err := ww.w.Write(ww.buf); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	ww.samples += usrp.VoiceFrameSize
+	return nil
+}
+
+// writeSilence appends d of silence
+func (ww *WAVWriter) writeSilence(d time.Duration) error {
+	n := int(d * USRPSampleRate / time.Second)
+	zeros := make([]byte, min(n, usrp.VoiceFrameSize)*2)
+	for remaining := n; remaining > 0; {
+		chunk := min(remaining, usrp.VoiceFrameSize)
+		if _, err := ww.w.Write(zeros[:chunk*2]); err != nil {
+			return fmt.Errorf("failed to write WAV data: %w", err)
+		}
+		remaining -= chunk
+	}
+	ww.samples += n
+	return nil
+}
+
+// Duration returns the length of audio recorded so far
+func (ww *WAVWriter) Duration() time.Duration {
+	return time.Duration(ww.samples) * time.Second / USRPSampleRate
+}
+
+// Markers returns the sample offsets where transmissions start
+func (ww *WAVWriter) Markers() []int {
+	return ww.markers
+}
+
+// Close writes the cue chunk, if any, and patches the header sizes. It does
+// not close the underlying writer.
+func (ww *WAVWriter) Close() error {
+	if ww.closed {
+		return nil
+	}
+	ww.closed = true
+
+	dataSize := ww.samples * 2
+	var tail []byte
+	if len(ww.markers) > 0 {
+		tail = make([]byte, 12, 12+24*len(ww.markers))
+		copy(tail[0:4], "cue ")
+		binary.LittleEndian.PutUint32(tail[4:8], uint32(4+24*len(ww.markers)))
+		binary.LittleEndian.PutUint32(tail[8:12], uint32(len(ww.markers)))
+		for i, offset := range ww.markers {
+			var point [24]byte
+			binary.LittleEndian.PutUint32(point[0:4], uint32(i+1)) // Cue point ID
+			binary.LittleEndian.PutUint32(point[4:8], uint32(offset))
+			copy(point[8:12], "data")
+			binary.LittleEndian.PutUint32(point[20:24], uint32(offset))
+			tail = append(tail, point[:]...)
+		}
+		if _, err := ww.w.Write(tail); err != nil {
+			return fmt.Errorf("failed to write WAV cue points: %w", err)
+		}
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(36+dataSize+len(tail)))
+	if err := ww.patch(4, size[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(size[:], uint32(dataSize))
+	if err := ww.patch(40, size[:]); err != nil {
+		return err
+	}
+	_, err := ww.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// patch overwrites header bytes at offset
+func (ww *WAVWriter) patch(offset int64, data []byte) error {
+	if _, err := ww.w.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek WAV header: %w", err)
+	}
+	if _, err := ww.w.Write(data); err != nil {
+		return fmt.Errorf("failed to update WAV header: %w", err)
+	}
+	return nil
+}
+
+// WAVReader plays a WAV file back as USRP voice frames. Files of any rate
+// and channel count are converted to 8 kHz mono. Cue points, as written by
+// a WAVWriter in marker mode, split the file into separate transmissions;
+// every transmission ends with an unkeyed frame of silence.
+type WAVReader struct {
+	samples []int16
+	bounds  []int // Where each transmission ends: every cue point, then len(samples)
+	pos     int
+	next    int // Index into bounds of the current transmission's end
+	seq     uint32
+}
+
+// NewWAVReader reads a whole 16-bit PCM WAV file from r
+func NewWAVReader(r io.Reader) (*WAVReader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAV file: %w", err)
+	}
+	samples, rate, channels, cues, err := parseWAV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	mono := ToUSRPFormat(samples, rate, channels)
+	var bounds []int
+	for _, cue := range cues {
+		if rate > 0 && rate != USRPSampleRate {
+			cue = int(int64(cue) * USRPSampleRate / int64(rate))
+		}
+		if cue > 0 && cue < len(mono) && (len(bounds) == 0 || cue > bounds[len(bounds)-1]) {
+			bounds = append(bounds, cue)
+		}
+	}
+	bounds = append(bounds, len(mono))
+
+	return &WAVReader{samples: mono, bounds: bounds}, nil
+}
+
+// Duration returns the length of the file's audio
+func (wr *WAVReader) Duration() time.Duration {
+	return time.Duration(len(wr.samples)) * time.Second / USRPSampleRate
+}
+
+// ReadMessage returns the next voice frame, or io.EOF after the final
+// unkey. A transmission's last frame is padded with silence.
+func (wr *WAVReader) ReadMessage() (*usrp.VoiceMessage, error) {
+	if wr.next >= len(wr.bounds) {
+		return nil, io.EOF
+	}
+	wr.seq++
+	msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, wr.seq)}
+
+	end := wr.bounds[wr.next]
+	if wr.pos >= end {
+		// Transmission done: unkey, then move on
+		wr.next++
+		return msg, nil
+	}
+
+	n := copy(msg.AudioData[:], wr.samples[wr.pos:end])
+	wr.pos += n
+	msg.Header.SetPTT(true)
+	return msg, nil
+}
+
+// ReadAll returns every remaining voice frame
+func (wr *WAVReader) ReadAll() []*usrp.VoiceMessage {
+	var messages []*usrp.VoiceMessage
+	for {
+		msg, err := wr.ReadMessage()
+		if err != nil {
+			return messages
+		}
+		messages = append(messages, msg)
+	}
+}
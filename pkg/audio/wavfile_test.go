@@ -0,0 +1,157 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// voiceFrame returns a voice frame filled with value
+func voiceFrame(value int16, ptt bool) *usrp.VoiceMessage {
+	msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, 0)}
+	for i := range msg.AudioData {
+		msg.AudioData[i] = value
+	}
+	msg.Header.SetPTT(ptt)
+	return msg
+}
+
+// recordTwoOvers records three frames, an unkey, and two more frames a
+// second after the first, then reopens the file for reading
+func recordTwoOvers(t *testing.T, config *WAVWriterConfig) (*WAVWriter, *WAVReader) {
+	t.Helper()
+	file, err := os.Create(filepath.Join(t.TempDir(), "recording.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := NewWAVWriter(file, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	frames := []struct {
+		msg *usrp.VoiceMessage
+		at  time.Duration
+	}{
+		{voiceFrame(1000, true), 0},
+		{voiceFrame(1000, true), 20 * time.Millisecond},
+		{voiceFrame(1000, true), 40 * time.Millisecond},
+		{voiceFrame(0, false), 60 * time.Millisecond},
+		{voiceFrame(2000, true), time.Second},
+		{voiceFrame(2000, true), time.Second + 20*time.Millisecond},
+	}
+	for _, f := range frames {
+		if err := writer.WriteMessage(f.msg, start.Add(f.at)); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := writer.WriteMessage(voiceFrame(0, true), time.Time{}); err == nil {
+		t.Error("Expected error writing after Close")
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewWAVReader(file)
+	if err != nil {
+		t.Fatalf("NewWAVReader failed: %v", err)
+	}
+	return writer, reader
+}
+
+func TestWAVWriter_SilenceGaps(t *testing.T) {
+	writer, reader := recordTwoOvers(t, nil)
+
+	// 940ms of silence between the end of frame three and frame four
+	want := 5*usrp.VoiceFrameSize + 940*USRPSampleRate/1000
+	if got := len(reader.samples); got != want {
+		t.Fatalf("Expected %d samples, got %d", want, got)
+	}
+	if writer.Duration() != reader.Duration() {
+		t.Errorf("Writer recorded %v, reader found %v", writer.Duration(), reader.Duration())
+	}
+	if reader.samples[3*usrp.VoiceFrameSize] != 0 || reader.samples[len(reader.samples)-1] != 2000 {
+		t.Error("Gap was not filled with silence")
+	}
+
+	// One transmission, unkeyed at the end
+	messages := reader.ReadAll()
+	for i, msg := range messages[:len(messages)-1] {
+		if !msg.Header.IsPTT() {
+			t.Fatalf("Frame %d unkeyed mid transmission", i)
+		}
+	}
+	if messages[len(messages)-1].Header.IsPTT() {
+		t.Error("Expected a final unkey frame")
+	}
+}
+
+func TestWAVWriter_MaxGap(t *testing.T) {
+	_, reader := recordTwoOvers(t, &WAVWriterConfig{Gaps: WAVGapSilence, MaxGap: 100 * time.Millisecond})
+
+	if want := 5*usrp.VoiceFrameSize + 800; len(reader.samples) != want {
+		t.Errorf("Expected %d samples with the gap capped, got %d", want, len(reader.samples))
+	}
+}
+
+func TestWAVWriter_Markers(t *testing.T) {
+	writer, reader := recordTwoOvers(t, &WAVWriterConfig{Gaps: WAVGapMarkers})
+
+	if markers := writer.Markers(); len(markers) != 2 || markers[0] != 0 || markers[1] != 480 {
+		t.Fatalf("Expected markers at 0 and 480, got %v", markers)
+	}
+	if len(reader.samples) != 5*usrp.VoiceFrameSize {
+		t.Fatalf("Expected gaps dropped, got %d samples", len(reader.samples))
+	}
+
+	// Two transmissions, each ending with an unkey
+	var keys []bool
+	var values []int16
+	for {
+		msg, err := reader.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, msg.Header.IsPTT())
+		values = append(values, msg.AudioData[0])
+	}
+	wantKeys := []bool{true, true, true, false, true, true, false}
+	wantValues := []int16{1000, 1000, 1000, 0, 2000, 2000, 0}
+	if len(keys) != len(wantKeys) {
+		t.Fatalf("Expected %d frames, got %d", len(wantKeys), len(keys))
+	}
+	for i := range wantKeys {
+		if keys[i] != wantKeys[i] || values[i] != wantValues[i] {
+			t.Errorf("Frame %d: got PTT %v value %d, want PTT %v value %d", i, keys[i], values[i], wantKeys[i], wantValues[i])
+		}
+	}
+}
+
+func TestWAVReader_Resamples(t *testing.T) {
+	// 100ms of 16kHz stereo plays back as five 8kHz mono frames and an unkey
+	reader, err := NewWAVReader(bytes.NewReader(EncodeWAV(make([]int16, 1600*2), 16000, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages := reader.ReadAll(); len(messages) != 6 {
+		t.Errorf("Expected 6 frames, got %d", len(messages))
+	}
+
+	if _, err := NewWAVWriter(nil, &WAVWriterConfig{Gaps: "skip"}); err == nil {
+		t.Error("Expected error for unknown gap mode")
+	}
+}
@@ -0,0 +1,136 @@
+package directory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to a directory server
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the directory at baseURL
+// (e.g. "https://directory.example.org")
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish registers or refreshes a hub
+func (c *Client) Publish(ctx context.Context, hub *Hub) error {
+	body, err := json.Marshal(hub)
+	if err != nil {
+		return fmt.Errorf("failed to encode hub: %w", err)
+	}
+	return c.do(ctx, http.MethodPut, "/hubs/"+url.PathEscape(hub.Name), body, nil)
+}
+
+// Withdraw removes a hub registration
+func (c *Client) Withdraw(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/hubs/"+url.PathEscape(name), nil, nil)
+}
+
+// List returns all live hubs
+func (c *Client) List(ctx context.Context) ([]Hub, error) {
+	var hubs []Hub
+	if err := c.do(ctx, http.MethodGet, "/hubs", nil, &hubs); err != nil {
+		return nil, err
+	}
+	return hubs, nil
+}
+
+// Lookup returns a hub by name
+func (c *Client) Lookup(ctx context.Context, name string) (*Hub, error) {
+	var hub Hub
+	if err := c.do(ctx, http.MethodGet, "/hubs/"+url.PathEscape(name), nil, &hub); err != nil {
+		return nil, err
+	}
+	return &hub, nil
+}
+
+// FindTalkGroup returns the hubs hosting talkgroup id
+func (c *Client) FindTalkGroup(ctx context.Context, id uint32) ([]Hub, error) {
+	var hubs []Hub
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/talkgroups/%d", id), nil, &hubs); err != nil {
+		return nil, err
+	}
+	return hubs, nil
+}
+
+// Run publishes hub every interval until ctx is cancelled, then withdraws it
+func (c *Client) Run(ctx context.Context, hub *Hub, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Publish(ctx, hub); err != nil && ctx.Err() == nil {
+			log.Printf("directory: publish %s failed: %v", hub.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			// Use a fresh context: the caller's is already cancelled
+			withdrawCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := c.Withdraw(withdrawCtx, hub.Name); err != nil {
+				log.Printf("directory: withdraw %s failed: %v", hub.Name, err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("directory request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("directory returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode directory response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Package directory implements a small talkgroup directory where federated
+// routers publish the talkgroups they host, so operators can find and link
+// to remote hubs by name instead of exchanging addresses by hand.
+//
+// The server keeps registrations in memory; hubs re-publish periodically and
+// entries expire after the configured TTL.
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TalkGroup is a talkgroup or room hosted by a hub
+type TalkGroup struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Hub is a directory registration
+type Hub struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Endpoint    string      `json:"endpoint"`           // host:port peers link to
+	Protocol    string      `json:"protocol,omitempty"` // "udp" (default), "tcp"
+	TalkGroups  []TalkGroup `json:"talk_groups"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+// Hosts reports whether the hub hosts talkgroup id
+func (h *Hub) Hosts(id uint32) bool {
+	for _, tg := range h.TalkGroups {
+		if tg.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks a registration before it is stored
+func (h *Hub) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("hub name is required")
+	}
+	if h.Endpoint == "" {
+		return fmt.Errorf("hub endpoint is required")
+	}
+	switch h.Protocol {
+	case "", "udp", "tcp":
+	default:
+		return fmt.Errorf("unsupported protocol: %s", h.Protocol)
+	}
+	return nil
+}
+
+// ServerConfig holds directory server settings
+type ServerConfig struct {
+	TTL   time.Duration // How long a registration lives without a refresh
+	Token string        // Shared secret required to publish (empty = open)
+}
+
+// DefaultServerConfig returns a 5 minute TTL with open publishing
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		TTL: 5 * time.Minute,
+	}
+}
+
+// Server is the directory HTTP service
+type Server struct {
+	config *ServerConfig
+	hubs   map[string]*Hub
+	mutex  sync.RWMutex
+	mux    *http.ServeMux
+	now    func() time.Time
+}
+
+// NewServer creates a directory server
+func NewServer(config *ServerConfig) *Server {
+	if config == nil {
+		config = DefaultServerConfig()
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultServerConfig().TTL
+	}
+
+	s := &Server{
+		config: config,
+		hubs:   make(map[string]*Hub),
+		mux:    http.NewServeMux(),
+		now:    time.Now,
+	}
+
+	s.mux.HandleFunc("GET /hubs", s.handleList)
+	s.mux.HandleFunc("PUT /hubs/{name}", s.handlePublish)
+	s.mux.HandleFunc("GET /hubs/{name}", s.handleGet)
+	s.mux.HandleFunc("DELETE /hubs/{name}", s.handleWithdraw)
+	s.mux.HandleFunc("GET /talkgroups/{id}", s.handleTalkGroup)
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Hubs returns the live registrations sorted by name
+func (s *Server) Hubs() []Hub {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	hubs := make([]Hub, 0, len(s.hubs))
+	for name, hub := range s.hubs {
+		if now.After(hub.ExpiresAt) {
+			delete(s.hubs, name)
+			continue
+		}
+		hubs = append(hubs, *hub)
+	}
+	sort.Slice(hubs, func(i, j int) bool { return hubs[i].Name < hubs[j].Name })
+	return hubs
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	return s.config.Token == "" || r.Header.Get("Authorization") == "Bearer "+s.config.Token
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var hub Hub
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&hub); err != nil {
+		http.Error(w, fmt.Sprintf("invalid hub: %v", err), http.StatusBadRequest)
+		return
+	}
+	hub.Name = r.PathValue("name")
+	if err := hub.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := s.now()
+	hub.UpdatedAt = now
+	hub.ExpiresAt = now.Add(s.config.TTL)
+
+	s.mutex.Lock()
+	s.hubs[hub.Name] = &hub
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, hub)
+}
+
+func (s *Server) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mutex.Lock()
+	delete(s.hubs, r.PathValue("name"))
+	s.mutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Hubs())
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, hub := range s.Hubs() {
+		if hub.Name == name {
+			writeJSON(w, http.StatusOK, hub)
+			return
+		}
+	}
+	http.Error(w, "hub not found", http.StatusNotFound)
+}
+
+func (s *Server) handleTalkGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid talkgroup", http.StatusBadRequest)
+		return
+	}
+
+	hubs := []Hub{}
+	for _, hub := range s.Hubs() {
+		if hub.Hosts(uint32(id)) {
+			hubs = append(hubs, hub)
+		}
+	}
+	writeJSON(w, http.StatusOK, hubs)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("directory: encode response error: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package directory
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectory_PublishAndDiscover(t *testing.T) {
+	server := NewServer(&ServerConfig{TTL: time.Minute, Token: "secret"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := NewClient(ts.URL, "secret")
+
+	hubs := []*Hub{
+		{Name: "east", Endpoint: "east.example.org:34001", TalkGroups: []TalkGroup{{ID: 3100, Name: "USA"}, {ID: 91}}},
+		{Name: "west", Endpoint: "west.example.org:34001", Protocol: "tcp", TalkGroups: []TalkGroup{{ID: 3100}}},
+	}
+	for _, hub := range hubs {
+		if err := client.Publish(ctx, hub); err != nil {
+			t.Fatalf("Publish %s failed: %v", hub.Name, err)
+		}
+	}
+
+	list, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "east" || list[1].Name != "west" {
+		t.Fatalf("Unexpected hub list: %+v", list)
+	}
+
+	hosting, err := client.FindTalkGroup(ctx, 91)
+	if err != nil {
+		t.Fatalf("FindTalkGroup failed: %v", err)
+	}
+	if len(hosting) != 1 || hosting[0].Endpoint != "east.example.org:34001" {
+		t.Errorf("Unexpected hubs for TG 91: %+v", hosting)
+	}
+
+	hub, err := client.Lookup(ctx, "west")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if hub.Protocol != "tcp" || hub.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected hub: %+v", hub)
+	}
+
+	if err := client.Withdraw(ctx, "west"); err != nil {
+		t.Fatalf("Withdraw failed: %v", err)
+	}
+	if _, err := client.Lookup(ctx, "west"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 after withdraw, got %v", err)
+	}
+}
+
+func TestDirectory_AuthAndValidation(t *testing.T) {
+	ts := httptest.NewServer(NewServer(&ServerConfig{Token: "secret"}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	hub := &Hub{Name: "east", Endpoint: "east.example.org:34001"}
+	if err := NewClient(ts.URL, "wrong").Publish(ctx, hub); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected 401 with wrong token, got %v", err)
+	}
+
+	client := NewClient(ts.URL, "secret")
+	if err := client.Publish(ctx, &Hub{Name: "east"}); err == nil {
+		t.Error("Expected error for hub without endpoint")
+	}
+	if err := client.Publish(ctx, &Hub{Name: "east", Endpoint: "x:1", Protocol: "sctp"}); err == nil {
+		t.Error("Expected error for unsupported protocol")
+	}
+
+	// Reads need no token
+	if _, err := NewClient(ts.URL, "").List(ctx); err != nil {
+		t.Errorf("List without token failed: %v", err)
+	}
+}
+
+func TestDirectory_Expiry(t *testing.T) {
+	server := NewServer(&ServerConfig{TTL: time.Minute})
+	now := time.Now()
+	server.now = func() time.Time { return now }
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "")
+	if err := client.Publish(context.Background(), &Hub{Name: "east", Endpoint: "east:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Hubs()) != 1 {
+		t.Fatal("Expected one live hub")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if len(server.Hubs()) != 0 {
+		t.Error("Expected registration to expire")
+	}
+}
@@ -9,22 +9,53 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/internal/transport"
 )
 
+// botStatus is the bot's presence while idle
+const botStatus = "Amateur Radio Bridge 📻"
+
 // Bot represents a Discord bot with voice capabilities
 type Bot struct {
 	session   *discordgo.Session
 	guildID   string
 	channelID string
 	voiceConn *discordgo.VoiceConnection
+	voiceDone chan struct{} // Closed when voiceConn is left
+
+	// Rejoining the voice channel when the connection drops
+	wantVoice  bool          // In a voice channel by request, so rejoin it
+	reconnects uint64        // Voice connections rejoined
+	done       chan struct{} // Closed by Stop
+
+	// Receives and decodes Discord voice for AudioIn, and encodes AudioOut
+	receiver *receiver
+	sender   *sender
+
+	// What members may do, from their roles
+	permissions *permissions
+
+	// Spacing of routine REST requests, within Discord's rate limits
+	rest *restLimiter
+
+	// Voice traffic and gateway latency, for Metrics
+	metrics transport.Metrics
+
+	// Speakers on a Stage channel, who alone may key the radio there
+	stage stageFloor
 
 	// Audio channels for bridging
 	AudioIn  chan []byte // PCM audio from Discord
 	AudioOut chan []byte // PCM audio to Discord
 
+	// Announcements to Discord, mixed over AudioOut
+	announcements chan []byte
+
 	// Control channels
 	stopChan chan bool
 	running  bool
+	managed  bool     // The session belongs to a BotManager, shared with other guilds' bots
+	handlers []func() // Removes the session event handlers
 	mutex    sync.Mutex
 
 	// Configuration
@@ -33,13 +64,39 @@ type Bot struct {
 
 // BotConfig holds Discord bot configuration
 type BotConfig struct {
-	Token      string        // Discord bot token
+	Token      Secret        // Discord bot token
 	GuildID    string        // Discord server (guild) ID
 	ChannelID  string        // Voice channel ID to join
 	SampleRate int           // Audio sample rate (48000 for Discord)
 	Channels   int           // Audio channels (2 for Discord stereo)
 	FrameSize  time.Duration // Audio frame duration (20ms)
 	BufferSize int           // Audio buffer size
+	Bitrate    int           // Opus bitrate of audio sent, in bits/s (64000)
+
+	// Voice connection recovery
+	HealthCheck    time.Duration // How often the voice connection is checked; one down this long is rejoined (5s)
+	ReconnectDelay time.Duration // Delay after a failed rejoin, doubling up to a minute (1s)
+
+	// Identification of Discord users on the radio
+	Callsigns       map[string]string // Discord user ID to callsign or name
+	RequireCallsign bool              // Hear only users in Callsigns
+
+	// Permissions by Discord role, so only licensed or verified members key
+	// the radio. A member has the highest permission of their roles.
+	Roles             map[string]Permission // Role ID to permission (nil = everyone may talk and command)
+	DefaultPermission Permission            // Members with none of Roles ("listen")
+
+	// Per-user keying of the radio: each user's voice detection, hangtime
+	// and longest transmission, in place of the bridge's VoiceThreshold
+	TalkProfiles map[string]TalkProfile // Discord user ID to profile (nil with no TalkProfile = keyed by the bridge)
+	TalkProfile  *TalkProfile           // Users not in TalkProfiles (nil = DefaultTalkProfile)
+
+	// Stage channels: the bot speaks on the stage, and only the speakers
+	// moderators invite up key the radio
+	StageTopic string // Topic the stage is started with if not already live ("" = leave it to moderators)
+
+	// Link metrics of the voice traffic, as the router keeps for its links
+	Metrics transport.Metrics // nil = the bot's own, from Bot.Metrics
 }
 
 // DefaultBotConfig returns default configuration for Discord bot
@@ -49,6 +106,10 @@ func DefaultBotConfig() *BotConfig {
 		Channels:   2,                     // Stereo
 		FrameSize:  20 * time.Millisecond, // 20ms frames
 		BufferSize: 100,                   // Channel buffer size
+		Bitrate:    64000,                 // Plenty for speech in stereo
+
+		HealthCheck:    5 * time.Second,
+		ReconnectDelay: time.Second,
 	}
 }
 
@@ -58,19 +119,14 @@ func NewBot(config *BotConfig) (*Bot, error) {
 		return nil, fmt.Errorf("Discord bot token is required")
 	}
 
-	session, err := discordgo.New("Bot " + config.Token)
+	session, err := discordgo.New("Bot " + config.Token.Reveal())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Discord session: %w", err)
 	}
 
-	bot := &Bot{
-		session:   session,
-		guildID:   config.GuildID,
-		channelID: config.ChannelID,
-		AudioIn:   make(chan []byte, config.BufferSize),
-		AudioOut:  make(chan []byte, config.BufferSize),
-		stopChan:  make(chan bool, 1),
-		config:    config,
+	bot, err := newBot(session, config)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set up event handlers
@@ -79,11 +135,98 @@ func NewBot(config *BotConfig) (*Bot, error) {
 	return bot, nil
 }
 
+// newBot creates a bot on session
+func newBot(session *discordgo.Session, config *BotConfig) (*Bot, error) {
+	bitrate := config.Bitrate
+	if bitrate <= 0 {
+		bitrate = DefaultBotConfig().Bitrate
+	}
+	sender, err := newSender(bitrate)
+	if err != nil {
+		return nil, err
+	}
+
+	bot := &Bot{
+		session:       session,
+		guildID:       config.GuildID,
+		channelID:     config.ChannelID,
+		AudioIn:       make(chan []byte, config.BufferSize),
+		AudioOut:      make(chan []byte, config.BufferSize),
+		announcements: make(chan []byte, announcementBuffer),
+		stopChan:      make(chan bool, 1),
+		receiver:      newReceiver(config.Callsigns, config.RequireCallsign),
+		sender:        sender,
+		rest:          newRESTLimiter(),
+		config:        config,
+	}
+
+	bot.metrics = config.Metrics
+	if bot.metrics == nil {
+		bot.metrics = transport.NewAtomicMetrics()
+	}
+	bot.receiver.metrics = bot.metrics
+	bot.sender.metrics = bot.metrics
+
+	bot.receiver.profiles = config.TalkProfiles
+	bot.receiver.profile = config.TalkProfile
+	bot.receiver.allow = bot.mayTalk
+
+	if config.Roles != nil {
+		bot.permissions, err = newPermissions(config.Roles, config.DefaultPermission, bot.memberRoles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bot, nil
+}
+
+// memberRoles returns the role IDs of a member of the bot's guild, from
+// the session state if cached there
+func (b *Bot) memberRoles(userID string) ([]string, error) {
+	guildID := b.guild()
+
+	if b.session.State != nil {
+		if member, err := b.session.State.Member(guildID, userID); err == nil {
+			return member.Roles, nil
+		}
+	}
+	member, err := b.session.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild member: %w", err)
+	}
+	return member.Roles, nil
+}
+
+// guild returns the ID of the bot's guild
+func (b *Bot) guild() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.guildID
+}
+
+// GuildID returns the ID of the guild the bot is in
+func (b *Bot) GuildID() string {
+	return b.guild()
+}
+
 // setupEventHandlers configures Discord event handlers
 func (b *Bot) setupEventHandlers() {
-	b.session.AddHandler(b.onReady)
-	b.session.AddHandler(b.onVoiceStateUpdate)
-	b.session.AddHandler(b.onMessageCreate)
+	if !b.managed {
+		// A BotManager handles its shared session becoming ready itself
+		b.handlers = append(b.handlers, b.session.AddHandler(b.onReady))
+	}
+	b.handlers = append(b.handlers,
+		b.session.AddHandler(b.onVoiceStateUpdate),
+		b.session.AddHandler(b.onMessageCreate),
+		b.session.AddHandler(b.onRateLimit))
+}
+
+// removeEventHandlers stops the bot handling Discord events
+func (b *Bot) removeEventHandlers() {
+	for _, remove := range b.handlers {
+		remove()
+	}
+	b.handlers = nil
 }
 
 // onReady handles the ready event when bot connects
@@ -91,7 +234,7 @@ func (b *Bot) onReady(s *discordgo.Session, event *discordgo.Ready) {
 	log.Printf("Discord bot ready: %s#%s", event.User.Username, event.User.Discriminator)
 
 	// Set bot status
-	err := s.UpdateGameStatus(0, "Amateur Radio Bridge 📻")
+	err := s.UpdateGameStatus(0, botStatus)
 	if err != nil {
 		log.Printf("Error setting status: %v", err)
 	}
@@ -100,19 +243,37 @@ func (b *Bot) onReady(s *discordgo.Session, event *discordgo.Ready) {
 // onVoiceStateUpdate handles voice state changes
 func (b *Bot) onVoiceStateUpdate(s *discordgo.Session, event *discordgo.VoiceStateUpdate) {
 	// Handle voice state changes if needed
+	if b.otherGuild(event.GuildID) {
+		return
+	}
+	had, has := b.stage.update(event.VoiceState)
 	if event.UserID == s.State.User.ID {
 		log.Printf("Bot voice state changed: Channel=%s, Guild=%s",
 			event.ChannelID, event.GuildID)
+		if had && !has && event.ChannelID != "" {
+			log.Printf("Moved to the stage audience; the radio is not heard until a moderator invites the bot to speak")
+		}
 	}
 }
 
 // onMessageCreate handles incoming messages (for commands)
 func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	// Ignore messages from the bot itself
-	if m.Author.ID == s.State.User.ID {
+	// Ignore messages from the bot itself, and other guilds' bots' commands
+	if m.Author.ID == s.State.User.ID || b.otherGuild(m.GuildID) {
 		return
 	}
 
+	// Commands are for members with the command permission
+	switch m.Content {
+	case "!join", "!leave", "!status":
+		if !b.may(PermissionCommand, m.Author.ID, m.Member) {
+			if _, msgErr := s.ChannelMessageSend(m.ChannelID, "⛔ You are not permitted to control the bridge"); msgErr != nil {
+				log.Printf("Failed to send permission message: %v", msgErr)
+			}
+			return
+		}
+	}
+
 	// Simple command handling
 	switch m.Content {
 	case "!join":
@@ -139,6 +300,9 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 		status := "Disconnected"
 		if b.IsConnected() {
 			status = "Connected to voice channel"
+			if b.stage.active() {
+				status = fmt.Sprintf("Speaking on stage, %d on the floor", len(b.StageSpeakers()))
+			}
 		}
 		if _, msgErr := s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Status: %s", status)); msgErr != nil {
 			log.Printf("Failed to send status message: %v", msgErr)
@@ -146,6 +310,30 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 	}
 }
 
+// may reports whether a user has a permission, from the roles of member
+// if the event carries it
+func (b *Bot) may(want Permission, userID string, member *discordgo.Member) bool {
+	if b.permissions == nil {
+		return true
+	}
+	if member != nil {
+		return b.permissions.fromRoles(member.Roles).Allows(want)
+	}
+	b.permissions.resolve(userID)
+	return b.permissions.allows(userID, want, time.Now())
+}
+
+// otherGuild reports whether an event from guildID is for another bot on
+// a shared session
+func (b *Bot) otherGuild(guildID string) bool {
+	if !b.managed {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return guildID != b.guildID
+}
+
 // Start starts the Discord bot
 func (b *Bot) Start(ctx context.Context) error {
 	b.mutex.Lock()
@@ -155,15 +343,19 @@ func (b *Bot) Start(ctx context.Context) error {
 		return fmt.Errorf("bot is already running")
 	}
 
-	// Open Discord session
-	if err := b.session.Open(); err != nil {
-		return fmt.Errorf("failed to open Discord session: %w", err)
+	// Open Discord session, unless a BotManager has
+	if !b.managed {
+		if err := b.session.Open(); err != nil {
+			return fmt.Errorf("failed to open Discord session: %w", err)
+		}
 	}
 
 	b.running = true
+	b.done = make(chan struct{})
 
-	// Start audio processing goroutine
+	// Start audio processing goroutine, and keep the voice channel joined
 	go b.audioProcessor(ctx)
+	go b.voiceWatchdog(ctx, b.done)
 
 	log.Println("Discord bot started successfully")
 	return nil
@@ -180,61 +372,74 @@ func (b *Bot) Stop() error {
 
 	b.running = false
 	b.stopChan <- true
+	close(b.done)
 
 	// Leave voice channel if connected
-	if b.voiceConn != nil {
-		if err := b.voiceConn.Disconnect(); err != nil {
-			log.Printf("Error disconnecting from voice: %v", err)
-		}
-		b.voiceConn = nil
+	if err := b.disconnectVoice(); err != nil {
+		log.Printf("Error disconnecting from voice: %v", err)
 	}
 
-	// Close Discord session
-	if err := b.session.Close(); err != nil {
-		log.Printf("Error closing Discord session: %v", err)
+	// Close Discord session, unless other guilds' bots share it
+	if !b.managed {
+		if err := b.session.Close(); err != nil {
+			log.Printf("Error closing Discord session: %v", err)
+		}
 	}
 
 	log.Println("Discord bot stopped")
 	return nil
 }
 
-// JoinVoiceChannel joins a Discord voice channel
+// JoinVoiceChannel joins a Discord voice channel. Until
+// LeaveVoiceChannel the bot rejoins it whenever the connection drops, or
+// if this first attempt fails.
 func (b *Bot) JoinVoiceChannel(guildID, channelID string) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	b.wantVoice = true
+	b.guildID = guildID
+	b.channelID = channelID
+	return b.joinVoice(guildID, channelID)
+}
+
+// joinVoice connects to a voice channel and starts receiving from it. The
+// caller holds the mutex.
+func (b *Bot) joinVoice(guildID, channelID string) error {
 	// Leave current channel if connected
-	if b.voiceConn != nil {
-		if err := b.voiceConn.Disconnect(); err != nil {
-			log.Printf("Error disconnecting from previous voice channel: %v", err)
-		}
-		b.voiceConn = nil
+	if err := b.disconnectVoice(); err != nil {
+		log.Printf("Error disconnecting from previous voice channel: %v", err)
 	}
 
-	// Join new channel
-	voiceConn, err := b.session.ChannelVoiceJoin(guildID, channelID, false, true)
+	// Join new channel, undeafened to hear the channel
+	voiceConn, err := b.session.ChannelVoiceJoin(guildID, channelID, false, false)
 	if err != nil {
 		return fmt.Errorf("failed to join voice channel: %w", err)
 	}
 
 	b.voiceConn = voiceConn
-	b.guildID = guildID
-	b.channelID = channelID
 
 	// Wait for connection to be ready
-	if voiceConn.Ready {
+	if voiceReady(voiceConn) {
 		log.Printf("Successfully joined voice channel: %s", channelID)
 	} else {
 		// Give it a moment to connect
 		time.Sleep(2 * time.Second)
-		if !voiceConn.Ready {
+		if !voiceReady(voiceConn) {
 			return fmt.Errorf("voice connection not ready")
 		}
 		log.Printf("Successfully joined voice channel: %s", channelID)
 	}
 
-	// Start receiving audio
-	go b.receiveAudio()
+	if b.isStage(channelID) {
+		b.joinStage(guildID, channelID)
+	}
+
+	// Start receiving audio, learning who is behind each stream as they
+	// start speaking
+	voiceConn.AddHandler(b.onSpeakingUpdate)
+	b.voiceDone = make(chan struct{})
+	go b.receiveAudio(voiceConn.OpusRecv, b.voiceDone)
 
 	return nil
 }
@@ -244,22 +449,53 @@ func (b *Bot) LeaveVoiceChannel() error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	b.wantVoice = false
 	if b.voiceConn != nil {
-		if err := b.voiceConn.Disconnect(); err != nil {
+		if err := b.disconnectVoice(); err != nil {
 			return fmt.Errorf("failed to disconnect from voice: %w", err)
 		}
-		b.voiceConn = nil
 		log.Println("Left voice channel")
 	}
 
 	return nil
 }
 
+// disconnectVoice stops receiving and leaves the voice channel, if any.
+// The caller holds the mutex.
+func (b *Bot) disconnectVoice() error {
+	b.stage.leave()
+	if b.voiceDone != nil {
+		close(b.voiceDone)
+		b.voiceDone = nil
+	}
+	if b.voiceConn == nil {
+		return nil
+	}
+	err := b.voiceConn.Disconnect()
+	b.voiceConn = nil
+	return err
+}
+
+// IsRunning returns true if the bot is running
+func (b *Bot) IsRunning() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.running
+}
+
 // IsConnected returns true if bot is connected to a voice channel
 func (b *Bot) IsConnected() bool {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	return b.voiceConn != nil && b.voiceConn.Ready
+	return voiceReady(b.voiceConn)
+}
+
+// Reconnects returns how many times a dropped voice connection has been
+// rejoined
+func (b *Bot) Reconnects() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.reconnects
 }
 
 // SendAudio sends PCM audio to Discord voice channel
@@ -278,37 +514,69 @@ func (b *Bot) SendAudio(pcmData []byte) error {
 	}
 }
 
-// receiveAudio handles incoming audio from Discord
-func (b *Bot) receiveAudio() {
-	if b.voiceConn == nil {
-		return
-	}
-
-	// Note: Discord audio receiving is more complex in practice
-	// This is a simplified version for the bridge concept
-	log.Println("Audio receiver started (simplified implementation)")
+// receiveAudio decodes voice packets from Discord until done is closed,
+// delivering the mix of everyone speaking on AudioIn as 20ms frames of
+// 48kHz stereo PCM
+func (b *Bot) receiveAudio(packets <-chan *discordgo.Packet, done <-chan struct{}) {
+	log.Println("Audio receiver started")
+	defer log.Println("Audio receiver stopped")
 
-	// In a real implementation, you would need to:
-	// 1. Handle Discord's voice packets
-	// 2. Decode Opus audio to PCM
-	// 3. Convert sample rates appropriately
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	lastPrune := time.Now()
 
 	for {
 		select {
-		case <-b.stopChan:
+		case <-done:
 			return
-		case <-time.After(100 * time.Millisecond):
-			// Placeholder - in real implementation, process incoming voice packets
-			continue
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
+			if err := b.receiver.packet(packet, time.Now()); err != nil {
+				log.Printf("Discord receive: %v", err)
+			}
+		case now := <-ticker.C:
+			if pcm := b.receiver.frame(now); pcm != nil {
+				select {
+				case b.AudioIn <- pcm:
+					b.receiver.delivered(true)
+				default:
+					b.receiver.delivered(false)
+				}
+			}
+			if now.Sub(lastPrune) > time.Second {
+				b.receiver.prune(now)
+				lastPrune = now
+			}
 		}
 	}
 }
 
-// audioProcessor handles audio streaming to Discord
+// onSpeakingUpdate learns which user sends each voice stream
+func (b *Bot) onSpeakingUpdate(vc *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
+	b.receiver.identify(uint32(vs.SSRC), vs.UserID)
+	b.permissions.resolve(vs.UserID)
+}
+
+// Talkers returns the Discord users heard now, the one talking longest
+// first
+func (b *Bot) Talkers() []Talker {
+	return b.receiver.talkers(time.Now())
+}
+
+// ReceiveStats returns Discord voice receive counters
+func (b *Bot) ReceiveStats() ReceiveStats {
+	return b.receiver.Stats()
+}
+
+// audioProcessor encodes audio from AudioOut and sends it to the voice
+// channel, one 20ms frame per tick, marking the bot speaking while it does
 func (b *Bot) audioProcessor(ctx context.Context) {
 	ticker := time.NewTicker(b.config.FrameSize)
 	defer ticker.Stop()
 
+	var current *discordgo.VoiceConnection
 	for {
 		select {
 		case <-ctx.Done():
@@ -316,21 +584,43 @@ func (b *Bot) audioProcessor(ctx context.Context) {
 		case <-b.stopChan:
 			return
 		case <-ticker.C:
-			// Process outgoing audio
+			var pcmData []byte
 			select {
-			case pcmData := <-b.AudioOut:
-				if b.IsConnected() && len(pcmData) > 0 {
-					// Convert PCM to Opus and send to Discord
-					// Note: This is simplified - real implementation needs proper Opus encoding
-					log.Printf("Sending %d bytes of audio to Discord", len(pcmData))
-				}
+			case pcmData = <-b.AudioOut:
 			default:
 				// No audio to send
 			}
+			select {
+			case announcement := <-b.announcements:
+				pcmData = mixPCM(pcmData, announcement)
+			default:
+			}
+
+			b.mutex.Lock()
+			voiceConn := b.voiceConn
+			b.mutex.Unlock()
+			if voiceConn != current {
+				// A new channel starts out not speaking
+				b.sender.reset()
+				current = voiceConn
+			}
+			if !voiceReady(voiceConn) {
+				continue
+			}
+
+			link := voiceLink{speaking: voiceConn.Speaking, opus: voiceConn.OpusSend}
+			if err := b.sender.tick(link, pcmData); err != nil {
+				log.Printf("Discord send: %v", err)
+			}
 		}
 	}
 }
 
+// SendStats returns Discord voice send counters
+func (b *Bot) SendStats() SendStats {
+	return b.sender.Stats()
+}
+
 // GetAudioSpecs returns audio specifications for this bot
 func (b *Bot) GetAudioSpecs() (sampleRate int, channels int, frameSize time.Duration) {
 	return b.config.SampleRate, b.config.Channels, b.config.FrameSize
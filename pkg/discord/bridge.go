@@ -5,13 +5,22 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/record"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
 
+// discordSampleRate is Discord's voice sample rate
+const discordSampleRate = 48000
+
+// discordFrameSize is 20ms of Discord audio: 960 stereo samples at 48kHz,
+// which resample to one 160 sample USRP frame
+const discordFrameSize = 1920
+
 // Bridge connects USRP packets with Discord voice channels
 type Bridge struct {
 	// Discord bot
@@ -20,10 +29,43 @@ type Bridge struct {
 	// Audio converter (USRP <-> PCM/Opus)
 	converter audio.Converter
 
+	// Optional echo canceller between the radio->Discord and Discord->radio paths
+	echo *audio.EchoCanceller
+
+	// Voice detection keying Discord audio onto the radio: a VAD, or else
+	// a noise gate at VoiceThreshold
+	vad  *audio.VAD
+	gate *audio.NoiseGate
+
+	// Audio processing each way, and the optional jitter buffer playing
+	// radio frames on a steady clock
+	radioPipeline   []Processor
+	discordPipeline []Processor
+	jitter          *audio.JitterBuffer
+
+	// Optional log of radio transmissions in a Discord text channel
+	air        *transmissions // Radio transmissions, when shown in Discord
+	transcript *transcript
+	indicator  *indicator
+
+	// Optional bridging of USRP text messages with a Discord text channel
+	text *textRelay
+
+	// Optional recording of voice sessions
+	recording *sessionRecorder
+
+	handlers []func() // Removes the bridge's session event handlers
+
 	// USRP channels
 	USRPIn  chan *usrp.VoiceMessage // USRP packets from amateur radio
 	USRPOut chan *usrp.VoiceMessage // USRP packets to amateur radio
 
+	// Callsigns of Discord users as they start talking, to amateur radio
+	USRPMeta      chan *usrp.TLVMessage
+	USRPText      chan *usrp.TextMessage // Text messages from Discord, to amateur radio
+	announced     string                 // Callsign last sent on USRPMeta
+	lastDiscordRx time.Time              // When Discord audio last arrived
+
 	// Control
 	running  bool
 	mutex    sync.Mutex
@@ -35,21 +77,86 @@ type Bridge struct {
 	config *BridgeConfig
 
 	// Audio resampling buffers
-	discordBuffer []int16 // Buffer for Discord audio (48kHz)
-	usrpBuffer    []int16 // Buffer for USRP audio (8kHz)
+	discordFrames *audio.FrameAligner // Discord audio (48kHz stereo) cut into 20ms frames
+	usrpBuffer    []int16             // Buffer for USRP audio (8kHz)
+
+	// Streaming resamplers, one per direction, and the stereo to mono mix
+	upsampler   *audio.ChannelResampler // 8kHz mono -> 48kHz stereo
+	downsampler *audio.ChannelResampler // 48kHz stereo -> 8kHz mono
+	downmix     *audio.ChannelMatrix    // Discord stereo -> USRP mono
 }
 
 // BridgeConfig holds bridge configuration
 type BridgeConfig struct {
 	// Discord settings
-	DiscordToken   string
+	DiscordToken   Secret
 	DiscordGuild   string
 	DiscordChannel string
 
 	// Audio settings
-	EnableResampling bool          // Enable audio resampling between 8kHz and 48kHz
-	PTTTimeout       time.Duration // PTT timeout for voice activation
-	VoiceThreshold   int16         // Minimum audio level to trigger PTT
+	EnableResampling bool                  // Enable audio resampling between 8kHz and 48kHz
+	ResampleQuality  audio.ResampleQuality // Resampling filter quality ("" = medium)
+	PTTTimeout       time.Duration         // PTT timeout for voice activation
+	VoiceThreshold   int16                 // RMS level of Discord audio that keys the radio (0 = always keyed)
+	VAD              *audio.VADConfig      // Spectral voice detection instead of VoiceThreshold (nil = level only)
+	EchoCancellation bool                  // Remove radio audio picked up by Discord microphones
+	EchoTail         time.Duration         // Longest echo path to cancel (0 = default)
+	Downmix          []float64             // Gains of Discord's left and right channels in the radio's mono (nil = equal mix, [1, 0] = left only)
+
+	// Audio pipeline, from the audio package. Radio audio is played on a
+	// steady clock by RadioJitter, then goes through RadioAGC and
+	// RadioProcessors before upsampling to Discord. Discord audio is
+	// downsampled, echo cancelled, then goes through DiscordAGC and
+	// DiscordProcessors before the voice detection keying the radio.
+	RadioJitter       *audio.JitterBufferConfig // Jitter buffer for radio frames arriving in bursts (nil = played as they arrive)
+	RadioAGC          *audio.AGCConfig          // Leveling of radio audio to Discord (nil = none)
+	RadioProcessors   []Processor               // Further processing of radio audio, e.g. an audio.FilterChain
+	DiscordAGC        *audio.AGCConfig          // Leveling of Discord audio to the radio (nil = none)
+	DiscordProcessors []Processor               // Further processing of Discord audio, e.g. an audio.Denoiser
+
+	// Identification of Discord users on the radio. Each user's callsign
+	// or name goes out as USRP metadata when they start talking; users
+	// without one are sent as CallSign, or not heard at all with
+	// RequireCallsign set.
+	Callsigns       map[string]string // Discord user ID to callsign or name
+	RequireCallsign bool              // Key the radio only for users in Callsigns
+
+	// What members may do by Discord role: "listen", "talk" or "command"
+	// (talk and control the bot), the highest of their roles. Only members
+	// allowed to talk key the radio.
+	Roles             map[string]Permission // Role ID to permission (nil = everyone may talk and command)
+	DefaultPermission Permission            // Members with none of Roles ("listen")
+
+	// Per-user keying of the radio, so quiet talkers are not chopped and
+	// hot mics do not key it indefinitely. Each user's voice detection,
+	// hangtime and longest transmission replace VoiceThreshold and VAD.
+	TalkProfiles map[string]TalkProfile // Discord user ID to profile (nil with no TalkProfile = VoiceThreshold or VAD)
+	TalkProfile  *TalkProfile           // Users not in TalkProfiles (nil = DefaultTalkProfile)
+
+	// Stage channels, for large directed nets: when DiscordChannel is a
+	// stage the bot speaks to its audience, and only the speakers
+	// moderators invite up key the radio
+	StageTopic string // Topic the stage is started with if not already live ("" = leave it to moderators)
+
+	// Log of radio transmissions: who keyed up, on which talk group and for
+	// how long, posted to a Discord text channel
+	TranscriptChannel string // Text channel ID ("" = none)
+
+	// The radio station on the air, e.g. "📻 W1AW on TG 3100", shown in the
+	// bot's nickname or presence while its audio plays. Presence is shared
+	// by every guild of a multi-channel bot, so use the nickname there.
+	SpeakingIndicator Indicator
+
+	// Text messages: USRP text from the radio is posted to this channel,
+	// and messages in it, or "!text ..." anywhere, go to the radio from
+	// members allowed to talk
+	TextChannel string // Text channel ID ("" = none)
+
+	// Recording of voice sessions: the radio and Discord audio mixed as
+	// heard in the voice channel, written to a recorder shared with the
+	// rest of the station, in guilds whose members consent to it
+	Recorder         *record.Recorder   // Recorder sessions are written to (nil = none)
+	RecordingConsent map[string]Consent // Guild ID to consent; guilds not listed are not recorded
 
 	// USRP settings
 	CallSign  string // Amateur radio callsign
@@ -82,11 +189,28 @@ func NewBridge(config *BridgeConfig) (*Bridge, error) {
 	botConfig.GuildID = config.DiscordGuild
 	botConfig.ChannelID = config.DiscordChannel
 	botConfig.BufferSize = config.BufferSize
+	botConfig.Callsigns = config.Callsigns
+	botConfig.RequireCallsign = config.RequireCallsign
+	botConfig.Roles = config.Roles
+	botConfig.DefaultPermission = config.DefaultPermission
+	botConfig.TalkProfiles = config.TalkProfiles
+	botConfig.TalkProfile = config.TalkProfile
+	botConfig.StageTopic = config.StageTopic
 
 	bot, err := NewBot(botConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Discord bot: %w", err)
 	}
+	return NewBridgeForBot(bot, config)
+}
+
+// NewBridgeForBot creates a bridge for an existing bot, such as one of a
+// BotManager's. The bot's own settings stand; of config's Discord settings
+// only DiscordGuild and DiscordChannel are used, to join on Start.
+func NewBridgeForBot(bot *Bot, config *BridgeConfig) (*Bridge, error) {
+	if config.Downmix != nil && len(config.Downmix) != 2 {
+		return nil, fmt.Errorf("downmix needs gains for the left and right channels, got %d", len(config.Downmix))
+	}
 
 	// Create audio converter (USRP uses Opus for efficiency)
 	converter, err := audio.NewOpusConverter()
@@ -101,12 +225,60 @@ func NewBridge(config *BridgeConfig) (*Bridge, error) {
 		converter:     converter,
 		USRPIn:        make(chan *usrp.VoiceMessage, config.BufferSize),
 		USRPOut:       make(chan *usrp.VoiceMessage, config.BufferSize),
+		USRPMeta:      make(chan *usrp.TLVMessage, config.BufferSize),
+		USRPText:      make(chan *usrp.TextMessage, config.BufferSize),
 		stopChan:      make(chan bool, 1),
 		ctx:           ctx,
 		cancel:        cancel,
 		config:        config,
-		discordBuffer: make([]int16, 0, 4800), // ~100ms at 48kHz
-		usrpBuffer:    make([]int16, 0, 800),  // ~100ms at 8kHz
+		discordFrames: audio.NewFrameAligner(discordFrameSize, discordSampleRate*2),
+		usrpBuffer:    make([]int16, 0, 800), // ~100ms at 8kHz
+	}
+
+	if config.EchoCancellation {
+		echoConfig := audio.DefaultEchoConfig()
+		if config.EchoTail > 0 {
+			echoConfig.TailLength = config.EchoTail
+		}
+		bridge.echo = audio.NewEchoCanceller(echoConfig)
+	}
+	if config.VAD != nil {
+		bridge.vad = audio.NewVAD(config.VAD)
+	}
+	bridge.radioPipeline = newPipeline(config.RadioAGC, config.RadioProcessors)
+	bridge.discordPipeline = newPipeline(config.DiscordAGC, config.DiscordProcessors)
+	if config.RadioJitter != nil {
+		bridge.jitter = audio.NewJitterBuffer(config.RadioJitter)
+	}
+	if config.TranscriptChannel != "" {
+		bridge.transcript = newTranscript(bot.session, config.TranscriptChannel)
+		bridge.transcript.limits = bot.rest
+	}
+	if config.TextChannel != "" {
+		bridge.text = newTextRelay(bot.session, config.TextChannel)
+		bridge.text.limits = bot.rest
+	}
+	if consent := config.RecordingConsent[config.DiscordGuild]; config.Recorder != nil && consent != ConsentNone {
+		if consent != ConsentAnnounce && consent != ConsentOptIn {
+			return nil, fmt.Errorf("unknown recording consent %q (want %q or %q)", consent, ConsentAnnounce, ConsentOptIn)
+		}
+		bridge.recording = newSessionRecorder(config.Recorder, consent, "discord-"+config.DiscordGuild, config.TalkGroup)
+		bridge.recording.members = bot.voiceMembers
+		bridge.recording.post = bot.postVoiceChannel
+	}
+	if config.SpeakingIndicator != IndicatorNone {
+		indicator, err := newIndicator(bot, config.SpeakingIndicator)
+		if err != nil {
+			return nil, err
+		}
+		bridge.indicator = indicator
+	}
+	if bridge.transcript != nil || bridge.indicator != nil {
+		timeout := config.PTTTimeout
+		if timeout <= 0 {
+			timeout = DefaultBridgeConfig().PTTTimeout
+		}
+		bridge.air = newTransmissions(timeout)
 	}
 
 	return bridge, nil
@@ -121,21 +293,37 @@ func (b *Bridge) Start() error {
 		return fmt.Errorf("bridge is already running")
 	}
 
-	// Start Discord bot
-	if err := b.bot.Start(b.ctx); err != nil {
-		return fmt.Errorf("failed to start Discord bot: %w", err)
+	// Start Discord bot, unless its BotManager has
+	if !b.bot.IsRunning() {
+		if err := b.bot.Start(b.ctx); err != nil {
+			return fmt.Errorf("failed to start Discord bot: %w", err)
+		}
 	}
 
 	// Auto-join voice channel if specified
-	if b.config.DiscordGuild != "" && b.config.DiscordChannel != "" {
+	if b.config.DiscordGuild != "" && b.config.DiscordChannel != "" && !b.bot.IsConnected() {
 		if err := b.bot.JoinVoiceChannel(b.config.DiscordGuild, b.config.DiscordChannel); err != nil {
-			log.Printf("Warning: Could not auto-join voice channel: %v", err)
+			log.Printf("Warning: Could not auto-join voice channel, retrying: %v", err)
 		}
 	}
 
 	b.running = true
 
 	// Start bridge workers
+	if b.transcript != nil {
+		go b.transcript.run(b.ctx, b.air.watch())
+	}
+	if b.indicator != nil {
+		go b.indicator.run(b.ctx, b.air.watch())
+	}
+	if b.text != nil {
+		go b.text.run(b.ctx)
+		b.handlers = append(b.handlers, b.bot.session.AddHandler(b.onTextMessage))
+	}
+	if b.recording != nil {
+		go b.recording.run(b.ctx, b.bot.IsConnected)
+		b.handlers = append(b.handlers, b.bot.session.AddHandler(b.onRecordCommand))
+	}
 	go b.usrpToDiscordWorker()
 	go b.discordToUSRPWorker()
 
@@ -155,6 +343,10 @@ func (b *Bridge) Stop() error {
 	b.running = false
 	b.cancel()
 	b.stopChan <- true
+	for _, remove := range b.handlers {
+		remove()
+	}
+	b.handlers = nil
 
 	// Stop Discord bot
 	if err := b.bot.Stop(); err != nil {
@@ -184,6 +376,15 @@ func (b *Bridge) SendUSRPPacket(packet *usrp.VoiceMessage) error {
 	}
 }
 
+// SendUSRPMetadata passes USRP metadata from amateur radio to the bridge.
+// A callsign names the station transmitting in the transcript and
+// speaking indicator.
+func (b *Bridge) SendUSRPMetadata(msg *usrp.TLVMessage) {
+	if callsign, ok := msg.GetCallsign(); ok && b.air != nil {
+		b.air.identify(callsign)
+	}
+}
+
 // GetUSRPPacket gets a USRP packet from Discord audio
 func (b *Bridge) GetUSRPPacket() (*usrp.VoiceMessage, bool) {
 	select {
@@ -194,14 +395,48 @@ func (b *Bridge) GetUSRPPacket() (*usrp.VoiceMessage, bool) {
 	}
 }
 
+// GetUSRPMetadata gets a USRP metadata packet naming a Discord talker
+func (b *Bridge) GetUSRPMetadata() (*usrp.TLVMessage, bool) {
+	select {
+	case msg := <-b.USRPMeta:
+		return msg, true
+	default:
+		return nil, false
+	}
+}
+
 // usrpToDiscordWorker converts USRP packets to Discord audio
 func (b *Bridge) usrpToDiscordWorker() {
+	// Transmissions that stop without an unkey end when the frames have
+	// been gone for PTTTimeout
+	var checks <-chan time.Time
+	if b.air != nil {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+	// A jitter buffer plays its frames out on the 20ms frame clock
+	var playout <-chan time.Time
+	if b.jitter != nil {
+		ticker := time.NewTicker(b.jitter.FrameDuration())
+		defer ticker.Stop()
+		playout = ticker.C
+	}
+
 	for {
 		select {
 		case <-b.ctx.Done():
 			return
 		case <-b.stopChan:
 			return
+		case now := <-checks:
+			b.air.check(now)
+		case now := <-playout:
+			if frame, ok := b.jitter.Pop(now); ok {
+				if err := b.playRadio(frame); err != nil {
+					log.Printf("Error processing USRP to Discord: %v", err)
+				}
+			}
 		case usrpPacket := <-b.USRPIn:
 			if err := b.processUSRPToDiscord(usrpPacket); err != nil {
 				log.Printf("Error processing USRP to Discord: %v", err)
@@ -228,16 +463,41 @@ func (b *Bridge) discordToUSRPWorker() {
 
 // processUSRPToDiscord converts USRP voice packet to Discord audio
 func (b *Bridge) processUSRPToDiscord(usrpPacket *usrp.VoiceMessage) error {
+	if b.air != nil {
+		b.air.frame(usrpPacket.Header.IsPTT(), usrpPacket.Header.TalkGroup, time.Now())
+	}
+
 	// Check if this is an active voice packet
 	if !usrpPacket.Header.IsPTT() {
 		return nil // Skip non-PTT packets
 	}
 
+	if b.jitter != nil {
+		b.jitter.Push(usrpPacket.Header.Seq, usrpPacket.AudioData[:], time.Now())
+		return nil
+	}
+	return b.playRadio(slices.Clone(usrpPacket.AudioData[:]))
+}
+
+// playRadio runs a frame of radio audio through the radio pipeline and
+// plays it in Discord
+func (b *Bridge) playRadio(samples []int16) error {
+	runPipeline(b.radioPipeline, samples)
+
 	// Convert USRP audio samples to Discord format
 	// USRP: 8kHz mono, 160 samples (20ms)
 	// Discord: 48kHz stereo (need resampling)
 
-	discordAudio := b.resampleUSRPToDiscord(usrpPacket.AudioData[:])
+	// Remember what the Discord side will play so it can be cancelled if it
+	// comes back through a microphone
+	if b.echo != nil {
+		b.echo.Playback(samples)
+	}
+	if b.recording != nil {
+		b.recording.radio(samples)
+	}
+
+	discordAudio := b.resampleUSRPToDiscord(samples)
 
 	// Send to Discord bot
 	if len(discordAudio) > 0 {
@@ -258,23 +518,33 @@ func (b *Bridge) processUSRPToDiscord(usrpPacket *usrp.VoiceMessage) error {
 
 // processDiscordToUSRP converts Discord audio to USRP packets
 func (b *Bridge) processDiscordToUSRP(discordAudio []byte) error {
-	// Convert bytes to int16 samples
-	samples := make([]int16, len(discordAudio)/2)
-	for i := 0; i < len(samples); i++ {
-		samples[i] = int16(discordAudio[i*2]) | int16(discordAudio[i*2+1])<<8
+	// A break in the audio ends the over, so the next talker is announced
+	// even if it is the same user again
+	now := time.Now()
+	if now.Sub(b.lastDiscordRx) > talkerHold {
+		b.announced = ""
 	}
-
-	// Add to buffer for resampling
-	b.discordBuffer = append(b.discordBuffer, samples...)
+	b.lastDiscordRx = now
 
 	// Process in chunks suitable for USRP (160 samples at 8kHz)
-	for len(b.discordBuffer) >= 960 { // 960 samples at 48kHz = 160 at 8kHz
+	b.discordFrames.WriteBytes(discordAudio, time.Time{})
+	for _, frame := range b.discordFrames.Frames() {
 		// Resample Discord audio (48kHz) to USRP (8kHz)
-		usrpSamples := b.resampleDiscordToUSRP(b.discordBuffer[:960])
-		b.discordBuffer = b.discordBuffer[960:]
+		usrpSamples := b.resampleDiscordToUSRP(frame.Samples)
+
+		if b.echo != nil {
+			b.echo.Process(usrpSamples)
+		}
+		runPipeline(b.discordPipeline, usrpSamples)
+		if b.recording != nil {
+			b.recording.discord(usrpSamples)
+		}
+
+		// Check if audio level is above threshold (voice activity detection),
+		// unless the bot has already keyed each user by their talk profile
+		if b.bot.receiver.gated() || b.detectVoiceActivity(usrpSamples) {
+			b.announceTalker()
 
-		// Check if audio level is above threshold (voice activity detection)
-		if b.detectVoiceActivity(usrpSamples) {
 			// Create USRP voice packet
 			usrpPacket := &usrp.VoiceMessage{
 				Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, b.generateSequence()),
@@ -298,77 +568,109 @@ func (b *Bridge) processDiscordToUSRP(discordAudio []byte) error {
 	return nil
 }
 
+// announceTalker sends the callsign of whoever is talking on Discord as
+// USRP metadata when it changes, so the radio side can identify them
+func (b *Bridge) announceTalker() {
+	talkers := b.bot.Talkers()
+	if len(talkers) == 0 {
+		return
+	}
+	callsign := talkers[0].Callsign
+	if callsign == "" {
+		callsign = b.config.CallSign
+	}
+	if callsign == "" || callsign == b.announced {
+		return
+	}
+
+	msg := &usrp.TLVMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TLV, b.generateSequence())}
+	msg.Header.TalkGroup = b.config.TalkGroup
+	msg.SetCallsign(callsign)
+	select {
+	case b.USRPMeta <- msg:
+		b.announced = callsign
+	default:
+		log.Printf("USRP metadata buffer full, dropping callsign %s", callsign)
+	}
+}
+
 // resampleUSRPToDiscord converts 8kHz mono to 48kHz stereo
 func (b *Bridge) resampleUSRPToDiscord(usrpSamples []int16) []int16 {
 	if !b.config.EnableResampling {
 		return usrpSamples // Return as-is if resampling disabled
 	}
 
-	// Simple 6x upsampling (8kHz -> 48kHz) with duplication
-	// Real implementation would use proper resampling algorithms
-	discordSamples := make([]int16, len(usrpSamples)*6*2) // 6x rate, 2x channels
-
-	for i, sample := range usrpSamples {
-		// Each USRP sample becomes 6 Discord samples (stereo)
-		for j := 0; j < 6; j++ {
-			idx := (i*6 + j) * 2
-			discordSamples[idx] = sample   // Left channel
-			discordSamples[idx+1] = sample // Right channel
-		}
+	// Band-limited 6x upsampling (8kHz -> 48kHz), so the 8kHz sample steps
+	// do not image into the 4-24kHz band, onto both channels
+	if b.upsampler == nil {
+		upmix, _ := audio.DefaultChannelMatrix(1, 2)
+		b.upsampler = b.newResampler(audio.USRPSampleRate, discordSampleRate, upmix)
 	}
-
-	return discordSamples
+	return b.upsampler.Process(usrpSamples)
 }
 
 // resampleDiscordToUSRP converts 48kHz stereo to 8kHz mono
 func (b *Bridge) resampleDiscordToUSRP(discordSamples []int16) []int16 {
+	if b.downmix == nil {
+		b.downmix = b.stereoToMono()
+	}
 	if !b.config.EnableResampling {
-		// Convert stereo to mono
-		monoSamples := make([]int16, len(discordSamples)/2)
-		for i := 0; i < len(monoSamples); i++ {
-			// Mix left and right channels
-			left := int32(discordSamples[i*2])
-			right := int32(discordSamples[i*2+1])
-			monoSamples[i] = int16((left + right) / 2)
-		}
-		return monoSamples
+		return b.downmix.Apply(discordSamples)
 	}
 
-	// Simple 6x downsampling (48kHz -> 8kHz) with decimation
-	// Real implementation would use proper anti-aliasing filters
-	usrpSamples := make([]int16, len(discordSamples)/12) // 6x rate, 2x channels
+	// Mix stereo to mono, then low-pass below 4kHz before 6x downsampling
+	// (48kHz -> 8kHz) so higher frequencies do not alias into the voice band
+	if b.downsampler == nil {
+		b.downsampler = b.newResampler(discordSampleRate, audio.USRPSampleRate, b.downmix)
+	}
+	return b.downsampler.Process(discordSamples)
+}
 
-	for i := 0; i < len(usrpSamples); i++ {
-		// Take every 6th sample, mix stereo to mono
-		idx := i * 12
-		if idx+1 < len(discordSamples) {
-			left := int32(discordSamples[idx])
-			right := int32(discordSamples[idx+1])
-			usrpSamples[i] = int16((left + right) / 2)
+// stereoToMono returns the configured mix of Discord's channels for the
+// radio, an equal mix by default
+func (b *Bridge) stereoToMono() *audio.ChannelMatrix {
+	if b.config.Downmix != nil {
+		if m, err := audio.NewChannelMatrix([][]float64{b.config.Downmix}); err == nil && m.In() == 2 {
+			return m
 		}
+		log.Printf("Invalid downmix %v, mixing both channels", b.config.Downmix)
 	}
+	m, _ := audio.DefaultChannelMatrix(2, 1)
+	return m
+}
 
-	return usrpSamples
+// newResampler creates a resampler remixing with mix at the configured
+// quality, falling back to the default for an unknown quality
+func (b *Bridge) newResampler(inRate, outRate int, mix *audio.ChannelMatrix) *audio.ChannelResampler {
+	r, err := audio.NewChannelResampler(inRate, outRate, mix, b.config.ResampleQuality)
+	if err != nil {
+		log.Printf("Invalid resample quality, using default: %v", err)
+		r, _ = audio.NewChannelResampler(inRate, outRate, mix, "")
+	}
+	return r
 }
 
 // detectVoiceActivity checks if audio contains voice activity
 func (b *Bridge) detectVoiceActivity(samples []int16) bool {
-	if b.config.VoiceThreshold == 0 {
+	if b.vad != nil {
+		return b.vad.Process(samples)
+	}
+	if b.config.VoiceThreshold <= 0 {
 		return true // Always transmit if threshold is 0
 	}
-
-	// Calculate RMS (Root Mean Square) for voice detection
-	var sum int64
-	for _, sample := range samples {
-		sum += int64(sample) * int64(sample)
+	if b.gate == nil {
+		b.gate = audio.NewNoiseGate(voiceGate(b.config.VoiceThreshold))
 	}
+	return b.gate.Process(samples)
+}
 
-	rms := int16(sum / int64(len(samples)))
-	if rms < 0 {
-		rms = -rms
+// JitterStats returns the radio jitter buffer's counters, or zeros
+// without RadioJitter
+func (b *Bridge) JitterStats() audio.JitterBufferStats {
+	if b.jitter == nil {
+		return audio.JitterBufferStats{}
 	}
-
-	return rms > b.config.VoiceThreshold
+	return b.jitter.Stats()
 }
 
 // generateSequence generates a sequence number for USRP packets
@@ -376,6 +678,16 @@ func (b *Bridge) generateSequence() uint32 {
 	return uint32(time.Now().Unix())
 }
 
+// Bot returns the bridge's Discord bot
+func (b *Bridge) Bot() *Bot {
+	return b.bot
+}
+
+// TalkGroup returns the USRP talk group the bridge carries
+func (b *Bridge) TalkGroup() uint32 {
+	return b.config.TalkGroup
+}
+
 // IsRunning returns true if bridge is running
 func (b *Bridge) IsRunning() bool {
 	b.mutex.Lock()
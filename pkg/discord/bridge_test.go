@@ -1,9 +1,11 @@
 package discord
 
 import (
+	"math"
 	"testing"
 	"time"
 
+	"github.com/dbehnke/usrp-go/pkg/audio"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
 
@@ -76,6 +78,39 @@ func TestAudioResampling(t *testing.T) {
 	}
 }
 
+// TestResamplingRejectsAliases checks that Discord audio above 4kHz does
+// not fold back into the USRP voice band
+func TestResamplingRejectsAliases(t *testing.T) {
+	bridge := &Bridge{config: DefaultBridgeConfig()}
+
+	// 6kHz at 48kHz stereo would alias to 2kHz under plain decimation
+	var peak int16
+	for frame := 0; frame < 10; frame++ {
+		discordInput := make([]int16, 960*2)
+		for i := 0; i < 960; i++ {
+			n := frame*960 + i
+			sample := int16(10000 * math.Sin(2*math.Pi*6000*float64(n)/48000))
+			discordInput[i*2] = sample
+			discordInput[i*2+1] = sample
+		}
+		usrpOutput := bridge.resampleDiscordToUSRP(discordInput)
+		if frame == 0 {
+			continue // Skip the filter settling on the tone's onset
+		}
+		for _, s := range usrpOutput {
+			if s > peak {
+				peak = s
+			} else if -s > peak {
+				peak = -s
+			}
+		}
+	}
+
+	if peak > 100 {
+		t.Errorf("6kHz tone leaked into USRP audio at peak %d", peak)
+	}
+}
+
 // TestVoiceActivityDetection tests voice activity detection
 func TestVoiceActivityDetection(t *testing.T) {
 	bridge := &Bridge{
@@ -104,6 +139,22 @@ func TestVoiceActivityDetection(t *testing.T) {
 	if !bridge.detectVoiceActivity(silence) {
 		t.Error("Should always detect voice when threshold is 0")
 	}
+
+	// With a VAD, a steady loud hum stops counting once it is learned
+	bridge.vad = audio.NewVAD(&audio.VADConfig{Hangover: 20 * time.Millisecond})
+	hum := make([]int16, 160)
+	keyed := 0
+	for frame := 0; frame < 50; frame++ {
+		for i := range hum {
+			hum[i] = int16(5000 * math.Sin(2*math.Pi*120*float64(frame*160+i)/8000))
+		}
+		if bridge.detectVoiceActivity(hum) {
+			keyed++
+		}
+	}
+	if keyed > 5 {
+		t.Errorf("Hum keyed %d of 50 frames with the VAD", keyed)
+	}
 }
 
 // TestUSRPPacketProcessing tests USRP packet creation and processing
@@ -197,3 +248,46 @@ func BenchmarkVoiceActivityDetection(b *testing.B) {
 		bridge.detectVoiceActivity(samples)
 	}
 }
+
+func TestBridge_AnnounceTalker(t *testing.T) {
+	config := DefaultBridgeConfig()
+	config.VoiceThreshold = 0
+	config.CallSign = "N0CALL"
+	config.TalkGroup = 9
+	bot := &Bot{receiver: newReceiver(map[string]string{"100": "W1AW"}, false)}
+	bridge := &Bridge{
+		bot:           bot,
+		config:        config,
+		USRPOut:       make(chan *usrp.VoiceMessage, 10),
+		USRPMeta:      make(chan *usrp.TLVMessage, 10),
+		discordFrames: audio.NewFrameAligner(discordFrameSize, discordSampleRate*2),
+	}
+	frame := make([]byte, discordFrameSize*2)
+
+	// A user with a callsign is announced once per over
+	bot.receiver.identify(1, "100")
+	bot.receiver.packet(newOpusTalker(t, 1, 400).next(), time.Now())
+	for i := 0; i < 3; i++ {
+		bridge.processDiscordToUSRP(frame)
+	}
+	msg, ok := bridge.GetUSRPMetadata()
+	if !ok {
+		t.Fatal("Talker not announced")
+	}
+	if callsign, _ := msg.GetCallsign(); callsign != "W1AW" || msg.Header.TalkGroup != 9 {
+		t.Errorf("Announced %q on talk group %d", callsign, msg.Header.TalkGroup)
+	}
+	if _, ok := bridge.GetUSRPMetadata(); ok {
+		t.Error("Talker announced more than once")
+	}
+
+	// Someone without one goes out under the station's callsign
+	bot.receiver.prune(time.Now().Add(2 * speakerTimeout))
+	bot.receiver.packet(newOpusTalker(t, 2, 400).next(), time.Now())
+	bridge.processDiscordToUSRP(frame)
+	if msg, ok := bridge.GetUSRPMetadata(); !ok {
+		t.Error("Second talker not announced")
+	} else if callsign, _ := msg.GetCallsign(); callsign != "N0CALL" {
+		t.Errorf("Unmapped user announced as %q", callsign)
+	}
+}
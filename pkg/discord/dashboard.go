@@ -0,0 +1,328 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// dashboardTitle titles the status embed, and finds it again after a
+// restart
+const dashboardTitle = "📻 Bridge Status"
+
+// activeWindow is how recently a station must have been heard to count as
+// talking now
+const activeWindow = 2 * time.Second
+
+// Embed colors by health
+const (
+	colorHealthy  = 0x2ecc71
+	colorDegraded = 0xf1c40f
+	colorDown     = 0xe74c3c
+)
+
+// RouterStatus is the part of the audio router's /status report the
+// dashboard shows
+type RouterStatus struct {
+	Router struct {
+		Name   string `json:"name"`
+		Uptime string `json:"uptime"`
+	} `json:"router"`
+	Services   []RouterService `json:"services"`
+	Statistics struct {
+		RoutedMessages      uint64 `json:"routed_messages"`
+		DroppedMessages     uint64 `json:"dropped_messages"`
+		ConversionErrors    uint64 `json:"conversion_errors"`
+		ActiveTransmissions int    `json:"active_transmissions"`
+	} `json:"statistics"`
+	Traffic usrp.StatsSnapshot `json:"usrp_traffic"`
+}
+
+// RouterService is one service in the router's status report
+type RouterService struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Enabled   bool   `json:"enabled"`
+	Connected bool   `json:"connected"`
+	LinkState string `json:"link_state,omitempty"`
+}
+
+// FetchRouterStatus gets the audio router's status report from its /status
+// endpoint
+func FetchRouterStatus(ctx context.Context, client *http.Client, url string) (*RouterStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("router status request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("router returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	status := &RouterStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("failed to decode router status: %w", err)
+	}
+	return status, nil
+}
+
+// DashboardConfig holds status dashboard settings
+type DashboardConfig struct {
+	ChannelID string        `json:"channel_id"` // Text channel holding the pinned status embed
+	RouterURL string        `json:"router_url"` // Router status endpoint, e.g. http://localhost:8080/status
+	Interval  time.Duration `json:"interval"`   // How often the embed is refreshed
+	LastHeard int           `json:"last_heard"` // Stations listed as last heard
+}
+
+// DefaultDashboardConfig returns a dashboard refreshed every 30 seconds
+// listing the last five stations heard
+func DefaultDashboardConfig() *DashboardConfig {
+	return &DashboardConfig{
+		RouterURL: "http://localhost:8080/status",
+		Interval:  30 * time.Second,
+		LastHeard: 5,
+	}
+}
+
+// dashboardMessenger posts, edits and pins embeds, as a discordgo.Session
+// does
+type dashboardMessenger interface {
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditEmbed(channelID, messageID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessagePin(channelID, messageID string, options ...discordgo.RequestOption) error
+	ChannelMessagesPinned(channelID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error)
+}
+
+// Dashboard keeps a pinned embed in a Discord text channel showing the
+// bridge's health from the router's stats: services, who is talking, the
+// stations last heard and audio counters, so admins need not open the
+// router's HTTP UI. The embed is edited in place, so the channel stays
+// quiet.
+type Dashboard struct {
+	discord dashboardMessenger
+	config  DashboardConfig
+	fetch   func(ctx context.Context) (*RouterStatus, error)
+	bot     *Bot         // Discord audio counters, if any
+	limits  *restLimiter // Spacing of edits (nil = none)
+
+	messageID string
+}
+
+// NewDashboard creates a dashboard posted by bot. A nil config uses
+// DefaultDashboardConfig; the channel ID is required.
+func NewDashboard(bot *Bot, config *DashboardConfig) (*Dashboard, error) {
+	defaults := DefaultDashboardConfig()
+	if config == nil {
+		config = defaults
+	}
+	cfg := *config
+	if cfg.ChannelID == "" {
+		return nil, fmt.Errorf("dashboard channel ID is required")
+	}
+	if cfg.RouterURL == "" {
+		cfg.RouterURL = defaults.RouterURL
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.LastHeard <= 0 {
+		cfg.LastHeard = defaults.LastHeard
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Dashboard{
+		discord: bot.session,
+		config:  cfg,
+		fetch: func(ctx context.Context) (*RouterStatus, error) {
+			return FetchRouterStatus(ctx, client, cfg.RouterURL)
+		},
+		bot:    bot,
+		limits: bot.rest,
+	}, nil
+}
+
+// Run refreshes the embed every Interval until ctx is done
+func (d *Dashboard) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.update(ctx, time.Now()); err != nil {
+			log.Printf("Error updating status dashboard: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update fetches the router's status and shows it in the embed, posting
+// and pinning the embed first if there is none yet
+func (d *Dashboard) update(ctx context.Context, now time.Time) error {
+	status, err := d.fetch(ctx)
+	embed := d.embed(status, err, now)
+
+	if !d.limits.wait(ctx, d.config.ChannelID, messageInterval) {
+		return ctx.Err()
+	}
+	if d.messageID == "" {
+		d.messageID = d.findPinned()
+	}
+	if d.messageID != "" {
+		if _, err := d.discord.ChannelMessageEditEmbed(d.config.ChannelID, d.messageID, embed); err == nil {
+			return nil
+		}
+		// Deleted or unpinned meanwhile; post a new one
+		d.messageID = ""
+	}
+
+	msg, err := d.discord.ChannelMessageSendEmbed(d.config.ChannelID, embed)
+	if err != nil {
+		return fmt.Errorf("failed to post status embed: %w", err)
+	}
+	d.messageID = msg.ID
+	if err := d.discord.ChannelMessagePin(d.config.ChannelID, msg.ID); err != nil {
+		return fmt.Errorf("failed to pin status embed: %w", err)
+	}
+	return nil
+}
+
+// findPinned returns the ID of a status embed a bot pinned earlier, so a
+// restart reuses it rather than pinning another
+func (d *Dashboard) findPinned() string {
+	pinned, err := d.discord.ChannelMessagesPinned(d.config.ChannelID)
+	if err != nil {
+		return ""
+	}
+	for _, msg := range pinned {
+		if msg.Author != nil && msg.Author.Bot && len(msg.Embeds) > 0 && msg.Embeds[0].Title == dashboardTitle {
+			return msg.ID
+		}
+	}
+	return ""
+}
+
+// embed renders the status, or the error fetching it
+func (d *Dashboard) embed(status *RouterStatus, err error, now time.Time) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:     dashboardTitle,
+		Timestamp: now.UTC().Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Updated"},
+	}
+	if err != nil {
+		embed.Color = colorDown
+		embed.Description = fmt.Sprintf("⛔ Router unreachable: %v", err)
+		embed.Fields = d.audioFields(nil)
+		return embed
+	}
+
+	embed.Color = colorHealthy
+	embed.Description = fmt.Sprintf("**%s** up %s", status.Router.Name, status.Router.Uptime)
+
+	var services []string
+	for _, s := range status.Services {
+		if !s.Enabled {
+			continue
+		}
+		mark := "🟢"
+		if !s.Connected {
+			mark = "🔴"
+			embed.Color = colorDegraded
+		}
+		line := fmt.Sprintf("%s %s (%s)", mark, s.ID, s.Type)
+		if s.LinkState != "" {
+			line += " " + s.LinkState
+		}
+		services = append(services, line)
+	}
+	slices.Sort(services)
+
+	talker, heard := d.stations(status.Traffic, now)
+	embed.Fields = append([]*discordgo.MessageEmbedField{
+		{Name: "Services", Value: orNone(strings.Join(services, "\n"))},
+		{Name: "Talking", Value: orNone(talker), Inline: true},
+		{Name: "Transmissions", Value: fmt.Sprint(status.Statistics.ActiveTransmissions), Inline: true},
+		{Name: "Last Heard", Value: orNone(strings.Join(heard, "\n"))},
+	}, d.audioFields(status)...)
+	return embed
+}
+
+// stations returns who is talking now and the stations last heard, most
+// recent first
+func (d *Dashboard) stations(traffic usrp.StatsSnapshot, now time.Time) (string, []string) {
+	type station struct {
+		name string
+		usrp.SourceStats
+	}
+	var stations []station
+	for source, stats := range traffic.Sources {
+		if stats.LastSeen.IsZero() {
+			continue
+		}
+		name := stats.CallSign
+		if name == "" {
+			name = source
+		}
+		stations = append(stations, station{name, stats})
+	}
+	slices.SortFunc(stations, func(a, b station) int { return b.LastSeen.Compare(a.LastSeen) })
+
+	var talker string
+	var heard []string
+	for i, s := range stations {
+		if i == 0 && now.Sub(s.LastSeen) <= activeWindow {
+			talker = fmt.Sprintf("**%s** on TG %d", s.name, s.LastTalkGroup)
+		}
+		if len(heard) < d.config.LastHeard {
+			heard = append(heard, fmt.Sprintf("%s · TG %d · <t:%d:R>", s.name, s.LastTalkGroup, s.LastSeen.Unix()))
+		}
+	}
+	return talker, heard
+}
+
+// audioFields renders the router's and the Discord bot's audio counters
+func (d *Dashboard) audioFields(status *RouterStatus) []*discordgo.MessageEmbedField {
+	var fields []*discordgo.MessageEmbedField
+	if status != nil {
+		total := status.Traffic.Total
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name: "Router Audio",
+			Value: fmt.Sprintf("Routed %d · dropped %d · conversion errors %d\nUSRP loss %.1f%% (%d of %d)",
+				status.Statistics.RoutedMessages, status.Statistics.DroppedMessages, status.Statistics.ConversionErrors,
+				total.LossRate()*100, total.Lost, total.Packets+total.Lost),
+		})
+	}
+	if d.bot != nil {
+		rx, tx := d.bot.ReceiveStats(), d.bot.SendStats()
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name: "Discord Audio",
+			Value: fmt.Sprintf("Heard %d frames from %d speakers · concealed %d · errors %d\nSent %d frames · dropped %d",
+				rx.Frames, rx.Speakers, rx.Concealed, rx.Errors, tx.Frames, tx.Dropped),
+		})
+	}
+	return fields
+}
+
+// orNone returns s, or a dash for an empty embed field
+func orNone(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
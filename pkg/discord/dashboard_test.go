@@ -0,0 +1,140 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// fakeEmbeds records the embeds in a text channel
+type fakeEmbeds struct {
+	embeds map[string]*discordgo.MessageEmbed
+	pinned []*discordgo.Message
+	posts  int
+}
+
+func (f *fakeEmbeds) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.posts++
+	id := string(rune('a' + f.posts))
+	f.embeds[id] = embed
+	return &discordgo.Message{ID: id}, nil
+}
+
+func (f *fakeEmbeds) ChannelMessageEditEmbed(channelID, messageID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.embeds[messageID] = embed
+	return &discordgo.Message{ID: messageID}, nil
+}
+
+func (f *fakeEmbeds) ChannelMessagePin(channelID, messageID string, options ...discordgo.RequestOption) error {
+	f.pinned = append(f.pinned, &discordgo.Message{
+		ID:     messageID,
+		Author: &discordgo.User{Bot: true},
+		Embeds: []*discordgo.MessageEmbed{f.embeds[messageID]},
+	})
+	return nil
+}
+
+func (f *fakeEmbeds) ChannelMessagesPinned(channelID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	return f.pinned, nil
+}
+
+func TestDashboard(t *testing.T) {
+	now := time.Now()
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Shaped like the audio router's /status
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"router": map[string]interface{}{"name": "Hub", "uptime": "1h0m0s"},
+			"services": []map[string]interface{}{
+				{"id": "allstar", "type": "usrp", "enabled": true, "connected": true, "link_state": "up"},
+				{"id": "discord", "type": "discord", "enabled": true, "connected": false},
+			},
+			"statistics": map[string]interface{}{"routed_messages": 100, "active_transmissions": 1},
+			"usrp_traffic": usrp.StatsSnapshot{
+				Total: usrp.TrafficStats{Packets: 99, Lost: 1},
+				Sources: map[string]usrp.SourceStats{
+					"10.0.0.1:1234": {TrafficStats: usrp.TrafficStats{LastSeen: now}, CallSign: "W1AW", LastTalkGroup: 3100},
+					"10.0.0.2:1234": {TrafficStats: usrp.TrafficStats{LastSeen: now.Add(-time.Minute)}, LastTalkGroup: 9},
+				},
+			},
+		})
+	}))
+	defer router.Close()
+
+	discord := &fakeEmbeds{embeds: make(map[string]*discordgo.MessageEmbed)}
+	d := &Dashboard{
+		discord: discord,
+		config:  DashboardConfig{ChannelID: "status", LastHeard: 5},
+		fetch: func(ctx context.Context) (*RouterStatus, error) {
+			return FetchRouterStatus(ctx, router.Client(), router.URL)
+		},
+	}
+
+	// The first update posts and pins the embed, later ones edit it
+	for i := 0; i < 2; i++ {
+		if err := d.update(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if discord.posts != 1 || len(discord.pinned) != 1 {
+		t.Fatalf("Posted %d embeds and pinned %d, want 1", discord.posts, len(discord.pinned))
+	}
+
+	embed := discord.embeds[d.messageID]
+	if embed.Color != colorDegraded {
+		t.Errorf("Color %x with a service down", embed.Color)
+	}
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	for name, want := range map[string]string{
+		"Services":     "🔴 discord (discord)",
+		"Talking":      "**W1AW** on TG 3100",
+		"Last Heard":   "10.0.0.2:1234 · TG 9",
+		"Router Audio": "USRP loss 1.0% (1 of 100)",
+	} {
+		if !strings.Contains(fields[name], want) {
+			t.Errorf("%s is %q, want %q in it", name, fields[name], want)
+		}
+	}
+	if heard := fields["Last Heard"]; strings.Index(heard, "W1AW") > strings.Index(heard, "10.0.0.2") {
+		t.Errorf("Last heard not most recent first: %q", heard)
+	}
+
+	// After a restart the pinned embed is found and reused
+	restarted := &Dashboard{discord: discord, config: d.config, fetch: d.fetch}
+	if err := restarted.update(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if discord.posts != 1 || restarted.messageID != d.messageID {
+		t.Error("Restarted dashboard posted a new embed")
+	}
+
+	// An unreachable router shows as down
+	router.Close()
+	restarted.update(context.Background(), now)
+	if embed := discord.embeds[d.messageID]; embed.Color != colorDown || !strings.Contains(embed.Description, "unreachable") {
+		t.Errorf("Unreachable router shown as %q", embed.Description)
+	}
+}
+
+func TestNewDashboard(t *testing.T) {
+	bot := &Bot{session: &discordgo.Session{}}
+	if _, err := NewDashboard(bot, nil); err == nil {
+		t.Error("Created a dashboard without a channel")
+	}
+	d, err := NewDashboard(bot, &DashboardConfig{ChannelID: "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.config.Interval != 30*time.Second || d.config.LastHeard != 5 || d.config.RouterURL == "" {
+		t.Errorf("Defaults not applied: %+v", d.config)
+	}
+}
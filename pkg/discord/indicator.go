@@ -0,0 +1,116 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Indicator is where the bot shows the radio station it is playing
+type Indicator string
+
+const (
+	IndicatorNone     Indicator = ""         // Not shown
+	IndicatorNickname Indicator = "nickname" // The bot's nickname in its guild
+	IndicatorPresence Indicator = "presence" // The bot's presence, shared by every guild it is in
+)
+
+// maxNickname is the longest nickname Discord allows, in characters
+const maxNickname = 32
+
+// indicator shows the station on the air while radio audio plays into
+// Discord, e.g. "📻 W1AW on TG 3100", and clears it when the station
+// unkeys
+type indicator struct {
+	set    func(status string) error // Shows status, or clears it if empty
+	shown  string
+	limits *restLimiter // Spacing of changes (nil = none)
+}
+
+// newIndicator creates an indicator of kind for bot
+func newIndicator(bot *Bot, kind Indicator) (*indicator, error) {
+	switch kind {
+	case IndicatorNickname:
+		return &indicator{set: bot.setNickname, limits: bot.rest}, nil
+	case IndicatorPresence:
+		return &indicator{set: bot.setPresence, limits: bot.rest}, nil
+	}
+	return nil, fmt.Errorf("unknown speaking indicator %q", kind)
+}
+
+// run shows transmission updates until ctx is done. Only the latest update
+// matters, so a backlog, as when Discord rate limits the bot, is skipped.
+func (i *indicator) run(ctx context.Context, updates <-chan transmission) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx := <-updates:
+			tx = latest(tx, updates)
+			if indicated(tx) == i.shown {
+				continue
+			}
+			// Updates arriving while the change waits supersede it
+			if !i.limits.wait(ctx, "indicator", nicknameInterval) {
+				return
+			}
+			i.show(latest(tx, updates))
+		}
+	}
+}
+
+// latest returns the last of the updates waiting, or tx if there are none
+func latest(tx transmission, updates <-chan transmission) transmission {
+	for {
+		select {
+		case tx = <-updates:
+		default:
+			return tx
+		}
+	}
+}
+
+// indicated returns what the indicator shows for a transmission: the
+// station while it is on the air, nothing once it has ended
+func indicated(tx transmission) string {
+	if tx.duration == 0 {
+		return tx.status()
+	}
+	return ""
+}
+
+// show shows a transmission while it is on the air
+func (i *indicator) show(tx transmission) {
+	status := indicated(tx)
+	if status == i.shown {
+		return
+	}
+	if err := i.set(status); err != nil {
+		log.Printf("Error updating speaking indicator: %v", err)
+		return
+	}
+	i.shown = status
+}
+
+// setNickname sets the bot's nickname in its guild, or clears it back to
+// the bot's username
+func (b *Bot) setNickname(nickname string) error {
+	if runes := []rune(nickname); len(runes) > maxNickname {
+		nickname = string(runes[:maxNickname])
+	}
+	if err := b.session.GuildMemberNickname(b.guild(), "@me", nickname); err != nil {
+		return fmt.Errorf("failed to set nickname: %w", err)
+	}
+	return nil
+}
+
+// setPresence sets the bot's presence, or clears it back to botStatus
+func (b *Bot) setPresence(status string) error {
+	if status == "" {
+		status = botStatus
+	}
+	if err := b.session.UpdateGameStatus(0, status); err != nil {
+		return fmt.Errorf("failed to set presence: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStatus records the statuses an indicator sets
+type fakeStatus struct {
+	mutex    sync.Mutex
+	statuses []string
+	fail     bool
+}
+
+func (f *fakeStatus) set(status string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fail {
+		return errors.New("rate limited")
+	}
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+func (f *fakeStatus) snapshot() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.statuses...)
+}
+
+func TestIndicator_Show(t *testing.T) {
+	status := &fakeStatus{}
+	ind := &indicator{set: status.set}
+
+	ind.show(transmission{callsign: "W1AW", talkGroup: 3100})
+	ind.show(transmission{callsign: "W1AW", talkGroup: 3100}) // Unchanged
+	ind.show(transmission{callsign: "W1AW", talkGroup: 3100, duration: time.Second})
+	ind.show(transmission{duration: time.Second}) // Already clear
+
+	// A failed update is retried by the next one
+	status.fail = true
+	ind.show(transmission{callsign: "KC1NCS"})
+	status.fail = false
+	ind.show(transmission{callsign: "KC1NCS"})
+
+	got, want := status.snapshot(), []string{"📻 W1AW on TG 3100", "", "📻 KC1NCS"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Statuses %q, want %q", got, want)
+	}
+}
+
+func TestIndicator_Run(t *testing.T) {
+	status := &fakeStatus{}
+	ind := &indicator{set: status.set}
+	air := newTransmissions(2 * time.Second)
+	updates := air.watch()
+
+	// A backlog is skipped to the latest update
+	now := time.Now()
+	air.frame(true, 3100, now)
+	air.identify("W1AW")
+	air.frame(false, 3100, now.Add(time.Second))
+	air.frame(true, 3100, now.Add(2*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ind.run(ctx, updates)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := status.snapshot()
+		if len(got) == 1 && got[0] == "📻 Unknown station on TG 3100" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Statuses %q", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNewIndicator(t *testing.T) {
+	if _, err := newIndicator(&Bot{}, "banner"); err == nil {
+		t.Error("Unknown indicator accepted")
+	}
+	for _, kind := range []Indicator{IndicatorNickname, IndicatorPresence} {
+		if _, err := newIndicator(&Bot{}, kind); err != nil {
+			t.Errorf("newIndicator(%q): %v", kind, err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// BotManagerConfig holds the settings of a bot serving several guilds
+type BotManagerConfig struct {
+	Token Secret     // Discord bot token
+	Bot   *BotConfig // Audio settings for every channel's bot (nil = DefaultBotConfig)
+
+	// Gateway sharding, which Discord requires of a bot in 2500 or more
+	// guilds. Each guild's events come on one shard, by its ID, and a
+	// large bot can run its shards across several processes.
+	ShardCount int   // Shards the bot's guilds are split across (0 = 1, unsharded)
+	Shards     []int // Shards this process runs (nil = all of them)
+}
+
+// identifyInterval is the least time between gateway sessions
+// identifying, Discord's limit for a bot without larger concurrency
+const identifyInterval = 5 * time.Second
+
+// BotManager runs one Discord bot, on one token and a gateway session per
+// shard, in a voice channel in each of several guilds. Each guild gets its
+// own Bot with its own audio channels, so each channel can be bridged to a
+// different USRP stream or talk group. Discord allows a bot one voice
+// channel per guild.
+type BotManager struct {
+	sessions   map[int]*discordgo.Session // By shard ID
+	shardCount int
+	config     *BotManagerConfig
+	bots       map[string]*Bot // By guild ID
+
+	ctx     context.Context
+	running bool
+	mutex   sync.Mutex
+}
+
+// NewBotManager creates a bot manager with no channels
+func NewBotManager(config *BotManagerConfig) (*BotManager, error) {
+	if config.Token == "" {
+		return nil, fmt.Errorf("Discord bot token is required")
+	}
+
+	shardCount := max(config.ShardCount, 1)
+	shards := config.Shards
+	if shards == nil {
+		for shard := 0; shard < shardCount; shard++ {
+			shards = append(shards, shard)
+		}
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shards to run")
+	}
+
+	m := &BotManager{
+		sessions:   make(map[int]*discordgo.Session, len(shards)),
+		shardCount: shardCount,
+		config:     config,
+		bots:       make(map[string]*Bot),
+	}
+	for _, shard := range shards {
+		if shard < 0 || shard >= shardCount {
+			return nil, fmt.Errorf("shard %d is not one of the %d shards", shard, shardCount)
+		}
+		session, err := discordgo.New("Bot " + config.Token.Reveal())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Discord session: %w", err)
+		}
+		session.ShardID, session.ShardCount = shard, shardCount
+		session.AddHandler(m.onReady)
+		m.sessions[shard] = session
+	}
+	return m, nil
+}
+
+// shardOf returns the shard a guild's events come on
+func (m *BotManager) shardOf(guildID string) (int, error) {
+	if m.shardCount == 1 {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid guild ID %q: %w", guildID, err)
+	}
+	return int((id >> 22) % uint64(m.shardCount)), nil
+}
+
+// onReady handles a session connecting
+func (m *BotManager) onReady(s *discordgo.Session, event *discordgo.Ready) {
+	log.Printf("Discord bot ready: %s#%s on shard %d of %d, serving %d guilds",
+		event.User.Username, event.User.Discriminator, s.ShardID, s.ShardCount, len(m.Bots()))
+
+	if err := s.UpdateGameStatus(0, botStatus); err != nil {
+		log.Printf("Error setting status: %v", err)
+	}
+}
+
+// AddChannel adds a bot for a voice channel in a guild and returns it.
+// Once the manager is running the bot starts and joins straight away.
+func (m *BotManager) AddChannel(guildID, channelID string) (*Bot, error) {
+	if guildID == "" || channelID == "" {
+		return nil, fmt.Errorf("guild and channel IDs are required")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if existing, ok := m.bots[guildID]; ok {
+		return nil, fmt.Errorf("guild %s already has a bot in channel %s", guildID, existing.config.ChannelID)
+	}
+
+	config := DefaultBotConfig()
+	if m.config.Bot != nil {
+		copied := *m.config.Bot
+		config = &copied
+	}
+	config.Token = m.config.Token
+	config.GuildID = guildID
+	config.ChannelID = channelID
+
+	shard, err := m.shardOf(guildID)
+	if err != nil {
+		return nil, err
+	}
+	session, ok := m.sessions[shard]
+	if !ok {
+		return nil, fmt.Errorf("guild %s is on shard %d, which this process does not run", guildID, shard)
+	}
+
+	bot, err := newBot(session, config)
+	if err != nil {
+		return nil, err
+	}
+	bot.managed = true
+	bot.setupEventHandlers()
+	m.bots[guildID] = bot
+
+	if m.running {
+		m.startBot(bot)
+	}
+	return bot, nil
+}
+
+// RemoveChannel stops the bot in a guild, leaving its voice channel
+func (m *BotManager) RemoveChannel(guildID string) error {
+	m.mutex.Lock()
+	bot, ok := m.bots[guildID]
+	delete(m.bots, guildID)
+	m.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no bot in guild %s", guildID)
+	}
+	bot.removeEventHandlers()
+	if err := bot.LeaveVoiceChannel(); err != nil {
+		log.Printf("Error leaving voice in guild %s: %v", guildID, err)
+	}
+	return bot.Stop()
+}
+
+// Bot returns the bot in a guild
+func (m *BotManager) Bot(guildID string) (*Bot, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	bot, ok := m.bots[guildID]
+	return bot, ok
+}
+
+// Bots returns every guild's bot, ordered by guild ID
+func (m *BotManager) Bots() []*Bot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	guilds := make([]string, 0, len(m.bots))
+	for guildID := range m.bots {
+		guilds = append(guilds, guildID)
+	}
+	sort.Strings(guilds)
+
+	bots := make([]*Bot, 0, len(guilds))
+	for _, guildID := range guilds {
+		bots = append(bots, m.bots[guildID])
+	}
+	return bots
+}
+
+// Start opens the shards' sessions, one identify interval apart, then
+// starts every bot and joins its voice channel. A channel that cannot be
+// joined yet is retried by its bot.
+func (m *BotManager) Start(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.running {
+		return fmt.Errorf("bot manager is already running")
+	}
+	shards := m.shards()
+	m.checkShards(m.sessions[shards[0]])
+	for i, shard := range shards {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				m.closeSessions()
+				return ctx.Err()
+			case <-time.After(identifyInterval):
+			}
+		}
+		if err := m.sessions[shard].Open(); err != nil {
+			m.closeSessions()
+			return fmt.Errorf("failed to open Discord session for shard %d: %w", shard, err)
+		}
+	}
+	m.ctx = ctx
+	m.running = true
+
+	for _, bot := range m.bots {
+		m.startBot(bot)
+	}
+	log.Printf("Discord bot manager started with %d channels", len(m.bots))
+	return nil
+}
+
+// startBot starts a bot, unless already started by its bridge, and joins
+// its channel. The caller holds the mutex.
+func (m *BotManager) startBot(bot *Bot) {
+	if !bot.IsRunning() {
+		if err := bot.Start(m.ctx); err != nil {
+			log.Printf("Error starting bot for guild %s: %v", bot.config.GuildID, err)
+			return
+		}
+	}
+	if !bot.IsConnected() {
+		if err := bot.JoinVoiceChannel(bot.config.GuildID, bot.config.ChannelID); err != nil {
+			log.Printf("Warning: Could not join voice channel %s in guild %s, retrying: %v",
+				bot.config.ChannelID, bot.config.GuildID, err)
+		}
+	}
+}
+
+// Stop stops every bot and closes the shared session
+func (m *BotManager) Stop() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.running {
+		return nil
+	}
+	m.running = false
+
+	for guildID, bot := range m.bots {
+		if err := bot.Stop(); err != nil {
+			log.Printf("Error stopping bot for guild %s: %v", guildID, err)
+		}
+	}
+	m.closeSessions()
+
+	log.Println("Discord bot manager stopped")
+	return nil
+}
+
+// shards returns the IDs of the shards this process runs, in order
+func (m *BotManager) shards() []int {
+	shards := make([]int, 0, len(m.sessions))
+	for shard := range m.sessions {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+// checkShards warns when Discord recommends more shards than configured,
+// before it starts refusing to connect the bot unsharded
+func (m *BotManager) checkShards(session *discordgo.Session) {
+	gateway, err := session.GatewayBot()
+	if err != nil {
+		log.Printf("Warning: could not get Discord's recommended shards: %v", err)
+		return
+	}
+	if gateway.Shards > m.shardCount {
+		log.Printf("Warning: Discord recommends %d shards for this bot, running %d", gateway.Shards, m.shardCount)
+	}
+}
+
+// closeSessions closes every shard's session. The caller holds the mutex.
+func (m *BotManager) closeSessions() {
+	for shard, session := range m.sessions {
+		if err := session.Close(); err != nil {
+			log.Printf("Error closing Discord session for shard %d: %v", shard, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package discord
+
+import (
+	"testing"
+)
+
+func TestBotManager(t *testing.T) {
+	if _, err := NewBotManager(&BotManagerConfig{}); err == nil {
+		t.Fatal("Created a manager without a token")
+	}
+	m, err := NewBotManager(&BotManagerConfig{Token: "test_token_not_real", Bot: &BotConfig{BufferSize: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One channel per guild, each with its own bot on the shared session
+	b, err := m.AddChannel("guild-b", "voice-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.AddChannel("guild-a", "voice-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddChannel("guild-a", "voice-3"); err == nil {
+		t.Error("Added a second channel in one guild")
+	}
+	if _, err := m.AddChannel("guild-c", ""); err == nil {
+		t.Error("Added a channel without an ID")
+	}
+	if a.session != b.session || !a.managed || cap(a.AudioIn) != 5 || a.config.GuildID != "guild-a" {
+		t.Errorf("Bot not set up for the manager: %+v", a.config)
+	}
+	if bots := m.Bots(); len(bots) != 2 || bots[0] != a || bots[1] != b {
+		t.Errorf("Bots = %v", bots)
+	}
+	if got, ok := m.Bot("guild-b"); !ok || got != b {
+		t.Error("Bot for guild-b not found")
+	}
+
+	// Each bot handles its own guild's events only
+	if a.otherGuild("guild-a") || !a.otherGuild("guild-b") {
+		t.Error("Bot does not filter events by guild")
+	}
+
+	if err := m.RemoveChannel("guild-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Bot("guild-a"); ok || len(a.handlers) != 0 {
+		t.Error("Removed bot still managed")
+	}
+	if err := m.RemoveChannel("guild-a"); err == nil {
+		t.Error("Removed a channel twice")
+	}
+	if err := m.Stop(); err != nil {
+		t.Errorf("Stopping an idle manager: %v", err)
+	}
+}
+
+func TestBotManager_Shards(t *testing.T) {
+	if _, err := NewBotManager(&BotManagerConfig{Token: "test_token_not_real", ShardCount: 2, Shards: []int{2}}); err == nil {
+		t.Error("Created a manager running a shard beyond the shard count")
+	}
+	m, err := NewBotManager(&BotManagerConfig{Token: "test_token_not_real", ShardCount: 2, Shards: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A guild's shard is its ID's timestamp bits modulo the shard count
+	if _, err := m.AddChannel("8388608", "voice"); err == nil {
+		t.Error("Added a guild on a shard the process does not run")
+	}
+	bot, err := m.AddChannel("4194304", "voice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.session.ShardID != 1 || bot.session.ShardCount != 2 {
+		t.Errorf("Bot on shard %d of %d, want 1 of 2", bot.session.ShardID, bot.session.ShardCount)
+	}
+	if _, err := m.AddChannel("guild-a", "voice"); err == nil {
+		t.Error("Added a guild with an invalid ID to a sharded bot")
+	}
+}
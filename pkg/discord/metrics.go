@@ -0,0 +1,50 @@
+package discord
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/internal/transport"
+)
+
+// botMetrics are a bot's link metrics, as the router keeps for its other
+// links: Opus packets received and sent, frames dropped, decode and encode
+// errors, and the gateway's latency as the RTT. As a HealthReporter they
+// add the voice reconnects and the frames queued to send.
+type botMetrics struct {
+	transport.Metrics
+	bot *Bot
+}
+
+// Health returns the health of the bot's voice connection
+func (m botMetrics) Health() transport.LinkHealth {
+	return transport.LinkHealth{
+		Reconnects: m.bot.Reconnects(),
+		QueueDepth: len(m.bot.AudioOut),
+	}
+}
+
+// Metrics returns the bot's link metrics, for a transport.PrometheusExporter
+func (b *Bot) Metrics() transport.Metrics {
+	return botMetrics{Metrics: b.metrics, bot: b}
+}
+
+// sampleLatency records the gateway's heartbeat latency as an RTT sample.
+// discordgo does not time the voice websocket's heartbeats, so the main
+// gateway's, on the same Discord edge, stand in for them.
+func (b *Bot) sampleLatency() {
+	if latency := gatewayLatency(b.session); latency > 0 {
+		b.metrics.RTT(latency)
+	}
+}
+
+// gatewayLatency returns the time the gateway took to acknowledge the last
+// heartbeat, or 0 while one is awaiting acknowledgement
+func gatewayLatency(s *discordgo.Session) time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	if s.LastHeartbeatSent.IsZero() {
+		return 0
+	}
+	return max(s.LastHeartbeatAck.Sub(s.LastHeartbeatSent), 0)
+}
@@ -0,0 +1,85 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/internal/transport"
+)
+
+func TestBot_Metrics(t *testing.T) {
+	metrics := transport.NewAtomicMetrics()
+	b := &Bot{
+		session:    &discordgo.Session{},
+		AudioOut:   make(chan []byte, 10),
+		receiver:   newReceiver(nil, false),
+		metrics:    metrics,
+		reconnects: 2,
+	}
+	b.receiver.metrics = metrics
+	sender, err := newSender(64000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.metrics = metrics
+
+	// Packets in, and frames dropped with AudioIn full
+	talker := newOpusTalker(t, 7, 600)
+	for i := 0; i < 3; i++ {
+		if err := b.receiver.packet(talker.next(), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.receiver.delivered(false)
+
+	// Packets out, and dropped with the voice connection's queue full
+	link := voiceLink{speaking: func(bool) error { return nil }, opus: make(chan []byte, 1)}
+	for i := 0; i < 2; i++ {
+		if err := sender.tick(link, make([]byte, discordFrameSize*2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// and the gateway's latency
+	b.session.LastHeartbeatSent = time.Now()
+	b.session.LastHeartbeatAck = b.session.LastHeartbeatSent.Add(40 * time.Millisecond)
+	b.sampleLatency()
+
+	b.AudioOut <- make([]byte, discordFrameSize*2)
+	exporter := transport.NewPrometheusExporter("usrp")
+	exporter.Register("discord-guild", b.Metrics())
+	report := exporter.Reports()["discord-guild"]
+	if report.PacketsIn != 3 || report.PacketsOut != 1 || report.Drops != 2 || report.RTT != 40*time.Millisecond {
+		t.Errorf("Metrics %+v", report.MetricsSnapshot)
+	}
+	if report.Reconnects != 2 || report.QueueDepth != 1 {
+		t.Errorf("Health %+v", report.LinkHealth)
+	}
+
+	var out strings.Builder
+	exporter.WriteTo(&out)
+	for _, want := range []string{
+		`usrp_transport_reconnects_total{link="discord-guild"} 2`,
+		`usrp_transport_queue_depth{link="discord-guild"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGatewayLatency(t *testing.T) {
+	s := &discordgo.Session{}
+	if latency := gatewayLatency(s); latency != 0 {
+		t.Errorf("Latency %v before a heartbeat", latency)
+	}
+
+	// A heartbeat awaiting its acknowledgement has no latency yet
+	s.LastHeartbeatAck = time.Now()
+	s.LastHeartbeatSent = s.LastHeartbeatAck.Add(time.Second)
+	if latency := gatewayLatency(s); latency != 0 {
+		t.Errorf("Latency %v awaiting acknowledgement", latency)
+	}
+}
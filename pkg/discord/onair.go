@@ -0,0 +1,135 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// transmission is a radio transmission played into Discord
+type transmission struct {
+	callsign  string
+	talkGroup uint32
+	duration  time.Duration // Zero while still on the air
+}
+
+// station names the transmitting station
+func (tx transmission) station() string {
+	if tx.callsign == "" {
+		return "Unknown station"
+	}
+	return tx.callsign
+}
+
+// String returns the transmission's line in the transcript
+func (tx transmission) String() string {
+	line := fmt.Sprintf("📻 **%s**", tx.station())
+	if tx.talkGroup != 0 {
+		line += fmt.Sprintf(" on TG %d", tx.talkGroup)
+	}
+	if tx.duration == 0 {
+		return line + " keyed up"
+	}
+	return line + fmt.Sprintf(" · %.1fs", tx.duration.Seconds())
+}
+
+// status returns the transmission as a short status, e.g. "📻 W1AW on TG 3100"
+func (tx transmission) status() string {
+	status := "📻 " + tx.station()
+	if tx.talkGroup != 0 {
+		status += fmt.Sprintf(" on TG %d", tx.talkGroup)
+	}
+	return status
+}
+
+// transmissions tracks radio transmissions from the voice frames and
+// metadata played into Discord, and queues each start, change of callsign
+// and end to its watchers. Watchers run on their own goroutines, off the
+// audio path.
+type transmissions struct {
+	timeout  time.Duration // Silence that ends a transmission without an unkey
+	watchers []chan transmission
+
+	callsign  string // Station named by the radio's latest metadata
+	current   *transmission
+	started   time.Time
+	lastFrame time.Time
+	mutex     sync.Mutex
+}
+
+// newTransmissions creates a tracker ending transmissions silent for timeout
+func newTransmissions(timeout time.Duration) *transmissions {
+	return &transmissions{timeout: timeout}
+}
+
+// watch returns a new channel of transmission updates. Watchers are added
+// before frames are tracked.
+func (t *transmissions) watch() <-chan transmission {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	updates := make(chan transmission, 16)
+	t.watchers = append(t.watchers, updates)
+	return updates
+}
+
+// identify records the callsign the radio names for the transmission
+// under way or about to start
+func (t *transmissions) identify(callsign string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.callsign = callsign
+	if t.current != nil && t.current.callsign != callsign {
+		t.current.callsign = callsign
+		t.post(*t.current)
+	}
+}
+
+// frame tracks a voice frame from the radio: keyed frames start or extend
+// a transmission and an unkeyed one ends it
+func (t *transmissions) frame(ptt bool, talkGroup uint32, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !ptt {
+		t.end(now)
+		return
+	}
+	if t.current == nil {
+		t.current = &transmission{callsign: t.callsign, talkGroup: talkGroup}
+		t.started = now
+		t.post(*t.current)
+	}
+	t.lastFrame = now
+}
+
+// check ends a transmission whose frames stopped without an unkey
+func (t *transmissions) check(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.current != nil && now.Sub(t.lastFrame) > t.timeout {
+		t.end(t.lastFrame)
+	}
+}
+
+// end ends the transmission under way, if any. The caller holds the mutex.
+func (t *transmissions) end(now time.Time) {
+	if t.current == nil {
+		return
+	}
+	t.current.duration = max(now.Sub(t.started), time.Millisecond)
+	t.post(*t.current)
+	t.current = nil
+	t.callsign = "" // Each transmission is identified afresh
+}
+
+// post queues an update to every watcher, dropping it rather than stall
+// audio if one is slow. The caller holds the mutex.
+func (t *transmissions) post(tx transmission) {
+	for _, updates := range t.watchers {
+		select {
+		case updates <- tx:
+		default:
+			log.Printf("Transmission updates backlog full, dropping %s", tx)
+		}
+	}
+}
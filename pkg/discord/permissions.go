@@ -0,0 +1,161 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Permission is what a Discord member may do through the bridge. Each
+// permission includes the ones before it.
+type Permission string
+
+const (
+	PermissionNone    Permission = "none"    // Ignored entirely
+	PermissionListen  Permission = "listen"  // Hear the radio, but not key it
+	PermissionTalk    Permission = "talk"    // Key the radio
+	PermissionCommand Permission = "command" // Key the radio and control the bot
+)
+
+// level orders permissions
+func (p Permission) level() int {
+	switch p {
+	case PermissionListen:
+		return 1
+	case PermissionTalk:
+		return 2
+	case PermissionCommand:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether p includes want
+func (p Permission) Allows(want Permission) bool {
+	return p.level() >= want.level()
+}
+
+// rolePermissionTTL is how long a member's permission is trusted before
+// their roles are looked up again
+const rolePermissionTTL = 5 * time.Minute
+
+// memberPermission is a member's permission as last looked up
+type memberPermission struct {
+	permission Permission
+	expires    time.Time
+	refreshing bool
+}
+
+// permissions resolves members' permissions from their Discord roles, the
+// highest of any role they hold. Lookups are cached, and a stale entry is
+// used while it is refreshed in the background, so the voice receive path
+// never waits on Discord's API.
+type permissions struct {
+	roles    map[string]Permission // Role ID to permission; nil lets everyone do everything
+	fallback Permission            // Members with none of the roles
+	lookup   func(userID string) ([]string, error)
+
+	members map[string]*memberPermission
+	mutex   sync.Mutex
+}
+
+// newPermissions creates permissions from role IDs to permissions, with
+// fallback for members with none of them ("listen" if empty). lookup
+// returns a member's role IDs.
+func newPermissions(roles map[string]Permission, fallback Permission, lookup func(userID string) ([]string, error)) (*permissions, error) {
+	for role, permission := range roles {
+		if permission.level() == 0 && permission != PermissionNone {
+			return nil, fmt.Errorf("role %s has unknown permission %q", role, permission)
+		}
+	}
+	if fallback == "" {
+		fallback = PermissionListen
+	} else if fallback.level() == 0 && fallback != PermissionNone {
+		return nil, fmt.Errorf("unknown default permission %q", fallback)
+	}
+	return &permissions{
+		roles:    roles,
+		fallback: fallback,
+		lookup:   lookup,
+		members:  make(map[string]*memberPermission),
+	}, nil
+}
+
+// fromRoles returns the permission granted by a set of role IDs
+func (p *permissions) fromRoles(roles []string) Permission {
+	permission := p.fallback
+	for _, role := range roles {
+		if granted, ok := p.roles[role]; ok && granted.level() > permission.level() {
+			permission = granted
+		}
+	}
+	return permission
+}
+
+// allows reports whether a member may do want, from the cache. An unknown
+// member has the fallback permission until their roles are looked up.
+func (p *permissions) allows(userID string, want Permission, now time.Time) bool {
+	if p == nil || p.roles == nil {
+		return true
+	}
+	if userID == "" {
+		return p.fallback.Allows(want) // Not yet named by Discord
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	member, ok := p.members[userID]
+	if !ok {
+		member = &memberPermission{permission: p.fallback}
+		p.members[userID] = member
+	}
+	if now.After(member.expires) && !member.refreshing {
+		member.refreshing = true
+		go p.refresh(userID)
+	}
+	return member.permission.Allows(want)
+}
+
+// refresh looks up a member's roles again
+func (p *permissions) refresh(userID string) {
+	roles, err := p.lookup(userID)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	member := p.members[userID]
+	if member == nil {
+		return
+	}
+	member.refreshing = false
+	if err != nil {
+		log.Printf("Error looking up Discord roles of %s: %v", userID, err)
+		member.expires = time.Now().Add(time.Minute / 2) // Retry soon
+		return
+	}
+	member.permission = p.fromRoles(roles)
+	member.expires = time.Now().Add(rolePermissionTTL)
+}
+
+// resolve looks up a member's permission now, as when they start speaking,
+// so their first words are not refused while it is looked up
+func (p *permissions) resolve(userID string) {
+	if p == nil || p.roles == nil {
+		return
+	}
+	p.mutex.Lock()
+	member, ok := p.members[userID]
+	if ok && (member.refreshing || time.Now().Before(member.expires)) {
+		p.mutex.Unlock()
+		return
+	}
+	if !ok {
+		p.members[userID] = &memberPermission{permission: p.fallback, refreshing: true}
+	} else {
+		member.refreshing = true
+	}
+	p.mutex.Unlock()
+
+	p.refresh(userID)
+}
@@ -0,0 +1,156 @@
+package discord
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRoles serves members' roles in place of Discord, counting lookups
+type fakeRoles struct {
+	roles   map[string][]string
+	lookups int
+	mutex   sync.Mutex
+}
+
+func (f *fakeRoles) lookup(userID string) ([]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.lookups++
+	roles, ok := f.roles[userID]
+	if !ok {
+		return nil, errors.New("unknown member")
+	}
+	return roles, nil
+}
+
+func TestPermission_Allows(t *testing.T) {
+	if !PermissionCommand.Allows(PermissionTalk) || !PermissionTalk.Allows(PermissionListen) {
+		t.Error("Higher permission does not include lower")
+	}
+	if PermissionListen.Allows(PermissionTalk) || PermissionNone.Allows(PermissionListen) {
+		t.Error("Lower permission includes higher")
+	}
+	if Permission("bogus").Allows(PermissionListen) {
+		t.Error("Unknown permission allows listening")
+	}
+}
+
+func TestNewPermissions(t *testing.T) {
+	if _, err := newPermissions(map[string]Permission{"1": "talker"}, "", nil); err == nil {
+		t.Error("Unknown role permission accepted")
+	}
+	if _, err := newPermissions(map[string]Permission{"1": PermissionTalk}, "everything", nil); err == nil {
+		t.Error("Unknown default permission accepted")
+	}
+	p, err := newPermissions(map[string]Permission{"1": PermissionNone}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.fallback != PermissionListen {
+		t.Errorf("Default permission %q, want listen", p.fallback)
+	}
+}
+
+func TestPermissions_FromRoles(t *testing.T) {
+	p, err := newPermissions(map[string]Permission{
+		"licensed": PermissionTalk,
+		"ncs":      PermissionCommand,
+		"muted":    PermissionNone,
+	}, PermissionListen, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		roles []string
+		want  Permission
+	}{
+		{nil, PermissionListen},
+		{[]string{"other"}, PermissionListen},
+		{[]string{"licensed"}, PermissionTalk},
+		{[]string{"licensed", "ncs"}, PermissionCommand},
+		{[]string{"muted"}, PermissionListen}, // No role lowers the default
+	}
+	for _, tt := range tests {
+		if got := p.fromRoles(tt.roles); got != tt.want {
+			t.Errorf("fromRoles(%v) = %q, want %q", tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestPermissions_Allows(t *testing.T) {
+	fake := &fakeRoles{roles: map[string][]string{"100": {"licensed"}, "200": {}}}
+	p, err := newPermissions(map[string]Permission{"licensed": PermissionTalk}, "", fake.lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolved members are known at once, and not looked up again until stale
+	p.resolve("100")
+	p.resolve("200")
+	now := time.Now()
+	if !p.allows("100", PermissionTalk, now) || p.allows("200", PermissionTalk, now) {
+		t.Error("Resolved permissions not applied")
+	}
+	if p.allows("100", PermissionCommand, now) {
+		t.Error("Talker allowed to command")
+	}
+	p.resolve("100")
+	if fake.lookups != 2 {
+		t.Errorf("%d lookups, want 2", fake.lookups)
+	}
+
+	// A member not yet resolved gets the default while looked up behind
+	fake.mutex.Lock()
+	fake.roles["300"] = []string{"licensed"}
+	fake.mutex.Unlock()
+	if p.allows("300", PermissionTalk, now) {
+		t.Error("Unresolved member allowed to talk")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !p.allows("300", PermissionTalk, now) {
+		if time.Now().After(deadline) {
+			t.Fatal("Background lookup never applied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Failed lookups keep the default
+	p.resolve("400")
+	if p.allows("400", PermissionTalk, now) {
+		t.Error("Member whose roles could not be found allowed to talk")
+	}
+
+	// Streams not yet named by Discord get the default, without a lookup
+	if p.allows("", PermissionTalk, now) || !p.allows("", PermissionListen, now) {
+		t.Error("Unnamed stream not given the default permission")
+	}
+
+	// Without roles everyone may do everything
+	var open *permissions
+	if !open.allows("200", PermissionCommand, now) {
+		t.Error("Nil permissions refuse")
+	}
+}
+
+func TestReceiver_Allow(t *testing.T) {
+	r := newReceiver(nil, false)
+	r.allow = func(userID string) bool { return userID == "100" }
+	now := time.Now()
+
+	alice, bob := newOpusTalker(t, 1, 400), newOpusTalker(t, 2, 1000)
+	r.identify(1, "100")
+	r.identify(2, "200")
+	r.packet(alice.next(), now)
+	r.packet(bob.next(), now)
+
+	talkers := r.talkers(now)
+	if len(talkers) != 1 || talkers[0].UserID != "100" {
+		t.Errorf("Talkers = %+v", talkers)
+	}
+	if stats := r.Stats(); stats.Refused != 1 {
+		t.Errorf("Refused %d packets, want 1", stats.Refused)
+	}
+}
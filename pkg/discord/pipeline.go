@@ -0,0 +1,40 @@
+package discord
+
+import (
+	"math"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+)
+
+// Processor processes a frame of 8kHz mono audio in place, as the audio
+// package's AGC, Denoiser, FilterChain, HighPassFilter and
+// LoudnessNormalizer do. Processors keep state from frame to frame, so
+// each bridge needs its own.
+type Processor interface {
+	Process(samples []int16)
+}
+
+// newPipeline returns one direction of the bridge's audio processing: an
+// AGC if configured, then the custom processors, in order
+func newPipeline(agc *audio.AGCConfig, processors []Processor) []Processor {
+	var pipeline []Processor
+	if agc != nil {
+		pipeline = append(pipeline, audio.NewAGC(agc))
+	}
+	return append(pipeline, processors...)
+}
+
+// runPipeline runs a frame through a pipeline's processors in order
+func runPipeline(pipeline []Processor, samples []int16) {
+	for _, p := range pipeline {
+		p.Process(samples)
+	}
+}
+
+// voiceGate returns a noise gate opening at threshold, an RMS amplitude,
+// for VoiceThreshold
+func voiceGate(threshold int16) *audio.NoiseGateConfig {
+	config := audio.DefaultNoiseGateConfig()
+	config.Threshold = 20 * math.Log10(float64(threshold)/32768)
+	return config
+}
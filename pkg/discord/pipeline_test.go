@@ -0,0 +1,97 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// gain is a Processor scaling audio, noting the order it ran in
+type gain struct {
+	factor int16
+	ran    *[]int16
+}
+
+func (g gain) Process(samples []int16) {
+	for i := range samples {
+		samples[i] *= g.factor
+	}
+	*g.ran = append(*g.ran, g.factor)
+}
+
+func TestPipeline(t *testing.T) {
+	var ran []int16
+	pipeline := newPipeline(audio.DefaultAGCConfig(), []Processor{gain{2, &ran}, gain{3, &ran}})
+	if len(pipeline) != 3 {
+		t.Fatalf("Pipeline of %d processors, want AGC and 2", len(pipeline))
+	}
+	if _, ok := pipeline[0].(*audio.AGC); !ok {
+		t.Errorf("First processor %T, want the AGC", pipeline[0])
+	}
+
+	samples := []int16{1, 2, 3}
+	runPipeline(newPipeline(nil, []Processor{gain{2, &ran}, gain{3, &ran}}), samples)
+	if samples[2] != 18 || len(ran) != 2 || ran[0] != 2 {
+		t.Errorf("Samples %v after processors run in order %v", samples, ran)
+	}
+}
+
+func TestBridge_RadioJitter(t *testing.T) {
+	bridge := &Bridge{
+		config: DefaultBridgeConfig(),
+		jitter: audio.NewJitterBuffer(&audio.JitterBufferConfig{MinDelay: 40 * time.Millisecond, MaxDelay: 100 * time.Millisecond}),
+	}
+
+	// Frames arriving out of order are buffered rather than played
+	for _, seq := range []uint32{2, 1, 3} {
+		msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, seq)}
+		msg.Header.SetPTT(true)
+		msg.AudioData[0] = int16(seq)
+		if err := bridge.processUSRPToDiscord(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := bridge.JitterStats(); stats.Received != 3 || stats.Played != 0 {
+		t.Fatalf("Jitter stats %+v, want 3 frames buffered", stats)
+	}
+
+	// and come out on the frame clock in order, once the delay has passed
+	now := time.Now().Add(100 * time.Millisecond)
+	for want := int16(1); want <= 3; want++ {
+		frame, ok := bridge.jitter.Pop(now)
+		if !ok || frame[0] != want {
+			t.Fatalf("Frame %v (%v), want sequence %d", frame, ok, want)
+		}
+		now = now.Add(20 * time.Millisecond)
+	}
+}
+
+func TestBridge_VoiceGate(t *testing.T) {
+	bridge := &Bridge{config: &BridgeConfig{VoiceThreshold: 1000}}
+	frame := func(level int16) []int16 {
+		samples := make([]int16, 160)
+		for i := range samples {
+			samples[i] = level
+		}
+		return samples
+	}
+
+	// Just over the threshold keys the radio, and it stays keyed through
+	// a pause shorter than the gate's hold
+	if !bridge.detectVoiceActivity(frame(1100)) {
+		t.Fatal("Audio over the threshold not keyed")
+	}
+	for n := 0; n < 10; n++ {
+		if !bridge.detectVoiceActivity(frame(0)) {
+			t.Fatalf("Unkeyed %dms into a pause", (n+1)*20)
+		}
+	}
+	for n := 0; n < 30; n++ {
+		bridge.detectVoiceActivity(frame(0))
+	}
+	if bridge.detectVoiceActivity(frame(900)) {
+		t.Error("Audio under the threshold keyed the radio")
+	}
+}
@@ -0,0 +1,115 @@
+package discord
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// messageInterval is the least time between messages posted or edited
+	// in a channel, within Discord's limit of 5 every 5 seconds
+	messageInterval = time.Second
+
+	// nicknameInterval is the least time between changes to the bot's
+	// nickname or presence, which Discord limits far more tightly than
+	// messages
+	nicknameInterval = 5 * time.Second
+)
+
+// RateLimitStats holds counters of the bot's REST rate limiting
+type RateLimitStats struct {
+	Limited uint64        `json:"limited"` // 429 responses from Discord
+	Waits   uint64        `json:"waits"`   // Requests held back to stay within the limits
+	Waited  time.Duration `json:"waited"`  // Total time requests were held back
+}
+
+// restLimiter spaces out the bot's routine REST requests: transcript and
+// dashboard edits, text posts, nickname and presence changes. discordgo
+// queues requests within the limits Discord advertises, but retries a 429
+// however often it gets one, and Discord bans a bot that collects too
+// many for a while; a bridge that edits a message for every key-up on a
+// busy net could. Requests on a route are spaced by its interval, and
+// after a 429 all routine requests hold off until Discord's retry time.
+type restLimiter struct {
+	last  map[string]time.Time // When each route last had a request
+	until time.Time            // No requests before this, after a 429
+	stats RateLimitStats
+	mutex sync.Mutex
+}
+
+// newRESTLimiter creates a limiter with no requests made yet
+func newRESTLimiter() *restLimiter {
+	return &restLimiter{last: make(map[string]time.Time)}
+}
+
+// wait blocks until a request on route may be made, at least interval
+// after the last, and claims the slot. It reports false if ctx is done
+// first. A nil limiter never waits.
+func (r *restLimiter) wait(ctx context.Context, route string, interval time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	r.mutex.Lock()
+	now := time.Now()
+	next := r.last[route].Add(interval)
+	if r.until.After(next) {
+		next = r.until
+	}
+	if !next.After(now) {
+		r.last[route] = now
+		r.mutex.Unlock()
+		return true
+	}
+	// Claim the slot now, so requests waiting on the route queue up behind
+	r.last[route] = next
+	r.stats.Waits++
+	r.stats.Waited += next.Sub(now)
+	r.mutex.Unlock()
+
+	timer := time.NewTimer(next.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// limited backs off after Discord answers a request with a 429
+func (r *restLimiter) limited(event *discordgo.RateLimit, now time.Time) {
+	if event.TooManyRequests == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stats.Limited++
+	if until := now.Add(event.RetryAfter); until.After(r.until) {
+		r.until = until
+	}
+}
+
+// Stats returns a copy of the current counters
+func (r *restLimiter) Stats() RateLimitStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.stats
+}
+
+// onRateLimit handles Discord rate limiting a request of the session's.
+// On a BotManager's shared session every bot backs off.
+func (b *Bot) onRateLimit(s *discordgo.Session, event *discordgo.RateLimit) {
+	b.rest.limited(event, time.Now())
+	if event.TooManyRequests != nil {
+		log.Printf("Discord rate limited %s, retrying after %v", event.URL, event.RetryAfter)
+	}
+}
+
+// RateLimitStats returns the bot's REST rate limiting counters
+func (b *Bot) RateLimitStats() RateLimitStats {
+	return b.rest.Stats()
+}
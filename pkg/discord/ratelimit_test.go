@@ -0,0 +1,52 @@
+package discord
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRESTLimiter(t *testing.T) {
+	r := newRESTLimiter()
+	ctx := context.Background()
+
+	// Requests on a route are spaced by its interval; other routes are not
+	start := time.Now()
+	r.wait(ctx, "channel", 50*time.Millisecond)
+	r.wait(ctx, "other", 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("First requests waited %v", elapsed)
+	}
+	r.wait(ctx, "channel", 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("Second request on a route waited only %v", elapsed)
+	}
+
+	// A 429 holds every route off until Discord's retry time
+	r.limited(&discordgo.RateLimit{TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 80 * time.Millisecond}}, time.Now())
+	start = time.Now()
+	r.wait(ctx, "new", time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("Request after a 429 waited only %v", elapsed)
+	}
+
+	// A wait gives up when its context is done
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if r.wait(canceled, "new", time.Hour) {
+		t.Error("Wait succeeded after its context was done")
+	}
+
+	stats := r.Stats()
+	if stats.Limited != 1 || stats.Waits != 3 || stats.Waited < 100*time.Millisecond {
+		t.Errorf("Stats %+v", stats)
+	}
+
+	// No limiter, no waiting
+	var none *restLimiter
+	if !none.wait(canceled, "channel", time.Hour) {
+		t.Error("Nil limiter waited")
+	}
+}
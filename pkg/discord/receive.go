@@ -0,0 +1,290 @@
+package discord
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/internal/transport"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/thesyncim/gopus"
+)
+
+// maxConcealed is the longest run of lost packets concealed; a longer gap
+// is a speaker pausing, not loss
+const maxConcealed = 5
+
+// speakerTimeout is how long a silent speaker's decoder is kept
+const speakerTimeout = time.Minute
+
+// talkerHold is how long a speaker counts as talking after their last
+// packet; Discord sends nothing between words
+const talkerHold = 200 * time.Millisecond
+
+// Talker is a Discord user heard now
+type Talker struct {
+	UserID   string `json:"user_id"`  // Discord user ID, empty until Discord names the SSRC
+	Callsign string `json:"callsign"` // Callsign or name configured for the user, if any
+	SSRC     uint32 `json:"ssrc"`
+}
+
+// ReceiveStats holds Discord voice receive counters
+type ReceiveStats struct {
+	Speakers  int    `json:"speakers"`  // Speakers (SSRCs) with a decoder now
+	Packets   uint64 `json:"packets"`   // Voice packets received
+	Concealed uint64 `json:"concealed"` // Lost packets concealed by the decoder
+	Errors    uint64 `json:"errors"`    // Packets that failed to decode
+	Refused   uint64 `json:"refused"`   // Packets from users not allowed to talk: without a callsign when one is required, or a talking role
+	Gated     uint64 `json:"gated"`     // Packets withheld by speakers' voice detection
+	CutOff    uint64 `json:"cut_off"`   // Transmissions cut off at a speaker's longest transmission
+	Frames    uint64 `json:"frames"`    // Mixed frames delivered on AudioIn
+	Dropped   uint64 `json:"dropped"`   // Mixed frames dropped with AudioIn full
+}
+
+// speaker is one SSRC's decoder
+type speaker struct {
+	decoder  *gopus.Decoder
+	sequence uint16
+	started  time.Time // Start of the current over
+	lastSeen time.Time
+
+	// Keying of the radio by the speaker's talk profile, if any
+	gate     *talkGate
+	gateUser string // User the gate's profile is for
+}
+
+// receiver decodes Discord voice packets with an Opus decoder per SSRC,
+// since each speaker's stream carries its own codec state, and mixes the
+// speakers into one stream of 20ms frames of 48kHz stereo PCM
+type receiver struct {
+	speakers map[uint32]*speaker
+	mixer    *audio.Mixer
+	pcm      []int16 // Decoder output
+
+	// Who is behind each SSRC, as Discord reports it, and what they are
+	// called on the radio
+	users     map[uint32]string
+	callsigns map[string]string
+	require   bool                     // Refuse users without a callsign
+	allow     func(userID string) bool // Whether a user may key the radio (nil = everyone)
+
+	// Per-user keying of the radio (both nil = every frame keys it)
+	profiles map[string]TalkProfile // By Discord user ID
+	profile  *TalkProfile           // Users not in profiles (nil = DefaultTalkProfile)
+
+	stats   ReceiveStats
+	metrics transport.Metrics // Packets received, errors and drops of the bot's link
+	mutex   sync.Mutex
+}
+
+// newReceiver creates a receiver naming users from callsigns, Discord user
+// ID to callsign. With require set, only users with a callsign are heard.
+func newReceiver(callsigns map[string]string, require bool) *receiver {
+	return &receiver{
+		speakers:  make(map[uint32]*speaker),
+		users:     make(map[uint32]string),
+		callsigns: callsigns,
+		require:   require,
+		// Interleaved stereo mixes sample by sample like mono, at twice
+		// the rate; everyone is heard at the same level
+		mixer: audio.NewMixer(&audio.MixerConfig{
+			SampleRate: discordSampleRate * 2,
+			FrameSize:  discordFrameSize,
+		}),
+		pcm:     make([]int16, discordFrameSize*6), // Up to 120ms, the longest Opus packet
+		metrics: transport.NewAtomicMetrics(),
+	}
+}
+
+// packet decodes a voice packet into its speaker's queue in the mixer
+func (r *receiver) packet(p *discordgo.Packet, now time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stats.Packets++
+	r.metrics.PacketIn(len(p.Opus))
+	userID := r.users[p.SSRC]
+	if (r.require && r.callsigns[userID] == "") || (r.allow != nil && !r.allow(userID)) {
+		// Unidentified or unauthorized stations may not key the radio
+		r.stats.Refused++
+		return nil
+	}
+	s, ok := r.speakers[p.SSRC]
+	if !ok {
+		decoder, err := gopus.NewDecoder(gopus.DefaultDecoderConfig(discordSampleRate, 2))
+		if err != nil {
+			return fmt.Errorf("failed to create Opus decoder: %w", err)
+		}
+		s = &speaker{decoder: decoder, sequence: p.Sequence - 1}
+		r.speakers[p.SSRC] = s
+	}
+	source := strconv.FormatUint(uint64(p.SSRC), 10)
+	r.updateGate(s, userID)
+
+	// Packets lost just before this one are concealed, so the speaker's
+	// audio does not jump
+	if missing := p.Sequence - s.sequence - 1; missing > 0 && missing <= maxConcealed {
+		for i := uint16(0); i < missing; i++ {
+			n, err := s.decoder.DecodeInt16(nil, r.pcm[:discordFrameSize])
+			if err != nil {
+				break
+			}
+			if s.gate == nil || s.gate.holding(now) {
+				r.mixer.Write(source, 0, r.pcm[:n*2])
+			}
+			r.stats.Concealed++
+		}
+	}
+	s.sequence = p.Sequence
+	if now.Sub(s.lastSeen) > talkerHold {
+		s.started = now
+	}
+	s.lastSeen = now
+
+	n, err := s.decoder.DecodeInt16(p.Opus, r.pcm)
+	if err != nil {
+		r.stats.Errors++
+		r.metrics.Error()
+		return fmt.Errorf("failed to decode Opus from SSRC %d: %w", p.SSRC, err)
+	}
+	if s.gate != nil {
+		keyed, cut := s.gate.process(r.pcm[:n*2], now)
+		if cut {
+			r.stats.CutOff++
+			log.Printf("Discord user %s reached the longest transmission, muted until they pause", userID)
+		}
+		if !keyed {
+			r.stats.Gated++
+			return nil
+		}
+	}
+	r.mixer.Write(source, 0, r.pcm[:n*2])
+	return nil
+}
+
+// updateGate gives a speaker the gate of their user's talk profile, once
+// Discord names them. The caller holds the mutex.
+func (r *receiver) updateGate(s *speaker, userID string) {
+	if r.profiles == nil && r.profile == nil {
+		return
+	}
+	if s.gate != nil && s.gateUser == userID {
+		return
+	}
+	profile, ok := r.profiles[userID]
+	if !ok {
+		profile = *cmp.Or(r.profile, DefaultTalkProfile())
+	}
+	s.gate = newTalkGate(profile)
+	s.gateUser = userID
+}
+
+// gated reports whether speakers key the radio by their talk profiles
+func (r *receiver) gated() bool {
+	return r.profiles != nil || r.profile != nil
+}
+
+// holding reports whether a speaker's gate keeps the radio keyed through
+// a pause. The caller holds the mutex.
+func (r *receiver) holding(now time.Time) bool {
+	for _, s := range r.speakers {
+		if s.gate != nil && s.gate.holding(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// identify records the Discord user behind an SSRC
+func (r *receiver) identify(ssrc uint32, userID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[ssrc] = userID
+}
+
+// talkers returns the speakers heard within talkerHold of now, the one
+// talking longest first
+func (r *receiver) talkers(now time.Time) []Talker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var talkers []Talker
+	for ssrc, s := range r.speakers {
+		if now.Sub(s.lastSeen) <= talkerHold {
+			userID := r.users[ssrc]
+			talkers = append(talkers, Talker{UserID: userID, Callsign: r.callsigns[userID], SSRC: ssrc})
+		}
+	}
+	slices.SortFunc(talkers, func(a, b Talker) int {
+		if c := r.speakers[a.SSRC].started.Compare(r.speakers[b.SSRC].started); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.SSRC, b.SSRC)
+	})
+	return talkers
+}
+
+// frame returns the next mixed 20ms frame as little-endian PCM bytes:
+// silence while a talk profile's hangtime holds the radio keyed, or nil
+// when nobody is talking
+func (r *receiver) frame(now time.Time) []byte {
+	var samples []int16
+	if r.mixer.Active() {
+		samples = r.mixer.Mix()
+	} else {
+		r.mutex.Lock()
+		holding := r.holding(now)
+		r.mutex.Unlock()
+		if !holding {
+			return nil
+		}
+		samples = make([]int16, discordFrameSize)
+	}
+	pcm := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(sample))
+	}
+	return pcm
+}
+
+// prune forgets speakers silent for longer than speakerTimeout
+func (r *receiver) prune(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for ssrc, s := range r.speakers {
+		if now.Sub(s.lastSeen) > speakerTimeout {
+			delete(r.speakers, ssrc)
+			delete(r.users, ssrc)
+			r.mixer.Remove(strconv.FormatUint(uint64(ssrc), 10))
+		}
+	}
+}
+
+// delivered counts a mixed frame delivered or dropped
+func (r *receiver) delivered(ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if ok {
+		r.stats.Frames++
+	} else {
+		r.stats.Dropped++
+		r.metrics.Drop()
+	}
+}
+
+// Stats returns a copy of the current counters
+func (r *receiver) Stats() ReceiveStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stats := r.stats
+	stats.Speakers = len(r.speakers)
+	return stats
+}
@@ -0,0 +1,181 @@
+package discord
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+	"github.com/thesyncim/gopus"
+)
+
+// opusTalker encodes a tone as a Discord speaker's voice packets
+type opusTalker struct {
+	t        *testing.T
+	ssrc     uint32
+	sequence uint16
+	tone     signal.Generator
+	encoder  *gopus.Encoder
+}
+
+func newOpusTalker(t *testing.T, ssrc uint32, frequency float64) *opusTalker {
+	t.Helper()
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{SampleRate: discordSampleRate, Channels: 2, Application: gopus.ApplicationAudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &opusTalker{t: t, ssrc: ssrc, tone: signal.NewSine(frequency, 0.3, discordSampleRate), encoder: encoder}
+}
+
+// next returns the speaker's next 20ms packet
+func (ot *opusTalker) next() *discordgo.Packet {
+	mono := make([]int16, discordFrameSize/2)
+	ot.tone.Fill(mono)
+	stereo := make([]int16, discordFrameSize)
+	for i, s := range mono {
+		stereo[i*2], stereo[i*2+1] = s, s
+	}
+	packet := make([]byte, 4000)
+	n, err := ot.encoder.EncodeInt16(stereo, packet)
+	if err != nil {
+		ot.t.Fatal(err)
+	}
+	ot.sequence++
+	return &discordgo.Packet{SSRC: ot.ssrc, Sequence: ot.sequence, Opus: packet[:n]}
+}
+
+func pcmLevel(pcm []byte) float64 {
+	var sum float64
+	for i := 0; i+1 < len(pcm); i += 2 {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(len(pcm)/2))
+}
+
+func TestReceiver(t *testing.T) {
+	r := newReceiver(nil, false)
+	now := time.Now()
+	if r.frame(now) != nil {
+		t.Fatal("Frame with nobody talking")
+	}
+
+	// Two speakers at once are decoded apart and mixed
+	alice, bob := newOpusTalker(t, 1, 400), newOpusTalker(t, 2, 1000)
+	var level float64
+	for i := 0; i < 25; i++ {
+		if i == 10 {
+			// Two of Alice's packets are lost and concealed
+			alice.next()
+			alice.next()
+		}
+		for _, p := range []*discordgo.Packet{alice.next(), bob.next()} {
+			if err := r.packet(p, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		pcm := r.frame(now)
+		if len(pcm) != discordFrameSize*2 {
+			t.Fatalf("Frame %d is %d bytes, want %d", i, len(pcm), discordFrameSize*2)
+		}
+		level = pcmLevel(pcm)
+	}
+	// Two uncorrelated tones at 0.3 of full scale sum to about 0.3 RMS
+	if want := 0.3 * 32767; level < want*0.7 || level > want*1.3 {
+		t.Errorf("Mixed level %.0f, want about %.0f", level, want)
+	}
+
+	// A corrupt packet is an error, not a crash
+	if err := r.packet(&discordgo.Packet{SSRC: 1, Sequence: alice.sequence + 1, Opus: []byte{0xff}}, now); err == nil {
+		t.Error("Decoded a corrupt packet")
+	}
+
+	stats := r.Stats()
+	if stats.Speakers != 2 || stats.Packets != 51 || stats.Concealed != 2 || stats.Errors != 1 {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	// Speakers silent for a while are forgotten
+	r.prune(now.Add(speakerTimeout / 2))
+	if r.Stats().Speakers != 2 {
+		t.Error("Pruned active speakers")
+	}
+	r.prune(now.Add(2 * speakerTimeout))
+	if r.Stats().Speakers != 0 {
+		t.Error("Kept silent speakers")
+	}
+}
+
+func TestBot_ReceiveAudio(t *testing.T) {
+	b := &Bot{AudioIn: make(chan []byte, 10), receiver: newReceiver(nil, false)}
+	packets := make(chan *discordgo.Packet, 10)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		b.receiveAudio(packets, done)
+		close(stopped)
+	}()
+
+	talker := newOpusTalker(t, 7, 600)
+	for i := 0; i < 5; i++ {
+		packets <- talker.next()
+	}
+	select {
+	case pcm := <-b.AudioIn:
+		if len(pcm) != discordFrameSize*2 {
+			t.Errorf("AudioIn frame is %d bytes", len(pcm))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No audio on AudioIn")
+	}
+
+	close(done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Receiver did not stop")
+	}
+	if stats := b.ReceiveStats(); stats.Packets != 5 || stats.Frames == 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func TestReceiver_Talkers(t *testing.T) {
+	r := newReceiver(map[string]string{"100": "W1AW"}, true)
+	now := time.Now()
+
+	// Until Discord says who sends an SSRC, its audio is refused
+	alice, bob := newOpusTalker(t, 1, 400), newOpusTalker(t, 2, 1000)
+	r.packet(alice.next(), now)
+	if stats := r.Stats(); stats.Refused != 1 || stats.Speakers != 0 {
+		t.Fatalf("Unidentified speaker heard: %+v", stats)
+	}
+
+	// Bob has no callsign, so stays refused once identified
+	r.identify(1, "100")
+	r.identify(2, "200")
+	r.packet(alice.next(), now)
+	r.packet(bob.next(), now)
+	talkers := r.talkers(now)
+	if len(talkers) != 1 || talkers[0] != (Talker{UserID: "100", Callsign: "W1AW", SSRC: 1}) {
+		t.Fatalf("Talkers = %+v", talkers)
+	}
+	if r.Stats().Refused != 2 {
+		t.Errorf("Refused %d packets, want 2", r.Stats().Refused)
+	}
+	if len(r.talkers(now.Add(time.Second))) != 0 {
+		t.Error("Still talking a second after the last packet")
+	}
+
+	// Without the requirement everyone is heard, longest talking first
+	open := newReceiver(map[string]string{"100": "W1AW"}, false)
+	open.identify(1, "100")
+	open.packet(bob.next(), now)
+	open.packet(alice.next(), now.Add(100*time.Millisecond))
+	talkers = open.talkers(now.Add(100 * time.Millisecond))
+	if len(talkers) != 2 || talkers[0].SSRC != 2 || talkers[0].UserID != "" || talkers[1].Callsign != "W1AW" {
+		t.Errorf("Talkers = %+v", talkers)
+	}
+}
@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/internal/transport"
+)
+
+// voiceMonitor decides when a dropped voice connection is rejoined. A
+// connection is only given up on once it has been down for a whole grace
+// period, since discordgo briefly drops Ready while it resumes by itself,
+// and failed rejoins back off exponentially.
+type voiceMonitor struct {
+	grace     time.Duration
+	backoff   *transport.Backoff
+	downSince time.Time // Zero while the connection is up
+	retryAt   time.Time // Earliest next rejoin
+}
+
+// newVoiceMonitor creates a monitor waiting grace before the first rejoin
+// and delay, doubling up to a minute, between failed ones
+func newVoiceMonitor(grace, delay time.Duration) *voiceMonitor {
+	return &voiceMonitor{
+		grace: grace,
+		backoff: transport.NewBackoff(&transport.BackoffConfig{
+			Initial:    delay,
+			Max:        time.Minute,
+			Multiplier: 2,
+			Jitter:     0.2,
+		}),
+	}
+}
+
+// due reports whether to rejoin now, given whether the connection is up
+func (m *voiceMonitor) due(up bool, now time.Time) bool {
+	if up {
+		m.recovered()
+		return false
+	}
+	if m.downSince.IsZero() {
+		m.downSince = now
+	}
+	return now.Sub(m.downSince) >= m.grace && !now.Before(m.retryAt)
+}
+
+// failed records a failed rejoin, putting off the next one
+func (m *voiceMonitor) failed(now time.Time) {
+	m.retryAt = now.Add(m.backoff.Next())
+}
+
+// recovered resets the monitor once the connection is up again
+func (m *voiceMonitor) recovered() {
+	m.downSince = time.Time{}
+	m.retryAt = time.Time{}
+	m.backoff.Reset()
+}
+
+// voiceWatchdog rejoins the configured voice channel whenever the
+// connection to it drops, until done is closed. Bridging resumes by itself:
+// AudioIn and AudioOut outlive voice connections.
+func (b *Bot) voiceWatchdog(ctx context.Context, done <-chan struct{}) {
+	interval := b.config.HealthCheck
+	if interval <= 0 {
+		interval = DefaultBotConfig().HealthCheck
+	}
+	delay := b.config.ReconnectDelay
+	if delay <= 0 {
+		delay = DefaultBotConfig().ReconnectDelay
+	}
+	monitor := newVoiceMonitor(interval, delay)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case now := <-ticker.C:
+			b.sampleLatency()
+			b.mutex.Lock()
+			want, channelID := b.wantVoice, b.channelID
+			up := voiceReady(b.voiceConn)
+			b.mutex.Unlock()
+
+			if !want || !monitor.due(up, now) {
+				continue
+			}
+			log.Printf("Voice connection to channel %s lost, rejoining", channelID)
+			if err := b.rejoinVoice(); err != nil {
+				log.Printf("Rejoining voice channel failed: %v", err)
+				monitor.failed(time.Now())
+				continue
+			}
+			monitor.recovered()
+			b.mutex.Lock()
+			b.reconnects++
+			b.mutex.Unlock()
+		}
+	}
+}
+
+// rejoinVoice joins the configured voice channel again, unless it has
+// been left meanwhile
+func (b *Bot) rejoinVoice() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.wantVoice {
+		return nil
+	}
+	return b.joinVoice(b.guildID, b.channelID)
+}
+
+// voiceReady reports whether vc is connected and ready
+func voiceReady(vc *discordgo.VoiceConnection) bool {
+	if vc == nil {
+		return false
+	}
+	vc.RLock()
+	defer vc.RUnlock()
+	return vc.Ready
+}
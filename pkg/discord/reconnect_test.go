@@ -0,0 +1,59 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestVoiceMonitor(t *testing.T) {
+	m := newVoiceMonitor(5*time.Second, time.Second)
+	start := time.Now()
+
+	// A connection up, or only briefly down, is left alone
+	if m.due(true, start) || m.due(false, start) || m.due(false, start.Add(4*time.Second)) {
+		t.Fatal("Rejoin due within the grace period")
+	}
+	if !m.due(false, start.Add(5*time.Second)) {
+		t.Fatal("Rejoin not due after the grace period")
+	}
+
+	// Failed rejoins back off, roughly doubling with jitter
+	now := start.Add(5 * time.Second)
+	var waits []time.Duration
+	for i := 0; i < 4; i++ {
+		m.failed(now)
+		wait := m.retryAt.Sub(now)
+		if m.due(false, now.Add(wait-time.Millisecond)) || !m.due(false, now.Add(wait)) {
+			t.Fatalf("Attempt %d not due after exactly %v", i+2, wait)
+		}
+		waits = append(waits, wait)
+		now = now.Add(wait)
+	}
+	if waits[3] < 5*time.Second || waits[3] > 10*time.Second {
+		t.Errorf("Backoff waits %v", waits)
+	}
+
+	// Once up again, a new drop gets the grace period and short delay again
+	m.due(true, now)
+	if m.due(false, now) || !m.due(false, now.Add(5*time.Second)) {
+		t.Error("Monitor not reset by recovery")
+	}
+	m.failed(now)
+	if wait := m.retryAt.Sub(now); wait > 2*time.Second {
+		t.Errorf("Backoff not reset: waiting %v", wait)
+	}
+}
+
+func TestVoiceReady(t *testing.T) {
+	if voiceReady(nil) {
+		t.Error("No connection is ready")
+	}
+	if voiceReady(&discordgo.VoiceConnection{}) {
+		t.Error("Unready connection is ready")
+	}
+	if !voiceReady(&discordgo.VoiceConnection{Ready: true}) {
+		t.Error("Ready connection is not ready")
+	}
+}
@@ -0,0 +1,349 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/record"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// Consent is how the members of a guild consent to being recorded
+type Consent string
+
+const (
+	ConsentNone     Consent = ""         // Not recorded
+	ConsentAnnounce Consent = "announce" // Recorded, announced as the recording starts and to members as they join
+	ConsentOptIn    Consent = "opt-in"   // Recorded only while everyone in the channel has agreed with !record agree
+)
+
+// recordCommand is the prefix of the recording commands
+const recordCommand = "!record"
+
+// membershipInterval is how often the voice channel's members are checked
+// for newcomers to tell of the recording
+const membershipInterval = time.Second
+
+// sessionRecorder records a bridge's voice sessions, from joining the
+// voice channel to leaving it: the radio and Discord audio mixed as heard
+// in the channel, written to a shared recorder as one transmission split
+// into parts by its MaxDuration. Members are told of the recording, and
+// with ConsentOptIn it pauses while anyone present has not agreed to it.
+type sessionRecorder struct {
+	recorder  *record.Recorder
+	consent   Consent
+	source    string
+	talkGroup uint32
+	mixer     *audio.Mixer
+
+	members func() []string                // Users in the voice channel, other than bots
+	post    func(text string, to []string) // Posts to the voice channel, mentioning to
+
+	mutex     sync.Mutex
+	agreed    map[string]bool // Users who agreed to be recorded
+	present   map[string]bool // Users in the channel who have been told of the recording
+	live      bool            // In a session
+	recording bool            // Writing the session
+	paused    bool            // Waiting for consent
+	checked   time.Time       // When the members were last checked
+	sequence  uint32
+}
+
+// newSessionRecorder creates a recorder of sessions written to recorder as
+// source
+func newSessionRecorder(recorder *record.Recorder, consent Consent, source string, talkGroup uint32) *sessionRecorder {
+	return &sessionRecorder{
+		recorder:  recorder,
+		consent:   consent,
+		source:    source,
+		talkGroup: talkGroup,
+		mixer:     audio.NewMixer(&audio.MixerConfig{Ducking: 0}),
+		members:   func() []string { return nil },
+		post:      func(string, []string) {},
+		agreed:    make(map[string]bool),
+		present:   make(map[string]bool),
+	}
+}
+
+// radio queues a frame of radio audio heard in the channel
+func (s *sessionRecorder) radio(samples []int16) {
+	s.mixer.Write("radio", 0, samples)
+}
+
+// discord queues a frame of Discord audio heard in the channel
+func (s *sessionRecorder) discord(samples []int16) {
+	s.mixer.Write("discord", 0, samples)
+}
+
+// notice is a message posted to the voice channel, mentioning to
+type notice struct {
+	text string
+	to   []string
+}
+
+// run records on the 20ms frame clock until ctx is done, in a session
+// whenever connected reports the bot in its voice channel. Notices are
+// posted on their own goroutine, off the frame clock.
+func (s *sessionRecorder) run(ctx context.Context, connected func() bool) {
+	notices := make(chan notice, 16)
+	defer close(notices)
+	go func() {
+		for n := range notices {
+			s.post(n.text, n.to)
+		}
+	}()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var posts []notice
+		select {
+		case <-ctx.Done():
+			s.tick(time.Now(), false)
+			return
+		case now := <-ticker.C:
+			posts = s.tick(now, connected())
+		}
+		for _, n := range posts {
+			select {
+			case notices <- n:
+			default:
+				log.Printf("Recording notice backlog full, dropping %q", n.text)
+			}
+		}
+	}
+}
+
+// tick records a frame, starting or ending the session as the bot joins
+// or leaves its voice channel, and returns the notices to post
+func (s *sessionRecorder) tick(now time.Time, connected bool) []notice {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	frame := s.mixer.Mix()
+	if !connected {
+		if !s.live {
+			return nil
+		}
+		s.pause(now)
+		s.live, s.paused = false, false
+		clear(s.present)
+		log.Printf("Stopped recording %s", s.source)
+		return []notice{{text: "⏹️ Recording stopped"}}
+	}
+
+	var notices []notice
+	if !s.live {
+		s.live = true
+		s.checked = time.Time{}
+		notices = append(notices, notice{text: s.announcement()})
+	}
+	if now.Sub(s.checked) >= membershipInterval {
+		s.checked = now
+		notices = append(notices, s.greet(s.members())...)
+	}
+
+	if !s.consented() {
+		if !s.paused {
+			s.paused = true
+			s.pause(now)
+			notices = append(notices, notice{text: "⏸️ Recording paused until everyone here agrees with `!record agree`"})
+		}
+		return notices
+	}
+	if !s.recording {
+		s.recording = true
+		log.Printf("Recording %s", s.source)
+		if s.paused {
+			s.paused = false
+			notices = append(notices, notice{text: "🔴 Recording, with the consent of everyone here"})
+		}
+	}
+	s.write(frame, true, now)
+	return notices
+}
+
+// announcement returns the announcement of the recording
+func (s *sessionRecorder) announcement() string {
+	if s.consent == ConsentOptIn {
+		return "🔴 This channel is recorded with the consent of everyone in it: say `!record agree` to agree, `!record revoke` to withdraw"
+	}
+	return "🔴 This channel is being recorded"
+}
+
+// greet returns notices telling members newly in the channel of the
+// recording, and forgets those who have left. Must be called with the
+// mutex held.
+func (s *sessionRecorder) greet(members []string) []notice {
+	var newcomers []string
+	for _, userID := range members {
+		if !s.present[userID] {
+			newcomers = append(newcomers, userID)
+		}
+	}
+	for userID := range s.present {
+		if !slices.Contains(members, userID) {
+			delete(s.present, userID)
+		}
+	}
+	var notices []notice
+	for _, userID := range newcomers {
+		s.present[userID] = true
+		if s.consent == ConsentOptIn && s.agreed[userID] {
+			continue
+		}
+		notices = append(notices, notice{text: fmt.Sprintf("<@%s> %s", userID, s.announcement()), to: []string{userID}})
+	}
+	return notices
+}
+
+// consented reports whether the session may be recorded now. Must be
+// called with the mutex held.
+func (s *sessionRecorder) consented() bool {
+	if s.consent != ConsentOptIn {
+		return true
+	}
+	for userID := range s.present {
+		if !s.agreed[userID] {
+			return false
+		}
+	}
+	return true
+}
+
+// pause ends the part being written, if any. Must be called with the
+// mutex held.
+func (s *sessionRecorder) pause(now time.Time) {
+	if s.recording {
+		s.recording = false
+		s.write(nil, false, now)
+	}
+}
+
+// write records a frame, keyed while the session is recorded. Must be
+// called with the mutex held.
+func (s *sessionRecorder) write(frame []int16, keyed bool, now time.Time) {
+	s.sequence++
+	msg := &usrp.VoiceMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_VOICE, s.sequence)}
+	msg.Header.SetPTT(keyed)
+	msg.Header.TalkGroup = s.talkGroup
+	copy(msg.AudioData[:], frame)
+	if err := s.recorder.WriteMessage(s.source, msg, now); err != nil {
+		log.Printf("Error recording %s: %v", s.source, err)
+	}
+}
+
+// agree records a user's consent, or its withdrawal, and returns the reply
+func (s *sessionRecorder) agree(userID string, agreed bool) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.consent != ConsentOptIn {
+		return "🔴 This channel is recorded"
+	}
+	if !agreed {
+		delete(s.agreed, userID)
+		return "⏸️ Consent withdrawn; recording is paused while you are here"
+	}
+	s.agreed[userID] = true
+	return "✅ Thank you, you agreed to be recorded"
+}
+
+// status returns whether the channel is being recorded, for !record
+func (s *sessionRecorder) status() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case s.recording:
+		return "🔴 Recording"
+	case s.live:
+		return "⏸️ Recording paused until everyone here agrees with `!record agree`"
+	default:
+		return "⏹️ Not recording"
+	}
+}
+
+// IsRecording reports whether the bridge is recording its voice channel now
+func (b *Bridge) IsRecording() bool {
+	if b.recording == nil {
+		return false
+	}
+	b.recording.mutex.Lock()
+	defer b.recording.mutex.Unlock()
+	return b.recording.recording
+}
+
+// onRecordCommand answers !record, !record agree and !record revoke
+func (b *Bridge) onRecordCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || m.Author.Bot || m.GuildID != b.bot.guild() || !strings.HasPrefix(m.Content, recordCommand) {
+		return
+	}
+	var reply string
+	switch strings.TrimSpace(strings.TrimPrefix(m.Content, recordCommand)) {
+	case "":
+		reply = b.recording.status()
+	case "agree":
+		reply = b.recording.agree(m.Author.ID, true)
+	case "revoke":
+		reply = b.recording.agree(m.Author.ID, false)
+	default:
+		return
+	}
+	if _, err := s.ChannelMessageSend(m.ChannelID, reply); err != nil {
+		log.Printf("Failed to send recording reply: %v", err)
+	}
+}
+
+// voiceChannel returns the ID of the bot's voice channel
+func (b *Bot) voiceChannel() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.channelID
+}
+
+// voiceMembers returns the users in the bot's voice channel other than
+// bots, from the session state
+func (b *Bot) voiceMembers() []string {
+	if b.session.State == nil {
+		return nil
+	}
+	guild, err := b.session.State.Guild(b.guild())
+	if err != nil {
+		return nil
+	}
+	channelID := b.voiceChannel()
+
+	b.session.State.RLock()
+	defer b.session.State.RUnlock()
+	var members []string
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != channelID || (vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot) {
+			continue
+		}
+		if b.session.State.User != nil && vs.UserID == b.session.State.User.ID {
+			continue
+		}
+		members = append(members, vs.UserID)
+	}
+	return members
+}
+
+// postVoiceChannel posts text to the chat of the bot's voice channel,
+// mentioning only the users in to
+func (b *Bot) postVoiceChannel(text string, to []string) {
+	channelID := b.voiceChannel()
+	b.rest.wait(context.Background(), channelID, messageInterval)
+	_, err := b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         text,
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: to},
+	})
+	if err != nil {
+		log.Printf("Error posting recording notice: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package discord
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/record"
+)
+
+// newTestSessionRecorder returns a session recorder writing WAV files
+// into a temporary directory, with members in its voice channel
+func newTestSessionRecorder(t *testing.T, consent Consent, members *[]string) (*sessionRecorder, *record.Recorder, string) {
+	t.Helper()
+	dir := t.TempDir()
+	recorder, err := record.NewRecorder(&record.Config{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSessionRecorder(recorder, consent, "discord-guild", 3100)
+	s.members = func() []string { return *members }
+	return s, recorder, dir
+}
+
+// noticeTexts returns the text of notices
+func noticeTexts(notices []notice) string {
+	var texts []string
+	for _, n := range notices {
+		texts = append(texts, n.text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestSessionRecorder_Announce(t *testing.T) {
+	members := []string{"100"}
+	s, recorder, dir := newTestSessionRecorder(t, ConsentAnnounce, &members)
+	start := time.Now()
+	at := func(n int) time.Time { return start.Add(time.Duration(n) * 20 * time.Millisecond) }
+
+	// Nothing is recorded out of a session
+	s.radio(make([]int16, 160))
+	if notices := s.tick(at(0), false); notices != nil || recorder.Stats().Active != 0 {
+		t.Fatalf("Recorded out of a session, with notices %v", notices)
+	}
+
+	// Joining starts the session, announced to the channel and its members
+	notices := s.tick(at(1), true)
+	if len(notices) != 2 || notices[0].to != nil || notices[1].to[0] != "100" || !strings.Contains(notices[1].text, "<@100>") {
+		t.Fatalf("Session start notices %+v", notices)
+	}
+	if recorder.Stats().Active != 1 {
+		t.Fatal("Session not being recorded")
+	}
+
+	// The radio and Discord are mixed, and newcomers told as they join
+	radio, discord := make([]int16, 160), make([]int16, 160)
+	for i := range radio {
+		radio[i], discord[i] = 1000, 500
+	}
+	for n := 2; n < 100; n++ {
+		s.radio(radio)
+		s.discord(discord)
+		if n == 50 {
+			members = append(members, "200")
+		}
+		if notices := s.tick(at(n), true); len(notices) > 0 && !strings.Contains(noticeTexts(notices), "<@200>") {
+			t.Errorf("Notices %v at frame %d", notices, n)
+		}
+	}
+	if !strings.Contains(s.status(), "Recording") {
+		t.Errorf("Status %q while recording", s.status())
+	}
+
+	// Leaving ends it
+	if text := noticeTexts(s.tick(at(100), false)); !strings.Contains(text, "stopped") {
+		t.Errorf("Session end notice %q", text)
+	}
+	stats := recorder.Stats()
+	if stats.Active != 0 || stats.Recordings != 1 {
+		t.Fatalf("Recorder stats %+v after the session", stats)
+	}
+
+	sidecars, _ := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if len(sidecars) != 1 {
+		t.Fatalf("Sidecars %v, want one", sidecars)
+	}
+	data, err := os.ReadFile(sidecars[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta record.Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Source != "discord-guild" || meta.TalkGroup != 3100 || meta.Duration < 1.9 {
+		t.Errorf("Recording %+v", meta)
+	}
+}
+
+func TestSessionRecorder_OptIn(t *testing.T) {
+	members := []string{"100", "200"}
+	s, recorder, _ := newTestSessionRecorder(t, ConsentOptIn, &members)
+	now := time.Now()
+
+	// Nobody has agreed, so the session is announced but not recorded
+	if text := noticeTexts(s.tick(now, true)); !strings.Contains(text, "!record agree") {
+		t.Errorf("Opt-in announcement %q", text)
+	}
+	if recorder.Stats().Active != 0 || s.recording {
+		t.Fatal("Recorded without consent")
+	}
+
+	s.agree("100", true)
+	s.tick(now.Add(20*time.Millisecond), true)
+	if recorder.Stats().Active != 0 {
+		t.Fatal("Recorded with consent from only some members")
+	}
+
+	// Once everyone has agreed it records, until someone withdraws
+	s.agree("200", true)
+	if text := noticeTexts(s.tick(now.Add(40*time.Millisecond), true)); !strings.Contains(text, "consent of everyone") {
+		t.Errorf("Recording start notice %q", text)
+	}
+	if recorder.Stats().Active != 1 {
+		t.Fatal("Not recording with everyone's consent")
+	}
+	s.agree("200", false)
+	if text := noticeTexts(s.tick(now.Add(60*time.Millisecond), true)); !strings.Contains(text, "paused") {
+		t.Errorf("Pause notice %q", text)
+	}
+	if recorder.Stats().Active != 0 || recorder.Stats().Recordings != 1 {
+		t.Errorf("Recorder stats %+v after withdrawal", recorder.Stats())
+	}
+
+	// or leaves, after which the rest are recorded again
+	members = []string{"100"}
+	s.tick(now.Add(time.Second+80*time.Millisecond), true)
+	if recorder.Stats().Active != 1 {
+		t.Error("Not recording after the member without consent left")
+	}
+
+	// A newcomer who has agreed before is not asked again
+	s.agree("300", true)
+	members = []string{"100", "300"}
+	if notices := s.tick(now.Add(2*time.Second+100*time.Millisecond), true); len(notices) != 0 {
+		t.Errorf("Notices %+v for a member who agreed", notices)
+	}
+}
@@ -0,0 +1,132 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// redacted is how a secret prints
+const redacted = "[REDACTED]"
+
+// Secret is a credential such as the bot token. It prints and marshals
+// redacted, so a configuration logged with %+v or dumped as JSON does not
+// give it away.
+type Secret string
+
+// String returns the secret redacted, or "" if it is empty
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString returns the secret redacted, for %#v
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON marshals the secret redacted
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", s.String())), nil
+}
+
+// Reveal returns the secret itself, for handing to Discord
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// SecretProvider looks up secrets kept outside the configuration, such as
+// in Vault or a cloud secrets manager
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+var (
+	secretProviders = map[string]SecretProvider{
+		"env":  envSecrets{},
+		"file": fileSecrets{},
+	}
+	secretProvidersMutex sync.RWMutex
+)
+
+// RegisterSecretProvider makes provider resolve references of the form
+// scheme:name. The env and file schemes are built in.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMutex.Lock()
+	defer secretProvidersMutex.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// ResolveSecret resolves a reference to a secret: env:NAME reads an
+// environment variable, file:/path reads a file such as a Docker or
+// Kubernetes secret, and scheme:name asks a registered SecretProvider.
+// Anything without a colon is the secret itself, as Discord tokens have
+// none.
+func ResolveSecret(ctx context.Context, ref string) (Secret, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return Secret(ref), nil
+	}
+
+	secretProvidersMutex.RLock()
+	provider, ok := secretProviders[scheme]
+	secretProvidersMutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider %q", scheme)
+	}
+
+	secret, err := provider.Secret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", ref, err)
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", ref)
+	}
+	return Secret(secret), nil
+}
+
+// envSecrets reads secrets from environment variables
+type envSecrets struct{}
+
+func (envSecrets) Secret(ctx context.Context, name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return secret, nil
+}
+
+// fileSecrets reads secrets from files
+type fileSecrets struct{}
+
+func (fileSecrets) Secret(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// CommandSecrets is a SecretProvider running a command, with the secret's
+// name as its last argument, and taking the secret from its output; for
+// instance {"vault", "kv", "get", "-field=token"} or a cloud CLI
+type CommandSecrets []string
+
+// Secret runs the command for the secret named name
+func (c CommandSecrets) Secret(ctx context.Context, name string) (string, error) {
+	if len(c) == 0 {
+		return "", fmt.Errorf("no secrets command")
+	}
+	args := append(append([]string(nil), c[1:]...), name)
+	output, err := exec.CommandContext(ctx, c[0], args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", c[0], err)
+	}
+	return string(output), nil
+}
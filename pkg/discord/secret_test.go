@@ -0,0 +1,71 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mapSecrets is a SecretProvider holding secrets in a map
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(ctx context.Context, name string) (string, error) {
+	secret, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("no secret %s", name)
+	}
+	return secret, nil
+}
+
+func TestResolveSecret(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_DISCORD_TOKEN", "from-env")
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	RegisterSecretProvider("test", mapSecrets{"discord": "from-provider"})
+
+	for ref, want := range map[string]Secret{
+		"inline.token":           "inline.token",
+		"env:TEST_DISCORD_TOKEN": "from-env",
+		"file:" + file:           "from-file",
+		"test:discord":           "from-provider",
+	} {
+		secret, err := ResolveSecret(ctx, ref)
+		if err != nil || secret != want {
+			t.Errorf("Resolved %s to %q (%v), want %q", ref, secret.Reveal(), err, want.Reveal())
+		}
+	}
+
+	for _, ref := range []string{"env:TEST_DISCORD_UNSET", "file:" + file + ".missing", "test:other", "vualt:discord"} {
+		if _, err := ResolveSecret(ctx, ref); err == nil {
+			t.Errorf("Resolved %s", ref)
+		}
+	}
+}
+
+func TestSecret_Redacted(t *testing.T) {
+	config := DefaultBridgeConfig()
+	config.DiscordToken = "MTIzNDU2Nzg5.secret.token"
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dump := range []string{fmt.Sprintf("%v", config), fmt.Sprintf("%+v", *config), fmt.Sprintf("%#v", *config), string(data)} {
+		if strings.Contains(dump, "secret.token") || !strings.Contains(dump, redacted) {
+			t.Errorf("Token not redacted from %s", dump)
+		}
+	}
+	if config.DiscordToken.Reveal() != "MTIzNDU2Nzg5.secret.token" {
+		t.Error("Token not revealed")
+	}
+	if Secret("").String() != "" {
+		t.Error("Empty secret redacted")
+	}
+}
@@ -0,0 +1,142 @@
+package discord
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/dbehnke/usrp-go/internal/transport"
+	"github.com/thesyncim/gopus"
+)
+
+// trailingSilence is how many Opus silence frames end a transmission.
+// Discord asks for five so receivers' decoders do not interpolate from the
+// last audio.
+const trailingSilence = 5
+
+// opusSilence is an Opus packet of 20ms of silence
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+// SendStats holds Discord voice send counters
+type SendStats struct {
+	Frames  uint64 `json:"frames"`  // Audio frames encoded and sent
+	Dropped uint64 `json:"dropped"` // Packets dropped with the voice connection's queue full
+	Errors  uint64 `json:"errors"`  // Frames that failed to encode
+	Talks   uint64 `json:"talks"`   // Transmissions started
+}
+
+// voiceLink is where encoded voice goes: a voice connection's speaking
+// state and Opus queue
+type voiceLink struct {
+	speaking func(bool) error
+	opus     chan<- []byte
+}
+
+// sender encodes outgoing 48kHz stereo PCM to Opus and manages the
+// speaking state around it: Discord only plays audio from a user marked
+// speaking, and each transmission ends with a few frames of silence
+type sender struct {
+	encoder  *gopus.Encoder
+	pcm      []int16
+	packet   []byte
+	speaking bool
+	silence  int // Silence frames left to send before speaking stops
+
+	stats   SendStats
+	metrics transport.Metrics // Packets sent, errors and drops of the bot's link
+	mutex   sync.Mutex
+}
+
+// newSender creates a sender encoding at bitrate bits/s
+func newSender(bitrate int) (*sender, error) {
+	encoder, err := gopus.NewEncoder(gopus.EncoderConfig{
+		SampleRate:  discordSampleRate,
+		Channels:    2,
+		Application: gopus.ApplicationAudio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus encoder: %w", err)
+	}
+	if err := encoder.SetBitrate(bitrate); err != nil {
+		return nil, fmt.Errorf("failed to set Opus bitrate: %w", err)
+	}
+	return &sender{
+		encoder: encoder,
+		pcm:     make([]int16, discordFrameSize),
+		packet:  make([]byte, 4000),
+		metrics: transport.NewAtomicMetrics(),
+	}, nil
+}
+
+// tick sends the next 20ms to link, given its pcm or nothing when there
+// is no audio. A short frame is padded with silence.
+func (s *sender) tick(link voiceLink, pcm []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(pcm) == 0 {
+		if !s.speaking {
+			return nil
+		}
+		if s.silence > 0 {
+			s.silence--
+			s.send(link, opusSilence)
+			return nil
+		}
+		s.speaking = false
+		return link.speaking(false)
+	}
+
+	clear(s.pcm)
+	for i := 0; i < len(s.pcm) && i*2+1 < len(pcm); i++ {
+		s.pcm[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	n, err := s.encoder.EncodeInt16(s.pcm, s.packet)
+	if err != nil {
+		s.stats.Errors++
+		s.metrics.Error()
+		return fmt.Errorf("failed to encode Opus: %w", err)
+	}
+
+	if !s.speaking {
+		if err := link.speaking(true); err != nil {
+			return fmt.Errorf("failed to set speaking: %w", err)
+		}
+		s.speaking = true
+		s.stats.Talks++
+	}
+	s.silence = trailingSilence
+	// The packet is queued, so it needs its own copy
+	if s.send(link, append([]byte(nil), s.packet[:n]...)) {
+		s.stats.Frames++
+	}
+	return nil
+}
+
+// send queues a packet without blocking the frame clock
+func (s *sender) send(link voiceLink, packet []byte) bool {
+	select {
+	case link.opus <- packet:
+		s.metrics.PacketOut(len(packet))
+		return true
+	default:
+		s.stats.Dropped++
+		s.metrics.Drop()
+		return false
+	}
+}
+
+// reset forgets the speaking state, as after leaving a voice channel
+func (s *sender) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.speaking = false
+	s.silence = 0
+}
+
+// Stats returns a copy of the current counters
+func (s *sender) Stats() SendStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats
+}
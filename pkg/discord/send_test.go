@@ -0,0 +1,84 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
+	"github.com/thesyncim/gopus"
+)
+
+func TestSender(t *testing.T) {
+	s, err := newSender(64000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []bool
+	opus := make(chan []byte, 100)
+	link := voiceLink{
+		speaking: func(speaking bool) error {
+			states = append(states, speaking)
+			return nil
+		},
+		opus: opus,
+	}
+
+	// Nothing is sent, nor speaking set, before there is audio
+	if err := s.tick(link, nil); err != nil || len(opus) != 0 || len(states) != 0 {
+		t.Fatalf("Idle tick sent %d packets, states %v, %v", len(opus), states, err)
+	}
+
+	tone := signal.NewSine(1000, 0.3, discordSampleRate)
+	mono := make([]int16, discordFrameSize/2)
+	for i := 0; i < 10; i++ {
+		tone.Fill(mono)
+		pcm := make([]byte, discordFrameSize*2)
+		for j, sample := range mono {
+			binary.LittleEndian.PutUint16(pcm[j*4:], uint16(sample))
+			binary.LittleEndian.PutUint16(pcm[j*4+2:], uint16(sample))
+		}
+		if err := s.tick(link, pcm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < trailingSilence+3; i++ {
+		if err := s.tick(link, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(states) != 2 || !states[0] || states[1] {
+		t.Errorf("Speaking states %v, want [true false]", states)
+	}
+	if len(opus) != 10+trailingSilence {
+		t.Fatalf("Sent %d packets, want %d", len(opus), 10+trailingSilence)
+	}
+
+	// The audio decodes back as 20ms of stereo; silence ends the stream
+	decoder, err := gopus.NewDecoder(gopus.DefaultDecoderConfig(discordSampleRate, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]int16, discordFrameSize)
+	for i := 0; i < 10; i++ {
+		n, err := decoder.DecodeInt16(<-opus, out)
+		if err != nil || n != discordFrameSize/2 {
+			t.Fatalf("Packet %d decoded to %d samples: %v", i, n, err)
+		}
+	}
+	if packet := <-opus; !bytes.Equal(packet, opusSilence) {
+		t.Errorf("Transmission ended with %x, not silence", packet)
+	}
+
+	if stats := s.Stats(); stats.Frames != 10 || stats.Talks != 1 || stats.Dropped != 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	// A full queue drops frames rather than stalling the frame clock
+	full := voiceLink{speaking: link.speaking, opus: make(chan []byte)}
+	s.tick(full, make([]byte, 100))
+	if stats := s.Stats(); stats.Dropped != 1 || stats.Talks != 2 {
+		t.Errorf("After a full queue: %+v", stats)
+	}
+}
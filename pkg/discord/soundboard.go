@@ -0,0 +1,267 @@
+package discord
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/playback"
+	"github.com/dbehnke/usrp-go/pkg/audio/tones"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// announcementBuffer is how many 20ms announcement frames may wait for the
+// voice connection, enough to ride out scheduling jitter
+const announcementBuffer = 10
+
+// maxChoices is the most choices Discord shows for a slash command option
+const maxChoices = 25
+
+// SoundboardConfig holds soundboard settings
+type SoundboardConfig struct {
+	Sounds  map[string]string `json:"sounds"`  // Name to audio file, e.g. "net-start" to "/srv/sounds/net.wav"
+	Player  *playback.Config  `json:"player"`  // Pacing and queueing of announcements (nil = playback.DefaultConfig)
+	Command string            `json:"command"` // Slash command playing a sound ("" = none)
+}
+
+// DefaultSoundboardConfig returns a soundboard of the built-in courtesy
+// tones, played with /play
+func DefaultSoundboardConfig() *SoundboardConfig {
+	return &SoundboardConfig{Command: "play"}
+}
+
+// Soundboard plays pre-recorded announcements and courtesy tones into a
+// bot's voice channel: net start, station ID, alerts. Sounds are queued
+// and paced by a playback.Player, then mixed over the bridged radio audio
+// rather than passing through the bridge, so they are neither sent to the
+// radio nor logged as transmissions.
+type Soundboard struct {
+	bot       *Bot
+	config    SoundboardConfig
+	player    *playback.Player
+	clips     map[string]*playback.Clip
+	upsampler *audio.ChannelResampler
+}
+
+// NewSoundboard creates a soundboard playing through bot, loading its
+// sound files up front. A nil config uses DefaultSoundboardConfig.
+func NewSoundboard(bot *Bot, config *SoundboardConfig) (*Soundboard, error) {
+	if config == nil {
+		config = DefaultSoundboardConfig()
+	}
+
+	clips := make(map[string]*playback.Clip, len(config.Sounds))
+	for name, path := range config.Sounds {
+		clip, err := playback.LoadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sound %s: %w", name, err)
+		}
+		clip.Name = name
+		clips[name] = clip
+	}
+
+	upmix, _ := audio.DefaultChannelMatrix(1, 2)
+	upsampler, err := audio.NewChannelResampler(audio.USRPSampleRate, discordSampleRate, upmix, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Soundboard{
+		bot:       bot,
+		config:    *config,
+		clips:     clips,
+		upsampler: upsampler,
+	}
+	s.player = playback.NewPlayer(s.send, config.Player)
+	return s, nil
+}
+
+// Sounds returns the names of the sounds that can be played, sorted
+func (s *Soundboard) Sounds() []string {
+	names := tones.CourtesyNames()
+	for name := range s.clips {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// clip returns a sound by name: a loaded file, or else a courtesy tone
+func (s *Soundboard) clip(name string) (*playback.Clip, error) {
+	if clip, ok := s.clips[name]; ok {
+		return clip, nil
+	}
+	sequence, err := tones.Courtesy(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown sound %q", name)
+	}
+	return playback.ToneClip(name, sequence)
+}
+
+// Play queues sounds by name to play back to back as one announcement,
+// such as an ID followed by a courtesy tone
+func (s *Soundboard) Play(names ...string) error {
+	clips := make([]*playback.Clip, 0, len(names))
+	for _, name := range names {
+		clip, err := s.clip(name)
+		if err != nil {
+			return err
+		}
+		clips = append(clips, clip)
+	}
+	return s.PlayClips(clips...)
+}
+
+// PlayClips queues clips to play as one announcement
+func (s *Soundboard) PlayClips(clips ...*playback.Clip) error {
+	return s.player.Enqueue(clips...)
+}
+
+// Clear drops the announcements waiting. One playing now finishes.
+func (s *Soundboard) Clear() {
+	s.player.Clear()
+}
+
+// Stats returns the soundboard's playback counters
+func (s *Soundboard) Stats() playback.Stats {
+	return s.player.Stats()
+}
+
+// Run plays queued announcements, and answers the slash command if one is
+// configured, until ctx is done
+func (s *Soundboard) Run(ctx context.Context) error {
+	if s.config.Command != "" {
+		// Commands are registered once the session knows the bot's user
+		session := s.bot.session
+		defer session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Ready) { s.register() })()
+		defer session.AddHandler(s.onInteraction)()
+		if session.State != nil && session.State.User != nil {
+			s.register()
+		}
+	}
+	return s.player.Run(ctx)
+}
+
+// register registers the slash command in the bot's guild
+func (s *Soundboard) register() {
+	session := s.bot.session
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "sound",
+		Description: "Sound to play",
+		Required:    true,
+	}
+	if sounds := s.Sounds(); len(sounds) <= maxChoices {
+		for _, name := range sounds {
+			option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+	}
+
+	_, err := session.ApplicationCommandCreate(session.State.User.ID, s.bot.guild(), &discordgo.ApplicationCommand{
+		Name:        s.config.Command,
+		Description: "Play an announcement or tone into the voice channel",
+		Options:     []*discordgo.ApplicationCommandOption{option},
+	})
+	if err != nil {
+		log.Printf("Error registering /%s command: %v", s.config.Command, err)
+	}
+}
+
+// onInteraction answers the slash command
+func (s *Soundboard) onInteraction(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || i.GuildID != s.bot.guild() {
+		return
+	}
+	data := i.ApplicationCommandData()
+	if data.Name != s.config.Command {
+		return
+	}
+
+	var sound, userID string
+	if len(data.Options) > 0 {
+		sound = data.Options[0].StringValue()
+	}
+	if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	}
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: s.command(sound, userID, i.Member),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("Error answering /%s: %v", s.config.Command, err)
+	}
+}
+
+// command plays a sound for a member and returns the reply
+func (s *Soundboard) command(sound, userID string, member *discordgo.Member) string {
+	if !s.bot.may(PermissionCommand, userID, member) {
+		return "⛔ You are not permitted to control the bridge"
+	}
+	if !s.bot.IsConnected() {
+		return "❌ Not connected to a voice channel"
+	}
+	if err := s.Play(sound); err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	return fmt.Sprintf("▶️ Playing **%s**", sound)
+}
+
+// send plays a voice frame from the player into Discord
+func (s *Soundboard) send(msg *usrp.VoiceMessage) error {
+	if !msg.Header.IsPTT() {
+		// The announcement is over; the next starts afresh
+		s.upsampler.Reset()
+		return nil
+	}
+	samples := s.upsampler.Process(msg.AudioData[:])
+	pcm := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(sample))
+	}
+	return s.bot.announce(pcm)
+}
+
+// announce queues a 20ms frame of PCM audio to mix over AudioOut
+func (b *Bot) announce(pcm []byte) error {
+	if !b.IsConnected() {
+		return fmt.Errorf("not connected to voice channel")
+	}
+	select {
+	case b.announcements <- pcm:
+		return nil
+	default:
+		return fmt.Errorf("announcement buffer full, dropping frame")
+	}
+}
+
+// mixPCM mixes two frames of little-endian 16-bit PCM, clipping the sum
+func mixPCM(a, b []byte) []byte {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	mixed := make([]byte, max(len(a), len(b)))
+	for i := 0; i+1 < len(mixed); i += 2 {
+		var sum int32
+		if i+1 < len(a) {
+			sum += int32(int16(binary.LittleEndian.Uint16(a[i:])))
+		}
+		if i+1 < len(b) {
+			sum += int32(int16(binary.LittleEndian.Uint16(b[i:])))
+		}
+		binary.LittleEndian.PutUint16(mixed[i:], uint16(int16(min(max(sum, -32768), 32767))))
+	}
+	return mixed
+}
@@ -0,0 +1,134 @@
+package discord
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/audio"
+	"github.com/dbehnke/usrp-go/pkg/audio/playback"
+)
+
+func TestMixPCM(t *testing.T) {
+	pcm := func(samples ...int16) []byte {
+		b := make([]byte, len(samples)*2)
+		for i, s := range samples {
+			binary.LittleEndian.PutUint16(b[i*2:], uint16(s))
+		}
+		return b
+	}
+
+	mixed := mixPCM(pcm(1000, -1000, 30000, -30000), pcm(500, 500, 10000, -10000, 7))
+	want := pcm(1500, -500, 32767, -32768, 7)
+	if string(mixed) != string(want) {
+		t.Errorf("Mixed %v, want %v", mixed, want)
+	}
+	if got := mixPCM(nil, pcm(5)); string(got) != string(pcm(5)) {
+		t.Error("Mixing into nothing changed the frame")
+	}
+	if got := mixPCM(pcm(5), nil); string(got) != string(pcm(5)) {
+		t.Error("Mixing nothing changed the frame")
+	}
+}
+
+// newSoundboardBot returns a bot connected to a voice channel, as far as
+// announcements are concerned
+func newSoundboardBot() *Bot {
+	return &Bot{
+		guildID:       "guild",
+		voiceConn:     &discordgo.VoiceConnection{Ready: true},
+		announcements: make(chan []byte, announcementBuffer),
+	}
+}
+
+func TestSoundboard(t *testing.T) {
+	// A 100ms 1kHz announcement
+	samples := make([]int16, 800)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*1000*float64(i)/8000))
+	}
+	path := filepath.Join(t.TempDir(), "id.wav")
+	if err := os.WriteFile(path, audio.EncodeWAV(samples, 8000, 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bot := newSoundboardBot()
+	sb, err := NewSoundboard(bot, &SoundboardConfig{
+		Sounds: map[string]string{"id": path},
+		Player: &playback.Config{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sounds := sb.Sounds(); len(sounds) < 2 || !strings.Contains(strings.Join(sounds, ","), "id") {
+		t.Errorf("Sounds = %v", sounds)
+	}
+	if err := sb.Play("id", "nonexistent"); err == nil {
+		t.Error("Unknown sound played")
+	}
+	if err := sb.Play("id", "beep"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sb.Run(ctx)
+
+	// The announcement arrives as 20ms frames of 48kHz stereo
+	var frames int
+	var level float64
+	timeout := time.After(2 * time.Second)
+	for frames < 5 {
+		select {
+		case frame := <-bot.announcements:
+			if len(frame) != discordFrameSize*2 {
+				t.Fatalf("Frame of %d bytes, want %d", len(frame), discordFrameSize*2)
+			}
+			level = max(level, pcmLevel(frame))
+			frames++
+		case <-timeout:
+			t.Fatalf("Only %d frames played", frames)
+		}
+	}
+	if level < 1000 {
+		t.Errorf("Announcement level %.0f, want audio", level)
+	}
+}
+
+func TestSoundboard_Command(t *testing.T) {
+	bot := newSoundboardBot()
+	sb, err := NewSoundboard(bot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := sb.command("roger", "100", nil); !strings.HasPrefix(reply, "▶️") {
+		t.Errorf("Reply %q, want playing", reply)
+	}
+	if reply := sb.command("kazoo", "100", nil); !strings.HasPrefix(reply, "❌") {
+		t.Errorf("Reply %q to an unknown sound", reply)
+	}
+
+	// Only members with the command permission may play sounds
+	bot.permissions, _ = newPermissions(map[string]Permission{"ncs": PermissionCommand}, "", nil)
+	if reply := sb.command("roger", "200", &discordgo.Member{Roles: []string{"other"}}); !strings.HasPrefix(reply, "⛔") {
+		t.Errorf("Reply %q to a member without permission", reply)
+	}
+	if reply := sb.command("roger", "100", &discordgo.Member{Roles: []string{"ncs"}}); !strings.HasPrefix(reply, "▶️") {
+		t.Errorf("Reply %q to net control", reply)
+	}
+
+	bot.voiceConn = nil
+	if reply := sb.command("roger", "100", &discordgo.Member{Roles: []string{"ncs"}}); !strings.HasPrefix(reply, "❌") {
+		t.Errorf("Reply %q while not connected", reply)
+	}
+	if stats := sb.Stats(); stats.Queued != 2 {
+		t.Errorf("%d announcements queued, want 2", stats.Queued)
+	}
+}
@@ -0,0 +1,159 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// stageFloor tracks who has the floor on a Discord Stage channel: its
+// speakers, as moderators invite them up or move them back to the
+// audience. On a stage only speakers key the radio, so moderators run a
+// directed net by passing the floor as net control would.
+type stageFloor struct {
+	channelID string          // Stage channel the bot is in ("" = not on a stage)
+	speakers  map[string]bool // User IDs of the stage's speakers
+	mutex     sync.Mutex
+}
+
+// enter starts tracking a stage, with the voice states already in the guild
+func (f *stageFloor) enter(channelID string, states []*discordgo.VoiceState) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.channelID = channelID
+	f.speakers = make(map[string]bool)
+	for _, vs := range states {
+		if vs.ChannelID == channelID && !vs.Suppress {
+			f.speakers[vs.UserID] = true
+		}
+	}
+}
+
+// leave stops tracking the stage
+func (f *stageFloor) leave() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.channelID = ""
+	f.speakers = nil
+}
+
+// update tracks a voice state change and reports whether its user had
+// the floor before and has it now
+func (f *stageFloor) update(vs *discordgo.VoiceState) (had, has bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.channelID == "" {
+		return false, false
+	}
+	had = f.speakers[vs.UserID]
+	has = vs.ChannelID == f.channelID && !vs.Suppress
+	if has {
+		f.speakers[vs.UserID] = true
+	} else {
+		delete(f.speakers, vs.UserID)
+	}
+	return had, has
+}
+
+// active reports whether the bot is on a stage
+func (f *stageFloor) active() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.channelID != ""
+}
+
+// allows reports whether a user may key the radio: anyone off a stage,
+// and only its speakers on one
+func (f *stageFloor) allows(userID string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.channelID == "" || f.speakers[userID]
+}
+
+// list returns the stage's speakers, sorted, or nil off a stage
+func (f *stageFloor) list() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var speakers []string
+	for userID := range f.speakers {
+		speakers = append(speakers, userID)
+	}
+	slices.Sort(speakers)
+	return speakers
+}
+
+// mayTalk reports whether a user may key the radio: on the floor if the
+// bot is on a stage, and with a talking role if roles are configured
+func (b *Bot) mayTalk(userID string) bool {
+	return b.stage.allows(userID) && b.permissions.allows(userID, PermissionTalk, time.Now())
+}
+
+// StageSpeakers returns the user IDs of the speakers on the bot's Stage
+// channel, other than the bot, or nil if it is not on a stage
+func (b *Bot) StageSpeakers() []string {
+	speakers := b.stage.list()
+	if b.session.State != nil && b.session.State.User != nil {
+		speakers = slices.DeleteFunc(speakers, func(userID string) bool { return userID == b.session.State.User.ID })
+	}
+	return speakers
+}
+
+// isStage reports whether a channel is a Stage channel
+func (b *Bot) isStage(channelID string) bool {
+	if b.session.State != nil {
+		if channel, err := b.session.State.Channel(channelID); err == nil {
+			return channel.Type == discordgo.ChannelTypeGuildStageVoice
+		}
+	}
+	channel, err := b.session.Channel(channelID)
+	return err == nil && channel.Type == discordgo.ChannelTypeGuildStageVoice
+}
+
+// joinStage sets up a Stage channel just joined: tracks its floor, starts
+// the stage if StageTopic is set and it is not live, and becomes a speaker
+// so the audience hears the radio. The caller holds the mutex.
+func (b *Bot) joinStage(guildID, channelID string) {
+	var states []*discordgo.VoiceState
+	if b.session.State != nil {
+		if guild, err := b.session.State.Guild(guildID); err == nil {
+			states = guild.VoiceStates
+		}
+	}
+	b.stage.enter(channelID, states)
+
+	if b.config.StageTopic != "" {
+		if _, err := b.session.StageInstance(channelID); err != nil {
+			_, err := b.session.StageInstanceCreate(&discordgo.StageInstanceParams{
+				ChannelID: channelID,
+				Topic:     b.config.StageTopic,
+			})
+			if err != nil {
+				log.Printf("Error starting stage %s: %v", channelID, err)
+			}
+		}
+	}
+
+	if err := b.becomeSpeaker(guildID, channelID); err != nil {
+		log.Printf("Warning: could not become a stage speaker, the audience will not hear the radio until a moderator invites the bot to speak: %v", err)
+		return
+	}
+	log.Printf("Speaking on stage %s", channelID)
+}
+
+// becomeSpeaker moves the bot from a stage's audience to its speakers,
+// which takes the Mute Members permission on the stage
+func (b *Bot) becomeSpeaker(guildID, channelID string) error {
+	endpoint := discordgo.EndpointGuild(guildID) + "/voice-states/@me"
+	data := struct {
+		ChannelID string `json:"channel_id"`
+		Suppress  bool   `json:"suppress"`
+	}{channelID, false}
+	if _, err := b.session.RequestWithBucketID("PATCH", endpoint, data, endpoint); err != nil {
+		return fmt.Errorf("failed to unsuppress on stage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package discord
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStageFloor(t *testing.T) {
+	var floor stageFloor
+	if floor.active() || !floor.allows("100") || floor.list() != nil {
+		t.Fatal("Floor restricts talkers off a stage")
+	}
+
+	// Speakers already up when the bot joins have the floor
+	floor.enter("stage", []*discordgo.VoiceState{
+		{UserID: "100", ChannelID: "stage"},
+		{UserID: "200", ChannelID: "stage", Suppress: true},
+		{UserID: "300", ChannelID: "elsewhere"},
+	})
+	if !floor.allows("100") || floor.allows("200") || floor.allows("300") {
+		t.Errorf("Floor %v after joining", floor.list())
+	}
+
+	// Moderators invite the audience up and move speakers back down
+	if had, has := floor.update(&discordgo.VoiceState{UserID: "200", ChannelID: "stage"}); had || !has {
+		t.Errorf("Invited speaker had %v, has %v", had, has)
+	}
+	if had, has := floor.update(&discordgo.VoiceState{UserID: "100", ChannelID: "stage", Suppress: true}); !had || has {
+		t.Errorf("Speaker moved to the audience had %v, has %v", had, has)
+	}
+	floor.update(&discordgo.VoiceState{UserID: "300", ChannelID: ""}) // Left
+	if got := floor.list(); !slices.Equal(got, []string{"200"}) {
+		t.Errorf("Speakers %v, want [200]", got)
+	}
+
+	floor.leave()
+	if floor.active() || !floor.allows("100") {
+		t.Error("Floor restricts talkers after leaving the stage")
+	}
+	if had, has := floor.update(&discordgo.VoiceState{UserID: "100", ChannelID: "stage"}); had || has {
+		t.Error("Floor tracked off a stage")
+	}
+}
+
+func TestBot_StageTalkers(t *testing.T) {
+	state := discordgo.NewState()
+	state.User = &discordgo.User{ID: "bot"}
+	b := &Bot{session: &discordgo.Session{State: state}, receiver: newReceiver(nil, false)}
+	b.receiver.allow = b.mayTalk
+
+	b.stage.enter("stage", []*discordgo.VoiceState{
+		{UserID: "bot", ChannelID: "stage"},
+		{UserID: "100", ChannelID: "stage"},
+		{UserID: "200", ChannelID: "stage", Suppress: true},
+	})
+	if got := b.StageSpeakers(); !slices.Equal(got, []string{"100"}) {
+		t.Errorf("Stage speakers %v, want [100]", got)
+	}
+
+	// The audience is refused, however it got audio through
+	now := time.Now()
+	b.receiver.identify(1, "100")
+	b.receiver.identify(2, "200")
+	b.receiver.packet(newOpusTalker(t, 1, 400).next(), now)
+	b.receiver.packet(newOpusTalker(t, 2, 1000).next(), now)
+	if talkers := b.receiver.talkers(now); len(talkers) != 1 || talkers[0].UserID != "100" {
+		t.Errorf("Talkers %+v, want only the speaker", talkers)
+	}
+	if refused := b.receiver.Stats().Refused; refused != 1 {
+		t.Errorf("Refused %d packets, want 1", refused)
+	}
+
+	// Speakers still need a talking role when roles are configured
+	b.permissions, _ = newPermissions(map[string]Permission{"licensed": PermissionTalk}, "", func(string) ([]string, error) {
+		return nil, nil
+	})
+	b.permissions.resolve("100")
+	if b.mayTalk("100") {
+		t.Error("Speaker without a talking role may talk")
+	}
+}
@@ -0,0 +1,95 @@
+package discord
+
+import (
+	"time"
+
+	"github.com/dbehnke/usrp-go/pkg/audio"
+)
+
+// TalkProfile is how a Discord user's voice keys the radio
+type TalkProfile struct {
+	Aggressiveness int           `json:"aggressiveness"` // Voice detection, 0 (keys on the quietest talker) to 3 (rejects the most noise)
+	Hangtime       time.Duration `json:"hangtime"`       // How long the radio stays keyed after they stop talking
+	MaxTransmit    time.Duration `json:"max_transmit"`   // Longest transmission before they are cut off until they pause (0 = unlimited)
+}
+
+// DefaultTalkProfile returns voice detection at aggressiveness 2, keeping
+// the radio keyed for 800ms after speech and cutting transmissions off at
+// three minutes
+func DefaultTalkProfile() *TalkProfile {
+	return &TalkProfile{
+		Aggressiveness: 2,
+		Hangtime:       800 * time.Millisecond,
+		MaxTransmit:    3 * time.Minute,
+	}
+}
+
+// talkGate keys the radio for one Discord speaker: on speech their own
+// voice detector hears, held through pauses shorter than the hangtime, and
+// cut off after the longest transmission until they pause. Discord sends
+// nothing while a user is silent, so the hangtime runs on the clock rather
+// than on the audio.
+type talkGate struct {
+	vad         *audio.VAD
+	hangtime    time.Duration
+	maxTransmit time.Duration
+	mono        []int16
+
+	keyedAt    time.Time // Start of the transmission, zero while unkeyed
+	lastSpeech time.Time
+	cutOff     bool // Transmitted for maxTransmit; muted until a pause
+}
+
+// newTalkGate creates a gate for 48kHz stereo from a profile, with zero
+// fields from DefaultTalkProfile except MaxTransmit
+func newTalkGate(profile TalkProfile) *talkGate {
+	if profile.Hangtime <= 0 {
+		profile.Hangtime = DefaultTalkProfile().Hangtime
+	}
+	return &talkGate{
+		vad: audio.NewVAD(&audio.VADConfig{
+			SampleRate:     discordSampleRate,
+			Aggressiveness: profile.Aggressiveness,
+		}),
+		hangtime:    profile.Hangtime,
+		maxTransmit: profile.MaxTransmit,
+		mono:        make([]int16, 0, discordFrameSize/2),
+	}
+}
+
+// process judges a decoded frame of interleaved stereo and reports whether
+// it keys the radio, and whether this frame cut the transmission off
+func (g *talkGate) process(pcm []int16, now time.Time) (keyed, cut bool) {
+	// A pause longer than the hangtime ends the transmission, and any cut off
+	if !g.lastSpeech.IsZero() && now.Sub(g.lastSpeech) > g.hangtime {
+		g.keyedAt = time.Time{}
+		g.cutOff = false
+	}
+
+	g.mono = g.mono[:0]
+	for i := 0; i+1 < len(pcm); i += 2 {
+		g.mono = append(g.mono, int16((int32(pcm[i])+int32(pcm[i+1]))/2))
+	}
+	if g.vad.Process(g.mono) {
+		g.lastSpeech = now
+	}
+	if g.lastSpeech.IsZero() || now.Sub(g.lastSpeech) > g.hangtime {
+		return false, false
+	}
+
+	if g.keyedAt.IsZero() {
+		g.keyedAt = now
+	}
+	if g.maxTransmit > 0 && now.Sub(g.keyedAt) > g.maxTransmit {
+		cut = !g.cutOff
+		g.cutOff = true
+		return false, cut
+	}
+	return true, false
+}
+
+// holding reports whether the gate keeps the radio keyed through a pause
+// in the speaker's audio
+func (g *talkGate) holding(now time.Time) bool {
+	return !g.keyedAt.IsZero() && !g.cutOff && now.Sub(g.lastSpeech) <= g.hangtime
+}
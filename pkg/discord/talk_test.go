@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// talkFrame returns 20ms of 48kHz stereo: faint noise plus, when voiced,
+// a 500Hz tone with harmonics at about -20 dBFS
+func talkFrame(rng *rand.Rand, n int, voiced bool) []int16 {
+	frame := make([]int16, discordFrameSize)
+	for i := 0; i < len(frame); i += 2 {
+		t := float64(n*discordFrameSize/2+i/2) / discordSampleRate
+		v := rng.NormFloat64() * 30
+		if voiced {
+			for h := 1; h <= 4; h++ {
+				v += 3000 / float64(h) * math.Sin(2*math.Pi*500*float64(h)*t)
+			}
+		}
+		frame[i], frame[i+1] = int16(v), int16(v)
+	}
+	return frame
+}
+
+func TestTalkGate(t *testing.T) {
+	gate := newTalkGate(TalkProfile{Aggressiveness: 2, Hangtime: 200 * time.Millisecond, MaxTransmit: 2 * time.Second})
+	rng := rand.New(rand.NewSource(1))
+	start := time.Now()
+	at := func(n int) time.Time { return start.Add(time.Duration(n) * 20 * time.Millisecond) }
+
+	// Background noise never keys the radio
+	for n := 0; n < 25; n++ {
+		if keyed, _ := gate.process(talkFrame(rng, n, false), at(n)); keyed {
+			t.Fatalf("Noise keyed the radio at frame %d", n)
+		}
+	}
+
+	// Speech does, and the radio stays keyed through a short pause,
+	// including one where Discord sends nothing
+	for n := 25; n < 50; n++ {
+		if keyed, _ := gate.process(talkFrame(rng, n, true), at(n)); !keyed && n > 26 {
+			t.Fatalf("Speech not keyed at frame %d", n)
+		}
+	}
+	if keyed, _ := gate.process(talkFrame(rng, 52, false), at(52)); !keyed {
+		t.Error("Pause within the hangtime unkeyed the radio")
+	}
+	if !gate.holding(at(55)) {
+		t.Error("Not holding the radio keyed through a gap in packets")
+	}
+	if gate.holding(at(70)) {
+		t.Error("Held the radio keyed past the hangtime")
+	}
+
+	// A hot mic is cut off at the longest transmission, once
+	var cuts int
+	for n := 100; n < 250; n++ {
+		keyed, cut := gate.process(talkFrame(rng, n, true), at(n))
+		if cut {
+			cuts++
+		}
+		if n > 102 && n < 200 && !keyed {
+			t.Fatalf("Cut off early at frame %d", n)
+		}
+		if n > 202 && keyed {
+			t.Fatalf("Still keyed at frame %d, past the longest transmission", n)
+		}
+	}
+	if cuts != 1 || gate.holding(at(250)) {
+		t.Errorf("Cut off %d times, holding %v", cuts, gate.holding(at(250)))
+	}
+
+	// and keys again after a pause
+	var keyed bool
+	for n := 300; n < 305; n++ {
+		keyed, _ = gate.process(talkFrame(rng, n, true), at(n))
+	}
+	if !keyed {
+		t.Error("Not keyed again after a pause")
+	}
+}
+
+func TestReceiver_TalkProfiles(t *testing.T) {
+	r := newReceiver(nil, false)
+	r.profiles = map[string]TalkProfile{"100": {Aggressiveness: 3, Hangtime: 100 * time.Millisecond}}
+	r.identify(1, "100")
+	if !r.gated() {
+		t.Fatal("Receiver with profiles not gated")
+	}
+
+	// Silence from a user is withheld rather than keying the radio
+	now := time.Now()
+	for seq := uint16(1); seq <= 5; seq++ {
+		if err := r.packet(&discordgo.Packet{SSRC: 1, Sequence: seq, Opus: opusSilence}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := r.Stats(); stats.Gated != 5 {
+		t.Errorf("Gated %d packets, want 5", stats.Gated)
+	}
+	if r.frame(now) != nil {
+		t.Error("Frame from silence")
+	}
+	speaker := r.speakers[1]
+	if speaker.gate == nil || speaker.gateUser != "100" || speaker.gate.hangtime != 100*time.Millisecond {
+		t.Fatalf("Speaker gate %+v not from the user's profile", speaker.gate)
+	}
+
+	// An unlisted user gets the default profile
+	r.identify(2, "200")
+	if err := r.packet(newOpusTalker(t, 2, 400).next(), now); err != nil {
+		t.Fatal(err)
+	}
+	if gate := r.speakers[2].gate; gate == nil || gate.hangtime != DefaultTalkProfile().Hangtime {
+		t.Errorf("Unlisted speaker gate %+v", gate)
+	}
+
+	// A receiver without profiles keys on every frame
+	if newReceiver(nil, false).gated() {
+		t.Error("Receiver without profiles gated")
+	}
+}
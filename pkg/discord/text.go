@@ -0,0 +1,173 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// textCommand sends the rest of a message to the radio from any channel
+const textCommand = "!text "
+
+// textMessenger posts Discord messages with options, as a
+// discordgo.Session does
+type textMessenger interface {
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// textRelay posts USRP text messages from the radio to a Discord text
+// channel. Posting runs on its own goroutine, off the packet path.
+type textRelay struct {
+	discord   textMessenger
+	channelID string
+	posts     chan string
+	limits    *restLimiter // Spacing of posts (nil = none)
+}
+
+// newTextRelay creates a relay posting to channelID
+func newTextRelay(discord textMessenger, channelID string) *textRelay {
+	return &textRelay{
+		discord:   discord,
+		channelID: channelID,
+		posts:     make(chan string, 16),
+	}
+}
+
+// post queues a radio text message, dropping it rather than stall the
+// radio if Discord is slow
+func (t *textRelay) post(text string) {
+	select {
+	case t.posts <- text:
+	default:
+		log.Printf("Text backlog full, dropping %q", text)
+	}
+}
+
+// run posts queued text until ctx is done. Radio text cannot mention
+// anyone, so an @everyone from the air pings nobody.
+func (t *textRelay) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case text := <-t.posts:
+			if !t.limits.wait(ctx, t.channelID, messageInterval) {
+				return
+			}
+			_, err := t.discord.ChannelMessageSendComplex(t.channelID, &discordgo.MessageSend{
+				Content:         "📟 " + text,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			if err != nil {
+				log.Printf("Error posting radio text: %v", err)
+			}
+		}
+	}
+}
+
+// radioText returns a USRP text message's text as Discord can show it:
+// without the NUL padding radios send, and valid UTF-8
+func radioText(msg *usrp.TextMessage) string {
+	text, _, _ := bytes.Cut(msg.Text, []byte{0})
+	return strings.TrimSpace(strings.ToValidUTF8(string(text), "�"))
+}
+
+// truncateText shortens text to at most max bytes without splitting a
+// character
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	text = text[:max]
+	for len(text) > 0 && !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// SendUSRPText passes a USRP text message from amateur radio to the
+// Discord text channel
+func (b *Bridge) SendUSRPText(msg *usrp.TextMessage) {
+	if b.text == nil {
+		return
+	}
+	if text := radioText(msg); text != "" {
+		b.text.post(text)
+	}
+}
+
+// GetUSRPText gets a USRP text message from Discord for amateur radio
+func (b *Bridge) GetUSRPText() (*usrp.TextMessage, bool) {
+	select {
+	case msg := <-b.USRPText:
+		return msg, true
+	default:
+		return nil, false
+	}
+}
+
+// onTextMessage sends messages in the text channel, and !text commands
+// anywhere in the guild, to the radio, marking each one sent
+func (b *Bridge) onTextMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if !b.relayText(m) {
+		return
+	}
+	if err := s.MessageReactionAdd(m.ChannelID, m.ID, "📡"); err != nil {
+		log.Printf("Error acknowledging text: %v", err)
+	}
+}
+
+// relayText queues a Discord message for the radio if it is bridged text
+// from a member allowed to talk, and reports whether it was
+func (b *Bridge) relayText(m *discordgo.MessageCreate) bool {
+	if m.Author == nil || m.Author.Bot || m.GuildID != b.bot.guild() {
+		return false
+	}
+	var text string
+	switch {
+	case strings.HasPrefix(m.Content, textCommand):
+		text = strings.TrimPrefix(m.ContentWithMentionsReplaced(), textCommand)
+	case m.ChannelID == b.config.TextChannel && !strings.HasPrefix(m.Content, "!"):
+		// Bot commands stay off the air
+		text = m.ContentWithMentionsReplaced()
+	default:
+		return false
+	}
+	if text = strings.TrimSpace(text); text == "" || !b.bot.may(PermissionTalk, m.Author.ID, m.Member) {
+		return false
+	}
+
+	select {
+	case b.USRPText <- b.textToUSRP(b.textSender(m), text):
+		return true
+	default:
+		log.Printf("USRP text buffer full, dropping message from %s", m.Author.Username)
+		return false
+	}
+}
+
+// textSender names who sent a Discord message on the radio: their
+// callsign if mapped, else their nickname or username
+func (b *Bridge) textSender(m *discordgo.MessageCreate) string {
+	if callsign := b.config.Callsigns[m.Author.ID]; callsign != "" {
+		return callsign
+	}
+	if m.Member != nil && m.Member.Nick != "" {
+		return m.Member.Nick
+	}
+	return m.Author.Username
+}
+
+// textToUSRP returns a USRP text message of text from a sender, within
+// the protocol's text limit
+func (b *Bridge) textToUSRP(sender, text string) *usrp.TextMessage {
+	msg := &usrp.TextMessage{Header: usrp.NewHeader(usrp.USRP_TYPE_TEXT, b.generateSequence())}
+	msg.Header.TalkGroup = b.config.TalkGroup
+	msg.Text = []byte(truncateText(sender+": "+text, usrp.CurrentLimits().MaxTextLength))
+	return msg
+}
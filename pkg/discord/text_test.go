@@ -0,0 +1,145 @@
+package discord
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dbehnke/usrp-go/pkg/usrp"
+)
+
+// fakeTextMessenger records messages sent with options
+type fakeTextMessenger struct {
+	mutex sync.Mutex
+	sent  []*discordgo.MessageSend
+}
+
+func (f *fakeTextMessenger) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.sent = append(f.sent, data)
+	return &discordgo.Message{ChannelID: channelID}, nil
+}
+
+func (f *fakeTextMessenger) snapshot() []*discordgo.MessageSend {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]*discordgo.MessageSend(nil), f.sent...)
+}
+
+func TestRadioText(t *testing.T) {
+	tests := []struct {
+		text []byte
+		want string
+	}{
+		{[]byte("W1AW net tonight\x00\x00\x00"), "W1AW net tonight"},
+		{[]byte("  spaced out \n"), "spaced out"},
+		{[]byte("bad \xff byte"), "bad � byte"},
+		{[]byte("\x00garbage after padding"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := radioText(&usrp.TextMessage{Text: tt.text}); got != tt.want {
+			t.Errorf("radioText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("short", 10); got != "short" {
+		t.Errorf("Short text truncated to %q", got)
+	}
+	// "é" is two bytes; cutting through it drops it whole
+	if got := truncateText("café", 4); got != "caf" {
+		t.Errorf("truncateText = %q, want %q", got, "caf")
+	}
+}
+
+func TestTextRelay(t *testing.T) {
+	discord := &fakeTextMessenger{}
+	relay := newTextRelay(discord, "text")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.run(ctx)
+
+	bridge := &Bridge{text: relay}
+	bridge.SendUSRPText(&usrp.TextMessage{Text: []byte("@everyone QSY to 146.52\x00")})
+	bridge.SendUSRPText(&usrp.TextMessage{Text: []byte("\x00")}) // Nothing to show
+
+	deadline := time.Now().Add(time.Second)
+	for len(discord.snapshot()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Radio text never posted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	sent := discord.snapshot()
+	if len(sent) != 1 || sent[0].Content != "📟 @everyone QSY to 146.52" {
+		t.Fatalf("Posted %+v", sent)
+	}
+	if mentions := sent[0].AllowedMentions; mentions == nil || len(mentions.Parse) != 0 {
+		t.Error("Radio text may mention members")
+	}
+}
+
+func TestBridge_RelayText(t *testing.T) {
+	b := &Bridge{
+		bot:      &Bot{guildID: "guild"},
+		config:   &BridgeConfig{TextChannel: "text", TalkGroup: 9, Callsigns: map[string]string{"100": "W1AW"}},
+		USRPText: make(chan *usrp.TextMessage, 10),
+	}
+	message := func(channelID, userID, content string) *discordgo.MessageCreate {
+		return &discordgo.MessageCreate{Message: &discordgo.Message{
+			GuildID:   "guild",
+			ChannelID: channelID,
+			Content:   content,
+			Author:    &discordgo.User{ID: userID, Username: "user" + userID},
+		}}
+	}
+
+	tests := []struct {
+		m    *discordgo.MessageCreate
+		want string // Text sent to the radio, "" for none
+	}{
+		{message("text", "100", "QRZ?"), "W1AW: QRZ?"},
+		{message("text", "200", "hello"), "user200: hello"},
+		{message("general", "200", "!text from elsewhere"), "user200: from elsewhere"},
+		{message("general", "200", "not bridged"), ""},
+		{message("text", "200", "!status"), ""},
+		{message("text", "200", "   "), ""},
+	}
+	for _, tt := range tests {
+		relayed := b.relayText(tt.m)
+		if relayed != (tt.want != "") {
+			t.Errorf("%q in %s relayed %v", tt.m.Content, tt.m.ChannelID, relayed)
+			continue
+		}
+		if !relayed {
+			continue
+		}
+		msg := <-b.USRPText
+		if string(msg.Text) != tt.want || msg.Header.TalkGroup != 9 || msg.GetType() != usrp.USRP_TYPE_TEXT {
+			t.Errorf("Sent %q on TG %d, want %q", msg.Text, msg.Header.TalkGroup, tt.want)
+		}
+	}
+
+	// Bots, other guilds and members who may not talk are not relayed
+	bot := message("text", "300", "beep")
+	bot.Author.Bot = true
+	other := message("text", "100", "hi")
+	other.GuildID = "elsewhere"
+	for _, m := range []*discordgo.MessageCreate{bot, other} {
+		if b.relayText(m) {
+			t.Errorf("Relayed %+v", m.Message)
+		}
+	}
+	b.bot.permissions, _ = newPermissions(map[string]Permission{"licensed": PermissionTalk}, "", nil)
+	listener := message("text", "200", "let me on")
+	listener.Member = &discordgo.Member{Roles: []string{"other"}}
+	if b.relayText(listener) {
+		t.Error("Relayed text from a listener")
+	}
+}
@@ -0,0 +1,63 @@
+package discord
+
+import (
+	"context"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// messenger posts and edits Discord text messages, as a discordgo.Session
+// does
+type messenger interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEdit(channelID, messageID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// transcript logs radio transmissions to a Discord text channel: a message
+// when a station keys up, edited as it is identified and with the duration
+// when it unkeys, so the channel shows who is talking without a message
+// per event.
+type transcript struct {
+	discord   messenger
+	channelID string
+	limits    *restLimiter // Spacing of posts and edits (nil = none)
+}
+
+// newTranscript creates a transcript posting to channelID
+func newTranscript(discord messenger, channelID string) *transcript {
+	return &transcript{discord: discord, channelID: channelID}
+}
+
+// run posts transmission updates until ctx is done: a new message when a
+// transmission starts, and edits of it until it ends
+func (t *transcript) run(ctx context.Context, updates <-chan transmission) {
+	var messageID string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx := <-updates:
+			if !t.limits.wait(ctx, t.channelID, messageInterval) {
+				return
+			}
+			if messageID != "" {
+				if _, err := t.discord.ChannelMessageEdit(t.channelID, messageID, tx.String()); err != nil {
+					log.Printf("Error updating transcript: %v", err)
+				}
+				if tx.duration != 0 {
+					messageID = ""
+				}
+				continue
+			}
+			msg, err := t.discord.ChannelMessageSend(t.channelID, tx.String())
+			if err != nil {
+				log.Printf("Error posting transcript: %v", err)
+				continue
+			}
+			if tx.duration == 0 {
+				messageID = msg.ID
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeMessenger records messages as a text channel would hold them
+type fakeMessenger struct {
+	mutex    sync.Mutex
+	messages []string
+	edits    int
+}
+
+func (f *fakeMessenger) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.messages = append(f.messages, content)
+	return &discordgo.Message{ID: fmt.Sprint(len(f.messages) - 1), ChannelID: channelID}, nil
+}
+
+func (f *fakeMessenger) ChannelMessageEdit(channelID, messageID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var i int
+	fmt.Sscan(messageID, &i)
+	f.messages[i] = content
+	f.edits++
+	return &discordgo.Message{ID: messageID, ChannelID: channelID}, nil
+}
+
+func (f *fakeMessenger) snapshot() ([]string, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.messages...), f.edits
+}
+
+func TestTranscript(t *testing.T) {
+	discord := &fakeMessenger{}
+	air := newTransmissions(2 * time.Second)
+	tr := newTranscript(discord, "log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.run(ctx, air.watch())
+
+	// A named station keys up and unkeys after 3.5s
+	start := time.Now()
+	air.identify("W1AW")
+	for i := 0; i < 175; i++ {
+		air.frame(true, 3100, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	air.frame(false, 3100, start.Add(3500*time.Millisecond))
+	air.frame(false, 3100, start.Add(3520*time.Millisecond))
+
+	// An unnamed one stops without unkeying, ended by the timeout
+	later := start.Add(10 * time.Second)
+	air.frame(true, 0, later)
+	air.frame(true, 0, later.Add(time.Second))
+	air.check(later.Add(2 * time.Second))
+	air.check(later.Add(3500 * time.Millisecond))
+
+	// One named after keying up is renamed in place
+	latest := later.Add(10 * time.Second)
+	air.frame(true, 9, latest)
+	air.identify("KC1NCS")
+	air.identify("KC1NCS")
+	air.frame(false, 9, latest.Add(2*time.Second))
+
+	want := []string{"📻 **W1AW** on TG 3100 · 3.5s", "📻 **Unknown station** · 1.0s", "📻 **KC1NCS** on TG 9 · 2.0s"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		messages, edits := discord.snapshot()
+		if len(messages) == len(want) && edits == 4 && messages[0] == want[0] && messages[1] == want[1] && messages[2] == want[2] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Transcript %q with %d edits, want %q", messages, edits, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTransmission_String(t *testing.T) {
+	tx := transmission{callsign: "KC1NCS", talkGroup: 9}
+	if got := tx.String(); got != "📻 **KC1NCS** on TG 9 keyed up" {
+		t.Errorf("Keyed up line %q", got)
+	}
+	if got := tx.status(); got != "📻 KC1NCS on TG 9" {
+		t.Errorf("Status %q", got)
+	}
+	if got := (transmission{}).status(); got != "📻 Unknown station" {
+		t.Errorf("Unnamed status %q", got)
+	}
+}
@@ -0,0 +1,301 @@
+package usrp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CapabilityVersion is the capability exchange version spoken by this library
+const CapabilityVersion uint8 = 1
+
+// Well-known capability extension names
+const (
+	ExtensionAggregation = "aggregation" // Multiple voice frames per datagram
+	ExtensionFEC         = "fec"         // Forward error correction / redundancy
+)
+
+// Capability flag bits (second byte of the encoded value)
+const (
+	capFlagReply uint8 = 1 << 7 // Set when the advertisement answers an offer
+)
+
+// Capabilities describes the optional features a USRP endpoint supports.
+//
+// Encoded layout (TLV_TAG_CAPABILITIES value):
+//
+//	version(1) flags(1) codec-count(1) codecs(n) ext-count(1) { len(1) name(len) }...
+type Capabilities struct {
+	Version    uint8        // Capability exchange version (0 = plain chan_usrp)
+	Codecs     []PacketType // Voice packet types the endpoint can decode
+	Extensions []string     // Optional protocol extensions (see Extension*)
+}
+
+// BaselineCapabilities returns what every USRP peer supports, including plain
+// AllStarLink chan_usrp endpoints that never answer a capability offer.
+func BaselineCapabilities() Capabilities {
+	return Capabilities{
+		Version: 0,
+		Codecs:  []PacketType{USRP_TYPE_VOICE},
+	}
+}
+
+// DefaultCapabilities returns the capabilities of a usrp-go endpoint
+func DefaultCapabilities() Capabilities {
+	return Capabilities{
+		Version: CapabilityVersion,
+		Codecs:  []PacketType{USRP_TYPE_VOICE, USRP_TYPE_VOICE_ULAW},
+	}
+}
+
+// Supports returns true if the codec is advertised
+func (c Capabilities) Supports(codec PacketType) bool {
+	for _, pt := range c.Codecs {
+		if pt == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// HasExtension returns true if the named extension is advertised
+func (c Capabilities) HasExtension(name string) bool {
+	for _, ext := range c.Extensions {
+		if ext == name {
+			return true
+		}
+	}
+	return false
+}
+
+// encode serializes the capabilities into a TLV value
+func (c Capabilities) encode(flags uint8) ([]byte, error) {
+	if len(c.Codecs) > 255 {
+		return nil, fmt.Errorf("too many codecs: %d", len(c.Codecs))
+	}
+	if len(c.Extensions) > 255 {
+		return nil, fmt.Errorf("too many extensions: %d", len(c.Extensions))
+	}
+
+	value := []byte{c.Version, flags, byte(len(c.Codecs))}
+	for _, pt := range c.Codecs {
+		if pt > 255 {
+			return nil, fmt.Errorf("codec %d does not fit capability encoding", pt)
+		}
+		value = append(value, byte(pt))
+	}
+
+	value = append(value, byte(len(c.Extensions)))
+	for _, ext := range c.Extensions {
+		if len(ext) == 0 || len(ext) > 255 {
+			return nil, fmt.Errorf("invalid extension name length: %q", ext)
+		}
+		value = append(value, byte(len(ext)))
+		value = append(value, ext...)
+	}
+
+	return value, nil
+}
+
+// decodeCapabilities parses a TLV value into capabilities and flags
+func decodeCapabilities(value []byte) (Capabilities, uint8, error) {
+	var c Capabilities
+	if len(value) < 3 {
+		return c, 0, fmt.Errorf("capability value too short: %d bytes", len(value))
+	}
+
+	c.Version = value[0]
+	flags := value[1]
+	count := int(value[2])
+	pos := 3
+
+	if len(value) < pos+count {
+		return c, 0, fmt.Errorf("capability codec list truncated")
+	}
+	for _, b := range value[pos : pos+count] {
+		c.Codecs = append(c.Codecs, PacketType(b))
+	}
+	pos += count
+
+	// Extensions are optional so version 1 peers may omit the count byte
+	if pos >= len(value) {
+		return c, flags, nil
+	}
+	extCount := int(value[pos])
+	pos++
+	for i := 0; i < extCount; i++ {
+		if pos >= len(value) {
+			return c, 0, fmt.Errorf("capability extension %d truncated", i)
+		}
+		n := int(value[pos])
+		pos++
+		if len(value) < pos+n {
+			return c, 0, fmt.Errorf("capability extension %d truncated", i)
+		}
+		c.Extensions = append(c.Extensions, string(value[pos:pos+n]))
+		pos += n
+	}
+
+	return c, flags, nil
+}
+
+// NewCapabilityMessage creates a TLV message advertising the given capabilities
+func NewCapabilityMessage(seq uint32, caps Capabilities) (*TLVMessage, error) {
+	return newCapabilityMessage(seq, caps, 0)
+}
+
+func newCapabilityMessage(seq uint32, caps Capabilities, flags uint8) (*TLVMessage, error) {
+	value, err := caps.encode(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &TLVMessage{Header: NewHeader(USRP_TYPE_TLV, seq)}
+	msg.AddTLV(TLV_TAG_CAPABILITIES, value)
+	return msg, nil
+}
+
+// GetCapabilities retrieves a capability advertisement from a TLV message
+func (tlv *TLVMessage) GetCapabilities() (Capabilities, bool, error) {
+	value, ok := tlv.GetTLV(TLV_TAG_CAPABILITIES)
+	if !ok {
+		return Capabilities{}, false, nil
+	}
+	caps, _, err := decodeCapabilities(value)
+	if err != nil {
+		return Capabilities{}, true, err
+	}
+	return caps, true, nil
+}
+
+// Negotiate returns the capabilities shared by both endpoints
+func Negotiate(local, remote Capabilities) Capabilities {
+	result := Capabilities{Version: local.Version}
+	if remote.Version < result.Version {
+		result.Version = remote.Version
+	}
+
+	for _, pt := range local.Codecs {
+		if remote.Supports(pt) {
+			result.Codecs = append(result.Codecs, pt)
+		}
+	}
+	// Uncompressed voice is always available, even to plain chan_usrp
+	if !result.Supports(USRP_TYPE_VOICE) {
+		result.Codecs = append([]PacketType{USRP_TYPE_VOICE}, result.Codecs...)
+	}
+
+	for _, ext := range local.Extensions {
+		if remote.HasExtension(ext) {
+			result.Extensions = append(result.Extensions, ext)
+		}
+	}
+
+	return result
+}
+
+// Negotiator runs the link-up capability exchange with a single peer.
+//
+// The local side sends Offer() when the link comes up and passes every
+// received message to HandleMessage. If the peer answers, Result returns the
+// shared capabilities; if it stays silent past the timeout (plain chan_usrp),
+// Result falls back to BaselineCapabilities.
+type Negotiator struct {
+	local   Capabilities
+	timeout time.Duration
+
+	mutex     sync.Mutex
+	started   time.Time
+	remote    *Capabilities
+	completed bool
+}
+
+// NewNegotiator creates a negotiator advertising the local capabilities
+func NewNegotiator(local Capabilities, timeout time.Duration) *Negotiator {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Negotiator{
+		local:   local,
+		timeout: timeout,
+	}
+}
+
+// Offer returns the capability message to send on link-up and starts the
+// fallback timer
+func (n *Negotiator) Offer(seq uint32) (*TLVMessage, error) {
+	n.mutex.Lock()
+	if n.started.IsZero() {
+		n.started = time.Now()
+	}
+	n.mutex.Unlock()
+
+	return newCapabilityMessage(seq, n.local, 0)
+}
+
+// HandleMessage processes a received message. It returns a reply that must be
+// sent back to the peer (or nil) and whether the message was a capability
+// advertisement that the caller should not route further.
+func (n *Negotiator) HandleMessage(msg Message) (Message, bool, error) {
+	tlv, ok := msg.(*TLVMessage)
+	if !ok {
+		return nil, false, nil
+	}
+
+	value, ok := tlv.GetTLV(TLV_TAG_CAPABILITIES)
+	if !ok {
+		return nil, false, nil
+	}
+
+	remote, flags, err := decodeCapabilities(value)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid capability advertisement: %w", err)
+	}
+
+	n.mutex.Lock()
+	n.remote = &remote
+	n.completed = true
+	n.mutex.Unlock()
+
+	// Answer offers so the peer can complete too; never answer a reply
+	if flags&capFlagReply != 0 {
+		return nil, true, nil
+	}
+
+	reply, err := newCapabilityMessage(tlv.Header.Seq, n.local, capFlagReply)
+	if err != nil {
+		return nil, true, err
+	}
+	return reply, true, nil
+}
+
+// Done returns true once the exchange completed or the fallback timer expired
+func (n *Negotiator) Done() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.completed || n.timedOut()
+}
+
+// PeerIsLegacy returns true if the peer never answered the offer in time
+func (n *Negotiator) PeerIsLegacy() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return !n.completed && n.timedOut()
+}
+
+// Result returns the negotiated capabilities, or the baseline set while the
+// exchange is pending or after the peer failed to answer
+func (n *Negotiator) Result() Capabilities {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.remote == nil {
+		return BaselineCapabilities()
+	}
+	return Negotiate(n.local, *n.remote)
+}
+
+// timedOut must be called with the mutex held
+func (n *Negotiator) timedOut() bool {
+	return !n.started.IsZero() && time.Since(n.started) > n.timeout
+}
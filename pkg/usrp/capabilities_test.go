@@ -0,0 +1,119 @@
+package usrp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapabilityMessage_RoundTrip(t *testing.T) {
+	caps := DefaultCapabilities()
+	caps.Extensions = []string{ExtensionAggregation, ExtensionFEC}
+
+	msg, err := NewCapabilityMessage(42, caps)
+	if err != nil {
+		t.Fatalf("Failed to create capability message: %v", err)
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	decoded := &TLVMessage{}
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	got, ok, err := decoded.GetCapabilities()
+	if err != nil || !ok {
+		t.Fatalf("Capabilities not found: ok=%v err=%v", ok, err)
+	}
+
+	if got.Version != CapabilityVersion {
+		t.Errorf("Version mismatch: got %d, want %d", got.Version, CapabilityVersion)
+	}
+	if !got.Supports(USRP_TYPE_VOICE_ULAW) {
+		t.Error("Expected μ-law codec to be advertised")
+	}
+	if !got.HasExtension(ExtensionFEC) || !got.HasExtension(ExtensionAggregation) {
+		t.Errorf("Extensions mismatch: got %v", got.Extensions)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	local := Capabilities{
+		Version:    1,
+		Codecs:     []PacketType{USRP_TYPE_VOICE, USRP_TYPE_VOICE_ULAW},
+		Extensions: []string{ExtensionAggregation, ExtensionFEC},
+	}
+	remote := Capabilities{
+		Version:    2,
+		Codecs:     []PacketType{USRP_TYPE_VOICE_ULAW},
+		Extensions: []string{ExtensionFEC},
+	}
+
+	result := Negotiate(local, remote)
+
+	if result.Version != 1 {
+		t.Errorf("Expected lowest version 1, got %d", result.Version)
+	}
+	if !result.Supports(USRP_TYPE_VOICE) || !result.Supports(USRP_TYPE_VOICE_ULAW) {
+		t.Errorf("Unexpected codecs: %v", result.Codecs)
+	}
+	if result.HasExtension(ExtensionAggregation) || !result.HasExtension(ExtensionFEC) {
+		t.Errorf("Unexpected extensions: %v", result.Extensions)
+	}
+}
+
+func TestNegotiator_Exchange(t *testing.T) {
+	a := NewNegotiator(Capabilities{Version: 1, Codecs: []PacketType{USRP_TYPE_VOICE}, Extensions: []string{ExtensionFEC}}, time.Second)
+	b := NewNegotiator(Capabilities{Version: 1, Codecs: []PacketType{USRP_TYPE_VOICE}, Extensions: []string{ExtensionFEC}}, time.Second)
+
+	offer, err := a.Offer(1)
+	if err != nil {
+		t.Fatalf("Offer failed: %v", err)
+	}
+
+	reply, handled, err := b.HandleMessage(offer)
+	if err != nil || !handled || reply == nil {
+		t.Fatalf("Expected reply to offer: reply=%v handled=%v err=%v", reply, handled, err)
+	}
+
+	again, handled, err := a.HandleMessage(reply)
+	if err != nil || !handled {
+		t.Fatalf("Reply not handled: handled=%v err=%v", handled, err)
+	}
+	if again != nil {
+		t.Error("A reply must not be answered")
+	}
+
+	if !a.Done() || !b.Done() {
+		t.Error("Both sides should have completed")
+	}
+	if !a.Result().HasExtension(ExtensionFEC) {
+		t.Errorf("Expected FEC to be negotiated, got %v", a.Result().Extensions)
+	}
+}
+
+func TestNegotiator_LegacyFallback(t *testing.T) {
+	n := NewNegotiator(DefaultCapabilities(), 10*time.Millisecond)
+	if _, err := n.Offer(1); err != nil {
+		t.Fatalf("Offer failed: %v", err)
+	}
+
+	// Plain chan_usrp answers with voice traffic, never a capability TLV
+	voice := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 1)}
+	if _, handled, _ := n.HandleMessage(voice); handled {
+		t.Error("Voice message must not be consumed by the negotiator")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !n.PeerIsLegacy() {
+		t.Error("Expected peer to be treated as legacy after timeout")
+	}
+	result := n.Result()
+	if result.Version != 0 || !result.Supports(USRP_TYPE_VOICE) || result.Supports(USRP_TYPE_VOICE_ULAW) {
+		t.Errorf("Expected baseline capabilities, got %+v", result)
+	}
+}
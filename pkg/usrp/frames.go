@@ -0,0 +1,91 @@
+package usrp
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultComfortNoiseLevel is a comfort noise level (dBFS RMS) that is audible
+// enough to mask gaps without being mistaken for signal
+const DefaultComfortNoiseLevel = -65.0
+
+// NewSilenceFrame creates a voice frame of digital silence. Bridges send these
+// during hang time or jitter gaps so the far end keeps a steady 20ms cadence.
+func NewSilenceFrame(seq uint32, ptt bool) *VoiceMessage {
+	msg := &VoiceMessage{
+		Header: NewHeader(USRP_TYPE_VOICE, seq),
+	}
+	msg.Header.SetPTT(ptt)
+	return msg
+}
+
+// NewComfortNoiseFrame creates a voice frame of white noise at the given RMS
+// level in dBFS (e.g. -65). Levels at or above 0 dBFS are clamped to -1 dBFS.
+func NewComfortNoiseFrame(seq uint32, ptt bool, levelDBFS float64) *VoiceMessage {
+	msg := NewSilenceFrame(seq, ptt)
+	sharedNoise.fill(msg.AudioData[:], noiseAmplitude(levelDBFS))
+	return msg
+}
+
+// ComfortNoiseGenerator produces comfort noise frames from its own random
+// source, so concurrent bridges do not contend on a shared generator
+type ComfortNoiseGenerator struct {
+	levelDBFS float64
+	amplitude float64
+	rng       *rand.Rand
+	mutex     sync.Mutex
+}
+
+// sharedNoise backs NewComfortNoiseFrame
+var sharedNoise = NewComfortNoiseGenerator(DefaultComfortNoiseLevel, time.Now().UnixNano())
+
+// NewComfortNoiseGenerator creates a generator at the given level (dBFS RMS)
+// seeded with seed
+func NewComfortNoiseGenerator(levelDBFS float64, seed int64) *ComfortNoiseGenerator {
+	if levelDBFS >= 0 {
+		levelDBFS = -1
+	}
+	return &ComfortNoiseGenerator{
+		levelDBFS: levelDBFS,
+		amplitude: noiseAmplitude(levelDBFS),
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// noiseAmplitude returns the peak of uniform noise with the given RMS level.
+// Uniform noise in [-a, a] has an RMS of a/√3.
+func noiseAmplitude(levelDBFS float64) float64 {
+	if levelDBFS >= 0 {
+		levelDBFS = -1
+	}
+	return math.Pow(10, levelDBFS/20) * math.MaxInt16 * math.Sqrt(3)
+}
+
+// Level returns the generator level in dBFS
+func (g *ComfortNoiseGenerator) Level() float64 {
+	return g.levelDBFS
+}
+
+// Fill writes comfort noise into samples
+func (g *ComfortNoiseGenerator) Fill(samples []int16) {
+	g.fill(samples, g.amplitude)
+}
+
+func (g *ComfortNoiseGenerator) fill(samples []int16, amplitude float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for i := range samples {
+		v := math.Round((g.rng.Float64()*2 - 1) * amplitude)
+		samples[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+	}
+}
+
+// Frame creates a comfort noise voice frame
+func (g *ComfortNoiseGenerator) Frame(seq uint32, ptt bool) *VoiceMessage {
+	msg := NewSilenceFrame(seq, ptt)
+	g.Fill(msg.AudioData[:])
+	return msg
+}
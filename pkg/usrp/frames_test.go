@@ -0,0 +1,71 @@
+package usrp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewSilenceFrame(t *testing.T) {
+	msg := NewSilenceFrame(12, true)
+
+	if err := msg.Validate(); err != nil {
+		t.Fatalf("Silence frame invalid: %v", err)
+	}
+	if msg.Header.Seq != 12 || !msg.Header.IsPTT() {
+		t.Errorf("Unexpected header: %+v", msg.Header)
+	}
+	for i, sample := range msg.AudioData {
+		if sample != 0 {
+			t.Fatalf("Sample %d not silent: %d", i, sample)
+		}
+	}
+}
+
+func TestComfortNoiseLevel(t *testing.T) {
+	for _, level := range []float64{-70, -50, -30} {
+		gen := NewComfortNoiseGenerator(level, 1)
+
+		// Average over many frames for a stable RMS estimate
+		var sum float64
+		var count int
+		for i := 0; i < 50; i++ {
+			frame := gen.Frame(uint32(i), false)
+			for _, s := range frame.AudioData {
+				sum += float64(s) * float64(s)
+				count++
+			}
+		}
+
+		rms := math.Sqrt(sum / float64(count))
+		measured := 20 * math.Log10(rms/math.MaxInt16)
+		if math.Abs(measured-level) > 1.5 {
+			t.Errorf("Level %.0f dBFS: measured %.1f dBFS", level, measured)
+		}
+	}
+}
+
+func TestNewComfortNoiseFrame(t *testing.T) {
+	quiet := NewComfortNoiseFrame(1, true, -80)
+	loud := NewComfortNoiseFrame(2, true, -20)
+
+	peak := func(m *VoiceMessage) int {
+		max := 0
+		for _, s := range m.AudioData {
+			v := int(s)
+			if v < 0 {
+				v = -v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		return max
+	}
+
+	if peak(quiet) >= peak(loud) {
+		t.Errorf("Expected -80 dBFS noise to be quieter than -20 dBFS: %d vs %d", peak(quiet), peak(loud))
+	}
+	if peak(loud) == 0 {
+		t.Error("Comfort noise should not be silent")
+	}
+}
@@ -0,0 +1,129 @@
+package usrp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is returned (wrapped) when a packet violates the parser limits
+var ErrLimitExceeded = errors.New("usrp: input limit exceeded")
+
+// Limits bounds what the parsers accept from the network. Every limit applies
+// before any payload is copied, so an oversized packet costs nothing more than
+// reading its header.
+type Limits struct {
+	MaxPacketSize   int `json:"max_packet_size"`   // Maximum datagram size accepted by Parse
+	MaxTLVItems     int `json:"max_tlv_items"`     // Maximum TLV items per TLV message
+	MaxTextLength   int `json:"max_text_length"`   // Maximum TextMessage payload in bytes
+	MaxADPCMPayload int `json:"max_adpcm_payload"` // Maximum ADPCM payload in bytes
+}
+
+// DefaultLimits returns conservative limits suitable for internet-facing hubs
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPacketSize:   HeaderSize + MaxPayloadSize,
+		MaxTLVItems:     32,
+		MaxTextLength:   256,
+		MaxADPCMPayload: VoiceFrameSize, // Twice a 4-bit ADPCM frame's 80 bytes, room for block headers or 5-bit G.726
+	}
+}
+
+// LimitCounters counts packets rejected by each limit
+type LimitCounters struct {
+	OversizedPackets uint64 `json:"oversized_packets"`
+	TooManyTLVs      uint64 `json:"too_many_tlvs"`
+	TextTooLong      uint64 `json:"text_too_long"`
+	ADPCMTooLong     uint64 `json:"adpcm_too_long"`
+}
+
+var (
+	limitsMutex   sync.RWMutex
+	currentLimits = DefaultLimits()
+	limitCounters LimitCounters
+)
+
+// SetLimits replaces the parser limits. Zero fields fall back to the defaults.
+func SetLimits(limits Limits) {
+	defaults := DefaultLimits()
+	if limits.MaxPacketSize <= 0 {
+		limits.MaxPacketSize = defaults.MaxPacketSize
+	}
+	if limits.MaxTLVItems <= 0 {
+		limits.MaxTLVItems = defaults.MaxTLVItems
+	}
+	if limits.MaxTextLength <= 0 {
+		limits.MaxTextLength = defaults.MaxTextLength
+	}
+	if limits.MaxADPCMPayload <= 0 {
+		limits.MaxADPCMPayload = defaults.MaxADPCMPayload
+	}
+
+	limitsMutex.Lock()
+	currentLimits = limits
+	limitsMutex.Unlock()
+}
+
+// CurrentLimits returns the parser limits in effect
+func CurrentLimits() Limits {
+	limitsMutex.RLock()
+	defer limitsMutex.RUnlock()
+	return currentLimits
+}
+
+// LimitStats returns a snapshot of the limit violation counters
+func LimitStats() LimitCounters {
+	return LimitCounters{
+		OversizedPackets: atomic.LoadUint64(&limitCounters.OversizedPackets),
+		TooManyTLVs:      atomic.LoadUint64(&limitCounters.TooManyTLVs),
+		TextTooLong:      atomic.LoadUint64(&limitCounters.TextTooLong),
+		ADPCMTooLong:     atomic.LoadUint64(&limitCounters.ADPCMTooLong),
+	}
+}
+
+// limitError counts a violation and returns a wrapped ErrLimitExceeded
+func limitError(counter *uint64, format string, args ...interface{}) error {
+	atomic.AddUint64(counter, 1)
+	return fmt.Errorf("%w: %s", ErrLimitExceeded, fmt.Sprintf(format, args...))
+}
+
+// Parse decodes a raw datagram into the matching message type after
+// enforcing the packet size limit
+func Parse(data []byte) (Message, error) {
+	if max := CurrentLimits().MaxPacketSize; len(data) > max {
+		return nil, limitError(&limitCounters.OversizedPackets, "packet size %d exceeds %d", len(data), max)
+	}
+
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("packet too small: %d bytes", len(data))
+	}
+
+	// Packet type is at offset 20 in the 32-byte header (after Eye, Seq, Memory, Keyup, TalkGroup)
+	packetType := PacketType(uint32(data[20])<<24 | uint32(data[21])<<16 | uint32(data[22])<<8 | uint32(data[23]))
+
+	var msg Message
+	switch packetType {
+	case USRP_TYPE_VOICE:
+		msg = &VoiceMessage{}
+	case USRP_TYPE_DTMF:
+		msg = &DTMFMessage{}
+	case USRP_TYPE_TEXT:
+		msg = &TextMessage{}
+	case USRP_TYPE_PING:
+		msg = &PingMessage{}
+	case USRP_TYPE_TLV:
+		msg = &TLVMessage{}
+	case USRP_TYPE_VOICE_ULAW:
+		msg = &VoiceULawMessage{}
+	case USRP_TYPE_VOICE_ADPCM:
+		msg = &VoiceADPCMMessage{}
+	default:
+		return nil, fmt.Errorf("unknown packet type: %d", packetType)
+	}
+
+	if err := msg.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
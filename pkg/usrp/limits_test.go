@@ -0,0 +1,89 @@
+package usrp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse_AllTypes(t *testing.T) {
+	messages := []Message{
+		&VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 1)},
+		&DTMFMessage{Header: NewHeader(USRP_TYPE_DTMF, 2), Digit: '#'},
+		&TextMessage{Header: NewHeader(USRP_TYPE_TEXT, 3), Text: []byte("hello")},
+		&PingMessage{Header: NewHeader(USRP_TYPE_PING, 4)},
+		&VoiceULawMessage{Header: NewHeader(USRP_TYPE_VOICE_ULAW, 5)},
+		&VoiceADPCMMessage{Header: NewHeader(USRP_TYPE_VOICE_ADPCM, 6), AudioData: []byte{1, 2, 3}},
+	}
+
+	for _, original := range messages {
+		data, err := original.Marshal()
+		if err != nil {
+			t.Fatalf("Failed to marshal %T: %v", original, err)
+		}
+
+		parsed, err := Parse(data)
+		if err != nil {
+			t.Fatalf("Failed to parse %T: %v", original, err)
+		}
+		if parsed.GetType() != original.GetType() {
+			t.Errorf("Type mismatch: got %d, want %d", parsed.GetType(), original.GetType())
+		}
+	}
+}
+
+func TestParse_Limits(t *testing.T) {
+	defer SetLimits(DefaultLimits())
+	SetLimits(Limits{MaxTextLength: 8, MaxTLVItems: 2})
+
+	before := LimitStats()
+
+	// Oversized text is rejected before it is copied
+	text := &TextMessage{Header: NewHeader(USRP_TYPE_TEXT, 1), Text: []byte("this text is far too long")}
+	data, _ := text.Marshal()
+	if _, err := Parse(data); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for long text, got %v", err)
+	}
+
+	// Too many TLV items
+	tlv := &TLVMessage{Header: NewHeader(USRP_TYPE_TLV, 2)}
+	for i := 0; i < 3; i++ {
+		tlv.AddTLV(TLV_TAG_SET_INFO, []byte("W1AW"))
+	}
+	data, _ = tlv.Marshal()
+	if _, err := Parse(data); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for TLV count, got %v", err)
+	}
+
+	// Datagram larger than the packet limit
+	huge := make([]byte, 64*1024)
+	copy(huge, USRPMagic)
+	if _, err := Parse(huge); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for huge packet, got %v", err)
+	}
+
+	// ADPCM longer than the default limit, twice a 4-bit frame
+	adpcm := &VoiceADPCMMessage{Header: NewHeader(USRP_TYPE_VOICE_ADPCM, 3), AudioData: make([]byte, VoiceFrameSize)}
+	data, _ = adpcm.Marshal()
+	if _, err := Parse(data); err != nil {
+		t.Errorf("ADPCM of %d bytes rejected: %v", VoiceFrameSize, err)
+	}
+	adpcm.AudioData = make([]byte, VoiceFrameSize+1)
+	data, _ = adpcm.Marshal()
+	if _, err := Parse(data); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for long ADPCM, got %v", err)
+	}
+
+	after := LimitStats()
+	if after.TextTooLong != before.TextTooLong+1 {
+		t.Errorf("TextTooLong counter not incremented")
+	}
+	if after.TooManyTLVs != before.TooManyTLVs+1 {
+		t.Errorf("TooManyTLVs counter not incremented")
+	}
+	if after.OversizedPackets != before.OversizedPackets+1 {
+		t.Errorf("OversizedPackets counter not incremented")
+	}
+	if after.ADPCMTooLong != before.ADPCMTooLong+1 {
+		t.Errorf("ADPCMTooLong counter not incremented")
+	}
+}
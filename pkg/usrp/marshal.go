@@ -277,6 +277,9 @@ func (t *TextMessage) Unmarshal(data []byte) error {
 
 	// Read remaining text data
 	remaining := len(data) - HeaderSize
+	if max := CurrentLimits().MaxTextLength; remaining > max {
+		return limitError(&limitCounters.TextTooLong, "text length %d exceeds %d", remaining, max)
+	}
 	if remaining > 0 {
 		t.Text = make([]byte, remaining)
 		if _, err := buf.Read(t.Text); err != nil {
@@ -451,10 +454,14 @@ func (tlv *TLVMessage) Unmarshal(data []byte) error {
 
 	// Parse TLV items
 	tlv.TLVs = nil
+	maxItems := CurrentLimits().MaxTLVItems
 	for buf.Len() > 0 {
 		if buf.Len() < 3 { // Need at least tag(1) + length(2)
 			break
 		}
+		if len(tlv.TLVs) >= maxItems {
+			return limitError(&limitCounters.TooManyTLVs, "more than %d TLV items", maxItems)
+		}
 
 		var item TLVItem
 		tag, _ := buf.ReadByte()
@@ -647,6 +654,9 @@ func (a *VoiceADPCMMessage) Unmarshal(data []byte) error {
 
 	// Read ADPCM data
 	remaining := len(data) - HeaderSize
+	if max := CurrentLimits().MaxADPCMPayload; remaining > max {
+		return limitError(&limitCounters.ADPCMTooLong, "ADPCM payload %d exceeds %d", remaining, max)
+	}
 	if remaining > 0 {
 		a.AudioData = make([]byte, remaining)
 		if _, err := buf.Read(a.AudioData); err != nil {
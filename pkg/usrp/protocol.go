@@ -37,6 +37,25 @@ const (
 	TLV_TAG_SET_INFO TLVTag = 0x08 // Primary metadata tag
 	TLV_TAG_AMBE     TLVTag = 0x01 // AMBE vocoder data
 	TLV_TAG_DTMF     TLVTag = 0x02 // DTMF tone
+
+	// Additional tags used by DVSwitch (Analog_Bridge / MMDVM_Bridge).
+	// Note that DVSwitch assigns 0x02 to END_TX, so TLV_TAG_DTMF and
+	// TLV_TAG_END_TX share a value; interpret it according to the peer.
+	TLV_TAG_BEGIN_TX   TLVTag = 0x00 // Start of transmission
+	TLV_TAG_END_TX     TLVTag = 0x02 // End of transmission
+	TLV_TAG_TG_TUNE    TLVTag = 0x03 // Tune to talkgroup (ASCII)
+	TLV_TAG_PLAY_AMBE  TLVTag = 0x04 // Play AMBE file
+	TLV_TAG_REMOTE_CMD TLVTag = 0x05 // Remote control command (ASCII)
+	TLV_TAG_AMBE_49    TLVTag = 0x06 // 49-bit AMBE frame
+	TLV_TAG_AMBE_72    TLVTag = 0x07 // 72-bit AMBE frame
+	TLV_TAG_IMBE       TLVTag = 0x09 // IMBE (P25) vocoder data
+	TLV_TAG_DSAMBE     TLVTag = 0x0A // D-STAR AMBE vocoder data
+	TLV_TAG_FILE_XFER  TLVTag = 0x0B // File transfer
+
+	// TLV_TAG_CAPABILITIES carries a usrp-go capability advertisement. The tag
+	// sits outside the ranges used by AllStarLink and DVSwitch, so plain
+	// chan_usrp peers simply ignore it.
+	TLV_TAG_CAPABILITIES TLVTag = 0x40
 )
 
 // Header represents the official USRP packet header (32 bytes)
@@ -183,3 +202,25 @@ func (tlv *TLVMessage) GetCallsign() (string, bool) {
 	}
 	return "", false
 }
+
+// HeaderOf returns a pointer to the header of any message type, or nil for
+// message types defined outside this package
+func HeaderOf(msg Message) *Header {
+	switch m := msg.(type) {
+	case *VoiceMessage:
+		return &m.Header
+	case *DTMFMessage:
+		return &m.Header
+	case *TextMessage:
+		return &m.Header
+	case *PingMessage:
+		return &m.Header
+	case *TLVMessage:
+		return &m.Header
+	case *VoiceULawMessage:
+		return &m.Header
+	case *VoiceADPCMMessage:
+		return &m.Header
+	}
+	return nil
+}
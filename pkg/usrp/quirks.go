@@ -0,0 +1,147 @@
+package usrp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// HeaderProfile describes how a peer implementation fills the USRP header,
+// so interop differences can be handled per peer in configuration.
+// A nil profile leaves messages untouched (plain AllStarLink behaviour).
+type HeaderProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Inbound validation
+	RequireZeroReserved bool `json:"require_zero_reserved"` // Reject packets with nonzero MpxID/Reserved
+
+	// Inbound normalization
+	ClearMemory    bool `json:"clear_memory"`     // Zero the Memory field the peer misuses
+	ClearMpxID     bool `json:"clear_mpxid"`      // Zero the MpxID field the peer misuses
+	ClearReserved  bool `json:"clear_reserved"`   // Zero the Reserved field the peer misuses
+	KeyupAlwaysSet bool `json:"keyup_always_set"` // Peer sends keyup=1 on every packet; a silent voice frame means unkey
+
+	// Outbound header defaults
+	Memory   uint32 `json:"memory"`
+	MpxID    uint32 `json:"mpxid"`
+	Reserved uint32 `json:"reserved"`
+}
+
+// Built-in profile names
+const (
+	ProfileAllStarLink = "allstarlink"
+	ProfileStrict      = "strict"
+	ProfileLenient     = "lenient"
+	ProfileKeyupAlways = "keyup-always"
+)
+
+// builtinProfiles holds the profiles selectable by name
+var builtinProfiles = map[string]HeaderProfile{
+	ProfileAllStarLink: {
+		Name:        ProfileAllStarLink,
+		Description: "AllStarLink chan_usrp: headers used as specified",
+	},
+	ProfileStrict: {
+		Name:                ProfileStrict,
+		Description:         "Reject packets that use the MpxID or Reserved fields",
+		RequireZeroReserved: true,
+	},
+	ProfileLenient: {
+		Name:          ProfileLenient,
+		Description:   "Accept and clear nonzero Memory, MpxID and Reserved fields",
+		ClearMemory:   true,
+		ClearMpxID:    true,
+		ClearReserved: true,
+	},
+	ProfileKeyupAlways: {
+		Name:           ProfileKeyupAlways,
+		Description:    "Peer holds keyup=1 permanently; end of transmission is a silent frame",
+		KeyupAlwaysSet: true,
+		ClearMpxID:     true,
+		ClearReserved:  true,
+	},
+}
+
+// LookupProfile returns a copy of a built-in profile
+func LookupProfile(name string) (*HeaderProfile, error) {
+	profile, ok := builtinProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown header profile: %s", name)
+	}
+	return &profile, nil
+}
+
+// ProfileNames returns the names of the built-in profiles
+func ProfileNames() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Inbound validates and normalizes a message received from the peer
+func (p *HeaderProfile) Inbound(msg Message) error {
+	if p == nil {
+		return nil
+	}
+	h := HeaderOf(msg)
+	if h == nil {
+		return nil
+	}
+
+	if p.RequireZeroReserved && (h.MpxID != 0 || h.Reserved != 0) {
+		return fmt.Errorf("header profile %s: nonzero mpxid/reserved (%d/%d)", p.Name, h.MpxID, h.Reserved)
+	}
+
+	if p.ClearMemory {
+		h.Memory = 0
+	}
+	if p.ClearMpxID {
+		h.MpxID = 0
+	}
+	if p.ClearReserved {
+		h.Reserved = 0
+	}
+
+	if p.KeyupAlwaysSet {
+		if voice, ok := msg.(*VoiceMessage); ok && isSilent(voice.AudioData[:]) {
+			h.SetPTT(false)
+		}
+	}
+
+	return nil
+}
+
+// Outbound applies the profile's header defaults to a message sent to the peer
+func (p *HeaderProfile) Outbound(msg Message) {
+	if p == nil {
+		return
+	}
+	h := HeaderOf(msg)
+	if h == nil {
+		return
+	}
+
+	h.Memory = p.Memory
+	h.MpxID = p.MpxID
+	h.Reserved = p.Reserved
+	if p.KeyupAlwaysSet {
+		// Signal unkey the way the peer expects: a silent frame with keyup held
+		if voice, ok := msg.(*VoiceMessage); ok && !h.IsPTT() {
+			voice.AudioData = [VoiceFrameSize]int16{}
+		}
+		h.SetPTT(true)
+	}
+}
+
+// isSilent reports whether every sample is zero
+func isSilent(samples []int16) bool {
+	for _, s := range samples {
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
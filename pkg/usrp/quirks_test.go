@@ -0,0 +1,103 @@
+package usrp
+
+import (
+	"testing"
+)
+
+func TestHeaderProfile_Inbound(t *testing.T) {
+	newVoice := func(mpxid, reserved uint32, silent bool) *VoiceMessage {
+		v := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 1)}
+		v.Header.SetPTT(true)
+		v.Header.Memory = 7
+		v.Header.MpxID = mpxid
+		v.Header.Reserved = reserved
+		if !silent {
+			v.AudioData[0] = 100
+		}
+		return v
+	}
+
+	tests := []struct {
+		profile   string
+		msg       *VoiceMessage
+		wantErr   bool
+		wantPTT   bool
+		wantClean bool // Memory, MpxID and Reserved zeroed
+	}{
+		{ProfileAllStarLink, newVoice(3, 4, false), false, true, false},
+		{ProfileStrict, newVoice(0, 0, false), false, true, false},
+		{ProfileStrict, newVoice(0, 4, false), true, true, false},
+		{ProfileLenient, newVoice(3, 4, false), false, true, true},
+		{ProfileKeyupAlways, newVoice(0, 0, false), false, true, false},
+		{ProfileKeyupAlways, newVoice(0, 0, true), false, false, false},
+	}
+
+	for _, tt := range tests {
+		profile, err := LookupProfile(tt.profile)
+		if err != nil {
+			t.Fatalf("LookupProfile(%s): %v", tt.profile, err)
+		}
+
+		err = profile.Inbound(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.profile, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tt.msg.Header.IsPTT() != tt.wantPTT {
+			t.Errorf("%s: PTT = %v, want %v", tt.profile, tt.msg.Header.IsPTT(), tt.wantPTT)
+		}
+		clean := tt.msg.Header.Memory == 0 && tt.msg.Header.MpxID == 0 && tt.msg.Header.Reserved == 0
+		if tt.wantClean && !clean {
+			t.Errorf("%s: header not normalized: %+v", tt.profile, tt.msg.Header)
+		}
+	}
+}
+
+func TestHeaderProfile_Outbound(t *testing.T) {
+	profile := &HeaderProfile{Name: "custom", MpxID: 2, KeyupAlwaysSet: true}
+
+	voice := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 1)}
+	voice.AudioData[10] = 500
+	profile.Outbound(voice)
+
+	if voice.Header.MpxID != 2 {
+		t.Errorf("MpxID = %d, want 2", voice.Header.MpxID)
+	}
+	if !voice.Header.IsPTT() {
+		t.Error("Expected keyup held on unkey frame")
+	}
+	if voice.AudioData[10] != 0 {
+		t.Error("Expected unkey frame to be silenced")
+	}
+
+	// Round trip through the same profile recovers the unkey
+	if err := profile.Inbound(voice); err != nil {
+		t.Fatal(err)
+	}
+	if voice.Header.IsPTT() {
+		t.Error("Expected inbound silent frame to read as unkey")
+	}
+}
+
+func TestHeaderProfile_NilAndUnknown(t *testing.T) {
+	var profile *HeaderProfile
+	voice := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 1)}
+	voice.Header.Reserved = 9
+	if err := profile.Inbound(voice); err != nil {
+		t.Errorf("Nil profile Inbound: %v", err)
+	}
+	profile.Outbound(voice)
+	if voice.Header.Reserved != 9 {
+		t.Error("Nil profile modified the header")
+	}
+
+	if _, err := LookupProfile("no-such-peer"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+	if len(ProfileNames()) != 4 {
+		t.Errorf("Expected 4 built-in profiles, got %v", ProfileNames())
+	}
+}
@@ -0,0 +1,48 @@
+package usrp
+
+import (
+	"net"
+	"time"
+)
+
+// Received wraps a parsed message with the metadata of its arrival, so
+// transports and routers can pass one value instead of threading the source
+// address and timing through separate parameters
+type Received struct {
+	Message Message   // Parsed message
+	Source  net.Addr  // Sender address (nil if unknown)
+	Time    time.Time // When the packet was read from the network
+	Length  int       // Size of the packet on the wire in bytes
+}
+
+// ParseReceived parses data with Parse and records its arrival metadata
+func ParseReceived(data []byte, source net.Addr, at time.Time) (*Received, error) {
+	msg, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Received{
+		Message: msg,
+		Source:  source,
+		Time:    at,
+		Length:  len(data),
+	}, nil
+}
+
+// Type returns the packet type of the wrapped message
+func (r *Received) Type() PacketType {
+	return r.Message.GetType()
+}
+
+// Age returns how long ago the packet was received
+func (r *Received) Age() time.Duration {
+	return time.Since(r.Time)
+}
+
+// SourceString returns the sender address as a string, or "" if unknown
+func (r *Received) SourceString() string {
+	if r.Source == nil {
+		return ""
+	}
+	return r.Source.String()
+}
@@ -0,0 +1,186 @@
+package usrp
+
+import (
+	"sync"
+	"time"
+)
+
+// frameDuration is the audio duration of one voice frame
+const frameDuration = 20 * time.Millisecond
+
+// maxSeqGap is the largest forward sequence jump counted as loss; bigger
+// jumps are treated as the peer restarting its counter
+const maxSeqGap = 1000
+
+// TrafficStats are the counters shared by talkgroup and source statistics
+type TrafficStats struct {
+	Packets    uint64        `json:"packets"`
+	Bytes      uint64        `json:"bytes"`
+	TalkTime   time.Duration `json:"talk_time"`    // Keyed voice audio received
+	Lost       uint64        `json:"lost"`         // Packets missing from sequence gaps
+	OutOfOrder uint64        `json:"out_of_order"` // Late or duplicate packets
+	LastSeen   time.Time     `json:"last_seen"`
+}
+
+// LossRate returns lost packets as a fraction of expected packets
+func (s TrafficStats) LossRate() float64 {
+	expected := s.Packets + s.Lost
+	if expected == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(expected)
+}
+
+// TalkGroupStats aggregates traffic seen on one talkgroup
+type TalkGroupStats struct {
+	TrafficStats
+	UniqueTalkers int `json:"unique_talkers"` // Distinct sources that keyed up
+}
+
+// SourceStats aggregates traffic from one source address
+type SourceStats struct {
+	TrafficStats
+	CallSign      string `json:"call_sign,omitempty"` // Last callsign announced via TLV
+	LastTalkGroup uint32 `json:"last_talk_group"`
+}
+
+// StatsSnapshot is a point-in-time copy of collected statistics
+type StatsSnapshot struct {
+	Since      time.Time                 `json:"since"`
+	Total      TrafficStats              `json:"total"`
+	TalkGroups map[uint32]TalkGroupStats `json:"talk_groups"`
+	Sources    map[string]SourceStats    `json:"sources"`
+}
+
+// StatsCollector aggregates received packets per talkgroup and per source.
+// It is safe for concurrent use.
+type StatsCollector struct {
+	since      time.Time
+	total      TrafficStats
+	talkGroups map[uint32]*talkGroupEntry
+	sources    map[string]*sourceEntry
+	mutex      sync.Mutex
+}
+
+type talkGroupEntry struct {
+	stats   TrafficStats
+	talkers map[string]struct{}
+}
+
+type sourceEntry struct {
+	stats   SourceStats
+	lastSeq uint32
+	haveSeq bool
+}
+
+// NewStatsCollector creates an empty collector
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		since:      time.Now(),
+		talkGroups: make(map[uint32]*talkGroupEntry),
+		sources:    make(map[string]*sourceEntry),
+	}
+}
+
+// Record accounts for a received packet
+func (c *StatsCollector) Record(rx *Received) {
+	c.Observe(rx.Message, rx.SourceString(), rx.Length, rx.Time)
+}
+
+// Observe accounts for a message of length bytes from source at time at.
+// Use Record when a Received is available.
+func (c *StatsCollector) Observe(msg Message, source string, length int, at time.Time) {
+	header := HeaderOf(msg)
+	if header == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	src := c.sources[source]
+	if src == nil {
+		src = &sourceEntry{}
+		c.sources[source] = src
+	}
+	tg := c.talkGroups[header.TalkGroup]
+	if tg == nil {
+		tg = &talkGroupEntry{talkers: make(map[string]struct{})}
+		c.talkGroups[header.TalkGroup] = tg
+	}
+
+	// Sequence accounting is per source, since each peer numbers its own packets
+	var lost, outOfOrder uint64
+	if src.haveSeq {
+		gap := int64(header.Seq) - int64(src.lastSeq)
+		switch {
+		case gap > 1 && gap <= maxSeqGap:
+			lost = uint64(gap - 1)
+		case gap <= 0 && gap > -maxSeqGap:
+			outOfOrder = 1
+		}
+	}
+	if outOfOrder == 0 {
+		src.lastSeq = header.Seq
+		src.haveSeq = true
+	}
+
+	var talk time.Duration
+	if header.IsPTT() {
+		switch msg.GetType() {
+		case USRP_TYPE_VOICE, USRP_TYPE_VOICE_ULAW, USRP_TYPE_VOICE_ADPCM:
+			talk = frameDuration
+			tg.talkers[source] = struct{}{}
+		}
+	}
+
+	if tlv, ok := msg.(*TLVMessage); ok {
+		if callsign, ok := tlv.GetCallsign(); ok {
+			src.stats.CallSign = callsign
+		}
+	}
+	src.stats.LastTalkGroup = header.TalkGroup
+
+	for _, s := range []*TrafficStats{&c.total, &tg.stats, &src.stats.TrafficStats} {
+		s.Packets++
+		s.Bytes += uint64(length)
+		s.TalkTime += talk
+		s.Lost += lost
+		s.OutOfOrder += outOfOrder
+		s.LastSeen = at
+	}
+}
+
+// Snapshot returns a copy of the current statistics
+func (c *StatsCollector) Snapshot() StatsSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	snap := StatsSnapshot{
+		Since:      c.since,
+		Total:      c.total,
+		TalkGroups: make(map[uint32]TalkGroupStats, len(c.talkGroups)),
+		Sources:    make(map[string]SourceStats, len(c.sources)),
+	}
+	for id, tg := range c.talkGroups {
+		snap.TalkGroups[id] = TalkGroupStats{
+			TrafficStats:  tg.stats,
+			UniqueTalkers: len(tg.talkers),
+		}
+	}
+	for addr, src := range c.sources {
+		snap.Sources[addr] = src.stats
+	}
+	return snap
+}
+
+// Reset clears all statistics
+func (c *StatsCollector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.since = time.Now()
+	c.total = TrafficStats{}
+	c.talkGroups = make(map[uint32]*talkGroupEntry)
+	c.sources = make(map[string]*sourceEntry)
+}
@@ -0,0 +1,94 @@
+package usrp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func voiceFrom(t *testing.T, seq, tg uint32, ptt bool, source string) *Received {
+	t.Helper()
+	msg := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, seq)}
+	msg.Header.TalkGroup = tg
+	msg.Header.SetPTT(ptt)
+	addr, err := net.ResolveUDPAddr("udp", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Received{Message: msg, Source: addr, Time: time.Now(), Length: HeaderSize + VoiceFrameSize*2}
+}
+
+func TestStatsCollector_PerTalkGroupAndSource(t *testing.T) {
+	c := NewStatsCollector()
+	a, b := "10.0.0.1:34001", "10.0.0.2:34001"
+
+	// Source A: seq 1-10 on TG 3100, with 4 and 5 lost
+	for seq := uint32(1); seq <= 10; seq++ {
+		if seq == 4 || seq == 5 {
+			continue
+		}
+		c.Record(voiceFrom(t, seq, 3100, true, a))
+	}
+	// Source B: 5 keyed frames on TG 3100, then unkey on TG 91
+	for seq := uint32(1); seq <= 5; seq++ {
+		c.Record(voiceFrom(t, seq, 3100, true, b))
+	}
+	c.Record(voiceFrom(t, 6, 91, false, b))
+	// Late duplicate from A
+	c.Record(voiceFrom(t, 3, 3100, true, a))
+
+	snap := c.Snapshot()
+
+	tg := snap.TalkGroups[3100]
+	if tg.Packets != 14 {
+		t.Errorf("TG 3100 packets: got %d, want 14", tg.Packets)
+	}
+	if tg.UniqueTalkers != 2 {
+		t.Errorf("TG 3100 talkers: got %d, want 2", tg.UniqueTalkers)
+	}
+	if tg.TalkTime != 14*frameDuration {
+		t.Errorf("TG 3100 talk time: got %v, want %v", tg.TalkTime, 14*frameDuration)
+	}
+	if tg.Lost != 2 || tg.OutOfOrder != 1 {
+		t.Errorf("TG 3100 lost/out-of-order: got %d/%d, want 2/1", tg.Lost, tg.OutOfOrder)
+	}
+
+	if tg91 := snap.TalkGroups[91]; tg91.Packets != 1 || tg91.UniqueTalkers != 0 || tg91.TalkTime != 0 {
+		t.Errorf("TG 91 unexpected stats: %+v", tg91)
+	}
+
+	srcA := snap.Sources[a]
+	if srcA.Packets != 9 || srcA.Lost != 2 {
+		t.Errorf("Source A: got %d packets / %d lost, want 9/2", srcA.Packets, srcA.Lost)
+	}
+	if rate := srcA.LossRate(); rate < 0.18 || rate > 0.19 {
+		t.Errorf("Source A loss rate: got %.3f, want 2/11", rate)
+	}
+	if srcB := snap.Sources[b]; srcB.LastTalkGroup != 91 {
+		t.Errorf("Source B last talkgroup: got %d, want 91", srcB.LastTalkGroup)
+	}
+
+	if snap.Total.Packets != 15 {
+		t.Errorf("Total packets: got %d, want 15", snap.Total.Packets)
+	}
+}
+
+func TestStatsCollector_CallsignAndReset(t *testing.T) {
+	c := NewStatsCollector()
+
+	tlv, err := NewTLV(1).Callsign("W1AW").TalkGroup(3100).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Observe(tlv, "peer", 40, time.Now())
+
+	if got := c.Snapshot().Sources["peer"].CallSign; got != "W1AW" {
+		t.Errorf("Callsign: got %q, want W1AW", got)
+	}
+
+	c.Reset()
+	snap := c.Snapshot()
+	if snap.Total.Packets != 0 || len(snap.Sources) != 0 || len(snap.TalkGroups) != 0 {
+		t.Errorf("Expected empty snapshot after reset, got %+v", snap)
+	}
+}
@@ -0,0 +1,112 @@
+package usrp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// TLVBuilder builds TLV messages with chainable calls:
+//
+//	msg, err := usrp.NewTLV(seq).Callsign("W1AW").TalkGroup(3100).Build()
+//
+// The first error encountered (e.g. an oversized value) is kept and returned
+// by Build; later calls become no-ops.
+type TLVBuilder struct {
+	msg *TLVMessage
+	err error
+}
+
+// NewTLV starts a TLV message with the given sequence number
+func NewTLV(seq uint32) *TLVBuilder {
+	return &TLVBuilder{
+		msg: &TLVMessage{Header: NewHeader(USRP_TYPE_TLV, seq)},
+	}
+}
+
+// Tag appends a raw TLV item
+func (b *TLVBuilder) Tag(tag TLVTag, value []byte) *TLVBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(value) > math.MaxUint16 {
+		b.err = fmt.Errorf("TLV tag 0x%02x value too long: %d bytes", uint8(tag), len(value))
+		return b
+	}
+	b.msg.AddTLV(tag, value)
+	return b
+}
+
+// Callsign appends the station callsign (TLV_TAG_SET_INFO)
+func (b *TLVBuilder) Callsign(callsign string) *TLVBuilder {
+	if callsign == "" {
+		if b.err == nil {
+			b.err = fmt.Errorf("empty callsign")
+		}
+		return b
+	}
+	return b.Tag(TLV_TAG_SET_INFO, []byte(callsign))
+}
+
+// TalkGroup sets the talkgroup in the message header
+func (b *TLVBuilder) TalkGroup(tg uint32) *TLVBuilder {
+	b.msg.Header.TalkGroup = tg
+	return b
+}
+
+// PTT sets the keyup state in the message header
+func (b *TLVBuilder) PTT(on bool) *TLVBuilder {
+	b.msg.Header.SetPTT(on)
+	return b
+}
+
+// BeginTX appends a DVSwitch begin-of-transmission marker
+func (b *TLVBuilder) BeginTX() *TLVBuilder {
+	return b.Tag(TLV_TAG_BEGIN_TX, nil)
+}
+
+// EndTX appends a DVSwitch end-of-transmission marker
+func (b *TLVBuilder) EndTX() *TLVBuilder {
+	return b.Tag(TLV_TAG_END_TX, nil)
+}
+
+// TGTune appends a DVSwitch talkgroup tune request
+func (b *TLVBuilder) TGTune(tg uint32) *TLVBuilder {
+	return b.Tag(TLV_TAG_TG_TUNE, []byte(strconv.FormatUint(uint64(tg), 10)))
+}
+
+// RemoteCommand appends a DVSwitch remote control command
+func (b *TLVBuilder) RemoteCommand(command string) *TLVBuilder {
+	return b.Tag(TLV_TAG_REMOTE_CMD, []byte(command))
+}
+
+// Build returns the finished message, or the first error recorded while
+// building it
+func (b *TLVBuilder) Build() (*TLVMessage, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := b.msg.Validate(); err != nil {
+		return nil, err
+	}
+	return b.msg, nil
+}
+
+// GetTGTune retrieves a DVSwitch talkgroup tune request from a TLV message
+func (tlv *TLVMessage) GetTGTune() (uint32, bool) {
+	value, ok := tlv.GetTLV(TLV_TAG_TG_TUNE)
+	if !ok {
+		return 0, false
+	}
+	tg, err := strconv.ParseUint(string(value), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(tg), true
+}
+
+// HasTag reports whether the message contains an item with the given tag
+func (tlv *TLVMessage) HasTag(tag TLVTag) bool {
+	_, ok := tlv.GetTLV(tag)
+	return ok
+}
@@ -0,0 +1,87 @@
+package usrp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTLVBuilder_RoundTrip(t *testing.T) {
+	msg, err := NewTLV(42).Callsign("W1AW").TalkGroup(3100).PTT(true).TGTune(91).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	decoded := &TLVMessage{}
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if decoded.Header.Seq != 42 {
+		t.Errorf("Seq mismatch: got %d, want 42", decoded.Header.Seq)
+	}
+	if decoded.Header.TalkGroup != 3100 {
+		t.Errorf("TalkGroup mismatch: got %d, want 3100", decoded.Header.TalkGroup)
+	}
+	if !decoded.Header.IsPTT() {
+		t.Error("Expected PTT to be set")
+	}
+	if callsign, ok := decoded.GetCallsign(); !ok || callsign != "W1AW" {
+		t.Errorf("Callsign mismatch: got %q (found=%v)", callsign, ok)
+	}
+	if tg, ok := decoded.GetTGTune(); !ok || tg != 91 {
+		t.Errorf("TG tune mismatch: got %d (found=%v)", tg, ok)
+	}
+}
+
+func TestTLVBuilder_TransmissionMarkers(t *testing.T) {
+	msg, err := NewTLV(1).BeginTX().RemoteCommand("txTg=3100").EndTX().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if len(msg.TLVs) != 3 {
+		t.Fatalf("Expected 3 TLV items, got %d", len(msg.TLVs))
+	}
+	wantTags := []TLVTag{TLV_TAG_BEGIN_TX, TLV_TAG_REMOTE_CMD, TLV_TAG_END_TX}
+	for i, tag := range wantTags {
+		if msg.TLVs[i].Tag != tag {
+			t.Errorf("Item %d: got tag 0x%02x, want 0x%02x", i, msg.TLVs[i].Tag, tag)
+		}
+	}
+	if !msg.HasTag(TLV_TAG_BEGIN_TX) || msg.HasTag(TLV_TAG_TG_TUNE) {
+		t.Error("HasTag reported unexpected results")
+	}
+	if value, _ := msg.GetTLV(TLV_TAG_REMOTE_CMD); !bytes.Equal(value, []byte("txTg=3100")) {
+		t.Errorf("Remote command mismatch: got %q", value)
+	}
+}
+
+func TestTLVBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *TLVBuilder
+		wantErr string
+	}{
+		{"empty callsign", NewTLV(1).Callsign(""), "empty callsign"},
+		{"oversized value", NewTLV(1).Tag(TLV_TAG_FILE_XFER, make([]byte, 70000)), "too long"},
+		{"first error kept", NewTLV(1).Callsign("").Tag(TLV_TAG_FILE_XFER, make([]byte, 70000)), "empty callsign"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.builder.Build()
+			if err == nil {
+				t.Fatalf("Expected error, got message %+v", msg)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package usrp
+
+// G.711 μ-law constants
+const (
+	ulawBias = 0x84  // Bias added before segment lookup
+	ulawClip = 32635 // Largest magnitude that survives the bias
+)
+
+// ulawDecodeTable maps every μ-law byte to its linear PCM value
+var ulawDecodeTable = func() [256]int16 {
+	var table [256]int16
+	for i := range table {
+		u := ^byte(i)
+		exponent := (u >> 4) & 0x07
+		mantissa := int32(u & 0x0F)
+		sample := ((mantissa << 3) + ulawBias) << exponent
+		sample -= ulawBias
+		if u&0x80 != 0 {
+			sample = -sample
+		}
+		table[i] = int16(sample)
+	}
+	return table
+}()
+
+// ULawEncode converts a 16-bit linear PCM sample to G.711 μ-law
+func ULawEncode(sample int16) byte {
+	s := int32(sample)
+	var sign byte
+	if s < 0 {
+		sign = 0x80
+		s = -s
+	}
+	if s > ulawClip {
+		s = ulawClip
+	}
+	s += ulawBias
+
+	// Find the segment: position of the highest set bit above bit 7
+	exponent := byte(7)
+	for mask := int32(0x4000); s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := byte(s>>(exponent+3)) & 0x0F
+
+	return ^(sign | exponent<<4 | mantissa)
+}
+
+// ULawDecode converts a G.711 μ-law byte to a 16-bit linear PCM sample
+func ULawDecode(u byte) int16 {
+	return ulawDecodeTable[u]
+}
+
+// ToPCM decodes the μ-law frame into a linear PCM VoiceMessage. The header is
+// copied with the packet type changed to USRP_TYPE_VOICE.
+func (u *VoiceULawMessage) ToPCM() *VoiceMessage {
+	voice := &VoiceMessage{Header: u.Header}
+	voice.Header.Type = uint32(USRP_TYPE_VOICE)
+
+	for i, b := range u.AudioData {
+		voice.AudioData[i] = ulawDecodeTable[b]
+	}
+	return voice
+}
+
+// FromPCM encodes a linear PCM VoiceMessage into this μ-law message. The
+// header is copied with the packet type changed to USRP_TYPE_VOICE_ULAW.
+func (u *VoiceULawMessage) FromPCM(voice *VoiceMessage) {
+	u.Header = voice.Header
+	u.Header.Type = uint32(USRP_TYPE_VOICE_ULAW)
+
+	for i, sample := range voice.AudioData {
+		u.AudioData[i] = ULawEncode(sample)
+	}
+}
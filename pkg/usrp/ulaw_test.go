@@ -0,0 +1,87 @@
+package usrp
+
+import (
+	"testing"
+)
+
+func TestULaw_KnownValues(t *testing.T) {
+	tests := []struct {
+		sample int16
+		ulaw   byte
+	}{
+		{0, 0xFF},
+		{-1, 0x7F},
+		{32767, 0x80},
+		{-32768, 0x00},
+		{1000, 0xCE},
+	}
+
+	for _, tt := range tests {
+		if got := ULawEncode(tt.sample); got != tt.ulaw {
+			t.Errorf("ULawEncode(%d) = 0x%02x, want 0x%02x", tt.sample, got, tt.ulaw)
+		}
+	}
+
+	if got := ULawDecode(0xFF); got != 0 {
+		t.Errorf("ULawDecode(0xFF) = %d, want 0", got)
+	}
+	if got := ULawDecode(0x80); got != 32124 {
+		t.Errorf("ULawDecode(0x80) = %d, want 32124", got)
+	}
+	if got := ULawDecode(0x00); got != -32124 {
+		t.Errorf("ULawDecode(0x00) = %d, want -32124", got)
+	}
+}
+
+func TestULaw_RoundTripError(t *testing.T) {
+	// μ-law quantization error grows with magnitude but stays within ~3%
+	for s := -32768; s <= 32767; s += 7 {
+		decoded := int(ULawDecode(ULawEncode(int16(s))))
+		diff := decoded - s
+		if diff < 0 {
+			diff = -diff
+		}
+		limit := 16
+		if mag := s; mag < 0 {
+			limit += -mag / 32
+		} else {
+			limit += mag / 32
+		}
+		if s > ulawClip || s < -ulawClip {
+			limit += 1024
+		}
+		if diff > limit {
+			t.Fatalf("Round trip error too large for %d: got %d (diff %d)", s, decoded, diff)
+		}
+	}
+}
+
+func TestVoiceULawMessage_PCMConversion(t *testing.T) {
+	voice := &VoiceMessage{Header: NewHeader(USRP_TYPE_VOICE, 77)}
+	voice.Header.SetPTT(true)
+	voice.Header.TalkGroup = 3100
+	for i := range voice.AudioData {
+		voice.AudioData[i] = int16((i - 80) * 200)
+	}
+
+	ulaw := &VoiceULawMessage{}
+	ulaw.FromPCM(voice)
+
+	if err := ulaw.Validate(); err != nil {
+		t.Fatalf("Encoded message invalid: %v", err)
+	}
+	if ulaw.Header.Seq != 77 || ulaw.Header.TalkGroup != 3100 || !ulaw.Header.IsPTT() {
+		t.Errorf("Header not preserved: %+v", ulaw.Header)
+	}
+
+	back := ulaw.ToPCM()
+	if err := back.Validate(); err != nil {
+		t.Fatalf("Decoded message invalid: %v", err)
+	}
+	for i, sample := range back.AudioData {
+		diff := int(sample) - int(voice.AudioData[i])
+		if diff < -600 || diff > 600 {
+			t.Errorf("Sample %d: got %d, want ~%d", i, sample, voice.AudioData[i])
+		}
+	}
+}
@@ -8,14 +8,14 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"net"
 	"os"
-	"os/signal"
+	ossignal "os/signal"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/dbehnke/usrp-go/pkg/audio/signal"
 	"github.com/dbehnke/usrp-go/pkg/usrp"
 )
 
@@ -48,7 +48,7 @@ type AllStarMock struct {
 	sampleRate  int
 	frameSize   int
 	sequenceNum uint32
-	audioPhase  float64
+	generator   signal.Generator
 
 	// Control
 	running   bool
@@ -83,6 +83,12 @@ func NewAllStarMock(nodeID uint32, callsign string) *AllStarMock {
 }
 
 func (a *AllStarMock) Start() error {
+	generator, err := signal.New(patternSpec(a.pattern, a.sampleRate))
+	if err != nil {
+		return fmt.Errorf("failed to create %s generator: %w", a.pattern, err)
+	}
+	a.generator = generator
+
 	// Set up UDP listener
 	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", a.listenPort))
 	if err != nil {
@@ -236,100 +242,31 @@ func (a *AllStarMock) generateAudio() {
 
 func (a *AllStarMock) generateAudioFrame() []int16 {
 	audioData := make([]int16, a.frameSize)
+	a.generator.Fill(audioData)
+	return audioData
+}
 
-	switch a.pattern {
-	case PatternSilence:
-		// Already zero-initialized
-
+// patternSpec returns the reference signal of a test pattern; unknown
+// patterns are silent
+func patternSpec(pattern TestPattern, sampleRate int) signal.Spec {
+	spec := signal.Spec{Pattern: signal.PatternSilence, SampleRate: sampleRate}
+	switch pattern {
 	case PatternSine440Hz:
-		a.generateSineWave(audioData, 440.0)
-
+		spec.Pattern, spec.Frequency, spec.Amplitude = signal.PatternSine, 440, 0.25
 	case PatternSine1kHz:
-		a.generateSineWave(audioData, 1000.0)
-
+		spec.Pattern, spec.Frequency, spec.Amplitude = signal.PatternSine, 1000, 0.25
 	case PatternWhiteNoise:
-		a.generateWhiteNoise(audioData)
-
+		spec.Pattern, spec.Amplitude = signal.PatternNoise, 0.06
 	case PatternSweep:
-		a.generateFrequencySweep(audioData)
-
+		// 300Hz to 3kHz over 10 seconds
+		spec.Pattern, spec.Frequency, spec.EndFrequency = signal.PatternSweep, 300, 3000
+		spec.Period, spec.Amplitude = 10*time.Second, 0.25
 	case PatternDTMF:
-		a.generateDTMF(audioData)
-
-	default:
-		// Silence for unknown patterns
-	}
-
-	return audioData
-}
-
-func (a *AllStarMock) generateSineWave(audioData []int16, frequency float64) {
-	amplitude := int16(8000) // -6dB from full scale
-
-	for i := 0; i < len(audioData); i++ {
-		sample := amplitude * int16(math.Sin(a.audioPhase))
-		audioData[i] = sample
-
-		a.audioPhase += 2.0 * math.Pi * frequency / float64(a.sampleRate)
-		if a.audioPhase > 2.0*math.Pi {
-			a.audioPhase -= 2.0 * math.Pi
-		}
-	}
-}
-
-func (a *AllStarMock) generateWhiteNoise(audioData []int16) {
-	amplitude := int16(2000) // Lower amplitude for noise
-
-	for i := 0; i < len(audioData); i++ {
-		// Simple pseudo-random noise
-		a.audioPhase = math.Mod(a.audioPhase*1103515245+12345, 4294967296)
-		sample := amplitude * int16((int(a.audioPhase)%32768-16384)/16384)
-		audioData[i] = sample
-	}
-}
-
-func (a *AllStarMock) generateFrequencySweep(audioData []int16) {
-	// Sweep from 300Hz to 3kHz over 10 seconds
-	startFreq := 300.0
-	endFreq := 3000.0
-
-	elapsed := float64(time.Since(a.stats.startTime).Nanoseconds()) / 1e9
-	progress := math.Mod(elapsed, 10.0) / 10.0 // Reset every 10 seconds
-
-	currentFreq := startFreq + (endFreq-startFreq)*progress
-	a.generateSineWave(audioData, currentFreq)
-}
-
-func (a *AllStarMock) generateDTMF(audioData []int16) {
-	// Generate DTMF sequence: "1234567890*#"
-	dtmfDigits := "1234567890*#"
-
-	elapsed := int(time.Since(a.stats.startTime).Seconds())
-	digitIndex := (elapsed / 2) % len(dtmfDigits)
-
-	// DTMF frequencies (row, column)
-	dtmfFreqs := map[rune][2]float64{
-		'1': {697, 1209}, '2': {697, 1336}, '3': {697, 1477},
-		'4': {770, 1209}, '5': {770, 1336}, '6': {770, 1477},
-		'7': {852, 1209}, '8': {852, 1336}, '9': {852, 1477},
-		'*': {941, 1209}, '0': {941, 1336}, '#': {941, 1477},
-	}
-
-	digit := rune(dtmfDigits[digitIndex])
-	if freqs, ok := dtmfFreqs[digit]; ok {
-		amplitude := int16(4000)
-
-		for i := 0; i < len(audioData); i++ {
-			sample1 := amplitude * int16(math.Sin(a.audioPhase)) / 2
-			sample2 := amplitude * int16(math.Sin(a.audioPhase*freqs[1]/freqs[0])) / 2
-			audioData[i] = sample1 + sample2
-
-			a.audioPhase += 2.0 * math.Pi * freqs[0] / float64(a.sampleRate)
-			if a.audioPhase > 2.0*math.Pi {
-				a.audioPhase -= 2.0 * math.Pi
-			}
-		}
+		// Each digit for 2 seconds
+		spec.Pattern, spec.Digits = signal.PatternDTMF, "1234567890*#"
+		spec.Period, spec.Amplitude = 2*time.Second, 0.12
 	}
+	return spec
 }
 
 func (a *AllStarMock) sendUSRPPacket(msg usrp.Message) error {
@@ -437,7 +374,7 @@ func main() {
 
 	// Handle shutdown
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ossignal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	<-sigChan
 	log.Println("Shutting down...")
@@ -1,5 +0,0 @@
-module allstar-mock
-
-go 1.25.0
-
-require github.com/dbehnke/usrp-go v0.0.0-20250902042351-db94799836d1
@@ -121,11 +121,11 @@ run_test_with_output "USRP bridge config generation" \
 echo ""
 echo "$(blue "🎛️ Audio Router Tests")"
 run_test_with_output "Audio router help" \
-    "go run cmd/audio-router/main.go --help || true" \
+    "go run ./cmd/audio-router --help || true" \
     "Usage"
 
 run_test_with_output "Audio router config generation" \
-    "go run cmd/audio-router/main.go -generate-config" \
+    "go run ./cmd/audio-router -generate-config" \
     "audio-router.json"
 
 echo ""